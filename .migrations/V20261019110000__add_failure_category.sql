@@ -0,0 +1,2 @@
+ALTER TABLE task ADD COLUMN IF NOT EXISTS failure_category varchar;
+CREATE INDEX IF NOT EXISTS ix_task_failure_category ON task(failure_category);
@@ -0,0 +1 @@
+ALTER TABLE cluster_state ADD COLUMN IF NOT EXISTS scheduling_policy jsonb;
@@ -0,0 +1,8 @@
+ALTER TABLE task ADD COLUMN IF NOT EXISTS array_parent_id varchar;
+ALTER TABLE task ADD COLUMN IF NOT EXISTS array_index integer;
+ALTER TABLE task ADD COLUMN IF NOT EXISTS array_status jsonb;
+CREATE INDEX IF NOT EXISTS ix_task_array_parent_id ON task(array_parent_id);
+
+INSERT INTO worker (worker_type, count_per_instance, engine)
+SELECT 'array', 1, 'eks'
+WHERE NOT EXISTS (SELECT 1 FROM worker WHERE worker_type = 'array');
@@ -0,0 +1,2 @@
+ALTER TABLE task ADD COLUMN IF NOT EXISTS replicas integer;
+ALTER TABLE task ADD COLUMN IF NOT EXISTS replica_pods jsonb;
@@ -0,0 +1,6 @@
+ALTER TABLE task_def ADD COLUMN IF NOT EXISTS init_containers jsonb;
+ALTER TABLE task_def ADD COLUMN IF NOT EXISTS sidecars jsonb;
+ALTER TABLE task_def ADD COLUMN IF NOT EXISTS shared_volumes jsonb;
+ALTER TABLE template ADD COLUMN IF NOT EXISTS init_containers jsonb;
+ALTER TABLE template ADD COLUMN IF NOT EXISTS sidecars jsonb;
+ALTER TABLE template ADD COLUMN IF NOT EXISTS shared_volumes jsonb;
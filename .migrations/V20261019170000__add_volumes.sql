@@ -0,0 +1,4 @@
+ALTER TABLE task_def ADD COLUMN IF NOT EXISTS volumes jsonb;
+ALTER TABLE template ADD COLUMN IF NOT EXISTS volumes jsonb;
+ALTER TABLE task ADD COLUMN IF NOT EXISTS volumes jsonb;
+ALTER TABLE cluster_state ADD COLUMN IF NOT EXISTS volume_policy jsonb;
@@ -0,0 +1,2 @@
+ALTER TABLE task ADD COLUMN IF NOT EXISTS artifacts jsonb;
+ALTER TABLE task ADD COLUMN IF NOT EXISTS result jsonb;
@@ -0,0 +1,5 @@
+ALTER TABLE task ADD COLUMN IF NOT EXISTS attempts jsonb;
+
+INSERT INTO worker (worker_type, count_per_instance, engine)
+SELECT 'interruption', 1, 'eks'
+WHERE NOT EXISTS (SELECT 1 FROM worker WHERE worker_type = 'interruption');
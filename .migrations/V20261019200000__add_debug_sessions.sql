@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS debug_session (
+    session_id varchar PRIMARY KEY,
+    run_id varchar NOT NULL,
+    mode varchar NOT NULL,
+    user_name varchar NOT NULL DEFAULT '',
+    cluster_name varchar NOT NULL,
+    namespace varchar NOT NULL,
+    job_name varchar NOT NULL DEFAULT '',
+    pod_name varchar NOT NULL DEFAULT '',
+    container varchar NOT NULL,
+    image varchar NOT NULL,
+    created_at timestamp with time zone NOT NULL,
+    expires_at timestamp with time zone NOT NULL,
+    terminated_at timestamp with time zone,
+    terminated_by varchar,
+    execs jsonb
+);
+CREATE INDEX IF NOT EXISTS ix_debug_session_run_id ON debug_session(run_id);
@@ -0,0 +1,9 @@
+ALTER TABLE template ADD COLUMN IF NOT EXISTS deprecation jsonb;
+CREATE TABLE IF NOT EXISTS template_channel (
+    template_name varchar NOT NULL,
+    channel varchar NOT NULL,
+    version integer NOT NULL,
+    updated_by varchar NOT NULL DEFAULT '',
+    updated_at timestamp with time zone NOT NULL,
+    PRIMARY KEY (template_name, channel)
+);
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS setting (
+    key varchar PRIMARY KEY,
+    value jsonb NOT NULL,
+    updated_by varchar NOT NULL DEFAULT '',
+    updated_at timestamp with time zone NOT NULL
+);
+CREATE TABLE IF NOT EXISTS setting_change (
+    id bigserial PRIMARY KEY,
+    key varchar NOT NULL,
+    value jsonb,
+    previous_value jsonb,
+    reason varchar NOT NULL DEFAULT '',
+    updated_by varchar NOT NULL DEFAULT '',
+    updated_at timestamp with time zone NOT NULL
+);
+CREATE INDEX IF NOT EXISTS ix_setting_change_key ON setting_change(key, id DESC);
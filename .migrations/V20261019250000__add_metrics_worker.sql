@@ -0,0 +1,3 @@
+INSERT INTO worker (worker_type, count_per_instance, engine)
+SELECT 'metrics', 1, 'eks'
+WHERE NOT EXISTS (SELECT 1 FROM worker WHERE worker_type = 'metrics');
@@ -0,0 +1,6 @@
+ALTER TABLE task ADD COLUMN IF NOT EXISTS pending_at timestamp with time zone;
+ALTER TABLE task ADD COLUMN IF NOT EXISTS running_at timestamp with time zone;
+
+INSERT INTO worker (worker_type, count_per_instance, engine)
+SELECT 'analytics', 1, 'eks'
+WHERE NOT EXISTS (SELECT 1 FROM worker WHERE worker_type = 'analytics');
@@ -0,0 +1,19 @@
+ALTER TABLE worker ADD COLUMN IF NOT EXISTS scope character varying DEFAULT 'instance';
+UPDATE worker SET scope = 'leader' WHERE worker_type IN ('retry', 'interruption', 'metrics', 'analytics');
+
+CREATE TABLE IF NOT EXISTS worker_instance (
+  instance_id character varying PRIMARY KEY,
+  hostname character varying,
+  started_at timestamp with time zone,
+  heartbeat_at timestamp with time zone,
+  workers jsonb
+);
+
+CREATE INDEX IF NOT EXISTS ix_worker_instance_heartbeat_at ON worker_instance(heartbeat_at);
+
+CREATE TABLE IF NOT EXISTS worker_lease (
+  name character varying PRIMARY KEY,
+  holder character varying NOT NULL,
+  acquired_at timestamp with time zone,
+  expires_at timestamp with time zone NOT NULL
+);
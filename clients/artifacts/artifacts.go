@@ -0,0 +1,51 @@
+package artifacts
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/stitchfix/flotilla-os/config"
+	flotillaLog "github.com/stitchfix/flotilla-os/log"
+	"github.com/stitchfix/flotilla-os/state"
+)
+
+// Client lists and serves the artifacts runs put under their output URI.
+type Client interface {
+	Name() string
+	Initialize(conf config.Config) error
+	OutputURI(runID string) string
+	Manifest(ctx context.Context, runID string) (state.ArtifactManifest, error)
+	Result(ctx context.Context, runID string) (*state.RunResult, error)
+	Download(ctx context.Context, runID string, path string, w http.ResponseWriter) error
+}
+
+// NewArtifactsClient creates and initializes a run artifacts client, nil
+// when no artifacts bucket is configured.
+func NewArtifactsClient(conf config.Config, logger flotillaLog.Logger) (Client, error) {
+	if !conf.IsSet("artifacts_s3_bucket") {
+		return nil, nil
+	}
+	_ = logger.Log("level", "info", "message", "Initializing artifacts client", "client", "s3")
+	client := &S3ArtifactsClient{}
+	if err := client.Initialize(conf); err != nil {
+		return nil, errors.Wrap(err, "problem initializing S3ArtifactsClient")
+	}
+	return client, nil
+}
+
+// OutputURI returns the output URI of runs, empty when no artifacts bucket
+// is configured.
+func OutputURI(conf config.Config, runID string) string {
+	if !conf.IsSet("artifacts_s3_bucket") {
+		return ""
+	}
+	return state.OutputURI(conf.GetString("artifacts_s3_bucket"), rootDir(conf), runID)
+}
+
+func rootDir(conf config.Config) string {
+	if conf.IsSet("artifacts_s3_root_dir") {
+		return conf.GetString("artifacts_s3_root_dir")
+	}
+	return "artifacts"
+}
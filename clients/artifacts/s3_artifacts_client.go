@@ -0,0 +1,166 @@
+package artifacts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pkg/errors"
+	"github.com/stitchfix/flotilla-os/config"
+	"github.com/stitchfix/flotilla-os/exceptions"
+	"github.com/stitchfix/flotilla-os/state"
+	awstrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/aws/aws-sdk-go/aws"
+)
+
+type s3Client interface {
+	ListObjectsV2PagesWithContext(ctx aws.Context, input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool, opts ...request.Option) error
+	GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error)
+}
+
+// S3ArtifactsClient serves the artifacts runs put under
+// s3://<artifacts_s3_bucket>/<artifacts_s3_root_dir>/<run id>/
+type S3ArtifactsClient struct {
+	s3Client      s3Client
+	bucket        string
+	rootDir       string
+	maxArtifacts  int
+	maxResultSize int64
+}
+
+// Name returns the name of the artifacts client
+func (ac *S3ArtifactsClient) Name() string {
+	return "s3"
+}
+
+// Initialize sets up the S3ArtifactsClient
+func (ac *S3ArtifactsClient) Initialize(conf config.Config) error {
+	awsRegion := conf.GetString("aws_default_region")
+	if len(awsRegion) == 0 {
+		return errors.Errorf("S3ArtifactsClient needs [aws_default_region] set in config")
+	}
+	if conf.GetString("flotilla_mode") != "test" {
+		sess := awstrace.WrapSession(session.Must(session.NewSession(&aws.Config{
+			Region: aws.String(awsRegion)})))
+		ac.s3Client = s3.New(sess, aws.NewConfig().WithRegion(awsRegion))
+	}
+	ac.bucket = conf.GetString("artifacts_s3_bucket")
+	ac.rootDir = rootDir(conf)
+
+	ac.maxArtifacts = 1000
+	if conf.IsSet("artifacts_max_count") {
+		ac.maxArtifacts = conf.GetInt("artifacts_max_count")
+	}
+	ac.maxResultSize = 64 * 1024
+	if conf.IsSet("artifacts_max_result_size") {
+		ac.maxResultSize = int64(conf.GetInt("artifacts_max_result_size"))
+	}
+	return nil
+}
+
+// OutputURI returns the S3 URI the run puts its artifacts under
+func (ac *S3ArtifactsClient) OutputURI(runID string) string {
+	return state.OutputURI(ac.bucket, ac.rootDir, runID)
+}
+
+// Manifest lists the artifacts of the run, up to artifacts_max_count of them
+func (ac *S3ArtifactsClient) Manifest(ctx context.Context, runID string) (state.ArtifactManifest, error) {
+	prefix := state.ArtifactsPrefix(ac.rootDir, runID)
+	manifest := state.ArtifactManifest{URI: ac.OutputURI(runID), Artifacts: []state.Artifact{}}
+	err := ac.s3Client.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(ac.bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			if len(manifest.Artifacts) >= ac.maxArtifacts {
+				manifest.Truncated = true
+				return false
+			}
+			artifact := state.Artifact{
+				Path:     strings.TrimPrefix(aws.StringValue(object.Key), prefix),
+				Size:     aws.Int64Value(object.Size),
+				Checksum: strings.Trim(aws.StringValue(object.ETag), `"`),
+			}
+			if object.LastModified != nil {
+				artifact.LastModified = *object.LastModified
+			}
+			manifest.Artifacts = append(manifest.Artifacts, artifact)
+			manifest.TotalSize += artifact.Size
+		}
+		return true
+	})
+	if err != nil {
+		return manifest, errors.Wrapf(err, "problem listing artifacts of run [%s]", runID)
+	}
+	return manifest, nil
+}
+
+// Result returns the result document of the run, nil when the run didn't
+// output one
+func (ac *S3ArtifactsClient) Result(ctx context.Context, runID string) (*state.RunResult, error) {
+	object, err := ac.getObject(ctx, runID, state.ResultFileName)
+	if err != nil {
+		if _, ok := err.(exceptions.MissingResource); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer object.Body.Close()
+	if aws.Int64Value(object.ContentLength) > ac.maxResultSize {
+		return nil, errors.Errorf("result of run [%s] exceeds %d bytes", runID, ac.maxResultSize)
+	}
+
+	var result state.RunResult
+	if err = json.NewDecoder(io.LimitReader(object.Body, ac.maxResultSize)).Decode(&result); err != nil {
+		return nil, errors.Wrapf(err, "result of run [%s] isn't a JSON object", runID)
+	}
+	return &result, nil
+}
+
+// Download streams an artifact of the run
+func (ac *S3ArtifactsClient) Download(ctx context.Context, runID string, artifactPath string, w http.ResponseWriter) error {
+	object, err := ac.getObject(ctx, runID, artifactPath)
+	if err != nil {
+		return err
+	}
+	defer object.Body.Close()
+
+	contentType := aws.StringValue(object.ContentType)
+	if len(contentType) == 0 {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base(artifactPath)))
+	if object.ContentLength != nil {
+		w.Header().Set("Content-Length", strconv.FormatInt(*object.ContentLength, 10))
+	}
+	_, err = io.Copy(w, object.Body)
+	return err
+}
+
+func (ac *S3ArtifactsClient) getObject(ctx context.Context, runID string, artifactPath string) (*s3.GetObjectOutput, error) {
+	if !state.ValidArtifactPath(artifactPath) {
+		return nil, exceptions.MalformedInput{ErrorString: fmt.Sprintf("invalid artifact path [%s]", artifactPath)}
+	}
+	object, err := ac.s3Client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(ac.bucket),
+		Key:    aws.String(state.ArtifactsPrefix(ac.rootDir, runID) + artifactPath),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, exceptions.MissingResource{
+				ErrorString: fmt.Sprintf("run [%s] has no artifact [%s]", runID, artifactPath)}
+		}
+		return nil, errors.Wrapf(err, "problem getting artifact [%s] of run [%s]", artifactPath, runID)
+	}
+	return object, nil
+}
@@ -0,0 +1,107 @@
+package artifacts
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stitchfix/flotilla-os/exceptions"
+)
+
+type fakeS3 struct {
+	objects map[string]string
+}
+
+func (f *fakeS3) ListObjectsV2PagesWithContext(ctx aws.Context, input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool, opts ...request.Option) error {
+	page := &s3.ListObjectsV2Output{}
+	for _, key := range []string{"artifacts/run/a.csv", "artifacts/run/model/weights.bin", "artifacts/run/result.json"} {
+		if body, ok := f.objects[key]; ok && strings.HasPrefix(key, *input.Prefix) {
+			page.Contents = append(page.Contents, &s3.Object{
+				Key:          aws.String(key),
+				Size:         aws.Int64(int64(len(body))),
+				ETag:         aws.String(`"abc123"`),
+				LastModified: aws.Time(time.Unix(0, 0)),
+			})
+		}
+	}
+	fn(page, true)
+	return nil
+}
+
+func (f *fakeS3) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	body, ok := f.objects[*input.Key]
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "not found", nil)
+	}
+	return &s3.GetObjectOutput{
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: aws.Int64(int64(len(body))),
+	}, nil
+}
+
+func newTestClient(objects map[string]string) *S3ArtifactsClient {
+	return &S3ArtifactsClient{
+		s3Client:      &fakeS3{objects: objects},
+		bucket:        "bucket",
+		rootDir:       "artifacts",
+		maxArtifacts:  2,
+		maxResultSize: 1024,
+	}
+}
+
+func TestS3ArtifactsClient_Manifest(t *testing.T) {
+	client := newTestClient(map[string]string{
+		"artifacts/run/a.csv":             "x,y",
+		"artifacts/run/model/weights.bin": "0101",
+		"artifacts/run/result.json":       `{"accuracy": 0.9}`,
+	})
+	manifest, err := client.Manifest(context.Background(), "run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.URI != "s3://bucket/artifacts/run/" {
+		t.Errorf("unexpected uri %s", manifest.URI)
+	}
+	if len(manifest.Artifacts) != 2 || !manifest.Truncated {
+		t.Fatalf("expected 2 artifacts and a truncated manifest, got %+v", manifest)
+	}
+	if manifest.Artifacts[1].Path != "model/weights.bin" || manifest.Artifacts[1].Checksum != "abc123" || manifest.TotalSize != 7 {
+		t.Errorf("unexpected artifacts %+v", manifest)
+	}
+
+	result, err := client.Result(context.Background(), "run")
+	if err != nil || result == nil || (*result)["accuracy"] != 0.9 {
+		t.Errorf("expected the result document, got %v %v", result, err)
+	}
+	if result, err = client.Result(context.Background(), "other"); result != nil || err != nil {
+		t.Errorf("expected no result for a run without one, got %v %v", result, err)
+	}
+}
+
+func TestS3ArtifactsClient_Download(t *testing.T) {
+	client := newTestClient(map[string]string{"artifacts/run/model/weights.bin": "0101"})
+
+	w := httptest.NewRecorder()
+	if err := client.Download(context.Background(), "run", "model/weights.bin", w); err != nil {
+		t.Fatal(err)
+	}
+	if w.Body.String() != "0101" || !strings.Contains(w.Header().Get("Content-Disposition"), "weights.bin") {
+		t.Errorf("unexpected download %q %v", w.Body.String(), w.Header())
+	}
+
+	err := client.Download(context.Background(), "run", "../other/secret", httptest.NewRecorder())
+	if _, ok := err.(exceptions.MalformedInput); !ok {
+		t.Errorf("expected paths escaping the run's prefix to be rejected, got %v", err)
+	}
+	err = client.Download(context.Background(), "run", "missing.txt", httptest.NewRecorder())
+	if _, ok := err.(exceptions.MissingResource); !ok {
+		t.Errorf("expected MissingResource, got %v", err)
+	}
+}
@@ -134,6 +134,16 @@ func (lc *EKSCloudWatchLogsClient) LogsText(executable state.Executable, run sta
 	return errors.Errorf("EKSCloudWatchLogsClient does not support LogsText method.")
 }
 
+// SearchLogs is a placeholder only, searching is supported for s3 logs.
+func (lc *EKSCloudWatchLogsClient) SearchLogs(executable state.Executable, run state.Run, query LogQuery) (LogSearchResult, error) {
+	return LogSearchResult{}, errors.Errorf("EKSCloudWatchLogsClient does not support SearchLogs method.")
+}
+
+// DownloadLogs is a placeholder only, downloads are supported for s3 logs.
+func (lc *EKSCloudWatchLogsClient) DownloadLogs(executable state.Executable, run state.Run, query LogQuery, w http.ResponseWriter) error {
+	return errors.Errorf("EKSCloudWatchLogsClient does not support DownloadLogs method.")
+}
+
 // Generate stream name
 func (lc *EKSCloudWatchLogsClient) toStreamName(run state.Run) string {
 	return fmt.Sprintf("%s", *run.PodName)
@@ -8,11 +8,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/pkg/errors"
 	"github.com/stitchfix/flotilla-os/config"
+	"github.com/stitchfix/flotilla-os/exceptions"
 	"github.com/stitchfix/flotilla-os/state"
 	awstrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/aws/aws-sdk-go/aws"
 	"io"
@@ -238,6 +240,15 @@ func (lc *EKSS3LogsClient) LogsText(executable state.Executable, run state.Run,
 
 // Fetch S3Object associated with the pod's log.
 func (lc *EKSS3LogsClient) getS3Object(run state.Run) (*s3.GetObjectOutput, error) {
+	key, err := lc.getLatestS3Key(run, int64(10000000))
+	if err != nil {
+		return nil, err
+	}
+	return lc.getS3Key(key)
+}
+
+// Find the latest log file of the run smaller than maxSize (0 for no limit).
+func (lc *EKSS3LogsClient) getLatestS3Key(run state.Run, maxSize int64) (*string, error) {
 	//Pod isn't there yet - dont return a 404
 	//if run.PodName == nil {
 	//	return nil, errors.New("no pod associated with the run.")
@@ -260,20 +271,112 @@ func (lc *EKSS3LogsClient) getS3Object(run state.Run) (*s3.GetObjectOutput, erro
 	var key *string
 	lastModified := &time.Time{}
 
+	// The pods of a replicated run all log under the run, pick the run's pod.
+	match := run.RunID
+	if run.IsReplicated() && run.PodName != nil {
+		match = *run.PodName
+	}
+
 	//Find latest log file (could have multiple log files per pod - due to pod retries)
 	for _, content := range result.Contents {
-		if strings.Contains(*content.Key, run.RunID) && lastModified.Before(*content.LastModified) {
-			if content != nil && *content.Size < int64(10000000) {
+		if strings.Contains(*content.Key, match) && lastModified.Before(*content.LastModified) {
+			if content != nil && (maxSize <= 0 || *content.Size < maxSize) {
 				key = content.Key
 				lastModified = content.LastModified
 			}
 		}
 	}
-	if key != nil {
-		return lc.getS3Key(key)
-	} else {
+	if key == nil {
 		return nil, errors.New("no s3 files associated with the run.")
 	}
+	return key, nil
+}
+
+// Fetch the latest log file of the run regardless of size, optionally
+// restricted to an HTTP byte range (eg. bytes=0-1048575).
+func (lc *EKSS3LogsClient) getS3ObjectRange(run state.Run, byteRange string) (*s3.GetObjectOutput, error) {
+	key, err := lc.getLatestS3Key(run, 0)
+	if err != nil {
+		return nil, exceptions.MissingResource{ErrorString: err.Error()}
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(lc.s3Bucket),
+		Key:    key,
+	}
+	if len(byteRange) > 0 {
+		input.Range = aws.String(byteRange)
+	}
+
+	result, err := lc.s3Client.GetObject(input)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "InvalidRange" {
+			return nil, exceptions.MalformedInput{ErrorString: fmt.Sprintf("invalid range [%s]", byteRange)}
+		}
+		return nil, errors.Wrap(err, "problem getting logs")
+	}
+	return result, nil
+}
+
+// SearchLogs scans the run's log file and returns the lines matching the query.
+// The object is streamed, only the matched lines are held in memory.
+func (lc *EKSS3LogsClient) SearchLogs(executable state.Executable, run state.Run, query LogQuery) (LogSearchResult, error) {
+	if run.Engine != nil && *run.Engine == state.EKSSparkEngine {
+		return LogSearchResult{}, exceptions.MalformedInput{ErrorString: "log search is only supported for eks runs"}
+	}
+
+	result, err := lc.getS3ObjectRange(run, query.Range)
+	if err != nil {
+		return LogSearchResult{}, err
+	}
+	defer result.Body.Close()
+
+	return collectLogLines(result.Body, query)
+}
+
+// DownloadLogs streams the log text of the lines matching the query to w,
+// optionally gzipped. A ranged download without filters or compression is
+// passed through as the raw bytes of the underlying object (with its
+// Content-Range); otherwise the range only bounds the scanned bytes and the
+// filtered text is returned whole.
+func (lc *EKSS3LogsClient) DownloadLogs(executable state.Executable, run state.Run, query LogQuery, w http.ResponseWriter) error {
+	if run.Engine != nil && *run.Engine == state.EKSSparkEngine {
+		return exceptions.MalformedInput{ErrorString: "log downloads are only supported for eks runs"}
+	}
+
+	result, err := lc.getS3ObjectRange(run, query.Range)
+	if err != nil {
+		return err
+	}
+	defer result.Body.Close()
+
+	filename := fmt.Sprintf("%s.log", run.RunID)
+	if query.Gzip {
+		filename = fmt.Sprintf("%s.gz", filename)
+		w.Header().Set("Content-Type", "application/gzip")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	if query.isRaw() && result.ContentRange != nil {
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Header().Set("Content-Range", *result.ContentRange)
+		w.WriteHeader(http.StatusPartialContent)
+		_, err = io.Copy(w, result.Body)
+		return err
+	}
+
+	if !query.Gzip {
+		return writeLogLines(result.Body, query, w)
+	}
+
+	gw := gzip.NewWriter(w)
+	if err = writeLogLines(result.Body, query, gw); err != nil {
+		_ = gw.Close()
+		return err
+	}
+	return gw.Close()
 }
 
 func (lc *EKSS3LogsClient) getS3Key(s3Key *string) (*s3.GetObjectOutput, error) {
@@ -380,6 +483,9 @@ func parseLines(input []byte) (s3Log, error) {
 	err := json.Unmarshal(input, &parsedInput)
 	if err != nil {
 		splitLines := strings.Split(string(input), " ")
+		if len(splitLines) < 3 {
+			return parsedInput, err
+		}
 		if len(splitLines) > 0 {
 			layout := "2006-01-02T15:04:05.999999999Z"
 			timestamp, err := time.Parse(layout, splitLines[0])
@@ -0,0 +1,257 @@
+package logs
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/stitchfix/flotilla-os/state"
+)
+
+// ExceptionParser finds exceptions in a window of log lines.
+type ExceptionParser interface {
+	Name() string
+	Parse(lines []LogLine) []state.RunException
+}
+
+var exceptionParsers = []ExceptionParser{
+	&pythonExceptionParser{},
+	&jvmExceptionParser{},
+	&sparkExceptionParser{},
+	&goPanicParser{},
+}
+
+// RegisterExceptionParser adds a parser used by every ExceptionExtractor
+// created without explicit parsers.
+func RegisterExceptionParser(parser ExceptionParser) {
+	exceptionParsers = append(exceptionParsers, parser)
+}
+
+// MaxExtractedExceptions caps the number of exceptions stored on a run.
+var MaxExtractedExceptions = 20
+
+// ExceptionExtractor scans the tail of a finished run's logs for exceptions.
+type ExceptionExtractor struct {
+	lc        Client
+	parsers   []ExceptionParser
+	tailLines int
+}
+
+// NewExceptionExtractor returns an extractor reading the last tailLines lines
+// of a run's logs through lc. The registered parsers are used when none are passed.
+func NewExceptionExtractor(lc Client, tailLines int, parsers ...ExceptionParser) *ExceptionExtractor {
+	if len(parsers) == 0 {
+		parsers = exceptionParsers
+	}
+	if tailLines <= 0 {
+		tailLines = MaxLogSearchLines
+	}
+	return &ExceptionExtractor{lc: lc, parsers: parsers, tailLines: tailLines}
+}
+
+// Extract returns the exceptions found in the logs of the run ordered by their
+// position in the log.
+func (ee *ExceptionExtractor) Extract(executable state.Executable, run state.Run) (state.StructuredExceptions, error) {
+	lines, err := ee.tail(executable, run)
+	if err != nil {
+		return nil, err
+	}
+	return ParseExceptions(lines, ee.parsers), nil
+}
+
+func (ee *ExceptionExtractor) tail(executable state.Executable, run state.Run) ([]LogLine, error) {
+	res, err := ee.lc.SearchLogs(executable, run, LogQuery{Tail: ee.tailLines})
+	if err != nil {
+		return nil, err
+	}
+	return res.Lines, nil
+}
+
+// ParseExceptions runs every parser over the lines and returns the exceptions
+// ordered by line offset, keeping the last MaxExtractedExceptions.
+func ParseExceptions(lines []LogLine, parsers []ExceptionParser) state.StructuredExceptions {
+	res := state.StructuredExceptions{}
+	// Parsers may match the same line (eg. a SparkException), the first parser wins.
+	seen := make(map[int64]bool)
+	for _, parser := range parsers {
+		for _, e := range parser.Parse(lines) {
+			e.Parser = parser.Name()
+			if !seen[e.Line] {
+				seen[e.Line] = true
+				res = append(res, e)
+			}
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Line < res[j].Line })
+	if len(res) > MaxExtractedExceptions {
+		res = res[len(res)-MaxExtractedExceptions:]
+	}
+	return res
+}
+
+func trimLog(l LogLine) string {
+	return strings.TrimRight(l.Log, "\r\n")
+}
+
+var (
+	pythonTracebackStart = regexp.MustCompile(`^Traceback \(most recent call last\):`)
+	pythonFrame          = regexp.MustCompile(`^\s+File "([^"]+)", line (\d+), in (.+)$`)
+	pythonException      = regexp.MustCompile(`^([A-Za-z_][\w.]*)(?::\s?(.*))?$`)
+)
+
+// pythonExceptionParser finds python tracebacks; the frame is the innermost call.
+type pythonExceptionParser struct{}
+
+func (p *pythonExceptionParser) Name() string {
+	return "python"
+}
+
+func (p *pythonExceptionParser) Parse(lines []LogLine) []state.RunException {
+	var res []state.RunException
+	for i := 0; i < len(lines); i++ {
+		if !pythonTracebackStart.MatchString(trimLog(lines[i])) {
+			continue
+		}
+		frame := ""
+		for j := i + 1; j < len(lines); j++ {
+			text := trimLog(lines[j])
+			if m := pythonFrame.FindStringSubmatch(text); m != nil {
+				frame = fmt.Sprintf("%s:%s in %s", m[1], m[2], m[3])
+				continue
+			}
+			if strings.HasPrefix(text, " ") || len(text) == 0 {
+				// Source line of the previous frame.
+				continue
+			}
+			if m := pythonException.FindStringSubmatch(text); m != nil {
+				res = append(res, state.RunException{
+					Type:    m[1],
+					Message: m[2],
+					Frame:   frame,
+					Line:    lines[j].Line,
+				})
+			}
+			i = j
+			break
+		}
+	}
+	return res
+}
+
+var (
+	jvmException = regexp.MustCompile(`^(?:Exception in thread "[^"]*" |Caused by: )?((?:[a-zA-Z_$][\w$]*\.)+[A-Z][\w$]*(?:Exception|Error|Throwable))(?::\s?(.*))?$`)
+	jvmFrame     = regexp.MustCompile(`^\s+at (\S+\(.*\))$`)
+)
+
+// jvmExceptionParser finds java/scala stack traces, including their causes.
+type jvmExceptionParser struct{}
+
+func (p *jvmExceptionParser) Name() string {
+	return "jvm"
+}
+
+func (p *jvmExceptionParser) Parse(lines []LogLine) []state.RunException {
+	var res []state.RunException
+	for i := 0; i < len(lines); i++ {
+		m := jvmException.FindStringSubmatch(trimLog(lines[i]))
+		if m == nil || i+1 >= len(lines) {
+			continue
+		}
+		// Only report exceptions followed by a stack trace, logged
+		// exception names alone are too noisy.
+		frame := jvmFrame.FindStringSubmatch(trimLog(lines[i+1]))
+		if frame == nil {
+			continue
+		}
+		res = append(res, state.RunException{
+			Type:    m[1],
+			Message: m[2],
+			Frame:   frame[1],
+			Line:    lines[i].Line,
+		})
+	}
+	return res
+}
+
+var sparkFailures = []struct {
+	exceptionType string
+	pattern       *regexp.Regexp
+}{
+	{"SparkJobAborted", regexp.MustCompile(`Job aborted due to stage failure: (.+)$`)},
+	{"ExecutorLostFailure", regexp.MustCompile(`ExecutorLostFailure \((.+)\)`)},
+	{"SparkContextShutdown", regexp.MustCompile(`(SparkContext (?:was shut down|has been shutdown).*)$`)},
+	{"SparkApplicationFailed", regexp.MustCompile(`Application .+ failed .+? due to (.+)$`)},
+}
+
+// sparkExceptionParser finds spark driver failures which aren't plain stack traces.
+type sparkExceptionParser struct{}
+
+func (p *sparkExceptionParser) Name() string {
+	return "spark"
+}
+
+func (p *sparkExceptionParser) Parse(lines []LogLine) []state.RunException {
+	var res []state.RunException
+	for _, l := range lines {
+		text := trimLog(l)
+		for _, failure := range sparkFailures {
+			if m := failure.pattern.FindStringSubmatch(text); m != nil {
+				res = append(res, state.RunException{
+					Type:    failure.exceptionType,
+					Message: m[1],
+					Line:    l.Line,
+				})
+				break
+			}
+		}
+	}
+	return res
+}
+
+var (
+	goPanic     = regexp.MustCompile(`^(panic|fatal error): (.+)$`)
+	goGoroutine = regexp.MustCompile(`^goroutine \d+ \[.+\]:$`)
+	goFile      = regexp.MustCompile(`^\s+(\S+\.go:\d+)`)
+)
+
+// goPanicParser finds go panics; the frame is the function that panicked.
+type goPanicParser struct{}
+
+func (p *goPanicParser) Name() string {
+	return "go"
+}
+
+func (p *goPanicParser) Parse(lines []LogLine) []state.RunException {
+	var res []state.RunException
+	for i := 0; i < len(lines); i++ {
+		m := goPanic.FindStringSubmatch(trimLog(lines[i]))
+		if m == nil {
+			continue
+		}
+		e := state.RunException{
+			Type:    m[1],
+			Message: m[2],
+			Line:    lines[i].Line,
+		}
+		for j := i + 1; j < len(lines) && j < i+10; j++ {
+			if !goGoroutine.MatchString(trimLog(lines[j])) {
+				continue
+			}
+			// Skip the runtime frames added by panic itself.
+			for k := j + 1; k+1 < len(lines); k += 2 {
+				fn := trimLog(lines[k])
+				if strings.HasPrefix(fn, "panic(") || strings.HasPrefix(fn, "runtime.") {
+					continue
+				}
+				if file := goFile.FindStringSubmatch(trimLog(lines[k+1])); file != nil {
+					e.Frame = fmt.Sprintf("%s %s", fn, file[1])
+				}
+				break
+			}
+			break
+		}
+		res = append(res, e)
+	}
+	return res
+}
@@ -0,0 +1,102 @@
+package logs
+
+import (
+	"strings"
+	"testing"
+)
+
+func toLogLines(text string) []LogLine {
+	var lines []LogLine
+	for i, l := range strings.SplitAfter(text, "\n") {
+		if len(l) > 0 {
+			lines = append(lines, LogLine{Line: int64(i), Log: l})
+		}
+	}
+	return lines
+}
+
+func TestParseExceptions(t *testing.T) {
+	cases := []struct {
+		name    string
+		logs    string
+		parser  string
+		excType string
+		message string
+		frame   string
+		line    int64
+	}{
+		{
+			name: "python",
+			logs: `starting
+Traceback (most recent call last):
+  File "/app/main.py", line 10, in <module>
+    run()
+  File "/app/job.py", line 42, in run
+    raise ValueError("bad input")
+ValueError: bad input
+`,
+			parser:  "python",
+			excType: "ValueError",
+			message: "bad input",
+			frame:   "/app/job.py:42 in run",
+			line:    6,
+		},
+		{
+			name: "jvm",
+			logs: `Exception in thread "main" java.lang.IllegalStateException: no table
+	at com.example.Job.run(Job.java:12)
+	at com.example.Main.main(Main.java:3)
+`,
+			parser:  "jvm",
+			excType: "java.lang.IllegalStateException",
+			message: "no table",
+			frame:   "com.example.Job.run(Job.java:12)",
+			line:    0,
+		},
+		{
+			name: "spark",
+			logs: `24/01/01 00:00:00 INFO DAGScheduler: ResultStage 1 failed
+24/01/01 00:00:01 ERROR FileFormatWriter: Job aborted due to stage failure: Task 0 in stage 1.0 failed 4 times
+`,
+			parser:  "spark",
+			excType: "SparkJobAborted",
+			message: "Task 0 in stage 1.0 failed 4 times",
+			line:    1,
+		},
+		{
+			name: "go",
+			logs: `panic: runtime error: index out of range [3] with length 3
+
+goroutine 1 [running]:
+main.process(...)
+	/app/main.go:17
+main.main()
+	/app/main.go:9 +0x1d
+`,
+			parser:  "go",
+			excType: "panic",
+			message: "runtime error: index out of range [3] with length 3",
+			frame:   "main.process(...) /app/main.go:17",
+			line:    0,
+		},
+	}
+
+	for _, c := range cases {
+		res := ParseExceptions(toLogLines(c.logs), exceptionParsers)
+		if len(res) != 1 {
+			t.Errorf("[%s] expected exactly 1 exception but was %d: %v", c.name, len(res), res)
+			continue
+		}
+		e := res[0]
+		if e.Parser != c.parser || e.Type != c.excType || e.Message != c.message || e.Frame != c.frame || e.Line != c.line {
+			t.Errorf("[%s] unexpected exception %+v", c.name, e)
+		}
+	}
+}
+
+func TestParseExceptions_NoExceptions(t *testing.T) {
+	res := ParseExceptions(toLogLines("hello\nworld\nError count: 0\n"), exceptionParsers)
+	if len(res) != 0 {
+		t.Errorf("Expected no exceptions but was %v", res)
+	}
+}
@@ -0,0 +1,205 @@
+package logs
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// MaxLogSearchLines caps the number of lines a single search returns.
+var MaxLogSearchLines = 10000
+
+// LogQuery describes a server side filter over a run's log stream.
+type LogQuery struct {
+	Pattern  *regexp.Regexp
+	Contains string
+	Stream   string
+	Since    *time.Time
+	Until    *time.Time
+	Head     int
+	Tail     int
+	Range    string
+	Gzip     bool
+	Replica  *int64
+}
+
+// LogLine is a single parsed log line; Line is its 0-based position in the
+// scanned bytes: in the log object, compatible with the last_seen offset of the
+// logs endpoint, unless the query has a Range, which it's then relative to.
+type LogLine struct {
+	Line   int64     `json:"line"`
+	Time   time.Time `json:"time"`
+	Stream string    `json:"stream"`
+	Log    string    `json:"log"`
+}
+
+// LogSearchResult is the response of a log search.
+type LogSearchResult struct {
+	Lines     []LogLine `json:"lines"`
+	Total     int       `json:"total"`
+	Scanned   int64     `json:"scanned"`
+	Truncated bool      `json:"truncated"`
+}
+
+// isRaw is true when the query neither filters nor compresses the log, ie. the
+// bytes of the log object can be returned as they are.
+func (q LogQuery) isRaw() bool {
+	return q.Pattern == nil && len(q.Contains) == 0 && len(q.Stream) == 0 &&
+		q.Since == nil && q.Until == nil && q.Head == 0 && q.Tail == 0 && !q.Gzip
+}
+
+func (q LogQuery) matches(l s3Log) bool {
+	if len(q.Stream) > 0 && l.Stream != q.Stream {
+		return false
+	}
+	if q.Since != nil && l.Time.Before(*q.Since) {
+		return false
+	}
+	if q.Until != nil && l.Time.After(*q.Until) {
+		return false
+	}
+	if len(q.Contains) > 0 && !strings.Contains(l.Log, q.Contains) {
+		return false
+	}
+	if q.Pattern != nil && !q.Pattern.MatchString(l.Log) {
+		return false
+	}
+	return true
+}
+
+// scanLogLines reads r one line at a time and calls fn for every line matching
+// the query; returning false from fn stops the scan. Lines that can't be parsed
+// (eg. partial lines at the edges of a byte range) are skipped. Returns the
+// number of lines read.
+func scanLogLines(r io.Reader, q LogQuery, fn func(LogLine) bool) (int64, error) {
+	reader := bufio.NewReader(r)
+	position := int64(0)
+	for {
+		raw, err := reader.ReadBytes('\n')
+		if len(raw) > 0 {
+			line := position
+			position = position + 1
+			parsed, parseErr := parseLines(raw)
+			if parseErr == nil {
+				// Container logs are written in order, nothing past until can match.
+				if q.Until != nil && parsed.Time.After(*q.Until) {
+					return position, nil
+				}
+				if q.matches(parsed) && !fn(LogLine{
+					Line:   line,
+					Time:   parsed.Time,
+					Stream: parsed.Stream,
+					Log:    parsed.Log,
+				}) {
+					return position, nil
+				}
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				return position, nil
+			}
+			return position, err
+		}
+	}
+}
+
+// tailBuffer keeps the last n lines seen.
+type tailBuffer struct {
+	lines []LogLine
+	next  int
+	seen  int
+}
+
+func newTailBuffer(n int) *tailBuffer {
+	return &tailBuffer{lines: make([]LogLine, 0, n)}
+}
+
+func (tb *tailBuffer) add(l LogLine) {
+	tb.seen = tb.seen + 1
+	if len(tb.lines) < cap(tb.lines) {
+		tb.lines = append(tb.lines, l)
+		return
+	}
+	tb.lines[tb.next] = l
+	tb.next = (tb.next + 1) % len(tb.lines)
+}
+
+// ordered returns the buffered lines oldest first.
+func (tb *tailBuffer) ordered() []LogLine {
+	return append(append([]LogLine{}, tb.lines[tb.next:]...), tb.lines[:tb.next]...)
+}
+
+// collectLogLines returns the lines of r matching the query, honoring head/tail
+// and never holding more than MaxLogSearchLines lines in memory.
+func collectLogLines(r io.Reader, q LogQuery) (LogSearchResult, error) {
+	limit := MaxLogSearchLines
+	if q.Tail > 0 {
+		if q.Tail < limit {
+			limit = q.Tail
+		}
+		tb := newTailBuffer(limit)
+		scanned, err := scanLogLines(r, q, func(l LogLine) bool {
+			tb.add(l)
+			return true
+		})
+		lines := tb.ordered()
+		return LogSearchResult{
+			Lines:     lines,
+			Total:     len(lines),
+			Scanned:   scanned,
+			Truncated: tb.seen > len(lines),
+		}, err
+	}
+
+	if q.Head > 0 && q.Head < limit {
+		limit = q.Head
+	}
+	res := LogSearchResult{Lines: []LogLine{}}
+	scanned, err := scanLogLines(r, q, func(l LogLine) bool {
+		if len(res.Lines) >= limit {
+			res.Truncated = true
+			return false
+		}
+		res.Lines = append(res.Lines, l)
+		return true
+	})
+	res.Total = len(res.Lines)
+	res.Scanned = scanned
+	return res, err
+}
+
+// writeLogLines streams the log text of the lines of r matching the query to w.
+func writeLogLines(r io.Reader, q LogQuery, w io.Writer) error {
+	if q.Tail > 0 {
+		res, err := collectLogLines(r, q)
+		if err != nil {
+			return err
+		}
+		for _, l := range res.Lines {
+			if _, err = io.WriteString(w, l.Log); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	written := 0
+	var writeErr error
+	_, err := scanLogLines(r, q, func(l LogLine) bool {
+		if q.Head > 0 && written >= q.Head {
+			return false
+		}
+		if _, writeErr = io.WriteString(w, l.Log); writeErr != nil {
+			return false
+		}
+		written = written + 1
+		return true
+	})
+	if writeErr != nil {
+		return writeErr
+	}
+	return err
+}
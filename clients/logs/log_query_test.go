@@ -0,0 +1,90 @@
+package logs
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testLogs = `{"log":"starting\n","stream":"stdout","time":"2024-01-01T00:00:00Z"}
+{"log":"Traceback (most recent call last):\n","stream":"stderr","time":"2024-01-01T00:00:01Z"}
+2024-01-01T00:00:02.000000000Z stdout F working 1
+2024-01-01T00:00:03.000000000Z stdout F working 2
+{"log":"ValueError: bad input\n","stream":"stderr","time":"2024-01-01T00:00:04Z"}
+{"log":"done\n","stream":"stdout","time":"2024-01-01T00:00:05Z"}`
+
+func TestCollectLogLines(t *testing.T) {
+	since := time.Date(2024, 1, 1, 0, 0, 2, 0, time.UTC)
+	until := time.Date(2024, 1, 1, 0, 0, 3, 0, time.UTC)
+
+	cases := []struct {
+		name      string
+		query     LogQuery
+		expected  []int64
+		truncated bool
+	}{
+		{"all", LogQuery{}, []int64{0, 1, 2, 3, 4, 5}, false},
+		{"stream", LogQuery{Stream: "stderr"}, []int64{1, 4}, false},
+		{"contains", LogQuery{Contains: "working"}, []int64{2, 3}, false},
+		{"pattern", LogQuery{Pattern: regexp.MustCompile(`^\w+Error:`)}, []int64{4}, false},
+		{"time range", LogQuery{Since: &since, Until: &until}, []int64{2, 3}, false},
+		{"head", LogQuery{Head: 2}, []int64{0, 1}, true},
+		{"tail", LogQuery{Tail: 2}, []int64{4, 5}, true},
+		{"tail with filter", LogQuery{Tail: 5, Stream: "stdout"}, []int64{0, 2, 3, 5}, false},
+	}
+
+	for _, c := range cases {
+		res, err := collectLogLines(strings.NewReader(testLogs), c.query)
+		if err != nil {
+			t.Errorf("[%s] unexpected error: %s", c.name, err.Error())
+			continue
+		}
+		if res.Total != len(c.expected) {
+			t.Errorf("[%s] expected %d lines but was %d", c.name, len(c.expected), res.Total)
+			continue
+		}
+		for i, l := range res.Lines {
+			if l.Line != c.expected[i] {
+				t.Errorf("[%s] expected line %d at %d but was %d", c.name, c.expected[i], i, l.Line)
+			}
+		}
+		if res.Truncated != c.truncated {
+			t.Errorf("[%s] expected truncated %v but was %v", c.name, c.truncated, res.Truncated)
+		}
+	}
+}
+
+func TestWriteLogLines(t *testing.T) {
+	var b bytes.Buffer
+	err := writeLogLines(strings.NewReader(testLogs), LogQuery{Stream: "stderr"}, &b)
+	if err != nil {
+		t.Error(err.Error())
+	}
+
+	expected := "Traceback (most recent call last):\nValueError: bad input\n"
+	if b.String() != expected {
+		t.Errorf("Expected [%s] but was [%s]", expected, b.String())
+	}
+}
+
+func TestLogQueryIsRaw(t *testing.T) {
+	since := time.Date(2024, 1, 1, 0, 0, 2, 0, time.UTC)
+	cases := []struct {
+		name     string
+		query    LogQuery
+		expected bool
+	}{
+		{"range only", LogQuery{Range: "bytes=0-1023"}, true},
+		{"gzip", LogQuery{Range: "bytes=0-1023", Gzip: true}, false},
+		{"stream", LogQuery{Range: "bytes=0-1023", Stream: "stderr"}, false},
+		{"since", LogQuery{Since: &since}, false},
+		{"tail", LogQuery{Tail: 10}, false},
+	}
+	for _, c := range cases {
+		if c.query.isRaw() != c.expected {
+			t.Errorf("[%s] expected raw %v but was %v", c.name, c.expected, !c.expected)
+		}
+	}
+}
@@ -18,6 +18,8 @@ type Client interface {
 	Initialize(config config.Config) error
 	Logs(executable state.Executable, run state.Run, lastSeen *string, role *string, facility *string) (string, *string, error)
 	LogsText(executable state.Executable, run state.Run, w http.ResponseWriter) error
+	SearchLogs(executable state.Executable, run state.Run, query LogQuery) (LogSearchResult, error)
+	DownloadLogs(executable state.Executable, run state.Run, query LogQuery, w http.ResponseWriter) error
 }
 
 type logsClient interface {
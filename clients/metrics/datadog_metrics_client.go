@@ -51,6 +51,11 @@ func (dd *DatadogStatsdMetricsClient) Histogram(name Metric, value float64, tags
 	return dd.client.Histogram(string(name), value, tags, rate)
 }
 
+// Gauge records the current value of the metric
+func (dd *DatadogStatsdMetricsClient) Gauge(name Metric, value float64, tags []string, rate float64) error {
+	return dd.client.Gauge(string(name), value, tags, rate)
+}
+
 // Distribution tracks the statistical distribution of a set of values
 func (dd *DatadogStatsdMetricsClient) Distribution(name Metric, value float64, tags []string, rate float64) error {
 	return dd.client.Distribution(string(name), value, tags, rate)
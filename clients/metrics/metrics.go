@@ -2,6 +2,8 @@ package metrics
 
 import (
 	"fmt"
+	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -26,6 +28,8 @@ const (
 	EngineEMRTerminate Metric = "engine.emr.terminate"
 	// Metric associated to termination of pods hopping between hosts.
 	EngineEKSRunPodnameChange Metric = "engine.eks.run_podname_changed"
+	// Metric associated to runs resubmitted after a spot interruption.
+	EngineEKSRunSpotInterrupted Metric = "engine.eks.run_spot_interrupted"
 	// Metric associated to pod events where there was a Cluster Autoscale event.
 	EngineEKSNodeTriggeredScaledUp Metric = "engine.eks.triggered_scale_up"
 	// Timing for status worker processEKSRun
@@ -48,6 +52,8 @@ const (
 	StatusWorkerGetJob Metric = "status_worker.get_job"
 	// Engine update run
 	EngineUpdateRun Metric = "engine.update_run"
+	// Metric for finished runs, tagged with the failure category of failed runs
+	RunFinished Metric = "run.finished"
 	// ARA metrics - tracking Auto Resource Adjustment behavior
 	EngineEKSARAEstimationAttempted Metric = "engine.eks.ara.estimation_attempted"
 	EngineEKSARAEstimationSucceeded Metric = "engine.eks.ara.estimation_succeeded"
@@ -67,6 +73,25 @@ const (
 	EngineEKSARAMemoryIncrease       Metric = "engine.eks.ara.memory_increase"
 	EngineEKSARACPUIncrease          Metric = "engine.eks.ara.cpu_increase"
 	EngineEKSARANullCommandHash      Metric = "engine.eks.ara.null_command_hash"
+	// Gauge of the active runs, tagged with their cluster, status and engine
+	RunsActive Metric = "runs.active"
+	// Gauge of the messages waiting in each queue
+	QueueDepth Metric = "queue.depth"
+	// Gauge of the workers running on this instance, tagged with their type
+	WorkerCount Metric = "worker.count"
+	// Gauge of whether this instance is the leader running the leader workers
+	WorkerLeader Metric = "worker.leader"
+	// Gauges of the queue wait, pending time and runtime percentiles of the
+	// recent runs, tagged with a dimension and the quantile
+	RunQueueWait Metric = "run.queue_wait_seconds"
+	RunPending   Metric = "run.pending_seconds"
+	RunRuntime   Metric = "run.runtime_seconds"
+	// Gauge of the runs running for longer than usual, tagged with their cluster
+	RunsSlow Metric = "runs.slow"
+	// Metric for runs flagged as running for longer than usual
+	RunSlow Metric = "run.slow"
+	// Metric for stuck runs remediated, tagged with their pattern and action
+	RunStuck Metric = "run.stuck"
 )
 
 type MetricTag string
@@ -83,6 +108,7 @@ type Client interface {
 	Decrement(name Metric, tags []string, rate float64) error
 	Increment(name Metric, tags []string, rate float64) error
 	Histogram(name Metric, value float64, tags []string, rate float64) error
+	Gauge(name Metric, value float64, tags []string, rate float64) error
 	Distribution(name Metric, value float64, tags []string, rate float64) error
 	Set(name Metric, value string, tags []string, rate float64) error
 	Event(evt event) error
@@ -97,8 +123,11 @@ type event struct {
 
 var once sync.Once
 var instance Client
+var handler http.Handler
 
-// Instantiating the Metrics Client.
+// Instantiating the Metrics Client. `metrics_client` is a comma separated
+// list of backends (`dogstatsd`, `prometheus`), metrics are sent to each of
+// them.
 func InstantiateClient(conf config.Config) error {
 	// Return an error if `metrics_client` isn't set in config.
 	if !conf.IsSet("metrics_client") {
@@ -106,26 +135,50 @@ func InstantiateClient(conf config.Config) error {
 	}
 
 	var err error = nil
-	name := conf.GetString("metrics_client")
+	names := strings.Split(conf.GetString("metrics_client"), ",")
 
 	once.Do(func() {
-		switch name {
-		case "dogstatsd":
-			instance = &DatadogStatsdMetricsClient{}
-
-			if err = instance.Init(conf); err != nil {
-				err = errors.Errorf("Unable to initialize dogstatsd client.")
-				instance = nil
-				break
+		var clients multiClient
+		for _, name := range names {
+			var client Client
+			switch strings.TrimSpace(name) {
+			case "dogstatsd":
+				client = &DatadogStatsdMetricsClient{}
+				if err = client.Init(conf); err != nil {
+					err = errors.Errorf("Unable to initialize dogstatsd client.")
+					return
+				}
+			case "prometheus":
+				prometheusClient := &PrometheusMetricsClient{}
+				if err = prometheusClient.Init(conf); err != nil {
+					err = errors.Wrap(err, "unable to initialize prometheus client")
+					return
+				}
+				handler = prometheusClient.Handler()
+				client = prometheusClient
+			default:
+				err = fmt.Errorf("no client named [%s] was found", name)
+				return
 			}
-		default:
-			err = fmt.Errorf("no client named [%s] was found", name)
+			clients = append(clients, client)
+		}
+
+		if len(clients) == 1 {
+			instance = clients[0]
+		} else {
+			instance = clients
 		}
 	})
 
 	return err
 }
 
+// Handler serves the metrics to Prometheus scrapes, it is nil unless the
+// `prometheus` client is configured.
+func Handler() http.Handler {
+	return handler
+}
+
 // Decr is just Count of -1
 func Decrement(name Metric, tags []string, rate float64) error {
 	if instance != nil {
@@ -153,6 +206,15 @@ func Histogram(name Metric, value float64, tags []string, rate float64) error {
 	return errors.Errorf("MetricsClient instance is nil, unable to send Histogram metric.")
 }
 
+// Gauge sets the current value of a metric
+func Gauge(name Metric, value float64, tags []string, rate float64) error {
+	if instance != nil {
+		return instance.Gauge(name, value, tags, rate)
+	}
+
+	return errors.Errorf("MetricsClient instance is nil, unable to send Gauge metric.")
+}
+
 // Distribution tracks the statistical distribution of a set of values
 func Distribution(name Metric, value float64, tags []string, rate float64) error {
 	if instance != nil {
@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/stitchfix/flotilla-os/config"
+)
+
+// multiClient sends the metrics to several clients, returning the first
+// error met once all of them were sent the metric.
+type multiClient []Client
+
+func (mc multiClient) each(send func(c Client) error) error {
+	var err error
+	for _, c := range mc {
+		if sendErr := send(c); sendErr != nil && err == nil {
+			err = sendErr
+		}
+	}
+	return err
+}
+
+func (mc multiClient) Init(conf config.Config) error {
+	return mc.each(func(c Client) error { return c.Init(conf) })
+}
+
+func (mc multiClient) Decrement(name Metric, tags []string, rate float64) error {
+	return mc.each(func(c Client) error { return c.Decrement(name, tags, rate) })
+}
+
+func (mc multiClient) Increment(name Metric, tags []string, rate float64) error {
+	return mc.each(func(c Client) error { return c.Increment(name, tags, rate) })
+}
+
+func (mc multiClient) Histogram(name Metric, value float64, tags []string, rate float64) error {
+	return mc.each(func(c Client) error { return c.Histogram(name, value, tags, rate) })
+}
+
+func (mc multiClient) Gauge(name Metric, value float64, tags []string, rate float64) error {
+	return mc.each(func(c Client) error { return c.Gauge(name, value, tags, rate) })
+}
+
+func (mc multiClient) Distribution(name Metric, value float64, tags []string, rate float64) error {
+	return mc.each(func(c Client) error { return c.Distribution(name, value, tags, rate) })
+}
+
+func (mc multiClient) Set(name Metric, value string, tags []string, rate float64) error {
+	return mc.each(func(c Client) error { return c.Set(name, value, tags, rate) })
+}
+
+func (mc multiClient) Event(e event) error {
+	return mc.each(func(c Client) error { return c.Event(e) })
+}
+
+func (mc multiClient) Timing(name Metric, value time.Duration, tags []string, rate float64) error {
+	return mc.each(func(c Client) error { return c.Timing(name, value, tags, rate) })
+}
@@ -0,0 +1,271 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stitchfix/flotilla-os/config"
+)
+
+// Buckets of the histograms other than timings, which use the default
+// buckets in seconds. Values range from ratios to MiB and millicores.
+var prometheusValueBuckets = prometheus.ExponentialBuckets(0.25, 2, 20)
+
+var invalidPrometheusChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+type prometheusKind int
+
+const (
+	prometheusCounter prometheusKind = iota
+	prometheusGauge
+	prometheusHistogram
+)
+
+// PrometheusMetricsClient keeps the metrics in memory and serves them to
+// Prometheus scrapes. Metric names have their dots replaced by underscores
+// and are prefixed with the namespace; counters end in `_total` and timings
+// are histograms in seconds ending in `_seconds`. Tags become labels: `k:v`
+// tags are a `k` label, and bare tags are joined in a `tag` label. Series of
+// a metric missing one of its labels have it empty.
+type PrometheusMetricsClient struct {
+	namespace string
+	registry  *prometheus.Registry
+	mu        sync.Mutex
+	families  map[string]*prometheusFamily
+}
+
+type prometheusFamily struct {
+	kind    prometheusKind
+	help    string
+	buckets []float64
+	series  map[string]*prometheusSeries
+}
+
+type prometheusSeries struct {
+	labels  map[string]string
+	value   float64
+	count   uint64
+	sum     float64
+	buckets []uint64
+}
+
+// Initialize the client. Reads the following keys:
+// *metrics_prometheus_namespace* -- prefix of all the metrics, default `flotilla`
+func (pc *PrometheusMetricsClient) Init(conf config.Config) error {
+	pc.namespace = "flotilla"
+	if conf != nil && conf.IsSet("metrics_prometheus_namespace") {
+		pc.namespace = conf.GetString("metrics_prometheus_namespace")
+	}
+	pc.families = make(map[string]*prometheusFamily)
+	pc.registry = prometheus.NewRegistry()
+	if err := pc.registry.Register(pc); err != nil {
+		return err
+	}
+	if err := pc.registry.Register(collectors.NewGoCollector()); err != nil {
+		return err
+	}
+	return pc.registry.Register(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+}
+
+// Handler serves the metrics in the Prometheus and OpenMetrics formats
+func (pc *PrometheusMetricsClient) Handler() http.Handler {
+	return promhttp.HandlerFor(pc.registry, promhttp.HandlerOpts{EnableOpenMetrics: true})
+}
+
+// Decrement isn't supported, Prometheus counters can only go up
+func (pc *PrometheusMetricsClient) Decrement(name Metric, tags []string, rate float64) error {
+	return fmt.Errorf("prometheus counter [%s] can't be decremented", name)
+}
+
+// Increment adds one to the counter of the metric. The rate is a sampling rate
+// for statsd, every increment is counted.
+func (pc *PrometheusMetricsClient) Increment(name Metric, tags []string, rate float64) error {
+	return pc.observe(pc.metricName(name, "_total"), prometheusCounter, nil, tags, func(s *prometheusSeries) {
+		s.value++
+	})
+}
+
+// Histogram tracks the statistical distribution of a set of values
+func (pc *PrometheusMetricsClient) Histogram(name Metric, value float64, tags []string, rate float64) error {
+	return pc.observeHistogram(pc.metricName(name, ""), prometheusValueBuckets, value, tags)
+}
+
+// Distribution tracks the statistical distribution of a set of values
+func (pc *PrometheusMetricsClient) Distribution(name Metric, value float64, tags []string, rate float64) error {
+	return pc.observeHistogram(pc.metricName(name, ""), prometheusValueBuckets, value, tags)
+}
+
+// Gauge sets the current value of the metric
+func (pc *PrometheusMetricsClient) Gauge(name Metric, value float64, tags []string, rate float64) error {
+	return pc.observe(pc.metricName(name, ""), prometheusGauge, nil, tags, func(s *prometheusSeries) {
+		s.value = value
+	})
+}
+
+// Timing tracks the distribution of durations, in seconds
+func (pc *PrometheusMetricsClient) Timing(name Metric, value time.Duration, tags []string, rate float64) error {
+	return pc.observeHistogram(pc.metricName(name, "_seconds"), prometheus.DefBuckets, value.Seconds(), tags)
+}
+
+// Set has no Prometheus equivalent and is ignored
+func (pc *PrometheusMetricsClient) Set(name Metric, value string, tags []string, rate float64) error {
+	return nil
+}
+
+// Event has no Prometheus equivalent and is ignored
+func (pc *PrometheusMetricsClient) Event(e event) error {
+	return nil
+}
+
+func (pc *PrometheusMetricsClient) observeHistogram(name string, buckets []float64, value float64, tags []string) error {
+	return pc.observe(name, prometheusHistogram, buckets, tags, func(s *prometheusSeries) {
+		if s.buckets == nil {
+			s.buckets = make([]uint64, len(buckets))
+		}
+		for i, upperBound := range buckets {
+			if value <= upperBound {
+				s.buckets[i]++
+			}
+		}
+		s.count++
+		s.sum += value
+	})
+}
+
+func (pc *PrometheusMetricsClient) observe(name string, kind prometheusKind, buckets []float64, tags []string, update func(s *prometheusSeries)) error {
+	labels := prometheusLabels(tags)
+	key := prometheusSeriesKey(labels)
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	family, ok := pc.families[name]
+	if !ok {
+		family = &prometheusFamily{
+			kind:    kind,
+			help:    fmt.Sprintf("flotilla metric %s", name),
+			buckets: buckets,
+			series:  make(map[string]*prometheusSeries),
+		}
+		pc.families[name] = family
+	}
+	if family.kind != kind {
+		return fmt.Errorf("prometheus metric [%s] is already registered with another type", name)
+	}
+	series, ok := family.series[key]
+	if !ok {
+		series = &prometheusSeries{labels: labels}
+		family.series[key] = series
+	}
+	update(series)
+	return nil
+}
+
+func (pc *PrometheusMetricsClient) metricName(name Metric, suffix string) string {
+	fqName := invalidPrometheusChars.ReplaceAllString(string(name), "_")
+	if len(pc.namespace) > 0 {
+		fqName = fmt.Sprintf("%s_%s", invalidPrometheusChars.ReplaceAllString(pc.namespace, "_"), fqName)
+	}
+	return fqName + suffix
+}
+
+// Describe sends no descriptions, which makes the client an unchecked
+// collector: its metrics are only known once observed.
+func (pc *PrometheusMetricsClient) Describe(ch chan<- *prometheus.Desc) {
+}
+
+// Collect sends the current value of every series
+func (pc *PrometheusMetricsClient) Collect(ch chan<- prometheus.Metric) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	for name, family := range pc.families {
+		labelNames := family.labelNames()
+		desc := prometheus.NewDesc(name, family.help, labelNames, nil)
+		for _, series := range family.series {
+			values := make([]string, len(labelNames))
+			for i, label := range labelNames {
+				values[i] = series.labels[label]
+			}
+			var (
+				metric prometheus.Metric
+				err    error
+			)
+			switch family.kind {
+			case prometheusCounter:
+				metric, err = prometheus.NewConstMetric(desc, prometheus.CounterValue, series.value, values...)
+			case prometheusGauge:
+				metric, err = prometheus.NewConstMetric(desc, prometheus.GaugeValue, series.value, values...)
+			case prometheusHistogram:
+				buckets := make(map[float64]uint64, len(family.buckets))
+				for i, upperBound := range family.buckets {
+					buckets[upperBound] = series.buckets[i]
+				}
+				metric, err = prometheus.NewConstHistogram(desc, series.count, series.sum, buckets, values...)
+			}
+			if err != nil {
+				metric = prometheus.NewInvalidMetric(desc, err)
+			}
+			ch <- metric
+		}
+	}
+}
+
+// labelNames is the union of the labels of the series of the family
+func (f *prometheusFamily) labelNames() []string {
+	names := map[string]bool{}
+	for _, series := range f.series {
+		for label := range series.labels {
+			names[label] = true
+		}
+	}
+	labelNames := make([]string, 0, len(names))
+	for label := range names {
+		labelNames = append(labelNames, label)
+	}
+	sort.Strings(labelNames)
+	return labelNames
+}
+
+func prometheusLabels(tags []string) map[string]string {
+	labels := map[string]string{}
+	var bare []string
+	for _, tag := range tags {
+		if len(tag) == 0 {
+			continue
+		}
+		parts := strings.SplitN(tag, ":", 2)
+		if len(parts) == 1 || len(parts[0]) == 0 {
+			bare = append(bare, tag)
+			continue
+		}
+		if len(parts[1]) == 0 {
+			continue
+		}
+		label := invalidPrometheusChars.ReplaceAllString(parts[0], "_")
+		if label[0] >= '0' && label[0] <= '9' || strings.HasPrefix(label, "__") {
+			label = "tag_" + strings.TrimLeft(label, "_")
+		}
+		labels[label] = parts[1]
+	}
+	if len(bare) > 0 {
+		sort.Strings(bare)
+		labels["tag"] = strings.Join(bare, ",")
+	}
+	return labels
+}
+
+func prometheusSeriesKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for label, value := range labels {
+		keys = append(keys, label+"="+value)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, "\xff")
+}
@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func scrape(t *testing.T, pc *PrometheusMetricsClient) string {
+	server := httptest.NewServer(pc.Handler())
+	defer server.Close()
+	resp, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestPrometheusMetricsClient(t *testing.T) {
+	pc := &PrometheusMetricsClient{}
+	if err := pc.Init(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = pc.Increment(EngineEKSExecute, []string{string(StatusSuccess), "tier:4"}, 1)
+	_ = pc.Increment(EngineEKSExecute, []string{string(StatusSuccess), "tier:4"}, 1)
+	_ = pc.Increment(EngineEKSExecute, []string{string(StatusFailure)}, 1)
+	_ = pc.Timing(StatusWorkerGetJob, 200*time.Millisecond, []string{"cluster-a"}, 1)
+	_ = pc.Gauge(RunsActive, 3, []string{"cluster:cluster-a", "status:RUNNING"}, 1)
+	_ = pc.Gauge(RunsActive, 2, []string{"cluster:cluster-a", "status:RUNNING"}, 1)
+
+	body := scrape(t, pc)
+	expected := []string{
+		`flotilla_engine_eks_execute_total{status="success",tier="4"} 2`,
+		`flotilla_engine_eks_execute_total{status="failure",tier=""} 1`,
+		`flotilla_status_worker_get_job_seconds_bucket{tag="cluster-a",le="0.25"} 1`,
+		`flotilla_status_worker_get_job_seconds_bucket{tag="cluster-a",le="0.1"} 0`,
+		`flotilla_status_worker_get_job_seconds_count{tag="cluster-a"} 1`,
+		`flotilla_runs_active{cluster="cluster-a",status="RUNNING"} 2`,
+		`# TYPE flotilla_runs_active gauge`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(body, line) {
+			t.Errorf("expected the scrape to contain %s, got:\n%s", line, body)
+		}
+	}
+
+	if err := pc.Decrement(EngineEKSExecute, nil, 1); err == nil {
+		t.Errorf("expected counters not to be decremented")
+	}
+	if err := pc.Histogram(RunsActive, 1, nil, 1); err == nil {
+		t.Errorf("expected a metric to keep its type")
+	}
+}
+
+func TestPrometheusLabels(t *testing.T) {
+	labels := prometheusLabels([]string{"cluster:a:b", "workerid:1", "9lives:x", "zeta", "alpha", "empty:", ""})
+	expected := map[string]string{"cluster": "a:b", "workerid": "1", "tag_9lives": "x", "tag": "alpha,zeta"}
+	if len(labels) != len(expected) {
+		t.Errorf("expected labels %v, got %v", expected, labels)
+	}
+	for label, value := range expected {
+		if labels[label] != value {
+			t.Errorf("expected label %s to be %s, got %s", label, value, labels[label])
+		}
+	}
+}
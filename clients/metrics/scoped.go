@@ -0,0 +1,51 @@
+package metrics
+
+import "context"
+
+type mutedKey struct{}
+
+// Mute returns a context whose metrics are not sent, eg. the metrics of
+// rendering a dry run, which would otherwise count as a submitted run.
+func Mute(ctx context.Context) context.Context {
+	return context.WithValue(ctx, mutedKey{}, true)
+}
+
+// Scoped sends metrics unless the context it was created for is muted.
+type Scoped struct {
+	muted bool
+}
+
+// For returns the metrics of ctx.
+func For(ctx context.Context) Scoped {
+	muted, _ := ctx.Value(mutedKey{}).(bool)
+	return Scoped{muted: muted}
+}
+
+// Muted reports whether metrics are muted.
+func (s Scoped) Muted() bool {
+	return s.muted
+}
+
+// Increment is Increment unless muted.
+func (s Scoped) Increment(name Metric, tags []string, rate float64) error {
+	if s.muted {
+		return nil
+	}
+	return Increment(name, tags, rate)
+}
+
+// Histogram is Histogram unless muted.
+func (s Scoped) Histogram(name Metric, value float64, tags []string, rate float64) error {
+	if s.muted {
+		return nil
+	}
+	return Histogram(name, value, tags, rate)
+}
+
+// Distribution is Distribution unless muted.
+func (s Scoped) Distribution(name Metric, value float64, tags []string, rate float64) error {
+	if s.muted {
+		return nil
+	}
+	return Distribution(name, value, tags, rate)
+}
@@ -0,0 +1,19 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+)
+
+func TestScopedMute(t *testing.T) {
+	ctx := context.Background()
+	if For(ctx).Muted() {
+		t.Errorf("Expected metrics of a plain context not to be muted")
+	}
+	if !For(Mute(ctx)).Muted() {
+		t.Errorf("Expected metrics of a muted context to be muted")
+	}
+	if err := For(Mute(ctx)).Increment(EngineEKSExecute, nil, 1); err != nil {
+		t.Errorf("Expected muted increment to be dropped, got %s", err.Error())
+	}
+}
@@ -0,0 +1,353 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/ecr/ecriface"
+	"github.com/pkg/errors"
+	"github.com/stitchfix/flotilla-os/config"
+	"github.com/stitchfix/flotilla-os/exceptions"
+	awstrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/aws/aws-sdk-go/aws"
+)
+
+const (
+	mediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+
+	// maxManifestSize bounds the manifests and image configs read from registries.
+	maxManifestSize = 4 << 20
+)
+
+var (
+	manifestAccept = strings.Join([]string{
+		mediaTypeOCIIndex,
+		mediaTypeDockerManifestList,
+		mediaTypeOCIManifest,
+		mediaTypeDockerManifest,
+	}, ", ")
+
+	ecrHost        = regexp.MustCompile(`^(\d{12})\.dkr\.ecr\.([a-z0-9-]+)\.amazonaws\.com(\.cn)?$`)
+	challengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+)
+
+// OCIRegistryClient resolves images against any registry implementing the
+// OCI distribution (docker registry v2) api. ECR registries are authenticated
+// with the service's AWS credentials, other registries with anonymous
+// bearer tokens.
+type OCIRegistryClient struct {
+	httpClient *http.Client
+	insecure   map[string]bool
+	cacheTTL   time.Duration
+
+	mu          sync.Mutex
+	cache       map[string]cachedImage
+	credentials map[string]credential
+	ecrClients  map[string]ecriface.ECRAPI
+}
+
+type cachedImage struct {
+	image   Image
+	expires time.Time
+}
+
+type credential struct {
+	header  string
+	expires time.Time
+}
+
+type manifest struct {
+	MediaType string `json:"mediaType"`
+	Manifests []struct {
+		Digest   string   `json:"digest"`
+		Platform Platform `json:"platform"`
+	} `json:"manifests"`
+	Config struct {
+		Digest string `json:"digest"`
+	} `json:"config"`
+}
+
+// Name returns the name of the registry client
+func (rc *OCIRegistryClient) Name() string {
+	return "oci"
+}
+
+// Initialize the registry client with the configured timeouts, cache duration
+// and the registries served over plain http.
+func (rc *OCIRegistryClient) Initialize(conf config.Config) error {
+	timeout := 5 * time.Second
+	if conf.IsSet("image_registry_timeout_seconds") {
+		timeout = time.Duration(conf.GetInt("image_registry_timeout_seconds")) * time.Second
+	}
+	rc.httpClient = &http.Client{Timeout: timeout}
+
+	if conf.IsSet("image_registry_cache_seconds") {
+		rc.cacheTTL = time.Duration(conf.GetInt("image_registry_cache_seconds")) * time.Second
+	} else {
+		rc.cacheTTL = 5 * time.Minute
+	}
+
+	rc.insecure = make(map[string]bool)
+	for _, host := range strings.Split(conf.GetString("image_registry_insecure_hosts"), ",") {
+		if host = strings.TrimSpace(host); len(host) > 0 {
+			rc.insecure[host] = true
+		}
+	}
+	rc.cache = make(map[string]cachedImage)
+	rc.credentials = make(map[string]credential)
+	rc.ecrClients = make(map[string]ecriface.ECRAPI)
+	return nil
+}
+
+// IsImageValid checks that the image exists in its registry.
+func (rc *OCIRegistryClient) IsImageValid(imageRef string) (bool, error) {
+	_, err := rc.ResolveImage(imageRef)
+	if err != nil {
+		if _, ok := err.(exceptions.MissingResource); ok {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// ResolveImage fetches the manifest of the image and returns its digest and
+// platforms. Images which don't exist return exceptions.MissingResource.
+func (rc *OCIRegistryClient) ResolveImage(imageRef string) (Image, error) {
+	ref, err := ParseReference(imageRef)
+	if err != nil {
+		return Image{}, exceptions.MalformedInput{ErrorString: err.Error()}
+	}
+
+	key := ref.String()
+	rc.mu.Lock()
+	cached, ok := rc.cache[key]
+	rc.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.image, nil
+	}
+
+	body, digest, err := rc.get(ref, fmt.Sprintf("manifests/%s", ref.Version()), manifestAccept)
+	if err != nil {
+		return Image{}, err
+	}
+
+	var m manifest
+	if err = json.Unmarshal(body, &m); err != nil {
+		return Image{}, errors.Wrapf(err, "problem decoding manifest of [%s]", key)
+	}
+
+	image := Image{Reference: ref, Digest: digest}
+	if len(image.Digest) == 0 {
+		image.Digest = fmt.Sprintf("sha256:%x", sha256.Sum256(body))
+	}
+	if len(m.Manifests) > 0 {
+		for _, entry := range m.Manifests {
+			// Attestation manifests are listed with an unknown platform.
+			if entry.Platform.Architecture != "unknown" {
+				image.Platforms = append(image.Platforms, entry.Platform)
+			}
+		}
+	} else if len(m.Config.Digest) > 0 {
+		// Single platform images only record their platform in the image config.
+		var platform Platform
+		if configBody, _, err := rc.get(ref, fmt.Sprintf("blobs/%s", m.Config.Digest), "*/*"); err == nil {
+			if json.Unmarshal(configBody, &platform) == nil && len(platform.Architecture) > 0 {
+				image.Platforms = []Platform{platform}
+			}
+		}
+	}
+
+	rc.mu.Lock()
+	rc.cache[key] = cachedImage{image: image, expires: time.Now().Add(rc.cacheTTL)}
+	rc.mu.Unlock()
+	return image, nil
+}
+
+// get reads a manifest or blob of the repository, authenticating with the
+// registry when challenged.
+func (rc *OCIRegistryClient) get(ref Reference, path string, accept string) ([]byte, string, error) {
+	scheme := "https"
+	if rc.insecure[ref.Registry] {
+		scheme = "http"
+	}
+	u := fmt.Sprintf("%s://%s/v2/%s/%s", scheme, ref.host(), ref.Repository, path)
+
+	var res *http.Response
+	for attempt := 0; attempt < 2; attempt++ {
+		req, err := http.NewRequest(http.MethodGet, u, nil)
+		if err != nil {
+			return nil, "", err
+		}
+		req.Header.Set("Accept", accept)
+		header, err := rc.authorization(ref)
+		if err != nil {
+			return nil, "", err
+		}
+		if len(header) > 0 {
+			req.Header.Set("Authorization", header)
+		}
+
+		res, err = rc.httpClient.Do(req)
+		if err != nil {
+			return nil, "", errors.Wrapf(err, "problem reaching registry [%s]", ref.Registry)
+		}
+		if res.StatusCode != http.StatusUnauthorized || attempt > 0 {
+			break
+		}
+		res.Body.Close()
+		if err = rc.authenticate(ref, res.Header.Get("WWW-Authenticate")); err != nil {
+			return nil, "", err
+		}
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusOK:
+	case res.StatusCode == http.StatusNotFound:
+		return nil, "", exceptions.MissingResource{
+			ErrorString: fmt.Sprintf("image [%s] was not found in registry [%s]", ref, ref.Registry)}
+	case res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden:
+		// Registries answer unauthorized for private and missing repositories
+		// alike, this isn't proof the image doesn't exist.
+		return nil, "", errors.Errorf("image [%s] is not accessible in registry [%s]", ref, ref.Registry)
+	default:
+		return nil, "", errors.Errorf("registry [%s] responded %s for [%s]", ref.Registry, res.Status, ref)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxManifestSize))
+	if err != nil {
+		return nil, "", err
+	}
+	return body, res.Header.Get("Docker-Content-Digest"), nil
+}
+
+// authorization returns the cached Authorization header for the repository,
+// fetching ECR credentials up front since ECR doesn't issue challenges for
+// anonymous tokens.
+func (rc *OCIRegistryClient) authorization(ref Reference) (string, error) {
+	rc.mu.Lock()
+	cred, ok := rc.credentials[rc.credentialKey(ref)]
+	rc.mu.Unlock()
+	if ok && time.Now().Before(cred.expires) {
+		return cred.header, nil
+	}
+	if m := ecrHost.FindStringSubmatch(ref.Registry); m != nil {
+		return rc.ecrAuthorization(ref, m[1], m[2])
+	}
+	return "", nil
+}
+
+func (rc *OCIRegistryClient) credentialKey(ref Reference) string {
+	if ecrHost.MatchString(ref.Registry) {
+		return ref.Registry
+	}
+	return ref.Name()
+}
+
+func (rc *OCIRegistryClient) ecrAuthorization(ref Reference, registryID string, region string) (string, error) {
+	rc.mu.Lock()
+	client, ok := rc.ecrClients[region]
+	if !ok {
+		sess := awstrace.WrapSession(session.Must(session.NewSession(&aws.Config{
+			Region: aws.String(region)})))
+		client = ecr.New(sess)
+		rc.ecrClients[region] = client
+	}
+	rc.mu.Unlock()
+
+	out, err := client.GetAuthorizationToken(&ecr.GetAuthorizationTokenInput{
+		RegistryIds: []*string{aws.String(registryID)},
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "problem getting authorization token for registry [%s]", ref.Registry)
+	}
+	if len(out.AuthorizationData) == 0 || out.AuthorizationData[0].AuthorizationToken == nil {
+		return "", errors.Errorf("no authorization token returned for registry [%s]", ref.Registry)
+	}
+
+	data := out.AuthorizationData[0]
+	cred := credential{
+		header:  "Basic " + *data.AuthorizationToken,
+		expires: time.Now().Add(time.Hour),
+	}
+	if data.ExpiresAt != nil {
+		// Refresh well before the token expires.
+		cred.expires = data.ExpiresAt.Add(-5 * time.Minute)
+	}
+	rc.mu.Lock()
+	rc.credentials[rc.credentialKey(ref)] = cred
+	rc.mu.Unlock()
+	return cred.header, nil
+}
+
+// authenticate answers a bearer challenge by fetching an anonymous pull token
+// for the repository from the registry's token service.
+func (rc *OCIRegistryClient) authenticate(ref Reference, challenge string) error {
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return errors.Errorf("registry [%s] requires credentials", ref.Registry)
+	}
+	params := make(map[string]string)
+	for _, m := range challengeParam.FindAllStringSubmatch(challenge, -1) {
+		params[strings.ToLower(m[1])] = m[2]
+	}
+	realm, err := url.Parse(params["realm"])
+	if err != nil || len(params["realm"]) == 0 {
+		return errors.Errorf("invalid authentication challenge from registry [%s]", ref.Registry)
+	}
+	q := realm.Query()
+	if service, ok := params["service"]; ok {
+		q.Set("service", service)
+	}
+	scope := params["scope"]
+	if len(scope) == 0 {
+		scope = fmt.Sprintf("repository:%s:pull", ref.Repository)
+	}
+	q.Set("scope", scope)
+	realm.RawQuery = q.Encode()
+
+	res, err := rc.httpClient.Get(realm.String())
+	if err != nil {
+		return errors.Wrapf(err, "problem getting token from registry [%s]", ref.Registry)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return errors.Errorf("token service of registry [%s] responded %s", ref.Registry, res.Status)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err = json.NewDecoder(io.LimitReader(res.Body, maxManifestSize)).Decode(&token); err != nil {
+		return errors.Wrapf(err, "problem decoding token from registry [%s]", ref.Registry)
+	}
+	if len(token.Token) == 0 {
+		token.Token = token.AccessToken
+	}
+	if token.ExpiresIn <= 0 {
+		token.ExpiresIn = 60
+	}
+
+	rc.mu.Lock()
+	rc.credentials[rc.credentialKey(ref)] = credential{
+		header:  "Bearer " + token.Token,
+		expires: time.Now().Add(time.Duration(token.ExpiresIn) * time.Second),
+	}
+	rc.mu.Unlock()
+	return nil
+}
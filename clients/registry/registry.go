@@ -0,0 +1,162 @@
+package registry
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/stitchfix/flotilla-os/config"
+)
+
+// Client checks images against the registry hosting them. It is used
+// when creating definitions and runs to reject images which can never
+// be pulled, and to pin the tag of a run's image to an immutable digest.
+type Client interface {
+	Name() string
+	Initialize(conf config.Config) error
+	IsImageValid(imageRef string) (bool, error)
+	ResolveImage(imageRef string) (Image, error)
+}
+
+// Image is an image resolved against its registry.
+type Image struct {
+	Reference Reference
+	// Digest is the content digest of the manifest (or manifest list) the
+	// tag pointed to when it was resolved.
+	Digest    string
+	Platforms []Platform
+}
+
+// Platform is an os/architecture an image was built for.
+type Platform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// SupportsArch checks whether the image can run on the given architecture;
+// images without platform information are assumed to support any.
+func (i Image) SupportsArch(arch string) bool {
+	if len(i.Platforms) == 0 {
+		return true
+	}
+	for _, p := range i.Platforms {
+		if p.Architecture == arch {
+			return true
+		}
+	}
+	return false
+}
+
+// Architectures lists the architectures the image was built for.
+func (i Image) Architectures() []string {
+	var archs []string
+	for _, p := range i.Platforms {
+		archs = append(archs, p.Architecture)
+	}
+	return archs
+}
+
+// Pinned returns the image reference pinned to the resolved digest.
+func (i Image) Pinned() string {
+	return fmt.Sprintf("%s@%s", i.Reference.Name(), i.Digest)
+}
+
+const (
+	dockerHubRegistry = "docker.io"
+	dockerHubHost     = "registry-1.docker.io"
+	defaultTag        = "latest"
+)
+
+// Reference is a parsed image reference, eg.
+// 123456789012.dkr.ecr.us-east-1.amazonaws.com/team/job:v1
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ParseReference splits an image reference in its registry, repository and
+// tag or digest. Images without a registry are on docker hub.
+func ParseReference(imageRef string) (Reference, error) {
+	var ref Reference
+	name := strings.TrimSpace(imageRef)
+	if len(name) == 0 {
+		return ref, errors.New("empty image reference")
+	}
+
+	if i := strings.Index(name, "@"); i >= 0 {
+		ref.Digest = name[i+1:]
+		name = name[:i]
+		if !strings.Contains(ref.Digest, ":") {
+			return ref, errors.Errorf("invalid digest in image reference [%s]", imageRef)
+		}
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		ref.Tag = name[i+1:]
+		name = name[:i]
+	}
+
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		ref.Registry = parts[0]
+		ref.Repository = parts[1]
+	} else {
+		ref.Registry = dockerHubRegistry
+		ref.Repository = name
+		if len(parts) == 1 {
+			ref.Repository = "library/" + name
+		}
+	}
+
+	if len(ref.Repository) == 0 || ref.Repository != strings.ToLower(ref.Repository) {
+		return ref, errors.Errorf("invalid repository in image reference [%s]", imageRef)
+	}
+	if len(ref.Tag) == 0 && len(ref.Digest) == 0 {
+		ref.Tag = defaultTag
+	}
+	return ref, nil
+}
+
+// Name is the reference without its tag or digest.
+func (r Reference) Name() string {
+	return fmt.Sprintf("%s/%s", r.Registry, r.Repository)
+}
+
+// Version is the digest of the reference if set, otherwise its tag.
+func (r Reference) Version() string {
+	if len(r.Digest) > 0 {
+		return r.Digest
+	}
+	return r.Tag
+}
+
+func (r Reference) String() string {
+	if len(r.Digest) > 0 {
+		return fmt.Sprintf("%s@%s", r.Name(), r.Digest)
+	}
+	return fmt.Sprintf("%s:%s", r.Name(), r.Tag)
+}
+
+// host is the address the registry api is served on.
+func (r Reference) host() string {
+	if r.Registry == dockerHubRegistry {
+		return dockerHubHost
+	}
+	return r.Registry
+}
+
+// NewRegistryClient returns a registry client
+func NewRegistryClient(conf config.Config, name string) (Client, error) {
+	switch name {
+	case "oci":
+		rc := &OCIRegistryClient{}
+		if err := rc.Initialize(conf); err != nil {
+			return nil, errors.Wrap(err, "problem initializing OCIRegistryClient")
+		}
+		return rc, nil
+	default:
+		return nil, fmt.Errorf("No Client named [%s] was found", name)
+	}
+}
@@ -0,0 +1,125 @@
+package registry
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stitchfix/flotilla-os/exceptions"
+)
+
+func TestParseReference(t *testing.T) {
+	cases := []struct {
+		ref      string
+		expected Reference
+	}{
+		{"ubuntu", Reference{Registry: "docker.io", Repository: "library/ubuntu", Tag: "latest"}},
+		{"ubuntu:22.04", Reference{Registry: "docker.io", Repository: "library/ubuntu", Tag: "22.04"}},
+		{"team/job:v1", Reference{Registry: "docker.io", Repository: "team/job", Tag: "v1"}},
+		{"localhost:5000/job", Reference{Registry: "localhost:5000", Repository: "job", Tag: "latest"}},
+		{"123456789012.dkr.ecr.us-east-1.amazonaws.com/team/job:v1",
+			Reference{Registry: "123456789012.dkr.ecr.us-east-1.amazonaws.com", Repository: "team/job", Tag: "v1"}},
+		{"ghcr.io/team/job@sha256:abc",
+			Reference{Registry: "ghcr.io", Repository: "team/job", Digest: "sha256:abc"}},
+	}
+	for _, c := range cases {
+		ref, err := ParseReference(c.ref)
+		if err != nil {
+			t.Errorf("[%s] unexpected error %v", c.ref, err)
+			continue
+		}
+		if ref != c.expected {
+			t.Errorf("[%s] expected %+v but was %+v", c.ref, c.expected, ref)
+		}
+	}
+
+	for _, invalid := range []string{"", "Team/Job", "job@abc"} {
+		if _, err := ParseReference(invalid); err == nil {
+			t.Errorf("[%s] expected an error", invalid)
+		}
+	}
+}
+
+func newTestRegistry(t *testing.T) (*OCIRegistryClient, string) {
+	var host string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if r.URL.Query().Get("scope") != "repository:team/job:pull" {
+				t.Errorf("unexpected token scope %s", r.URL.Query().Get("scope"))
+			}
+			fmt.Fprint(w, `{"token":"secret","expires_in":300}`)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("WWW-Authenticate",
+				fmt.Sprintf(`Bearer realm="http://%s/token",service="test",scope="repository:team/job:pull"`, host))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/team/job/manifests/multi":
+			w.Header().Set("Docker-Content-Digest", "sha256:multi")
+			fmt.Fprint(w, `{"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[
+				{"digest":"sha256:a","platform":{"os":"linux","architecture":"amd64"}},
+				{"digest":"sha256:b","platform":{"os":"linux","architecture":"arm64"}},
+				{"digest":"sha256:c","platform":{"os":"unknown","architecture":"unknown"}}]}`)
+		case "/v2/team/job/manifests/single":
+			w.Header().Set("Docker-Content-Digest", "sha256:single")
+			fmt.Fprint(w, `{"mediaType":"application/vnd.docker.distribution.manifest.v2+json","config":{"digest":"sha256:config"}}`)
+		case "/v2/team/job/blobs/sha256:config":
+			fmt.Fprint(w, `{"os":"linux","architecture":"arm64"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	u, _ := url.Parse(server.URL)
+	host = u.Host
+	rc := &OCIRegistryClient{
+		httpClient:  server.Client(),
+		insecure:    map[string]bool{host: true},
+		cacheTTL:    time.Minute,
+		cache:       make(map[string]cachedImage),
+		credentials: make(map[string]credential),
+	}
+	return rc, host
+}
+
+func TestOCIRegistryClient_ResolveImage(t *testing.T) {
+	rc, host := newTestRegistry(t)
+
+	image, err := rc.ResolveImage(host + "/team/job:multi")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if image.Digest != "sha256:multi" {
+		t.Errorf("expected digest sha256:multi but was %s", image.Digest)
+	}
+	if strings.Join(image.Architectures(), ",") != "amd64,arm64" {
+		t.Errorf("expected architectures amd64,arm64 but was %v", image.Architectures())
+	}
+	if image.Pinned() != host+"/team/job@sha256:multi" {
+		t.Errorf("unexpected pinned image %s", image.Pinned())
+	}
+
+	image, err = rc.ResolveImage(host + "/team/job:single")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !image.SupportsArch("arm64") || image.SupportsArch("amd64") {
+		t.Errorf("expected single platform image to only support arm64 but was %v", image.Architectures())
+	}
+
+	_, err = rc.ResolveImage(host + "/team/job:missing")
+	if _, ok := err.(exceptions.MissingResource); !ok {
+		t.Errorf("expected MissingResource for a missing tag but was %v", err)
+	}
+	if valid, err := rc.IsImageValid(host + "/team/job:missing"); valid || err != nil {
+		t.Errorf("expected missing image to be invalid without error but was %v, %v", valid, err)
+	}
+}
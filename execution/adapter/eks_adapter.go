@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -16,17 +17,32 @@ import (
 	"github.com/stitchfix/flotilla-os/state"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 type EKSAdapter interface {
 	AdaptJobToFlotillaRun(job *batchv1.Job, run state.Run, pod *corev1.Pod) (state.Run, error)
-	AdaptFlotillaDefinitionAndRunToJob(ctx context.Context, executable state.Executable, run state.Run, schedulerName string, manager state.Manager, araEnabled bool, capabilities state.Capabilities) (batchv1.Job, error)
+	AdaptFlotillaDefinitionAndRunToJob(ctx context.Context, executable state.Executable, run state.Run, schedulerName string, manager state.Manager, araEnabled bool, capabilities state.Capabilities, policy state.SchedulingPolicy) (batchv1.Job, error)
+	AdaptFlotillaRunToService(run state.Run) *corev1.Service
+	AdaptFlotillaRunToPortsService(executable state.Executable, run state.Run) *corev1.Service
+	AdaptFlotillaRunToIngress(run state.Run, service *corev1.Service) (*networkingv1.Ingress, error)
+	AdaptExposureToEndpoints(run state.Run, namespace string, service *corev1.Service, ingress *networkingv1.Ingress) state.RunEndpoints
+	AdaptPodsToReplicas(pods []corev1.Pod) state.ReplicaPods
 }
 type eksAdapter struct {
 	logger               flotillaLog.Logger
 	lakekeeperSecretName string
+	replicaMasterPort    int32
+	outputUploaderImage  string
+	outputDir            string
+	stopSignal           string
+	gracePeriodSeconds   *int64
+	ingressHostTemplate  *template.Template
+	ingressClassName     string
+	ingressTLSSecretName string
+	ingressAnnotations   map[string]string
 }
 
 // NewEKSAdapter configures and returns an eks adapter for translating
@@ -35,6 +51,30 @@ func NewEKSAdapter(conf config.Config, logger flotillaLog.Logger) (EKSAdapter, e
 	adapter := eksAdapter{
 		logger:               logger,
 		lakekeeperSecretName: conf.GetString("eks_lakekeeper_secret_name"),
+		replicaMasterPort:    29500,
+		outputUploaderImage:  conf.GetString("eks_output_uploader_image"),
+		outputDir:            "/flotilla/output",
+		stopSignal:           conf.GetString("eks_interruption_signal"),
+		ingressClassName:     conf.GetString("eks_ingress_class_name"),
+		ingressTLSSecretName: conf.GetString("eks_ingress_tls_secret_name"),
+		ingressAnnotations:   conf.GetStringMapString("eks_ingress_annotations"),
+	}
+	if conf.IsSet("eks_ingress_host_template") {
+		hostTemplate, err := template.New("ingress_host").Parse(conf.GetString("eks_ingress_host_template"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid eks_ingress_host_template: %w", err)
+		}
+		adapter.ingressHostTemplate = hostTemplate
+	}
+	if conf.IsSet("eks_interruption_grace_period_seconds") {
+		gracePeriod := int64(conf.GetInt("eks_interruption_grace_period_seconds"))
+		adapter.gracePeriodSeconds = &gracePeriod
+	}
+	if conf.IsSet("eks_output_dir") {
+		adapter.outputDir = conf.GetString("eks_output_dir")
+	}
+	if conf.IsSet("eks_replica_master_port") {
+		adapter.replicaMasterPort = int32(conf.GetInt("eks_replica_master_port"))
 	}
 	return &adapter, nil
 }
@@ -43,8 +83,16 @@ func NewEKSAdapter(conf config.Config, logger flotillaLog.Logger) (EKSAdapter, e
 // This method maps the exit code & timestamps from Kubernetes to Flotilla's Run object.
 func (a *eksAdapter) AdaptJobToFlotillaRun(job *batchv1.Job, run state.Run, pod *corev1.Pod) (state.Run, error) {
 	updated := run
-	if job.Status.Active == 1 && job.Status.CompletionTime == nil {
-		updated.Status = state.StatusRunning
+	if run.IsReplicated() {
+		updated = a.adaptIndexedJobToFlotillaRun(job, run)
+	} else if job.Status.Active == 1 && job.Status.CompletionTime == nil {
+		// An active job's pod may still be waiting to be scheduled or for
+		// its containers to start.
+		if pod != nil && pod.Status.Phase == corev1.PodPending {
+			updated.Status = state.StatusPending
+		} else {
+			updated.Status = state.StatusRunning
+		}
 	} else if job.Status.Succeeded == 1 {
 		if pod != nil {
 			if pod.Status.Phase == corev1.PodSucceeded {
@@ -63,8 +111,7 @@ func (a *eksAdapter) AdaptJobToFlotillaRun(job *batchv1.Job, run state.Run, pod
 		var exitCode int64 = 1
 		updated.Status = state.StatusStopped
 		if pod != nil {
-			if pod.Status.ContainerStatuses != nil && len(pod.Status.ContainerStatuses) > 0 {
-				containerStatus := pod.Status.ContainerStatuses[len(pod.Status.ContainerStatuses)-1]
+			if containerStatus := mainContainerStatus(pod, run); containerStatus != nil {
 				if containerStatus.State.Terminated != nil {
 					updated.ExitReason = &containerStatus.State.Terminated.Reason
 					exitCode = int64(containerStatus.State.Terminated.ExitCode)
@@ -104,8 +151,12 @@ func (a *eksAdapter) AdaptJobToFlotillaRun(job *batchv1.Job, run state.Run, pod
 // 3. Environment variables to be setup.
 // 4. Port mappings.
 // 5. Node lifecycle.
-// 6. Node affinity and anti-affinity
-func (a *eksAdapter) AdaptFlotillaDefinitionAndRunToJob(ctx context.Context, executable state.Executable, run state.Run, schedulerName string, manager state.Manager, araEnabled bool, capabilities state.Capabilities) (batchv1.Job, error) {
+// 6. Node affinity and anti-affinity, following the cluster's scheduling policy
+// 7. Indexed completion, one pod per replica, for replicated runs
+// 8. Init containers, sidecars and the volumes they share with the run
+// 9. The output directory and its uploader, when configured
+// 10. The signal and grace period the run's container is stopped with
+func (a *eksAdapter) AdaptFlotillaDefinitionAndRunToJob(ctx context.Context, executable state.Executable, run state.Run, schedulerName string, manager state.Manager, araEnabled bool, capabilities state.Capabilities, policy state.SchedulingPolicy) (batchv1.Job, error) {
 	cmd := ""
 
 	if run.Command != nil && len(*run.Command) > 0 {
@@ -118,13 +169,23 @@ func (a *eksAdapter) AdaptFlotillaDefinitionAndRunToJob(ctx context.Context, exe
 	resourceRequirements, run := a.constructResourceRequirements(ctx, executable, run, manager, araEnabled)
 
 	volumeMounts, volumes := a.constructVolumeMounts(ctx, executable, run, manager, araEnabled)
+	initContainers, sharedVolumes, sharedMounts := a.constructExtraContainers(executable, run)
+	volumeMounts = append(volumeMounts, sharedMounts...)
+	volumes = append(volumes, sharedVolumes...)
+	env := append(a.envOverrides(executable, run), a.lakekeeperSecretEnvVars()...)
+	if uploader, outputVolume, outputMount := a.constructOutputUploader(executable, run); uploader != nil {
+		initContainers = append([]corev1.Container{*uploader}, initContainers...)
+		volumes = append(volumes, outputVolume)
+		volumeMounts = append(volumeMounts, outputMount)
+		env = append(env, corev1.EnvVar{Name: state.OutputDirVar, Value: a.outputDir})
+	}
 
 	container := corev1.Container{
 		Name:            run.RunID,
-		Image:           run.Image,
+		Image:           run.PinnedImage(),
 		Command:         cmdSlice,
 		Resources:       resourceRequirements,
-		Env:             append(a.envOverrides(executable, run), a.lakekeeperSecretEnvVars()...),
+		Env:             env,
 		Ports:           a.constructContainerPorts(executable),
 		ImagePullPolicy: corev1.PullAlways,
 	}
@@ -132,8 +193,12 @@ func (a *eksAdapter) AdaptFlotillaDefinitionAndRunToJob(ctx context.Context, exe
 	if volumeMounts != nil {
 		container.VolumeMounts = volumeMounts
 	}
-	affinity := a.constructAffinity(ctx, executable, run, manager, capabilities)
-	tolerations := a.constructTolerations(executable, run, capabilities)
+	if len(a.stopSignal) > 0 {
+		signal := corev1.Signal(a.stopSignal)
+		container.Lifecycle = &corev1.Lifecycle{StopSignal: &signal}
+	}
+	affinity := a.constructAffinity(ctx, executable, run, manager, capabilities, policy)
+	tolerations := a.constructTolerations(executable, run, capabilities, policy)
 
 	annotations := map[string]string{}
 	annotations["prometheus.io/port"] = "9090"
@@ -152,12 +217,14 @@ func (a *eksAdapter) AdaptFlotillaDefinitionAndRunToJob(ctx context.Context, exe
 				Labels:      labels,
 			},
 			Spec: corev1.PodSpec{
-				SchedulerName:      schedulerName,
-				Containers:         []corev1.Container{container},
-				RestartPolicy:      corev1.RestartPolicyNever,
-				ServiceAccountName: *run.ServiceAccount,
-				Affinity:           affinity,
-				Tolerations:        tolerations,
+				SchedulerName:             schedulerName,
+				Containers:                []corev1.Container{container},
+				InitContainers:            initContainers,
+				RestartPolicy:             corev1.RestartPolicyNever,
+				ServiceAccountName:        *run.ServiceAccount,
+				Affinity:                  affinity,
+				Tolerations:               tolerations,
+				TopologySpreadConstraints: policy.TopologySpreadConstraints(run.RunID),
 			},
 		},
 	}
@@ -165,6 +232,11 @@ func (a *eksAdapter) AdaptFlotillaDefinitionAndRunToJob(ctx context.Context, exe
 	if volumes != nil {
 		jobSpec.Template.Spec.Volumes = volumes
 	}
+	if container.Lifecycle != nil {
+		// Stop signals are only allowed on pods declaring their OS.
+		jobSpec.Template.Spec.OS = &corev1.PodOS{Name: corev1.Linux}
+	}
+	jobSpec.Template.Spec.TerminationGracePeriodSeconds = a.gracePeriodSeconds
 
 	eksJob := batchv1.Job{
 		Spec: jobSpec,
@@ -173,6 +245,10 @@ func (a *eksAdapter) AdaptFlotillaDefinitionAndRunToJob(ctx context.Context, exe
 		},
 	}
 
+	if run.IsReplicated() {
+		a.adaptReplicatedJob(&eksJob, run, policy)
+	}
+
 	return eksJob, nil
 }
 func (a *eksAdapter) constructEviction(ctx context.Context, run state.Run, manager state.Manager) string {
@@ -205,7 +281,7 @@ func (a *eksAdapter) constructContainerPorts(executable state.Executable) []core
 	return containerPorts
 }
 
-func (a *eksAdapter) constructTolerations(executable state.Executable, run state.Run, capabilities state.Capabilities) []corev1.Toleration {
+func (a *eksAdapter) constructTolerations(executable state.Executable, run state.Run, capabilities state.Capabilities, policy state.SchedulingPolicy) []corev1.Toleration {
 	executableResources := executable.GetExecutableResources()
 	tolerations := []corev1.Toleration{}
 
@@ -232,14 +308,14 @@ func (a *eksAdapter) constructTolerations(executable state.Executable, run state
 
 		if capabilities.Has(state.CapSharedPool) {
 			cpu, mem := a.getResourceDefaults(run, executable)
-			size := state.PoolSize(cpu, mem)
-			routing := state.SharedPoolRouting(size)
+			size := policy.PoolSize(cpu, mem)
+			routing := policy.SharedPoolRouting(size)
 			tolerations = append(tolerations, routing.Tolerations...)
 		} else if capabilities.Has(state.CapPoolSizing) {
 			cpu, mem := a.getResourceDefaults(run, executable)
-			size := state.PoolSize(cpu, mem)
+			size := policy.PoolSize(cpu, mem)
 			tolerations = append(tolerations, corev1.Toleration{
-				Key:      "flotilla-pool",
+				Key:      policy.PoolKey,
 				Operator: "Equal",
 				Value:    size,
 				Effect:   "NoSchedule",
@@ -247,16 +323,16 @@ func (a *eksAdapter) constructTolerations(executable state.Executable, run state
 		}
 	}
 
+	tolerations = append(tolerations, policy.Tolerations...)
 	return tolerations
 }
 
-func (a *eksAdapter) constructAffinity(ctx context.Context, executable state.Executable, run state.Run, manager state.Manager, capabilities state.Capabilities) *corev1.Affinity {
+func (a *eksAdapter) constructAffinity(ctx context.Context, executable state.Executable, run state.Run, manager state.Manager, capabilities state.Capabilities, policy state.SchedulingPolicy) *corev1.Affinity {
 	affinity := &corev1.Affinity{}
 	var requiredMatch []corev1.NodeSelectorRequirement
 	var preferredMatches []corev1.PreferredSchedulingTerm
-	//todo move to config
-	nodeLifecycleKey := "karpenter.sh/capacity-type"
-	nodeArchKey := "kubernetes.io/arch"
+	nodeLifecycleKey := policy.CapacityTypeKey
+	nodeArchKey := policy.ArchKey
 
 	var nodeLifecycle []string
 	if run.NodeLifecycle != nil && *run.NodeLifecycle == state.OndemandLifecycle {
@@ -265,7 +341,6 @@ func (a *eksAdapter) constructAffinity(ctx context.Context, executable state.Exe
 		nodeLifecycle = append(nodeLifecycle, "spot", "on-demand")
 	}
 
-	//todo move to config
 	arch := []string{"amd64"}
 	if run.Arch != nil && *run.Arch == "arm64" {
 		arch = []string{"arm64"}
@@ -289,7 +364,7 @@ func (a *eksAdapter) constructAffinity(ctx context.Context, executable state.Exe
 	if team, ok := run.Labels["team"]; ok && team != "" && !isGPU && !isWaitForData {
 		if !capabilities.Has(state.CapSharedPool) {
 			requiredMatch = append(requiredMatch, corev1.NodeSelectorRequirement{
-				Key:      "team",
+				Key:      policy.TeamKey,
 				Operator: corev1.NodeSelectorOpIn,
 				Values:   []string{team},
 			})
@@ -297,8 +372,8 @@ func (a *eksAdapter) constructAffinity(ctx context.Context, executable state.Exe
 
 		if capabilities.Has(state.CapSharedPool) {
 			cpu, mem := a.getResourceDefaults(run, executable)
-			size := state.PoolSize(cpu, mem)
-			routing := state.SharedPoolRouting(size)
+			size := policy.PoolSize(cpu, mem)
+			routing := policy.SharedPoolRouting(size)
 			if routing.RequiredAffinity != nil {
 				requiredMatch = append(requiredMatch, *routing.RequiredAffinity)
 			}
@@ -307,15 +382,18 @@ func (a *eksAdapter) constructAffinity(ctx context.Context, executable state.Exe
 			}
 		} else if capabilities.Has(state.CapPoolSizing) {
 			cpu, mem := a.getResourceDefaults(run, executable)
-			size := state.PoolSize(cpu, mem)
+			size := policy.PoolSize(cpu, mem)
 			requiredMatch = append(requiredMatch, corev1.NodeSelectorRequirement{
-				Key:      "flotilla-pool",
+				Key:      policy.PoolKey,
 				Operator: corev1.NodeSelectorOpIn,
 				Values:   []string{size},
 			})
 		}
 	}
 
+	requiredMatch = append(requiredMatch, policy.RequiredTerms...)
+	preferredMatches = append(preferredMatches, policy.PreferredTerms...)
+
 	affinity = &corev1.Affinity{
 		NodeAffinity: &corev1.NodeAffinity{
 			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
@@ -415,6 +493,11 @@ func (a *eksAdapter) constructVolumeMounts(ctx context.Context, executable state
 			MountPath: "/var/run/docker.sock",
 		})
 	}
+	if run.Volumes != nil {
+		runVolumes, runMounts := run.Volumes.KubernetesVolumes()
+		volumes = append(volumes, runVolumes...)
+		mounts = append(mounts, runMounts...)
+	}
 	return mounts, volumes
 }
 
@@ -432,6 +515,7 @@ func (a *eksAdapter) adaptiveResources(ctx context.Context, executable state.Exe
 	defaultMem := memRequest
 
 	// Create tags for metrics (engine + cluster to avoid high cardinality)
+	m := metrics.For(ctx)
 	metricTags := []string{"engine:eks"}
 	if run.ClusterName != "" {
 		metricTags = append(metricTags, fmt.Sprintf("cluster:%s", run.ClusterName))
@@ -441,7 +525,7 @@ func (a *eksAdapter) adaptiveResources(ctx context.Context, executable state.Exe
 		// Check if command_hash is NULL (malformed job with no command)
 		if run.CommandHash == nil {
 			// Command hash is NULL - skip ARA for malformed jobs
-			_ = metrics.Increment(metrics.EngineEKSARANullCommandHash, metricTags, 1)
+			_ = m.Increment(metrics.EngineEKSARANullCommandHash, metricTags, 1)
 			if a.logger != nil {
 				_ = a.logger.Log(
 					"level", "warn",
@@ -453,13 +537,13 @@ func (a *eksAdapter) adaptiveResources(ctx context.Context, executable state.Exe
 			}
 		} else {
 			// Track ARA estimation attempt
-			_ = metrics.Increment(metrics.EngineEKSARAEstimationAttempted, metricTags, 1)
+			_ = m.Increment(metrics.EngineEKSARAEstimationAttempted, metricTags, 1)
 
 			// Pass command_hash directly instead of run_id (optimization)
 			estimatedResources, err := manager.EstimateRunResources(ctx, *executable.GetExecutableID(), *run.CommandHash)
 			if err == nil {
 				// Track successful estimation
-				_ = metrics.Increment(metrics.EngineEKSARAEstimationSucceeded, metricTags, 1)
+				_ = m.Increment(metrics.EngineEKSARAEstimationSucceeded, metricTags, 1)
 
 				// Extract int64 values from NullInt64 (we know they're valid because err == nil)
 				estimatedCPU := estimatedResources.Cpu.Int64
@@ -470,16 +554,16 @@ func (a *eksAdapter) adaptiveResources(ctx context.Context, executable state.Exe
 
 				if araTriggered {
 					// Track that ARA triggered resource adjustment
-					_ = metrics.Increment(metrics.EngineEKSARAResourceAdjustment, metricTags, 1)
+					_ = m.Increment(metrics.EngineEKSARAResourceAdjustment, metricTags, 1)
 
 					// Track the magnitude of adjustment as ratios (better for understanding relative growth)
 					if defaultMem > 0 {
 						memoryRatio := float64(estimatedMemory) / float64(defaultMem)
-						_ = metrics.Histogram(metrics.EngineEKSARAMemoryIncreaseRatio, memoryRatio, metricTags, 1)
+						_ = m.Histogram(metrics.EngineEKSARAMemoryIncreaseRatio, memoryRatio, metricTags, 1)
 					}
 					if defaultCPU > 0 {
 						cpuRatio := float64(estimatedCPU) / float64(defaultCPU)
-						_ = metrics.Histogram(metrics.EngineEKSARACPUIncreaseRatio, cpuRatio, metricTags, 1)
+						_ = m.Histogram(metrics.EngineEKSARACPUIncreaseRatio, cpuRatio, metricTags, 1)
 					}
 
 					// Log detailed information when ARA triggers (INFO level)
@@ -508,27 +592,27 @@ func (a *eksAdapter) adaptiveResources(ctx context.Context, executable state.Exe
 				memIncrease := memRequest - defaultMem
 
 				// Emit default and ARA resource distributions
-				_ = metrics.Distribution(metrics.EngineEKSARADefaultCPU, float64(defaultCPU), metricTags, 1)
-				_ = metrics.Distribution(metrics.EngineEKSARAARACPU, float64(cpuRequest), metricTags, 1)
-				_ = metrics.Distribution(metrics.EngineEKSARADefaultMemory, float64(defaultMem), metricTags, 1)
-				_ = metrics.Distribution(metrics.EngineEKSARAARAMemory, float64(memRequest), metricTags, 1)
+				_ = m.Distribution(metrics.EngineEKSARADefaultCPU, float64(defaultCPU), metricTags, 1)
+				_ = m.Distribution(metrics.EngineEKSARAARACPU, float64(cpuRequest), metricTags, 1)
+				_ = m.Distribution(metrics.EngineEKSARADefaultMemory, float64(defaultMem), metricTags, 1)
+				_ = m.Distribution(metrics.EngineEKSARAARAMemory, float64(memRequest), metricTags, 1)
 
 				// Emit increase amounts
 				if cpuIncrease > 0 {
-					_ = metrics.Distribution(metrics.EngineEKSARACPUIncrease, float64(cpuIncrease), metricTags, 1)
+					_ = m.Distribution(metrics.EngineEKSARACPUIncrease, float64(cpuIncrease), metricTags, 1)
 				}
 				if memIncrease > 0 {
-					_ = metrics.Distribution(metrics.EngineEKSARAMemoryIncrease, float64(memIncrease), metricTags, 1)
+					_ = m.Distribution(metrics.EngineEKSARAMemoryIncrease, float64(memIncrease), metricTags, 1)
 				}
 			} else {
 				// Check if this is a missing resource error (expected for new jobs) vs a real error
 				var missingResource exceptions.MissingResource
 				if errors.As(err, &missingResource) {
 					// No historical data available - this is expected for new jobs or jobs that haven't OOM'd
-					_ = metrics.Increment(metrics.EngineEKSARANoHistoricalData, metricTags, 1)
+					_ = m.Increment(metrics.EngineEKSARANoHistoricalData, metricTags, 1)
 				} else {
 					// Track failed estimation (actual error)
-					_ = metrics.Increment(metrics.EngineEKSARAEstimationFailed, metricTags, 1)
+					_ = m.Increment(metrics.EngineEKSARAEstimationFailed, metricTags, 1)
 				}
 			}
 
@@ -545,15 +629,15 @@ func (a *eksAdapter) adaptiveResources(ctx context.Context, executable state.Exe
 	// Check bounds - this will also emit metrics/logs for max hits
 	cpuRequestBeforeBounds := cpuRequest
 	memRequestBeforeBounds := memRequest
-	cpuRequest, memRequest, maxCPUHit, maxMemHit := a.checkResourceBounds(cpuRequest, memRequest, isGPUJob, run, executable, defaultCPU, defaultMem)
-	cpuLimit, memLimit, _, _ = a.checkResourceBounds(cpuLimit, memLimit, isGPUJob, run, executable, defaultCPU, defaultMem)
+	cpuRequest, memRequest, maxCPUHit, maxMemHit := a.checkResourceBounds(m, cpuRequest, memRequest, isGPUJob, run, executable, defaultCPU, defaultMem)
+	cpuLimit, memLimit, _, _ = a.checkResourceBounds(m, cpuLimit, memLimit, isGPUJob, run, executable, defaultCPU, defaultMem)
 
 	// Emit final resource distributions
-	_ = metrics.Histogram(metrics.EngineEKSARAFinalMemoryMB, float64(memRequest), metricTags, 1)
-	_ = metrics.Histogram(metrics.EngineEKSARAFinalCPUMillicores, float64(cpuRequest), metricTags, 1)
+	_ = m.Histogram(metrics.EngineEKSARAFinalMemoryMB, float64(memRequest), metricTags, 1)
+	_ = m.Histogram(metrics.EngineEKSARAFinalCPUMillicores, float64(cpuRequest), metricTags, 1)
 
 	// Emit structured log when max resources hit
-	if maxMemHit || maxCPUHit {
+	if (maxMemHit || maxCPUHit) && !m.Muted() {
 		a.emitARAMetrics(run, defaultCPU, defaultMem, cpuRequest, memRequest, cpuRequestBeforeBounds, memRequestBeforeBounds, maxCPUHit, maxMemHit)
 	}
 
@@ -608,7 +692,7 @@ func (a *eksAdapter) emitARAMetrics(run state.Run, defaultCPU int64, defaultMem
 
 // checkResourceBounds enforces resource limits and emits metrics/logs when limits are hit
 // Returns: adjusted CPU, adjusted memory, whether max CPU was hit, whether max memory was hit
-func (a *eksAdapter) checkResourceBounds(cpu int64, mem int64, isGPUJob bool, run state.Run, executable state.Executable, defaultCPU int64, defaultMem int64) (int64, int64, bool, bool) {
+func (a *eksAdapter) checkResourceBounds(m metrics.Scoped, cpu int64, mem int64, isGPUJob bool, run state.Run, executable state.Executable, defaultCPU int64, defaultMem int64) (int64, int64, bool, bool) {
 	maxMem := state.MaxMem
 	maxCPU := state.MaxCPU
 
@@ -632,7 +716,7 @@ func (a *eksAdapter) checkResourceBounds(cpu int64, mem int64, isGPUJob bool, ru
 	if cpu > maxCPU {
 		maxCPUHit = true
 		// Track hitting max CPU limit
-		_ = metrics.Increment(metrics.EngineEKSARAHitMaxCPU, metricTags, 1)
+		_ = m.Increment(metrics.EngineEKSARAHitMaxCPU, metricTags, 1)
 
 		cpu = maxCPU
 	}
@@ -643,7 +727,7 @@ func (a *eksAdapter) checkResourceBounds(cpu int64, mem int64, isGPUJob bool, ru
 	if mem > maxMem {
 		maxMemHit = true
 		// Track hitting max memory limit - THIS IS THE KEY METRIC
-		_ = metrics.Increment(metrics.EngineEKSARAHitMaxMemory, metricTags, 1)
+		_ = m.Increment(metrics.EngineEKSARAHitMaxMemory, metricTags, 1)
 
 		mem = maxMem
 	}
@@ -5,9 +5,11 @@ import (
 	"database/sql"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/stitchfix/flotilla-os/config"
 	"github.com/stitchfix/flotilla-os/state"
+	corev1 "k8s.io/api/core/v1"
 )
 
 func TestRoundCPUMillicores(t *testing.T) {
@@ -173,6 +175,9 @@ func (m *mockStateManager) GetRun(ctx context.Context, runID string) (state.Run,
 	return state.Run{}, nil
 }
 func (m *mockStateManager) CreateRun(ctx context.Context, r state.Run) error { return nil }
+func (m *mockStateManager) CreateRuns(ctx context.Context, runs []state.Run) error {
+	return nil
+}
 func (m *mockStateManager) UpdateRun(ctx context.Context, runID string, updates state.Run) (state.Run, error) {
 	return state.Run{}, nil
 }
@@ -194,6 +199,24 @@ func (m *mockStateManager) GetWorker(ctx context.Context, workerType string, eng
 func (m *mockStateManager) UpdateWorker(ctx context.Context, workerType string, updates state.Worker) (state.Worker, error) {
 	return state.Worker{}, nil
 }
+func (m *mockStateManager) HeartbeatWorkerInstance(ctx context.Context, instance state.WorkerInstance) error {
+	return nil
+}
+func (m *mockStateManager) ListWorkerInstances(ctx context.Context, ttl time.Duration) ([]state.WorkerInstance, error) {
+	return nil, nil
+}
+func (m *mockStateManager) AcquireWorkerLease(ctx context.Context, name string, holder string, ttl time.Duration) (state.WorkerLease, error) {
+	return state.WorkerLease{}, nil
+}
+func (m *mockStateManager) GetWorkerLease(ctx context.Context, name string) (state.WorkerLease, error) {
+	return state.WorkerLease{}, nil
+}
+func (m *mockStateManager) ReleaseWorkerLease(ctx context.Context, name string, holder string) error {
+	return nil
+}
+func (m *mockStateManager) DeleteWorkerInstance(ctx context.Context, instanceID string) error {
+	return nil
+}
 func (m *mockStateManager) GetExecutableByTypeAndID(ctx context.Context, executableType state.ExecutableType, executableID string) (state.Executable, error) {
 	return state.Definition{}, nil
 }
@@ -213,12 +236,51 @@ func (m *mockStateManager) ListTemplatesLatestOnly(ctx context.Context, limit in
 	return state.TemplateList{}, nil
 }
 func (m *mockStateManager) CreateTemplate(ctx context.Context, t state.Template) error { return nil }
+func (m *mockStateManager) UpdateTemplateDeprecation(ctx context.Context, templateID string, deprecation *state.TemplateDeprecation) (state.Template, error) {
+	return state.Template{}, nil
+}
+func (m *mockStateManager) ListTemplateChannels(ctx context.Context, templateName string) (state.TemplateChannelList, error) {
+	return state.TemplateChannelList{}, nil
+}
+func (m *mockStateManager) GetTemplateChannel(ctx context.Context, templateName string, channel string) (bool, state.TemplateChannel, error) {
+	return false, state.TemplateChannel{}, nil
+}
+func (m *mockStateManager) SetTemplateChannel(ctx context.Context, c state.TemplateChannel) (state.TemplateChannel, error) {
+	return c, nil
+}
+func (m *mockStateManager) DeleteTemplateChannel(ctx context.Context, templateName string, channel string) error {
+	return nil
+}
+func (m *mockStateManager) GetTemplateUsage(ctx context.Context, templateName string, since time.Time) ([]state.TemplateVersionUsage, error) {
+	return nil, nil
+}
+func (m *mockStateManager) ApplyBundle(ctx context.Context, changes state.BundleChanges) error {
+	return nil
+}
+func (m *mockStateManager) ListSettings(ctx context.Context) ([]state.Setting, error) {
+	return nil, nil
+}
+func (m *mockStateManager) SetSetting(ctx context.Context, s state.Setting, reason string) (state.Setting, error) {
+	return s, nil
+}
+func (m *mockStateManager) DeleteSetting(ctx context.Context, key string, user string, reason string) error {
+	return nil
+}
+func (m *mockStateManager) ListSettingChanges(ctx context.Context, key string, limit int, offset int) (state.SettingChangeList, error) {
+	return state.SettingChangeList{}, nil
+}
 func (m *mockStateManager) ListFailingNodes(ctx context.Context) (state.NodeList, error) {
 	return state.NodeList{}, nil
 }
 func (m *mockStateManager) GetPodReAttemptRate(ctx context.Context) (float32, error) {
 	return 0, nil
 }
+func (m *mockStateManager) CountActiveRuns(ctx context.Context) ([]state.RunStatusCount, error) {
+	return nil, nil
+}
+func (m *mockStateManager) GetRunLatencyStats(ctx context.Context, q state.RunLatencyQuery) ([]state.RunLatencyStats, error) {
+	return nil, nil
+}
 func (m *mockStateManager) GetNodeLifecycle(ctx context.Context, executableID string, commandHash string) (string, error) {
 	return "", nil
 }
@@ -249,6 +311,18 @@ func (m *mockStateManager) GetClusterByID(ctx context.Context, clusterID string)
 func (m *mockStateManager) GetRunStatus(ctx context.Context, runID string) (state.RunStatus, error) {
 	return state.RunStatus{}, nil
 }
+func (m *mockStateManager) CreateDebugSession(ctx context.Context, s state.DebugSession) error {
+	return nil
+}
+func (m *mockStateManager) GetDebugSession(ctx context.Context, sessionID string) (state.DebugSession, error) {
+	return state.DebugSession{}, nil
+}
+func (m *mockStateManager) ListDebugSessions(ctx context.Context, runID string) (state.DebugSessionList, error) {
+	return state.DebugSessionList{}, nil
+}
+func (m *mockStateManager) UpdateDebugSession(ctx context.Context, sessionID string, updates state.DebugSession) (state.DebugSession, error) {
+	return state.DebugSession{}, nil
+}
 
 // mockExecutable implements state.Executable for testing
 type mockExecutable struct {
@@ -651,3 +725,72 @@ func TestEmitARAMetrics_NilLogger(t *testing.T) {
 func int64Ptr(i int64) *int64 {
 	return &i
 }
+
+func TestConstructAffinity_SchedulingPolicy(t *testing.T) {
+	adapter := &eksAdapter{}
+	executable := &mockExecutable{resources: &state.ExecutableResources{}}
+	run := state.Run{
+		RunID:  "test-run",
+		Cpu:    int64Ptr(16000),
+		Memory: int64Ptr(1000),
+		Labels: map[string]string{"team": "search"},
+	}
+	policy := state.SchedulingPolicy{
+		ArchKey: "example.com/arch",
+		TeamKey: "example.com/team",
+		PoolKey: "example.com/pool",
+		RequiredTerms: []corev1.NodeSelectorRequirement{
+			{Key: "example.com/zone-type", Operator: corev1.NodeSelectorOpIn, Values: []string{"private"}},
+		},
+		Tolerations: []corev1.Toleration{{Key: "dedicated", Operator: "Exists", Effect: "NoSchedule"}},
+	}.WithDefaults()
+	capabilities := state.Capabilities{state.CapPoolSizing}
+
+	affinity := adapter.constructAffinity(context.Background(), executable, run, &mockStateManager{}, capabilities, policy)
+	required := map[string][]string{}
+	for _, r := range affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0].MatchExpressions {
+		required[r.Key] = r.Values
+	}
+	expected := map[string]string{
+		"karpenter.sh/capacity-type": "spot",
+		"example.com/arch":           "amd64",
+		"example.com/team":           "search",
+		"example.com/pool":           "l",
+		"example.com/zone-type":      "private",
+	}
+	for key, value := range expected {
+		if len(required[key]) == 0 || required[key][0] != value {
+			t.Errorf("expected required %s=%s, got %v", key, value, required[key])
+		}
+	}
+
+	tolerations := adapter.constructTolerations(executable, run, capabilities, policy)
+	keys := map[string]string{}
+	for _, tol := range tolerations {
+		keys[tol.Key] = tol.Value
+	}
+	if keys["example.com/pool"] != "l" {
+		t.Errorf("expected pool toleration for size l, got %v", tolerations)
+	}
+	if _, ok := keys["dedicated"]; !ok {
+		t.Errorf("expected policy toleration, got %v", tolerations)
+	}
+}
+
+func TestConstructVolumeMounts_RunVolumes(t *testing.T) {
+	adapter := &eksAdapter{}
+	run := state.Run{
+		RunID: "eks-run",
+		Gpu:   int64Ptr(1),
+		Volumes: &state.Volumes{
+			{Name: "data", Type: state.VolumeTypePVC, ClaimName: "claim", MountPath: "/data", ReadOnly: true},
+		},
+	}
+	mounts, volumes := adapter.constructVolumeMounts(context.Background(), &mockExecutable{resources: &state.ExecutableResources{}}, run, &mockStateManager{}, false)
+	if len(volumes) != 2 || volumes[1].PersistentVolumeClaim == nil || volumes[1].PersistentVolumeClaim.ClaimName != "claim" {
+		t.Fatalf("expected the run's claim next to the shared memory volume, got %+v", volumes)
+	}
+	if len(mounts) != 2 || mounts[1].MountPath != "/data" || !mounts[1].ReadOnly {
+		t.Errorf("expected a read-only mount of the claim, got %+v", mounts)
+	}
+}
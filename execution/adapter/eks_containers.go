@@ -0,0 +1,125 @@
+package adapter
+
+import (
+	"fmt"
+
+	"github.com/stitchfix/flotilla-os/state"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Resources of extra containers which don't specify their own, in millicores
+// and MiB.
+const (
+	defaultExtraContainerCpu    = int64(100)
+	defaultExtraContainerMemory = int64(128)
+)
+
+// constructExtraContainers returns the init containers of the run's pod, the
+// shared volumes and the mounts of those volumes in the main container.
+// Sidecars are rendered as native sidecars, init containers restarting
+// always, so they start before the executable's init containers and are
+// stopped once the main container exits instead of keeping the pod alive.
+func (a *eksAdapter) constructExtraContainers(executable state.Executable, run state.Run) ([]corev1.Container, []corev1.Volume, []corev1.VolumeMount) {
+	resources := executable.GetExecutableResources()
+	var volumes []corev1.Volume
+	var mounts []corev1.VolumeMount
+	if resources.SharedVolumes != nil {
+		for _, v := range *resources.SharedVolumes {
+			emptyDir := corev1.EmptyDirVolumeSource{}
+			if v.SizeLimit != nil {
+				sizeLimit := resource.MustParse(fmt.Sprintf("%dMi", *v.SizeLimit))
+				emptyDir.SizeLimit = &sizeLimit
+			}
+			volumes = append(volumes, corev1.Volume{
+				Name:         v.Name,
+				VolumeSource: corev1.VolumeSource{EmptyDir: &emptyDir},
+			})
+			if len(v.MountPath) > 0 {
+				mounts = append(mounts, corev1.VolumeMount{Name: v.Name, MountPath: v.MountPath})
+			}
+		}
+	}
+
+	var containers []corev1.Container
+	always := corev1.ContainerRestartPolicyAlways
+	if resources.Sidecars != nil {
+		for _, c := range *resources.Sidecars {
+			container := a.adaptExtraContainer(executable, run, c)
+			container.RestartPolicy = &always
+			containers = append(containers, container)
+		}
+	}
+	if resources.InitContainers != nil {
+		for _, c := range *resources.InitContainers {
+			containers = append(containers, a.adaptExtraContainer(executable, run, c))
+		}
+	}
+	return containers, volumes, mounts
+}
+
+// adaptExtraContainer returns the container of an init container or sidecar.
+// It sees the same environment as the main container, with its own variables
+// on top.
+func (a *eksAdapter) adaptExtraContainer(executable state.Executable, run state.Run, c state.Container) corev1.Container {
+	env := a.envOverrides(executable, run)
+	if c.Env != nil {
+		for _, ev := range *c.Env {
+			name := a.sanitizeEnvVar(ev.Name)
+			replaced := false
+			for i := range env {
+				if env[i].Name == name {
+					env[i].Value = ev.Value
+					replaced = true
+				}
+			}
+			if !replaced {
+				env = append(env, corev1.EnvVar{Name: name, Value: ev.Value})
+			}
+		}
+	}
+
+	cpu, mem := defaultExtraContainerCpu, defaultExtraContainerMemory
+	if c.Cpu != nil {
+		cpu = *c.Cpu
+	}
+	if c.Memory != nil {
+		mem = *c.Memory
+	}
+	quantities := corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse(fmt.Sprintf("%dm", cpu)),
+		corev1.ResourceMemory: resource.MustParse(fmt.Sprintf("%dMi", mem)),
+	}
+
+	var mounts []corev1.VolumeMount
+	for _, m := range c.VolumeMounts {
+		mounts = append(mounts, corev1.VolumeMount{Name: m.Name, MountPath: m.MountPath, ReadOnly: m.ReadOnly})
+	}
+
+	return corev1.Container{
+		Name:            c.Name,
+		Image:           c.Image,
+		Command:         c.Command,
+		Args:            c.Args,
+		Env:             env,
+		Resources:       corev1.ResourceRequirements{Limits: quantities, Requests: quantities.DeepCopy()},
+		VolumeMounts:    mounts,
+		ImagePullPolicy: corev1.PullAlways,
+	}
+}
+
+// mainContainerStatus returns the status of the run's own container, which
+// alone decides the outcome of the run; init containers and sidecars are
+// ignored.
+func mainContainerStatus(pod *corev1.Pod, run state.Run) *corev1.ContainerStatus {
+	statuses := pod.Status.ContainerStatuses
+	for i := range statuses {
+		if statuses[i].Name == run.RunID {
+			return &statuses[i]
+		}
+	}
+	if len(statuses) > 0 {
+		return &statuses[len(statuses)-1]
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package adapter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stitchfix/flotilla-os/state"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestAdaptFlotillaDefinitionAndRunToJob_ExtraContainers(t *testing.T) {
+	adapter, _ := NewEKSAdapter(&mockConfig{values: map[string]string{}}, nil)
+	executable := &mockExecutable{resources: &state.ExecutableResources{
+		Env: &state.EnvList{{Name: "STAGE", Value: "prod"}},
+		InitContainers: &state.Containers{{
+			Name:         "fetch-inputs",
+			Image:        "aws-cli:latest",
+			Command:      []string{"aws", "s3", "sync", "s3://bucket/inputs", "/inputs"},
+			VolumeMounts: []state.SharedVolumeMount{{Name: "inputs", MountPath: "/inputs"}},
+		}},
+		Sidecars: &state.Containers{{
+			Name:   "metrics-agent",
+			Image:  "agent:1",
+			Env:    &state.EnvList{{Name: "STAGE", Value: "agent"}},
+			Cpu:    int64Ptr(250),
+			Memory: int64Ptr(256),
+		}},
+		SharedVolumes: &state.SharedVolumes{{Name: "inputs", MountPath: "/mnt/inputs", SizeLimit: int64Ptr(1024)}},
+	}}
+	run := state.Run{
+		RunID:          "eks-run",
+		Cpu:            int64Ptr(1000),
+		Memory:         int64Ptr(1000),
+		ServiceAccount: aws.String("default"),
+	}
+
+	job, err := adapter.AdaptFlotillaDefinitionAndRunToJob(context.Background(), executable, run, "", &mockStateManager{}, false, nil, state.SchedulingPolicy{}.WithDefaults())
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := job.Spec.Template.Spec
+	if len(spec.Containers) != 1 || spec.Containers[0].Name != "eks-run" {
+		t.Fatalf("expected the run's container alone in containers, got %d", len(spec.Containers))
+	}
+	if len(spec.InitContainers) != 2 {
+		t.Fatalf("expected a sidecar and an init container, got %d", len(spec.InitContainers))
+	}
+	sidecar, init := spec.InitContainers[0], spec.InitContainers[1]
+	if sidecar.Name != "metrics-agent" || sidecar.RestartPolicy == nil || *sidecar.RestartPolicy != corev1.ContainerRestartPolicyAlways {
+		t.Errorf("expected the sidecar first, restarting always, got %+v", sidecar)
+	}
+	if init.Name != "fetch-inputs" || init.RestartPolicy != nil {
+		t.Errorf("expected a plain init container, got %+v", init)
+	}
+	if sidecar.Resources.Limits.Cpu().MilliValue() != 250 || sidecar.Resources.Requests.Memory().Value() != 256*1024*1024 {
+		t.Errorf("unexpected sidecar resources %+v", sidecar.Resources)
+	}
+	if init.Resources.Limits.Cpu().MilliValue() != defaultExtraContainerCpu {
+		t.Errorf("expected default resources for the init container, got %+v", init.Resources)
+	}
+	for _, e := range sidecar.Env {
+		if e.Name == "STAGE" && e.Value != "agent" {
+			t.Errorf("expected the sidecar's own env to take precedence, got %s", e.Value)
+		}
+	}
+	if len(init.VolumeMounts) != 1 || init.VolumeMounts[0].MountPath != "/inputs" {
+		t.Errorf("unexpected init container mounts %+v", init.VolumeMounts)
+	}
+
+	mounted := false
+	for _, m := range spec.Containers[0].VolumeMounts {
+		mounted = mounted || (m.Name == "inputs" && m.MountPath == "/mnt/inputs")
+	}
+	if !mounted {
+		t.Errorf("expected the shared volume mounted in the main container")
+	}
+	if len(spec.Volumes) != 1 || spec.Volumes[0].EmptyDir == nil || spec.Volumes[0].EmptyDir.SizeLimit.String() != "1Gi" {
+		t.Errorf("unexpected volumes %+v", spec.Volumes)
+	}
+}
+
+func TestAdaptJobToFlotillaRun_MainContainerStatus(t *testing.T) {
+	adapter, _ := NewEKSAdapter(&mockConfig{values: map[string]string{}}, nil)
+	job := &batchv1.Job{Status: batchv1.JobStatus{Failed: 1}}
+	pod := &corev1.Pod{Status: corev1.PodStatus{
+		ContainerStatuses: []corev1.ContainerStatus{
+			{Name: "eks-run", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 3, Reason: "Error"}}},
+			{Name: "proxy", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 137, Reason: "Killed"}}},
+		},
+	}}
+
+	run, err := adapter.AdaptJobToFlotillaRun(job, state.Run{RunID: "eks-run"}, pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *run.ExitCode != 3 || *run.ExitReason != "Error" {
+		t.Errorf("expected the main container's exit, got %d %s", *run.ExitCode, *run.ExitReason)
+	}
+}
+
+func TestAdaptJobToFlotillaRun_PendingPod(t *testing.T) {
+	adapter, _ := NewEKSAdapter(&mockConfig{values: map[string]string{}}, nil)
+	job := &batchv1.Job{Status: batchv1.JobStatus{Active: 1}}
+
+	run, _ := adapter.AdaptJobToFlotillaRun(job, state.Run{RunID: "eks-run"}, &corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodPending}})
+	if run.Status != state.StatusPending {
+		t.Errorf("expected the run of a pending pod to be pending, got %s", run.Status)
+	}
+	run, _ = adapter.AdaptJobToFlotillaRun(job, state.Run{RunID: "eks-run"}, &corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodRunning}})
+	if run.Status != state.StatusRunning {
+		t.Errorf("expected the run of a running pod to be running, got %s", run.Status)
+	}
+}
@@ -0,0 +1,58 @@
+package adapter
+
+import (
+	"fmt"
+
+	"github.com/stitchfix/flotilla-os/state"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// outputVolumeName is the volume of the output directory of runs.
+const outputVolumeName = "flotilla-output"
+
+// constructOutputUploader returns the sidecar uploading the run's output
+// directory to its output URI, along with the directory's volume and mount.
+// The sidecar syncs the directory once the kubelet stops it, which happens
+// after the main container exits. Nothing is returned unless an uploader
+// image is configured and the run has an output URI.
+func (a *eksAdapter) constructOutputUploader(executable state.Executable, run state.Run) (*corev1.Container, corev1.Volume, corev1.VolumeMount) {
+	mount := corev1.VolumeMount{Name: outputVolumeName, MountPath: a.outputDir}
+	volume := corev1.Volume{
+		Name:         outputVolumeName,
+		VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+	}
+	if len(a.outputUploaderImage) == 0 || !hasRunEnv(run, state.OutputURIVar) {
+		return nil, volume, mount
+	}
+
+	always := corev1.ContainerRestartPolicyAlways
+	quantities := corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse(fmt.Sprintf("%dm", defaultExtraContainerCpu)),
+		corev1.ResourceMemory: resource.MustParse(fmt.Sprintf("%dMi", defaultExtraContainerMemory)),
+	}
+	sync := fmt.Sprintf(`aws s3 sync %s "$%s"`, a.outputDir, state.OutputURIVar)
+	return &corev1.Container{
+		Name:  "flotilla-output-uploader",
+		Image: a.outputUploaderImage,
+		Command: []string{"/bin/sh", "-c",
+			fmt.Sprintf("trap '%s; exit $?' TERM; while true; do sleep 1; done", sync)},
+		Env:             a.envOverrides(executable, run),
+		Resources:       corev1.ResourceRequirements{Limits: quantities, Requests: quantities.DeepCopy()},
+		VolumeMounts:    []corev1.VolumeMount{mount},
+		RestartPolicy:   &always,
+		ImagePullPolicy: corev1.PullIfNotPresent,
+	}, volume, mount
+}
+
+func hasRunEnv(run state.Run, name string) bool {
+	if run.Env == nil {
+		return false
+	}
+	for _, e := range *run.Env {
+		if e.Name == name && len(e.Value) > 0 {
+			return true
+		}
+	}
+	return false
+}
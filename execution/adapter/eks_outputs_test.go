@@ -0,0 +1,61 @@
+package adapter
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stitchfix/flotilla-os/state"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestAdaptFlotillaDefinitionAndRunToJob_OutputUploader(t *testing.T) {
+	adapter, _ := NewEKSAdapter(&mockConfig{values: map[string]string{"eks_output_uploader_image": "aws-cli:2"}}, nil)
+	executable := &mockExecutable{resources: &state.ExecutableResources{}}
+	run := state.Run{
+		RunID:          "eks-run",
+		Cpu:            int64Ptr(1000),
+		Memory:         int64Ptr(1000),
+		ServiceAccount: aws.String("default"),
+		Env:            &state.EnvList{{Name: state.OutputURIVar, Value: "s3://bucket/artifacts/eks-run/"}},
+	}
+
+	job, err := adapter.AdaptFlotillaDefinitionAndRunToJob(context.Background(), executable, run, "", &mockStateManager{}, false, nil, state.SchedulingPolicy{}.WithDefaults())
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := job.Spec.Template.Spec
+	if len(spec.InitContainers) != 1 {
+		t.Fatalf("expected the uploader sidecar, got %d init containers", len(spec.InitContainers))
+	}
+	uploader := spec.InitContainers[0]
+	if uploader.RestartPolicy == nil || *uploader.RestartPolicy != corev1.ContainerRestartPolicyAlways {
+		t.Errorf("expected the uploader to be a sidecar")
+	}
+	if !strings.Contains(uploader.Command[2], "aws s3 sync /flotilla/output") {
+		t.Errorf("unexpected uploader command %v", uploader.Command)
+	}
+
+	main := spec.Containers[0]
+	mounted := false
+	for _, m := range main.VolumeMounts {
+		mounted = mounted || (m.Name == outputVolumeName && m.MountPath == "/flotilla/output")
+	}
+	if !mounted {
+		t.Errorf("expected the output directory mounted in the main container")
+	}
+	hasDir := false
+	for _, e := range main.Env {
+		hasDir = hasDir || (e.Name == state.OutputDirVar && e.Value == "/flotilla/output")
+	}
+	if !hasDir {
+		t.Errorf("expected %s in the main container's env", state.OutputDirVar)
+	}
+
+	run.Env = nil
+	job, _ = adapter.AdaptFlotillaDefinitionAndRunToJob(context.Background(), executable, run, "", &mockStateManager{}, false, nil, state.SchedulingPolicy{}.WithDefaults())
+	if len(job.Spec.Template.Spec.InitContainers) != 0 {
+		t.Errorf("expected no uploader for a run without an output URI")
+	}
+}
@@ -0,0 +1,120 @@
+package adapter
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/stitchfix/flotilla-os/state"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ingressHost is what ingress host templates are executed with.
+type ingressHost struct {
+	RunID string
+	Port  int
+}
+
+// AdaptFlotillaRunToPortsService returns the service exposing the ports the
+// executable declares, nil when it declares none. Replicated runs are
+// reached through their rank 0 pod.
+func (a *eksAdapter) AdaptFlotillaRunToPortsService(executable state.Executable, run state.Run) *corev1.Service {
+	ports := executable.GetExecutableResources().Ports
+	if ports == nil || len(*ports) == 0 {
+		return nil
+	}
+	selector := map[string]string{batchv1.JobNameLabel: run.RunID}
+	if run.IsReplicated() {
+		// Pods of indexed jobs are also labelled with their index.
+		selector[batchv1.JobCompletionIndexAnnotation] = "0"
+	}
+	service := &corev1.Service{
+		ObjectMeta: v1.ObjectMeta{
+			Name:   state.PortsServiceName(run.RunID),
+			Labels: map[string]string{"flotilla-run-id": state.SanitizeLabel(run.RunID)},
+		},
+		Spec: corev1.ServiceSpec{Selector: selector},
+	}
+	for _, port := range *ports {
+		service.Spec.Ports = append(service.Spec.Ports, corev1.ServicePort{
+			Name: fmt.Sprintf("port-%d", port),
+			Port: int32(port),
+		})
+	}
+	return service
+}
+
+// AdaptFlotillaRunToIngress returns the ingress routing a host per port of
+// the service to it, nil unless ingress hosts are configured.
+func (a *eksAdapter) AdaptFlotillaRunToIngress(run state.Run, service *corev1.Service) (*networkingv1.Ingress, error) {
+	if a.ingressHostTemplate == nil || service == nil {
+		return nil, nil
+	}
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: v1.ObjectMeta{
+			Name:        service.Name,
+			Labels:      service.Labels,
+			Annotations: a.ingressAnnotations,
+		},
+	}
+	if len(a.ingressClassName) > 0 {
+		ingress.Spec.IngressClassName = &a.ingressClassName
+	}
+	pathType := networkingv1.PathTypePrefix
+	var hosts []string
+	for _, port := range service.Spec.Ports {
+		var host bytes.Buffer
+		if err := a.ingressHostTemplate.Execute(&host, ingressHost{RunID: run.RunID, Port: int(port.Port)}); err != nil {
+			return nil, fmt.Errorf("unable to render the ingress host of run [%s]: %w", run.RunID, err)
+		}
+		hosts = append(hosts, host.String())
+		ingress.Spec.Rules = append(ingress.Spec.Rules, networkingv1.IngressRule{
+			Host: host.String(),
+			IngressRuleValue: networkingv1.IngressRuleValue{
+				HTTP: &networkingv1.HTTPIngressRuleValue{
+					Paths: []networkingv1.HTTPIngressPath{{
+						Path:     "/",
+						PathType: &pathType,
+						Backend: networkingv1.IngressBackend{
+							Service: &networkingv1.IngressServiceBackend{
+								Name: service.Name,
+								Port: networkingv1.ServiceBackendPort{Number: port.Port},
+							},
+						},
+					}},
+				},
+			},
+		})
+	}
+	if len(a.ingressTLSSecretName) > 0 {
+		ingress.Spec.TLS = []networkingv1.IngressTLS{{Hosts: hosts, SecretName: a.ingressTLSSecretName}}
+	}
+	return ingress, nil
+}
+
+// AdaptExposureToEndpoints returns the endpoints of the ports exposed by the
+// service, and by the ingress if any.
+func (a *eksAdapter) AdaptExposureToEndpoints(run state.Run, namespace string, service *corev1.Service, ingress *networkingv1.Ingress) state.RunEndpoints {
+	if service == nil {
+		return nil
+	}
+	scheme := "http"
+	if ingress != nil && len(ingress.Spec.TLS) > 0 {
+		scheme = "https"
+	}
+	endpoints := make(state.RunEndpoints, 0, len(service.Spec.Ports))
+	for i, port := range service.Spec.Ports {
+		endpoint := state.RunEndpoint{
+			Port:     int(port.Port),
+			Address:  fmt.Sprintf("%s.%s.svc:%d", service.Name, namespace, port.Port),
+			ProxyURI: state.RunProxyURI(run.RunID, int(port.Port)),
+		}
+		if ingress != nil && i < len(ingress.Spec.Rules) {
+			endpoint.URL = fmt.Sprintf("%s://%s/", scheme, ingress.Spec.Rules[i].Host)
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	return endpoints
+}
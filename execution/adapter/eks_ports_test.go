@@ -0,0 +1,62 @@
+package adapter
+
+import (
+	"testing"
+
+	"github.com/stitchfix/flotilla-os/state"
+	batchv1 "k8s.io/api/batch/v1"
+)
+
+func TestAdaptFlotillaRunToPortsService(t *testing.T) {
+	adapter, err := NewEKSAdapter(&mockConfig{values: map[string]string{
+		"eks_ingress_host_template":   "{{.RunID}}-{{.Port}}.runs.example.com",
+		"eks_ingress_class_name":      "alb",
+		"eks_ingress_tls_secret_name": "runs-tls",
+	}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := state.Run{RunID: "eks-run"}
+
+	if adapter.AdaptFlotillaRunToPortsService(&mockExecutable{resources: &state.ExecutableResources{}}, run) != nil {
+		t.Errorf("expected no service without ports")
+	}
+
+	executable := &mockExecutable{resources: &state.ExecutableResources{Ports: &state.PortsList{4040, 8888}}}
+	service := adapter.AdaptFlotillaRunToPortsService(executable, run)
+	if service == nil || service.Name != "eks-run-ports" || len(service.Spec.Ports) != 2 {
+		t.Fatalf("expected a service exposing both ports, got %+v", service)
+	}
+	if service.Spec.Selector[batchv1.JobNameLabel] != "eks-run" {
+		t.Errorf("expected the service to select the run's pods, got %v", service.Spec.Selector)
+	}
+
+	ingress, err := adapter.AdaptFlotillaRunToIngress(run, service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ingress == nil || len(ingress.Spec.Rules) != 2 || ingress.Spec.Rules[1].Host != "eks-run-8888.runs.example.com" {
+		t.Fatalf("expected a host per port, got %+v", ingress)
+	}
+	if *ingress.Spec.IngressClassName != "alb" || ingress.Spec.TLS[0].SecretName != "runs-tls" {
+		t.Errorf("unexpected ingress spec %+v", ingress.Spec)
+	}
+
+	endpoints := adapter.AdaptExposureToEndpoints(run, "flotilla", service, ingress)
+	endpoint, ok := endpoints.Find(8888)
+	if !ok {
+		t.Fatalf("expected an endpoint for port 8888")
+	}
+	if endpoint.Address != "eks-run-ports.flotilla.svc:8888" ||
+		endpoint.URL != "https://eks-run-8888.runs.example.com/" ||
+		endpoint.ProxyURI != "/api/v6/eks-run/proxy/8888/" {
+		t.Errorf("unexpected endpoint %+v", endpoint)
+	}
+
+	replicas := int64(4)
+	run.Replicas = &replicas
+	service = adapter.AdaptFlotillaRunToPortsService(executable, run)
+	if service.Spec.Selector[batchv1.JobCompletionIndexAnnotation] != "0" {
+		t.Errorf("expected replicated runs to be reached through their rank 0 pod")
+	}
+}
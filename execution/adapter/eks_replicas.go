@@ -0,0 +1,164 @@
+package adapter
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/stitchfix/flotilla-os/state"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// replicaZoneKey is the topology the pods of a replicated run prefer to share.
+const replicaZoneKey = "topology.kubernetes.io/zone"
+
+// adaptReplicatedJob turns the single pod job of a run into an Indexed Job
+// running one pod per replica. Pods are addressable as
+// <run id>-<index>.<run id> through the headless service of the run, which
+// all replicas rendezvous on through the rank 0 pod.
+func (a *eksAdapter) adaptReplicatedJob(job *batchv1.Job, run state.Run, policy state.SchedulingPolicy) {
+	replicas := int32(run.ReplicaCount())
+	indexed := batchv1.IndexedCompletion
+	job.Spec.CompletionMode = &indexed
+	job.Spec.Completions = &replicas
+	// All replicas have to be up at once for the rendezvous to complete.
+	job.Spec.Parallelism = &replicas
+
+	podSpec := &job.Spec.Template.Spec
+	podSpec.Subdomain = run.RunID
+	for i := range podSpec.Containers {
+		podSpec.Containers[i].Env = append(podSpec.Containers[i].Env, a.replicaEnv(run)...)
+	}
+
+	if podSpec.Affinity == nil {
+		podSpec.Affinity = &corev1.Affinity{}
+	}
+	podSpec.Affinity.PodAffinity = &corev1.PodAffinity{
+		PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{{
+			Weight: 100,
+			PodAffinityTerm: corev1.PodAffinityTerm{
+				LabelSelector: &v1.LabelSelector{
+					MatchLabels: map[string]string{"flotilla-run-id": state.SanitizeLabel(run.RunID)},
+				},
+				TopologyKey: replicaZoneKey,
+			},
+		}},
+	}
+
+	if len(policy.GangLabelKey) > 0 {
+		job.Spec.Template.Labels[policy.GangLabelKey] = state.SanitizeLabel(run.RunID)
+	}
+}
+
+// replicaEnv returns the rendezvous variables of the pods of a replicated run,
+// the rank being the pod's completion index.
+func (a *eksAdapter) replicaEnv(run state.Run) []corev1.EnvVar {
+	return []corev1.EnvVar{
+		{
+			Name: state.ReplicaRankVar,
+			ValueFrom: &corev1.EnvVarSource{
+				FieldRef: &corev1.ObjectFieldSelector{
+					FieldPath: fmt.Sprintf("metadata.annotations['%s']", batchv1.JobCompletionIndexAnnotation),
+				},
+			},
+		},
+		{Name: state.ReplicaWorldSizeVar, Value: strconv.FormatInt(run.ReplicaCount(), 10)},
+		{Name: state.ReplicaMasterAddrVar, Value: fmt.Sprintf("%s-0.%s", run.RunID, run.RunID)},
+		{Name: state.ReplicaMasterPortVar, Value: strconv.Itoa(int(a.replicaMasterPort))},
+	}
+}
+
+// AdaptFlotillaRunToService returns the headless service giving the pods of a
+// replicated run stable hostnames, nil for single pod runs.
+func (a *eksAdapter) AdaptFlotillaRunToService(run state.Run) *corev1.Service {
+	if !run.IsReplicated() {
+		return nil
+	}
+	return &corev1.Service{
+		ObjectMeta: v1.ObjectMeta{
+			Name:   run.RunID,
+			Labels: map[string]string{"flotilla-run-id": state.SanitizeLabel(run.RunID)},
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP:                corev1.ClusterIPNone,
+			Selector:                 map[string]string{batchv1.JobNameLabel: run.RunID},
+			PublishNotReadyAddresses: true,
+			Ports: []corev1.ServicePort{{
+				Name: "rendezvous",
+				Port: a.replicaMasterPort,
+			}},
+		},
+	}
+}
+
+// AdaptPodsToReplicas returns the status of the pods of a replicated run,
+// keeping the most recent pod of each completion index.
+func (a *eksAdapter) AdaptPodsToReplicas(pods []corev1.Pod) state.ReplicaPods {
+	latest := map[int64]corev1.Pod{}
+	for _, pod := range pods {
+		index, err := strconv.ParseInt(pod.Annotations[batchv1.JobCompletionIndexAnnotation], 10, 64)
+		if err != nil {
+			continue
+		}
+		if prior, ok := latest[index]; !ok || prior.CreationTimestamp.Before(&pod.CreationTimestamp) {
+			latest[index] = pod
+		}
+	}
+
+	replicas := make(state.ReplicaPods, 0, len(latest))
+	for index, pod := range latest {
+		replica := state.ReplicaPod{
+			Index:           index,
+			PodName:         pod.Name,
+			Phase:           string(pod.Status.Phase),
+			InstanceDNSName: pod.Spec.NodeName,
+		}
+		for _, cs := range pod.Status.ContainerStatuses {
+			if cs.State.Terminated != nil {
+				exitCode := int64(cs.State.Terminated.ExitCode)
+				reason := cs.State.Terminated.Reason
+				replica.ExitCode = &exitCode
+				replica.ExitReason = &reason
+			}
+		}
+		replicas = append(replicas, replica)
+	}
+	sort.Slice(replicas, func(i, j int) bool { return replicas[i].Index < replicas[j].Index })
+	return replicas
+}
+
+// adaptIndexedJobToFlotillaRun maps the status of a replicated run's job: it
+// succeeds once every index has, and fails as soon as any pod fails.
+func (a *eksAdapter) adaptIndexedJobToFlotillaRun(job *batchv1.Job, run state.Run) state.Run {
+	updated := run
+	replicas := int32(run.ReplicaCount())
+	if job.Status.Failed > 0 {
+		exitCode := int64(1)
+		updated.Status = state.StatusStopped
+		if run.ReplicaPods != nil {
+			for _, replica := range *run.ReplicaPods {
+				if replica.ExitCode != nil && *replica.ExitCode != 0 {
+					exitCode = *replica.ExitCode
+					reason := fmt.Sprintf("Replica %d failed", replica.Index)
+					if replica.ExitReason != nil {
+						reason = fmt.Sprintf("Replica %d failed: %s", replica.Index, *replica.ExitReason)
+					}
+					updated.ExitReason = &reason
+					break
+				}
+			}
+		}
+		updated.ExitCode = &exitCode
+	} else if job.Status.Succeeded >= replicas {
+		exitCode := int64(0)
+		reason := fmt.Sprintf("All %d replicas exited successfully", replicas)
+		updated.Status = state.StatusStopped
+		updated.ExitCode = &exitCode
+		updated.ExitReason = &reason
+	} else if job.Status.Active > 0 && job.Status.CompletionTime == nil {
+		updated.Status = state.StatusRunning
+	}
+	return updated
+}
@@ -0,0 +1,103 @@
+package adapter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stitchfix/flotilla-os/state"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAdaptFlotillaDefinitionAndRunToJob_Replicas(t *testing.T) {
+	adapter, _ := NewEKSAdapter(&mockConfig{values: map[string]string{}}, nil)
+	executable := &mockExecutable{resources: &state.ExecutableResources{}}
+	run := state.Run{
+		RunID:          "eks-run",
+		Cpu:            int64Ptr(1000),
+		Memory:         int64Ptr(1000),
+		ServiceAccount: aws.String("default"),
+		Replicas:       int64Ptr(4),
+	}
+	policy := state.SchedulingPolicy{GangLabelKey: "example.com/pod-group"}.WithDefaults()
+
+	job, err := adapter.AdaptFlotillaDefinitionAndRunToJob(context.Background(), executable, run, "", &mockStateManager{}, false, nil, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Spec.CompletionMode == nil || *job.Spec.CompletionMode != batchv1.IndexedCompletion {
+		t.Errorf("expected an indexed job")
+	}
+	if *job.Spec.Completions != 4 || *job.Spec.Parallelism != 4 {
+		t.Errorf("expected 4 completions and parallelism, got %d and %d", *job.Spec.Completions, *job.Spec.Parallelism)
+	}
+	if job.Spec.Template.Spec.Subdomain != "eks-run" {
+		t.Errorf("expected pods in the run's subdomain, got %q", job.Spec.Template.Spec.Subdomain)
+	}
+	if job.Spec.Template.Labels["example.com/pod-group"] != "eks-run" {
+		t.Errorf("expected pods labelled with their gang")
+	}
+	env := map[string]corev1.EnvVar{}
+	for _, e := range job.Spec.Template.Spec.Containers[0].Env {
+		env[e.Name] = e
+	}
+	if env["WORLD_SIZE"].Value != "4" || env["MASTER_ADDR"].Value != "eks-run-0.eks-run" || env["MASTER_PORT"].Value != "29500" {
+		t.Errorf("unexpected rendezvous variables %v", env)
+	}
+	if env["RANK"].ValueFrom == nil || env["RANK"].ValueFrom.FieldRef == nil {
+		t.Errorf("expected RANK to come from the completion index")
+	}
+
+	service := adapter.AdaptFlotillaRunToService(run)
+	if service == nil || service.Spec.ClusterIP != corev1.ClusterIPNone || service.Name != "eks-run" {
+		t.Errorf("expected a headless service named after the run, got %+v", service)
+	}
+	run.Replicas = nil
+	if adapter.AdaptFlotillaRunToService(run) != nil {
+		t.Errorf("expected no service for a single pod run")
+	}
+}
+
+func TestAdaptIndexedJobToFlotillaRun(t *testing.T) {
+	adapter := &eksAdapter{}
+	pod := func(name string, index string, exitCode int32, created int64) corev1.Pod {
+		return corev1.Pod{
+			ObjectMeta: v1.ObjectMeta{
+				Name:              name,
+				Annotations:       map[string]string{batchv1.JobCompletionIndexAnnotation: index},
+				CreationTimestamp: v1.Unix(created, 0),
+			},
+			Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+				State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: exitCode, Reason: "Error"}},
+			}}},
+		}
+	}
+	replicas := adapter.AdaptPodsToReplicas([]corev1.Pod{
+		pod("eks-run-1-old", "1", 0, 1),
+		pod("eks-run-1-new", "1", 3, 2),
+		pod("eks-run-0-a", "0", 0, 1),
+	})
+	if len(replicas) != 2 || replicas[0].PodName != "eks-run-0-a" || replicas[1].PodName != "eks-run-1-new" {
+		t.Fatalf("unexpected replicas %+v", replicas)
+	}
+
+	run := state.Run{RunID: "eks-run", Replicas: int64Ptr(2), ReplicaPods: &replicas}
+	updated := adapter.adaptIndexedJobToFlotillaRun(&batchv1.Job{Status: batchv1.JobStatus{Failed: 1, Succeeded: 1}}, run)
+	if updated.Status != state.StatusStopped || *updated.ExitCode != 3 {
+		t.Errorf("expected the run to fail with the failed replica's exit code")
+	}
+	if updated.ExitReason == nil || *updated.ExitReason != "Replica 1 failed: Error" {
+		t.Errorf("unexpected exit reason %v", updated.ExitReason)
+	}
+
+	updated = adapter.adaptIndexedJobToFlotillaRun(&batchv1.Job{Status: batchv1.JobStatus{Active: 1, Succeeded: 1}}, run)
+	if updated.Status != state.StatusRunning {
+		t.Errorf("expected the run to be running until all replicas succeed")
+	}
+	updated = adapter.adaptIndexedJobToFlotillaRun(&batchv1.Job{Status: batchv1.JobStatus{Succeeded: 2}}, run)
+	if updated.Status != state.StatusStopped || *updated.ExitCode != 0 {
+		t.Errorf("expected the run to succeed once all replicas have")
+	}
+}
@@ -136,6 +136,16 @@ func (dcm *DynamicClusterManager) GetKubernetesClient(clusterName string) (kuber
 	return *kClient, nil
 }
 
+// GetRestConfig returns the rest config of the requested cluster, for the
+// streaming requests clientsets don't cover such as pod execs.
+func (dcm *DynamicClusterManager) GetRestConfig(clusterName string) (*rest.Config, error) {
+	kubeconfigPath, err := dcm.getOrCreateKubeconfig(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	return dcm.createRestConfig(kubeconfigPath)
+}
+
 // GetMetricsClient returns a metrics client for the requested cluster
 func (dcm *DynamicClusterManager) GetMetricsClient(clusterName string) (metricsv.Clientset, error) {
 	kubeconfigPath, err := dcm.getOrCreateKubeconfig(clusterName)
@@ -0,0 +1,33 @@
+package engine
+
+import (
+	"context"
+	"io"
+
+	"github.com/stitchfix/flotilla-os/state"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// Debugger is implemented by the engines able to open debug sessions on
+// their runs.
+type Debugger interface {
+	// StartDebugSession launches the twin of the run, or the ephemeral
+	// container of a running run, the session describes.
+	StartDebugSession(ctx context.Context, executable state.Executable, run state.Run, session state.DebugSession, manager state.Manager) (state.DebugSession, error)
+	// StopDebugSession removes the twin of a session.
+	StopDebugSession(ctx context.Context, session state.DebugSession) error
+	// ExecDebugSession runs a command in the session's container until the
+	// command exits or the context is cancelled. The session is returned with
+	// the pod the command ran in.
+	ExecDebugSession(ctx context.Context, session state.DebugSession, command []string, streams DebugStreams) (state.DebugSession, error)
+}
+
+// DebugStreams are the streams of an exec into a debug session.
+type DebugStreams struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	TTY    bool
+	// Resize delivers the terminal sizes of TTY execs.
+	Resize remotecommand.TerminalSizeQueue
+}
@@ -0,0 +1,270 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/stitchfix/flotilla-os/exceptions"
+	"github.com/stitchfix/flotilla-os/state"
+	"github.com/stitchfix/flotilla-os/utils"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// debugLabel marks the pods of debug twins with their session.
+const debugLabel = "flotilla-debug-session"
+
+// twinTTLSecondsAfterFinished is how long finished twins are kept around.
+var twinTTLSecondsAfterFinished = int32(60)
+
+// StartDebugSession launches the twin of the run or adds an ephemeral
+// container to its pod, both sleeping until the session expires.
+func (ee *EKSExecutionEngine) StartDebugSession(ctx context.Context, executable state.Executable, run state.Run, session state.DebugSession, manager state.Manager) (state.DebugSession, error) {
+	ctx, span := utils.TraceJob(ctx, "flotilla.job.eks_debug_start", run.RunID)
+	defer span.Finish()
+	utils.TagJobRun(span, run)
+	span.SetTag("debug.mode", session.Mode)
+
+	kClient, err := ee.getKClient(run)
+	if err != nil {
+		return session, err
+	}
+	session.Namespace = ee.jobNamespace
+	sleep := []string{"sleep", fmt.Sprintf("%d", int64(session.ExpiresAt.Sub(session.CreatedAt).Seconds()))}
+
+	if session.Mode == state.DebugModeEphemeral {
+		if run.PodName == nil {
+			return session, exceptions.ConflictingResource{ErrorString: fmt.Sprintf("run [%s] has no pod to debug", run.RunID)}
+		}
+		pod, err := kClient.CoreV1().Pods(ee.jobNamespace).Get(ctx, *run.PodName, metav1.GetOptions{})
+		if err != nil {
+			return session, errors.Wrapf(err, "unable to get pod of run [%s]", run.RunID)
+		}
+		main := debugTarget(pod.Spec.Containers, run)
+		if main == nil {
+			return session, exceptions.ConflictingResource{ErrorString: fmt.Sprintf("pod [%s] has no container to debug", pod.Name)}
+		}
+		if len(session.Image) == 0 {
+			session.Image = main.Image
+		}
+		pod.Spec.EphemeralContainers = append(pod.Spec.EphemeralContainers, v1.EphemeralContainer{
+			EphemeralContainerCommon: v1.EphemeralContainerCommon{
+				Name:         session.SessionID,
+				Image:        session.Image,
+				Command:      sleep,
+				Env:          main.Env,
+				VolumeMounts: main.VolumeMounts,
+				Stdin:        true,
+				TTY:          true,
+			},
+			TargetContainerName: main.Name,
+		})
+		if _, err = kClient.CoreV1().Pods(ee.jobNamespace).UpdateEphemeralContainers(ctx, pod.Name, pod, metav1.UpdateOptions{}); err != nil {
+			span.SetTag("error", true)
+			span.SetTag("error.msg", err.Error())
+			return session, errors.Wrapf(err, "unable to add debug container to pod [%s]", pod.Name)
+		}
+		session.PodName = pod.Name
+		session.Container = session.SessionID
+		return session, nil
+	}
+
+	run, job, err := ee.prepareJob(ctx, executable, run, manager)
+	if err != nil {
+		return session, err
+	}
+	twin(&job, run, session, sleep)
+	main := debugTarget(job.Spec.Template.Spec.Containers, run)
+	if _, err = kClient.BatchV1().Jobs(ee.jobNamespace).Create(ctx, &job, metav1.CreateOptions{}); err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return session, errors.Wrapf(err, "unable to create debug twin of run [%s]", run.RunID)
+	}
+	session.JobName = job.Name
+	session.Container = main.Name
+	session.Image = main.Image
+	return session, nil
+}
+
+// twin turns the job of a run into the job of its debug twin: a single pod
+// sleeping until the session expires, without the labels naming the run nor
+// the uploader of the run's outputs.
+func twin(job *batchv1.Job, run state.Run, session state.DebugSession, sleep []string) {
+	ttl := int64(session.ExpiresAt.Sub(session.CreatedAt).Seconds())
+	job.Name = session.SessionID
+	job.Spec.ActiveDeadlineSeconds = &ttl
+	job.Spec.TTLSecondsAfterFinished = &twinTTLSecondsAfterFinished
+	if job.Spec.CompletionMode != nil {
+		one := int32(1)
+		job.Spec.Completions = &one
+		job.Spec.Parallelism = &one
+	}
+
+	labels := map[string]string{}
+	for k, v := range job.Spec.Template.Labels {
+		if v != state.SanitizeLabel(run.RunID) {
+			labels[k] = v
+		}
+	}
+	labels[debugLabel] = session.SessionID
+	labels["flotilla-debug-run-id"] = state.SanitizeLabel(run.RunID)
+	job.Spec.Template.Labels = labels
+
+	podSpec := &job.Spec.Template.Spec
+	var initContainers []v1.Container
+	for _, c := range podSpec.InitContainers {
+		if c.Name != "flotilla-output-uploader" {
+			initContainers = append(initContainers, c)
+		}
+	}
+	podSpec.InitContainers = initContainers
+	if main := debugTarget(podSpec.Containers, run); main != nil {
+		main.Command = sleep
+		main.Args = nil
+	}
+}
+
+// debugTarget returns the run's own container.
+func debugTarget(containers []v1.Container, run state.Run) *v1.Container {
+	for i := range containers {
+		if containers[i].Name == run.RunID {
+			return &containers[i]
+		}
+	}
+	if len(containers) > 0 {
+		return &containers[len(containers)-1]
+	}
+	return nil
+}
+
+// StopDebugSession deletes the twin of the session. Ephemeral containers
+// can't be removed from their pod, they stop once their sleep runs out.
+func (ee *EKSExecutionEngine) StopDebugSession(ctx context.Context, session state.DebugSession) error {
+	if len(session.JobName) == 0 {
+		return nil
+	}
+	kClient, err := ee.clusterManager.GetKubernetesClient(session.ClusterName)
+	if err != nil {
+		return err
+	}
+	gracePeriod := int64(0)
+	propagation := metav1.DeletePropagationBackground
+	err = kClient.BatchV1().Jobs(session.Namespace).Delete(ctx, session.JobName, metav1.DeleteOptions{
+		GracePeriodSeconds: &gracePeriod,
+		PropagationPolicy:  &propagation,
+	})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return errors.Wrapf(err, "unable to delete debug twin [%s]", session.JobName)
+	}
+	return nil
+}
+
+// ExecDebugSession execs the command in the session's container.
+func (ee *EKSExecutionEngine) ExecDebugSession(ctx context.Context, session state.DebugSession, command []string, streams DebugStreams) (state.DebugSession, error) {
+	ctx, span := utils.TraceJob(ctx, "flotilla.job.eks_debug_exec", session.RunID)
+	defer span.Finish()
+	span.SetTag("debug.session_id", session.SessionID)
+
+	kClient, err := ee.clusterManager.GetKubernetesClient(session.ClusterName)
+	if err != nil {
+		return session, err
+	}
+	if session.PodName, err = ee.debugPod(ctx, &kClient, session); err != nil {
+		return session, err
+	}
+
+	if err = ee.execInPod(ctx, &kClient, session.ClusterName, session.Namespace, session.PodName, session.Container, command, streams); err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return session, err
+	}
+	return session, nil
+}
+
+// execInPod execs the command in the container, streaming over websockets and
+// falling back to SPDY on clusters without websocket support.
+func (ee *EKSExecutionEngine) execInPod(ctx context.Context, kClient *kubernetes.Clientset, clusterName string, namespace string, podName string, container string, command []string, streams DebugStreams) error {
+	config, err := ee.clusterManager.GetRestConfig(clusterName)
+	if err != nil {
+		return err
+	}
+	// Upgraded connections can't go through the tracing round tripper.
+	config.WrapTransport = nil
+
+	req := kClient.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(podName).
+		SubResource("exec").
+		VersionedParams(&v1.PodExecOptions{
+			Container: container,
+			Command:   command,
+			Stdin:     streams.Stdin != nil,
+			Stdout:    streams.Stdout != nil,
+			Stderr:    streams.Stderr != nil && !streams.TTY,
+			TTY:       streams.TTY,
+		}, scheme.ParameterCodec)
+
+	websocketExec, err := remotecommand.NewWebSocketExecutor(config, "GET", req.URL().String())
+	if err != nil {
+		return err
+	}
+	spdyExec, err := remotecommand.NewSPDYExecutor(config, "POST", req.URL())
+	if err != nil {
+		return err
+	}
+	exec, err := remotecommand.NewFallbackExecutor(websocketExec, spdyExec, func(err error) bool {
+		return httpstream.IsUpgradeFailure(err) || httpstream.IsHTTPSProxyError(err)
+	})
+	if err != nil {
+		return err
+	}
+
+	options := remotecommand.StreamOptions{
+		Stdin:             streams.Stdin,
+		Stdout:            streams.Stdout,
+		Tty:               streams.TTY,
+		TerminalSizeQueue: streams.Resize,
+	}
+	if !streams.TTY {
+		options.Stderr = streams.Stderr
+	}
+	return exec.StreamWithContext(ctx, options)
+}
+
+// debugPod returns the pod of the session, once its debug container runs.
+func (ee *EKSExecutionEngine) debugPod(ctx context.Context, kClient *kubernetes.Clientset, session state.DebugSession) (string, error) {
+	notRunning := exceptions.ConflictingResource{ErrorString: fmt.Sprintf("debug session [%s] is not running yet", session.SessionID)}
+	if len(session.JobName) == 0 {
+		pod, err := kClient.CoreV1().Pods(session.Namespace).Get(ctx, session.PodName, metav1.GetOptions{})
+		if err != nil {
+			return session.PodName, err
+		}
+		for _, status := range pod.Status.EphemeralContainerStatuses {
+			if status.Name == session.Container && status.State.Running != nil {
+				return pod.Name, nil
+			}
+		}
+		return pod.Name, notRunning
+	}
+
+	pods, err := kClient.CoreV1().Pods(session.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("job-name=%s", session.JobName),
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == v1.PodRunning && pod.DeletionTimestamp == nil {
+			return pod.Name, nil
+		}
+	}
+	return "", notRunning
+}
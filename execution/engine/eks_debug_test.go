@@ -0,0 +1,63 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stitchfix/flotilla-os/state"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestTwin(t *testing.T) {
+	run := state.Run{RunID: "eks-run"}
+	completions := int32(4)
+	indexed := batchv1.IndexedCompletion
+	job := batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: run.RunID},
+		Spec: batchv1.JobSpec{
+			Completions:    &completions,
+			Parallelism:    &completions,
+			CompletionMode: &indexed,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{
+					"flotilla-run-id": run.RunID,
+					"team":            "data",
+				}},
+				Spec: corev1.PodSpec{
+					InitContainers: []corev1.Container{{Name: "flotilla-output-uploader"}, {Name: "setup"}},
+					Containers: []corev1.Container{
+						{Name: "sidecar", Command: []string{"proxy"}},
+						{Name: run.RunID, Command: []string{"bash", "-c"}, Args: []string{"train"}},
+					},
+				},
+			},
+		},
+	}
+	now := time.Now()
+	session := state.DebugSession{SessionID: "debug-a", CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+	sleep := []string{"sleep", "3600"}
+
+	twin(&job, run, session, sleep)
+	if job.Name != "debug-a" || *job.Spec.ActiveDeadlineSeconds != 3600 {
+		t.Errorf("expected the twin to be named after the session and expire with it, got %s %d", job.Name, *job.Spec.ActiveDeadlineSeconds)
+	}
+	if *job.Spec.Completions != 1 || *job.Spec.Parallelism != 1 {
+		t.Errorf("expected a single pod twin")
+	}
+	labels := job.Spec.Template.Labels
+	if _, ok := labels["flotilla-run-id"]; ok || labels["team"] != "data" || labels[debugLabel] != "debug-a" {
+		t.Errorf("unexpected twin labels %v", labels)
+	}
+	spec := job.Spec.Template.Spec
+	if len(spec.InitContainers) != 1 || spec.InitContainers[0].Name != "setup" {
+		t.Errorf("expected the output uploader to be dropped, got %+v", spec.InitContainers)
+	}
+	if spec.Containers[1].Command[0] != "sleep" || spec.Containers[1].Args != nil {
+		t.Errorf("expected the run's container to sleep, got %+v", spec.Containers[1])
+	}
+	if spec.Containers[0].Command[0] != "proxy" {
+		t.Errorf("expected sidecars to be left alone")
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/go-redis/redis"
 	"github.com/stitchfix/flotilla-os/utils"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -19,9 +20,11 @@ import (
 	flotillaLog "github.com/stitchfix/flotilla-os/log"
 	"github.com/stitchfix/flotilla-os/queue"
 	"github.com/stitchfix/flotilla-os/state"
+	"github.com/stitchfix/flotilla-os/tracing"
 	awstrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/aws/aws-sdk-go/aws"
-	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	k8sJson "k8s.io/apimachinery/pkg/runtime/serializer/json"
@@ -40,7 +43,7 @@ type EKSExecutionEngine struct {
 	jobNamespace    string
 	jobTtl          int
 	jobSA           string
-	jobARAEnabled   bool
+	jobARAEnabled   atomic.Bool
 	schedulerName   string
 	serializer      *k8sJson.Serializer
 	s3Client        *s3.S3
@@ -67,7 +70,7 @@ func (ee *EKSExecutionEngine) Initialize(conf config.Config) error {
 	ee.jobNamespace = conf.GetString("eks_job_namespace")
 	ee.jobTtl = conf.GetInt("eks_job_ttl")
 	ee.jobSA = conf.GetString("eks_default_service_account")
-	ee.jobARAEnabled = true
+	ee.jobARAEnabled.Store(true)
 	clusterManager, err := NewDynamicClusterManager(
 		conf.GetString("aws_default_region"),
 		ee.log,
@@ -117,8 +120,17 @@ func (ee *EKSExecutionEngine) Initialize(conf config.Config) error {
 	return nil
 }
 
+// subscribe follows the settings of the engine which can be changed at
+// runtime.
+func (ee *EKSExecutionEngine) subscribe(settings *state.Settings) {
+	settings.Subscribe(state.SettingJobARAEnabled, func(v interface{}) {
+		enabled, _ := v.(bool)
+		ee.jobARAEnabled.Store(enabled)
+	})
+}
+
 func (ee *EKSExecutionEngine) Execute(ctx context.Context, executable state.Executable, run state.Run, manager state.Manager) (state.Run, bool, error) {
-	var span tracer.Span
+	var span tracing.Span
 	if ctx == nil {
 		ctx = context.Background()
 	}
@@ -128,40 +140,13 @@ func (ee *EKSExecutionEngine) Execute(ctx context.Context, executable state.Exec
 	span.SetTag("job.tier", run.Tier)
 	defer span.Finish()
 	utils.TagJobRun(span, run)
-	if run.Namespace == nil || *run.Namespace == "" {
-		clusters, err := manager.ListClusterStates(ctx)
-		if err == nil {
-			for _, cluster := range clusters {
-				if cluster.Name == run.ClusterName && cluster.Namespace != "" {
-					run.Namespace = &cluster.Namespace
-					break
-				}
-			}
-		}
-	}
-
-	if run.ServiceAccount == nil {
-		run.ServiceAccount = aws.String(ee.jobSA)
-	}
-
-	var capabilities state.Capabilities
-	if clusters, err := manager.ListClusterStates(ctx); err == nil {
-		for _, cluster := range clusters {
-			if cluster.Name == run.ClusterName {
-				capabilities = cluster.Capabilities
-				break
-			}
-		}
-	}
-
-	tierTag := fmt.Sprintf("tier:%s", run.Tier)
-
-	job, err := ee.adapter.AdaptFlotillaDefinitionAndRunToJob(ctx, executable, run, ee.schedulerName, manager, ee.jobARAEnabled, capabilities)
+	run, job, err := ee.prepareJob(ctx, executable, run, manager)
 	if err != nil {
 		exitReason := fmt.Sprintf("Error creating k8s manigest - %s", err.Error())
 		run.ExitReason = &exitReason
 		return run, false, err
 	}
+	tierTag := fmt.Sprintf("tier:%s", run.Tier)
 
 	kClient, err := ee.getKClient(run)
 	if err != nil {
@@ -211,6 +196,11 @@ func (ee *EKSExecutionEngine) Execute(ctx context.Context, executable state.Exec
 	}
 	_ = metrics.Increment(metrics.EngineEKSExecute, []string{string(metrics.StatusSuccess), tierTag}, 1)
 
+	if service := ee.adapter.AdaptFlotillaRunToService(run); service != nil {
+		ee.createReplicaService(ctx, &kClient, service, result)
+	}
+	run.Endpoints = ee.exposePorts(ctx, &kClient, executable, run, result)
+
 	run, _ = ee.getPodName(run)
 	adaptedRun, err := ee.adapter.AdaptJobToFlotillaRun(result, run, nil)
 
@@ -230,6 +220,90 @@ func (ee *EKSExecutionEngine) Execute(ctx context.Context, executable state.Exec
 	return adaptedRun, false, nil
 }
 
+// Render returns the job Execute would create for the run.
+func (ee *EKSExecutionEngine) Render(ctx context.Context, executable state.Executable, run state.Run, manager state.Manager) (RenderedRun, error) {
+	ctx, span := utils.TraceJob(ctx, "flotilla.job.render", run.RunID)
+	// Rendering doesn't submit anything, its resource allocation isn't counted.
+	ctx = metrics.Mute(ctx)
+	defer span.Finish()
+	utils.TagJobRun(span, run)
+
+	run, job, err := ee.prepareJob(ctx, executable, run, manager)
+	if err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return RenderedRun{Run: run}, err
+	}
+	job.TypeMeta = metav1.TypeMeta{Kind: "Job", APIVersion: "batch/v1"}
+	job.Namespace = ee.jobNamespace
+	rendered := RenderedRun{Run: run, Job: &job}
+	if service := ee.adapter.AdaptFlotillaRunToService(run); service != nil {
+		service.TypeMeta = metav1.TypeMeta{Kind: "Service", APIVersion: "v1"}
+		service.Namespace = ee.jobNamespace
+		rendered.Service = service
+	}
+	if service := ee.adapter.AdaptFlotillaRunToPortsService(executable, run); service != nil {
+		ingress, err := ee.adapter.AdaptFlotillaRunToIngress(run, service)
+		if err != nil {
+			return rendered, err
+		}
+		service.TypeMeta = metav1.TypeMeta{Kind: "Service", APIVersion: "v1"}
+		service.Namespace = ee.jobNamespace
+		rendered.PortsService = service
+		if ingress != nil {
+			ingress.TypeMeta = metav1.TypeMeta{Kind: "Ingress", APIVersion: "networking.k8s.io/v1"}
+			ingress.Namespace = ee.jobNamespace
+			rendered.Ingress = ingress
+		}
+	}
+	return rendered, nil
+}
+
+// createReplicaService creates the headless service of a replicated run. The
+// service is owned by the run's job so that it's removed along with it.
+func (ee *EKSExecutionEngine) createReplicaService(ctx context.Context, kClient *kubernetes.Clientset, service *v1.Service, job *batchv1.Job) {
+	service.OwnerReferences = ownedBy(job)
+	_, err := kClient.CoreV1().Services(ee.jobNamespace).Create(ctx, service, metav1.CreateOptions{})
+	if err != nil && !strings.Contains(strings.ToLower(err.Error()), "already exists") {
+		_ = ee.log.Log("level", "error", "message", "unable to create replica service", "run_id", job.Name, "error", err.Error())
+	}
+}
+
+// prepareJob resolves the namespace, service account, cluster capabilities and
+// scheduling policy of the run and adapts it to a k8s job.
+func (ee *EKSExecutionEngine) prepareJob(ctx context.Context, executable state.Executable, run state.Run, manager state.Manager) (state.Run, batchv1.Job, error) {
+	if run.Namespace == nil || *run.Namespace == "" {
+		clusters, err := manager.ListClusterStates(ctx)
+		if err == nil {
+			for _, cluster := range clusters {
+				if cluster.Name == run.ClusterName && cluster.Namespace != "" {
+					run.Namespace = &cluster.Namespace
+					break
+				}
+			}
+		}
+	}
+
+	if run.ServiceAccount == nil {
+		run.ServiceAccount = aws.String(ee.jobSA)
+	}
+
+	var capabilities state.Capabilities
+	policy := state.DefaultSchedulingPolicy()
+	if clusters, err := manager.ListClusterStates(ctx); err == nil {
+		for _, cluster := range clusters {
+			if cluster.Name == run.ClusterName {
+				capabilities = cluster.Capabilities
+				policy = cluster.Scheduling()
+				break
+			}
+		}
+	}
+
+	job, err := ee.adapter.AdaptFlotillaDefinitionAndRunToJob(ctx, executable, run, ee.schedulerName, manager, ee.jobARAEnabled.Load(), capabilities, policy)
+	return run, job, err
+}
+
 func (ee *EKSExecutionEngine) getPodName(run state.Run) (state.Run, error) {
 	podList, err := ee.getPodList(run)
 
@@ -271,8 +345,22 @@ func (ee *EKSExecutionEngine) getPodList(run state.Run) (*v1.PodList, error) {
 		return &v1.PodList{}, err
 	}
 
+	if run.IsReplicated() {
+		// Replicated runs are made of a pod per index, all of them are needed.
+		return kClient.CoreV1().Pods(ee.jobNamespace).List(ctx, metav1.ListOptions{
+			LabelSelector: fmt.Sprintf("job-name=%s", run.RunID),
+		})
+	}
+
 	if run.PodName != nil {
 		pod, err := kClient.CoreV1().Pods(ee.jobNamespace).Get(ctx, *run.PodName, metav1.GetOptions{})
+		if k8serrors.IsNotFound(err) && run.Attempts != nil {
+			// The pod belongs to an attempt of a resubmitted run, look up
+			// the pod of the current attempt.
+			return kClient.CoreV1().Pods(ee.jobNamespace).List(ctx, metav1.ListOptions{
+				LabelSelector: fmt.Sprintf("job-name=%s", run.RunID),
+			})
+		}
 		if pod != nil {
 			return &v1.PodList{Items: []v1.Pod{*pod}}, err
 		}
@@ -295,6 +383,9 @@ func (ee *EKSExecutionEngine) getKClient(run state.Run) (kubernetes.Clientset, e
 	ctx := context.Background()
 	ctx, span := utils.TraceJob(ctx, "flotilla.job.get_k8s_client", run.RunID)
 	defer span.Finish()
+	if kClient, ok := ee.kClients[run.ClusterName]; ok {
+		return kClient, nil
+	}
 	startTime := time.Now()
 	kClient, err := ee.clusterManager.GetKubernetesClient(run.ClusterName)
 	span.SetTag("k8s.client_init_ms", time.Since(startTime).Milliseconds())
@@ -308,7 +399,7 @@ func (ee *EKSExecutionEngine) getKClient(run state.Run) (kubernetes.Clientset, e
 }
 
 func (ee *EKSExecutionEngine) Terminate(ctx context.Context, run state.Run) error {
-	var span tracer.Span
+	var span tracing.Span
 	if ctx == nil {
 		ctx = context.Background()
 	}
@@ -316,9 +407,14 @@ func (ee *EKSExecutionEngine) Terminate(ctx context.Context, run state.Run) erro
 	ctx, span = utils.TraceJob(ctx, "flotilla.job.eks_terminate", run.RunID)
 	defer span.Finish()
 	utils.TagJobRun(span, run)
-	gracePeriod := int64(300)
+	gracePeriod := run.Stop.GracePeriod()
 	deletionPropagation := metav1.DeletePropagationBackground
-	_ = ee.log.Log("level", "info", "message", "terminating run", "run_id", run.RunID)
+	if run.Stop != nil {
+		_ = ee.log.Log("level", "info", "message", "terminating run", "run_id", run.RunID,
+			"by", run.Stop.By, "reason", run.Stop.Reason, "grace_period_seconds", gracePeriod, "signal", run.Stop.Signal)
+	} else {
+		_ = ee.log.Log("level", "info", "message", "terminating run", "run_id", run.RunID)
+	}
 	deleteOptions := &metav1.DeleteOptions{
 		GracePeriodSeconds: &gracePeriod,
 		PropagationPolicy:  &deletionPropagation,
@@ -331,18 +427,31 @@ func (ee *EKSExecutionEngine) Terminate(ctx context.Context, run state.Run) erro
 		return err
 	}
 
-	_ = kClient.BatchV1().Jobs(ee.jobNamespace).Delete(ctx, run.RunID, *deleteOptions)
+	// Runs signalled have had their grace period once their pods are deleted.
+	if run.Stop != nil && len(run.Stop.Signal) > 0 && ee.signalRun(ctx, &kClient, run, run.Stop.Signal, gracePeriod) {
+		noGracePeriod := int64(0)
+		deleteOptions.GracePeriodSeconds = &noGracePeriod
+	}
+
+	tierTag := fmt.Sprintf("tier:%s", run.Tier)
+	// A job which is already gone counts as terminated.
+	err = kClient.BatchV1().Jobs(ee.jobNamespace).Delete(ctx, run.RunID, *deleteOptions)
+	if err != nil && !k8serrors.IsNotFound(err) {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		_ = metrics.Increment(metrics.EngineEKSTerminate, []string{string(metrics.StatusFailure), tierTag}, 1)
+		return err
+	}
 	if run.PodName != nil {
 		_ = kClient.CoreV1().Pods(ee.jobNamespace).Delete(ctx, *run.PodName, *deleteOptions)
 	}
 
-	tierTag := fmt.Sprintf("tier:%s", run.Tier)
 	_ = metrics.Increment(metrics.EngineEKSTerminate, []string{string(metrics.StatusSuccess), tierTag}, 1)
 	return nil
 }
 
 func (ee *EKSExecutionEngine) Enqueue(ctx context.Context, run state.Run) error {
-	var span tracer.Span
+	var span tracing.Span
 	ctx, span = utils.TraceJob(ctx, "flotilla.job.eks_enqueue", "")
 	defer span.Finish()
 	span.SetTag("job.run_id", run.RunID)
@@ -387,18 +496,11 @@ func (ee *EKSExecutionEngine) PollRuns(ctx context.Context) ([]RunReceipt, error
 		if runReceipt.Run == nil {
 			continue
 		}
-		if runReceipt.TraceID != 0 && runReceipt.ParentID != 0 {
+		if len(runReceipt.TraceContext) > 0 {
 			ee.log.Log("level", "info", "message", "Received run with trace context",
-				"run_id", runReceipt.Run.RunID,
-				"trace_id", runReceipt.TraceID,
-				"parent_id", runReceipt.ParentID)
-		}
-		runs = append(runs, RunReceipt{
-			RunReceipt:       runReceipt,
-			TraceID:          runReceipt.TraceID,
-			ParentID:         runReceipt.ParentID,
-			SamplingPriority: runReceipt.SamplingPriority,
-		})
+				"run_id", runReceipt.Run.RunID)
+		}
+		runs = append(runs, RunReceipt{RunReceipt: runReceipt})
 	}
 	return runs, nil
 }
@@ -447,7 +549,7 @@ func (ee *EKSExecutionEngine) Get(ctx context.Context, run state.Run) (state.Run
 }
 
 func (ee *EKSExecutionEngine) GetEvents(ctx context.Context, run state.Run) (state.PodEventList, error) {
-	var span tracer.Span
+	var span tracing.Span
 	if ctx == nil {
 		ctx = context.Background()
 	}
@@ -463,14 +565,30 @@ func (ee *EKSExecutionEngine) GetEvents(ctx context.Context, run state.Run) (sta
 		return state.PodEventList{}, err
 	}
 
-	eventList, err := kClient.CoreV1().Events(ee.jobNamespace).List(ctx, metav1.ListOptions{FieldSelector: fmt.Sprintf("involvedObject.name==%s", *run.PodName)})
-	if err != nil {
-		return state.PodEventList{}, errors.Errorf("error getting kubernetes event for flotilla run %s", err)
+	// The events of a replicated run are those of all of its pods.
+	podNames := []string{*run.PodName}
+	if run.IsReplicated() && run.ReplicaPods != nil {
+		podNames = podNames[:0]
+		for _, replica := range *run.ReplicaPods {
+			podNames = append(podNames, replica.PodName)
+		}
+	}
+
+	var events []v1.Event
+	for _, podName := range podNames {
+		eventList, err := kClient.CoreV1().Events(ee.jobNamespace).List(ctx, metav1.ListOptions{FieldSelector: fmt.Sprintf("involvedObject.name==%s", podName)})
+		if err != nil {
+			return state.PodEventList{}, errors.Errorf("error getting kubernetes event for flotilla run %s", err)
+		}
+		events = append(events, eventList.Items...)
 	}
 
 	var podEvents []state.PodEvent
-	for _, e := range eventList.Items {
+	for _, e := range events {
 		eTime := e.FirstTimestamp.Time
+		if eTime.IsZero() {
+			eTime = e.EventTime.Time
+		}
 		runEvent := state.PodEvent{
 			Message:      e.Message,
 			Timestamp:    &eTime,
@@ -495,7 +613,7 @@ func (ee *EKSExecutionEngine) GetEvents(ctx context.Context, run state.Run) (sta
 }
 
 func (ee *EKSExecutionEngine) FetchPodMetrics(ctx context.Context, run state.Run) (state.Run, error) {
-	var span tracer.Span
+	var span tracing.Span
 	if ctx == nil {
 		ctx = context.Background()
 	}
@@ -543,7 +661,7 @@ func (ee *EKSExecutionEngine) FetchPodMetrics(ctx context.Context, run state.Run
 }
 
 func (ee *EKSExecutionEngine) FetchUpdateStatus(ctx context.Context, run state.Run) (state.Run, error) {
-	var span tracer.Span
+	var span tracing.Span
 	if ctx == nil {
 		ctx = context.Background()
 	}
@@ -585,8 +703,17 @@ func (ee *EKSExecutionEngine) FetchUpdateStatus(ctx context.Context, run state.R
 	_ = metrics.Timing(metrics.StatusWorkerGetPodList, time.Since(start), []string{run.ClusterName}, 1)
 
 	if err == nil && podList != nil && podList.Items != nil && len(podList.Items) > 0 {
-		// Iterate over associated pods to find the most recent.
+		if run.IsReplicated() {
+			replicas := state.MergeReplicaPods(run.ReplicaPods, ee.adapter.AdaptPodsToReplicas(podList.Items))
+			run.ReplicaPods = &replicas
+		}
+
+		// Iterate over associated pods to find the most recent. The pod of a
+		// replicated run is its rank 0 pod.
 		for _, p := range podList.Items {
+			if run.IsReplicated() && p.Annotations[batchv1.JobCompletionIndexAnnotation] != "0" {
+				continue
+			}
 			if mostRecentPodCreationTimestamp.Before(&p.CreationTimestamp) || len(podList.Items) == 1 {
 				mostRecentPod = &p
 				mostRecentPodCreationTimestamp = p.CreationTimestamp
@@ -626,10 +753,25 @@ func (ee *EKSExecutionEngine) FetchUpdateStatus(ctx context.Context, run state.R
 	//run, _ = ee.FetchPodMetrics(ctx, run)
 	hoursBack := time.Now().Add(-24 * time.Hour)
 
-	start = time.Now()
+	// The events of pending pods tell the stuck run detector why they aren't
+	// running, like their volumes failing to mount, and when they got past it.
 	var events state.PodEventList
-	//events, err = ee.GetEvents(ctx, run)
-	_ = metrics.Timing(metrics.StatusWorkerGetEvents, time.Since(start), []string{run.ClusterName}, 1)
+	if run.Status == state.StatusPending && run.PodName != nil {
+		start = time.Now()
+		podEvents, eventsErr := ee.GetEvents(ctx, run)
+		_ = metrics.Timing(metrics.StatusWorkerGetEvents, time.Since(start), []string{run.ClusterName}, 1)
+		if eventsErr != nil {
+			span.SetTag("error.events", eventsErr.Error())
+		} else {
+			events = podEvents
+		}
+	}
+
+	// The problems of a pending pod, like its image failing to pull, are
+	// recorded with its events for the stuck run detector.
+	if mostRecentPod != nil {
+		events.PodEvents = append(events.PodEvents, state.PodStatusEvents(*mostRecentPod)...)
+	}
 
 	if err == nil && len(events.PodEvents) > 0 {
 		newEvents := events.PodEvents
@@ -0,0 +1,110 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	gklog "github.com/go-kit/kit/log"
+	"github.com/stitchfix/flotilla-os/config"
+	"github.com/stitchfix/flotilla-os/execution/adapter"
+	flotillaLog "github.com/stitchfix/flotilla-os/log"
+	"github.com/stitchfix/flotilla-os/state"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// kubernetesAPI serves the objects by path as a kubernetes API server would.
+func kubernetesAPI(t *testing.T, objects map[string]interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		object, ok := objects[r.URL.Path]
+		if !ok {
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(object)
+	}))
+}
+
+func TestEKSExecutionEngine_FetchUpdateStatusPodEvents(t *testing.T) {
+	ctx := context.Background()
+	createdAt := metav1.NewTime(time.Now().Add(-time.Hour))
+	failedAt := metav1.NewTime(time.Now().Add(-50 * time.Minute))
+	server := kubernetesAPI(t, map[string]interface{}{
+		"/apis/batch/v1/namespaces/flotilla/jobs/run-a": batchv1.Job{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "batch/v1", Kind: "Job"},
+			ObjectMeta: metav1.ObjectMeta{Name: "run-a", Namespace: "flotilla"},
+			Status:     batchv1.JobStatus{Active: 1},
+		},
+		"/api/v1/namespaces/flotilla/pods/pod-a": v1.Pod{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+			ObjectMeta: metav1.ObjectMeta{Name: "pod-a", Namespace: "flotilla", CreationTimestamp: createdAt},
+			Status: v1.PodStatus{
+				Phase: v1.PodPending,
+				ContainerStatuses: []v1.ContainerStatus{
+					{Name: "main", State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "ContainerCreating"}}},
+				},
+			},
+		},
+		"/api/v1/namespaces/flotilla/events": v1.EventList{
+			TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "EventList"},
+			Items: []v1.Event{{
+				ObjectMeta:     metav1.ObjectMeta{Name: "pod-a.1", Namespace: "flotilla"},
+				Reason:         "FailedMount",
+				Message:        "MountVolume.SetUp failed for volume \"data\"",
+				Type:           v1.EventTypeWarning,
+				FirstTimestamp: failedAt,
+			}},
+		},
+	})
+	defer server.Close()
+
+	kClient, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	confDir := "../../conf"
+	c, _ := config.NewConfig(&confDir)
+	logger := flotillaLog.NewLogger(gklog.NewLogfmtLogger(gklog.NewSyncWriter(os.Stderr)), nil)
+	eksAdapter, err := adapter.NewEKSAdapter(c, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ee := &EKSExecutionEngine{
+		kClients:     map[string]kubernetes.Clientset{"a": *kClient},
+		adapter:      eksAdapter,
+		log:          logger,
+		jobNamespace: "flotilla",
+	}
+
+	queuedAt := createdAt.Time
+	podName := "pod-a"
+	run, err := ee.FetchUpdateStatus(ctx, state.Run{
+		RunID:       "run-a",
+		ClusterName: "a",
+		Status:      state.StatusPending,
+		QueuedAt:    &queuedAt,
+		PodName:     &podName,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.PodEvents == nil || len(*run.PodEvents) != 1 || (*run.PodEvents)[0].Reason != "FailedMount" {
+		t.Fatalf("expected the events of the pending pod to be recorded, got %+v", run.PodEvents)
+	}
+
+	detector, _ := state.NewStuckRunDetector(nil)
+	stuck := detector.Detect(run, time.Now())
+	if stuck == nil || stuck.Pattern.Name != "mount" {
+		t.Errorf("expected the run to be stuck on its volumes, got %+v", stuck)
+	}
+}
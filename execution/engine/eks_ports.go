@@ -0,0 +1,92 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+
+	"github.com/stitchfix/flotilla-os/state"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// exposePorts creates the service exposing the ports of the run, and its
+// ingress if configured, and returns their endpoints. Both are owned by the
+// run's job so that they're removed along with it once the run ends.
+func (ee *EKSExecutionEngine) exposePorts(ctx context.Context, kClient *kubernetes.Clientset, executable state.Executable, run state.Run, job *batchv1.Job) *state.RunEndpoints {
+	service := ee.adapter.AdaptFlotillaRunToPortsService(executable, run)
+	if service == nil {
+		return nil
+	}
+	service.OwnerReferences = ownedBy(job)
+	_, err := kClient.CoreV1().Services(ee.jobNamespace).Create(ctx, service, metav1.CreateOptions{})
+	if err != nil && !strings.Contains(strings.ToLower(err.Error()), "already exists") {
+		_ = ee.log.Log("level", "error", "message", "unable to create ports service", "run_id", run.RunID, "error", err.Error())
+		return nil
+	}
+
+	ingress, err := ee.adapter.AdaptFlotillaRunToIngress(run, service)
+	if err != nil {
+		_ = ee.log.Log("level", "error", "message", "unable to adapt ingress", "run_id", run.RunID, "error", err.Error())
+	}
+	if ingress != nil {
+		ingress.OwnerReferences = ownedBy(job)
+		_, err = kClient.NetworkingV1().Ingresses(ee.jobNamespace).Create(ctx, ingress, metav1.CreateOptions{})
+		if err != nil && !strings.Contains(strings.ToLower(err.Error()), "already exists") {
+			_ = ee.log.Log("level", "error", "message", "unable to create ingress", "run_id", run.RunID, "error", err.Error())
+			ingress = nil
+		}
+	}
+
+	endpoints := ee.adapter.AdaptExposureToEndpoints(run, ee.jobNamespace, service, ingress)
+	return &endpoints
+}
+
+// ownedBy returns the owner references of objects removed along with the job.
+func ownedBy(job *batchv1.Job) []metav1.OwnerReference {
+	return []metav1.OwnerReference{{
+		APIVersion: "batch/v1",
+		Kind:       "Job",
+		Name:       job.Name,
+		UID:        job.UID,
+	}}
+}
+
+// ProxyPort proxies requests to the port through the service proxy of the
+// run's cluster api server, authenticated as flotilla.
+func (ee *EKSExecutionEngine) ProxyPort(run state.Run, port int, prefix string) (http.Handler, error) {
+	config, err := ee.clusterManager.GetRestConfig(run.ClusterName)
+	if err != nil {
+		return nil, err
+	}
+	transport, err := rest.TransportFor(config)
+	if err != nil {
+		return nil, err
+	}
+	host, err := url.Parse(config.Host)
+	if err != nil {
+		return nil, err
+	}
+	target := host.JoinPath("api", "v1", "namespaces", ee.jobNamespace, "services",
+		fmt.Sprintf("%s:%d", state.PortsServiceName(run.RunID), port), "proxy")
+
+	return &httputil.ReverseProxy{
+		Transport: transport,
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(target)
+			r.Out.URL.Path = strings.TrimSuffix(target.Path, "/") + "/" + strings.TrimPrefix(strings.TrimPrefix(r.In.URL.Path, prefix), "/")
+			r.Out.URL.RawPath = ""
+			r.Out.Host = target.Host
+			// The api server is reached with flotilla's credentials, not
+			// those the client authenticated to flotilla with.
+			r.Out.Header.Del("Authorization")
+			r.SetXForwarded()
+			r.Out.Header.Set("X-Forwarded-Prefix", prefix)
+		},
+	}, nil
+}
@@ -0,0 +1,67 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/stitchfix/flotilla-os/state"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// stopPollInterval is how often the pods of signalled runs are checked.
+var stopPollInterval = 2 * time.Second
+
+// signalRun sends the signal to the main process of the running pods of the
+// run, then waits up to the grace period for them to exit. It returns false
+// when no pod could be signalled.
+func (ee *EKSExecutionEngine) signalRun(ctx context.Context, kClient *kubernetes.Clientset, run state.Run, signal string, gracePeriod int64) bool {
+	pods, err := kClient.CoreV1().Pods(ee.jobNamespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("job-name=%s", run.RunID),
+	})
+	if err != nil {
+		return false
+	}
+
+	command := []string{"kill", "-s", strings.TrimPrefix(signal, "SIG"), "1"}
+	signalled := map[string]bool{}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != v1.PodRunning {
+			continue
+		}
+		err = ee.execInPod(ctx, kClient, run.ClusterName, ee.jobNamespace, pod.Name, run.RunID, command, DebugStreams{Stdout: io.Discard, Stderr: io.Discard})
+		if err != nil {
+			_ = ee.log.Log("level", "error", "message", "unable to signal run", "run_id", run.RunID, "pod", pod.Name, "signal", signal, "error", err.Error())
+			continue
+		}
+		signalled[pod.Name] = true
+	}
+	if len(signalled) == 0 {
+		return false
+	}
+
+	deadline := time.Now().Add(time.Duration(gracePeriod) * time.Second)
+	for time.Now().Before(deadline) {
+		running := false
+		for name := range signalled {
+			pod, err := kClient.CoreV1().Pods(ee.jobNamespace).Get(ctx, name, metav1.GetOptions{})
+			if err == nil && pod.Status.Phase == v1.PodRunning {
+				running = true
+				break
+			}
+		}
+		if !running {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return true
+		case <-time.After(stopPollInterval):
+		}
+	}
+	return true
+}
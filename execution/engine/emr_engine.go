@@ -20,8 +20,8 @@ import (
 	flotillaLog "github.com/stitchfix/flotilla-os/log"
 	"github.com/stitchfix/flotilla-os/queue"
 	"github.com/stitchfix/flotilla-os/state"
+	"github.com/stitchfix/flotilla-os/tracing"
 	awstrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/aws/aws-sdk-go/aws"
-	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	_ "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -138,7 +138,7 @@ func (emr *EMRExecutionEngine) getKClient(run state.Run) (kubernetes.Clientset,
 	return kClient, nil
 }
 func (emr *EMRExecutionEngine) Execute(ctx context.Context, executable state.Executable, run state.Run, manager state.Manager) (state.Run, bool, error) {
-	var span tracer.Span
+	var span tracing.Span
 	if ctx == nil {
 		ctx = context.Background()
 	}
@@ -146,29 +146,19 @@ func (emr *EMRExecutionEngine) Execute(ctx context.Context, executable state.Exe
 	ctx, span = utils.TraceJob(ctx, "flotilla.job.emr_execute", run.RunID)
 	defer span.Finish()
 	utils.TagJobRun(span, run)
-	run = emr.estimateExecutorCount(run, manager)
-	run = emr.estimateMemoryResources(ctx, run, manager)
-
-	if run.ServiceAccount == nil || *run.ServiceAccount == "" {
-		run.ServiceAccount = aws.String(emr.emrJobSA)
-	}
-
-	if run.CommandHash != nil && run.NodeLifecycle != nil && *run.NodeLifecycle == state.SpotLifecycle {
-		nodeType, err := manager.GetNodeLifecycle(ctx, run.DefinitionID, *run.CommandHash)
-		if err == nil && nodeType == state.OndemandLifecycle {
-			run.NodeLifecycle = &state.OndemandLifecycle
-		}
-	}
+	run = emr.prepareRun(ctx, run, manager)
 
-	_, capabilities, _ := emr.resolveCluster(ctx, run)
+	cluster, _ := emr.resolveCluster(ctx, run)
 
-	if team := run.Labels["team"]; team != "" && capabilities.Has(state.CapPoolSizing) {
+	if team := run.Labels["team"]; team != "" && cluster.Capabilities.Has(state.CapPoolSizing) {
 		if kClient, err := emr.getKClient(run); err == nil {
 			go ensureTeamRegistryConfigMap(context.Background(), &kClient, emr.emrJobNamespace, team)
 		}
 	}
 
-	startJobRunInput, err := emr.generateEMRStartJobRunInput(ctx, executable, run, manager, capabilities)
+	driverTemplate := emr.driverPodTemplate(ctx, executable, run, manager, cluster)
+	executorTemplate := emr.executorPodTemplate(ctx, executable, run, manager, cluster)
+	startJobRunInput, err := emr.generateEMRStartJobRunInput(ctx, run, driverTemplate, executorTemplate)
 	emrJobManifest := aws.String(fmt.Sprintf("%s/%s/%s.json", emr.s3ManifestBasePath, run.RunID, "start-job-run-input"))
 	obj, err := json.MarshalIndent(startJobRunInput, "", "\t")
 	if err == nil {
@@ -206,13 +196,58 @@ func (emr *EMRExecutionEngine) Execute(ctx context.Context, executable state.Exe
 	return run, false, nil
 }
 
-func (emr *EMRExecutionEngine) generateApplicationConf(ctx context.Context, executable state.Executable, run state.Run, manager state.Manager, capabilities state.Capabilities) []*emrcontainers.Configuration {
-	if ctx == nil {
-		ctx = context.Background()
+// Render returns the job run input and pod templates Execute would submit for
+// the run, without uploading the pod templates.
+func (emr *EMRExecutionEngine) Render(ctx context.Context, executable state.Executable, run state.Run, manager state.Manager) (RenderedRun, error) {
+	ctx, span := utils.TraceJob(ctx, "flotilla.job.emr_render", run.RunID)
+	// Rendering doesn't submit anything, its resource allocation isn't counted.
+	ctx = metrics.Mute(ctx)
+	defer span.Finish()
+	utils.TagJobRun(span, run)
+	run = emr.prepareRun(ctx, run, manager)
+
+	cluster, _ := emr.resolveCluster(ctx, run)
+	driver := emr.driverPod(ctx, executable, run, manager, cluster)
+	executor := emr.executorPod(ctx, executable, run, manager, cluster)
+	startJobRunInput, err := emr.generateEMRStartJobRunInput(ctx, run,
+		emr.podTemplatePath(emr.podTemplateKey(run, "driver-template")),
+		emr.podTemplatePath(emr.podTemplateKey(run, "executor-template")))
+	rendered := RenderedRun{
+		Run:          run,
+		PodTemplates: map[string]*v1.Pod{"driver": &driver, "executor": &executor},
+	}
+	if err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return rendered, err
+	}
+	rendered.StartJobRunInput = &startJobRunInput
+	return rendered, nil
+}
+
+// prepareRun estimates the resources of the run and resolves its service
+// account and node lifecycle.
+func (emr *EMRExecutionEngine) prepareRun(ctx context.Context, run state.Run, manager state.Manager) state.Run {
+	run = emr.estimateExecutorCount(run, manager)
+	run = emr.estimateMemoryResources(ctx, run, manager)
+
+	if run.ServiceAccount == nil || *run.ServiceAccount == "" {
+		run.ServiceAccount = aws.String(emr.emrJobSA)
+	}
+
+	if run.CommandHash != nil && run.NodeLifecycle != nil && *run.NodeLifecycle == state.SpotLifecycle {
+		nodeType, err := manager.GetNodeLifecycle(ctx, run.DefinitionID, *run.CommandHash)
+		if err == nil && nodeType == state.OndemandLifecycle {
+			run.NodeLifecycle = &state.OndemandLifecycle
+		}
 	}
+	return run
+}
+
+func (emr *EMRExecutionEngine) generateApplicationConf(run state.Run, driverTemplate *string, executorTemplate *string) []*emrcontainers.Configuration {
 	sparkDefaults := map[string]*string{
-		"spark.kubernetes.driver.podTemplateFile":   emr.driverPodTemplate(ctx, executable, run, manager, capabilities),
-		"spark.kubernetes.executor.podTemplateFile": emr.executorPodTemplate(ctx, executable, run, manager, capabilities),
+		"spark.kubernetes.driver.podTemplateFile":   driverTemplate,
+		"spark.kubernetes.executor.podTemplateFile": executorTemplate,
 		"spark.kubernetes.container.image":          &run.Image,
 		"spark.eventLog.dir":                        aws.String(fmt.Sprintf("s3://%s/%s", emr.s3LogsBucket, emr.s3EventLogPath)),
 		"spark.history.fs.logDirectory":             aws.String(fmt.Sprintf("s3://%s/%s", emr.s3LogsBucket, emr.s3EventLogPath)),
@@ -273,36 +308,37 @@ func emrContainersDefaultsConf() *emrcontainers.Configuration {
 	}
 }
 
-func (emr *EMRExecutionEngine) resolveCluster(ctx context.Context, run state.Run) (string, state.Capabilities, error) {
+func (emr *EMRExecutionEngine) resolveCluster(ctx context.Context, run state.Run) (state.ClusterMetadata, error) {
 	dbClusters, err := emr.stateManager.ListClusterStates(ctx)
 	if err != nil {
-		return "", nil, err
+		return state.ClusterMetadata{}, err
 	}
 	for _, cluster := range dbClusters {
 		if cluster.Namespace == emr.emrJobNamespace && cluster.Name == run.ClusterName {
 			if cluster.SparkServerURI != "" && run.SparkExtension != nil {
 				run.SparkExtension.SparkServerURI = aws.String(cluster.SparkServerURI)
 			}
-			return cluster.EMRVirtualCluster, cluster.Capabilities, nil
+			return cluster, nil
 		}
 	}
 	if id := emr.emrVirtualClusters[run.ClusterName]; id != "" {
-		return id, nil, nil
+		return state.ClusterMetadata{Name: run.ClusterName, EMRVirtualCluster: id}, nil
 	}
-	return "", nil, fmt.Errorf("EMR virtual cluster ID not found for EKS cluster: %s", run.ClusterName)
+	return state.ClusterMetadata{}, fmt.Errorf("EMR virtual cluster ID not found for EKS cluster: %s", run.ClusterName)
 }
 
-func (emr *EMRExecutionEngine) generateEMRStartJobRunInput(ctx context.Context, executable state.Executable, run state.Run, manager state.Manager, capabilities state.Capabilities) (emrcontainers.StartJobRunInput, error) {
+func (emr *EMRExecutionEngine) generateEMRStartJobRunInput(ctx context.Context, run state.Run, driverTemplate *string, executorTemplate *string) (emrcontainers.StartJobRunInput, error) {
 	roleArn := emr.emrJobRoleArn[*run.ServiceAccount]
 	if ctx == nil {
 		ctx = context.Background()
 	}
-	clusterID, _, err := emr.resolveCluster(ctx, run)
+	cluster, err := emr.resolveCluster(ctx, run)
 	if err != nil {
 		emr.log.Log("level", "error", "message", "failed to get clusters from database", "error", err.Error())
 		return emrcontainers.StartJobRunInput{}, err
 	}
 
+	clusterID := cluster.EMRVirtualCluster
 	if clusterID == "" {
 		return emrcontainers.StartJobRunInput{}, fmt.Errorf("EMR virtual cluster ID not found for EKS cluster: %s", run.ClusterName)
 	}
@@ -315,7 +351,7 @@ func (emr *EMRExecutionEngine) generateEMRStartJobRunInput(ctx context.Context,
 					LogUri: aws.String(fmt.Sprintf("s3://%s/%s", emr.s3LogsBucket, emr.s3LogsBasePath)),
 				},
 			},
-			ApplicationConfiguration: emr.generateApplicationConf(ctx, executable, run, manager, capabilities),
+			ApplicationConfiguration: emr.generateApplicationConf(run, driverTemplate, executorTemplate),
 		},
 		ExecutionRoleArn: &roleArn,
 		JobDriver: &emrcontainers.JobDriver{
@@ -382,7 +418,22 @@ func generateVolumesForCluster(clusterName string, isEmptyDir bool) ([]v1.Volume
 	return volumes, volumeMounts
 }
 
-func (emr *EMRExecutionEngine) driverPodTemplate(ctx context.Context, executable state.Executable, run state.Run, manager state.Manager, capabilities state.Capabilities) *string {
+// appendRunVolumes adds the volumes of the run to the volumes of its driver
+// and executor pods.
+func appendRunVolumes(run state.Run, volumes []v1.Volume, volumeMounts []v1.VolumeMount) ([]v1.Volume, []v1.VolumeMount) {
+	if run.Volumes == nil {
+		return volumes, volumeMounts
+	}
+	runVolumes, runMounts := run.Volumes.KubernetesVolumes()
+	return append(volumes, runVolumes...), append(volumeMounts, runMounts...)
+}
+
+func (emr *EMRExecutionEngine) driverPodTemplate(ctx context.Context, executable state.Executable, run state.Run, manager state.Manager, cluster state.ClusterMetadata) *string {
+	pod := emr.driverPod(ctx, executable, run, manager, cluster)
+	return emr.writeK8ObjToS3(&pod, emr.podTemplateKey(run, "driver-template"))
+}
+
+func (emr *EMRExecutionEngine) driverPod(ctx context.Context, executable state.Executable, run state.Run, manager state.Manager, cluster state.ClusterMetadata) v1.Pod {
 	if ctx == nil {
 		ctx = context.Background()
 	}
@@ -394,6 +445,7 @@ func (emr *EMRExecutionEngine) driverPodTemplate(ctx context.Context, executable
 	}
 
 	volumes, volumeMounts := generateVolumesForCluster(run.ClusterName, true)
+	volumes, volumeMounts = appendRunVolumes(run, volumes, volumeMounts)
 
 	podSpec := v1.PodSpec{
 		TerminationGracePeriodSeconds: aws.Int64(90),
@@ -415,8 +467,10 @@ func (emr *EMRExecutionEngine) driverPodTemplate(ctx context.Context, executable
 			Command:      emr.constructCmdSlice(run.SparkExtension.DriverInitCommand),
 		}},
 		RestartPolicy: v1.RestartPolicyNever,
-		Affinity:      emr.constructAffinity(ctx, executable, run, manager, true, capabilities),
-		Tolerations:   emr.constructTolerations(executable, run, true, capabilities),
+		Affinity:      emr.constructAffinity(ctx, executable, run, manager, true, cluster),
+		Tolerations:   emr.constructTolerations(executable, run, true, cluster),
+
+		TopologySpreadConstraints: cluster.Scheduling().TopologySpreadConstraints(run.RunID),
 	}
 
 	if emr.driverInstanceType != "" {
@@ -436,12 +490,15 @@ func (emr *EMRExecutionEngine) driverPodTemplate(ctx context.Context, executable
 		},
 		Spec: podSpec,
 	}
+	return pod
+}
 
-	key := aws.String(fmt.Sprintf("%s/%s/%s.yaml", emr.s3ManifestBasePath, run.RunID, "driver-template"))
-	return emr.writeK8ObjToS3(&pod, key)
+func (emr *EMRExecutionEngine) executorPodTemplate(ctx context.Context, executable state.Executable, run state.Run, manager state.Manager, cluster state.ClusterMetadata) *string {
+	pod := emr.executorPod(ctx, executable, run, manager, cluster)
+	return emr.writeK8ObjToS3(&pod, emr.podTemplateKey(run, "executor-template"))
 }
 
-func (emr *EMRExecutionEngine) executorPodTemplate(ctx context.Context, executable state.Executable, run state.Run, manager state.Manager, capabilities state.Capabilities) *string {
+func (emr *EMRExecutionEngine) executorPod(ctx context.Context, executable state.Executable, run state.Run, manager state.Manager, cluster state.ClusterMetadata) v1.Pod {
 	if ctx == nil {
 		ctx = context.Background()
 	}
@@ -454,6 +511,7 @@ func (emr *EMRExecutionEngine) executorPodTemplate(ctx context.Context, executab
 
 	// TODO Remove after migration
 	volumes, volumeMounts := generateVolumesForCluster(run.ClusterName, true)
+	volumes, volumeMounts = appendRunVolumes(run, volumes, volumeMounts)
 
 	pod := v1.Pod{
 		Status: v1.PodStatus{},
@@ -483,13 +541,22 @@ func (emr *EMRExecutionEngine) executorPodTemplate(ctx context.Context, executab
 				Command:      emr.constructCmdSlice(run.SparkExtension.ExecutorInitCommand),
 			}},
 			RestartPolicy: v1.RestartPolicyNever,
-			Affinity:      emr.constructAffinity(ctx, executable, run, manager, false, capabilities),
-			Tolerations:   emr.constructTolerations(executable, run, false, capabilities),
+			Affinity:      emr.constructAffinity(ctx, executable, run, manager, false, cluster),
+			Tolerations:   emr.constructTolerations(executable, run, false, cluster),
+
+			TopologySpreadConstraints: cluster.Scheduling().TopologySpreadConstraints(run.RunID),
 		},
 	}
 
-	key := aws.String(fmt.Sprintf("%s/%s/%s.yaml", emr.s3ManifestBasePath, run.RunID, "executor-template"))
-	return emr.writeK8ObjToS3(&pod, key)
+	return pod
+}
+
+func (emr *EMRExecutionEngine) podTemplateKey(run state.Run, name string) *string {
+	return aws.String(fmt.Sprintf("%s/%s/%s.yaml", emr.s3ManifestBasePath, run.RunID, name))
+}
+
+func (emr *EMRExecutionEngine) podTemplatePath(key *string) *string {
+	return aws.String(fmt.Sprintf("s3://%s/%s", emr.s3ManifestBucket, *key))
 }
 
 func (emr *EMRExecutionEngine) writeK8ObjToS3(obj runtime.Object, key *string) *string {
@@ -512,7 +579,7 @@ func (emr *EMRExecutionEngine) writeK8ObjToS3(obj runtime.Object, key *string) *
 		}
 	}
 
-	return aws.String(fmt.Sprintf("s3://%s/%s", emr.s3ManifestBucket, *key))
+	return emr.podTemplatePath(key)
 }
 
 func (emr *EMRExecutionEngine) writeStringToS3(key *string, body []byte) *string {
@@ -547,7 +614,9 @@ func (emr *EMRExecutionEngine) constructEviction(ctx context.Context, run state.
 	return "true"
 }
 
-func (emr *EMRExecutionEngine) constructTolerations(executable state.Executable, run state.Run, driver bool, capabilities state.Capabilities) []v1.Toleration {
+func (emr *EMRExecutionEngine) constructTolerations(executable state.Executable, run state.Run, driver bool, cluster state.ClusterMetadata) []v1.Toleration {
+	capabilities := cluster.Capabilities
+	policy := cluster.Scheduling()
 	tolerations := []v1.Toleration{}
 
 	tolerations = append(tolerations, v1.Toleration{
@@ -581,8 +650,8 @@ func (emr *EMRExecutionEngine) constructTolerations(executable state.Executable,
 				mem = execMem
 			}
 		}
-		size := state.PoolSize(cpu, mem)
-		routing := state.SharedPoolRouting(size)
+		size := policy.PoolSize(cpu, mem)
+		routing := policy.SharedPoolRouting(size)
 		tolerations = append(tolerations, routing.Tolerations...)
 	} else if team, ok := run.Labels["team"]; ok && team != "" {
 		tolerations = append(tolerations, v1.Toleration{
@@ -616,9 +685,9 @@ func (emr *EMRExecutionEngine) constructTolerations(executable state.Executable,
 					mem = execMem
 				}
 			}
-			size := state.PoolSize(cpu, mem)
+			size := policy.PoolSize(cpu, mem)
 			tolerations = append(tolerations, v1.Toleration{
-				Key:      "flotilla-pool",
+				Key:      policy.PoolKey,
 				Operator: "Equal",
 				Value:    size,
 				Effect:   "NoSchedule",
@@ -626,19 +695,21 @@ func (emr *EMRExecutionEngine) constructTolerations(executable state.Executable,
 		}
 	}
 
+	tolerations = append(tolerations, policy.Tolerations...)
 	return tolerations
 }
 
-func (emr *EMRExecutionEngine) constructAffinity(ctx context.Context, executable state.Executable, run state.Run, manager state.Manager, driver bool, capabilities state.Capabilities) *v1.Affinity {
+func (emr *EMRExecutionEngine) constructAffinity(ctx context.Context, executable state.Executable, run state.Run, manager state.Manager, driver bool, cluster state.ClusterMetadata) *v1.Affinity {
+	capabilities := cluster.Capabilities
+	policy := cluster.Scheduling()
 	affinity := &v1.Affinity{}
 	if ctx == nil {
 		ctx = context.Background()
 	}
 	var requiredMatch []v1.NodeSelectorRequirement
 	var preferredMatches []v1.PreferredSchedulingTerm
-	//todo move to config
-	nodeLifecycleKey := "karpenter.sh/capacity-type"
-	nodeArchKey := "kubernetes.io/arch"
+	nodeLifecycleKey := policy.CapacityTypeKey
+	nodeArchKey := policy.ArchKey
 
 	newCluster := true
 
@@ -699,8 +770,8 @@ func (emr *EMRExecutionEngine) constructAffinity(ctx context.Context, executable
 				mem = execMem
 			}
 		}
-		size := state.PoolSize(cpu, mem)
-		routing := state.SharedPoolRouting(size)
+		size := policy.PoolSize(cpu, mem)
+		routing := policy.SharedPoolRouting(size)
 		if routing.RequiredAffinity != nil {
 			requiredMatch = append(requiredMatch, *routing.RequiredAffinity)
 		}
@@ -709,7 +780,7 @@ func (emr *EMRExecutionEngine) constructAffinity(ctx context.Context, executable
 		}
 	} else if team, ok := run.Labels["team"]; ok && team != "" {
 		requiredMatch = append(requiredMatch, v1.NodeSelectorRequirement{
-			Key:      "team",
+			Key:      policy.TeamKey,
 			Operator: v1.NodeSelectorOpIn,
 			Values:   []string{team},
 		})
@@ -738,9 +809,9 @@ func (emr *EMRExecutionEngine) constructAffinity(ctx context.Context, executable
 					mem = execMem
 				}
 			}
-			size := state.PoolSize(cpu, mem)
+			size := policy.PoolSize(cpu, mem)
 			requiredMatch = append(requiredMatch, v1.NodeSelectorRequirement{
-				Key:      "flotilla-pool",
+				Key:      policy.PoolKey,
 				Operator: v1.NodeSelectorOpIn,
 				Values:   []string{size},
 			})
@@ -757,6 +828,9 @@ func (emr *EMRExecutionEngine) constructAffinity(ctx context.Context, executable
 		})
 	}
 
+	requiredMatch = append(requiredMatch, policy.RequiredTerms...)
+	preferredMatches = append(preferredMatches, policy.PreferredTerms...)
+
 	preferredMatches = append(preferredMatches, v1.PreferredSchedulingTerm{
 		Weight: 50,
 		Preference: v1.NodeSelectorTerm{
@@ -917,10 +991,11 @@ func setResourceSuffix(value string) string {
 }
 
 func (emr *EMRExecutionEngine) estimateMemoryResources(ctx context.Context, run state.Run, manager state.Manager) state.Run {
+	m := metrics.For(ctx)
 	// Early return for NULL command_hash
 	if run.CommandHash == nil {
 		metricTags := emr.buildMetricTags(run)
-		_ = metrics.Increment(metrics.EngineEKSARANullCommandHash, metricTags, 1)
+		_ = m.Increment(metrics.EngineEKSARANullCommandHash, metricTags, 1)
 		if emr.log != nil {
 			_ = emr.log.Log(
 				"level", "warn",
@@ -940,7 +1015,7 @@ func (emr *EMRExecutionEngine) estimateMemoryResources(ctx context.Context, run
 	metricTags := emr.buildMetricTags(run)
 
 	// Track adjustment attempt
-	_ = metrics.Increment(metrics.EngineEKSARAEstimationAttempted, metricTags, 1)
+	_ = m.Increment(metrics.EngineEKSARAEstimationAttempted, metricTags, 1)
 
 	// Query for OOMs
 	executorOOM, executorErr := manager.ExecutorOOM(ctx, run.DefinitionID, *run.CommandHash)
@@ -951,14 +1026,14 @@ func (emr *EMRExecutionEngine) estimateMemoryResources(ctx context.Context, run
 		var missingResource exceptions.MissingResource
 		if errors.As(executorErr, &missingResource) || errors.As(driverErr, &missingResource) {
 			// No historical data - expected for new jobs
-			_ = metrics.Increment(metrics.EngineEKSARANoHistoricalData, metricTags, 1)
+			_ = m.Increment(metrics.EngineEKSARANoHistoricalData, metricTags, 1)
 		} else {
 			// Query failed with real error
-			_ = metrics.Increment(metrics.EngineEKSARAEstimationFailed, metricTags, 1)
+			_ = m.Increment(metrics.EngineEKSARAEstimationFailed, metricTags, 1)
 		}
 	} else {
 		// Query succeeded
-		_ = metrics.Increment(metrics.EngineEKSARAEstimationSucceeded, metricTags, 1)
+		_ = m.Increment(metrics.EngineEKSARAEstimationSucceeded, metricTags, 1)
 	}
 
 	var sparkSubmitConf []state.Conf
@@ -975,12 +1050,12 @@ func (emr *EMRExecutionEngine) estimateMemoryResources(ctx context.Context, run
 
 				// Emit metrics with component:executor tag
 				executorTags := append(metricTags, "component:executor")
-				_ = metrics.Increment(metrics.EngineEKSARAResourceAdjustment, executorTags, 1)
-				_ = metrics.Histogram(metrics.EngineEKSARAMemoryIncreaseRatio, 1.25, executorTags, 1)
-				_ = metrics.Distribution(metrics.EngineEKSARADefaultMemory, float64(originalMB), executorTags, 1)
-				_ = metrics.Distribution(metrics.EngineEKSARAARAMemory, float64(adjustedMB), executorTags, 1)
+				_ = m.Increment(metrics.EngineEKSARAResourceAdjustment, executorTags, 1)
+				_ = m.Histogram(metrics.EngineEKSARAMemoryIncreaseRatio, 1.25, executorTags, 1)
+				_ = m.Distribution(metrics.EngineEKSARADefaultMemory, float64(originalMB), executorTags, 1)
+				_ = m.Distribution(metrics.EngineEKSARAARAMemory, float64(adjustedMB), executorTags, 1)
 				increaseMB := adjustedMB - originalMB
-				_ = metrics.Distribution(metrics.EngineEKSARAMemoryIncrease, float64(increaseMB), executorTags, 1)
+				_ = m.Distribution(metrics.EngineEKSARAMemoryIncrease, float64(increaseMB), executorTags, 1)
 
 				// Log executor adjustment
 				if emr.log != nil {
@@ -1018,12 +1093,12 @@ func (emr *EMRExecutionEngine) estimateMemoryResources(ctx context.Context, run
 
 				// Emit metrics with component:driver tag
 				driverTags := append(metricTags, "component:driver")
-				_ = metrics.Increment(metrics.EngineEKSARAResourceAdjustment, driverTags, 1)
-				_ = metrics.Histogram(metrics.EngineEKSARAMemoryIncreaseRatio, 3.0, driverTags, 1)
-				_ = metrics.Distribution(metrics.EngineEKSARADefaultMemory, float64(originalMB), driverTags, 1)
-				_ = metrics.Distribution(metrics.EngineEKSARAARAMemory, float64(adjustedMB), driverTags, 1)
+				_ = m.Increment(metrics.EngineEKSARAResourceAdjustment, driverTags, 1)
+				_ = m.Histogram(metrics.EngineEKSARAMemoryIncreaseRatio, 3.0, driverTags, 1)
+				_ = m.Distribution(metrics.EngineEKSARADefaultMemory, float64(originalMB), driverTags, 1)
+				_ = m.Distribution(metrics.EngineEKSARAARAMemory, float64(adjustedMB), driverTags, 1)
 				increaseMB := adjustedMB - originalMB
-				_ = metrics.Distribution(metrics.EngineEKSARAMemoryIncrease, float64(increaseMB), driverTags, 1)
+				_ = m.Distribution(metrics.EngineEKSARAMemoryIncrease, float64(increaseMB), driverTags, 1)
 
 				// Log driver adjustment
 				if emr.log != nil {
@@ -1083,7 +1158,7 @@ func (emr *EMRExecutionEngine) sparkSubmitParams(run state.Run) *string {
 }
 
 func (emr *EMRExecutionEngine) Terminate(ctx context.Context, run state.Run) error {
-	var span tracer.Span
+	var span tracing.Span
 	if ctx == nil {
 		ctx = context.Background()
 	}
@@ -1107,6 +1182,12 @@ func (emr *EMRExecutionEngine) Terminate(ctx context.Context, run state.Run) err
 		emr.writeStringToS3(key, obj)
 	}
 
+	// CancelJobRun takes no grace period nor signal, job runs are cancelled
+	// right away; the stop is only recorded.
+	if run.Stop != nil {
+		_ = emr.log.Log("level", "info", "message", "cancelling EMR job run", "run_id", run.RunID,
+			"by", run.Stop.By, "reason", run.Stop.Reason)
+	}
 	_, err = emr.emrContainersClient.CancelJobRun(&cancelJobRunInput)
 	if err != nil {
 		_ = metrics.Increment(metrics.EngineEMRTerminate, []string{string(metrics.StatusFailure), tierTag}, 1)
@@ -1118,7 +1199,7 @@ func (emr *EMRExecutionEngine) Terminate(ctx context.Context, run state.Run) err
 }
 
 func (emr *EMRExecutionEngine) Enqueue(ctx context.Context, run state.Run) error {
-	var span tracer.Span
+	var span tracing.Span
 	ctx, span = utils.TraceJob(ctx, "flotilla.job.emr_enqueue", "")
 	defer span.Finish()
 	span.SetTag("job.run_id", run.RunID)
@@ -1164,12 +1245,7 @@ func (emr *EMRExecutionEngine) PollRuns(ctx context.Context) ([]RunReceipt, erro
 			continue
 		}
 
-		runs = append(runs, RunReceipt{
-			RunReceipt:       runReceipt,
-			TraceID:          runReceipt.TraceID,
-			ParentID:         runReceipt.ParentID,
-			SamplingPriority: runReceipt.SamplingPriority,
-		})
+		runs = append(runs, RunReceipt{RunReceipt: runReceipt})
 	}
 	return runs, nil
 }
@@ -1198,7 +1274,7 @@ func (emr *EMRExecutionEngine) Get(ctx context.Context, run state.Run) (state.Ru
 }
 
 func (emr *EMRExecutionEngine) GetEvents(ctx context.Context, run state.Run) (state.PodEventList, error) {
-	var span tracer.Span
+	var span tracing.Span
 	if ctx == nil {
 		ctx = context.Background()
 	}
@@ -1210,7 +1286,7 @@ func (emr *EMRExecutionEngine) GetEvents(ctx context.Context, run state.Run) (st
 }
 
 func (emr *EMRExecutionEngine) FetchPodMetrics(ctx context.Context, run state.Run) (state.Run, error) {
-	var span tracer.Span
+	var span tracing.Span
 	if ctx == nil {
 		ctx = context.Background()
 	}
@@ -1222,7 +1298,7 @@ func (emr *EMRExecutionEngine) FetchPodMetrics(ctx context.Context, run state.Ru
 }
 
 func (emr *EMRExecutionEngine) FetchUpdateStatus(ctx context.Context, run state.Run) (state.Run, error) {
-	var span tracer.Span
+	var span tracing.Span
 	if ctx == nil {
 		ctx = context.Background()
 	}
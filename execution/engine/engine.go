@@ -3,17 +3,22 @@ package engine
 import (
 	"context"
 	"fmt"
+	"github.com/aws/aws-sdk-go/service/emrcontainers"
 	"github.com/pkg/errors"
 	"github.com/stitchfix/flotilla-os/config"
 	"github.com/stitchfix/flotilla-os/log"
 	"github.com/stitchfix/flotilla-os/queue"
 	"github.com/stitchfix/flotilla-os/state"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 )
 
 // Engine defines the execution engine interface.
 type Engine interface {
 	Initialize(conf config.Config) error
 	Execute(ctx context.Context, executable state.Executable, run state.Run, manager state.Manager) (state.Run, bool, error)
+	Render(ctx context.Context, executable state.Executable, run state.Run, manager state.Manager) (RenderedRun, error)
 	Terminate(ctx context.Context, run state.Run) error
 	Enqueue(ctx context.Context, run state.Run) error
 	PollRuns(ctx context.Context) ([]RunReceipt, error)
@@ -27,21 +32,32 @@ type Engine interface {
 	Deregister(ctx context.Context, definition state.Definition) error
 }
 
+// RenderedRun is what Execute would submit for a run, it is returned by dry
+// runs without submitting or uploading anything.
+type RenderedRun struct {
+	Run              state.Run                       `json:"run"`
+	Job              *batchv1.Job                    `json:"job,omitempty"`
+	StartJobRunInput *emrcontainers.StartJobRunInput `json:"start_job_run_input,omitempty"`
+	PodTemplates     map[string]*v1.Pod              `json:"pod_templates,omitempty"`
+	Service          *v1.Service                     `json:"service,omitempty"`
+	PortsService     *v1.Service                     `json:"ports_service,omitempty"`
+	Ingress          *networkingv1.Ingress           `json:"ingress,omitempty"`
+}
+
 type RunReceipt struct {
 	queue.RunReceipt
-	TraceID          uint64
-	ParentID         uint64
-	SamplingPriority int
 }
 
-// NewExecutionEngine initializes and returns a new Engine
-func NewExecutionEngine(conf config.Config, qm queue.Manager, name string, logger log.Logger, clusterManager *DynamicClusterManager, stateManager state.Manager) (Engine, error) {
+// NewExecutionEngine initializes and returns a new Engine, following the
+// settings which can be changed at runtime.
+func NewExecutionEngine(conf config.Config, qm queue.Manager, name string, logger log.Logger, clusterManager *DynamicClusterManager, stateManager state.Manager, settings *state.Settings) (Engine, error) {
 	switch name {
 	case state.EKSEngine:
 		eksEng := &EKSExecutionEngine{qm: qm, log: logger, clusterManager: clusterManager, stateManager: stateManager}
 		if err := eksEng.Initialize(conf); err != nil {
 			return nil, errors.Wrap(err, "problem initializing EKSExecutionEngine")
 		}
+		eksEng.subscribe(settings)
 		return eksEng, nil
 	case state.EKSSparkEngine:
 		emrEng := &EMRExecutionEngine{sqsQueueManager: qm, log: logger, clusterManager: clusterManager, stateManager: stateManager}
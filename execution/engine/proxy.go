@@ -0,0 +1,15 @@
+package engine
+
+import (
+	"net/http"
+
+	"github.com/stitchfix/flotilla-os/state"
+)
+
+// PortProxy is implemented by the engines able to proxy requests to the
+// ports exposed by their runs.
+type PortProxy interface {
+	// ProxyPort returns a handler proxying requests to the port of the run,
+	// stripping prefix from their path.
+	ProxyPort(run state.Run, port int, prefix string) (http.Handler, error)
+}
@@ -6,13 +6,19 @@ import (
 	"github.com/stitchfix/flotilla-os/queue"
 	"github.com/stitchfix/flotilla-os/utils"
 	"net/http"
+	"os"
+	"os/signal"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/rs/cors"
+	"github.com/stitchfix/flotilla-os/clients/artifacts"
 	"github.com/stitchfix/flotilla-os/clients/cluster"
 	"github.com/stitchfix/flotilla-os/clients/logs"
+	"github.com/stitchfix/flotilla-os/clients/registry"
 	"github.com/stitchfix/flotilla-os/config"
 	"github.com/stitchfix/flotilla-os/execution/engine"
 	flotillaLog "github.com/stitchfix/flotilla-os/log"
@@ -30,9 +36,20 @@ type App struct {
 	writeTimeout       time.Duration
 	handler            http.Handler
 	workerManager      worker.Worker
+	settings           *state.Settings
+	settingsInterval   time.Duration
+	readiness          *readiness
+	shutdownDelay      time.Duration
+	shutdownTimeout    time.Duration
 }
 
-// Start the Application.
+// readiness is whether the instance takes API requests, until it drains.
+type readiness struct {
+	draining atomic.Bool
+}
+
+// Start the Application. It runs until it gets SIGTERM or SIGINT, then drains
+// and returns nil once the API and the workers are done.
 func (app *App) Run() error {
 	srv := &http.Server{
 		Addr:         app.address,
@@ -40,13 +57,59 @@ func (app *App) Run() error {
 		ReadTimeout:  app.readTimeout,
 		WriteTimeout: app.writeTimeout,
 	}
+	// Follow the changes of the settings made by the other instances.
+	go app.settings.Watch(context.Background(), app.settingsInterval)
 	// Start worker manager's run goroutine.
 	app.workerManager.GetTomb().Go(func() error {
 		ctx, span := utils.TraceJob(context.Background(), "worker_manager.run", "startup")
 		defer span.Finish()
 		return app.workerManager.Run(ctx)
 	})
-	return srv.ListenAndServe()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(signals)
+
+	select {
+	case err := <-serveErr:
+		return err
+	case sig := <-signals:
+		_ = app.logger.Log("level", "info", "message", "Draining", "signal", sig.String())
+	}
+	return app.drain(srv)
+}
+
+// drain shuts the instance down within `shutdown_timeout_seconds`. The
+// workers stop polling right away and finish their in-flight submits and
+// status updates, while readiness fails for `http_server_shutdown_delay_seconds`
+// so load balancers stop sending requests before the server stops accepting
+// them and finishes the in-flight ones.
+func (app *App) drain(srv *http.Server) error {
+	ctx, cancel := context.WithTimeout(context.Background(), app.shutdownTimeout)
+	defer cancel()
+
+	workers := app.workerManager.GetTomb()
+	workers.Kill(nil)
+	app.readiness.draining.Store(true)
+	select {
+	case <-time.After(app.shutdownDelay):
+	case <-ctx.Done():
+	}
+
+	if err := srv.Shutdown(ctx); err != nil {
+		return errors.Wrap(err, "problem draining the http server")
+	}
+	select {
+	case <-workers.Dead():
+	case <-ctx.Done():
+		return errors.New("workers didn't drain before the shutdown timeout")
+	}
+	_ = app.logger.Log("level", "info", "message", "Drained")
+	return nil
 }
 
 // Function to initialize a new Flotilla app.
@@ -61,12 +124,16 @@ func NewApp(conf config.Config,
 	emrQueueManager queue.Manager,
 	middlewareClient middleware.Client,
 	clusterManager *engine.DynamicClusterManager,
+	registryClient registry.Client,
+	settings *state.Settings,
 ) (App, error) {
 	var app App
 	app.logger = log
+	app.settings = settings
+	app.readiness = &readiness{}
 	app.configure(conf)
 
-	executionService, err := services.NewExecutionService(conf, eksExecutionEngine, stateManager, eksClusterClient, emrExecutionEngine)
+	executionService, err := services.NewExecutionService(conf, eksExecutionEngine, stateManager, eksClusterClient, emrExecutionEngine, registryClient, settings)
 	if err != nil {
 		return app, errors.Wrap(err, "problem initializing execution service")
 	}
@@ -78,19 +145,49 @@ func NewApp(conf config.Config,
 	if err != nil {
 		return app, errors.Wrap(err, "problem initializing eks log service")
 	}
+	artifactsClient, err := artifacts.NewArtifactsClient(conf, log)
+	if err != nil {
+		return app, errors.Wrap(err, "problem initializing artifacts client")
+	}
+	artifactService, err := services.NewArtifactService(stateManager, artifactsClient)
+	if err != nil {
+		return app, errors.Wrap(err, "problem initializing artifact service")
+	}
+	debugService, err := services.NewDebugService(conf, stateManager, eksExecutionEngine)
+	if err != nil {
+		return app, errors.Wrap(err, "problem initializing debug service")
+	}
 	workerService, err := services.NewWorkerService(conf, stateManager)
 	if err != nil {
 		return app, errors.Wrap(err, "problem initializing worker service")
 	}
-	definitionService, err := services.NewDefinitionService(stateManager)
+	definitionService, err := services.NewDefinitionService(conf, stateManager, registryClient)
 	if err != nil {
 		return app, errors.Wrap(err, "problem initializing definition service")
 	}
+	bundleService, err := services.NewBundleService(conf, stateManager, registryClient)
+	if err != nil {
+		return app, errors.Wrap(err, "problem initializing bundle service")
+	}
+	settingsService, err := services.NewSettingsService(conf, stateManager, settings)
+	if err != nil {
+		return app, errors.Wrap(err, "problem initializing settings service")
+	}
+	analyticsService, err := services.NewAnalyticsService(conf, stateManager)
+	if err != nil {
+		return app, errors.Wrap(err, "problem initializing analytics service")
+	}
 	ep := endpoints{
 		executionService:  executionService,
 		eksLogService:     eksLogService,
+		artifactService:   artifactService,
+		debugService:      debugService,
 		workerService:     workerService,
+		bundleService:     bundleService,
+		settingsService:   settingsService,
+		analyticsService:  analyticsService,
 		templateService:   templateService,
+		readiness:         app.readiness,
 		logger:            log,
 		middlewareClient:  middlewareClient,
 		definitionService: definitionService,
@@ -121,6 +218,23 @@ func (app *App) configure(conf config.Config) {
 	app.readTimeout = time.Duration(readTimeout) * time.Second
 	app.writeTimeout = time.Duration(writeTimeout) * time.Second
 
+	settingsInterval := conf.GetInt("settings_refresh_interval_seconds")
+	if settingsInterval <= 0 {
+		settingsInterval = 15
+	}
+	app.settingsInterval = time.Duration(settingsInterval) * time.Second
+
+	shutdownDelay := 5
+	if conf.IsSet("http_server_shutdown_delay_seconds") {
+		shutdownDelay = conf.GetInt("http_server_shutdown_delay_seconds")
+	}
+	shutdownTimeout := conf.GetInt("shutdown_timeout_seconds")
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = 30
+	}
+	app.shutdownDelay = time.Duration(shutdownDelay) * time.Second
+	app.shutdownTimeout = time.Duration(shutdownTimeout) * time.Second
+
 	app.mode = conf.GetString("flotilla_mode")
 	app.corsAllowedOrigins = strings.Split(conf.GetString("http_server_cors_allowed_origins"), ",")
 }
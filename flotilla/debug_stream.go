@@ -0,0 +1,142 @@
+package flotilla
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stitchfix/flotilla-os/execution/engine"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// Channels of the debug exec websocket protocol; each binary message starts
+// with the byte of its channel.
+const (
+	debugChannelStdin  = byte(0)
+	debugChannelStdout = byte(1)
+	debugChannelStderr = byte(2)
+	debugChannelError  = byte(3)
+	debugChannelResize = byte(4)
+)
+
+var debugUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+}
+
+// debugStream bridges the websocket of a client to the streams of an exec
+// into a debug session. Clients send stdin on channel 0 and terminal sizes,
+// as {"Width": w, "Height": h}, on channel 4; stdout, stderr and the error
+// ending the exec are sent back on channels 1, 2 and 3.
+type debugStream struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+	stdin   *io.PipeWriter
+	sizes   chan remotecommand.TerminalSize
+}
+
+// upgradeDebugStream upgrades the request to the websocket of an exec.
+func upgradeDebugStream(w http.ResponseWriter, r *http.Request) (*debugStream, error) {
+	conn, err := debugUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Execs outlive the server's read and write timeouts.
+	_ = conn.NetConn().SetDeadline(time.Time{})
+	return &debugStream{conn: conn, sizes: make(chan remotecommand.TerminalSize, 1)}, nil
+}
+
+// streams returns the streams of the exec, reading the client's messages
+// until it goes away, which cancels the returned context.
+func (ds *debugStream) streams(ctx context.Context, tty bool) (engine.DebugStreams, context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	stdin, stdinWriter := io.Pipe()
+	ds.stdin = stdinWriter
+	go ds.read(cancel)
+
+	streams := engine.DebugStreams{
+		Stdin:  stdin,
+		Stdout: debugChannelWriter{ds, debugChannelStdout},
+		Stderr: debugChannelWriter{ds, debugChannelStderr},
+		TTY:    tty,
+	}
+	if tty {
+		streams.Resize = ds
+	}
+	return streams, ctx, cancel
+}
+
+func (ds *debugStream) read(cancel context.CancelFunc) {
+	defer cancel()
+	defer close(ds.sizes)
+	defer ds.stdin.Close()
+	for {
+		_, message, err := ds.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if len(message) == 0 {
+			continue
+		}
+		switch message[0] {
+		case debugChannelStdin:
+			if _, err = ds.stdin.Write(message[1:]); err != nil {
+				return
+			}
+		case debugChannelResize:
+			var size remotecommand.TerminalSize
+			if json.Unmarshal(message[1:], &size) != nil {
+				continue
+			}
+			// Only the latest size matters.
+			select {
+			case <-ds.sizes:
+			default:
+			}
+			ds.sizes <- size
+		}
+	}
+}
+
+// Next returns the next terminal size of the client, nil once it's gone.
+func (ds *debugStream) Next() *remotecommand.TerminalSize {
+	size, ok := <-ds.sizes
+	if !ok {
+		return nil
+	}
+	return &size
+}
+
+func (ds *debugStream) write(channel byte, p []byte) error {
+	ds.writeMu.Lock()
+	defer ds.writeMu.Unlock()
+	return ds.conn.WriteMessage(websocket.BinaryMessage, append([]byte{channel}, p...))
+}
+
+// close ends the stream, sending the error the exec ended with if any.
+func (ds *debugStream) close(err error) {
+	if err != nil {
+		_ = ds.write(debugChannelError, []byte(err.Error()))
+	}
+	ds.writeMu.Lock()
+	_ = ds.conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	ds.writeMu.Unlock()
+	_ = ds.conn.Close()
+}
+
+type debugChannelWriter struct {
+	stream  *debugStream
+	channel byte
+}
+
+func (w debugChannelWriter) Write(p []byte) (int, error) {
+	if err := w.stream.write(w.channel, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -3,14 +3,19 @@ package flotilla
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/stitchfix/flotilla-os/clients/logs"
 	"github.com/stitchfix/flotilla-os/clients/middleware"
 	"github.com/stitchfix/flotilla-os/exceptions"
+	"github.com/stitchfix/flotilla-os/execution/engine"
 	flotillaLog "github.com/stitchfix/flotilla-os/log"
 	"github.com/stitchfix/flotilla-os/services"
 	"github.com/stitchfix/flotilla-os/state"
@@ -22,8 +27,14 @@ type endpoints struct {
 	definitionService services.DefinitionService
 	templateService   services.TemplateService
 	eksLogService     services.LogService
+	artifactService   services.ArtifactService
+	debugService      services.DebugService
 	workerService     services.WorkerService
+	bundleService     services.BundleService
+	settingsService   services.SettingsService
+	analyticsService  services.AnalyticsService
 	middlewareClient  middleware.Client
+	readiness         *readiness
 	logger            flotillaLog.Logger
 }
 
@@ -500,16 +511,75 @@ func (ep *endpoints) CreateRunV4(w http.ResponseWriter, r *http.Request) {
 		ep.encodeError(w, exceptions.MalformedInput{ErrorString: err.Error()})
 		return
 	}
-	err = ep.middlewareClient.AnnotateLaunchRequest(&r.Header, &lr)
+	req, err := ep.definitionExecutionRequestV4(r, &lr)
 	if err != nil {
 		ep.encodeError(w, err)
 		return
 	}
-	if len(lr.RunTags.OwnerID) == 0 {
-		ep.encodeError(w, exceptions.MalformedInput{
-			ErrorString: fmt.Sprintf("run_tags must exist in body and contain [owner_id]")})
+	vars := mux.Vars(r)
+
+	if lr.DryRun || ep.isDryRun(r) {
+		rendered, err := ep.executionService.RenderDefinitionRunByDefinitionID(r.Context(), vars["definition_id"], &req)
+		ep.encodeRenderedRun(w, "CreateRunV4", rendered, err)
+		return
+	}
+
+	run, err := ep.executionService.CreateDefinitionRunByDefinitionID(r.Context(), vars["definition_id"], &req)
+	if err != nil {
+		ep.logger.Log(
+			"level", "error",
+			"message", "problem creating V4 run",
+			"operation", "CreateRunV4",
+			"error", fmt.Sprintf("%+v", err))
+		ep.encodeError(w, err)
+	} else {
+		ep.encodeResponse(w, run)
+	}
+}
+
+// Creates an array run of a definition, with a child run per parameter set.
+func (ep *endpoints) CreateArrayRun(w http.ResponseWriter, r *http.Request) {
+	var alr state.ArrayLaunchRequest
+	err := ep.decodeRequest(r, &alr)
+	if err != nil {
+		ep.encodeError(w, exceptions.MalformedInput{ErrorString: err.Error()})
 		return
 	}
+	if alr.DryRun || ep.isDryRun(r) {
+		ep.encodeError(w, exceptions.MalformedInput{ErrorString: "dry_run is not supported for array runs"})
+		return
+	}
+	req, err := ep.definitionExecutionRequestV4(r, &alr.LaunchRequestV2)
+	if err != nil {
+		ep.encodeError(w, err)
+		return
+	}
+	vars := mux.Vars(r)
+
+	run, err := ep.executionService.CreateDefinitionArrayRun(r.Context(), vars["definition_id"], &req, alr.Array)
+	if err != nil {
+		ep.logger.Log(
+			"level", "error",
+			"message", "problem creating array run",
+			"operation", "CreateArrayRun",
+			"error", fmt.Sprintf("%+v", err))
+		ep.encodeError(w, err)
+	} else {
+		ep.encodeResponse(w, run)
+	}
+}
+
+// definitionExecutionRequestV4 validates a V4 launch request and converts it
+// into a definition execution request.
+func (ep *endpoints) definitionExecutionRequestV4(r *http.Request, lr *state.LaunchRequestV2) (state.DefinitionExecutionRequest, error) {
+	err := ep.middlewareClient.AnnotateLaunchRequest(&r.Header, lr)
+	if err != nil {
+		return state.DefinitionExecutionRequest{}, err
+	}
+	if len(lr.RunTags.OwnerID) == 0 {
+		return state.DefinitionExecutionRequest{}, exceptions.MalformedInput{
+			ErrorString: fmt.Sprintf("run_tags must exist in body and contain [owner_id]")}
+	}
 	if lr.Engine == nil {
 		if lr.SparkExtension != nil {
 			lr.Engine = &state.EKSSparkEngine
@@ -520,15 +590,13 @@ func (ep *endpoints) CreateRunV4(w http.ResponseWriter, r *http.Request) {
 
 	if lr.NodeLifecycle != nil {
 		if !utils.StringSliceContains(state.NodeLifeCycles, *lr.NodeLifecycle) {
-			ep.encodeError(w, exceptions.MalformedInput{
-				ErrorString: fmt.Sprintf("Nodelifecyle must be [normal, spot]")})
-			return
+			return state.DefinitionExecutionRequest{}, exceptions.MalformedInput{
+				ErrorString: fmt.Sprintf("Nodelifecyle must be [normal, spot]")}
 		}
 	} else {
 		lr.NodeLifecycle = &state.DefaultLifecycle
 	}
-	vars := mux.Vars(r)
-	req := state.DefinitionExecutionRequest{
+	return state.DefinitionExecutionRequest{
 		ExecutionRequestCommon: &state.ExecutionRequestCommon{
 			Env:                   lr.Env,
 			OwnerID:               lr.RunTags.OwnerID,
@@ -548,20 +616,10 @@ func (ep *endpoints) CreateRunV4(w http.ResponseWriter, r *http.Request) {
 			Labels:                lr.Labels,
 			ServiceAccount:        lr.ServiceAccount,
 			Tier:                  lr.Tier,
+			Replicas:              lr.Replicas,
+			Volumes:               lr.Volumes,
 		},
-	}
-
-	run, err := ep.executionService.CreateDefinitionRunByDefinitionID(r.Context(), vars["definition_id"], &req)
-	if err != nil {
-		ep.logger.Log(
-			"level", "error",
-			"message", "problem creating V4 run",
-			"operation", "CreateRunV4",
-			"error", fmt.Sprintf("%+v", err))
-		ep.encodeError(w, err)
-	} else {
-		ep.encodeResponse(w, run)
-	}
+	}, nil
 }
 
 // Creates a new Run based on definition alias.
@@ -624,8 +682,15 @@ func (ep *endpoints) CreateRunByAlias(w http.ResponseWriter, r *http.Request) {
 			Labels:                lr.Labels,
 			ServiceAccount:        lr.ServiceAccount,
 			Tier:                  lr.Tier,
+			Replicas:              lr.Replicas,
+			Volumes:               lr.Volumes,
 		},
 	}
+	if lr.DryRun || ep.isDryRun(r) {
+		rendered, err := ep.executionService.RenderDefinitionRunByAlias(r.Context(), vars["alias"], &req)
+		ep.encodeRenderedRun(w, "CreateRunByAlias", rendered, err)
+		return
+	}
 	run, err := ep.executionService.CreateDefinitionRunByAlias(r.Context(), vars["alias"], &req)
 	if err != nil {
 		ep.logger.Log(
@@ -643,8 +708,13 @@ func (ep *endpoints) CreateRunByAlias(w http.ResponseWriter, r *http.Request) {
 // Stops a run based on run ID.
 func (ep *endpoints) StopRun(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
+	var req state.StopRequest
+	if err := ep.decodeStopRequest(r, &req, &req); err != nil {
+		ep.encodeError(w, err)
+		return
+	}
 	userInfo := ep.ExtractUserInfo(r)
-	err := ep.executionService.Terminate(r.Context(), vars["run_id"], userInfo)
+	err := ep.executionService.Terminate(r.Context(), vars["run_id"], userInfo, req)
 	if err != nil {
 		ep.logger.Log(
 			"level", "error",
@@ -652,10 +722,71 @@ func (ep *endpoints) StopRun(w http.ResponseWriter, r *http.Request) {
 			"operation", "StopRun",
 			"error", fmt.Sprintf("%+v", err),
 			"run_id", vars["run_id"])
+		if _, ok := err.(exceptions.MalformedInput); ok {
+			ep.encodeError(w, err)
+			return
+		}
 	}
 	ep.encodeResponse(w, map[string]bool{"terminated": true})
 }
 
+// Stop all the runs matching the filters of the query, as for ListRuns. Dry
+// runs only list the runs which would be stopped.
+func (ep *endpoints) BulkStopRuns(w http.ResponseWriter, r *http.Request) {
+	var req state.BulkStopRequest
+	if err := ep.decodeStopRequest(r, &req, &req.StopRequest); err != nil {
+		ep.encodeError(w, err)
+		return
+	}
+	params := r.URL.Query()
+	if dryRun, ok := params["dry_run"]; ok && len(dryRun) > 0 {
+		req.DryRun, _ = strconv.ParseBool(dryRun[0])
+	}
+	filters, envFilters := ep.getFilters(params, map[string]bool{
+		"dry_run":              true,
+		"reason":               true,
+		"grace_period_seconds": true,
+		"signal":               true,
+	})
+
+	userInfo := ep.ExtractUserInfo(r)
+	result, err := ep.executionService.BulkTerminate(r.Context(), filters, envFilters, userInfo, req)
+	if err != nil {
+		ep.logger.Log(
+			"level", "error",
+			"message", "problem stopping runs",
+			"operation", "BulkStopRuns",
+			"error", fmt.Sprintf("%+v", err))
+		ep.encodeError(w, err)
+		return
+	}
+	ep.encodeResponse(w, result)
+}
+
+// decodeStopRequest decodes the optional body of requests stopping runs.
+// Clients unable to send bodies along with DELETEs can give the request as
+// query parameters instead.
+func (ep *endpoints) decodeStopRequest(r *http.Request, req interface{}, stop *state.StopRequest) error {
+	if err := ep.decodeRequest(r, req); err != nil && err != io.EOF {
+		return exceptions.MalformedInput{ErrorString: err.Error()}
+	}
+	params := r.URL.Query()
+	if reason := params.Get("reason"); len(reason) > 0 {
+		stop.Reason = reason
+	}
+	if signal := params.Get("signal"); len(signal) > 0 {
+		stop.Signal = signal
+	}
+	if gracePeriod := params.Get("grace_period_seconds"); len(gracePeriod) > 0 {
+		seconds, err := strconv.ParseInt(gracePeriod, 10, 64)
+		if err != nil {
+			return exceptions.MalformedInput{ErrorString: fmt.Sprintf("invalid grace_period_seconds [%s]", gracePeriod)}
+		}
+		stop.GracePeriodSeconds = &seconds
+	}
+	return nil
+}
+
 // Extracts user info if present in the headers.s
 func (ep *endpoints) ExtractUserInfo(r *http.Request) state.UserInfo {
 	var userInfo state.UserInfo
@@ -736,6 +867,11 @@ func (ep *endpoints) GetLogs(w http.ResponseWriter, r *http.Request) {
 	run, err := ep.executionService.Get(r.Context(), vars["run_id"])
 	role := ep.getURLParam(params, "role", "driver")
 	facility := ep.getURLParam(params, "facility", "stderr")
+	replica, replicaErr := ep.decodeReplica(params)
+	if replicaErr != nil {
+		ep.encodeError(w, replicaErr)
+		return
+	}
 
 	if err != nil {
 		_ = ep.logger.Log(
@@ -752,9 +888,9 @@ func (ep *endpoints) GetLogs(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if rawText == true {
-		_ = ep.eksLogService.LogsText(vars["run_id"], w)
+		_ = ep.eksLogService.LogsText(vars["run_id"], replica, w)
 	} else {
-		log, newLastSeen, err := ep.eksLogService.Logs(vars["run_id"], &lastSeen, &role, &facility)
+		log, newLastSeen, err := ep.eksLogService.Logs(vars["run_id"], &lastSeen, &role, &facility, replica)
 
 		res := map[string]string{
 			"log":       "",
@@ -772,173 +908,463 @@ func (ep *endpoints) GetLogs(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// Get list of groups.
-func (ep *endpoints) GetGroups(w http.ResponseWriter, r *http.Request) {
-	response := make(map[string]interface{})
-	response["total"] = 0
-	response["groups"] = []string{}
-	ep.encodeResponse(w, response)
-}
-
-// Get listing of tags.
-func (ep *endpoints) GetTags(w http.ResponseWriter, r *http.Request) {
-	response := make(map[string]interface{})
-	response["total"] = 0
-	response["tags"] = []string{}
-	ep.encodeResponse(w, response)
-}
-
-func (ep *endpoints) ListClusters(w http.ResponseWriter, r *http.Request) {
-	clusters, err := ep.executionService.ListClusters(r.Context())
-	if err != nil {
-		ep.encodeError(w, err)
-		return
+// Decode the log search parameters shared by the log search and download endpoints.
+func (ep *endpoints) decodeLogQuery(r *http.Request) (logs.LogQuery, error) {
+	params := r.URL.Query()
+	query := logs.LogQuery{
+		Contains: ep.getURLParam(params, "contains", ""),
+		Stream:   ep.getURLParam(params, "stream", ""),
+		Range:    r.Header.Get("Range"),
+		Gzip:     ep.getStringBoolVal(ep.getURLParam(params, "gzip", "")),
 	}
 
-	ep.encodeResponse(w, map[string]interface{}{
-		"clusters": clusters,
-	})
-}
-
-// List active workers.
-func (ep *endpoints) ListWorkers(w http.ResponseWriter, r *http.Request) {
-	wl, err := ep.workerService.List(r.Context(), state.EKSEngine)
-	wlEKS, errEKS := ep.workerService.List(r.Context(), state.EKSEngine)
+	if pattern := ep.getURLParam(params, "pattern", ""); len(pattern) > 0 {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return query, exceptions.MalformedInput{ErrorString: fmt.Sprintf("invalid pattern [%s]: %s", pattern, err.Error())}
+		}
+		query.Pattern = compiled
+	}
 
-	if wl.Workers == nil {
-		wl.Workers = []state.Worker{}
+	for key, target := range map[string]**time.Time{"since": &query.Since, "until": &query.Until} {
+		if val := ep.getURLParam(params, key, ""); len(val) > 0 {
+			parsed, err := time.Parse(time.RFC3339, val)
+			if err != nil {
+				return query, exceptions.MalformedInput{ErrorString: fmt.Sprintf("invalid %s [%s], expected RFC3339", key, val)}
+			}
+			*target = &parsed
+		}
 	}
 
-	if wlEKS.Workers == nil {
-		wlEKS.Workers = []state.Worker{}
+	for key, target := range map[string]*int{"head": &query.Head, "tail": &query.Tail} {
+		if val := ep.getURLParam(params, key, ""); len(val) > 0 {
+			parsed, err := strconv.Atoi(val)
+			if err != nil || parsed < 0 {
+				return query, exceptions.MalformedInput{ErrorString: fmt.Sprintf("invalid %s [%s], expected a non-negative integer", key, val)}
+			}
+			*target = parsed
+		}
 	}
 
-	if err != nil || errEKS != nil {
-		ep.encodeError(w, err)
-	} else {
-		response := make(map[string]interface{})
-		response["total"] = wl.Total + wlEKS.Total
-		response["workers"] = append(wl.Workers, wlEKS.Workers...)
-		ep.encodeResponse(w, response)
+	if query.Head > 0 && query.Tail > 0 {
+		return query, exceptions.MalformedInput{ErrorString: "only one of head or tail may be set"}
 	}
-}
 
-// Get information about an active worker.
-func (ep *endpoints) GetWorker(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	worker, err := ep.workerService.Get(r.Context(), vars["worker_type"], state.DefaultEngine)
+	replica, err := ep.decodeReplica(params)
 	if err != nil {
-		ep.encodeError(w, err)
-	} else {
-		ep.encodeResponse(w, worker)
+		return query, err
 	}
+	query.Replica = replica
+	return query, nil
 }
 
-// Update worker counts.
-func (ep *endpoints) UpdateWorker(w http.ResponseWriter, r *http.Request) {
-	var worker state.Worker
-	err := ep.decodeRequest(r, &worker)
+// Decode the replica whose logs of a replicated run are requested.
+func (ep *endpoints) decodeReplica(params url.Values) (*int64, error) {
+	val := ep.getURLParam(params, "replica", "")
+	if len(val) == 0 {
+		return nil, nil
+	}
+	parsed, err := strconv.ParseInt(val, 10, 64)
+	if err != nil || parsed < 0 {
+		return nil, exceptions.MalformedInput{ErrorString: fmt.Sprintf("invalid replica [%s], expected a positive integer", val)}
+	}
+	return &parsed, nil
+}
 
+// Search the logs of a run server side.
+func (ep *endpoints) SearchLogs(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	query, err := ep.decodeLogQuery(r)
 	if err != nil {
-		ep.encodeError(w, exceptions.MalformedInput{ErrorString: err.Error()})
+		ep.encodeError(w, err)
 		return
 	}
 
-	vars := mux.Vars(r)
-	updated, err := ep.workerService.Update(r.Context(), vars["worker_type"], worker)
-
+	result, err := ep.eksLogService.SearchLogs(vars["run_id"], query)
 	if err != nil {
+		_ = ep.logger.Log(
+			"level", "error",
+			"message", "problem searching logs",
+			"operation", "SearchLogs",
+			"error", fmt.Sprintf("%+v", err),
+			"run_id", vars["run_id"])
 		ep.encodeError(w, err)
-	} else {
-		ep.encodeResponse(w, updated)
+		return
 	}
+	ep.encodeResponse(w, result)
 }
 
-// Update batches of workers - used to turn on/off in bulk.
-func (ep *endpoints) BatchUpdateWorkers(w http.ResponseWriter, r *http.Request) {
-	var wks []state.Worker
-	err := ep.decodeRequest(r, &wks)
-
+// Download the (optionally filtered) logs of a run.
+func (ep *endpoints) DownloadLogs(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	query, err := ep.decodeLogQuery(r)
 	if err != nil {
-		ep.encodeError(w, exceptions.MalformedInput{ErrorString: err.Error()})
+		ep.encodeError(w, err)
 		return
 	}
 
-	updated, err := ep.workerService.BatchUpdate(r.Context(), wks)
-
+	dw := &downloadWriter{ResponseWriter: w}
+	err = ep.eksLogService.DownloadLogs(vars["run_id"], query, dw)
 	if err != nil {
-		ep.encodeError(w, err)
-	} else {
-		ep.encodeResponse(w, updated)
+		_ = ep.logger.Log(
+			"level", "error",
+			"message", "problem downloading logs",
+			"operation", "DownloadLogs",
+			"error", fmt.Sprintf("%+v", err),
+			"run_id", vars["run_id"])
+		// Once the download started its status is sent, the error can only be logged.
+		if !dw.started {
+			ep.encodeError(w, err)
+		}
 	}
 }
 
-func (ep *endpoints) getStringBoolVal(s string) bool {
-	l := strings.ToLower(s)
-
-	if l == "true" {
-		return true
-	}
+// downloadWriter records whether a streamed response has been started.
+type downloadWriter struct {
+	http.ResponseWriter
+	started bool
+}
 
-	return false
+func (dw *downloadWriter) WriteHeader(status int) {
+	dw.started = true
+	dw.ResponseWriter.WriteHeader(status)
 }
 
-// Create a new template run based on template name/alias.
-func (ep *endpoints) CreateTemplateRunByName(w http.ResponseWriter, r *http.Request) {
-	var req state.TemplateExecutionRequest
-	err := ep.decodeRequest(r, &req)
+func (dw *downloadWriter) Write(b []byte) (int, error) {
+	dw.started = true
+	return dw.ResponseWriter.Write(b)
+}
 
+// List the output artifacts of a run.
+func (ep *endpoints) ListArtifacts(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	manifest, err := ep.artifactService.List(r.Context(), vars["run_id"])
 	if err != nil {
-		ep.encodeError(w, exceptions.MalformedInput{ErrorString: err.Error()})
+		_ = ep.logger.Log(
+			"level", "error",
+			"message", "problem listing artifacts",
+			"operation", "ListArtifacts",
+			"error", fmt.Sprintf("%+v", err),
+			"run_id", vars["run_id"])
+		ep.encodeError(w, err)
 		return
 	}
+	ep.encodeResponse(w, manifest)
+}
 
-	if len(req.OwnerID) == 0 {
-		ep.encodeError(w, exceptions.MalformedInput{
-			ErrorString: fmt.Sprintf("request payload must contain [owner_id]; the run_tags field is deprecated for the v7 endpoint.")})
+// Download an output artifact of a run, named by its path relative to the
+// run's output URI.
+func (ep *endpoints) DownloadArtifact(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	path := r.URL.Query().Get("path")
+	if len(path) == 0 {
+		ep.encodeError(w, exceptions.MalformedInput{ErrorString: "query parameter [path] must be specified"})
 		return
 	}
 
-	req.Engine = &state.DefaultEngine
-
-	if req.NodeLifecycle != nil {
-		if !utils.StringSliceContains(state.NodeLifeCycles, *req.NodeLifecycle) {
-			ep.encodeError(w, exceptions.MalformedInput{
-				ErrorString: fmt.Sprintf("Nodelifecyle must be [normal, spot]")})
-			return
-		}
-	} else {
-		req.NodeLifecycle = &state.DefaultLifecycle
-	}
-	vars := mux.Vars(r)
-
-	run, err := ep.executionService.CreateTemplateRunByTemplateName(r.Context(), vars["template_name"], vars["template_version"], &req)
+	err := ep.artifactService.Download(r.Context(), vars["run_id"], path, w)
 	if err != nil {
-		ep.logger.Log(
+		_ = ep.logger.Log(
 			"level", "error",
-			"message", "problem creating template run",
-			"operation", "CreateTemplateRun",
-			"error", fmt.Sprintf("%+v", err))
+			"message", "problem downloading artifact",
+			"operation", "DownloadArtifact",
+			"error", fmt.Sprintf("%+v", err),
+			"run_id", vars["run_id"],
+			"path", path)
 		ep.encodeError(w, err)
-	} else {
-		ep.encodeResponse(w, run)
 	}
-
 }
 
-// Create a new template run based on template id.
-func (ep *endpoints) CreateTemplateRun(w http.ResponseWriter, r *http.Request) {
-	var req state.TemplateExecutionRequest
-	err := ep.decodeRequest(r, &req)
-
+// Proxy requests to a port exposed by a running run.
+func (ep *endpoints) ProxyRun(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	port, err := strconv.Atoi(vars["port"])
 	if err != nil {
-		ep.encodeError(w, exceptions.MalformedInput{ErrorString: err.Error()})
+		ep.encodeError(w, exceptions.MalformedInput{ErrorString: fmt.Sprintf("invalid port [%s]", vars["port"])})
+		return
+	}
+	prefix := fmt.Sprintf("/api/v6/%s/proxy/%d", vars["run_id"], port)
+	if r.URL.Path == prefix {
+		http.Redirect(w, r, prefix+"/", http.StatusMovedPermanently)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, prefix+"/") {
+		http.NotFound(w, r)
 		return
 	}
 
-	if len(req.OwnerID) == 0 {
-		ep.encodeError(w, exceptions.MalformedInput{
-			ErrorString: fmt.Sprintf("request payload must contain [owner_id]; the run_tags field is deprecated for the v7 endpoint.")})
+	handler, err := ep.executionService.ProxyPort(r.Context(), vars["run_id"], port, prefix)
+	if err != nil {
+		ep.encodeError(w, err)
+		return
+	}
+	handler.ServeHTTP(w, r)
+}
+
+// Start a debug session on a run.
+func (ep *endpoints) StartDebugSession(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	var req state.DebugSessionRequest
+	if err := ep.decodeRequest(r, &req); err != nil && err != io.EOF {
+		ep.encodeError(w, exceptions.MalformedInput{ErrorString: err.Error()})
+		return
+	}
+
+	userInfo := ep.ExtractUserInfo(r)
+	session, err := ep.debugService.Start(r.Context(), vars["run_id"], userInfo.Name, req)
+	if err != nil {
+		_ = ep.logger.Log(
+			"level", "error",
+			"message", "problem starting debug session",
+			"operation", "StartDebugSession",
+			"error", fmt.Sprintf("%+v", err),
+			"run_id", vars["run_id"])
+		ep.encodeError(w, err)
+		return
+	}
+	ep.encodeResponse(w, session)
+}
+
+// List the debug sessions of a run.
+func (ep *endpoints) ListDebugSessions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	list, err := ep.debugService.List(r.Context(), vars["run_id"])
+	if err != nil {
+		ep.encodeError(w, err)
+		return
+	}
+	if list.Sessions == nil {
+		list.Sessions = []state.DebugSession{}
+	}
+	ep.encodeResponse(w, list)
+}
+
+// Get a debug session, along with its execs.
+func (ep *endpoints) GetDebugSession(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	session, err := ep.debugService.Get(r.Context(), vars["session_id"])
+	if err != nil {
+		ep.encodeError(w, err)
+		return
+	}
+	ep.encodeResponse(w, session)
+}
+
+// Terminate a debug session.
+func (ep *endpoints) StopDebugSession(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userInfo := ep.ExtractUserInfo(r)
+	session, err := ep.debugService.Stop(r.Context(), vars["session_id"], userInfo.Name)
+	if err != nil {
+		_ = ep.logger.Log(
+			"level", "error",
+			"message", "problem stopping debug session",
+			"operation", "StopDebugSession",
+			"error", fmt.Sprintf("%+v", err),
+			"session_id", vars["session_id"])
+		ep.encodeError(w, err)
+		return
+	}
+	ep.encodeResponse(w, session)
+}
+
+// Exec into a debug session over a websocket. The command is given by the
+// repeated command query parameter, eg. ?command=bash&tty=true.
+func (ep *endpoints) ExecDebugSession(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	params := r.URL.Query()
+	command := params["command"]
+	if len(command) == 0 {
+		ep.encodeError(w, exceptions.MalformedInput{ErrorString: "query parameter [command] must be specified"})
+		return
+	}
+	tty, _ := strconv.ParseBool(ep.getURLParam(params, "tty", "false"))
+
+	// Sessions that can't be exec'd into are refused before upgrading.
+	session, err := ep.debugService.Get(r.Context(), vars["session_id"])
+	if err != nil {
+		ep.encodeError(w, err)
+		return
+	}
+	if !session.Active(time.Now()) {
+		ep.encodeError(w, exceptions.ConflictingResource{ErrorString: fmt.Sprintf("debug session [%s] has ended", session.SessionID)})
+		return
+	}
+
+	stream, err := upgradeDebugStream(w, r)
+	if err != nil {
+		// The upgrader has already replied.
+		return
+	}
+	streams, ctx, cancel := stream.streams(r.Context(), tty)
+	defer cancel()
+
+	userInfo := ep.ExtractUserInfo(r)
+	err = ep.debugService.Exec(ctx, session.SessionID, userInfo.Name, command, streams)
+	if err != nil {
+		_ = ep.logger.Log(
+			"level", "error",
+			"message", "problem executing in debug session",
+			"operation", "ExecDebugSession",
+			"error", fmt.Sprintf("%+v", err),
+			"session_id", session.SessionID)
+	}
+	stream.close(err)
+}
+
+// Get list of groups.
+func (ep *endpoints) GetGroups(w http.ResponseWriter, r *http.Request) {
+	response := make(map[string]interface{})
+	response["total"] = 0
+	response["groups"] = []string{}
+	ep.encodeResponse(w, response)
+}
+
+// Get listing of tags.
+func (ep *endpoints) GetTags(w http.ResponseWriter, r *http.Request) {
+	response := make(map[string]interface{})
+	response["total"] = 0
+	response["tags"] = []string{}
+	ep.encodeResponse(w, response)
+}
+
+func (ep *endpoints) ListClusters(w http.ResponseWriter, r *http.Request) {
+	clusters, err := ep.executionService.ListClusters(r.Context())
+	if err != nil {
+		ep.encodeError(w, err)
+		return
+	}
+
+	ep.encodeResponse(w, map[string]interface{}{
+		"clusters": clusters,
+	})
+}
+
+// List active workers.
+func (ep *endpoints) ListWorkers(w http.ResponseWriter, r *http.Request) {
+	wl, err := ep.workerService.List(r.Context(), state.EKSEngine)
+	wlEKS, errEKS := ep.workerService.List(r.Context(), state.EKSEngine)
+
+	if wl.Workers == nil {
+		wl.Workers = []state.Worker{}
+	}
+
+	if wlEKS.Workers == nil {
+		wlEKS.Workers = []state.Worker{}
+	}
+
+	if err != nil || errEKS != nil {
+		ep.encodeError(w, err)
+	} else {
+		response := make(map[string]interface{})
+		response["total"] = wl.Total + wlEKS.Total
+		response["workers"] = append(wl.Workers, wlEKS.Workers...)
+		ep.encodeResponse(w, response)
+	}
+}
+
+// Get information about an active worker.
+func (ep *endpoints) GetWorker(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	worker, err := ep.workerService.Get(r.Context(), vars["worker_type"], state.DefaultEngine)
+	if err != nil {
+		ep.encodeError(w, err)
+	} else {
+		ep.encodeResponse(w, worker)
+	}
+}
+
+// Get which instance runs which workers.
+func (ep *endpoints) GetWorkerTopology(w http.ResponseWriter, r *http.Request) {
+	topology, err := ep.workerService.Topology(r.Context())
+	if err != nil {
+		ep.encodeError(w, err)
+	} else {
+		ep.encodeResponse(w, topology)
+	}
+}
+
+// Update worker counts.
+func (ep *endpoints) UpdateWorker(w http.ResponseWriter, r *http.Request) {
+	var worker state.Worker
+	err := ep.decodeRequest(r, &worker)
+
+	if err != nil {
+		ep.encodeError(w, exceptions.MalformedInput{ErrorString: err.Error()})
+		return
+	}
+
+	vars := mux.Vars(r)
+	updated, err := ep.workerService.Update(r.Context(), vars["worker_type"], worker)
+
+	if err != nil {
+		ep.encodeError(w, err)
+	} else {
+		ep.encodeResponse(w, updated)
+	}
+}
+
+// Update batches of workers - used to turn on/off in bulk.
+func (ep *endpoints) BatchUpdateWorkers(w http.ResponseWriter, r *http.Request) {
+	var wks []state.Worker
+	err := ep.decodeRequest(r, &wks)
+
+	if err != nil {
+		ep.encodeError(w, exceptions.MalformedInput{ErrorString: err.Error()})
+		return
+	}
+
+	updated, err := ep.workerService.BatchUpdate(r.Context(), wks)
+
+	if err != nil {
+		ep.encodeError(w, err)
+	} else {
+		ep.encodeResponse(w, updated)
+	}
+}
+
+func (ep *endpoints) getStringBoolVal(s string) bool {
+	l := strings.ToLower(s)
+
+	if l == "true" {
+		return true
+	}
+
+	return false
+}
+
+// isDryRun checks the dry_run param of run creations and bundle applies, dry
+// runs only render the runs, or plan the changes, without making them.
+func (ep *endpoints) isDryRun(r *http.Request) bool {
+	return ep.getStringBoolVal(ep.getURLParam(r.URL.Query(), "dry_run", "false"))
+}
+
+func (ep *endpoints) encodeRenderedRun(w http.ResponseWriter, operation string, rendered engine.RenderedRun, err error) {
+	if err != nil {
+		ep.logger.Log(
+			"level", "error",
+			"message", "problem rendering run",
+			"operation", operation,
+			"error", fmt.Sprintf("%+v", err))
+		ep.encodeError(w, err)
+		return
+	}
+	ep.encodeResponse(w, rendered)
+}
+
+// Create a new template run based on template name/alias.
+func (ep *endpoints) CreateTemplateRunByName(w http.ResponseWriter, r *http.Request) {
+	var req state.TemplateExecutionRequest
+	err := ep.decodeRequest(r, &req)
+
+	if err != nil {
+		ep.encodeError(w, exceptions.MalformedInput{ErrorString: err.Error()})
+		return
+	}
+
+	if len(req.OwnerID) == 0 {
+		ep.encodeError(w, exceptions.MalformedInput{
+			ErrorString: fmt.Sprintf("request payload must contain [owner_id]; the run_tags field is deprecated for the v7 endpoint.")})
 		return
 	}
 
@@ -955,6 +1381,47 @@ func (ep *endpoints) CreateTemplateRun(w http.ResponseWriter, r *http.Request) {
 	}
 	vars := mux.Vars(r)
 
+	if req.DryRun || ep.isDryRun(r) {
+		rendered, err := ep.executionService.RenderTemplateRunByTemplateName(r.Context(), vars["template_name"], vars["template_version"], &req)
+		ep.encodeRenderedRun(w, "CreateTemplateRunByName", rendered, err)
+		return
+	}
+
+	run, err := ep.executionService.CreateTemplateRunByTemplateName(r.Context(), vars["template_name"], vars["template_version"], &req)
+	if err != nil {
+		ep.logger.Log(
+			"level", "error",
+			"message", "problem creating template run",
+			"operation", "CreateTemplateRun",
+			"error", fmt.Sprintf("%+v", err))
+		ep.encodeError(w, err)
+	} else {
+		ep.encodeResponse(w, run)
+	}
+
+}
+
+// Create a new template run based on template id.
+func (ep *endpoints) CreateTemplateRun(w http.ResponseWriter, r *http.Request) {
+	var req state.TemplateExecutionRequest
+	err := ep.decodeRequest(r, &req)
+
+	if err != nil {
+		ep.encodeError(w, exceptions.MalformedInput{ErrorString: err.Error()})
+		return
+	}
+	if err = ep.validateTemplateExecutionRequest(&req); err != nil {
+		ep.encodeError(w, err)
+		return
+	}
+	vars := mux.Vars(r)
+
+	if req.DryRun || ep.isDryRun(r) {
+		rendered, err := ep.executionService.RenderTemplateRunByTemplateID(r.Context(), vars["template_id"], &req)
+		ep.encodeRenderedRun(w, "CreateTemplateRun", rendered, err)
+		return
+	}
+
 	run, err := ep.executionService.CreateTemplateRunByTemplateID(r.Context(), vars["template_id"], &req)
 	if err != nil {
 		ep.logger.Log(
@@ -968,6 +1435,64 @@ func (ep *endpoints) CreateTemplateRun(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Creates an array run of a template, with a child run per parameter set.
+func (ep *endpoints) CreateTemplateArrayRun(w http.ResponseWriter, r *http.Request) {
+	var req state.TemplateArrayExecutionRequest
+	err := ep.decodeRequest(r, &req)
+
+	if err != nil {
+		ep.encodeError(w, exceptions.MalformedInput{ErrorString: err.Error()})
+		return
+	}
+	if req.ExecutionRequestCommon == nil {
+		ep.encodeError(w, exceptions.MalformedInput{
+			ErrorString: fmt.Sprintf("request payload must contain [owner_id]")})
+		return
+	}
+	if req.DryRun || ep.isDryRun(r) {
+		ep.encodeError(w, exceptions.MalformedInput{ErrorString: "dry_run is not supported for array runs"})
+		return
+	}
+	if err = ep.validateTemplateExecutionRequest(&req.TemplateExecutionRequest); err != nil {
+		ep.encodeError(w, err)
+		return
+	}
+	vars := mux.Vars(r)
+
+	run, err := ep.executionService.CreateTemplateArrayRun(r.Context(), vars["template_id"], &req.TemplateExecutionRequest, req.Array)
+	if err != nil {
+		ep.logger.Log(
+			"level", "error",
+			"message", "problem creating template array run",
+			"operation", "CreateTemplateArrayRun",
+			"error", fmt.Sprintf("%+v", err))
+		ep.encodeError(w, err)
+	} else {
+		ep.encodeResponse(w, run)
+	}
+}
+
+// validateTemplateExecutionRequest checks the owner and node lifecycle of a
+// template execution request and sets its engine.
+func (ep *endpoints) validateTemplateExecutionRequest(req *state.TemplateExecutionRequest) error {
+	if len(req.OwnerID) == 0 {
+		return exceptions.MalformedInput{
+			ErrorString: fmt.Sprintf("request payload must contain [owner_id]; the run_tags field is deprecated for the v7 endpoint.")}
+	}
+
+	req.Engine = &state.DefaultEngine
+
+	if req.NodeLifecycle != nil {
+		if !utils.StringSliceContains(state.NodeLifeCycles, *req.NodeLifecycle) {
+			return exceptions.MalformedInput{
+				ErrorString: fmt.Sprintf("Nodelifecyle must be [normal, spot]")}
+		}
+	} else {
+		req.NodeLifecycle = &state.DefaultLifecycle
+	}
+	return nil
+}
+
 // List all templates.
 func (ep *endpoints) ListTemplates(w http.ResponseWriter, r *http.Request) {
 	var (
@@ -1046,6 +1571,369 @@ func (ep *endpoints) CreateTemplate(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Preview the command of a template for a payload, merged with the template's
+// defaults. Payloads rejected by the schema list the rejected fields.
+func (ep *endpoints) RenderTemplate(w http.ResponseWriter, r *http.Request) {
+	var req state.TemplateRenderRequest
+	if err := ep.decodeRequest(r, &req); err != nil {
+		ep.encodeError(w, exceptions.MalformedInput{ErrorString: err.Error()})
+		return
+	}
+	vars := mux.Vars(r)
+	render, err := ep.templateService.Render(r.Context(), vars["template_id"], req.TemplatePayload)
+	if err != nil {
+		ep.logger.Log(
+			"level", "error",
+			"message", "problem rendering template",
+			"operation", "RenderTemplate",
+			"error", fmt.Sprintf("%+v", err),
+			"template_id", vars["template_id"])
+		ep.encodeError(w, err)
+		return
+	}
+	ep.encodeResponse(w, render)
+}
+
+// Lint the command template of a template, as it would be created, for
+// payload keys its schema doesn't define.
+func (ep *endpoints) LintTemplate(w http.ResponseWriter, r *http.Request) {
+	var req state.CreateTemplateRequest
+	if err := ep.decodeRequest(r, &req); err != nil {
+		ep.encodeError(w, exceptions.MalformedInput{ErrorString: err.Error()})
+		return
+	}
+	lint, err := ep.templateService.Lint(r.Context(), &req)
+	if err != nil {
+		ep.encodeError(w, err)
+		return
+	}
+	ep.encodeResponse(w, lint)
+}
+
+// Deprecate a template version; runs of it get a warning or are rejected,
+// depending on the level of the deprecation.
+func (ep *endpoints) DeprecateTemplate(w http.ResponseWriter, r *http.Request) {
+	var req state.TemplateDeprecation
+	if err := ep.decodeRequest(r, &req); err != nil {
+		ep.encodeError(w, exceptions.MalformedInput{ErrorString: err.Error()})
+		return
+	}
+	vars := mux.Vars(r)
+	userInfo := ep.ExtractUserInfo(r)
+	tpl, err := ep.templateService.Deprecate(r.Context(), vars["template_id"], userInfo.Name, req)
+	if err != nil {
+		ep.logger.Log(
+			"level", "error",
+			"message", "problem deprecating template",
+			"operation", "DeprecateTemplate",
+			"error", fmt.Sprintf("%+v", err),
+			"template_id", vars["template_id"])
+		ep.encodeError(w, err)
+		return
+	}
+	ep.encodeResponse(w, tpl)
+}
+
+// Lift the deprecation of a template version.
+func (ep *endpoints) UndeprecateTemplate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	tpl, err := ep.templateService.Undeprecate(r.Context(), vars["template_id"])
+	if err != nil {
+		ep.logger.Log(
+			"level", "error",
+			"message", "problem undeprecating template",
+			"operation", "UndeprecateTemplate",
+			"error", fmt.Sprintf("%+v", err),
+			"template_id", vars["template_id"])
+		ep.encodeError(w, err)
+		return
+	}
+	ep.encodeResponse(w, tpl)
+}
+
+// List the channels of a template.
+func (ep *endpoints) ListTemplateChannels(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	channels, err := ep.templateService.ListChannels(r.Context(), vars["template_name"])
+	if err != nil {
+		ep.logger.Log(
+			"level", "error",
+			"message", "problem listing template channels",
+			"operation", "ListTemplateChannels",
+			"error", fmt.Sprintf("%+v", err),
+			"template_name", vars["template_name"])
+		ep.encodeError(w, err)
+		return
+	}
+	ep.encodeResponse(w, channels)
+}
+
+// Point a channel of a template at a version.
+func (ep *endpoints) SetTemplateChannel(w http.ResponseWriter, r *http.Request) {
+	var req state.TemplateChannelRequest
+	if err := ep.decodeRequest(r, &req); err != nil {
+		ep.encodeError(w, exceptions.MalformedInput{ErrorString: err.Error()})
+		return
+	}
+	vars := mux.Vars(r)
+	userInfo := ep.ExtractUserInfo(r)
+	channel, err := ep.templateService.SetChannel(r.Context(), vars["template_name"], vars["channel"], userInfo.Name, req)
+	if err != nil {
+		ep.logger.Log(
+			"level", "error",
+			"message", "problem setting template channel",
+			"operation", "SetTemplateChannel",
+			"error", fmt.Sprintf("%+v", err),
+			"template_name", vars["template_name"],
+			"channel", vars["channel"])
+		ep.encodeError(w, err)
+		return
+	}
+	ep.encodeResponse(w, channel)
+}
+
+// Delete a channel of a template.
+func (ep *endpoints) DeleteTemplateChannel(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if err := ep.templateService.DeleteChannel(r.Context(), vars["template_name"], vars["channel"]); err != nil {
+		ep.logger.Log(
+			"level", "error",
+			"message", "problem deleting template channel",
+			"operation", "DeleteTemplateChannel",
+			"error", fmt.Sprintf("%+v", err),
+			"template_name", vars["template_name"],
+			"channel", vars["channel"])
+		ep.encodeError(w, err)
+		return
+	}
+	ep.encodeResponse(w, map[string]bool{"deleted": true})
+}
+
+// Report the runs of each version of a template over the last days, 30 by
+// default.
+func (ep *endpoints) GetTemplateUsage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	days, err := strconv.Atoi(ep.getURLParam(r.URL.Query(), "days", "30"))
+	if err != nil || days <= 0 {
+		ep.encodeError(w, exceptions.MalformedInput{ErrorString: "query parameter [days] must be a positive integer"})
+		return
+	}
+	since := time.Now().AddDate(0, 0, -days)
+	report, err := ep.templateService.Usage(r.Context(), vars["template_name"], since)
+	if err != nil {
+		ep.logger.Log(
+			"level", "error",
+			"message", "problem getting template usage",
+			"operation", "GetTemplateUsage",
+			"error", fmt.Sprintf("%+v", err),
+			"template_name", vars["template_name"])
+		ep.encodeError(w, err)
+		return
+	}
+	ep.encodeResponse(w, report)
+}
+
+// maxBundleSize is the largest bundle which can be applied, in bytes.
+const maxBundleSize = 10 << 20
+
+// bundleScope reads the scope of bundle requests from the kind, group_name
+// and template_prefix query parameters; kind and group_name may be repeated.
+func (ep *endpoints) bundleScope(r *http.Request) (state.BundleScope, error) {
+	params := r.URL.Query()
+	scope := state.BundleScope{
+		GroupNames:     params["group_name"],
+		TemplatePrefix: ep.getURLParam(params, "template_prefix", ""),
+	}
+	for _, kind := range params["kind"] {
+		switch state.BundleKind(kind) {
+		case state.BundleKindDefinition, state.BundleKindTemplate:
+			scope.Kinds = append(scope.Kinds, state.BundleKind(kind))
+		default:
+			return scope, exceptions.MalformedInput{ErrorString: fmt.Sprintf(
+				"invalid kind [%s], must be one of [%s, %s]", kind, state.BundleKindDefinition, state.BundleKindTemplate)}
+		}
+	}
+	return scope, nil
+}
+
+// Export definitions and the latest versions of templates as a YAML bundle.
+func (ep *endpoints) ExportBundle(w http.ResponseWriter, r *http.Request) {
+	scope, err := ep.bundleScope(r)
+	if err != nil {
+		ep.encodeError(w, err)
+		return
+	}
+	bundle, err := ep.bundleService.Export(r.Context(), scope)
+	if err != nil {
+		ep.logger.Log(
+			"level", "error",
+			"message", "problem exporting bundle",
+			"operation", "ExportBundle",
+			"error", fmt.Sprintf("%+v", err))
+		ep.encodeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml; charset=utf-8")
+	w.Write(bundle)
+}
+
+// Apply a YAML bundle of definitions and templates, responding with the plan
+// of its changes. Dry runs only plan them.
+func (ep *endpoints) ApplyBundle(w http.ResponseWriter, r *http.Request) {
+	scope, err := ep.bundleScope(r)
+	if err != nil {
+		ep.encodeError(w, err)
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBundleSize))
+	if err != nil {
+		ep.encodeError(w, exceptions.MalformedInput{ErrorString: err.Error()})
+		return
+	}
+	opts := services.BundleApplyOptions{
+		DryRun: ep.isDryRun(r),
+		Prune:  ep.getStringBoolVal(ep.getURLParam(r.URL.Query(), "prune", "false")),
+	}
+	userInfo := ep.ExtractUserInfo(r)
+	plan, err := ep.bundleService.Apply(r.Context(), data, scope, opts, userInfo.Name)
+	if err != nil {
+		ep.logger.Log(
+			"level", "error",
+			"message", "problem applying bundle",
+			"operation", "ApplyBundle",
+			"error", fmt.Sprintf("%+v", err))
+		ep.encodeError(w, err)
+		return
+	}
+	ep.encodeResponse(w, plan)
+}
+
+// List the settings which can be changed at runtime, with their values.
+func (ep *endpoints) ListSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := ep.settingsService.List(r.Context())
+	if err != nil {
+		ep.encodeError(w, err)
+		return
+	}
+	ep.encodeResponse(w, settings)
+}
+
+// Override a setting.
+func (ep *endpoints) SetSetting(w http.ResponseWriter, r *http.Request) {
+	var req state.SettingRequest
+	if err := ep.decodeRequest(r, &req); err != nil {
+		ep.encodeError(w, exceptions.MalformedInput{ErrorString: err.Error()})
+		return
+	}
+	vars := mux.Vars(r)
+	userInfo := ep.ExtractUserInfo(r)
+	setting, err := ep.settingsService.Set(r.Context(), vars["key"], userInfo.Name, req)
+	if err != nil {
+		ep.logger.Log(
+			"level", "error",
+			"message", "problem setting setting",
+			"operation", "SetSetting",
+			"error", fmt.Sprintf("%+v", err),
+			"key", vars["key"])
+		ep.encodeError(w, err)
+		return
+	}
+	ep.logger.Log(
+		"level", "info",
+		"message", "setting overridden",
+		"key", vars["key"],
+		"value", string(req.Value),
+		"user", userInfo.Name)
+	ep.encodeResponse(w, setting)
+}
+
+// Remove the override of a setting, with an optional reason query parameter.
+func (ep *endpoints) ResetSetting(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userInfo := ep.ExtractUserInfo(r)
+	reason := ep.getURLParam(r.URL.Query(), "reason", "")
+	setting, err := ep.settingsService.Reset(r.Context(), vars["key"], userInfo.Name, reason)
+	if err != nil {
+		ep.logger.Log(
+			"level", "error",
+			"message", "problem resetting setting",
+			"operation", "ResetSetting",
+			"error", fmt.Sprintf("%+v", err),
+			"key", vars["key"])
+		ep.encodeError(w, err)
+		return
+	}
+	ep.logger.Log(
+		"level", "info",
+		"message", "setting reset",
+		"key", vars["key"],
+		"user", userInfo.Name)
+	ep.encodeResponse(w, setting)
+}
+
+// List the changes of the settings, or of one of them, most recent first.
+func (ep *endpoints) ListSettingChanges(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	params := r.URL.Query()
+	limit, _ := strconv.Atoi(ep.getURLParam(params, "limit", "100"))
+	offset, _ := strconv.Atoi(ep.getURLParam(params, "offset", "0"))
+	changes, err := ep.settingsService.History(r.Context(), vars["key"], limit, offset)
+	if err != nil {
+		ep.encodeError(w, err)
+		return
+	}
+	ep.encodeResponse(w, changes)
+}
+
+// Get the latency percentiles of the recent runs, grouped by the group_by
+// query parameter, over the window and interval query parameters (durations
+// like 24h).
+func (ep *endpoints) GetRunLatency(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	groupBy := state.RunDimension(ep.getURLParam(params, "group_by", string(state.RunDimensionCluster)))
+	var window, interval time.Duration
+	for name, d := range map[string]*time.Duration{"window": &window, "interval": &interval} {
+		raw := ep.getURLParam(params, name, "")
+		if len(raw) == 0 {
+			continue
+		}
+		parsed, err := time.ParseDuration(raw)
+		if err != nil {
+			ep.encodeError(w, exceptions.MalformedInput{ErrorString: fmt.Sprintf("invalid [%s]: %s", name, err.Error())})
+			return
+		}
+		*d = parsed
+	}
+
+	report, err := ep.analyticsService.RunLatency(r.Context(), groupBy, window, interval)
+	if err != nil {
+		ep.encodeError(w, err)
+		return
+	}
+	ep.encodeResponse(w, report)
+}
+
+// List the running runs which have been running for more than the factor
+// query parameter times their historical runtime.
+func (ep *endpoints) ListSlowRuns(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	var factor float64
+	if raw := ep.getURLParam(params, "factor", ""); len(raw) > 0 {
+		var err error
+		if factor, err = strconv.ParseFloat(raw, 64); err != nil {
+			ep.encodeError(w, exceptions.MalformedInput{ErrorString: fmt.Sprintf("invalid [factor]: %s", err.Error())})
+			return
+		}
+	}
+
+	slow, err := ep.analyticsService.SlowRuns(r.Context(), factor)
+	if err != nil {
+		ep.encodeError(w, err)
+		return
+	}
+	ep.encodeResponse(w, slow)
+}
+
 // Get a cluster.
 func (ep *endpoints) GetCluster(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -1095,6 +1983,24 @@ func (ep *endpoints) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// Readiness check endpoint, unlike the health check it fails once the
+// instance drains.
+func (ep *endpoints) ReadinessCheck(w http.ResponseWriter, r *http.Request) {
+	if ep.readiness != nil && ep.readiness.draining.Load() {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"status":  "draining",
+			"message": "Service is shutting down",
+		})
+		return
+	}
+	ep.encodeResponse(w, map[string]string{
+		"status":  "ready",
+		"message": "Service is ready to take requests",
+	})
+}
+
 // Create a new cluster.
 func (ep *endpoints) CreateCluster(w http.ResponseWriter, r *http.Request) {
 	var cluster state.ClusterMetadata
@@ -6,15 +6,23 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	gklog "github.com/go-kit/kit/log"
+	"github.com/gorilla/mux"
 	"github.com/stitchfix/flotilla-os/clients/middleware"
 	"github.com/stitchfix/flotilla-os/config"
+	flotillaLog "github.com/stitchfix/flotilla-os/log"
 	"github.com/stitchfix/flotilla-os/services"
 	"github.com/stitchfix/flotilla-os/state"
 	"github.com/stitchfix/flotilla-os/testutils"
-	muxtrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/gorilla/mux"
 )
 
-func setUp(t *testing.T) *muxtrace.Router {
+func setUp(t *testing.T) *mux.Router {
+	router, _ := setUpWithState(t)
+	return router
+}
+
+// setUpWithState sets up the router along with the state behind it.
+func setUpWithState(t *testing.T) (*mux.Router, *testutils.ImplementsAllTheThings) {
 	confDir := "../conf"
 	c, _ := config.NewConfig(&confDir)
 	imp := testutils.ImplementsAllTheThings{
@@ -43,12 +51,13 @@ func setUp(t *testing.T) *muxtrace.Router {
 		Groups: []string{"g1", "g2", "g3"},
 		Tags:   []string{"t1", "t2", "t3"},
 	}
-	ds, _ := services.NewDefinitionService(&imp)
-	es, _ := services.NewExecutionService(c, &imp, &imp, &imp, &imp)
+	ds, _ := services.NewDefinitionService(c, &imp, &imp)
+	es, _ := services.NewExecutionService(c, &imp, &imp, &imp, &imp, &imp, state.NewSettings(c, &imp, nil))
 	ls, _ := services.NewLogService(&imp, &imp)
 	mwc, _ := middleware.NewClient()
-	ep := endpoints{definitionService: ds, executionService: es, eksLogService: ls, middlewareClient: mwc}
-	return NewRouter(ep)
+	logger := flotillaLog.NewLogger(gklog.NewNopLogger(), nil)
+	ep := endpoints{definitionService: ds, executionService: es, eksLogService: ls, middlewareClient: mwc, logger: logger}
+	return NewRouter(ep), &imp
 }
 
 func TestEndpoints_CreateDefinition(t *testing.T) {
@@ -226,6 +235,54 @@ func TestEndpoints_CreateRun4(t *testing.T) {
 	}
 }
 
+func TestEndpoints_CreateRunDryRun(t *testing.T) {
+	router := setUp(t)
+
+	newRun := `{"cluster":"cupcake", "env":[{"name":"E1","value":"V1"}], "run_tags":{"owner_id":"flotilla"}, "dry_run":true}`
+	req := httptest.NewRequest("PUT", "/api/v6/task/alias/aliasA/execute", bytes.NewBufferString(newRun))
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	resp := w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("Expected status 200, was %v", resp.StatusCode)
+	}
+
+	var rendered struct {
+		Run state.Run `json:"run"`
+	}
+	err := json.NewDecoder(resp.Body).Decode(&rendered)
+	if err != nil {
+		t.Error(err.Error())
+	}
+
+	if len(rendered.Run.RunID) == 0 {
+		t.Errorf("Expected rendered run to have a non-empty run id")
+	}
+	if rendered.Run.DefinitionID != "A" {
+		t.Errorf("Expected rendered run of definition [A] but was [%s]", rendered.Run.DefinitionID)
+	}
+}
+
+func TestEndpoints_CreateRunDryRunQuery(t *testing.T) {
+	router, imp := setUpWithState(t)
+
+	newRun := `{"cluster":"cupcake", "env":[{"name":"E1","value":"V1"}], "run_tags":{"owner_id":"flotilla"}}`
+	req := httptest.NewRequest("PUT", "/api/v6/task/A/execute?dry_run=true", bytes.NewBufferString(newRun))
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	resp := w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("Expected status 200, was %v", resp.StatusCode)
+	}
+	if len(imp.Runs) != 2 || len(imp.Queued) != 0 {
+		t.Errorf("Expected dry runs not to create or enqueue runs, got %d runs and %v queued", len(imp.Runs), imp.Queued)
+	}
+}
+
 func TestEndpoints_CreateRunByAlias(t *testing.T) {
 	router := setUp(t)
 
@@ -719,6 +776,39 @@ func TestEndpoints_StopRun(t *testing.T) {
 	}
 }
 
+func TestEndpoints_BulkStopRuns(t *testing.T) {
+	router := setUp(t)
+
+	req := httptest.NewRequest("POST", "/api/v6/history/stop?status=QUEUED&label=team|data", bytes.NewBufferString(`{"dry_run": true, "reason": "cleanup"}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	resp := w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("Expected status 200, was %v", resp.StatusCode)
+	}
+	var result state.BulkStopResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err.Error())
+	}
+	if !result.DryRun || result.Total != len(result.RunIDs) {
+		t.Errorf("Expected a dry run listing the matching runs, got %+v", result)
+	}
+
+	req = httptest.NewRequest("POST", "/api/v6/history/stop?dry_run=true", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Result().StatusCode != 400 {
+		t.Errorf("Expected status 400 without filters, was %v", w.Result().StatusCode)
+	}
+
+	req = httptest.NewRequest("DELETE", "/api/v6/task/A/history/runA?signal=SIGSEGV", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Result().StatusCode != 400 {
+		t.Errorf("Expected status 400 for an invalid signal, was %v", w.Result().StatusCode)
+	}
+}
+
 func TestEndpoints_ListClusters(t *testing.T) {
 	router := setUp(t)
 
@@ -886,3 +976,26 @@ func TestEndpoints_CreateCluster(t *testing.T) {
 		t.Errorf("Expected [created] acknowledgement")
 	}
 }
+
+func TestEndpoints_ReadinessCheck(t *testing.T) {
+	ready := &readiness{}
+	router := NewRouter(endpoints{readiness: ready})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v6/ready", nil))
+	if w.Result().StatusCode != 200 {
+		t.Errorf("Expected status 200, was %v", w.Result().StatusCode)
+	}
+
+	ready.draining.Store(true)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v6/ready", nil))
+	if w.Result().StatusCode != 503 {
+		t.Errorf("Expected status 503 once draining, was %v", w.Result().StatusCode)
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v6/health", nil))
+	if w.Result().StatusCode != 200 {
+		t.Errorf("Expected the health check to pass while draining, was %v", w.Result().StatusCode)
+	}
+}
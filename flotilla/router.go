@@ -1,12 +1,16 @@
 package flotilla
 
 import (
-	muxtrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/gorilla/mux"
+	"github.com/gorilla/mux"
+	"github.com/stitchfix/flotilla-os/clients/metrics"
+	"github.com/stitchfix/flotilla-os/tracing"
 )
 
-// NewRouter creates and returns a Mux Router
-func NewRouter(ep endpoints) *muxtrace.Router {
-	r := muxtrace.NewRouter()
+// NewRouter creates and returns a Mux Router, its requests traced by the
+// tracing backend
+func NewRouter(ep endpoints) *mux.Router {
+	r := mux.NewRouter()
+	r.Use(tracing.Middleware)
 	v1 := r.PathPrefix("/api/v1").Subrouter()
 
 	v1.HandleFunc("/task", ep.ListDefinitions).Methods("GET")
@@ -41,6 +45,7 @@ func NewRouter(ep endpoints) *muxtrace.Router {
 	v5 := r.PathPrefix("/api/v5").Subrouter()
 	v5.HandleFunc("/worker", ep.ListWorkers).Methods("GET")
 	v5.HandleFunc("/worker", ep.BatchUpdateWorkers).Methods("PUT")
+	v5.HandleFunc("/worker/topology", ep.GetWorkerTopology).Methods("GET")
 	v5.HandleFunc("/worker/{worker_type}", ep.GetWorker).Methods("GET")
 	v5.HandleFunc("/worker/{worker_type}", ep.UpdateWorker).Methods("PUT")
 
@@ -50,10 +55,15 @@ func NewRouter(ep endpoints) *muxtrace.Router {
 	v6.HandleFunc("/clusters/{cluster_id}", ep.GetCluster).Methods("GET")
 	v6.HandleFunc("/clusters/{cluster_id}", ep.UpdateCluster).Methods("PUT")
 	v6.HandleFunc("/clusters/{cluster_id}", ep.DeleteCluster).Methods("DELETE")
+	v6.HandleFunc("/debug/{session_id}", ep.GetDebugSession).Methods("GET")
+	v6.HandleFunc("/debug/{session_id}", ep.StopDebugSession).Methods("DELETE")
+	v6.HandleFunc("/debug/{session_id}/exec", ep.ExecDebugSession).Methods("GET")
 	v6.HandleFunc("/{run_id}/events", ep.GetEvents).Methods("GET")
 	v6.HandleFunc("/groups", ep.GetGroups).Methods("GET")
 	v6.HandleFunc("/health", ep.HealthCheck).Methods("GET")
+	v6.HandleFunc("/ready", ep.ReadinessCheck).Methods("GET")
 	v6.HandleFunc("/history", ep.ListRuns).Methods("GET")
+	v6.HandleFunc("/history/stop", ep.BulkStopRuns).Methods("POST")
 	v6.HandleFunc("/history/{run_id}", ep.GetRun).Methods("GET")
 	v6.HandleFunc("/tags", ep.GetTags).Methods("GET")
 	v6.HandleFunc("/task", ep.ListDefinitions).Methods("GET")
@@ -64,6 +74,7 @@ func NewRouter(ep endpoints) *muxtrace.Router {
 	v6.HandleFunc("/task/{definition_id}", ep.UpdateDefinition).Methods("PUT")
 	v6.HandleFunc("/task/{definition_id}", ep.DeleteDefinition).Methods("DELETE")
 	v6.HandleFunc("/task/{definition_id}/execute", ep.CreateRunV4).Methods("PUT")
+	v6.HandleFunc("/task/{definition_id}/execute/array", ep.CreateArrayRun).Methods("PUT")
 	v6.HandleFunc("/task/{definition_id}/history", ep.ListDefinitionRuns).Methods("GET")
 	v6.HandleFunc("/task/{definition_id}/history/{run_id}", ep.GetRun).Methods("GET")
 	v6.HandleFunc("/task/{definition_id}/history/{run_id}", ep.StopRun).Methods("DELETE")
@@ -71,17 +82,46 @@ func NewRouter(ep endpoints) *muxtrace.Router {
 	v6.HandleFunc("/{run_id}/status", ep.UpdateRun).Methods("PUT")
 	v6.HandleFunc("/{run_id}/status", ep.GetRunStatus).Methods("GET")
 	v6.HandleFunc("/{run_id}/logs", ep.GetLogs).Methods("GET")
+	v6.HandleFunc("/{run_id}/logs/search", ep.SearchLogs).Methods("GET")
+	v6.HandleFunc("/{run_id}/logs/download", ep.DownloadLogs).Methods("GET")
+	v6.HandleFunc("/{run_id}/artifacts", ep.ListArtifacts).Methods("GET")
+	v6.HandleFunc("/{run_id}/artifacts/download", ep.DownloadArtifact).Methods("GET")
+	v6.HandleFunc("/{run_id}/debug", ep.StartDebugSession).Methods("POST")
+	v6.HandleFunc("/{run_id}/debug", ep.ListDebugSessions).Methods("GET")
+	v6.PathPrefix("/{run_id}/proxy/{port:[0-9]+}").HandlerFunc(ep.ProxyRun)
 
 	v7 := r.PathPrefix("/api/v7").Subrouter()
 	v7.HandleFunc("/template/{template_id}/execute", ep.CreateTemplateRun).Methods("PUT")
+	v7.HandleFunc("/template/{template_id}/execute/array", ep.CreateTemplateArrayRun).Methods("PUT")
 	v7.HandleFunc("/template/name/{template_name}/version/{template_version}/execute", ep.CreateTemplateRunByName).Methods("PUT")
+	v7.HandleFunc("/template/name/{template_name}/channel", ep.ListTemplateChannels).Methods("GET")
+	v7.HandleFunc("/template/name/{template_name}/channel/{channel}", ep.SetTemplateChannel).Methods("PUT")
+	v7.HandleFunc("/template/name/{template_name}/channel/{channel}", ep.DeleteTemplateChannel).Methods("DELETE")
+	v7.HandleFunc("/template/name/{template_name}/usage", ep.GetTemplateUsage).Methods("GET")
 	v7.HandleFunc("/template", ep.ListTemplates).Methods("GET")
 	v7.HandleFunc("/template", ep.CreateTemplate).Methods("POST")
+	v7.HandleFunc("/template/lint", ep.LintTemplate).Methods("POST")
 	v7.HandleFunc("/template/{template_id}", ep.GetTemplate).Methods("GET")
+	v7.HandleFunc("/template/{template_id}/render", ep.RenderTemplate).Methods("POST")
+	v7.HandleFunc("/template/{template_id}/deprecation", ep.DeprecateTemplate).Methods("PUT")
+	v7.HandleFunc("/template/{template_id}/deprecation", ep.UndeprecateTemplate).Methods("DELETE")
 	v7.HandleFunc("/template/history/{run_id}", ep.GetRun).Methods("GET")
 	v7.HandleFunc("/template/{template_id}/history", ep.ListTemplateRuns).Methods("GET")
 	v7.HandleFunc("/template/{template_id}/history/{run_id}", ep.GetRun).Methods("GET")
 	v7.HandleFunc("/template/{template_id}/history/{run_id}", ep.StopRun).Methods("DELETE")
+	v7.HandleFunc("/bundle/export", ep.ExportBundle).Methods("GET")
+	v7.HandleFunc("/bundle/apply", ep.ApplyBundle).Methods("POST")
+	v7.HandleFunc("/settings", ep.ListSettings).Methods("GET")
+	v7.HandleFunc("/settings/history", ep.ListSettingChanges).Methods("GET")
+	v7.HandleFunc("/settings/{key}", ep.SetSetting).Methods("PUT")
+	v7.HandleFunc("/settings/{key}", ep.ResetSetting).Methods("DELETE")
+	v7.HandleFunc("/settings/{key}/history", ep.ListSettingChanges).Methods("GET")
+	v7.HandleFunc("/analytics/runs", ep.GetRunLatency).Methods("GET")
+	v7.HandleFunc("/analytics/slow_runs", ep.ListSlowRuns).Methods("GET")
+
+	if handler := metrics.Handler(); handler != nil {
+		r.Handle("/metrics", handler).Methods("GET")
+	}
 
 	return r
 }
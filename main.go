@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	gklog "github.com/go-kit/kit/log"
 	"github.com/pkg/errors"
@@ -8,20 +9,19 @@ import (
 	"github.com/stitchfix/flotilla-os/clients/logs"
 	"github.com/stitchfix/flotilla-os/clients/metrics"
 	"github.com/stitchfix/flotilla-os/clients/middleware"
+	"github.com/stitchfix/flotilla-os/clients/registry"
 	"github.com/stitchfix/flotilla-os/config"
 	"github.com/stitchfix/flotilla-os/execution/engine"
 	"github.com/stitchfix/flotilla-os/flotilla"
 	flotillaLog "github.com/stitchfix/flotilla-os/log"
 	"github.com/stitchfix/flotilla-os/queue"
 	"github.com/stitchfix/flotilla-os/state"
-	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"github.com/stitchfix/flotilla-os/tracing"
 	"log"
 	"os"
 )
 
 func main() {
-	tracer.Start()
-	defer tracer.Stop()
 	args := os.Args
 	if len(args) < 2 {
 		fmt.Println("Usage: flotilla-os <conf_dir>")
@@ -46,6 +46,15 @@ func main() {
 		os.Exit(1)
 	}
 
+	//
+	// Start the tracing backend
+	//
+	if err = tracing.Init(c); err != nil {
+		fmt.Printf("%+v\n", errors.Wrap(err, "unable to initialize tracing"))
+		os.Exit(1)
+	}
+	defer tracing.Stop()
+
 	//
 	// Instantiate metrics client.
 	//
@@ -64,9 +73,22 @@ func main() {
 		os.Exit(1)
 	}
 
+	//
+	// Settings which can be changed at runtime, overriding the configuration
+	//
+	settings := state.NewSettings(c, stateManager, logger)
+	if err = settings.Refresh(context.Background()); err != nil {
+		fmt.Printf("%+v\n", errors.Wrap(err, "unable to load settings, using the configuration"))
+	}
+
 	//
 	// Get registry client for validating images
 	//
+	registryClientName := c.GetString("image_registry_client")
+	if len(registryClientName) == 0 {
+		registryClientName = "oci"
+	}
+	registryClient, err := registry.NewRegistryClient(c, registryClientName)
 	if err != nil {
 		fmt.Printf("%+v\n", errors.Wrap(err, "unable to initialize registry client"))
 		os.Exit(1)
@@ -118,13 +140,13 @@ func main() {
 	// Get execution engine for interacting with backend
 	// execution management framework (eg. EKS)
 	//
-	eksExecutionEngine, err := engine.NewExecutionEngine(c, eksQueueManager, state.EKSEngine, logger, clusterManager, stateManager)
+	eksExecutionEngine, err := engine.NewExecutionEngine(c, eksQueueManager, state.EKSEngine, logger, clusterManager, stateManager, settings)
 	if err != nil {
 		fmt.Printf("%+v\n", errors.Wrap(err, "unable to initialize EKS execution engine"))
 		os.Exit(1)
 	}
 
-	emrExecutionEngine, err := engine.NewExecutionEngine(c, eksQueueManager, state.EKSSparkEngine, logger, clusterManager, stateManager)
+	emrExecutionEngine, err := engine.NewExecutionEngine(c, eksQueueManager, state.EKSSparkEngine, logger, clusterManager, stateManager, settings)
 	if err != nil {
 		fmt.Printf("%+v\n", errors.Wrap(err, "unable to initialize EMR execution engine"))
 		os.Exit(1)
@@ -134,11 +156,13 @@ func main() {
 		fmt.Printf("%+v\n", errors.Wrap(err, "unable to initialize middleware client"))
 		os.Exit(1)
 	}
-	app, err := flotilla.NewApp(c, logger, eksLogsClient, eksExecutionEngine, stateManager, eksClusterClient, eksQueueManager, emrExecutionEngine, emrQueueManager, middlewareClient, clusterManager)
+	app, err := flotilla.NewApp(c, logger, eksLogsClient, eksExecutionEngine, stateManager, eksClusterClient, eksQueueManager, emrExecutionEngine, emrQueueManager, middlewareClient, clusterManager, registryClient, settings)
 	if err != nil {
 		fmt.Printf("%+v\n", errors.Wrap(err, "unable to initialize app"))
 		os.Exit(1)
 	}
 
-	log.Fatal(app.Run())
+	if err = app.Run(); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -6,6 +6,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/stitchfix/flotilla-os/config"
 	"github.com/stitchfix/flotilla-os/state"
+	"github.com/stitchfix/flotilla-os/tracing"
 )
 
 // Manager wraps operations on a queue
@@ -21,16 +22,16 @@ type Manager interface {
 	ReceiveEMREvent(qURL string) (state.EmrEvent, error)
 	ReceiveKubernetesRun(queue string) (string, error)
 	List() ([]string, error)
+	Depth(qURL string) (int64, error)
 }
 
 // RunReceipt wraps a Run and a callback to use
 // when Run is finished processing
 type RunReceipt struct {
-	Run              *state.Run
-	Done             func() error
-	TraceID          uint64
-	ParentID         uint64
-	SamplingPriority int
+	Run  *state.Run
+	Done func() error
+	// TraceContext is the trace propagated with the run, if any
+	TraceContext tracing.TextMapCarrier
 }
 
 // StatusReceipt wraps a StatusUpdate and a callback to use
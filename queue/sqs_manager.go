@@ -10,6 +10,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/stitchfix/flotilla-os/config"
 	"github.com/stitchfix/flotilla-os/state"
+	"github.com/stitchfix/flotilla-os/tracing"
 	"github.com/stitchfix/flotilla-os/utils"
 	awstrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/aws/aws-sdk-go/aws"
 	"strconv"
@@ -31,6 +32,7 @@ type sqsClient interface {
 	SendMessage(input *sqs.SendMessageInput) (*sqs.SendMessageOutput, error)
 	ReceiveMessage(input *sqs.ReceiveMessageInput) (*sqs.ReceiveMessageOutput, error)
 	DeleteMessage(input *sqs.DeleteMessageInput) (*sqs.DeleteMessageOutput, error)
+	GetQueueAttributes(input *sqs.GetQueueAttributesInput) (*sqs.GetQueueAttributesOutput, error)
 }
 
 // Name of queue manager - matches value in configuration
@@ -171,23 +173,22 @@ func (qm *SQSManager) Enqueue(ctx context.Context, qURL string, run state.Run) e
 		return errors.WithStack(err)
 	}
 
+	// Propagate the trace through the message, for the submit worker to
+	// continue it
+	carrier := tracing.TextMapCarrier{}
+	tracing.Inject(ctx, carrier)
+	attributes := make(map[string]*sqs.MessageAttributeValue, len(carrier))
+	for key, value := range carrier {
+		attributes[key] = &sqs.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(value),
+		}
+	}
+
 	sme := sqs.SendMessageInput{
-		QueueUrl:    &qURL,
-		MessageBody: message,
-		MessageAttributes: map[string]*sqs.MessageAttributeValue{
-			"dd-trace-id": {
-				DataType:    aws.String("String"),
-				StringValue: aws.String(fmt.Sprintf("%d", span.Context().TraceID())),
-			},
-			"dd-parent-id": {
-				DataType:    aws.String("String"),
-				StringValue: aws.String(fmt.Sprintf("%d", span.Context().SpanID())),
-			},
-			"dd-sampling-priority": {
-				DataType:    aws.String("String"),
-				StringValue: aws.String("1"),
-			},
-		},
+		QueueUrl:          &qURL,
+		MessageBody:       message,
+		MessageAttributes: attributes,
 	}
 
 	_, err = qm.qc.SendMessage(&sme)
@@ -218,9 +219,6 @@ func (qm *SQSManager) ReceiveRun(ctx context.Context, qURL string) (RunReceipt,
 		MaxNumberOfMessages: &maxMessages,
 		VisibilityTimeout:   &visibilityTimeout,
 		MessageAttributeNames: []*string{
-			aws.String("dd-trace-id"),
-			aws.String("dd-parent-id"),
-			aws.String("dd-sampling-priority"),
 			aws.String("All"),
 		},
 	}
@@ -244,28 +242,38 @@ func (qm *SQSManager) ReceiveRun(ctx context.Context, qURL string) (RunReceipt,
 		span.SetTag("error.msg", err.Error())
 		return receipt, errors.WithStack(err)
 	}
-	var traceID, parentID uint64
-	var samplingPriority int
-	if attr, exists := response.Messages[0].MessageAttributes["dd-trace-id"]; exists && attr.StringValue != nil {
-		traceID, _ = strconv.ParseUint(*attr.StringValue, 10, 64)
-	}
-	if attr, exists := response.Messages[0].MessageAttributes["dd-parent-id"]; exists && attr.StringValue != nil {
-		parentID, _ = strconv.ParseUint(*attr.StringValue, 10, 64)
-	}
-	if attr, exists := response.Messages[0].MessageAttributes["dd-sampling-priority"]; exists && attr.StringValue != nil {
-		sp, _ := strconv.Atoi(*attr.StringValue)
-		samplingPriority = sp
-	}
+	receipt.TraceContext = traceContextFromMessage(response.Messages[0])
 	receipt.Run = &run
 	receipt.Done = func() error {
 		return qm.ack(qURL, response.Messages[0].ReceiptHandle)
 	}
-	receipt.TraceID = traceID
-	receipt.ParentID = parentID
-	receipt.SamplingPriority = samplingPriority
 	return receipt, nil
 }
 
+// legacyTraceAttributes maps the attributes of the messages queued by
+// previous versions to the datadog headers
+var legacyTraceAttributes = map[string]string{
+	"dd-trace-id":          "x-datadog-trace-id",
+	"dd-parent-id":         "x-datadog-parent-id",
+	"dd-sampling-priority": "x-datadog-sampling-priority",
+}
+
+// traceContextFromMessage returns the trace propagated in the attributes of
+// the message
+func traceContextFromMessage(message *sqs.Message) tracing.TextMapCarrier {
+	carrier := tracing.TextMapCarrier{}
+	for key, attr := range message.MessageAttributes {
+		if attr == nil || attr.StringValue == nil {
+			continue
+		}
+		if legacy, ok := legacyTraceAttributes[key]; ok {
+			key = legacy
+		}
+		carrier[key] = *attr.StringValue
+	}
+	return carrier
+}
+
 func (qm *SQSManager) ReceiveStatus(qURL string) (StatusReceipt, error) {
 	var receipt StatusReceipt
 
@@ -466,3 +474,19 @@ func (qm *SQSManager) List() ([]string, error) {
 	}
 	return listed, nil
 }
+
+// Depth returns the approximate number of messages waiting in the queue
+func (qm *SQSManager) Depth(qURL string) (int64, error) {
+	response, err := qm.qc.GetQueueAttributes(&sqs.GetQueueAttributesInput{
+		QueueUrl:       &qURL,
+		AttributeNames: []*string{aws.String(sqs.QueueAttributeNameApproximateNumberOfMessages)},
+	})
+	if err != nil {
+		return 0, errors.Wrapf(err, "problem getting the attributes of sqs queue [%s]", qURL)
+	}
+	messages, ok := response.Attributes[sqs.QueueAttributeNameApproximateNumberOfMessages]
+	if !ok || messages == nil {
+		return 0, errors.Errorf("sqs queue [%s] has no [%s] attribute", qURL, sqs.QueueAttributeNameApproximateNumberOfMessages)
+	}
+	return strconv.ParseInt(*messages, 10, 64)
+}
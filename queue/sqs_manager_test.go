@@ -143,6 +143,17 @@ func (qc *testSQSClient) DeleteMessage(input *sqs.DeleteMessageInput) (*sqs.Dele
 	return &sqs.DeleteMessageOutput{}, nil
 }
 
+func (qc *testSQSClient) GetQueueAttributes(input *sqs.GetQueueAttributesInput) (*sqs.GetQueueAttributesOutput, error) {
+	qc.calls = append(qc.calls, "GetQueueAttributes")
+	if input.QueueUrl == nil || len(*input.QueueUrl) == 0 {
+		qc.t.Errorf("Expected non-nil and non empty QueueUrl")
+	}
+	messages := "42"
+	return &sqs.GetQueueAttributesOutput{
+		Attributes: map[string]*string{sqs.QueueAttributeNameApproximateNumberOfMessages: &messages},
+	}, nil
+}
+
 func setUp(t *testing.T) SQSManager {
 	confDir := "../conf"
 	c, _ := config.NewConfig(&confDir)
@@ -173,6 +184,18 @@ func TestSQSManager_List(t *testing.T) {
 	}
 }
 
+func TestSQSManager_Depth(t *testing.T) {
+	qm := setUp(t)
+
+	depth, err := qm.Depth("A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if depth != 42 {
+		t.Errorf("Expected queue depth to be [42] but was %v", depth)
+	}
+}
+
 func TestSQSManager_Enqueue(t *testing.T) {
 	qm := setUp(t)
 
@@ -241,6 +264,21 @@ func TestSQSManager_ReceiveRun(t *testing.T) {
 	receipt.Done()
 }
 
+func TestTraceContextFromMessage(t *testing.T) {
+	traceID := "1111"
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	msg := sqs.Message{MessageAttributes: map[string]*sqs.MessageAttributeValue{
+		"dd-trace-id": {StringValue: &traceID},
+		"traceparent": {StringValue: &traceparent},
+		"binary":      {BinaryValue: []byte("ignored")},
+	}}
+
+	carrier := traceContextFromMessage(&msg)
+	if len(carrier) != 2 || carrier["x-datadog-trace-id"] != traceID || carrier["traceparent"] != traceparent {
+		t.Errorf("Expected the string attributes with legacy datadog names mapped, got %v", carrier)
+	}
+}
+
 func TestSQSManager_ReceiveStatus(t *testing.T) {
 	qm := setUp(t)
 	receipt, _ := qm.ReceiveStatus("statusQ")
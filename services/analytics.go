@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/stitchfix/flotilla-os/config"
+	"github.com/stitchfix/flotilla-os/exceptions"
+	"github.com/stitchfix/flotilla-os/state"
+	"github.com/stitchfix/flotilla-os/utils"
+)
+
+const (
+	defaultAnalyticsWindow = 24 * time.Hour
+	maxAnalyticsWindow     = 31 * 24 * time.Hour
+	minAnalyticsInterval   = time.Minute
+	maxAnalyticsBuckets    = 1000
+)
+
+// AnalyticsService computes the latencies of the runs and finds the runs
+// running for longer than usual.
+type AnalyticsService interface {
+	RunLatency(ctx context.Context, groupBy state.RunDimension, window time.Duration, interval time.Duration) (state.RunLatencyReport, error)
+	SlowRuns(ctx context.Context, factor float64) (state.SlowRunList, error)
+}
+
+type analyticsService struct {
+	sm   state.Manager
+	conf state.AnalyticsConfig
+}
+
+// NewAnalyticsService configures and returns an AnalyticsService.
+func NewAnalyticsService(conf config.Config, sm state.Manager) (AnalyticsService, error) {
+	return &analyticsService{sm: sm, conf: state.NewAnalyticsConfig(conf)}, nil
+}
+
+// RunLatency returns the percentiles of the queue wait, pending time and
+// runtime of the runs queued in the last window (default 24h), grouped by the
+// dimension, and by buckets of interval when it is set.
+func (as *analyticsService) RunLatency(ctx context.Context, groupBy state.RunDimension, window time.Duration, interval time.Duration) (state.RunLatencyReport, error) {
+	ctx, span := utils.TraceJob(ctx, "flotilla.analytics.run_latency", "")
+	defer span.Finish()
+	span.SetTag("group_by", string(groupBy))
+
+	if !state.IsValidRunDimension(groupBy) {
+		return state.RunLatencyReport{}, exceptions.MalformedInput{ErrorString: fmt.Sprintf(
+			"[group_by] must be one of %v, got [%s]", state.RunDimensions, groupBy)}
+	}
+	if window == 0 {
+		window = defaultAnalyticsWindow
+	}
+	if window < 0 || window > maxAnalyticsWindow {
+		return state.RunLatencyReport{}, exceptions.MalformedInput{ErrorString: fmt.Sprintf(
+			"[window] must be positive and at most %s, got [%s]", maxAnalyticsWindow, window)}
+	}
+	if interval != 0 {
+		if interval < minAnalyticsInterval {
+			return state.RunLatencyReport{}, exceptions.MalformedInput{ErrorString: fmt.Sprintf(
+				"[interval] must be at least %s, got [%s]", minAnalyticsInterval, interval)}
+		}
+		if window/interval > maxAnalyticsBuckets {
+			return state.RunLatencyReport{}, exceptions.MalformedInput{ErrorString: fmt.Sprintf(
+				"[interval] of %s splits the window in more than %d buckets", interval, maxAnalyticsBuckets)}
+		}
+	}
+
+	until := time.Now().UTC()
+	q := state.RunLatencyQuery{
+		GroupBy:   groupBy,
+		Since:     until.Add(-window),
+		Until:     until,
+		Interval:  interval,
+		TeamLabel: as.conf.TeamLabel,
+	}
+	stats, err := as.sm.GetRunLatencyStats(ctx, q)
+	if err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return state.RunLatencyReport{}, err
+	}
+
+	report := state.RunLatencyReport{GroupBy: groupBy, Since: q.Since, Until: q.Until, Stats: stats}
+	if interval != 0 {
+		report.Interval = interval.String()
+	}
+	if report.Stats == nil {
+		report.Stats = []state.RunLatencyStats{}
+	}
+	return report, nil
+}
+
+// SlowRuns returns the running runs which have been running for more than
+// factor times their historical runtime, the configured factor when it is 0.
+func (as *analyticsService) SlowRuns(ctx context.Context, factor float64) (state.SlowRunList, error) {
+	ctx, span := utils.TraceJob(ctx, "flotilla.analytics.slow_runs", "")
+	defer span.Finish()
+
+	if factor == 0 {
+		factor = as.conf.SlowRunFactor
+	}
+	if factor < 1 {
+		return state.SlowRunList{}, exceptions.MalformedInput{ErrorString: fmt.Sprintf(
+			"[factor] must be at least 1, got [%v]", factor)}
+	}
+	slow, err := state.ListSlowRuns(ctx, as.sm, factor, time.Now())
+	if err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+	}
+	return slow, err
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stitchfix/flotilla-os/config"
+	"github.com/stitchfix/flotilla-os/exceptions"
+	"github.com/stitchfix/flotilla-os/state"
+	"github.com/stitchfix/flotilla-os/testutils"
+)
+
+func TestAnalyticsService_RunLatency(t *testing.T) {
+	ctx := context.Background()
+	confDir := "../conf"
+	c, _ := config.NewConfig(&confDir)
+	p50 := 12.5
+	imp := &testutils.ImplementsAllTheThings{T: t, LatencyStats: []state.RunLatencyStats{
+		{Value: "cluster-a", Runs: 3, QueueWait: state.Percentiles{P50: &p50}},
+	}}
+	as, _ := NewAnalyticsService(c, imp)
+
+	for _, bad := range []struct {
+		groupBy  state.RunDimension
+		window   time.Duration
+		interval time.Duration
+	}{
+		{"queue", 0, 0},
+		{state.RunDimensionCluster, -time.Hour, 0},
+		{state.RunDimensionCluster, 90 * 24 * time.Hour, 0},
+		{state.RunDimensionCluster, time.Hour, time.Second},
+		{state.RunDimensionCluster, 24 * time.Hour, time.Minute},
+	} {
+		if _, err := as.RunLatency(ctx, bad.groupBy, bad.window, bad.interval); err == nil {
+			t.Errorf("expected %+v to be refused", bad)
+		} else if _, ok := err.(exceptions.MalformedInput); !ok {
+			t.Errorf("expected a malformed input for %+v, got %v", bad, err)
+		}
+	}
+
+	report, err := as.RunLatency(ctx, state.RunDimensionCluster, 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Until.Sub(report.Since) != defaultAnalyticsWindow {
+		t.Errorf("expected the default window of %s, got %s", defaultAnalyticsWindow, report.Until.Sub(report.Since))
+	}
+	if report.Interval != "1h0m0s" || len(report.Stats) != 1 || *report.Stats[0].QueueWait.P50 != p50 {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
+
+func TestAnalyticsService_SlowRuns(t *testing.T) {
+	ctx := context.Background()
+	confDir := "../conf"
+	c, _ := config.NewConfig(&confDir)
+	executableID := "definition-a"
+	longAgo := time.Now().Add(-10 * time.Minute)
+	recently := time.Now().Add(-30 * time.Second)
+	// The historical runtime of the mock is 1 minute
+	imp := &testutils.ImplementsAllTheThings{T: t, Runs: map[string]state.Run{
+		"slow": {RunID: "slow", ExecutableID: &executableID, Status: state.StatusRunning, StartedAt: &longAgo},
+		"fine": {RunID: "fine", ExecutableID: &executableID, Status: state.StatusRunning, StartedAt: &recently},
+	}}
+	as, _ := NewAnalyticsService(c, imp)
+
+	if _, err := as.SlowRuns(ctx, 0.5); err == nil {
+		t.Errorf("expected factors below 1 to be refused")
+	}
+
+	slow, err := as.SlowRuns(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slow.Factor != 3 || slow.Total != 1 || slow.Runs[0].RunID != "slow" {
+		t.Errorf("expected only the slow run to be flagged with the default factor, got %+v", slow)
+	}
+	if slow.Runs[0].Ratio < 9 {
+		t.Errorf("expected the ratio to the historical runtime, got %v", slow.Runs[0].Ratio)
+	}
+}
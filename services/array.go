@@ -0,0 +1,259 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stitchfix/flotilla-os/exceptions"
+	"github.com/stitchfix/flotilla-os/state"
+	"github.com/stitchfix/flotilla-os/utils"
+)
+
+// arrayChildrenPageSize is the number of children of an array run listed at once.
+const arrayChildrenPageSize = 500
+
+// CreateDefinitionArrayRun creates an array run of the definition, with a
+// child run per parameter set of the spec. Children beyond the spec's
+// parallelism are held and queued by the array worker as others finish.
+func (es *executionService) CreateDefinitionArrayRun(ctx context.Context, definitionID string, req *state.DefinitionExecutionRequest, spec state.ArraySpec) (state.Run, error) {
+	ctx, span := utils.TraceJob(ctx, "flotilla.definition.create_array_run", "")
+	defer span.Finish()
+	span.SetTag("definition_id", definitionID)
+
+	definition, err := es.stateManager.GetDefinition(ctx, definitionID)
+	if err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return state.Run{}, err
+	}
+	params, parallelism, err := es.expandArray(spec)
+	if err != nil {
+		return state.Run{}, err
+	}
+
+	// Resolving the parent selects the cluster for all of the children.
+	parent, err := es.resolveRunFromDefinition(ctx, definition, req)
+	if err != nil {
+		return parent, err
+	}
+	children := make([]state.Run, len(params))
+	for i, p := range params {
+		childReq := &state.DefinitionExecutionRequest{
+			ExecutionRequestCommon: arrayChildRequest(req.ExecutionRequestCommon, p, i, len(params)),
+		}
+		if children[i], err = es.constructRunFromDefinition(ctx, definition, childReq); err != nil {
+			return parent, err
+		}
+	}
+	return es.createArrayRun(ctx, parent, children, parallelism)
+}
+
+// CreateTemplateArrayRun creates an array run of the template, with a child
+// run per parameter set of the spec. The template payload of each child is
+// the request's payload with the parameter set's payload fields on top.
+func (es *executionService) CreateTemplateArrayRun(ctx context.Context, templateID string, req *state.TemplateExecutionRequest, spec state.ArraySpec) (state.Run, error) {
+	ctx, span := utils.TraceJob(ctx, "flotilla.template.create_array_run", "")
+	defer span.Finish()
+	span.SetTag("template_id", templateID)
+
+	template, err := es.stateManager.GetTemplateByID(ctx, templateID)
+	if err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return state.Run{}, err
+	}
+	warnings, err := es.checkDeprecation(template)
+	if err != nil {
+		return state.Run{}, err
+	}
+	params, parallelism, err := es.expandArray(spec)
+	if err != nil {
+		return state.Run{}, err
+	}
+
+	es.sanitizeExecutionRequestCommonFields(req.GetExecutionRequestCommon())
+	children := make([]state.Run, len(params))
+	for i, p := range params {
+		payload := state.TemplatePayload{}
+		for k, v := range req.TemplatePayload {
+			payload[k] = v
+		}
+		for k, v := range p.TemplatePayload {
+			payload[k] = v
+		}
+		childReq := &state.TemplateExecutionRequest{
+			ExecutionRequestCommon: arrayChildRequest(req.ExecutionRequestCommon, p, i, len(params)),
+			TemplatePayload:        payload,
+		}
+		if children[i], err = es.constructRunFromTemplate(ctx, template, childReq); err != nil {
+			return state.Run{}, err
+		}
+	}
+
+	// The request's payload alone may not satisfy the template's schema, the
+	// parent is based on the first child instead.
+	parent := children[0]
+	if parent.RunID, err = state.NewRunID(parent.Engine); err != nil {
+		return state.Run{}, err
+	}
+	parent.Command = nil
+	parent.IdempotenceKey = req.IdempotenceKey
+	parent.ExecutionRequestCustom = req.GetExecutionRequestCustom()
+	parentEnv := es.constructEnviron(parent, req.Env)
+	parent.Env = &parentEnv
+	parent, err = es.createArrayRun(ctx, parent, children, parallelism)
+	parent.Warnings = warnings
+	return parent, err
+}
+
+// expandArray returns the parameter sets of the spec and the parallelism of
+// the array, capped by array_max_parallelism.
+func (es *executionService) expandArray(spec state.ArraySpec) ([]state.ArrayParameters, int64, error) {
+	params, err := spec.Expand(es.arrayMaxSize)
+	if err != nil {
+		return nil, 0, exceptions.MalformedInput{ErrorString: err.Error()}
+	}
+	if spec.Parallelism < 0 {
+		return nil, 0, exceptions.MalformedInput{
+			ErrorString: fmt.Sprintf("invalid array parallelism [%d]", spec.Parallelism)}
+	}
+	parallelism := spec.Parallelism
+	if parallelism == 0 || parallelism > es.arrayMaxParallelism {
+		parallelism = es.arrayMaxParallelism
+	}
+	if parallelism > int64(len(params)) {
+		parallelism = int64(len(params))
+	}
+	return params, parallelism, nil
+}
+
+// arrayChildRequest returns a copy of the request's common fields with the
+// parameter set's variables and the reserved array variables added to the
+// environment.
+func arrayChildRequest(fields *state.ExecutionRequestCommon, params state.ArrayParameters, index int, size int) *state.ExecutionRequestCommon {
+	child := *fields
+	child.IdempotenceKey = nil
+
+	env := state.EnvList{}
+	if fields.Env != nil {
+		for _, e := range *fields.Env {
+			if _, ok := params.Env[e.Name]; !ok {
+				env = append(env, e)
+			}
+		}
+	}
+	var names []string
+	for name := range params.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		env = append(env, state.EnvVar{Name: name, Value: params.Env[name]})
+	}
+	env = append(env,
+		state.EnvVar{Name: state.ArrayIndexVar, Value: strconv.Itoa(index)},
+		state.EnvVar{Name: state.ArraySizeVar, Value: strconv.Itoa(size)})
+	child.Env = &env
+	return &child
+}
+
+// createArrayRun saves the array run and its children, all held at first,
+// then queues as many children as the parallelism allows.
+func (es *executionService) createArrayRun(ctx context.Context, parent state.Run, children []state.Run, parallelism int64) (state.Run, error) {
+	ctx, span := utils.TraceJob(ctx, "flotilla.job.create_array", parent.RunID)
+	defer span.Finish()
+	span.SetTag("array.size", len(children))
+	span.SetTag("array.parallelism", parallelism)
+
+	if parent.IdempotenceKey != nil {
+		priorRunId, err := es.stateManager.CheckIdempotenceKey(ctx, *parent.IdempotenceKey)
+		if err == nil && len(priorRunId) > 0 {
+			priorRun, err := es.Get(ctx, priorRunId)
+			if err == nil {
+				return priorRun, nil
+			}
+		}
+	}
+
+	if err := es.checkRunImage(ctx, &parent); err != nil {
+		return parent, err
+	}
+
+	spawnedRuns := make(state.SpawnedRuns, len(children))
+	for i := range children {
+		children[i].Status = state.StatusHeld
+		children[i].ArrayParentID = aws.String(parent.RunID)
+		children[i].ArrayIndex = aws.Int64(int64(i))
+		children[i].ImageDigest = parent.ImageDigest
+		spawnedRuns[i] = state.SpawnedRun{RunID: children[i].RunID}
+	}
+	summary := state.SummarizeArray(children, parallelism)
+	parent.TaskType = state.ArrayTaskType
+	parent.Status = state.StatusQueued
+	parent.SpawnedRuns = &spawnedRuns
+	parent.Array = &summary
+
+	// The parent and its children are saved together, none are left behind
+	// when one of them can't be saved.
+	if err := es.stateManager.CreateRuns(ctx, append([]state.Run{parent}, children...)); err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return parent, err
+	}
+
+	for _, child := range children[:parallelism] {
+		if err := es.releaseHeldRun(ctx, child); err != nil {
+			span.SetTag("error", true)
+			span.SetTag("error.msg", err.Error())
+			return parent, err
+		}
+	}
+	return es.Get(ctx, parent.RunID)
+}
+
+// releaseHeldRun queues a held child of an array run.
+func (es *executionService) releaseHeldRun(ctx context.Context, run state.Run) error {
+	queuedAt := time.Now()
+	run, err := es.stateManager.UpdateRun(ctx, run.RunID, state.Run{Status: state.StatusQueued, QueuedAt: &queuedAt})
+	if err != nil {
+		return err
+	}
+	if *run.Engine == state.EKSEngine {
+		return es.eksExecutionEngine.Enqueue(ctx, run)
+	}
+	return es.emrExecutionEngine.Enqueue(ctx, run)
+}
+
+// terminateArrayChildren stops the children of an array run which haven't
+// stopped yet.
+func (es *executionService) terminateArrayChildren(ctx context.Context, run state.Run, stop state.RunStop) {
+	filters := map[string][]string{
+		"array_parent_id": {run.RunID},
+		"status":          {state.StatusHeld, state.StatusQueued, state.StatusNeedsRetry, state.StatusPending, state.StatusRunning},
+	}
+	// Stopped children drop out of the filter, the first page is re-listed
+	// until it holds no child which wasn't already stopped.
+	seen := make(map[string]bool)
+	for {
+		children, err := es.stateManager.ListRuns(ctx, arrayChildrenPageSize, 0, "array_index", "asc", filters, nil, state.Engines)
+		if err != nil {
+			return
+		}
+		stopping := 0
+		for _, child := range children.Runs {
+			if seen[child.RunID] {
+				continue
+			}
+			seen[child.RunID] = true
+			stopping++
+			_ = es.stopRun(ctx, child, stop)
+		}
+		if stopping == 0 {
+			return
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stitchfix/flotilla-os/state"
+)
+
+func TestExecutionService_CreateDefinitionArrayRun(t *testing.T) {
+	ctx := context.Background()
+	es, imp := setUp(t)
+
+	engine := state.DefaultEngine
+	req := state.DefinitionExecutionRequest{
+		ExecutionRequestCommon: &state.ExecutionRequestCommon{
+			ClusterName: "clusta",
+			Env:         &state.EnvList{{Name: "K1", Value: "V1"}},
+			OwnerID:     "somebody",
+			Engine:      &engine,
+		},
+	}
+	spec := state.ArraySpec{
+		Range:       &state.ArrayRange{Env: "DAY", Start: 0, End: 5},
+		Parallelism: 2,
+	}
+
+	parent, err := es.CreateDefinitionArrayRun(ctx, "B", &req, spec)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if parent.TaskType != state.ArrayTaskType {
+		t.Errorf("Expected array run to have task type [%s] but was [%s]", state.ArrayTaskType, parent.TaskType)
+	}
+	if parent.SpawnedRuns == nil || len(*parent.SpawnedRuns) != 5 {
+		t.Fatalf("Expected array run to list 5 spawned runs")
+	}
+	if len(imp.Queued) != 2 {
+		t.Errorf("Expected 2 children to be queued but was %v", len(imp.Queued))
+	}
+
+	held := 0
+	for i, spawned := range *parent.SpawnedRuns {
+		child := imp.Runs[spawned.RunID]
+		if child.ArrayParentID == nil || *child.ArrayParentID != parent.RunID {
+			t.Errorf("Expected child %d to reference its array run", i)
+		}
+		if child.Status == state.StatusHeld {
+			held++
+		}
+		vars := map[string]string{}
+		for _, e := range *child.Env {
+			vars[e.Name] = e.Value
+		}
+		if vars[state.ArrayIndexVar] != vars["DAY"] || vars[state.ArraySizeVar] != "5" || vars["K1"] != "V1" {
+			t.Errorf("Unexpected environment for child %d: %v", i, vars)
+		}
+	}
+	if held != 3 {
+		t.Errorf("Expected 3 held children but was %v", held)
+	}
+	creates := map[string]int{}
+	for _, call := range imp.Calls {
+		creates[call]++
+	}
+	if creates["CreateRuns"] != 1 || creates["CreateRun"] != 0 {
+		t.Errorf("Expected the array run and its children to be created at once, got %v", creates)
+	}
+
+	spec.Parallelism = -1
+	if _, err := es.CreateDefinitionArrayRun(ctx, "B", &req, spec); err == nil {
+		t.Errorf("Expected an error for a negative parallelism")
+	}
+}
+
+func TestExecutionService_terminateArrayChildren(t *testing.T) {
+	ctx := context.Background()
+	es, imp := setUp(t)
+
+	parentID := "array-parent"
+	imp.Runs = map[string]state.Run{
+		"child-0": {RunID: "child-0", Status: state.StatusHeld, ArrayParentID: &parentID},
+		"child-1": {RunID: "child-1", Status: state.StatusRunning, ArrayParentID: &parentID},
+	}
+	// The array run doesn't list its spawned runs, the children are found by parent.
+	es.(*executionService).terminateArrayChildren(ctx, state.Run{RunID: parentID, TaskType: state.ArrayTaskType}, state.RunStop{})
+
+	for id, run := range imp.Runs {
+		if run.Status != state.StatusStopped {
+			t.Errorf("Expected child [%s] to be stopped but was [%s]", id, run.Status)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/stitchfix/flotilla-os/clients/artifacts"
+	"github.com/stitchfix/flotilla-os/exceptions"
+	"github.com/stitchfix/flotilla-os/state"
+)
+
+// ArtifactService lists and serves the output artifacts of runs.
+type ArtifactService interface {
+	List(ctx context.Context, runID string) (state.ArtifactManifest, error)
+	Download(ctx context.Context, runID string, path string, w http.ResponseWriter) error
+}
+
+type artifactService struct {
+	sm state.Manager
+	ac artifacts.Client
+}
+
+// NewArtifactService initializes an artifact service, ac is nil when no
+// artifacts bucket is configured.
+func NewArtifactService(sm state.Manager, ac artifacts.Client) (ArtifactService, error) {
+	return &artifactService{sm: sm, ac: ac}, nil
+}
+
+// List returns the manifest recorded when the run stopped, or the artifacts
+// output so far by runs still going.
+func (as *artifactService) List(ctx context.Context, runID string) (state.ArtifactManifest, error) {
+	run, err := as.sm.GetRun(ctx, runID)
+	if err != nil {
+		return state.ArtifactManifest{}, err
+	}
+	// An empty manifest may have been recorded before the output was
+	// uploaded, the artifacts are listed again.
+	if run.Artifacts != nil && (len(run.Artifacts.Artifacts) > 0 || as.ac == nil) {
+		return *run.Artifacts, nil
+	}
+	if as.ac == nil {
+		return state.ArtifactManifest{}, notConfigured()
+	}
+	return as.ac.Manifest(ctx, run.RunID)
+}
+
+// Download streams an artifact of the run.
+func (as *artifactService) Download(ctx context.Context, runID string, path string, w http.ResponseWriter) error {
+	run, err := as.sm.GetRun(ctx, runID)
+	if err != nil {
+		return err
+	}
+	if as.ac == nil {
+		return notConfigured()
+	}
+	return as.ac.Download(ctx, run.RunID, path, w)
+}
+
+func notConfigured() error {
+	return exceptions.MissingResource{ErrorString: "run artifacts are not configured"}
+}
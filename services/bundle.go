@@ -0,0 +1,359 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/stitchfix/flotilla-os/clients/registry"
+	"github.com/stitchfix/flotilla-os/config"
+	"github.com/stitchfix/flotilla-os/exceptions"
+	"github.com/stitchfix/flotilla-os/state"
+	"github.com/stitchfix/flotilla-os/utils"
+)
+
+// BundleApplyOptions tune how a bundle is applied.
+type BundleApplyOptions struct {
+	// DryRun plans the changes without making them.
+	DryRun bool
+	// Prune deletes the definitions, and deprecates the templates, of the
+	// scope which the bundle doesn't declare.
+	Prune bool
+}
+
+// BundleService exports definitions and templates as bundles of YAML
+// documents, and applies such bundles back, so that they can be kept in git.
+type BundleService interface {
+	Export(ctx context.Context, scope state.BundleScope) ([]byte, error)
+	Apply(ctx context.Context, data []byte, scope state.BundleScope, opts BundleApplyOptions, user string) (state.BundlePlan, error)
+}
+
+type bundleService struct {
+	sm        state.Manager
+	images    imageChecker
+	templates *templateService
+}
+
+// bundlePageSize is the number of definitions or templates listed at once.
+const bundlePageSize = 1000
+
+// NewBundleService configures and returns a BundleService.
+func NewBundleService(conf config.Config, sm state.Manager, registryClient registry.Client) (BundleService, error) {
+	bs := bundleService{
+		sm:        sm,
+		images:    newImageChecker(conf, registryClient),
+		templates: &templateService{sm: sm},
+	}
+	return &bs, nil
+}
+
+// Export returns the definitions and the latest versions of the templates of
+// the scope as a bundle.
+func (bs *bundleService) Export(ctx context.Context, scope state.BundleScope) ([]byte, error) {
+	ctx, span := utils.TraceJob(ctx, "flotilla.bundle.export", "")
+	defer span.Finish()
+
+	definitions, templates, err := bs.list(ctx, scope)
+	if err != nil {
+		return nil, err
+	}
+	var bundle state.Bundle
+	for _, d := range definitions {
+		bundle.Definitions = append(bundle.Definitions, *d)
+	}
+	for _, t := range templates {
+		bundle.Templates = append(bundle.Templates, bundleTemplate(*t))
+	}
+	return state.EncodeBundle(bundle)
+}
+
+// Apply plans the changes which make the definitions and templates match the
+// bundle, and makes them unless it's a dry run. Bundles are validated as a
+// whole before anything is written, and the changes are made in a single
+// transaction: all of them are, or none.
+//
+// Definitions are matched by alias and fully replaced by their spec. Templates
+// are matched by name and get a new version when their spec differs from the
+// latest one. Pruning requires a scope, definitions are only pruned within
+// group names and templates within a name prefix, and only acts on the kinds
+// the bundle is scoped to.
+func (bs *bundleService) Apply(ctx context.Context, data []byte, scope state.BundleScope, opts BundleApplyOptions, user string) (state.BundlePlan, error) {
+	ctx, span := utils.TraceJob(ctx, "flotilla.bundle.apply", "")
+	defer span.Finish()
+
+	plan := state.BundlePlan{DryRun: opts.DryRun, Prune: opts.Prune, Changes: []state.BundleChange{}}
+	bundle, err := state.ParseBundle(data)
+	if err != nil {
+		return plan, exceptions.MalformedInput{ErrorString: fmt.Sprintf("invalid bundle: %s", err)}
+	}
+	if opts.Prune {
+		if scope.Includes(state.BundleKindDefinition) && len(scope.GroupNames) == 0 {
+			return plan, exceptions.MalformedInput{ErrorString: "pruning definitions requires [group_name]"}
+		}
+		if scope.Includes(state.BundleKindTemplate) && len(scope.TemplatePrefix) == 0 {
+			return plan, exceptions.MalformedInput{ErrorString: "pruning templates requires [template_prefix]"}
+		}
+	}
+
+	definitions, templates, err := bs.list(ctx, state.BundleScope{})
+	if err != nil {
+		return plan, err
+	}
+	changes := state.BundleChanges{DeprecateTemplates: map[string]state.TemplateDeprecation{}}
+	var reasons []string
+
+	declaredDefinitions := map[string]bool{}
+	for _, d := range bundle.Definitions {
+		declaredDefinitions[d.Alias] = true
+		change, reason, err := bs.planDefinition(ctx, d, definitions[d.Alias], &changes)
+		if err != nil {
+			return plan, err
+		}
+		if len(reason) > 0 {
+			reasons = append(reasons, reason)
+			continue
+		}
+		plan.Changes = append(plan.Changes, change)
+	}
+	declaredTemplates := map[string]bool{}
+	for _, t := range bundle.Templates {
+		declaredTemplates[t.TemplateName] = true
+		change, reason, err := bs.planTemplate(t, templates[t.TemplateName], &changes)
+		if err != nil {
+			return plan, err
+		}
+		if len(reason) > 0 {
+			reasons = append(reasons, reason)
+			continue
+		}
+		plan.Changes = append(plan.Changes, change)
+	}
+	if len(reasons) > 0 {
+		return plan, exceptions.MalformedInput{ErrorString: strings.Join(reasons, "\n")}
+	}
+
+	if opts.Prune {
+		pruned, err := bs.planPrune(ctx, scope, declaredDefinitions, declaredTemplates, definitions, templates, user, &changes)
+		if err != nil {
+			return plan, err
+		}
+		plan.Changes = append(plan.Changes, pruned...)
+	}
+
+	if opts.DryRun || changes.Empty() {
+		return plan, nil
+	}
+	if err = bs.sm.ApplyBundle(ctx, changes); err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return plan, err
+	}
+	plan.Applied = true
+	return plan, nil
+}
+
+// planDefinition plans the creation or update of the definition, returning
+// why it's invalid, if it is.
+func (bs *bundleService) planDefinition(ctx context.Context, d state.Definition, current *state.Definition, changes *state.BundleChanges) (state.BundleChange, string, error) {
+	change := state.BundleChange{Kind: state.BundleKindDefinition, Name: d.Alias}
+	if valid, reasons := d.IsValid(); !valid {
+		return change, fmt.Sprintf("definition [%s]: %s", d.Alias, strings.Join(reasons, ", ")), nil
+	}
+	for _, image := range append([]string{d.Image}, d.ContainerImages()...) {
+		if _, err := bs.images.check(ctx, image, ""); err != nil {
+			if _, ok := err.(exceptions.MalformedInput); ok {
+				return change, fmt.Sprintf("definition [%s]: %s", d.Alias, err), nil
+			}
+			return change, "", err
+		}
+	}
+
+	if current == nil {
+		definitionID, err := state.NewDefinitionID(d)
+		if err != nil {
+			return change, "", err
+		}
+		d.DefinitionID = definitionID
+		change.Action = state.BundleActionCreate
+		changes.CreateDefinitions = append(changes.CreateDefinitions, d)
+		return change, "", nil
+	}
+
+	fields, err := state.BundleFieldChanges(*current, d)
+	if err != nil {
+		return change, "", err
+	}
+	if len(fields) == 0 {
+		change.Action = state.BundleActionUnchanged
+		return change, "", nil
+	}
+	// Ports and tags aren't part of specs, they're kept as they are.
+	d.DefinitionID = current.DefinitionID
+	d.Ports = current.Ports
+	d.Tags = current.Tags
+	change.Action = state.BundleActionUpdate
+	change.Fields = fields
+	changes.UpdateDefinitions = append(changes.UpdateDefinitions, d)
+	return change, "", nil
+}
+
+// planTemplate plans the creation of the template, or of a new version of it,
+// returning why it's invalid, if it is.
+func (bs *bundleService) planTemplate(req state.CreateTemplateRequest, current *state.Template, changes *state.BundleChanges) (state.BundleChange, string, error) {
+	change := state.BundleChange{Kind: state.BundleKindTemplate, Name: req.TemplateName}
+	tpl, err := bs.templates.constructTemplateFromCreateTemplateRequest(&req)
+	if err != nil {
+		return change, "", err
+	}
+	if valid, reasons := tpl.IsValid(); !valid {
+		return change, fmt.Sprintf("template [%s]: %s", req.TemplateName, strings.Join(reasons, ", ")), nil
+	}
+	templateID, err := state.NewTemplateID(tpl)
+	if err != nil {
+		return change, "", err
+	}
+	tpl.TemplateID = templateID
+
+	if current == nil {
+		tpl.Version = 1
+		change.Action = state.BundleActionCreate
+		change.Version = tpl.Version
+		changes.CreateTemplates = append(changes.CreateTemplates, tpl)
+		return change, "", nil
+	}
+	fields, err := state.BundleFieldChanges(bundleTemplate(*current), bundleTemplate(tpl))
+	if err != nil {
+		return change, "", err
+	}
+	if len(fields) == 0 {
+		change.Action = state.BundleActionUnchanged
+		change.Version = current.Version
+		return change, "", nil
+	}
+
+	incompatibilities := state.SchemaIncompatibilities(current.Schema, tpl.Schema, tpl.Defaults)
+	if len(incompatibilities) > 0 && !req.AllowIncompatibleSchema {
+		return change, fmt.Sprintf("template [%s]: schema rejects payloads version [%d] accepted, set [allow_incompatible_schema] to allow it: %s",
+			req.TemplateName, current.Version, strings.Join(incompatibilities, ", ")), nil
+	}
+	tpl.Version = current.Version + 1
+	change.Action = state.BundleActionUpdate
+	change.Fields = fields
+	change.Version = tpl.Version
+	change.Incompatibilities = incompatibilities
+	changes.CreateTemplates = append(changes.CreateTemplates, tpl)
+	return change, "", nil
+}
+
+// planPrune plans the deletion of the definitions, and the deprecation of the
+// latest version of the templates, of the scope which the bundle doesn't
+// declare. Definitions with active runs aren't pruned, their runs would be
+// left without a definition.
+func (bs *bundleService) planPrune(ctx context.Context, scope state.BundleScope, declaredDefinitions map[string]bool, declaredTemplates map[string]bool, definitions map[string]*state.Definition, templates map[string]*state.Template, user string, changes *state.BundleChanges) ([]state.BundleChange, error) {
+	var pruned []state.BundleChange
+	var reasons []string
+	if scope.Includes(state.BundleKindDefinition) {
+		aliases := make([]string, 0, len(definitions))
+		for alias := range definitions {
+			aliases = append(aliases, alias)
+		}
+		sort.Strings(aliases)
+		for _, alias := range aliases {
+			d := definitions[alias]
+			if declaredDefinitions[alias] || !scope.IncludesDefinition(*d) {
+				continue
+			}
+			rl, err := bs.sm.ListRuns(ctx, 1, 0, "started_at", "asc", map[string][]string{
+				"definition_id": {d.DefinitionID},
+				"status":        state.StopStatuses,
+			}, nil, state.Engines)
+			if err != nil {
+				return nil, err
+			}
+			if rl.Total > 0 {
+				reasons = append(reasons, fmt.Sprintf("definition [%s] has [%d] active runs and can't be pruned", alias, rl.Total))
+				continue
+			}
+			pruned = append(pruned, state.BundleChange{Kind: state.BundleKindDefinition, Name: alias, Action: state.BundleActionDelete})
+			changes.DeleteDefinitions = append(changes.DeleteDefinitions, d.DefinitionID)
+		}
+	}
+	if scope.Includes(state.BundleKindTemplate) {
+		names := make([]string, 0, len(templates))
+		for name := range templates {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			t := templates[name]
+			if declaredTemplates[name] || !scope.IncludesTemplate(name) || t.Deprecation != nil {
+				continue
+			}
+			pruned = append(pruned, state.BundleChange{Kind: state.BundleKindTemplate, Name: name, Action: state.BundleActionDeprecate, Version: t.Version})
+			changes.DeprecateTemplates[t.TemplateID] = state.TemplateDeprecation{
+				Level:        state.TemplateDeprecationWarn,
+				Message:      "pruned from bundle",
+				By:           user,
+				DeprecatedAt: time.Now(),
+			}
+		}
+	}
+	if len(reasons) > 0 {
+		return nil, exceptions.ConflictingResource{ErrorString: strings.Join(reasons, "\n")}
+	}
+	return pruned, nil
+}
+
+// list returns the definitions, by alias, and the latest versions of the
+// templates, by name, of the scope.
+func (bs *bundleService) list(ctx context.Context, scope state.BundleScope) (map[string]*state.Definition, map[string]*state.Template, error) {
+	definitions := map[string]*state.Definition{}
+	templates := map[string]*state.Template{}
+	if scope.Includes(state.BundleKindDefinition) {
+		for offset := 0; ; offset += bundlePageSize {
+			dl, err := bs.sm.ListDefinitions(ctx, bundlePageSize, offset, "alias", "asc", nil, nil)
+			if err != nil {
+				return nil, nil, err
+			}
+			for i := range dl.Definitions {
+				if d := dl.Definitions[i]; scope.IncludesDefinition(d) {
+					definitions[d.Alias] = &d
+				}
+			}
+			if len(dl.Definitions) == 0 || offset+len(dl.Definitions) >= dl.Total {
+				break
+			}
+		}
+	}
+	if scope.Includes(state.BundleKindTemplate) {
+		for offset := 0; ; offset += bundlePageSize {
+			tl, err := bs.sm.ListTemplatesLatestOnly(ctx, bundlePageSize, offset, "template_name", "asc")
+			if err != nil {
+				return nil, nil, err
+			}
+			for i := range tl.Templates {
+				if t := tl.Templates[i]; scope.IncludesTemplate(t.TemplateName) {
+					templates[t.TemplateName] = &t
+				}
+			}
+			if len(tl.Templates) == 0 || offset+len(tl.Templates) >= tl.Total {
+				break
+			}
+		}
+	}
+	return definitions, templates, nil
+}
+
+// bundleTemplate returns the spec of a template version.
+func bundleTemplate(t state.Template) state.CreateTemplateRequest {
+	return state.CreateTemplateRequest{
+		TemplateName:        t.TemplateName,
+		Schema:              t.Schema,
+		CommandTemplate:     t.CommandTemplate,
+		Defaults:            t.Defaults,
+		AvatarURI:           t.AvatarURI,
+		ExecutableResources: t.ExecutableResources,
+	}
+}
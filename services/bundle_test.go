@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stitchfix/flotilla-os/config"
+	"github.com/stitchfix/flotilla-os/exceptions"
+	"github.com/stitchfix/flotilla-os/state"
+	"github.com/stitchfix/flotilla-os/testutils"
+)
+
+func setUpBundles(t *testing.T) (BundleService, *testutils.ImplementsAllTheThings) {
+	ts, imp := setUpTemplates(t)
+	mem := int64(512)
+	imp.Definitions = map[string]state.Definition{
+		"def-a": {DefinitionID: "def-a", Alias: "a", GroupName: "team", Command: "echo a", ExecutableResources: state.ExecutableResources{Image: "image:1", Memory: &mem}},
+		"def-b": {DefinitionID: "def-b", Alias: "b", GroupName: "team", Command: "echo b", ExecutableResources: state.ExecutableResources{Image: "image:1", Memory: &mem}},
+		"def-c": {DefinitionID: "def-c", Alias: "c", GroupName: "other", Command: "echo c", ExecutableResources: state.ExecutableResources{Image: "image:1", Memory: &mem}},
+	}
+	confDir := "../conf"
+	c, _ := config.NewConfig(&confDir)
+	bs, err := NewBundleService(c, ts.sm, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bs, imp
+}
+
+func applied(imp *testutils.ImplementsAllTheThings) bool {
+	for _, call := range imp.Calls {
+		if call == "ApplyBundle" {
+			return true
+		}
+	}
+	return false
+}
+
+func planActions(plan state.BundlePlan) string {
+	var actions []string
+	for _, change := range plan.Changes {
+		actions = append(actions, string(change.Kind)+"/"+change.Name+":"+string(change.Action))
+	}
+	return strings.Join(actions, " ")
+}
+
+func TestBundleService_ExportApply(t *testing.T) {
+	ctx := context.Background()
+	bs, imp := setUpBundles(t)
+
+	exported, err := bs.Export(ctx, state.BundleScope{GroupNames: []string{"team"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle, err := state.ParseBundle(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bundle.Definitions) != 2 || len(bundle.Templates) != 1 || bundle.Templates[0].CommandTemplate != "echo hello {{.name}}" {
+		t.Fatalf("expected the team's definitions and the latest template, got %+v", bundle)
+	}
+
+	plan, err := bs.Apply(ctx, exported, state.BundleScope{}, BundleApplyOptions{}, "somebody")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Applied || planActions(plan) != "Definition/a:unchanged Definition/b:unchanged Template/tpl:unchanged" {
+		t.Errorf("expected applying an export to change nothing, got %+v", plan)
+	}
+
+	bundle.Definitions[0].Command = "echo aa"
+	bundle.Definitions = bundle.Definitions[:1]
+	bundle.Templates[0].CommandTemplate = "echo hi {{.name}}"
+	data, err := state.EncodeBundle(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scope := state.BundleScope{GroupNames: []string{"team"}, TemplatePrefix: "tp"}
+	plan, err = bs.Apply(ctx, data, scope, BundleApplyOptions{DryRun: true, Prune: true}, "somebody")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if planActions(plan) != "Definition/a:update Template/tpl:update Definition/b:delete" || plan.Changes[1].Version != 3 {
+		t.Errorf("unexpected plan %+v", plan)
+	}
+	if plan.Applied || applied(imp) {
+		t.Errorf("expected dry runs not to apply the bundle")
+	}
+
+	plan, err = bs.Apply(ctx, data, scope, BundleApplyOptions{Prune: true}, "somebody")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.Applied {
+		t.Errorf("expected the bundle to be applied")
+	}
+	if _, ok := imp.Definitions["def-b"]; ok {
+		t.Errorf("expected definition b to be pruned")
+	}
+	if _, ok := imp.Definitions["def-c"]; !ok {
+		t.Errorf("expected definitions out of the scope to be kept")
+	}
+	if imp.Definitions["def-a"].Command != "echo aa" {
+		t.Errorf("expected definition a to be updated, got %+v", imp.Definitions["def-a"])
+	}
+	if len(imp.Templates) != 3 {
+		t.Errorf("expected a new template version, got %d versions", len(imp.Templates))
+	}
+}
+
+func TestBundleService_ApplyInvalid(t *testing.T) {
+	ctx := context.Background()
+	bs, imp := setUpBundles(t)
+
+	_, err := bs.Apply(ctx, []byte("apiVersion: flotilla/v1\nkind: Definition\nspec: {alias: d, image: i}"),
+		state.BundleScope{}, BundleApplyOptions{Prune: true}, "somebody")
+	if _, ok := err.(exceptions.MalformedInput); !ok {
+		t.Errorf("expected pruning without a scope to be refused, got %v", err)
+	}
+
+	data := `apiVersion: flotilla/v1
+kind: Definition
+spec: {alias: d, image: i}
+---
+apiVersion: flotilla/v1
+kind: Template
+spec:
+  template_name: tpl
+  image: image:1
+  command_template: echo {{.name}}
+  schema: {type: object, required: [name]}
+`
+	_, err = bs.Apply(ctx, []byte(data), state.BundleScope{}, BundleApplyOptions{}, "somebody")
+	if _, ok := err.(exceptions.MalformedInput); !ok || !strings.Contains(err.Error(), "allow_incompatible_schema") {
+		t.Errorf("expected the incompatible schema to be refused, got %v", err)
+	}
+	if applied(imp) {
+		t.Errorf("expected nothing to be applied when part of the bundle is invalid")
+	}
+}
+
+func TestBundleService_ApplyPruneActiveRuns(t *testing.T) {
+	ctx := context.Background()
+	bs, imp := setUpBundles(t)
+	imp.Runs = map[string]state.Run{
+		"run-b": {RunID: "run-b", DefinitionID: "def-b", Status: state.StatusRunning},
+	}
+
+	data := []byte("apiVersion: flotilla/v1\nkind: Definition\nspec: {alias: a, group_name: team, command: echo a, image: \"image:1\", memory: 512}")
+	scope := state.BundleScope{GroupNames: []string{"team"}, Kinds: []state.BundleKind{state.BundleKindDefinition}}
+	_, err := bs.Apply(ctx, data, scope, BundleApplyOptions{Prune: true}, "somebody")
+	if _, ok := err.(exceptions.ConflictingResource); !ok {
+		t.Errorf("expected pruning a definition with active runs to be refused, got %v", err)
+	}
+	if applied(imp) {
+		t.Errorf("expected nothing to be applied when a definition can't be pruned")
+	}
+	if _, ok := imp.Definitions["def-b"]; !ok {
+		t.Errorf("expected definition b to be kept")
+	}
+}
+
+func TestBundleService_ApplyPruneTemplateNamedLikeDefinition(t *testing.T) {
+	ctx := context.Background()
+	bs, _ := setUpBundles(t)
+
+	data := []byte(`apiVersion: flotilla/v1
+kind: Definition
+spec: {alias: a, group_name: team, command: echo a, image: "image:1", memory: 512}
+---
+apiVersion: flotilla/v1
+kind: Template
+spec:
+  template_name: b
+  image: image:1
+  command_template: echo {{.name}}
+  schema: {type: object}
+`)
+	scope := state.BundleScope{GroupNames: []string{"team"}, Kinds: []state.BundleKind{state.BundleKindDefinition}}
+	plan, err := bs.Apply(ctx, data, scope, BundleApplyOptions{DryRun: true, Prune: true}, "somebody")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(planActions(plan), "Definition/b:delete") {
+		t.Errorf("expected definition b to be pruned despite template b, got %+v", plan)
+	}
+}
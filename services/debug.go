@@ -0,0 +1,236 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/stitchfix/flotilla-os/config"
+	"github.com/stitchfix/flotilla-os/exceptions"
+	"github.com/stitchfix/flotilla-os/execution/engine"
+	"github.com/stitchfix/flotilla-os/state"
+	"github.com/stitchfix/flotilla-os/utils"
+)
+
+// DebugService opens debug sessions into the environment of runs and
+// records the execs into them.
+type DebugService interface {
+	Start(ctx context.Context, runID string, user string, req state.DebugSessionRequest) (state.DebugSession, error)
+	Get(ctx context.Context, sessionID string) (state.DebugSession, error)
+	List(ctx context.Context, runID string) (state.DebugSessionList, error)
+	Stop(ctx context.Context, sessionID string, user string) (state.DebugSession, error)
+	Exec(ctx context.Context, sessionID string, user string, command []string, streams engine.DebugStreams) error
+}
+
+type debugService struct {
+	sm         state.Manager
+	eksEngine  engine.Engine
+	defaultTTL time.Duration
+	maxTTL     time.Duration
+}
+
+// NewDebugService initializes a debug service.
+func NewDebugService(conf config.Config, sm state.Manager, eksEngine engine.Engine) (DebugService, error) {
+	ds := &debugService{sm: sm, eksEngine: eksEngine}
+	if conf.IsSet("debug_session_default_ttl_seconds") {
+		ds.defaultTTL = time.Duration(conf.GetInt("debug_session_default_ttl_seconds")) * time.Second
+	} else {
+		ds.defaultTTL = 15 * time.Minute
+	}
+	if conf.IsSet("debug_session_max_ttl_seconds") {
+		ds.maxTTL = time.Duration(conf.GetInt("debug_session_max_ttl_seconds")) * time.Second
+	} else {
+		ds.maxTTL = time.Hour
+	}
+	return ds, nil
+}
+
+// Start opens a debug session on the run. Twins can be launched for runs in
+// any state, ephemeral containers only join the pods of running runs.
+func (ds *debugService) Start(ctx context.Context, runID string, user string, req state.DebugSessionRequest) (state.DebugSession, error) {
+	ctx, span := utils.TraceJob(ctx, "flotilla.debug.start", runID)
+	defer span.Finish()
+
+	if len(req.Mode) == 0 {
+		req.Mode = state.DebugModeTwin
+	}
+	if req.Mode != state.DebugModeTwin && req.Mode != state.DebugModeEphemeral {
+		return state.DebugSession{}, exceptions.MalformedInput{ErrorString: fmt.Sprintf("invalid debug mode [%s], must be one of [%s, %s]", req.Mode, state.DebugModeTwin, state.DebugModeEphemeral)}
+	}
+	ttl := ds.defaultTTL
+	if req.TTLSeconds > 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+	if ttl > ds.maxTTL {
+		return state.DebugSession{}, exceptions.MalformedInput{ErrorString: fmt.Sprintf("ttl_seconds must be at most %d", int64(ds.maxTTL.Seconds()))}
+	}
+
+	run, err := ds.sm.GetRun(ctx, runID)
+	if err != nil {
+		return state.DebugSession{}, err
+	}
+	if run.Engine == nil || *run.Engine != state.EKSEngine {
+		return state.DebugSession{}, exceptions.MalformedInput{ErrorString: fmt.Sprintf("run [%s] doesn't run on %s, it can't be debugged", run.RunID, state.EKSEngine)}
+	}
+	if req.Mode == state.DebugModeEphemeral && run.Status != state.StatusRunning {
+		return state.DebugSession{}, exceptions.ConflictingResource{ErrorString: fmt.Sprintf("run [%s] is %s, ephemeral debug sessions need a running run", run.RunID, run.Status)}
+	}
+	debugger, ok := ds.eksEngine.(engine.Debugger)
+	if !ok {
+		return state.DebugSession{}, exceptions.MalformedInput{ErrorString: "debug sessions are not supported"}
+	}
+
+	if run.ExecutableType == nil {
+		defaultExecutableType := state.ExecutableTypeDefinition
+		run.ExecutableType = &defaultExecutableType
+	}
+	if run.ExecutableID == nil {
+		defID := run.DefinitionID
+		run.ExecutableID = &defID
+	}
+	executable, err := ds.sm.GetExecutableByTypeAndID(ctx, *run.ExecutableType, *run.ExecutableID)
+	if err != nil {
+		return state.DebugSession{}, err
+	}
+
+	sessionID, err := state.NewDebugSessionID()
+	if err != nil {
+		return state.DebugSession{}, err
+	}
+	now := time.Now()
+	session := state.DebugSession{
+		SessionID:   sessionID,
+		RunID:       run.RunID,
+		Mode:        req.Mode,
+		User:        user,
+		ClusterName: run.ClusterName,
+		Image:       req.Image,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(ttl),
+	}
+	span.SetTag("debug.session_id", sessionID)
+	if session, err = debugger.StartDebugSession(ctx, executable, run, session, ds.sm); err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return session, err
+	}
+	if err = ds.sm.CreateDebugSession(ctx, session); err != nil {
+		return session, err
+	}
+	return withExecURI(session), nil
+}
+
+// Get returns the debug session.
+func (ds *debugService) Get(ctx context.Context, sessionID string) (state.DebugSession, error) {
+	session, err := ds.sm.GetDebugSession(ctx, sessionID)
+	if err != nil {
+		return session, err
+	}
+	return withExecURI(session), nil
+}
+
+// List returns the debug sessions of the run, most recent first.
+func (ds *debugService) List(ctx context.Context, runID string) (state.DebugSessionList, error) {
+	if _, err := ds.sm.GetRun(ctx, runID); err != nil {
+		return state.DebugSessionList{}, err
+	}
+	list, err := ds.sm.ListDebugSessions(ctx, runID)
+	if err != nil {
+		return list, err
+	}
+	for i := range list.Sessions {
+		list.Sessions[i] = withExecURI(list.Sessions[i])
+	}
+	return list, nil
+}
+
+// Stop terminates the debug session, removing its twin.
+func (ds *debugService) Stop(ctx context.Context, sessionID string, user string) (state.DebugSession, error) {
+	ctx, span := utils.TraceJob(ctx, "flotilla.debug.stop", "")
+	defer span.Finish()
+	span.SetTag("debug.session_id", sessionID)
+
+	session, err := ds.sm.GetDebugSession(ctx, sessionID)
+	if err != nil {
+		return session, err
+	}
+	if session.TerminatedAt != nil {
+		return withExecURI(session), nil
+	}
+	debugger, ok := ds.eksEngine.(engine.Debugger)
+	if !ok {
+		return session, exceptions.MalformedInput{ErrorString: "debug sessions are not supported"}
+	}
+	if err = debugger.StopDebugSession(ctx, session); err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return session, err
+	}
+	now := time.Now()
+	session, err = ds.sm.UpdateDebugSession(ctx, sessionID, state.DebugSession{
+		TerminatedAt: &now,
+		TerminatedBy: &user,
+	})
+	if err != nil {
+		return session, err
+	}
+	return withExecURI(session), nil
+}
+
+// Exec runs the command in the session's container, recording the exec in
+// the session's audit trail when it starts and again once it ends.
+func (ds *debugService) Exec(ctx context.Context, sessionID string, user string, command []string, streams engine.DebugStreams) error {
+	ctx, span := utils.TraceJob(ctx, "flotilla.debug.exec", "")
+	defer span.Finish()
+	span.SetTag("debug.session_id", sessionID)
+
+	if len(command) == 0 {
+		return exceptions.MalformedInput{ErrorString: "a command is required"}
+	}
+	session, err := ds.sm.GetDebugSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if !session.Active(time.Now()) {
+		return exceptions.ConflictingResource{ErrorString: fmt.Sprintf("debug session [%s] has ended", sessionID)}
+	}
+	debugger, ok := ds.eksEngine.(engine.Debugger)
+	if !ok {
+		return exceptions.MalformedInput{ErrorString: "debug sessions are not supported"}
+	}
+
+	execID, err := state.NewDebugExecID()
+	if err != nil {
+		return err
+	}
+	// Execs are audited before they run, they may never end.
+	exec := state.DebugExec{ExecID: execID, User: user, Command: command, StartedAt: time.Now()}
+	if _, err = ds.sm.UpdateDebugSession(ctx, sessionID, state.DebugSession{Execs: &state.DebugExecs{exec}}); err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return err
+	}
+
+	ran, err := debugger.ExecDebugSession(ctx, session, command, streams)
+	endedAt := time.Now()
+	exec.EndedAt = &endedAt
+	if err != nil {
+		exec.Error = err.Error()
+	}
+	// The exec may have ended with the client, its end is recorded regardless.
+	_, updateErr := ds.sm.UpdateDebugSession(context.Background(), sessionID, state.DebugSession{
+		PodName: ran.PodName,
+		Execs:   &state.DebugExecs{exec},
+	})
+	if err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return err
+	}
+	return updateErr
+}
+
+func withExecURI(session state.DebugSession) state.DebugSession {
+	session.ExecURI = fmt.Sprintf("/api/v6/debug/%s/exec", session.SessionID)
+	return session
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stitchfix/flotilla-os/config"
+	"github.com/stitchfix/flotilla-os/exceptions"
+	"github.com/stitchfix/flotilla-os/execution/engine"
+	"github.com/stitchfix/flotilla-os/state"
+	"github.com/stitchfix/flotilla-os/testutils"
+)
+
+func setUpDebugServiceTest(t *testing.T) (DebugService, *testutils.ImplementsAllTheThings) {
+	confDir := "../conf"
+	c, _ := config.NewConfig(&confDir)
+	eks := state.EKSEngine
+	podName := "running-pod"
+	imp := testutils.ImplementsAllTheThings{
+		T: t,
+		Definitions: map[string]state.Definition{
+			"A": {DefinitionID: "A"},
+		},
+		Runs: map[string]state.Run{
+			"running": {DefinitionID: "A", RunID: "running", Status: state.StatusRunning, Engine: &eks, ClusterName: "clusta", PodName: &podName},
+			"failed":  {DefinitionID: "A", RunID: "failed", Status: state.StatusStopped, Engine: &eks, ClusterName: "clusta"},
+		},
+	}
+	ds, _ := NewDebugService(c, &imp, &imp)
+	return ds, &imp
+}
+
+func TestDebugService_Start(t *testing.T) {
+	ctx := context.Background()
+	ds, imp := setUpDebugServiceTest(t)
+
+	session, err := ds.Start(ctx, "failed", "somebody", state.DebugSessionRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Mode != state.DebugModeTwin || session.JobName != session.SessionID {
+		t.Errorf("expected a twin to be launched by default, got %+v", session)
+	}
+	if session.ClusterName != "clusta" || session.User != "somebody" {
+		t.Errorf("unexpected session %+v", session)
+	}
+	if ttl := session.ExpiresAt.Sub(session.CreatedAt); ttl != 15*time.Minute {
+		t.Errorf("expected the default ttl, got %v", ttl)
+	}
+	if session.ExecURI != "/api/v6/debug/"+session.SessionID+"/exec" {
+		t.Errorf("unexpected exec uri %s", session.ExecURI)
+	}
+	if _, ok := imp.DebugSessions[session.SessionID]; !ok {
+		t.Errorf("expected the session to be recorded")
+	}
+
+	_, err = ds.Start(ctx, "failed", "somebody", state.DebugSessionRequest{Mode: state.DebugModeEphemeral})
+	if _, ok := err.(exceptions.ConflictingResource); !ok {
+		t.Errorf("expected ephemeral sessions on stopped runs to conflict, got %v", err)
+	}
+	_, err = ds.Start(ctx, "failed", "somebody", state.DebugSessionRequest{TTLSeconds: 24 * 3600})
+	if _, ok := err.(exceptions.MalformedInput); !ok {
+		t.Errorf("expected ttls past the max to be refused, got %v", err)
+	}
+
+	session, err = ds.Start(ctx, "running", "somebody", state.DebugSessionRequest{Mode: state.DebugModeEphemeral, TTLSeconds: 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.PodName != "running-pod" || len(session.JobName) != 0 {
+		t.Errorf("expected the ephemeral container to join the run's pod, got %+v", session)
+	}
+}
+
+func TestDebugService_ExecAndStop(t *testing.T) {
+	ctx := context.Background()
+	ds, imp := setUpDebugServiceTest(t)
+
+	session, err := ds.Start(ctx, "failed", "somebody", state.DebugSessionRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ds.Exec(ctx, session.SessionID, "somebody", []string{"ls"}, engine.DebugStreams{}); err != nil {
+		t.Fatal(err)
+	}
+	recorded := imp.DebugSessions[session.SessionID]
+	if recorded.Execs == nil || len(*recorded.Execs) != 1 || (*recorded.Execs)[0].Command[0] != "ls" {
+		t.Errorf("expected the exec to be audited, got %+v", recorded.Execs)
+	}
+	if recorded.PodName != session.JobName+"-pod" {
+		t.Errorf("expected the twin's pod to be recorded, got %s", recorded.PodName)
+	}
+
+	stopped, err := ds.Stop(ctx, session.SessionID, "somebody-else")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stopped.TerminatedAt == nil || *stopped.TerminatedBy != "somebody-else" {
+		t.Errorf("expected the session to be terminated, got %+v", stopped)
+	}
+	err = ds.Exec(ctx, session.SessionID, "somebody", []string{"ls"}, engine.DebugStreams{})
+	if _, ok := err.(exceptions.ConflictingResource); !ok {
+		t.Errorf("expected execs into terminated sessions to conflict, got %v", err)
+	}
+}
+
+// auditedDebugger records the execs of the session while its command runs.
+type auditedDebugger struct {
+	*testutils.ImplementsAllTheThings
+	running state.DebugExecs
+}
+
+func (d *auditedDebugger) ExecDebugSession(ctx context.Context, session state.DebugSession, command []string, streams engine.DebugStreams) (state.DebugSession, error) {
+	if execs := d.DebugSessions[session.SessionID].Execs; execs != nil {
+		d.running = append(state.DebugExecs{}, *execs...)
+	}
+	return d.ImplementsAllTheThings.ExecDebugSession(ctx, session, command, streams)
+}
+
+func TestDebugService_ExecAuditedOnStart(t *testing.T) {
+	ctx := context.Background()
+	confDir := "../conf"
+	c, _ := config.NewConfig(&confDir)
+	_, imp := setUpDebugServiceTest(t)
+	debugger := &auditedDebugger{ImplementsAllTheThings: imp}
+	ds, _ := NewDebugService(c, imp, debugger)
+
+	session, err := ds.Start(ctx, "failed", "somebody", state.DebugSessionRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ds.Exec(ctx, session.SessionID, "somebody", []string{"sleep", "3600"}, engine.DebugStreams{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(debugger.running) != 1 || debugger.running[0].EndedAt != nil || debugger.running[0].Command[0] != "sleep" {
+		t.Errorf("expected the exec to be recorded before it ran, got %+v", debugger.running)
+	}
+	recorded := *imp.DebugSessions[session.SessionID].Execs
+	if len(recorded) != 1 || recorded[0].ExecID != debugger.running[0].ExecID || recorded[0].EndedAt == nil {
+		t.Errorf("expected the exec to be ended once it returned, got %+v", recorded)
+	}
+}
@@ -3,6 +3,8 @@ package services
 import (
 	"context"
 	"fmt"
+	"github.com/stitchfix/flotilla-os/clients/registry"
+	"github.com/stitchfix/flotilla-os/config"
 	"github.com/stitchfix/flotilla-os/exceptions"
 	"github.com/stitchfix/flotilla-os/state"
 	"strings"
@@ -29,14 +31,15 @@ type DefinitionService interface {
 }
 
 type definitionService struct {
-	sm state.Manager
+	sm     state.Manager
+	images imageChecker
 }
 
 //
 // NewDefinitionService configures and returns a DefinitionService
 //
-func NewDefinitionService(stateManager state.Manager) (DefinitionService, error) {
-	ds := definitionService{sm: stateManager}
+func NewDefinitionService(conf config.Config, stateManager state.Manager, registryClient registry.Client) (DefinitionService, error) {
+	ds := definitionService{sm: stateManager, images: newImageChecker(conf, registryClient)}
 	return &ds, nil
 }
 
@@ -60,6 +63,15 @@ func (ds *definitionService) Create(ctx context.Context, definition *state.Defin
 		return state.Definition{}, exceptions.ConflictingResource{
 			fmt.Sprintf("definition with alias [%s] aleady exists", definition.Alias)}
 	}
+
+	if _, err = ds.images.check(ctx, definition.Image, ""); err != nil {
+		return state.Definition{}, err
+	}
+	for _, image := range definition.ContainerImages() {
+		if _, err = ds.images.check(ctx, image, ""); err != nil {
+			return state.Definition{}, err
+		}
+	}
 	// Attach definition id here
 	definitionID, err := state.NewDefinitionID(*definition)
 	if err != nil {
@@ -112,6 +124,26 @@ func (ds *definitionService) Update(ctx context.Context, definitionID string, up
 	}
 
 	definition.UpdateWith(updates)
+	if len(updates.Image) > 0 {
+		if _, err = ds.images.check(ctx, definition.Image, ""); err != nil {
+			return definition, err
+		}
+	}
+	if updates.Volumes != nil {
+		if reasons := definition.Volumes.Validate(); len(reasons) > 0 {
+			return definition, exceptions.MalformedInput{ErrorString: strings.Join(reasons, "\n")}
+		}
+	}
+	if updates.InitContainers != nil || updates.Sidecars != nil || updates.SharedVolumes != nil || updates.Volumes != nil {
+		if reasons := definition.ValidateContainers(); len(reasons) > 0 {
+			return definition, exceptions.MalformedInput{ErrorString: strings.Join(reasons, "\n")}
+		}
+		for _, image := range definition.ContainerImages() {
+			if _, err = ds.images.check(ctx, image, ""); err != nil {
+				return definition, err
+			}
+		}
+	}
 	return ds.sm.UpdateDefinition(ctx, definitionID, definition)
 }
 
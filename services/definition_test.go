@@ -2,12 +2,16 @@ package services
 
 import (
 	"context"
+	"github.com/stitchfix/flotilla-os/config"
+	"github.com/stitchfix/flotilla-os/exceptions"
 	"github.com/stitchfix/flotilla-os/state"
 	"github.com/stitchfix/flotilla-os/testutils"
 	"testing"
 )
 
 func setUpDefinitionServiceTest(t *testing.T) (DefinitionService, *testutils.ImplementsAllTheThings) {
+	confDir := "../conf"
+	c, _ := config.NewConfig(&confDir)
 	imp := testutils.ImplementsAllTheThings{
 		T: t,
 		Definitions: map[string]state.Definition{
@@ -24,7 +28,7 @@ func setUpDefinitionServiceTest(t *testing.T) (DefinitionService, *testutils.Imp
 			"B": "b/",
 		},
 	}
-	ds, _ := NewDefinitionService(&imp)
+	ds, _ := NewDefinitionService(c, &imp, &imp)
 	return ds, &imp
 }
 
@@ -50,7 +54,7 @@ func TestDefinitionService_Create(t *testing.T) {
 	}
 
 	// order matters
-	expected := []string{"ListDefinitions", "CreateDefinition"}
+	expected := []string{"ListDefinitions", "ResolveImage", "CreateDefinition"}
 	if len(imp.Calls) != len(expected) {
 		t.Errorf("Unexpected number of create calls, expected %v but was %v", len(expected), len(imp.Calls))
 	}
@@ -84,6 +88,29 @@ func TestDefinitionService_Create2(t *testing.T) {
 	}
 }
 
+func TestDefinitionService_CreateInvalidImage(t *testing.T) {
+	ds, imp := setUpDefinitionServiceTest(t)
+	memory := int64(512)
+	d := state.Definition{
+		Alias:     "cupcake",
+		GroupName: "group-cupcake",
+		Command:   "echo 'hi'",
+		ExecutableResources: state.ExecutableResources{
+			Image:  "invalidimage",
+			Memory: &memory,
+		},
+	}
+	_, err := ds.Create(context.Background(), &d)
+	if _, ok := err.(exceptions.MalformedInput); !ok {
+		t.Errorf("Expected definition with a missing image to result in MalformedInput but was %v", err)
+	}
+	for _, call := range imp.Calls {
+		if call == "CreateDefinition" {
+			t.Errorf("Expected definition with a missing image not to be saved")
+		}
+	}
+}
+
 func TestDefinitionService_Update(t *testing.T) {
 	ds, imp := setUpDefinitionServiceTest(t)
 	memory := int64(512)
@@ -105,6 +132,22 @@ func TestDefinitionService_Update(t *testing.T) {
 	}
 }
 
+func TestDefinitionService_UpdateInvalidImage(t *testing.T) {
+	ds, imp := setUpDefinitionServiceTest(t)
+	d := state.Definition{
+		ExecutableResources: state.ExecutableResources{Image: "invalidimage"},
+	}
+	_, err := ds.Update(context.Background(), "A", d)
+	if _, ok := err.(exceptions.MalformedInput); !ok {
+		t.Errorf("Expected update to a missing image to result in MalformedInput but was %v", err)
+	}
+
+	expected := []string{"GetDefinition", "ResolveImage"}
+	if len(imp.Calls) != len(expected) {
+		t.Errorf("Unexpected number of update calls, expected %v but was %v", len(expected), len(imp.Calls))
+	}
+}
+
 func TestDefinitionService_Delete(t *testing.T) {
 	ds, imp := setUpDefinitionServiceTest(t)
 	ds.Delete(context.Background(), "A")
@@ -3,11 +3,10 @@ package services
 import (
 	"context"
 	"crypto/md5"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"math/rand"
-	"regexp"
+	"net/http"
 	"slices"
 	"strconv"
 	"strings"
@@ -17,7 +16,9 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws"
 
+	"github.com/stitchfix/flotilla-os/clients/artifacts"
 	"github.com/stitchfix/flotilla-os/clients/cluster"
+	"github.com/stitchfix/flotilla-os/clients/registry"
 	"github.com/stitchfix/flotilla-os/config"
 	"github.com/stitchfix/flotilla-os/exceptions"
 	"github.com/stitchfix/flotilla-os/execution/engine"
@@ -30,6 +31,7 @@ import (
 type ExecutionService interface {
 	CreateDefinitionRunByDefinitionID(ctx context.Context, definitionID string, req *state.DefinitionExecutionRequest) (state.Run, error)
 	CreateDefinitionRunByAlias(ctx context.Context, alias string, req *state.DefinitionExecutionRequest) (state.Run, error)
+	CreateDefinitionArrayRun(ctx context.Context, definitionID string, req *state.DefinitionExecutionRequest, spec state.ArraySpec) (state.Run, error)
 	List(
 		ctx context.Context,
 		limit int,
@@ -40,17 +42,24 @@ type ExecutionService interface {
 		envFilters map[string]string) (state.RunList, error)
 	Get(ctx context.Context, runID string) (state.Run, error)
 	UpdateStatus(ctx context.Context, runID string, status string, exitCode *int64, runExceptions *state.RunExceptions, exitReason *string) error
-	Terminate(ctx context.Context, runID string, userInfo state.UserInfo) error
+	Terminate(ctx context.Context, runID string, userInfo state.UserInfo, req state.StopRequest) error
+	BulkTerminate(ctx context.Context, filters map[string][]string, envFilters map[string]string, userInfo state.UserInfo, req state.BulkStopRequest) (state.BulkStopResult, error)
 	ReservedVariables() []string
 	ListClusters(ctx context.Context) ([]state.ClusterMetadata, error)
 	GetDefaultCluster() string
 	GetEvents(ctx context.Context, run state.Run) (state.PodEventList, error)
 	CreateTemplateRunByTemplateID(ctx context.Context, templateID string, req *state.TemplateExecutionRequest) (state.Run, error)
 	CreateTemplateRunByTemplateName(ctx context.Context, templateName string, templateVersion string, req *state.TemplateExecutionRequest) (state.Run, error)
+	CreateTemplateArrayRun(ctx context.Context, templateID string, req *state.TemplateExecutionRequest, spec state.ArraySpec) (state.Run, error)
+	RenderDefinitionRunByDefinitionID(ctx context.Context, definitionID string, req *state.DefinitionExecutionRequest) (engine.RenderedRun, error)
+	RenderDefinitionRunByAlias(ctx context.Context, alias string, req *state.DefinitionExecutionRequest) (engine.RenderedRun, error)
+	RenderTemplateRunByTemplateID(ctx context.Context, templateID string, req *state.TemplateExecutionRequest) (engine.RenderedRun, error)
+	RenderTemplateRunByTemplateName(ctx context.Context, templateName string, templateVersion string, req *state.TemplateExecutionRequest) (engine.RenderedRun, error)
 	UpdateClusterMetadata(ctx context.Context, cluster state.ClusterMetadata) error
 	DeleteClusterMetadata(ctx context.Context, clusterID string) error
 	GetClusterByID(ctx context.Context, clusterID string) (state.ClusterMetadata, error)
 	GetRunStatus(ctx context.Context, runID string) (state.RunStatus, error)
+	ProxyPort(ctx context.Context, runID string, port int, prefix string) (http.Handler, error)
 }
 
 type executionService struct {
@@ -60,17 +69,18 @@ type executionService struct {
 	emrExecutionEngine    engine.Engine
 	reservedEnv           map[string]func(run state.Run) string
 	eksClusterOverride    string
-	eksClusterDefault     string
-	eksTierDefault        string
 	eksGPUClusterOverride string
-	eksGPUClusterDefault  string
-	checkImageValidity    bool
+	settings              *state.Settings
+	images                imageChecker
 	baseUri               string
-	spotReAttemptOverride float32
-	eksSpotOverride       bool
-	spotThresholdMinutes  float64
+	arrayMaxSize          int
+	arrayMaxParallelism   int64
+	maxReplicas           int64
+	maxStopGracePeriod    int64
+	bulkStopMaxRuns       int
 	terminateJobChannel   chan state.TerminateJob
 	validEksClusters      []string
+	stuckRunDetector      *state.StuckRunDetector
 	//validEksClusterTiers  string
 }
 
@@ -81,13 +91,15 @@ func (es *executionService) GetEvents(ctx context.Context, run state.Run) (state
 	return es.eksExecutionEngine.GetEvents(ctx, run)
 }
 
-// NewExecutionService configures and returns an ExecutionService
-func NewExecutionService(conf config.Config, eksExecutionEngine engine.Engine, sm state.Manager, eksClusterClient cluster.Client, emrExecutionEngine engine.Engine) (ExecutionService, error) {
+// NewExecutionService configures and returns an ExecutionService. The
+// default clusters and tier, and the spot policy, follow the settings.
+func NewExecutionService(conf config.Config, eksExecutionEngine engine.Engine, sm state.Manager, eksClusterClient cluster.Client, emrExecutionEngine engine.Engine, registryClient registry.Client, settings *state.Settings) (ExecutionService, error) {
 	es := executionService{
 		stateManager:       sm,
 		eksClusterClient:   eksClusterClient,
 		eksExecutionEngine: eksExecutionEngine,
 		emrExecutionEngine: emrExecutionEngine,
+		settings:           settings,
 	}
 	//
 	// Reserved environment variables dynamically generated
@@ -104,43 +116,61 @@ func NewExecutionService(conf config.Config, eksExecutionEngine engine.Engine, s
 	}
 	es.eksClusterOverride = conf.GetString("eks_cluster_override")
 	es.eksGPUClusterOverride = conf.GetString("eks_gpu_cluster_override")
-	es.eksClusterDefault = conf.GetString("eks_cluster_default")
-	es.eksGPUClusterDefault = conf.GetString("eks_gpu_cluster_default")
-	es.eksTierDefault = conf.GetString("eks_tier_default")
 	//es.validEksClusterTiers = conf.GetString("eks_cluster_tiers")
 
-	if !slices.Contains(es.validEksClusters, es.eksClusterDefault) || !slices.Contains(es.validEksClusters, es.eksGPUClusterDefault) {
-		return nil, fmt.Errorf("an invalid cluster has been set as a default\nvalid_clusters:%s\neks_cluster_default:%s\neks_gpu_cluster_default:%s", es.validEksClusters, es.eksClusterDefault, es.eksGPUClusterDefault)
+	clusterDefault := settings.String(state.SettingClusterDefault)
+	gpuClusterDefault := settings.String(state.SettingGPUClusterDefault)
+	for _, name := range []string{clusterDefault, gpuClusterDefault} {
+		known, err := isKnownCluster(context.Background(), sm, es.validEksClusters, name)
+		if err != nil {
+			return nil, err
+		}
+		if known {
+			continue
+		}
+		return nil, fmt.Errorf("an invalid cluster has been set as a default\nvalid_clusters:%s\neks_cluster_default:%s\neks_gpu_cluster_default:%s", es.validEksClusters, clusterDefault, gpuClusterDefault)
 	}
 
-	if conf.IsSet("check_image_validity") {
-		es.checkImageValidity = conf.GetBool("check_image_validity")
-	} else {
-		es.checkImageValidity = true
-	}
+	es.images = newImageChecker(conf, registryClient)
 
 	if conf.IsSet("base_uri") {
 		es.baseUri = conf.GetString("base_uri")
 	}
 
-	if conf.IsSet("eks_spot_reattempt_override") {
-		es.spotReAttemptOverride = float32(conf.GetFloat64("eks_spot_reattempt_override"))
+	if conf.IsSet("array_max_size") {
+		es.arrayMaxSize = conf.GetInt("array_max_size")
 	} else {
-		// defaults to 5% override.
-		es.spotReAttemptOverride = float32(0.05)
+		es.arrayMaxSize = 1000
 	}
 
-	if conf.IsSet("eks_spot_override") {
-		es.eksSpotOverride = conf.GetBool("eks_spot_override")
+	if conf.IsSet("array_max_parallelism") {
+		es.arrayMaxParallelism = int64(conf.GetInt("array_max_parallelism"))
 	} else {
-		es.eksSpotOverride = false
+		es.arrayMaxParallelism = 100
 	}
 
-	if conf.IsSet("eks_spot_threshold_minutes") {
-		es.spotThresholdMinutes = conf.GetFloat64("eks_spot_threshold_minutes")
+	if conf.IsSet("eks_max_replicas") {
+		es.maxReplicas = int64(conf.GetInt("eks_max_replicas"))
 	} else {
-		es.spotThresholdMinutes = 30.0
+		es.maxReplicas = 16
+	}
+
+	if conf.IsSet("stop_max_grace_period_seconds") {
+		es.maxStopGracePeriod = int64(conf.GetInt("stop_max_grace_period_seconds"))
+	} else {
+		es.maxStopGracePeriod = 3600
+	}
+	if conf.IsSet("bulk_stop_max_runs") {
+		es.bulkStopMaxRuns = conf.GetInt("bulk_stop_max_runs")
+	} else {
+		es.bulkStopMaxRuns = 1000
+	}
+
+	stuckRunDetector, err := state.NewStuckRunDetector(conf)
+	if err != nil {
+		return nil, err
 	}
+	es.stuckRunDetector = stuckRunDetector
 
 	es.reservedEnv = map[string]func(run state.Run) string{
 		"FLOTILLA_SERVER_MODE": func(run state.Run) string {
@@ -157,6 +187,12 @@ func NewExecutionService(conf config.Config, eksExecutionEngine engine.Engine, s
 		},
 	}
 
+	if conf.IsSet("artifacts_s3_bucket") {
+		es.reservedEnv[state.OutputURIVar] = func(run state.Run) string {
+			return artifacts.OutputURI(conf, run.RunID)
+		}
+	}
+
 	es.terminateJobChannel = make(chan state.TerminateJob, 100)
 	return &es, nil
 }
@@ -205,10 +241,17 @@ func (es *executionService) CreateDefinitionRunByAlias(ctx context.Context, alia
 }
 
 func (es *executionService) createFromDefinition(ctx context.Context, definition state.Definition, req *state.DefinitionExecutionRequest) (state.Run, error) {
-	var (
-		run state.Run
-		err error
-	)
+	run, err := es.resolveRunFromDefinition(ctx, definition, req)
+	if err != nil {
+		return run, err
+	}
+	return es.createAndEnqueueRun(ctx, run)
+}
+
+// resolveRunFromDefinition selects the cluster of the run and constructs it,
+// without creating it.
+func (es *executionService) resolveRunFromDefinition(ctx context.Context, definition state.Definition, req *state.DefinitionExecutionRequest) (state.Run, error) {
+	var run state.Run
 	ctx, span := utils.TraceJob(ctx, "flotilla.definition.create_run", run.RunID)
 	defer span.Finish()
 
@@ -226,7 +269,7 @@ func (es *executionService) createFromDefinition(ctx context.Context, definition
 
 		if required, cluster overrides should be introduced and set here
 	*/
-	clusterMetadata, err := es.ListClusters(ctx)
+	clusterMetadata, _ := es.ListClusters(ctx)
 	var activeClusters []string
 	if len(clusterMetadata) > 0 {
 		for _, cluster := range clusterMetadata {
@@ -244,10 +287,8 @@ func (es *executionService) createFromDefinition(ctx context.Context, definition
 		fields.ClusterName = activeClusters[rand.Intn(len(activeClusters))]
 	} else if definition.TargetCluster != "" {
 		fields.ClusterName = definition.TargetCluster
-	} else if fields.Gpu != nil && *fields.Gpu > 0 {
-		fields.ClusterName = es.eksGPUClusterDefault
 	} else {
-		fields.ClusterName = es.eksClusterDefault
+		fields.ClusterName = es.defaultClusterName(fields.Gpu)
 	}
 
 	for _, c := range clusterMetadata {
@@ -260,11 +301,54 @@ func (es *executionService) createFromDefinition(ctx context.Context, definition
 	run.User = req.OwnerID
 	es.sanitizeExecutionRequestCommonFields(fields)
 	// Construct run object with StatusQueued and new UUID4 run id
-	run, err = es.constructRunFromDefinition(ctx, definition, req)
+	return es.constructRunFromDefinition(ctx, definition, req)
+}
+
+// RenderDefinitionRunByDefinitionID resolves a run like CreateDefinitionRunByDefinitionID
+// and returns what would be submitted for it, without creating or queuing it.
+func (es *executionService) RenderDefinitionRunByDefinitionID(ctx context.Context, definitionID string, req *state.DefinitionExecutionRequest) (engine.RenderedRun, error) {
+	ctx, span := utils.TraceJob(ctx, "flotilla.definition.render_run", "")
+	defer span.Finish()
+	span.SetTag("definition_id", definitionID)
+
+	definition, err := es.stateManager.GetDefinition(ctx, definitionID)
 	if err != nil {
-		return run, err
+		return engine.RenderedRun{}, err
 	}
-	return es.createAndEnqueueRun(ctx, run)
+	run, err := es.resolveRunFromDefinition(ctx, definition, req)
+	if err != nil {
+		return engine.RenderedRun{Run: run}, err
+	}
+	return es.render(ctx, definition, run)
+}
+
+// RenderDefinitionRunByAlias resolves a run like CreateDefinitionRunByAlias and
+// returns what would be submitted for it, without creating or queuing it.
+func (es *executionService) RenderDefinitionRunByAlias(ctx context.Context, alias string, req *state.DefinitionExecutionRequest) (engine.RenderedRun, error) {
+	ctx, span := utils.TraceJob(ctx, "flotilla.alias.render_run", "")
+	defer span.Finish()
+	span.SetTag("alias", alias)
+
+	definition, err := es.stateManager.GetDefinitionByAlias(ctx, alias)
+	if err != nil {
+		return engine.RenderedRun{}, err
+	}
+	run, err := es.resolveRunFromDefinition(ctx, definition, req)
+	if err != nil {
+		return engine.RenderedRun{Run: run}, err
+	}
+	return es.render(ctx, definition, run)
+}
+
+// render checks the image of the run and has the engine of the run render it.
+func (es *executionService) render(ctx context.Context, executable state.Executable, run state.Run) (engine.RenderedRun, error) {
+	if err := es.checkRunImage(ctx, &run); err != nil {
+		return engine.RenderedRun{Run: run}, err
+	}
+	if *run.Engine == state.EKSEngine {
+		return es.eksExecutionEngine.Render(ctx, executable, run, es.stateManager)
+	}
+	return es.emrExecutionEngine.Render(ctx, executable, run, es.stateManager)
 }
 
 func (es *executionService) constructRunFromDefinition(ctx context.Context, definition state.Definition, req *state.DefinitionExecutionRequest) (state.Run, error) {
@@ -321,6 +405,9 @@ func (es *executionService) constructBaseRunFromExecutable(ctx context.Context,
 	if *fields.Engine == state.EKSEngine {
 		executableCmd, err := executable.GetExecutableCommand(req)
 		if err != nil {
+			if _, ok := err.(state.TemplatePayloadErrors); ok {
+				return run, exceptions.MalformedInput{ErrorString: err.Error()}
+			}
 			return run, err
 		}
 
@@ -331,7 +418,7 @@ func (es *executionService) constructBaseRunFromExecutable(ctx context.Context,
 
 		taskExecutionMinutes, _ := es.stateManager.GetTaskHistoricalRuntime(ctx, *executableID, runID)
 		reAttemptRate, _ := es.stateManager.GetPodReAttemptRate(ctx)
-		if reAttemptRate >= es.spotReAttemptOverride &&
+		if reAttemptRate >= float32(es.settings.Float64(state.SettingSpotReattemptOverride)) &&
 			fields.Engine != nil &&
 			fields.NodeLifecycle != nil &&
 			*fields.Engine == state.EKSEngine &&
@@ -339,7 +426,7 @@ func (es *executionService) constructBaseRunFromExecutable(ctx context.Context,
 			fields.NodeLifecycle = &state.OndemandLifecycle
 		}
 
-		if taskExecutionMinutes > float32(es.spotThresholdMinutes) {
+		if taskExecutionMinutes > float32(es.settings.Float64(state.SettingSpotThresholdMinutes)) {
 			fields.NodeLifecycle = &state.OndemandLifecycle
 		}
 	}
@@ -350,11 +437,27 @@ func (es *executionService) constructBaseRunFromExecutable(ctx context.Context,
 		}
 		fields.SparkExtension = req.GetExecutionRequestCommon().SparkExtension
 		reAttemptRate, _ := es.stateManager.GetPodReAttemptRate(ctx)
-		if reAttemptRate >= es.spotReAttemptOverride {
+		if reAttemptRate >= float32(es.settings.Float64(state.SettingSpotReattemptOverride)) {
 			fields.NodeLifecycle = &state.OndemandLifecycle
 		}
 	}
 
+	if fields.Replicas != nil {
+		if *fields.Replicas < 1 || *fields.Replicas > es.maxReplicas {
+			return run, exceptions.MalformedInput{
+				ErrorString: fmt.Sprintf("replicas must be between 1 and %d", es.maxReplicas)}
+		}
+		if *fields.Replicas > 1 && *fields.Engine != state.EKSEngine {
+			return run, exceptions.MalformedInput{
+				ErrorString: fmt.Sprintf("replicas are only supported by the %s engine", state.EKSEngine)}
+		}
+	}
+
+	volumes, err := es.resolveVolumes(ctx, fields.ClusterName, fields.Gpu, state.MergeVolumes(resources.Volumes, fields.Volumes))
+	if err != nil {
+		return run, err
+	}
+
 	if fields.NodeLifecycle == nil {
 		fields.NodeLifecycle = &state.SpotLifecycle
 	}
@@ -394,6 +497,11 @@ func (es *executionService) constructBaseRunFromExecutable(ctx context.Context,
 		CommandHash:           fields.CommandHash,
 		ServiceAccount:        fields.ServiceAccount,
 		Tier:                  fields.Tier,
+		Replicas:              fields.Replicas,
+	}
+
+	if len(volumes) > 0 {
+		run.Volumes = &volumes
 	}
 
 	if fields.Labels != nil {
@@ -405,6 +513,37 @@ func (es *executionService) constructBaseRunFromExecutable(ctx context.Context,
 	return run, nil
 }
 
+// resolveVolumes validates the volumes of a run and checks them against the
+// volume policy of the run's cluster, returning them with the claims of S3
+// buckets filled in. Runs without a cluster get the default cluster for their gpus.
+func (es *executionService) resolveVolumes(ctx context.Context, clusterName string, gpu *int64, volumes state.Volumes) (state.Volumes, error) {
+	if len(volumes) == 0 {
+		return nil, nil
+	}
+	if reasons := volumes.Validate(); len(reasons) > 0 {
+		return nil, exceptions.MalformedInput{ErrorString: strings.Join(reasons, "\n")}
+	}
+	if len(clusterName) == 0 {
+		clusterName = es.defaultClusterName(gpu)
+	}
+	clusters, err := es.stateManager.ListClusterStates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var policy *state.VolumePolicy
+	for _, cluster := range clusters {
+		if cluster.Name == clusterName {
+			policy = cluster.VolumePolicy
+			break
+		}
+	}
+	resolved, reasons := policy.Resolve(volumes)
+	if len(reasons) > 0 {
+		return nil, exceptions.MalformedInput{ErrorString: strings.Join(reasons, "\n")}
+	}
+	return resolved, nil
+}
+
 func (es *executionService) constructEnviron(run state.Run, env *state.EnvList) state.EnvList {
 	size := len(es.reservedEnv)
 	if env != nil {
@@ -462,6 +601,15 @@ func (es *executionService) List(
 			}
 		}
 	}
+	if categoryFilters, ok := filters["failure_category"]; ok {
+		for _, category := range categoryFilters {
+			if !state.IsValidFailureCategory(category) {
+				err := exceptions.MalformedInput{
+					ErrorString: fmt.Sprintf("invalid failure_category [%s]", category)}
+				return state.RunList{}, err
+			}
+		}
+	}
 	return es.stateManager.ListRuns(ctx, limit, offset, sortField, sortOrder, filters, envFilters, []string{state.EKSEngine, state.EKSSparkEngine})
 }
 
@@ -478,6 +626,8 @@ func (es *executionService) Get(ctx context.Context, runID string) (state.Run, e
 	if err != nil {
 		span.SetTag("error", true)
 		span.SetTag("error.msg", err.Error())
+	} else {
+		run.Diagnosis = es.stuckRunDetector.Diagnose(run, time.Now())
 	}
 	return run, err
 }
@@ -513,34 +663,7 @@ func (es *executionService) UpdateStatus(ctx context.Context, runID string, stat
 }
 
 func (es *executionService) extractExitReason(runExceptions *state.RunExceptions) string {
-	connectionError := regexp.MustCompile(`(?i).*(timeout|gatewayerror|socketerror|\s503\s|\s502\s|\s500\s|\s504\s|connectionerror).*`)
-	pipError := regexp.MustCompile(`(?i).*(could\snot\sfind\sa\sversion|package\snot\sfound|ModuleNotFoundError|No\smatching\sdistribution\sfound).*`)
-	yumError := regexp.MustCompile(`(?i).*(Nothing\sto\sdo).*`)
-	gitError := regexp.MustCompile(`(?i).*(Could\snot\sread\sfrom\sremote\srepository|correct\saccess\srights|Repository\snot\sfound).*`)
-	argumentError := regexp.MustCompile(`(?i).*(404|400|keyerror|column\smissing|RuntimeError).*`)
-	syntaxError := regexp.MustCompile(`(?i).*(syntaxerror|typeerror|).*`)
-
-	value, _ := json.Marshal(runExceptions)
-	if value != nil {
-		errorMsg := string(value)
-		switch {
-		case connectionError.MatchString(errorMsg):
-			return "Connection error to downstream uri"
-		case pipError.MatchString(errorMsg):
-			return "Python pip package installation error"
-		case yumError.MatchString(errorMsg):
-			return "Yum installation error"
-		case gitError.MatchString(errorMsg):
-			return "Git clone error"
-		case argumentError.MatchString(errorMsg):
-			return "Data or argument error"
-		case syntaxError.MatchString(errorMsg):
-			return "Code or syntax error"
-		default:
-			return "Runtime exception encountered"
-		}
-	}
-	return "Runtime exception encountered"
+	return state.ExitReasonFromExceptions(runExceptions)
 }
 
 func (es *executionService) terminateWorker(jobChan <-chan state.TerminateJob) {
@@ -567,6 +690,7 @@ func (es *executionService) terminateWorker(jobChan <-chan state.TerminateJob) {
 				es.terminateJobChannel <- state.TerminateJob{
 					RunID:    subRun.RunID,
 					UserInfo: job.UserInfo,
+					Request:  job.Request,
 				}
 			}
 		}
@@ -576,43 +700,115 @@ func (es *executionService) terminateWorker(jobChan <-chan state.TerminateJob) {
 		}
 
 		if run.Status != state.StatusStopped {
-			if *run.Engine == state.EKSSparkEngine {
-				err = es.emrExecutionEngine.Terminate(ctx, run)
-			} else {
-				err = es.eksExecutionEngine.Terminate(ctx, run)
-			}
-			exitReason := "Task terminated by user"
-			if len(userInfo.Email) > 0 {
-				exitReason = fmt.Sprintf("Task terminated by - %s", userInfo.Email)
+			stop := state.NewRunStop(job.Request, userInfo, time.Now())
+			if run.TaskType == state.ArrayTaskType {
+				es.terminateArrayChildren(ctx, run, stop)
 			}
-
-			exitCode := int64(1)
-			finishedAt := time.Now()
-			_, err = es.stateManager.UpdateRun(ctx, run.RunID, state.Run{
-				Status:     state.StatusStopped,
-				ExitReason: &exitReason,
-				ExitCode:   &exitCode,
-				FinishedAt: &finishedAt,
-			})
+			err = es.stopRun(ctx, run, stop)
 			break
 		}
 		break
 	}
 }
 
-// Terminate stops the run with the given runID
-func (es *executionService) Terminate(ctx context.Context, runID string, userInfo state.UserInfo) error {
+// stopRun terminates the run's job, if it has one, and marks it stopped. The
+// engines stop the run as recorded in stop.
+func (es *executionService) stopRun(ctx context.Context, run state.Run, stop state.RunStop) error {
+	if run.Engine == nil {
+		run.Engine = &state.EKSEngine
+	}
+	run.Stop = &stop
+	// Array runs and held children of array runs have no job to terminate.
+	if run.TaskType != state.ArrayTaskType && run.Status != state.StatusHeld {
+		if *run.Engine == state.EKSSparkEngine {
+			_ = es.emrExecutionEngine.Terminate(ctx, run)
+		} else {
+			_ = es.eksExecutionEngine.Terminate(ctx, run)
+		}
+	}
+
+	exitCode := int64(1)
+	exitReason := stop.ExitReason()
+	finishedAt := time.Now()
+	_, err := es.stateManager.UpdateRun(ctx, run.RunID, state.Run{
+		Status:     state.StatusStopped,
+		ExitReason: &exitReason,
+		ExitCode:   &exitCode,
+		FinishedAt: &finishedAt,
+		Stop:       &stop,
+	})
+	return err
+}
+
+// Terminate stops the run with the given runID, giving it the grace period of
+// the request to exit once signalled.
+func (es *executionService) Terminate(ctx context.Context, runID string, userInfo state.UserInfo, req state.StopRequest) error {
 	ctx, span := utils.TraceJob(ctx, "flotilla.terminate_run", runID)
 	defer span.Finish()
 	span.SetTag("run_id", runID)
 	if userInfo.Email != "" {
 		span.SetTag("user.email", userInfo.Email)
 	}
-	es.terminateJobChannel <- state.TerminateJob{RunID: runID, UserInfo: userInfo}
+	if err := req.Validate(es.maxStopGracePeriod); err != nil {
+		return exceptions.MalformedInput{ErrorString: err.Error()}
+	}
+	es.terminateJobChannel <- state.TerminateJob{RunID: runID, UserInfo: userInfo, Request: req}
 	go es.terminateWorker(es.terminateJobChannel)
 	return nil
 }
 
+// BulkTerminate stops all the runs matching the filters which haven't
+// stopped yet, or only lists them on dry runs.
+func (es *executionService) BulkTerminate(ctx context.Context, filters map[string][]string, envFilters map[string]string, userInfo state.UserInfo, req state.BulkStopRequest) (state.BulkStopResult, error) {
+	ctx, span := utils.TraceJob(ctx, "flotilla.bulk_terminate_runs", "")
+	defer span.Finish()
+	result := state.BulkStopResult{DryRun: req.DryRun, RunIDs: []string{}}
+
+	if len(filters) == 0 && len(envFilters) == 0 {
+		return result, exceptions.MalformedInput{ErrorString: "at least one filter is required to stop runs in bulk"}
+	}
+	if err := req.Validate(es.maxStopGracePeriod); err != nil {
+		return result, exceptions.MalformedInput{ErrorString: err.Error()}
+	}
+	statuses := state.StopStatuses
+	if requested, ok := filters["status"]; ok {
+		statuses = nil
+		for _, status := range requested {
+			if slices.Contains(state.StopStatuses, status) {
+				statuses = append(statuses, status)
+			}
+		}
+		if len(statuses) == 0 {
+			return result, nil
+		}
+	}
+	query := make(map[string][]string, len(filters))
+	for k, v := range filters {
+		query[k] = v
+	}
+	query["status"] = statuses
+
+	runs, err := es.stateManager.ListRuns(ctx, es.bulkStopMaxRuns, 0, "run_id", "asc", query, envFilters, state.Engines)
+	if err != nil {
+		return result, err
+	}
+	if runs.Total > es.bulkStopMaxRuns {
+		return result, exceptions.MalformedInput{ErrorString: fmt.Sprintf(
+			"%d runs match, more than the %d that can be stopped at once", runs.Total, es.bulkStopMaxRuns)}
+	}
+	result.Total = runs.Total
+	span.SetTag("bulk_stop.total", runs.Total)
+	span.SetTag("bulk_stop.dry_run", req.DryRun)
+	for _, run := range runs.Runs {
+		result.RunIDs = append(result.RunIDs, run.RunID)
+		if !req.DryRun {
+			es.terminateJobChannel <- state.TerminateJob{RunID: run.RunID, UserInfo: userInfo, Request: req.StopRequest}
+			go es.terminateWorker(es.terminateJobChannel)
+		}
+	}
+	return result, nil
+}
+
 // ListClusters returns a list of all execution clusters available with their metadata
 func (es *executionService) ListClusters(ctx context.Context) ([]state.ClusterMetadata, error) {
 	ctx, span := utils.TraceJob(ctx, "flotilla.list_clusters", "")
@@ -625,7 +821,15 @@ func (es *executionService) ListClusters(ctx context.Context) ([]state.ClusterMe
 }
 
 func (es *executionService) GetDefaultCluster() string {
-	return es.eksClusterDefault
+	return es.settings.String(state.SettingClusterDefault)
+}
+
+// defaultClusterName is the runtime default cluster of runs with the given gpus.
+func (es *executionService) defaultClusterName(gpu *int64) string {
+	if gpu != nil && *gpu > 0 {
+		return es.settings.String(state.SettingGPUClusterDefault)
+	}
+	return es.settings.String(state.SettingClusterDefault)
 }
 
 // sanitizeExecutionRequestCommonFields does what its name implies - sanitizes
@@ -634,7 +838,7 @@ func (es *executionService) sanitizeExecutionRequestCommonFields(fields *state.E
 		fields.Engine = &state.EKSEngine
 	}
 
-	if es.eksSpotOverride {
+	if es.settings.Bool(state.SettingSpotOverride) {
 		fields.NodeLifecycle = &state.OndemandLifecycle
 	}
 	if fields.ActiveDeadlineSeconds == nil {
@@ -664,6 +868,10 @@ func (es *executionService) createAndEnqueueRun(ctx context.Context, run state.R
 		}
 	}
 
+	if err = es.checkRunImage(ctx, &run); err != nil {
+		return run, err
+	}
+
 	// Save run to source of state - it is *CRITICAL* to do this
 	// -before- queuing to avoid processing unsaved runs
 	if err = es.stateManager.CreateRun(ctx, run); err != nil {
@@ -687,27 +895,105 @@ func (es *executionService) createAndEnqueueRun(ctx context.Context, run state.R
 	}
 	return run, nil
 }
+
+// checkRunImage rejects runs whose image doesn't exist or wasn't built for the
+// run's arch, and pins the run to the image digest when configured to.
+func (es *executionService) checkRunImage(ctx context.Context, run *state.Run) error {
+	arch := defaultArch
+	if run.Arch != nil && len(*run.Arch) > 0 {
+		arch = *run.Arch
+	}
+	image, err := es.images.check(ctx, run.Image, arch)
+	if err != nil {
+		return err
+	}
+	if image != nil && es.images.resolveDigests {
+		run.ImageDigest = &image.Digest
+	}
+	return nil
+}
+
 func (es *executionService) CreateTemplateRunByTemplateName(ctx context.Context, templateName string, templateVersion string, req *state.TemplateExecutionRequest) (state.Run, error) {
 	ctx, span := utils.TraceJob(ctx, "flotilla.template.create_run_by_name", "")
 	defer span.Finish()
 	span.SetTag("template_name", templateName)
 	span.SetTag("template_version", templateVersion)
-	version, err := strconv.Atoi(templateVersion)
-
+	template, err := es.getTemplateByNameAndVersion(ctx, templateName, templateVersion)
 	if err != nil {
-		//use the "latest" template - version not a integer
-		fetch, template, err := es.stateManager.GetLatestTemplateByTemplateName(ctx, templateName)
-		if fetch && err == nil {
-			return es.CreateTemplateRunByTemplateID(ctx, template.TemplateID, req)
+		return state.Run{}, err
+	}
+	return es.CreateTemplateRunByTemplateID(ctx, template.TemplateID, req)
+}
+
+// getTemplateByNameAndVersion returns the version of the template targeted by
+// the channel when templateVersion is the name of one, the latest version when
+// it's neither a channel nor an integer.
+func (es *executionService) getTemplateByNameAndVersion(ctx context.Context, templateName string, templateVersion string) (state.Template, error) {
+	var (
+		fetch    bool
+		template state.Template
+	)
+	version, err := strconv.Atoi(templateVersion)
+	if templateVersion == state.TemplateLatestChannel {
+		fetch, template, err = es.stateManager.GetLatestTemplateByTemplateName(ctx, templateName)
+	} else if err != nil {
+		var channel state.TemplateChannel
+		fetch, channel, err = es.stateManager.GetTemplateChannel(ctx, templateName, templateVersion)
+		if err != nil {
+			return template, err
 		}
-	} else {
-		fetch, template, err := es.stateManager.GetTemplateByVersion(ctx, templateName, int64(version))
-		if fetch && err == nil {
-			return es.CreateTemplateRunByTemplateID(ctx, template.TemplateID, req)
+		if !fetch {
+			return template, exceptions.MissingResource{
+				ErrorString: fmt.Sprintf("template [%s] has no version or channel [%s]", templateName, templateVersion)}
 		}
+		fetch, template, err = es.stateManager.GetTemplateByVersion(ctx, templateName, channel.Version)
+	} else {
+		fetch, template, err = es.stateManager.GetTemplateByVersion(ctx, templateName, int64(version))
+	}
+	if !fetch || err != nil {
+		return template,
+			errors.New(fmt.Sprintf("invalid template name or version, template_name: %s, template_version: %s", templateName, templateVersion))
+	}
+	return template, nil
+}
+
+// RenderTemplateRunByTemplateName resolves a run like CreateTemplateRunByTemplateName
+// and returns what would be submitted for it, without creating or queuing it.
+func (es *executionService) RenderTemplateRunByTemplateName(ctx context.Context, templateName string, templateVersion string, req *state.TemplateExecutionRequest) (engine.RenderedRun, error) {
+	ctx, span := utils.TraceJob(ctx, "flotilla.template.render_run_by_name", "")
+	defer span.Finish()
+	span.SetTag("template_name", templateName)
+	span.SetTag("template_version", templateVersion)
+	template, err := es.getTemplateByNameAndVersion(ctx, templateName, templateVersion)
+	if err != nil {
+		return engine.RenderedRun{}, err
+	}
+	return es.RenderTemplateRunByTemplateID(ctx, template.TemplateID, req)
+}
+
+// RenderTemplateRunByTemplateID resolves a run like CreateTemplateRunByTemplateID
+// and returns what would be submitted for it, without creating or queuing it.
+func (es *executionService) RenderTemplateRunByTemplateID(ctx context.Context, templateID string, req *state.TemplateExecutionRequest) (engine.RenderedRun, error) {
+	ctx, span := utils.TraceJob(ctx, "flotilla.template.render_run_by_id", "")
+	defer span.Finish()
+	span.SetTag("template_id", templateID)
+	template, err := es.stateManager.GetTemplateByID(ctx, templateID)
+	if err != nil {
+		return engine.RenderedRun{}, err
+	}
+
+	warnings, err := es.checkDeprecation(template)
+	if err != nil {
+		return engine.RenderedRun{}, err
+	}
+
+	es.sanitizeExecutionRequestCommonFields(req.GetExecutionRequestCommon())
+	run, err := es.constructRunFromTemplate(ctx, template, req)
+	if err != nil {
+		return engine.RenderedRun{Run: run}, err
 	}
-	return state.Run{},
-		errors.New(fmt.Sprintf("invalid template name or version, template_name: %s, template_version: %s", templateName, templateVersion))
+	run.Warnings = warnings
+	return es.render(ctx, template, run)
 }
 
 // Create constructs and queues a new Run on the cluster specified.
@@ -733,15 +1019,34 @@ func (es *executionService) createFromTemplate(ctx context.Context, template sta
 	fields := req.GetExecutionRequestCommon()
 	es.sanitizeExecutionRequestCommonFields(fields)
 
+	warnings, err := es.checkDeprecation(template)
+	if err != nil {
+		return run, err
+	}
+
 	// Construct run object with StatusQueued and new UUID4 run id
 	run, err = es.constructRunFromTemplate(ctx, template, req)
 	if err != nil {
 		return run, err
 	}
 	if !req.DryRun {
-		return es.createAndEnqueueRun(ctx, run)
+		run, err = es.createAndEnqueueRun(ctx, run)
 	}
-	return run, nil
+	run.Warnings = warnings
+	return run, err
+}
+
+// checkDeprecation rejects runs of template versions deprecated with the
+// block level and returns warnings for the others.
+func (es *executionService) checkDeprecation(template state.Template) ([]string, error) {
+	if template.Deprecation == nil {
+		return nil, nil
+	}
+	warning := template.Deprecation.Warning(template)
+	if template.Deprecation.Blocks() {
+		return nil, exceptions.ConflictingResource{ErrorString: warning}
+	}
+	return []string{warning}, nil
 }
 
 func (es *executionService) constructRunFromTemplate(ctx context.Context, template state.Template, req *state.TemplateExecutionRequest) (state.Run, error) {
@@ -762,7 +1067,7 @@ func (es *executionService) constructRunFromTemplate(ctx context.Context, templa
 // resolveRequestTier returns the requested tier or default tier if empty
 func (es *executionService) resolveRequestTier(requestedTier state.Tier) state.Tier {
 	if requestedTier == "" {
-		return state.Tier(es.eksTierDefault)
+		return state.Tier(es.settings.String(state.SettingTierDefault))
 	}
 	return requestedTier
 }
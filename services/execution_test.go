@@ -3,12 +3,14 @@ package services
 import (
 	"context"
 	"crypto/md5"
+	"encoding/json"
 	"fmt"
 	"log"
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/stitchfix/flotilla-os/config"
+	"github.com/stitchfix/flotilla-os/exceptions"
 	"github.com/stitchfix/flotilla-os/state"
 	"github.com/stitchfix/flotilla-os/testutils"
 )
@@ -37,7 +39,7 @@ func setUp(t *testing.T) (ExecutionService, *testutils.ImplementsAllTheThings) {
 		},
 	}
 
-	es, err := NewExecutionService(c, &imp, &imp, &imp, &imp)
+	es, err := NewExecutionService(c, &imp, &imp, &imp, &imp, &imp, state.NewSettings(c, &imp, nil))
 	if err != nil {
 		log.Fatalf("error seting up execution service: %s", err.Error())
 	}
@@ -262,6 +264,61 @@ func TestExecutionService_CreateDefinitionRunByAlias(t *testing.T) {
 	}
 }
 
+func TestExecutionService_CreateDefinitionRunInvalidImage(t *testing.T) {
+	ctx := context.Background()
+	es, imp := setUp(t)
+	engine := state.DefaultEngine
+	req := state.DefinitionExecutionRequest{
+		ExecutionRequestCommon: &state.ExecutionRequestCommon{
+			OwnerID: "somebody",
+			Engine:  &engine,
+		},
+	}
+	_, err := es.CreateDefinitionRunByAlias(ctx, "aliasC", &req)
+	if _, ok := err.(exceptions.MalformedInput); !ok {
+		t.Errorf("Expected run with a missing image to result in MalformedInput but was %v", err)
+	}
+	for _, call := range imp.Calls {
+		if call == "CreateRun" || call == "Enqueue" {
+			t.Errorf("Expected run with a missing image not to be created, but %s was called", call)
+		}
+	}
+}
+
+func TestExecutionService_RenderDefinitionRunByDefinitionID(t *testing.T) {
+	ctx := context.Background()
+	es, imp := setUp(t)
+	engine := state.DefaultEngine
+	cmd := "_test_cmd_"
+	req := state.DefinitionExecutionRequest{
+		ExecutionRequestCommon: &state.ExecutionRequestCommon{
+			OwnerID: "somebody",
+			Command: &cmd,
+			Engine:  &engine,
+		},
+	}
+	rendered, err := es.RenderDefinitionRunByDefinitionID(ctx, "B", &req)
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if rendered.Run.DefinitionID != "B" || rendered.Run.Command == nil || *rendered.Run.Command != cmd {
+		t.Errorf("Unexpected rendered run %+v", rendered.Run)
+	}
+
+	called := false
+	for _, call := range imp.Calls {
+		switch call {
+		case "Render":
+			called = true
+		case "CreateRun", "Enqueue", "UpdateRun":
+			t.Errorf("Expected dry run not to create the run, but %s was called", call)
+		}
+	}
+	if !called {
+		t.Errorf("Expected the engine to render the run")
+	}
+}
+
 func TestExecutionService_List(t *testing.T) {
 	ctx := context.Background()
 	es, imp := setUp(t)
@@ -389,7 +446,7 @@ func TestExecutionService_CreateDefinitionRunWithTier(t *testing.T) {
 		return ""
 	}
 
-	es, err := NewExecutionService(c, &imp, &imp, &imp, &imp)
+	es, err := NewExecutionService(c, &imp, &imp, &imp, &imp, &imp, state.NewSettings(c, &imp, nil))
 	if err != nil {
 		t.Fatalf("Error setting up execution service: %s", err.Error())
 	}
@@ -1011,3 +1068,75 @@ func TestExecutionService_SparkNullDescriptionNullHash(t *testing.T) {
 		t.Errorf("Expected NULL command_hash for Spark job with NULL description, got '%s'", *run.CommandHash)
 	}
 }
+
+func TestExecutionService_CreateDefinitionRunWithVolumes(t *testing.T) {
+	ctx := context.Background()
+	es, imp := setUp(t)
+	imp.ClusterStates[0].VolumePolicy = &state.VolumePolicy{
+		ConfigMaps: []string{"app-config"},
+		Buckets:    map[string]string{"training-data": "s3-training-data"},
+	}
+	imp.Definitions["A"] = state.Definition{DefinitionID: "A", Alias: "aliasA", ExecutableResources: state.ExecutableResources{
+		Volumes: &state.Volumes{{Name: "config", Type: state.VolumeTypeConfigMap, ConfigMap: "app-config", MountPath: "/etc/app"}},
+	}}
+
+	cmd := "echo test"
+	engine := state.DefaultEngine
+	req := state.DefinitionExecutionRequest{
+		ExecutionRequestCommon: &state.ExecutionRequestCommon{
+			ClusterName: "cluster1",
+			Command:     &cmd,
+			OwnerID:     "testuser",
+			Engine:      &engine,
+			Volumes: &state.Volumes{
+				{Name: "data", Type: state.VolumeTypeS3, Bucket: "training-data", MountPath: "/data", ReadOnly: true},
+			},
+		},
+	}
+	run, err := es.CreateDefinitionRunByDefinitionID(ctx, "A", &req)
+	if err != nil {
+		t.Fatalf("Error creating run: %s", err.Error())
+	}
+	if run.Volumes == nil || len(*run.Volumes) != 2 {
+		t.Fatalf("expected the definition's and the request's volumes, got %v", run.Volumes)
+	}
+	if (*run.Volumes)[1].ClaimName != "s3-training-data" {
+		t.Errorf("expected the bucket's claim, got %q", (*run.Volumes)[1].ClaimName)
+	}
+
+	(*req.Volumes)[0].Bucket = "other-bucket"
+	if _, err = es.CreateDefinitionRunByDefinitionID(ctx, "A", &req); err == nil {
+		t.Errorf("expected a bucket missing from the cluster's policy to be rejected")
+	} else if _, ok := err.(exceptions.MalformedInput); !ok {
+		t.Errorf("expected MalformedInput, got %T", err)
+	}
+
+	req.ClusterName = "cluster2"
+	(*req.Volumes)[0].Bucket = "training-data"
+	if _, err = es.CreateDefinitionRunByDefinitionID(ctx, "A", &req); err == nil {
+		t.Errorf("expected volumes to be rejected on a cluster without a volume policy")
+	}
+}
+
+func TestExecutionService_ResolveVolumesDefaultCluster(t *testing.T) {
+	ctx := context.Background()
+	es, imp := setUp(t)
+	imp.ClusterStates[0].VolumePolicy = &state.VolumePolicy{ConfigMaps: []string{"app-config"}}
+	imp.Settings = map[string]state.Setting{
+		state.SettingClusterDefault:    {Key: state.SettingClusterDefault, Value: json.RawMessage(`"cluster2"`)},
+		state.SettingGPUClusterDefault: {Key: state.SettingGPUClusterDefault, Value: json.RawMessage(`"cluster1"`)},
+	}
+	ees := es.(*executionService)
+	if err := ees.settings.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	volumes := state.Volumes{{Name: "config", Type: state.VolumeTypeConfigMap, ConfigMap: "app-config", MountPath: "/etc/app"}}
+	gpu := int64(1)
+	if _, err := ees.resolveVolumes(ctx, "", &gpu, volumes); err != nil {
+		t.Errorf("expected the volumes to be checked against the gpu default cluster, got %v", err)
+	}
+	if _, err := ees.resolveVolumes(ctx, "", nil, volumes); err == nil {
+		t.Errorf("expected the volumes to be checked against the default cluster")
+	}
+}
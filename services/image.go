@@ -0,0 +1,67 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/stitchfix/flotilla-os/clients/registry"
+	"github.com/stitchfix/flotilla-os/config"
+	"github.com/stitchfix/flotilla-os/exceptions"
+	"github.com/stitchfix/flotilla-os/utils"
+)
+
+// defaultArch is the architecture runs are scheduled on when none is requested.
+const defaultArch = "amd64"
+
+// imageChecker validates the images of definitions and runs against the
+// registry hosting them.
+type imageChecker struct {
+	rc             registry.Client
+	enabled        bool
+	resolveDigests bool
+}
+
+func newImageChecker(conf config.Config, rc registry.Client) imageChecker {
+	ic := imageChecker{rc: rc, enabled: rc != nil}
+	if conf.IsSet("check_image_validity") {
+		ic.enabled = ic.enabled && conf.GetBool("check_image_validity")
+	}
+	if conf.IsSet("resolve_image_digests") {
+		ic.resolveDigests = conf.GetBool("resolve_image_digests")
+	}
+	return ic
+}
+
+// check resolves the image and makes sure it exists and, when arch is set,
+// was built for arch. Images which can't be checked because the registry is
+// unreachable or requires credentials are let through, the check returns a
+// nil image for them.
+func (ic imageChecker) check(ctx context.Context, image string, arch string) (*registry.Image, error) {
+	if !ic.enabled || len(image) == 0 {
+		return nil, nil
+	}
+	_, span := utils.TraceJob(ctx, "flotilla.image.check", "")
+	defer span.Finish()
+	span.SetTag("image", image)
+
+	resolved, err := ic.rc.ResolveImage(image)
+	if err != nil {
+		switch err.(type) {
+		case exceptions.MissingResource, exceptions.MalformedInput:
+			return nil, exceptions.MalformedInput{
+				ErrorString: fmt.Sprintf("invalid image [%s]: %s", image, err.Error())}
+		}
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return nil, nil
+	}
+
+	if len(arch) > 0 && !resolved.SupportsArch(arch) {
+		return nil, exceptions.MalformedInput{
+			ErrorString: fmt.Sprintf("image [%s] is built for [%s] and can't run on arch [%s]",
+				image, strings.Join(resolved.Architectures(), ","), arch)}
+	}
+	span.SetTag("image.digest", resolved.Digest)
+	return &resolved, nil
+}
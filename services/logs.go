@@ -4,13 +4,16 @@ import (
 	"context"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/stitchfix/flotilla-os/clients/logs"
+	"github.com/stitchfix/flotilla-os/exceptions"
 	"github.com/stitchfix/flotilla-os/state"
 	"net/http"
 )
 
 type LogService interface {
-	Logs(runID string, lastSeen *string, role *string, facility *string) (string, *string, error)
-	LogsText(runID string, w http.ResponseWriter) error
+	Logs(runID string, lastSeen *string, role *string, facility *string, replica *int64) (string, *string, error)
+	LogsText(runID string, replica *int64, w http.ResponseWriter) error
+	SearchLogs(runID string, query logs.LogQuery) (logs.LogSearchResult, error)
+	DownloadLogs(runID string, query logs.LogQuery, w http.ResponseWriter) error
 }
 
 type logService struct {
@@ -23,12 +26,15 @@ func NewLogService(sm state.Manager, lc logs.Client) (LogService, error) {
 	return &logService{sm: sm, lc: lc}, nil
 }
 
-// Returns logs associated with a RunId
-func (ls *logService) Logs(runID string, lastSeen *string, role *string, facility *string) (string, *string, error) {
+// Returns logs associated with a RunId, of the given replica for replicated runs
+func (ls *logService) Logs(runID string, lastSeen *string, role *string, facility *string, replica *int64) (string, *string, error) {
 	run, err := ls.sm.GetRun(context.Background(), runID)
 	if err != nil {
 		return "", nil, err
 	}
+	if run, err = forReplica(run, replica); err != nil {
+		return "", nil, err
+	}
 
 	if run.Status != state.StatusRunning && run.Status != state.StatusStopped {
 		// Won't have logs yet
@@ -49,11 +55,14 @@ func (ls *logService) Logs(runID string, lastSeen *string, role *string, facilit
 }
 
 // Returns all the logs as text associated with a runID (supported only for s3 logs).
-func (ls *logService) LogsText(runID string, w http.ResponseWriter) error {
+func (ls *logService) LogsText(runID string, replica *int64, w http.ResponseWriter) error {
 	run, err := ls.sm.GetRun(context.Background(), runID)
 	if err != nil {
 		return err
 	}
+	if run, err = forReplica(run, replica); err != nil {
+		return err
+	}
 
 	if run.Status != state.StatusRunning && run.Status != state.StatusStopped {
 		// Won't have logs yet
@@ -71,3 +80,62 @@ func (ls *logService) LogsText(runID string, w http.ResponseWriter) error {
 
 	return ls.lc.LogsText(executable, run, w)
 }
+
+// Returns the log lines associated with a runID that match the query (supported only for s3 logs).
+func (ls *logService) SearchLogs(runID string, query logs.LogQuery) (logs.LogSearchResult, error) {
+	run, executable, ready, err := ls.getRunAndExecutable(runID, query)
+	if err != nil || !ready {
+		return logs.LogSearchResult{Lines: []logs.LogLine{}}, err
+	}
+	return ls.lc.SearchLogs(executable, run, query)
+}
+
+// Streams the log text associated with a runID that matches the query (supported only for s3 logs).
+func (ls *logService) DownloadLogs(runID string, query logs.LogQuery, w http.ResponseWriter) error {
+	run, executable, ready, err := ls.getRunAndExecutable(runID, query)
+	if err != nil || !ready {
+		return err
+	}
+	return ls.lc.DownloadLogs(executable, run, query, w)
+}
+
+// Fetches the run and its executable; ready is false when the run won't have logs yet.
+func (ls *logService) getRunAndExecutable(runID string, query logs.LogQuery) (state.Run, state.Executable, bool, error) {
+	run, err := ls.sm.GetRun(context.Background(), runID)
+	if err != nil {
+		return run, nil, false, err
+	}
+	if run, err = forReplica(run, query.Replica); err != nil {
+		return run, nil, false, err
+	}
+
+	if run.Status != state.StatusRunning && run.Status != state.StatusStopped {
+		return run, nil, false, nil
+	}
+
+	if run.ExecutableType == nil {
+		defaultExecutableType := state.ExecutableTypeDefinition
+		run.ExecutableType = &defaultExecutableType
+	}
+	if run.ExecutableID == nil {
+		run.ExecutableID = &run.DefinitionID
+	}
+	executable, err := ls.sm.GetExecutableByTypeAndID(context.Background(), *run.ExecutableType, *run.ExecutableID)
+	if err != nil {
+		return run, nil, false, err
+	}
+	return run, executable, true, nil
+}
+
+// Points the run at the pod of the requested replica, runs default to their
+// own (rank 0) pod.
+func forReplica(run state.Run, replica *int64) (state.Run, error) {
+	if replica == nil {
+		return run, nil
+	}
+	replicaRun, err := run.ForReplica(*replica)
+	if err != nil {
+		return run, exceptions.MissingResource{ErrorString: err.Error()}
+	}
+	return replicaRun, nil
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"testing"
 
+	"github.com/stitchfix/flotilla-os/clients/logs"
 	"github.com/stitchfix/flotilla-os/state"
 	"github.com/stitchfix/flotilla-os/testutils"
 )
@@ -33,7 +34,7 @@ func TestLogService_Logs(t *testing.T) {
 		"GetRun": true,
 	}
 
-	_, _, err := ls.Logs("isQueued", nil, nil, nil)
+	_, _, err := ls.Logs("isQueued", nil, nil, nil, nil)
 	if err != nil {
 		t.Error(err.Error())
 	}
@@ -60,7 +61,7 @@ func TestLogService_Logs(t *testing.T) {
 		"GetExecutableByTypeAndID": true,
 	}
 
-	_, _, err = ls.Logs("running", nil, nil, nil)
+	_, _, err = ls.Logs("running", nil, nil, nil, nil)
 	if err != nil {
 		t.Error(err.Error())
 	}
@@ -76,3 +77,46 @@ func TestLogService_Logs(t *testing.T) {
 		}
 	}
 }
+
+func TestLogService_SearchLogs(t *testing.T) {
+	ls, imp := setUpLogServiceTest(t)
+	expectedCalls := map[string]bool{
+		"GetRun":                   true,
+		"GetDefinition":            true,
+		"SearchLogs":               true,
+		"GetExecutableByTypeAndID": true,
+	}
+
+	res, err := ls.SearchLogs("running", logs.LogQuery{Tail: 10})
+	if err != nil {
+		t.Error(err.Error())
+	}
+
+	if res.Lines == nil {
+		t.Errorf("Expected non-nil lines")
+	}
+
+	if len(imp.Calls) != len(expectedCalls) {
+		t.Errorf("Expected exactly %v calls for log search for running run but was: %v", len(expectedCalls), len(imp.Calls))
+	}
+
+	for _, call := range imp.Calls {
+		_, ok := expectedCalls[call]
+		if !ok {
+			t.Errorf("Unexpected call during log search for running run: %s", call)
+		}
+	}
+
+	//
+	// Queued runs won't have logs yet
+	//
+	ls, imp = setUpLogServiceTest(t)
+	_, err = ls.SearchLogs("isQueued", logs.LogQuery{})
+	if err != nil {
+		t.Error(err.Error())
+	}
+
+	if len(imp.Calls) != 1 || imp.Calls[0] != "GetRun" {
+		t.Errorf("Expected only GetRun for log search for queued run but was: %v", imp.Calls)
+	}
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/stitchfix/flotilla-os/exceptions"
+	"github.com/stitchfix/flotilla-os/execution/engine"
+	"github.com/stitchfix/flotilla-os/state"
+	"github.com/stitchfix/flotilla-os/utils"
+)
+
+// ProxyPort returns a handler proxying requests to a port exposed by the
+// run, stripping prefix from their path. Only running runs are proxied.
+func (es *executionService) ProxyPort(ctx context.Context, runID string, port int, prefix string) (http.Handler, error) {
+	ctx, span := utils.TraceJob(ctx, "flotilla.job.proxy_port", runID)
+	defer span.Finish()
+	span.SetTag("proxy.port", port)
+
+	run, err := es.stateManager.GetRun(ctx, runID)
+	if err != nil {
+		return nil, err
+	}
+	if run.Endpoints == nil {
+		return nil, exceptions.MissingResource{ErrorString: fmt.Sprintf("run [%s] exposes no ports", runID)}
+	}
+	if _, ok := run.Endpoints.Find(port); !ok {
+		return nil, exceptions.MissingResource{ErrorString: fmt.Sprintf("run [%s] doesn't expose port %d", runID, port)}
+	}
+	if run.Status != state.StatusRunning {
+		return nil, exceptions.ConflictingResource{ErrorString: fmt.Sprintf("run [%s] is %s, only running runs can be proxied", runID, run.Status)}
+	}
+	proxy, ok := es.eksExecutionEngine.(engine.PortProxy)
+	if !ok {
+		return nil, exceptions.MalformedInput{ErrorString: "proxying runs is not supported"}
+	}
+	handler, err := proxy.ProxyPort(run, port, prefix)
+	if err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return nil, err
+	}
+	return handler, nil
+}
@@ -0,0 +1,39 @@
+package services
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stitchfix/flotilla-os/exceptions"
+	"github.com/stitchfix/flotilla-os/state"
+)
+
+func TestExecutionService_ProxyPort(t *testing.T) {
+	ctx := context.Background()
+	es, imp := setUp(t)
+	endpoints := state.RunEndpoints{{Port: 8888, ProxyURI: state.RunProxyURI("exposed", 8888)}}
+	imp.Runs["exposed"] = state.Run{RunID: "exposed", Status: state.StatusRunning, Endpoints: &endpoints}
+	imp.Runs["done"] = state.Run{RunID: "done", Status: state.StatusStopped, Endpoints: &endpoints}
+
+	handler, err := es.ProxyPort(ctx, "exposed", 8888, "/api/v6/exposed/proxy/8888")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/v6/exposed/proxy/8888/tree", nil))
+	if w.Body.String() != "exposed:8888/tree" {
+		t.Errorf("unexpected proxied response %q", w.Body.String())
+	}
+
+	if _, err = es.ProxyPort(ctx, "exposed", 4040, ""); err == nil {
+		t.Errorf("expected undeclared ports to be refused")
+	} else if _, ok := err.(exceptions.MissingResource); !ok {
+		t.Errorf("expected a missing resource, got %v", err)
+	}
+	if _, err = es.ProxyPort(ctx, "done", 8888, ""); err == nil {
+		t.Errorf("expected stopped runs to be refused")
+	} else if _, ok := err.(exceptions.ConflictingResource); !ok {
+		t.Errorf("expected a conflict, got %v", err)
+	}
+}
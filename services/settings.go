@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/stitchfix/flotilla-os/config"
+	"github.com/stitchfix/flotilla-os/exceptions"
+	"github.com/stitchfix/flotilla-os/state"
+	"github.com/stitchfix/flotilla-os/utils"
+)
+
+// SettingsService overrides the settings which can be changed at runtime and
+// keeps the history of their changes.
+type SettingsService interface {
+	List(ctx context.Context) (state.SettingStatusList, error)
+	Set(ctx context.Context, key string, user string, req state.SettingRequest) (state.SettingStatus, error)
+	Reset(ctx context.Context, key string, user string, reason string) (state.SettingStatus, error)
+	History(ctx context.Context, key string, limit int, offset int) (state.SettingChangeList, error)
+}
+
+type settingsService struct {
+	sm               state.Manager
+	settings         *state.Settings
+	validEksClusters []string
+}
+
+// NewSettingsService configures and returns a SettingsService.
+func NewSettingsService(conf config.Config, sm state.Manager, settings *state.Settings) (SettingsService, error) {
+	ss := settingsService{sm: sm, settings: settings}
+	for _, c := range strings.Split(conf.GetString("eks_clusters"), ",") {
+		ss.validEksClusters = append(ss.validEksClusters, strings.TrimSpace(c))
+	}
+	return &ss, nil
+}
+
+// List returns the current value of each setting.
+func (ss *settingsService) List(ctx context.Context) (state.SettingStatusList, error) {
+	if err := ss.settings.Refresh(ctx); err != nil {
+		return state.SettingStatusList{}, err
+	}
+	return ss.settings.Statuses(), nil
+}
+
+// Set overrides the setting. The change is applied right away by this
+// instance, and by the others when they next refresh their settings.
+func (ss *settingsService) Set(ctx context.Context, key string, user string, req state.SettingRequest) (state.SettingStatus, error) {
+	ctx, span := utils.TraceJob(ctx, "flotilla.settings.set", "")
+	defer span.Finish()
+	span.SetTag("setting", key)
+
+	spec, err := ss.getSpec(key)
+	if err != nil {
+		return state.SettingStatus{}, err
+	}
+	if len(req.Value) == 0 {
+		return state.SettingStatus{}, exceptions.MalformedInput{ErrorString: "[value] must be specified"}
+	}
+	value, err := spec.ParseJSON(req.Value)
+	if err != nil {
+		return state.SettingStatus{}, exceptions.MalformedInput{ErrorString: err.Error()}
+	}
+	if err = ss.validateCluster(ctx, key, value); err != nil {
+		return state.SettingStatus{}, err
+	}
+
+	setting := state.Setting{Key: key, Value: req.Value, UpdatedBy: user, UpdatedAt: time.Now()}
+	if _, err = ss.sm.SetSetting(ctx, setting, req.Reason); err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return state.SettingStatus{}, err
+	}
+	return ss.status(ctx, key)
+}
+
+// Reset removes the override of the setting, which goes back to its value
+// from the configuration.
+func (ss *settingsService) Reset(ctx context.Context, key string, user string, reason string) (state.SettingStatus, error) {
+	ctx, span := utils.TraceJob(ctx, "flotilla.settings.reset", "")
+	defer span.Finish()
+	span.SetTag("setting", key)
+
+	if _, err := ss.getSpec(key); err != nil {
+		return state.SettingStatus{}, err
+	}
+	if err := ss.sm.DeleteSetting(ctx, key, user, reason); err != nil {
+		return state.SettingStatus{}, err
+	}
+	return ss.status(ctx, key)
+}
+
+// History lists the changes of the setting, or of all of them when key is
+// empty, most recent first.
+func (ss *settingsService) History(ctx context.Context, key string, limit int, offset int) (state.SettingChangeList, error) {
+	if len(key) > 0 {
+		if _, err := ss.getSpec(key); err != nil {
+			return state.SettingChangeList{}, err
+		}
+	}
+	return ss.sm.ListSettingChanges(ctx, key, limit, offset)
+}
+
+func (ss *settingsService) getSpec(key string) (state.SettingSpec, error) {
+	spec, ok := state.GetSettingSpec(key)
+	if !ok {
+		return spec, exceptions.MissingResource{ErrorString: fmt.Sprintf("setting [%s] not found", key)}
+	}
+	return spec, nil
+}
+
+// validateCluster makes sure default clusters are either configured or
+// registered.
+func (ss *settingsService) validateCluster(ctx context.Context, key string, value interface{}) error {
+	if key != state.SettingClusterDefault && key != state.SettingGPUClusterDefault {
+		return nil
+	}
+	name := value.(string)
+	known, err := isKnownCluster(ctx, ss.sm, ss.validEksClusters, name)
+	if err != nil {
+		return err
+	}
+	if !known {
+		return exceptions.MalformedInput{ErrorString: fmt.Sprintf("setting [%s] must be a valid cluster, [%s] isn't", key, name)}
+	}
+	return nil
+}
+
+// isKnownCluster tells whether the cluster is one of the configured
+// clusters, or a registered one.
+func isKnownCluster(ctx context.Context, sm state.Manager, configured []string, name string) (bool, error) {
+	if slices.Contains(configured, name) {
+		return true, nil
+	}
+	clusters, err := sm.ListClusterStates(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, c := range clusters {
+		if c.Name == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// status refreshes the settings and returns the status of the setting.
+func (ss *settingsService) status(ctx context.Context, key string) (state.SettingStatus, error) {
+	if err := ss.settings.Refresh(ctx); err != nil {
+		return state.SettingStatus{}, err
+	}
+	for _, status := range ss.settings.Statuses().Settings {
+		if status.Key == key {
+			return status, nil
+		}
+	}
+	return state.SettingStatus{}, exceptions.MissingResource{ErrorString: fmt.Sprintf("setting [%s] not found", key)}
+}
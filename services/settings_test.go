@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stitchfix/flotilla-os/config"
+	"github.com/stitchfix/flotilla-os/exceptions"
+	"github.com/stitchfix/flotilla-os/state"
+	"github.com/stitchfix/flotilla-os/testutils"
+)
+
+func TestSettingsService(t *testing.T) {
+	ctx := context.Background()
+	confDir := "../conf"
+	c, _ := config.NewConfig(&confDir)
+	imp := &testutils.ImplementsAllTheThings{T: t}
+	settings := state.NewSettings(c, imp, nil)
+	ss, _ := NewSettingsService(c, imp, settings)
+
+	if _, err := ss.Set(ctx, "unknown", "somebody", state.SettingRequest{Value: json.RawMessage(`1`)}); err == nil {
+		t.Errorf("expected unknown settings to be refused")
+	} else if _, ok := err.(exceptions.MissingResource); !ok {
+		t.Errorf("expected a missing resource, got %v", err)
+	}
+	if _, err := ss.Set(ctx, state.SettingSpotOverride, "somebody", state.SettingRequest{Value: json.RawMessage(`"yes"`)}); err == nil {
+		t.Errorf("expected values of the wrong type to be refused")
+	}
+	if _, err := ss.Set(ctx, state.SettingClusterDefault, "somebody", state.SettingRequest{Value: json.RawMessage(`"nowhere"`)}); err == nil {
+		t.Errorf("expected unknown clusters to be refused")
+	}
+
+	status, err := ss.Set(ctx, state.SettingSpotOverride, "somebody", state.SettingRequest{Value: json.RawMessage(`true`), Reason: "spot outage"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Value != true || !status.Overridden || status.UpdatedBy != "somebody" {
+		t.Errorf("expected the override to apply right away, got %+v", status)
+	}
+	if !settings.Bool(state.SettingSpotOverride) {
+		t.Errorf("expected subscribers of the settings to see the override")
+	}
+
+	status, err = ss.Reset(ctx, state.SettingSpotOverride, "somebody", "outage over")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Value != false || status.Overridden {
+		t.Errorf("expected the setting to go back to its default, got %+v", status)
+	}
+	if _, err = ss.Reset(ctx, state.SettingSpotOverride, "somebody", ""); err == nil {
+		t.Errorf("expected resetting a setting which isn't overridden to fail")
+	}
+
+	history, err := ss.History(ctx, state.SettingSpotOverride, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history.Total != 2 || history.Changes[0].Reason != "outage over" || string(history.Changes[1].Value) != "true" {
+		t.Errorf("expected the changes to be recorded, got %+v", history)
+	}
+}
+
+func TestSettingsService_RegisteredClusterDefault(t *testing.T) {
+	ctx := context.Background()
+	confDir := "../conf"
+	c, _ := config.NewConfig(&confDir)
+	imp := &testutils.ImplementsAllTheThings{
+		T:             t,
+		ClusterStates: []state.ClusterMetadata{{Name: "registered", Status: state.StatusActive}},
+	}
+	settings := state.NewSettings(c, imp, nil)
+	ss, _ := NewSettingsService(c, imp, settings)
+
+	if _, err := ss.Set(ctx, state.SettingClusterDefault, "somebody", state.SettingRequest{Value: json.RawMessage(`"registered"`)}); err != nil {
+		t.Fatal(err)
+	}
+	// Instances restarting with the override must accept it too.
+	restarted := state.NewSettings(c, imp, nil)
+	if err := restarted.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewExecutionService(c, imp, imp, imp, imp, imp, restarted); err != nil {
+		t.Errorf("expected a registered default cluster to be accepted on startup, got %v", err)
+	}
+}
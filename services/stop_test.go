@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stitchfix/flotilla-os/exceptions"
+	"github.com/stitchfix/flotilla-os/state"
+)
+
+func TestExecutionService_BulkTerminate(t *testing.T) {
+	ctx := context.Background()
+	es, imp := setUp(t)
+	user := state.UserInfo{Email: "somebody@example.com"}
+
+	_, err := es.BulkTerminate(ctx, nil, nil, user, state.BulkStopRequest{DryRun: true})
+	if _, ok := err.(exceptions.MalformedInput); !ok {
+		t.Errorf("expected bulk stops without filters to be refused, got %v", err)
+	}
+	_, err = es.BulkTerminate(ctx, map[string][]string{"cluster_name": {"clusta"}}, nil, user, state.BulkStopRequest{
+		StopRequest: state.StopRequest{Signal: "SIGSEGV"},
+		DryRun:      true,
+	})
+	if _, ok := err.(exceptions.MalformedInput); !ok {
+		t.Errorf("expected invalid signals to be refused, got %v", err)
+	}
+
+	result, err := es.BulkTerminate(ctx, map[string][]string{"status": {state.StatusStopped}}, nil, user, state.BulkStopRequest{DryRun: true})
+	if err != nil || result.Total != 0 {
+		t.Errorf("expected stopped runs not to be stopped again, got %+v %v", result, err)
+	}
+
+	imp.Calls = nil
+	result, err = es.BulkTerminate(ctx, map[string][]string{"status": {state.StatusQueued}}, nil, user, state.BulkStopRequest{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.DryRun || result.Total != len(imp.Runs) || len(result.RunIDs) != result.Total {
+		t.Errorf("expected the matching runs to be listed, got %+v", result)
+	}
+	for _, call := range imp.Calls {
+		if call == "GetRun" || call == "UpdateRun" || call == "Terminate" {
+			t.Errorf("expected dry runs not to stop anything, got call %s", call)
+		}
+	}
+}
+
+func TestExecutionService_StopRun(t *testing.T) {
+	ctx := context.Background()
+	es, imp := setUp(t)
+	gracePeriod := int64(30)
+	stop := state.NewRunStop(state.StopRequest{Reason: "wrong input", GracePeriodSeconds: &gracePeriod},
+		state.UserInfo{Email: "somebody@example.com"}, time.Now())
+
+	run := imp.Runs["runA"]
+	run.Status = state.StatusRunning
+	imp.Runs["runA"] = run
+	if err := es.(*executionService).stopRun(ctx, run, stop); err != nil {
+		t.Fatal(err)
+	}
+	stopped := imp.Runs["runA"]
+	if stopped.Status != state.StatusStopped || stopped.Stop == nil || stopped.Stop.By != "somebody@example.com" {
+		t.Errorf("expected who stopped the run to be recorded, got %+v", stopped.Stop)
+	}
+	if *stopped.ExitReason != "Task terminated by - somebody@example.com: wrong input" {
+		t.Errorf("unexpected exit reason %q", *stopped.ExitReason)
+	}
+}
@@ -2,8 +2,10 @@ package services
 
 import (
 	"context"
+	"fmt"
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/stitchfix/flotilla-os/config"
 	"github.com/stitchfix/flotilla-os/exceptions"
@@ -17,6 +19,14 @@ type TemplateService interface {
 	List(ctx context.Context, limit int, offset int, sortBy string, order string) (state.TemplateList, error)
 	ListLatestOnly(ctx context.Context, limit int, offset int, sortBy string, order string) (state.TemplateList, error)
 	Create(ctx context.Context, tpl *state.CreateTemplateRequest) (state.CreateTemplateResponse, error)
+	Deprecate(ctx context.Context, templateID string, user string, deprecation state.TemplateDeprecation) (state.Template, error)
+	Undeprecate(ctx context.Context, templateID string) (state.Template, error)
+	ListChannels(ctx context.Context, templateName string) (state.TemplateChannelList, error)
+	SetChannel(ctx context.Context, templateName string, channel string, user string, req state.TemplateChannelRequest) (state.TemplateChannel, error)
+	DeleteChannel(ctx context.Context, templateName string, channel string) error
+	Usage(ctx context.Context, templateName string, since time.Time) (state.TemplateUsageReport, error)
+	Render(ctx context.Context, templateID string, payload state.TemplatePayload) (state.TemplateRender, error)
+	Lint(ctx context.Context, req *state.CreateTemplateRequest) (state.TemplateLint, error)
 }
 
 type templateService struct {
@@ -69,8 +79,17 @@ func (ts *templateService) Create(ctx context.Context, req *state.CreateTemplate
 	}
 
 	// Check if prev and curr are diff, if they are, write curr to DB (increment)
-	// version number by 1. Otherwise, return prev.
+	// version number by 1. Otherwise, return prev. The new version's schema
+	// must accept the payloads prev accepted, unless the request allows it not
+	// to.
 	if ts.diff(prev, curr) == true {
+		incompatibilities := state.SchemaIncompatibilities(prev.Schema, curr.Schema, curr.Defaults)
+		if len(incompatibilities) > 0 && !req.AllowIncompatibleSchema {
+			return res, exceptions.ConflictingResource{ErrorString: fmt.Sprintf(
+				"schema of template [%s] rejects payloads version [%d] accepted:\n%s",
+				curr.TemplateName, prev.Version, strings.Join(incompatibilities, "\n"))}
+		}
+		res.Incompatibilities = incompatibilities
 		curr.Version = prev.Version + 1
 		res.Template = curr
 		res.DidCreate = true
@@ -101,6 +120,154 @@ func (ts *templateService) ListLatestOnly(ctx context.Context, limit int, offset
 	return ts.sm.ListTemplatesLatestOnly(ctx, limit, offset, sortBy, order)
 }
 
+// Deprecate deprecates the template version. Versions targeted by a channel
+// can't block runs.
+func (ts *templateService) Deprecate(ctx context.Context, templateID string, user string, deprecation state.TemplateDeprecation) (state.Template, error) {
+	if err := deprecation.Validate(); err != nil {
+		return state.Template{}, exceptions.MalformedInput{ErrorString: err.Error()}
+	}
+	tpl, err := ts.sm.GetTemplateByID(ctx, templateID)
+	if err != nil {
+		return tpl, err
+	}
+	if deprecation.Blocks() {
+		channels, err := ts.sm.ListTemplateChannels(ctx, tpl.TemplateName)
+		if err != nil {
+			return tpl, err
+		}
+		for _, c := range channels.Channels {
+			if c.Version == tpl.Version {
+				return tpl, exceptions.ConflictingResource{ErrorString: fmt.Sprintf(
+					"version [%d] of template [%s] is targeted by channel [%s], it can't block runs",
+					tpl.Version, tpl.TemplateName, c.Channel)}
+			}
+		}
+	}
+	deprecation.By = user
+	deprecation.DeprecatedAt = time.Now()
+	return ts.sm.UpdateTemplateDeprecation(ctx, templateID, &deprecation)
+}
+
+// Undeprecate lifts the deprecation of the template version.
+func (ts *templateService) Undeprecate(ctx context.Context, templateID string) (state.Template, error) {
+	return ts.sm.UpdateTemplateDeprecation(ctx, templateID, nil)
+}
+
+// ListChannels lists the channels of the template.
+func (ts *templateService) ListChannels(ctx context.Context, templateName string) (state.TemplateChannelList, error) {
+	if _, err := ts.getLatestByName(ctx, templateName); err != nil {
+		return state.TemplateChannelList{}, err
+	}
+	return ts.sm.ListTemplateChannels(ctx, templateName)
+}
+
+// SetChannel points the channel of the template at a version which doesn't
+// block runs.
+func (ts *templateService) SetChannel(ctx context.Context, templateName string, channel string, user string, req state.TemplateChannelRequest) (state.TemplateChannel, error) {
+	if err := state.ValidateTemplateChannelName(channel); err != nil {
+		return state.TemplateChannel{}, exceptions.MalformedInput{ErrorString: err.Error()}
+	}
+	if _, err := ts.getLatestByName(ctx, templateName); err != nil {
+		return state.TemplateChannel{}, err
+	}
+	found, tpl, err := ts.sm.GetTemplateByVersion(ctx, templateName, req.Version)
+	if err != nil {
+		return state.TemplateChannel{}, err
+	}
+	if !found {
+		return state.TemplateChannel{}, exceptions.MissingResource{ErrorString: fmt.Sprintf(
+			"template [%s] has no version [%d]", templateName, req.Version)}
+	}
+	if tpl.Deprecation.Blocks() {
+		return state.TemplateChannel{}, exceptions.ConflictingResource{ErrorString: tpl.Deprecation.Warning(tpl)}
+	}
+	return ts.sm.SetTemplateChannel(ctx, state.TemplateChannel{
+		TemplateName: templateName,
+		Channel:      channel,
+		Version:      req.Version,
+		UpdatedBy:    user,
+		UpdatedAt:    time.Now(),
+	})
+}
+
+// DeleteChannel deletes the channel of the template; runs targeting it fall
+// back to the latest version.
+func (ts *templateService) DeleteChannel(ctx context.Context, templateName string, channel string) error {
+	return ts.sm.DeleteTemplateChannel(ctx, templateName, channel)
+}
+
+// Usage reports the runs of each version of the template queued since a
+// point in time, along with the channels targeting them.
+func (ts *templateService) Usage(ctx context.Context, templateName string, since time.Time) (state.TemplateUsageReport, error) {
+	report := state.TemplateUsageReport{TemplateName: templateName, Since: since}
+	if _, err := ts.getLatestByName(ctx, templateName); err != nil {
+		return report, err
+	}
+	versions, err := ts.sm.GetTemplateUsage(ctx, templateName, since)
+	if err != nil {
+		return report, err
+	}
+	channels, err := ts.sm.ListTemplateChannels(ctx, templateName)
+	if err != nil {
+		return report, err
+	}
+	for i := range versions {
+		for _, c := range channels.Channels {
+			if c.Version == versions[i].Version {
+				versions[i].Channels = append(versions[i].Channels, c.Channel)
+			}
+		}
+	}
+	report.Versions = versions
+	return report, nil
+}
+
+// Render previews the command of the template for the payload. Payloads the
+// schema rejects and command templates failing to render them aren't errors,
+// they make an invalid render.
+func (ts *templateService) Render(ctx context.Context, templateID string, payload state.TemplatePayload) (state.TemplateRender, error) {
+	tpl, err := ts.sm.GetTemplateByID(ctx, templateID)
+	if err != nil {
+		return state.TemplateRender{}, err
+	}
+	command, merged, err := tpl.RenderCommand(payload)
+	render := state.TemplateRender{Payload: merged, Command: command, Valid: err == nil}
+	if errs, ok := err.(state.TemplatePayloadErrors); ok {
+		render.Errors = errs
+	} else if err != nil {
+		render.RenderError = err.Error()
+	}
+	return render, nil
+}
+
+// Lint checks the command template of a template to be created against its
+// schema and defaults.
+func (ts *templateService) Lint(ctx context.Context, req *state.CreateTemplateRequest) (state.TemplateLint, error) {
+	if len(req.CommandTemplate) == 0 {
+		return state.TemplateLint{}, exceptions.MalformedInput{ErrorString: "string [command_template] must be specified"}
+	}
+	tpl := state.Template{
+		TemplateName:    req.TemplateName,
+		Schema:          req.Schema,
+		CommandTemplate: req.CommandTemplate,
+		Defaults:        req.Defaults,
+	}
+	return tpl.LintCommandTemplate(), nil
+}
+
+// getLatestByName returns the latest version of the template, failing with a
+// MissingResource when there's none.
+func (ts *templateService) getLatestByName(ctx context.Context, templateName string) (state.Template, error) {
+	found, tpl, err := ts.sm.GetLatestTemplateByTemplateName(ctx, templateName)
+	if err != nil {
+		return tpl, err
+	}
+	if !found {
+		return tpl, exceptions.MissingResource{ErrorString: fmt.Sprintf("template [%s] not found", templateName)}
+	}
+	return tpl, nil
+}
+
 // diff performs a diff between all fields (except for TemplateName and
 // Version) of two templates.
 func (ts *templateService) diff(prev state.Template, curr state.Template) bool {
@@ -180,6 +347,22 @@ func (ts *templateService) diff(prev state.Template, curr state.Template) bool {
 		return true
 	}
 
+	if reflect.DeepEqual(prev.InitContainers, curr.InitContainers) == false {
+		return true
+	}
+
+	if reflect.DeepEqual(prev.Sidecars, curr.Sidecars) == false {
+		return true
+	}
+
+	if reflect.DeepEqual(prev.SharedVolumes, curr.SharedVolumes) == false {
+		return true
+	}
+
+	if reflect.DeepEqual(prev.Volumes, curr.Volumes) == false {
+		return true
+	}
+
 	return false
 }
 
@@ -208,6 +391,9 @@ func (ts *templateService) constructTemplateFromCreateTemplateRequest(req *state
 
 	if req.Gpu != nil {
 		tpl.Gpu = req.Gpu
+	} else {
+		gpu := int64(0)
+		tpl.Gpu = &gpu
 	}
 	if req.Cpu != nil {
 		tpl.Cpu = req.Cpu
@@ -221,7 +407,8 @@ func (ts *templateService) constructTemplateFromCreateTemplateRequest(req *state
 	if req.AdaptiveResourceAllocation != nil {
 		tpl.AdaptiveResourceAllocation = req.AdaptiveResourceAllocation
 	} else {
-		*tpl.AdaptiveResourceAllocation = true
+		adaptiveResourceAllocation := true
+		tpl.AdaptiveResourceAllocation = &adaptiveResourceAllocation
 	}
 
 	if req.Ports != nil {
@@ -230,6 +417,18 @@ func (ts *templateService) constructTemplateFromCreateTemplateRequest(req *state
 	if req.Tags != nil {
 		tpl.Tags = req.Tags
 	}
+	if req.InitContainers != nil {
+		tpl.InitContainers = req.InitContainers
+	}
+	if req.Sidecars != nil {
+		tpl.Sidecars = req.Sidecars
+	}
+	if req.SharedVolumes != nil {
+		tpl.SharedVolumes = req.SharedVolumes
+	}
+	if req.Volumes != nil {
+		tpl.Volumes = req.Volumes
+	}
 	if req.Defaults != nil {
 		tpl.Defaults = req.Defaults
 	} else {
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stitchfix/flotilla-os/exceptions"
+	"github.com/stitchfix/flotilla-os/state"
+	"github.com/stitchfix/flotilla-os/testutils"
+)
+
+func setUpTemplates(t *testing.T) (*templateService, *testutils.ImplementsAllTheThings) {
+	mem, cpu, gpu, ara := int64(1024), int64(512), int64(0), true
+	resources := state.ExecutableResources{Image: "image:1", Memory: &mem, Cpu: &cpu, Gpu: &gpu, AdaptiveResourceAllocation: &ara}
+	imp := &testutils.ImplementsAllTheThings{
+		T: t,
+		Templates: map[string]state.Template{
+			"tpl-1": {
+				TemplateID:          "tpl-1",
+				TemplateName:        "tpl",
+				Version:             1,
+				Schema:              state.TemplateJSONSchema{"type": "object", "properties": map[string]interface{}{"name": map[string]interface{}{"type": "string"}}},
+				CommandTemplate:     "echo {{.name}}",
+				ExecutableResources: resources,
+			},
+			"tpl-2": {
+				TemplateID:          "tpl-2",
+				TemplateName:        "tpl",
+				Version:             2,
+				Schema:              state.TemplateJSONSchema{"type": "object", "properties": map[string]interface{}{"name": map[string]interface{}{"type": "string"}}},
+				CommandTemplate:     "echo hello {{.name}}",
+				ExecutableResources: resources,
+			},
+		},
+	}
+	return &templateService{sm: imp}, imp
+}
+
+func TestTemplateService_CreateIncompatibleSchema(t *testing.T) {
+	ctx := context.Background()
+	ts, imp := setUpTemplates(t)
+	prev := imp.Templates["tpl-2"]
+	req := &state.CreateTemplateRequest{
+		TemplateName:        "tpl",
+		Schema:              state.TemplateJSONSchema{"type": "object", "required": []interface{}{"name"}},
+		CommandTemplate:     prev.CommandTemplate,
+		ExecutableResources: prev.ExecutableResources,
+	}
+	if _, err := ts.Create(ctx, req); err == nil {
+		t.Fatalf("expected a schema requiring a new field to be refused")
+	} else if _, ok := err.(exceptions.ConflictingResource); !ok {
+		t.Errorf("expected a conflict, got %v", err)
+	}
+
+	req.AllowIncompatibleSchema = true
+	res, err := ts.Create(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.DidCreate || res.Template.Version != 3 || len(res.Incompatibilities) != 1 {
+		t.Errorf("expected version 3 to be created with its incompatibilities, got %+v", res)
+	}
+}
+
+func TestTemplateService_Channels(t *testing.T) {
+	ctx := context.Background()
+	ts, imp := setUpTemplates(t)
+
+	if _, err := ts.SetChannel(ctx, "tpl", "latest", "somebody", state.TemplateChannelRequest{Version: 1}); err == nil {
+		t.Errorf("expected the latest channel to be reserved")
+	}
+	channel, err := ts.SetChannel(ctx, "tpl", "stable", "somebody", state.TemplateChannelRequest{Version: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if channel.TemplateID != "tpl-1" || channel.UpdatedBy != "somebody" {
+		t.Errorf("expected the channel to target version 1, got %+v", channel)
+	}
+
+	if _, err = ts.Deprecate(ctx, "tpl-1", "somebody", state.TemplateDeprecation{Level: state.TemplateDeprecationBlock}); err == nil {
+		t.Errorf("expected versions targeted by a channel not to block runs")
+	}
+	tpl, err := ts.Deprecate(ctx, "tpl-1", "somebody", state.TemplateDeprecation{Level: state.TemplateDeprecationWarn, Message: "use stable"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tpl.Deprecation == nil || tpl.Deprecation.By != "somebody" || tpl.Deprecation.DeprecatedAt.IsZero() {
+		t.Errorf("expected the deprecation to be recorded, got %+v", tpl.Deprecation)
+	}
+
+	es, _ := setUp(t)
+	es.(*executionService).stateManager = imp
+	resolved, err := es.(*executionService).getTemplateByNameAndVersion(ctx, "tpl", "stable")
+	if err != nil || resolved.TemplateID != "tpl-1" {
+		t.Errorf("expected the stable channel to resolve to version 1, got %s %v", resolved.TemplateID, err)
+	}
+	resolved, err = es.(*executionService).getTemplateByNameAndVersion(ctx, "tpl", "latest")
+	if err != nil || resolved.TemplateID != "tpl-2" {
+		t.Errorf("expected the latest version, got %s %v", resolved.TemplateID, err)
+	}
+	if _, err = es.(*executionService).getTemplateByNameAndVersion(ctx, "tpl", "stabel"); err == nil {
+		t.Errorf("expected unknown channels not to resolve")
+	} else if _, ok := err.(exceptions.MissingResource); !ok {
+		t.Errorf("expected a missing resource for an unknown channel, got %v", err)
+	}
+	warnings, err := es.(*executionService).checkDeprecation(resolved)
+	if err != nil || len(warnings) != 0 {
+		t.Errorf("expected no warnings for version 2, got %v %v", warnings, err)
+	}
+
+	report, err := ts.Usage(ctx, "tpl", tpl.Deprecation.DeprecatedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Versions) != 2 || report.Versions[1].Version != 1 || len(report.Versions[1].Channels) != 1 {
+		t.Errorf("expected the report to list the channels of each version, got %+v", report)
+	}
+
+	if err = ts.DeleteChannel(ctx, "tpl", "stable"); err != nil {
+		t.Fatal(err)
+	}
+	tpl, err = ts.Deprecate(ctx, "tpl-1", "somebody", state.TemplateDeprecation{Level: state.TemplateDeprecationBlock})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = es.(*executionService).checkDeprecation(tpl); err == nil {
+		t.Errorf("expected runs of blocked versions to be refused")
+	} else if _, ok := err.(exceptions.ConflictingResource); !ok {
+		t.Errorf("expected a conflict, got %v", err)
+	}
+	if _, err = ts.SetChannel(ctx, "tpl", "stable", "somebody", state.TemplateChannelRequest{Version: 1}); err == nil {
+		t.Errorf("expected channels not to target blocked versions")
+	}
+}
+
+func TestTemplateService_Render(t *testing.T) {
+	ctx := context.Background()
+	ts, imp := setUpTemplates(t)
+	tpl := imp.Templates["tpl-2"]
+	tpl.Schema = state.TemplateJSONSchema{"type": "object", "required": []interface{}{"name"}}
+	imp.Templates["tpl-2"] = tpl
+
+	render, err := ts.Render(ctx, "tpl-2", state.TemplatePayload{"name": "world"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !render.Valid || render.Command != "echo hello world" {
+		t.Errorf("expected the command to be rendered, got %+v", render)
+	}
+
+	render, err = ts.Render(ctx, "tpl-2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if render.Valid || len(render.Errors) != 1 || render.Errors[0].Field != "name" {
+		t.Errorf("expected the missing field to be reported, got %+v", render)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/stitchfix/flotilla-os/config"
 	"github.com/stitchfix/flotilla-os/exceptions"
 	"github.com/stitchfix/flotilla-os/state"
+	"time"
 )
 
 //
@@ -16,17 +17,23 @@ type WorkerService interface {
 	Get(ctx context.Context, workerType string, engine string) (state.Worker, error)
 	Update(ctx context.Context, workerType string, updates state.Worker) (state.Worker, error)
 	BatchUpdate(ctx context.Context, updates []state.Worker) (state.WorkersList, error)
+	Topology(ctx context.Context) (state.WorkerTopology, error)
 }
 
 type workerService struct {
-	sm state.Manager
+	sm          state.Manager
+	topologyTTL time.Duration
 }
 
 //
 // NewWorkerService configures and returns a WorkerService
 //
 func NewWorkerService(conf config.Config, sm state.Manager) (WorkerService, error) {
-	ws := workerService{sm: sm}
+	ttl, err := state.WorkerTopologyTTL(conf)
+	if err != nil {
+		return nil, err
+	}
+	ws := workerService{sm: sm, topologyTTL: ttl}
 	return &ws, nil
 }
 
@@ -47,6 +54,9 @@ func (ws *workerService) Update(ctx context.Context, workerType string, updates
 	if err := ws.validate(workerType); err != nil {
 		return w, err
 	}
+	if err := ws.validateScope(updates.Scope); err != nil {
+		return w, err
+	}
 
 	return ws.sm.UpdateWorker(ctx, workerType, updates)
 }
@@ -57,6 +67,9 @@ func (ws *workerService) BatchUpdate(ctx context.Context, updates []state.Worker
 		if err := ws.validate(update.WorkerType); err != nil {
 			return wl, err
 		}
+		if err := ws.validateScope(update.Scope); err != nil {
+			return wl, err
+		}
 	}
 	return ws.sm.BatchUpdateWorkers(ctx, updates)
 }
@@ -74,3 +87,53 @@ func (ws *workerService) validate(workerType string) error {
 	}
 	return nil
 }
+
+func (ws *workerService) validateScope(scope string) error {
+	if len(scope) > 0 && !state.IsValidWorkerScope(scope) {
+		return exceptions.MalformedInput{
+			ErrorString: fmt.Sprintf(
+				"Worker scope: [%s] is not a valid scope; valid scopes: %s",
+				scope, []string{state.WorkerScopeInstance, state.WorkerScopeLeader})}
+	}
+	return nil
+}
+
+// Topology is which instance runs which workers: the live instances with
+// their share of the runs swept by the status workers, and the leader running
+// the leader workers.
+func (ws *workerService) Topology(ctx context.Context) (state.WorkerTopology, error) {
+	var topology state.WorkerTopology
+	instances, err := ws.sm.ListWorkerInstances(ctx, ws.topologyTTL)
+	if err != nil {
+		return topology, err
+	}
+	lease, err := ws.sm.GetWorkerLease(ctx, state.WorkerLeaderLease)
+	if err != nil {
+		if _, ok := err.(exceptions.MissingResource); !ok {
+			return topology, err
+		}
+	} else if lease.ExpiresAt.After(time.Now()) {
+		topology.Leader = &lease
+	}
+	workers, err := ws.sm.ListWorkers(ctx, state.EKSEngine)
+	if err != nil {
+		return topology, err
+	}
+	topology.Workers = workers.Workers
+	if topology.Workers == nil {
+		topology.Workers = []state.Worker{}
+	}
+
+	var members []string
+	for _, i := range instances {
+		members = append(members, i.InstanceID)
+	}
+	shares := state.NewHashRing(members, state.HashRingReplicas).Shares()
+	topology.Instances = []state.WorkerInstance{}
+	for _, i := range instances {
+		i.Leader = topology.Leader != nil && topology.Leader.Holder == i.InstanceID
+		i.ShardShare = shares[i.InstanceID]
+		topology.Instances = append(topology.Instances, i)
+	}
+	return topology, nil
+}
@@ -0,0 +1,200 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/stitchfix/flotilla-os/config"
+)
+
+// AnalyticsConfig configures the run analytics
+type AnalyticsConfig struct {
+	// TeamLabel is the run label holding the team of the runs
+	TeamLabel string
+	// SlowRunFactor is how many times their historical runtime runs must
+	// run for to be slow
+	SlowRunFactor float64
+	// Window is the window of the latencies exported as metrics
+	Window time.Duration
+}
+
+// NewAnalyticsConfig reads `analytics_team_label` (default `team`),
+// `analytics_slow_run_factor` (default 3) and `analytics_window` (default 1h).
+func NewAnalyticsConfig(conf config.Config) AnalyticsConfig {
+	ac := AnalyticsConfig{TeamLabel: "team", SlowRunFactor: 3, Window: time.Hour}
+	if conf == nil {
+		return ac
+	}
+	if conf.IsSet("analytics_team_label") {
+		ac.TeamLabel = conf.GetString("analytics_team_label")
+	}
+	if conf.IsSet("analytics_slow_run_factor") && conf.GetFloat64("analytics_slow_run_factor") > 0 {
+		ac.SlowRunFactor = conf.GetFloat64("analytics_slow_run_factor")
+	}
+	if window, err := time.ParseDuration(conf.GetString("analytics_window")); err == nil && window > 0 {
+		ac.Window = window
+	}
+	return ac
+}
+
+// RunDimension is what run latencies are grouped by.
+type RunDimension string
+
+const (
+	RunDimensionCluster    RunDimension = "cluster"
+	RunDimensionTier       RunDimension = "tier"
+	RunDimensionTeam       RunDimension = "team"
+	RunDimensionDefinition RunDimension = "definition"
+	RunDimensionEngine     RunDimension = "engine"
+)
+
+// RunDimensions lists the dimensions run latencies can be grouped by.
+var RunDimensions = []RunDimension{
+	RunDimensionCluster,
+	RunDimensionTier,
+	RunDimensionTeam,
+	RunDimensionDefinition,
+	RunDimensionEngine,
+}
+
+// IsValidRunDimension checks that runs can be grouped by the dimension.
+func IsValidRunDimension(dimension RunDimension) bool {
+	for _, d := range RunDimensions {
+		if d == dimension {
+			return true
+		}
+	}
+	return false
+}
+
+// RunLatencyQuery selects the runs queued in [Since, Until) and groups them by
+// dimension, and by buckets of Interval when it is set. TeamLabel is the run
+// label holding the team of the runs.
+type RunLatencyQuery struct {
+	GroupBy   RunDimension
+	Since     time.Time
+	Until     time.Time
+	Interval  time.Duration
+	TeamLabel string
+}
+
+// Percentiles of durations, in seconds. They're nil when no run had the
+// duration.
+type Percentiles struct {
+	P50 *float64 `json:"p50"`
+	P90 *float64 `json:"p90"`
+	P99 *float64 `json:"p99"`
+}
+
+// RunLatencyStats are the latencies of the runs of a dimension value:
+//   - QueueWait from QUEUED to PENDING, ie. until the run was submitted (or
+//     RUNNING for runs which were never seen pending)
+//   - Pending from PENDING to RUNNING, ie. scheduling and image pulls
+//   - Runtime from RUNNING to finished
+//
+// Runs which haven't reached a state yet don't count in its latency, resubmitted
+// runs only count their last attempt.
+type RunLatencyStats struct {
+	Bucket    *time.Time  `json:"bucket,omitempty"`
+	Value     string      `json:"value"`
+	Runs      int64       `json:"runs"`
+	Started   int64       `json:"started"`
+	Finished  int64       `json:"finished"`
+	QueueWait Percentiles `json:"queue_wait_seconds"`
+	Pending   Percentiles `json:"pending_seconds"`
+	Runtime   Percentiles `json:"runtime_seconds"`
+}
+
+// RunLatencyReport wraps the latencies of the runs of a window
+type RunLatencyReport struct {
+	GroupBy  RunDimension      `json:"group_by"`
+	Since    time.Time         `json:"since"`
+	Until    time.Time         `json:"until"`
+	Interval string            `json:"interval,omitempty"`
+	Stats    []RunLatencyStats `json:"stats"`
+}
+
+// SlowRun is a running run which has been running for longer than its usual
+// runtime.
+type SlowRun struct {
+	RunID             string    `json:"run_id"`
+	ExecutableID      string    `json:"executable_id"`
+	Alias             string    `json:"alias"`
+	ClusterName       string    `json:"cluster"`
+	Tier              Tier      `json:"tier,omitempty"`
+	StartedAt         time.Time `json:"started_at"`
+	RuntimeMinutes    float64   `json:"runtime_minutes"`
+	HistoricalMinutes float64   `json:"historical_minutes"`
+	Ratio             float64   `json:"ratio"`
+}
+
+// SlowRunList wraps the slow runs and the factor they exceed
+type SlowRunList struct {
+	Factor float64   `json:"factor"`
+	Total  int       `json:"total"`
+	Runs   []SlowRun `json:"runs"`
+}
+
+// slowRunsLimit is the largest number of running runs checked for slowness.
+const slowRunsLimit = 1000
+
+// ListSlowRuns returns the running runs which have been running for more than
+// factor times their historical runtime, the 95th percentile of the runtime
+// of their command's successful runs (see GetTaskHistoricalRuntime). Runs
+// without history are skipped.
+func ListSlowRuns(ctx context.Context, sm Manager, factor float64, now time.Time) (SlowRunList, error) {
+	slow := SlowRunList{Factor: factor, Runs: []SlowRun{}}
+	if factor <= 0 {
+		return slow, fmt.Errorf("the slow run factor must be positive, got %v", factor)
+	}
+
+	runs, err := sm.ListRuns(ctx, slowRunsLimit, 0, "started_at", "asc", map[string][]string{
+		"status": {StatusRunning},
+	}, nil, []string{EKSEngine, EKSSparkEngine})
+	if err != nil {
+		return slow, err
+	}
+
+	// The historical runtime only depends on the executable and the command
+	historical := map[string]float64{}
+	for _, run := range runs.Runs {
+		if run.StartedAt == nil || run.ExecutableID == nil {
+			continue
+		}
+		key := *run.ExecutableID
+		if run.CommandHash != nil {
+			key = fmt.Sprintf("%s/%s", key, *run.CommandHash)
+		}
+		minutes, ok := historical[key]
+		if !ok {
+			m, err := sm.GetTaskHistoricalRuntime(ctx, *run.ExecutableID, run.RunID)
+			if err != nil {
+				m = 0
+			}
+			minutes = float64(m)
+			historical[key] = minutes
+		}
+		if minutes <= 0 {
+			continue
+		}
+
+		runtime := now.Sub(*run.StartedAt).Minutes()
+		if runtime <= factor*minutes {
+			continue
+		}
+		slow.Runs = append(slow.Runs, SlowRun{
+			RunID:             run.RunID,
+			ExecutableID:      *run.ExecutableID,
+			Alias:             run.Alias,
+			ClusterName:       run.ClusterName,
+			Tier:              run.Tier,
+			StartedAt:         *run.StartedAt,
+			RuntimeMinutes:    runtime,
+			HistoricalMinutes: minutes,
+			Ratio:             runtime / minutes,
+		})
+	}
+	slow.Total = len(slow.Runs)
+	return slow, nil
+}
@@ -0,0 +1,229 @@
+package state
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ArrayTaskType is the task type of array runs, the parents of the child
+// runs created from a single array execution request. Array runs are never
+// executed themselves.
+var ArrayTaskType = "array"
+
+// ArrayIndexVar is the reserved environment variable holding the index of a
+// child run within its array run.
+var ArrayIndexVar = "FLOTILLA_ARRAY_INDEX"
+
+// ArraySizeVar is the reserved environment variable holding the number of
+// child runs of the array run.
+var ArraySizeVar = "FLOTILLA_ARRAY_SIZE"
+
+// ArraySpec describes the child runs of an array run. The parameter sets of
+// the children are the cartesian product of Parameters, Range and each
+// variable in Product; at least one of them has to be set.
+type ArraySpec struct {
+	// Parameters lists explicit parameter sets.
+	Parameters []ArrayParameters `json:"parameters,omitempty"`
+	// Range sets an environment variable to each value of a range.
+	Range *ArrayRange `json:"range,omitempty"`
+	// Product maps environment variables to the values they take.
+	Product map[string][]string `json:"product,omitempty"`
+	// Parallelism caps the number of children queued or running at once.
+	Parallelism int64 `json:"parallelism,omitempty"`
+}
+
+// ArrayParameters is the set of parameters a child run differs by: extra
+// environment variables and, for template runs, template payload fields.
+type ArrayParameters struct {
+	Env             map[string]string `json:"env,omitempty"`
+	TemplatePayload TemplatePayload   `json:"template_payload,omitempty"`
+}
+
+// ArrayRange sets Env to Start, Start+Step, ... up to, but excluding, End.
+type ArrayRange struct {
+	Env   string `json:"env"`
+	Start int64  `json:"start"`
+	End   int64  `json:"end"`
+	Step  int64  `json:"step,omitempty"`
+}
+
+// Expand returns the parameter sets of the spec's child runs, in index order.
+func (s ArraySpec) Expand(maxSize int) ([]ArrayParameters, error) {
+	var dimensions [][]ArrayParameters
+	if len(s.Parameters) > 0 {
+		dimensions = append(dimensions, s.Parameters)
+	}
+	if s.Range != nil {
+		r := *s.Range
+		if len(r.Env) == 0 {
+			return nil, fmt.Errorf("array range must set [env]")
+		}
+		if r.Step == 0 {
+			r.Step = 1
+		}
+		if r.Step < 0 || r.End <= r.Start {
+			return nil, fmt.Errorf("array range [%d, %d) with step %d is empty", r.Start, r.End, r.Step)
+		}
+		if (r.End-r.Start+r.Step-1)/r.Step > int64(maxSize) {
+			return nil, fmt.Errorf("array can't have more than %d runs", maxSize)
+		}
+		var values []ArrayParameters
+		for v := r.Start; v < r.End; v += r.Step {
+			values = append(values, ArrayParameters{Env: map[string]string{r.Env: strconv.FormatInt(v, 10)}})
+		}
+		dimensions = append(dimensions, values)
+	}
+	var names []string
+	for name := range s.Product {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if len(s.Product[name]) == 0 {
+			return nil, fmt.Errorf("array product variable [%s] has no values", name)
+		}
+		var values []ArrayParameters
+		for _, v := range s.Product[name] {
+			values = append(values, ArrayParameters{Env: map[string]string{name: v}})
+		}
+		dimensions = append(dimensions, values)
+	}
+	if len(dimensions) == 0 {
+		return nil, fmt.Errorf("array must set [parameters], [range] or [product]")
+	}
+
+	size := 1
+	for _, d := range dimensions {
+		size *= len(d)
+		if size > maxSize {
+			return nil, fmt.Errorf("array can't have more than %d runs", maxSize)
+		}
+	}
+
+	expanded := []ArrayParameters{{}}
+	for _, d := range dimensions {
+		next := make([]ArrayParameters, 0, len(expanded)*len(d))
+		for _, prefix := range expanded {
+			for _, p := range d {
+				next = append(next, prefix.merge(p))
+			}
+		}
+		expanded = next
+	}
+	for _, p := range expanded {
+		for name := range p.Env {
+			if name == ArrayIndexVar || name == ArraySizeVar {
+				return nil, fmt.Errorf("array parameters can't set reserved variable [%s]", name)
+			}
+		}
+	}
+	return expanded, nil
+}
+
+// merge returns the parameters with other's parameters added, other's values
+// win when both set the same variable or payload field.
+func (p ArrayParameters) merge(other ArrayParameters) ArrayParameters {
+	merged := ArrayParameters{}
+	if len(p.Env)+len(other.Env) > 0 {
+		merged.Env = make(map[string]string)
+		for k, v := range p.Env {
+			merged.Env[k] = v
+		}
+		for k, v := range other.Env {
+			merged.Env[k] = v
+		}
+	}
+	if len(p.TemplatePayload)+len(other.TemplatePayload) > 0 {
+		merged.TemplatePayload = make(TemplatePayload)
+		for k, v := range p.TemplatePayload {
+			merged.TemplatePayload[k] = v
+		}
+		for k, v := range other.TemplatePayload {
+			merged.TemplatePayload[k] = v
+		}
+	}
+	return merged
+}
+
+// ArrayStatus is the progress of an array run's children.
+type ArrayStatus struct {
+	Size        int64 `json:"size"`
+	Parallelism int64 `json:"parallelism"`
+	Held        int64 `json:"held"`
+	Queued      int64 `json:"queued"`
+	Running     int64 `json:"running"`
+	Succeeded   int64 `json:"succeeded"`
+	Failed      int64 `json:"failed"`
+}
+
+// Active is the number of children counting against the parallelism limit.
+func (a ArrayStatus) Active() int64 {
+	return a.Queued + a.Running
+}
+
+// Done checks whether every child has stopped.
+func (a ArrayStatus) Done() bool {
+	return a.Succeeded+a.Failed == a.Size
+}
+
+// SummarizeArray counts the children of an array run by status.
+func SummarizeArray(children []Run, parallelism int64) ArrayStatus {
+	summary := ArrayStatus{Size: int64(len(children)), Parallelism: parallelism}
+	for _, child := range children {
+		switch child.Status {
+		case StatusHeld:
+			summary.Held++
+		case StatusQueued, StatusNeedsRetry:
+			summary.Queued++
+		case StatusPending, StatusRunning:
+			summary.Running++
+		case StatusStopped:
+			if child.ExitCode != nil && *child.ExitCode == 0 {
+				summary.Succeeded++
+			} else {
+				summary.Failed++
+			}
+		}
+	}
+	return summary
+}
+
+// ArrayRunUpdate returns the update bringing an array run in line with the
+// status of its children: it's running once any child left the queue and
+// stops, failed if any child failed, when all children have stopped.
+func ArrayRunUpdate(parent Run, children []Run, summary ArrayStatus) Run {
+	update := Run{Array: &summary, Status: parent.Status}
+	var startedAt, finishedAt *time.Time
+	for _, child := range children {
+		if child.StartedAt != nil && (startedAt == nil || child.StartedAt.Before(*startedAt)) {
+			startedAt = child.StartedAt
+		}
+		if child.FinishedAt != nil && (finishedAt == nil || child.FinishedAt.After(*finishedAt)) {
+			finishedAt = child.FinishedAt
+		}
+	}
+	if parent.StartedAt == nil {
+		update.StartedAt = startedAt
+	}
+	if summary.Running+summary.Succeeded+summary.Failed > 0 {
+		update.Status = StatusRunning
+	}
+	if summary.Done() {
+		update.Status = StatusStopped
+		exitCode := int64(0)
+		if summary.Failed > 0 {
+			exitCode = 1
+			reason := fmt.Sprintf("%d of %d array runs failed", summary.Failed, summary.Size)
+			update.ExitReason = &reason
+		}
+		update.ExitCode = &exitCode
+		if finishedAt == nil {
+			now := time.Now()
+			finishedAt = &now
+		}
+		update.FinishedAt = finishedAt
+	}
+	return update
+}
@@ -0,0 +1,76 @@
+package state
+
+import "testing"
+
+func TestArraySpec_Expand(t *testing.T) {
+	spec := ArraySpec{
+		Range:   &ArrayRange{Env: "DAY", Start: 1, End: 4},
+		Product: map[string][]string{"REGION": {"us", "eu"}},
+	}
+	params, err := spec.Expand(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(params) != 6 {
+		t.Fatalf("expected 6 parameter sets, got %d", len(params))
+	}
+	expected := []map[string]string{
+		{"DAY": "1", "REGION": "us"},
+		{"DAY": "1", "REGION": "eu"},
+		{"DAY": "2", "REGION": "us"},
+	}
+	for i, env := range expected {
+		for k, v := range env {
+			if params[i].Env[k] != v {
+				t.Errorf("expected parameter set %d to have %s=%s, got %v", i, k, v, params[i].Env)
+			}
+		}
+	}
+
+	if _, err := spec.Expand(5); err == nil {
+		t.Errorf("expected an error for an array larger than the max size")
+	}
+	if _, err := (ArraySpec{}).Expand(100); err == nil {
+		t.Errorf("expected an error for an array without parameters")
+	}
+	reserved := ArraySpec{Parameters: []ArrayParameters{{Env: map[string]string{ArrayIndexVar: "1"}}}}
+	if _, err := reserved.Expand(100); err == nil {
+		t.Errorf("expected an error for parameters setting a reserved variable")
+	}
+	if _, err := (ArraySpec{Range: &ArrayRange{Env: "X", Start: 3, End: 3}}).Expand(100); err == nil {
+		t.Errorf("expected an error for an empty range")
+	}
+}
+
+func TestArrayRunUpdate(t *testing.T) {
+	zero, one := int64(0), int64(1)
+	children := []Run{
+		{Status: StatusStopped, ExitCode: &zero},
+		{Status: StatusRunning},
+		{Status: StatusHeld},
+	}
+	summary := SummarizeArray(children, 2)
+	if summary.Succeeded != 1 || summary.Running != 1 || summary.Held != 1 || summary.Active() != 1 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+	update := ArrayRunUpdate(Run{Status: StatusQueued}, children, summary)
+	if update.Status != StatusRunning {
+		t.Errorf("expected array run to be %s, got %s", StatusRunning, update.Status)
+	}
+
+	children[1] = Run{Status: StatusStopped, ExitCode: &one}
+	children[2] = Run{Status: StatusStopped, ExitCode: &zero}
+	update = ArrayRunUpdate(Run{Status: StatusRunning}, children, SummarizeArray(children, 2))
+	if update.Status != StatusStopped {
+		t.Errorf("expected array run to be %s, got %s", StatusStopped, update.Status)
+	}
+	if update.ExitCode == nil || *update.ExitCode != 1 {
+		t.Errorf("expected array run with a failed child to exit with 1")
+	}
+	if update.ExitReason == nil || *update.ExitReason != "1 of 3 array runs failed" {
+		t.Errorf("unexpected exit reason %v", update.ExitReason)
+	}
+	if update.FinishedAt == nil {
+		t.Errorf("expected array run to have finished_at set")
+	}
+}
@@ -0,0 +1,65 @@
+package state
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Environment variables pointing runs at where their outputs go: files put
+// under FLOTILLA_OUTPUT_URI, or written to FLOTILLA_OUTPUT_DIR when the
+// output directory is mounted, are the run's artifacts.
+var (
+	OutputURIVar = "FLOTILLA_OUTPUT_URI"
+	OutputDirVar = "FLOTILLA_OUTPUT_DIR"
+)
+
+// ResultFileName is the artifact holding the run's result document.
+const ResultFileName = "result.json"
+
+// Artifact is a file a run output.
+type Artifact struct {
+	// Path is relative to the run's output URI.
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	// Checksum is the S3 ETag, the MD5 of artifacts uploaded in one part.
+	Checksum     string    `json:"checksum"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// ArtifactManifest lists the artifacts of a run.
+type ArtifactManifest struct {
+	URI       string     `json:"uri"`
+	Artifacts []Artifact `json:"artifacts"`
+	TotalSize int64      `json:"total_size"`
+	// Truncated is set when the run output more artifacts than are listed.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// RunResult is the result document of a run, the contents of its
+// result.json artifact.
+type RunResult map[string]interface{}
+
+// ArtifactsPrefix returns the S3 key prefix of the artifacts of a run.
+func ArtifactsPrefix(rootDir string, runID string) string {
+	return fmt.Sprintf("%s/%s/", strings.Trim(rootDir, "/"), runID)
+}
+
+// OutputURI returns the S3 URI runs put their artifacts under.
+func OutputURI(bucket string, rootDir string, runID string) string {
+	return fmt.Sprintf("s3://%s/%s", bucket, ArtifactsPrefix(rootDir, runID))
+}
+
+// ValidArtifactPath checks the path of an artifact stays under the run's
+// output URI.
+func ValidArtifactPath(path string) bool {
+	if len(path) == 0 || strings.HasPrefix(path, "/") {
+		return false
+	}
+	for _, part := range strings.Split(path, "/") {
+		if part == ".." {
+			return false
+		}
+	}
+	return true
+}
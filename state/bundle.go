@@ -0,0 +1,307 @@
+package state
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+// BundleAPIVersion is the version of the documents of bundles.
+const BundleAPIVersion = "flotilla/v1"
+
+// BundleKind is the kind of resource a bundle document declares.
+type BundleKind string
+
+const (
+	// BundleKindDefinition documents declare a definition, identified by its
+	// alias.
+	BundleKindDefinition BundleKind = "Definition"
+	// BundleKindTemplate documents declare the latest version of a template,
+	// identified by its name.
+	BundleKindTemplate BundleKind = "Template"
+)
+
+// BundleDocument is a YAML document of a bundle.
+type BundleDocument struct {
+	APIVersion string          `json:"apiVersion"`
+	Kind       BundleKind      `json:"kind"`
+	Spec       json.RawMessage `json:"spec"`
+}
+
+// Bundle declares definitions and templates, as kept in git.
+type Bundle struct {
+	Definitions []Definition
+	Templates   []CreateTemplateRequest
+}
+
+// BundleScope selects the definitions and templates a bundle manages: those
+// exported, and those pruned when missing from the bundle applied.
+type BundleScope struct {
+	Kinds []BundleKind
+	// GroupNames of the definitions, none selecting all of them.
+	GroupNames []string
+	// TemplatePrefix of the names of the templates.
+	TemplatePrefix string
+}
+
+// Includes tells whether the scope includes the kind.
+func (s BundleScope) Includes(kind BundleKind) bool {
+	if len(s.Kinds) == 0 {
+		return true
+	}
+	for _, k := range s.Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// IncludesDefinition tells whether the scope includes the definition.
+func (s BundleScope) IncludesDefinition(d Definition) bool {
+	if !s.Includes(BundleKindDefinition) {
+		return false
+	}
+	return len(s.GroupNames) == 0 || containsString(s.GroupNames, d.GroupName)
+}
+
+// IncludesTemplate tells whether the scope includes the template.
+func (s BundleScope) IncludesTemplate(name string) bool {
+	return s.Includes(BundleKindTemplate) && strings.HasPrefix(name, s.TemplatePrefix)
+}
+
+// BundleAction is what applying a bundle does to a definition or template.
+type BundleAction string
+
+const (
+	BundleActionCreate    BundleAction = "create"
+	BundleActionUpdate    BundleAction = "update"
+	BundleActionDelete    BundleAction = "delete"
+	BundleActionDeprecate BundleAction = "deprecate"
+	BundleActionUnchanged BundleAction = "unchanged"
+)
+
+// BundleChange is a step of the plan of a bundle.
+type BundleChange struct {
+	Kind   BundleKind   `json:"kind"`
+	Name   string       `json:"name"`
+	Action BundleAction `json:"action"`
+	// Fields are the fields of the spec which changed.
+	Fields []string `json:"fields,omitempty"`
+	// Version of the template created or deprecated.
+	Version int64 `json:"version,omitempty"`
+	// Incompatibilities of the schema of the new template version, allowed
+	// by its spec.
+	Incompatibilities []string `json:"incompatibilities,omitempty"`
+}
+
+// BundlePlan is what applying a bundle does, or did.
+type BundlePlan struct {
+	DryRun  bool           `json:"dry_run"`
+	Prune   bool           `json:"prune"`
+	Applied bool           `json:"applied"`
+	Changes []BundleChange `json:"changes"`
+}
+
+// BundleChanges are the writes applying a bundle makes, all or none of which
+// are.
+type BundleChanges struct {
+	CreateDefinitions []Definition
+	// UpdateDefinitions replace the definitions of the same ids.
+	UpdateDefinitions  []Definition
+	DeleteDefinitions  []string
+	CreateTemplates    []Template
+	DeprecateTemplates map[string]TemplateDeprecation
+}
+
+// Empty tells whether there's nothing to write.
+func (c BundleChanges) Empty() bool {
+	return len(c.CreateDefinitions) == 0 && len(c.UpdateDefinitions) == 0 && len(c.DeleteDefinitions) == 0 &&
+		len(c.CreateTemplates) == 0 && len(c.DeprecateTemplates) == 0
+}
+
+// ParseBundle reads the YAML documents of a bundle. Specs are strict: unknown
+// fields are errors. Definitions are identified by their alias and templates
+// by their name, which must be unique within the bundle.
+func ParseBundle(data []byte) (Bundle, error) {
+	var bundle Bundle
+	aliases := map[string]bool{}
+	names := map[string]bool{}
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(data)))
+	for i := 1; ; i++ {
+		raw, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return bundle, fmt.Errorf("document %d: %s", i, err)
+		}
+		if len(bytes.TrimSpace(raw)) == 0 {
+			continue
+		}
+		var doc BundleDocument
+		if err = yaml.Unmarshal(raw, &doc); err != nil {
+			return bundle, fmt.Errorf("document %d: %s", i, err)
+		}
+		if doc.APIVersion == "" && doc.Kind == "" && len(doc.Spec) == 0 {
+			// Only comments.
+			continue
+		}
+		if doc.APIVersion != BundleAPIVersion {
+			return bundle, fmt.Errorf("document %d: unsupported apiVersion [%s], must be [%s]", i, doc.APIVersion, BundleAPIVersion)
+		}
+		switch doc.Kind {
+		case BundleKindDefinition:
+			var d Definition
+			if err = decodeBundleSpec(doc.Spec, &d); err != nil {
+				return bundle, fmt.Errorf("document %d: %s", i, err)
+			}
+			if len(d.Alias) == 0 {
+				return bundle, fmt.Errorf("document %d: definitions must have an [alias]", i)
+			}
+			if aliases[d.Alias] {
+				return bundle, fmt.Errorf("document %d: definition [%s] is declared twice", i, d.Alias)
+			}
+			aliases[d.Alias] = true
+			d.DefinitionID = ""
+			bundle.Definitions = append(bundle.Definitions, d)
+		case BundleKindTemplate:
+			var t CreateTemplateRequest
+			if err = decodeBundleSpec(doc.Spec, &t); err != nil {
+				return bundle, fmt.Errorf("document %d: %s", i, err)
+			}
+			if len(t.TemplateName) == 0 {
+				return bundle, fmt.Errorf("document %d: templates must have a [template_name]", i)
+			}
+			if names[t.TemplateName] {
+				return bundle, fmt.Errorf("document %d: template [%s] is declared twice", i, t.TemplateName)
+			}
+			names[t.TemplateName] = true
+			bundle.Templates = append(bundle.Templates, t)
+		default:
+			return bundle, fmt.Errorf("document %d: unsupported kind [%s], must be one of [%s, %s]", i, doc.Kind, BundleKindDefinition, BundleKindTemplate)
+		}
+	}
+	return bundle, nil
+}
+
+func decodeBundleSpec(spec json.RawMessage, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(spec))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("invalid spec: %s", err)
+	}
+	return nil
+}
+
+// EncodeBundle writes the bundle as YAML documents, definitions by alias then
+// templates by name, so that exports diff well.
+func EncodeBundle(bundle Bundle) ([]byte, error) {
+	definitions := append([]Definition{}, bundle.Definitions...)
+	sort.Slice(definitions, func(i, j int) bool { return definitions[i].Alias < definitions[j].Alias })
+	templates := append([]CreateTemplateRequest{}, bundle.Templates...)
+	sort.Slice(templates, func(i, j int) bool { return templates[i].TemplateName < templates[j].TemplateName })
+
+	var buf bytes.Buffer
+	write := func(kind BundleKind, v interface{}) error {
+		spec, err := BundleSpec(v)
+		if err != nil {
+			return err
+		}
+		out, err := yaml.Marshal(map[string]interface{}{
+			"apiVersion": BundleAPIVersion,
+			"kind":       kind,
+			"spec":       spec,
+		})
+		if err != nil {
+			return err
+		}
+		if buf.Len() > 0 {
+			buf.WriteString("---\n")
+		}
+		buf.Write(out)
+		return nil
+	}
+	for _, d := range definitions {
+		if err := write(BundleKindDefinition, d); err != nil {
+			return nil, err
+		}
+	}
+	for _, t := range templates {
+		if err := write(BundleKindTemplate, t); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// bundleIgnoredFields aren't part of specs: ids are assigned by flotilla, and
+// the ports and tags of definitions are written but never read back.
+var bundleIgnoredFields = []string{"definition_id", "ports", "tags", "allow_incompatible_schema"}
+
+// BundleSpec returns the spec of a definition or a template request, without
+// empty fields.
+func BundleSpec(v interface{}) (map[string]interface{}, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var spec map[string]interface{}
+	if err = json.Unmarshal(raw, &spec); err != nil {
+		return nil, err
+	}
+	for k, value := range spec {
+		if containsString(bundleIgnoredFields, k) || isEmptySpecValue(value) {
+			delete(spec, k)
+		}
+	}
+	return spec, nil
+}
+
+// BundleFieldChanges lists the fields of the specs of current and desired
+// which differ.
+func BundleFieldChanges(current interface{}, desired interface{}) ([]string, error) {
+	currentSpec, err := BundleSpec(current)
+	if err != nil {
+		return nil, err
+	}
+	desiredSpec, err := BundleSpec(desired)
+	if err != nil {
+		return nil, err
+	}
+	var fields []string
+	for k, v := range desiredSpec {
+		if !reflect.DeepEqual(currentSpec[k], v) {
+			fields = append(fields, k)
+		}
+	}
+	for k := range currentSpec {
+		if _, ok := desiredSpec[k]; !ok {
+			fields = append(fields, k)
+		}
+	}
+	sort.Strings(fields)
+	return fields, nil
+}
+
+func isEmptySpecValue(v interface{}) bool {
+	switch value := v.(type) {
+	case nil:
+		return true
+	case string:
+		return len(value) == 0
+	case []interface{}:
+		return len(value) == 0
+	case map[string]interface{}:
+		return len(value) == 0
+	}
+	return false
+}
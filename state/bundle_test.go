@@ -0,0 +1,105 @@
+package state
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseBundle(t *testing.T) {
+	data := `
+# managed in git
+apiVersion: flotilla/v1
+kind: Definition
+spec:
+  alias: hello
+  group_name: team-a
+  image: ubuntu:22.04
+  command: echo hello
+  memory: 512
+---
+apiVersion: flotilla/v1
+kind: Template
+spec:
+  template_name: greeter
+  command_template: echo {{.name}}
+  image: ubuntu:22.04
+  schema:
+    type: object
+    required: [name]
+`
+	bundle, err := ParseBundle([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bundle.Definitions) != 1 || len(bundle.Templates) != 1 {
+		t.Fatalf("expected a definition and a template, got %+v", bundle)
+	}
+	if d := bundle.Definitions[0]; d.Alias != "hello" || d.GroupName != "team-a" || *d.Memory != 512 {
+		t.Errorf("unexpected definition %+v", d)
+	}
+	if tpl := bundle.Templates[0]; tpl.TemplateName != "greeter" || tpl.Schema["type"] != "object" {
+		t.Errorf("unexpected template %+v", tpl)
+	}
+
+	encoded, err := EncodeBundle(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := ParseBundle(encoded)
+	if err != nil {
+		t.Fatalf("expected exports to parse back, got %v:\n%s", err, encoded)
+	}
+	fields, err := BundleFieldChanges(bundle.Definitions[0], decoded.Definitions[0])
+	if err != nil || len(fields) != 0 {
+		t.Errorf("expected the definition to round trip, got changes %v %v", fields, err)
+	}
+	fields, err = BundleFieldChanges(bundle.Templates[0], decoded.Templates[0])
+	if err != nil || len(fields) != 0 {
+		t.Errorf("expected the template to round trip, got changes %v %v", fields, err)
+	}
+}
+
+func TestParseBundle_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"unsupported apiVersion": "apiVersion: flotilla/v2\nkind: Definition\nspec: {alias: a, image: i}",
+		"unsupported kind":       "apiVersion: flotilla/v1\nkind: Worker\nspec: {}",
+		"unknown field":          "apiVersion: flotilla/v1\nkind: Definition\nspec: {alias: a, image: i, memroy: 512}",
+		"must have an [alias]":   "apiVersion: flotilla/v1\nkind: Definition\nspec: {image: i}",
+		"declared twice":         "apiVersion: flotilla/v1\nkind: Template\nspec: {template_name: t}\n---\napiVersion: flotilla/v1\nkind: Template\nspec: {template_name: t}",
+	}
+	for expected, data := range tests {
+		if _, err := ParseBundle([]byte(data)); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected an error about %s, got %v", expected, err)
+		}
+	}
+}
+
+func TestBundleFieldChanges(t *testing.T) {
+	mem, otherMem := int64(512), int64(1024)
+	current := Definition{DefinitionID: "def-1", Alias: "hello", Command: "echo hello", ExecutableResources: ExecutableResources{
+		Image: "ubuntu", Memory: &mem, Tags: &Tags{""}, Env: &EnvList{}}}
+	desired := Definition{Alias: "hello", GroupName: "team-a", ExecutableResources: ExecutableResources{
+		Image: "ubuntu", Memory: &otherMem}}
+
+	fields, err := BundleFieldChanges(current, desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(fields, ",") != "command,group_name,memory" {
+		t.Errorf("expected ids, tags and empty values to be ignored, got %v", fields)
+	}
+}
+
+func TestBundleScope(t *testing.T) {
+	scope := BundleScope{Kinds: []BundleKind{BundleKindDefinition}, GroupNames: []string{"team-a"}}
+	if !scope.IncludesDefinition(Definition{GroupName: "team-a"}) || scope.IncludesDefinition(Definition{GroupName: "team-b"}) {
+		t.Errorf("expected definitions to be scoped by group name")
+	}
+	if scope.IncludesTemplate("greeter") {
+		t.Errorf("expected templates to be out of a definition scope")
+	}
+	scope = BundleScope{TemplatePrefix: "team-a."}
+	if !scope.IncludesTemplate("team-a.greeter") || scope.IncludesTemplate("team-b.greeter") {
+		t.Errorf("expected templates to be scoped by prefix")
+	}
+}
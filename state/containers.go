@@ -0,0 +1,125 @@
+package state
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Container is an extra container of a definition or template's pod. Init
+// containers run to completion, in order, before the main container starts;
+// sidecars run alongside the main container and are stopped once it exits.
+// Only the main container decides the outcome of a run.
+type Container struct {
+	Name    string   `json:"name"`
+	Image   string   `json:"image"`
+	Command []string `json:"command,omitempty"`
+	Args    []string `json:"args,omitempty"`
+	Env     *EnvList `json:"env,omitempty"`
+	// Cpu (millicores) and Memory (MiB) are both requested and used as limits.
+	Cpu          *int64              `json:"cpu,omitempty"`
+	Memory       *int64              `json:"memory,omitempty"`
+	VolumeMounts []SharedVolumeMount `json:"volume_mounts,omitempty"`
+}
+
+// Containers is a list of extra containers.
+type Containers []Container
+
+// SharedVolume is a scratch volume shared by the containers of a run's pod,
+// mounted at MountPath in the main container when set.
+type SharedVolume struct {
+	Name      string `json:"name"`
+	MountPath string `json:"mount_path,omitempty"`
+	// SizeLimit caps the volume, in MiB.
+	SizeLimit *int64 `json:"size_limit,omitempty"`
+}
+
+// SharedVolumes is a list of shared volumes.
+type SharedVolumes []SharedVolume
+
+// SharedVolumeMount mounts a shared volume into an extra container.
+type SharedVolumeMount struct {
+	Name      string `json:"name"`
+	MountPath string `json:"mount_path"`
+	ReadOnly  bool   `json:"read_only,omitempty"`
+}
+
+// ReservedVolumeNames are the names of volumes flotilla adds to pods itself.
+var ReservedVolumeNames = []string{"shared-memory", "dockersock", "flotilla-output"}
+
+var containerNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// ValidateContainers returns the reasons the extra containers and shared
+// volumes of the resources are invalid, if any.
+func (e *ExecutableResources) ValidateContainers() []string {
+	var reasons []string
+	volumes := map[string]bool{}
+	if e.SharedVolumes != nil {
+		for _, v := range *e.SharedVolumes {
+			switch {
+			case !containerNamePattern.MatchString(v.Name) || len(v.Name) > 63:
+				reasons = append(reasons, fmt.Sprintf("shared volume name [%s] must be a lowercase DNS label", v.Name))
+			case volumes[v.Name]:
+				reasons = append(reasons, fmt.Sprintf("shared volume [%s] is declared more than once", v.Name))
+			}
+			for _, reserved := range ReservedVolumeNames {
+				if v.Name == reserved {
+					reasons = append(reasons, fmt.Sprintf("shared volume name [%s] is reserved", v.Name))
+				}
+			}
+			if e.Volumes != nil {
+				for _, volume := range *e.Volumes {
+					if volume.Name == v.Name {
+						reasons = append(reasons, fmt.Sprintf("shared volume [%s] has the name of a volume", v.Name))
+					}
+				}
+			}
+			if len(v.MountPath) > 0 && !strings.HasPrefix(v.MountPath, "/") {
+				reasons = append(reasons, fmt.Sprintf("mount path of shared volume [%s] must be absolute", v.Name))
+			}
+			volumes[v.Name] = true
+		}
+	}
+
+	names := map[string]bool{}
+	for _, list := range []*Containers{e.InitContainers, e.Sidecars} {
+		if list == nil {
+			continue
+		}
+		for _, c := range *list {
+			switch {
+			case !containerNamePattern.MatchString(c.Name) || len(c.Name) > 63:
+				reasons = append(reasons, fmt.Sprintf("container name [%s] must be a lowercase DNS label", c.Name))
+			case names[c.Name]:
+				reasons = append(reasons, fmt.Sprintf("container [%s] is declared more than once", c.Name))
+			}
+			names[c.Name] = true
+			if len(c.Image) == 0 {
+				reasons = append(reasons, fmt.Sprintf("container [%s] must specify an [image]", c.Name))
+			}
+			for _, m := range c.VolumeMounts {
+				if !volumes[m.Name] {
+					reasons = append(reasons, fmt.Sprintf("container [%s] mounts undeclared shared volume [%s]", c.Name, m.Name))
+				}
+				if !strings.HasPrefix(m.MountPath, "/") {
+					reasons = append(reasons, fmt.Sprintf("container [%s] must mount [%s] at an absolute path", c.Name, m.Name))
+				}
+			}
+		}
+	}
+	return reasons
+}
+
+// ContainerImages returns the images of the extra containers.
+func (e *ExecutableResources) ContainerImages() []string {
+	var images []string
+	for _, list := range []*Containers{e.InitContainers, e.Sidecars} {
+		if list == nil {
+			continue
+		}
+		for _, c := range *list {
+			images = append(images, c.Image)
+		}
+	}
+	return images
+}
@@ -0,0 +1,31 @@
+package state
+
+import "testing"
+
+func TestExecutableResources_ValidateContainers(t *testing.T) {
+	valid := ExecutableResources{
+		InitContainers: &Containers{{Name: "fetch", Image: "cli", VolumeMounts: []SharedVolumeMount{{Name: "data", MountPath: "/data"}}}},
+		Sidecars:       &Containers{{Name: "proxy", Image: "envoy"}},
+		SharedVolumes:  &SharedVolumes{{Name: "data", MountPath: "/data"}},
+	}
+	if reasons := valid.ValidateContainers(); len(reasons) != 0 {
+		t.Errorf("expected valid containers, got %v", reasons)
+	}
+	if images := valid.ContainerImages(); len(images) != 2 || images[0] != "cli" || images[1] != "envoy" {
+		t.Errorf("unexpected images %v", images)
+	}
+
+	invalid := ExecutableResources{
+		InitContainers: &Containers{
+			{Name: "Fetch", Image: "cli"},
+			{Name: "copy", VolumeMounts: []SharedVolumeMount{{Name: "missing", MountPath: "relative"}}},
+		},
+		Sidecars:      &Containers{{Name: "copy", Image: "envoy"}},
+		SharedVolumes: &SharedVolumes{{Name: "shared-memory"}},
+	}
+	// Bad name, missing image, undeclared volume, relative path, duplicate
+	// name and reserved volume name.
+	if reasons := invalid.ValidateContainers(); len(reasons) != 6 {
+		t.Errorf("expected 6 reasons, got %v", reasons)
+	}
+}
@@ -0,0 +1,131 @@
+package state
+
+import (
+	"fmt"
+	"time"
+)
+
+// DebugMode is how a debug session reaches the run's environment.
+type DebugMode string
+
+const (
+	// DebugModeTwin launches a twin of the run: same image, env, service
+	// account, resources and node placement, its command replaced by a
+	// sleep.
+	DebugModeTwin DebugMode = "twin"
+	// DebugModeEphemeral adds an ephemeral container to the pod of a running
+	// run, sharing the process namespace of the run's container.
+	DebugModeEphemeral DebugMode = "ephemeral"
+)
+
+// DebugSessionRequest is the body of requests starting a debug session.
+type DebugSessionRequest struct {
+	Mode       DebugMode `json:"mode"`
+	TTLSeconds int64     `json:"ttl_seconds,omitempty"`
+	// Image of ephemeral containers, the run's image by default.
+	Image string `json:"image,omitempty"`
+}
+
+// DebugSession is a shell into the environment of a run. Sessions end at
+// ExpiresAt, when their pod or container stops sleeping, or once terminated;
+// they are kept along with their execs for auditing.
+type DebugSession struct {
+	SessionID    string      `json:"session_id" db:"session_id"`
+	RunID        string      `json:"run_id" db:"run_id"`
+	Mode         DebugMode   `json:"mode" db:"mode"`
+	User         string      `json:"user" db:"user_name"`
+	ClusterName  string      `json:"cluster" db:"cluster_name"`
+	Namespace    string      `json:"namespace" db:"namespace"`
+	JobName      string      `json:"job_name,omitempty" db:"job_name"`
+	PodName      string      `json:"pod_name,omitempty" db:"pod_name"`
+	Container    string      `json:"container" db:"container"`
+	Image        string      `json:"image" db:"image"`
+	CreatedAt    time.Time   `json:"created_at" db:"created_at"`
+	ExpiresAt    time.Time   `json:"expires_at" db:"expires_at"`
+	TerminatedAt *time.Time  `json:"terminated_at,omitempty" db:"terminated_at"`
+	TerminatedBy *string     `json:"terminated_by,omitempty" db:"terminated_by"`
+	Execs        *DebugExecs `json:"execs,omitempty" db:"execs"`
+	ExecURI      string      `json:"exec_uri,omitempty" db:"-"`
+}
+
+// DebugExec is an exec into a debug session, recorded when it starts and
+// updated once it ends.
+type DebugExec struct {
+	ExecID    string     `json:"exec_id"`
+	User      string     `json:"user"`
+	Command   []string   `json:"command"`
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// DebugExecs is the audit trail of a debug session.
+type DebugExecs []DebugExec
+
+// DebugSessionList wraps a list of debug sessions.
+type DebugSessionList struct {
+	Total    int            `json:"total"`
+	Sessions []DebugSession `json:"sessions"`
+}
+
+// Active tells whether the session can still be exec'd into.
+func (s DebugSession) Active(now time.Time) bool {
+	return s.TerminatedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// UpdateWith updates this session with information from another. Execs are
+// appended to the session's audit trail, or replace the exec with their id.
+func (s *DebugSession) UpdateWith(other DebugSession) {
+	if len(other.PodName) > 0 {
+		s.PodName = other.PodName
+	}
+	if other.TerminatedAt != nil {
+		s.TerminatedAt = other.TerminatedAt
+	}
+	if other.TerminatedBy != nil {
+		s.TerminatedBy = other.TerminatedBy
+	}
+	if other.Execs != nil {
+		var execs DebugExecs
+		if s.Execs != nil {
+			execs = append(execs, *s.Execs...)
+		}
+		for _, exec := range *other.Execs {
+			if i := execs.index(exec.ExecID); i >= 0 {
+				execs[i] = exec
+			} else {
+				execs = append(execs, exec)
+			}
+		}
+		s.Execs = &execs
+	}
+}
+
+// index returns the position of the exec with the id in the trail, -1 when
+// there's none.
+func (e DebugExecs) index(execID string) int {
+	if len(execID) == 0 {
+		return -1
+	}
+	for i := range e {
+		if e[i].ExecID == execID {
+			return i
+		}
+	}
+	return -1
+}
+
+// NewDebugExecID returns a new id for an exec into a debug session.
+func NewDebugExecID() (string, error) {
+	return newUUIDv4()
+}
+
+// NewDebugSessionID returns a new debug session id, short enough to name the
+// job of a twin.
+func NewDebugSessionID() (string, error) {
+	s, err := newUUIDv4()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("debug-%s", s[:18]), nil
+}
@@ -0,0 +1,64 @@
+package state
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDebugSession_UpdateWith(t *testing.T) {
+	now := time.Now()
+	s := DebugSession{
+		SessionID: "debug-a",
+		PodName:   "run-a",
+		Execs:     &DebugExecs{{User: "a", Command: []string{"ls"}}},
+	}
+
+	s.UpdateWith(DebugSession{Execs: &DebugExecs{{User: "b", Command: []string{"bash"}}}})
+	if s.PodName != "run-a" {
+		t.Errorf("expected the pod name to be kept, got %s", s.PodName)
+	}
+	if s.Execs == nil || len(*s.Execs) != 2 || (*s.Execs)[1].User != "b" {
+		t.Fatalf("expected the exec to be appended, got %+v", s.Execs)
+	}
+
+	endedAt := now
+	s.UpdateWith(DebugSession{Execs: &DebugExecs{{ExecID: "exec-c", User: "c", Command: []string{"top"}}}})
+	s.UpdateWith(DebugSession{Execs: &DebugExecs{{ExecID: "exec-c", User: "c", Command: []string{"top"}, EndedAt: &endedAt}}})
+	if len(*s.Execs) != 3 || (*s.Execs)[2].EndedAt == nil {
+		t.Fatalf("expected the exec to be ended in place, got %+v", s.Execs)
+	}
+
+	user := "c"
+	s.UpdateWith(DebugSession{PodName: "run-b", TerminatedAt: &now, TerminatedBy: &user})
+	if s.PodName != "run-b" || s.TerminatedAt == nil || *s.TerminatedBy != "c" {
+		t.Errorf("expected the session to be terminated, got %+v", s)
+	}
+	if len(*s.Execs) != 3 {
+		t.Errorf("expected the execs to be kept, got %d", len(*s.Execs))
+	}
+}
+
+func TestDebugSession_Active(t *testing.T) {
+	now := time.Now()
+	s := DebugSession{CreatedAt: now.Add(-time.Minute), ExpiresAt: now.Add(time.Minute)}
+	if !s.Active(now) {
+		t.Errorf("expected the session to be active")
+	}
+	if s.Active(now.Add(2 * time.Minute)) {
+		t.Errorf("expected expired sessions to be inactive")
+	}
+	s.TerminatedAt = &now
+	if s.Active(now) {
+		t.Errorf("expected terminated sessions to be inactive")
+	}
+}
+
+func TestNewDebugSessionID(t *testing.T) {
+	id, err := NewDebugSessionID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(id) != len("debug-")+18 || len(id) > 63 {
+		t.Errorf("unexpected session id %s", id)
+	}
+}
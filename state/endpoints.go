@@ -0,0 +1,38 @@
+package state
+
+import "fmt"
+
+// RunEndpoint is how a port declared by a run's executable can be reached
+// while the run is running.
+type RunEndpoint struct {
+	Port int `json:"port"`
+	// Address of the port inside the cluster, <service>.<namespace>.svc:<port>.
+	Address string `json:"address"`
+	// URL of the port's ingress, when ingresses are configured.
+	URL string `json:"url,omitempty"`
+	// ProxyURI is the path the port is proxied under by the api.
+	ProxyURI string `json:"proxy_uri"`
+}
+
+// RunEndpoints lists the endpoints of a run, one per declared port.
+type RunEndpoints []RunEndpoint
+
+// Find returns the endpoint of the port.
+func (e RunEndpoints) Find(port int) (RunEndpoint, bool) {
+	for _, endpoint := range e {
+		if endpoint.Port == port {
+			return endpoint, true
+		}
+	}
+	return RunEndpoint{}, false
+}
+
+// PortsServiceName is the name of the service exposing the ports of a run.
+func PortsServiceName(runID string) string {
+	return fmt.Sprintf("%s-ports", runID)
+}
+
+// RunProxyURI is the path the api proxies the port of a run under.
+func RunProxyURI(runID string, port int) string {
+	return fmt.Sprintf("/api/v6/%s/proxy/%d/", runID, port)
+}
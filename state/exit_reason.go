@@ -0,0 +1,63 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"unicode/utf8"
+)
+
+// MaxExitReasonLength bounds the exception details appended to an exit reason.
+var MaxExitReasonLength = 512
+
+// ExitReasonFromExceptions categorizes the exceptions of a run into a human readable exit reason.
+func ExitReasonFromExceptions(runExceptions *RunExceptions) string {
+	connectionError := regexp.MustCompile(`(?i).*(timeout|gatewayerror|socketerror|\s503\s|\s502\s|\s500\s|\s504\s|connectionerror).*`)
+	pipError := regexp.MustCompile(`(?i).*(could\snot\sfind\sa\sversion|package\snot\sfound|ModuleNotFoundError|No\smatching\sdistribution\sfound).*`)
+	yumError := regexp.MustCompile(`(?i).*(Nothing\sto\sdo).*`)
+	gitError := regexp.MustCompile(`(?i).*(Could\snot\sread\sfrom\sremote\srepository|correct\saccess\srights|Repository\snot\sfound).*`)
+	argumentError := regexp.MustCompile(`(?i).*(404|400|keyerror|column\smissing|RuntimeError).*`)
+	syntaxError := regexp.MustCompile(`(?i).*(syntaxerror|typeerror|).*`)
+
+	value, _ := json.Marshal(runExceptions)
+	if value != nil {
+		errorMsg := string(value)
+		switch {
+		case connectionError.MatchString(errorMsg):
+			return "Connection error to downstream uri"
+		case pipError.MatchString(errorMsg):
+			return "Python pip package installation error"
+		case yumError.MatchString(errorMsg):
+			return "Yum installation error"
+		case gitError.MatchString(errorMsg):
+			return "Git clone error"
+		case argumentError.MatchString(errorMsg):
+			return "Data or argument error"
+		case syntaxError.MatchString(errorMsg):
+			return "Code or syntax error"
+		default:
+			return "Runtime exception encountered"
+		}
+	}
+	return "Runtime exception encountered"
+}
+
+// ExitReasonFromStructuredExceptions categorizes the exceptions extracted from
+// the logs of a run and appends the last (root) exception to the exit reason.
+func ExitReasonFromStructuredExceptions(structured StructuredExceptions) string {
+	runExceptions := structured.RunExceptions()
+	reason := ExitReasonFromExceptions(&runExceptions)
+	if len(structured) == 0 {
+		return reason
+	}
+	reason = fmt.Sprintf("%s - %s", reason, structured[len(structured)-1].String())
+	if len(reason) > MaxExitReasonLength {
+		// Cut on a rune boundary, the reason must stay valid utf-8.
+		end := MaxExitReasonLength
+		for end > 0 && !utf8.RuneStart(reason[end]) {
+			end = end - 1
+		}
+		reason = reason[:end]
+	}
+	return reason
+}
@@ -0,0 +1,22 @@
+package state
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestExitReasonFromStructuredExceptions(t *testing.T) {
+	reason := ExitReasonFromStructuredExceptions(StructuredExceptions{
+		{Type: "ValueError", Message: strings.Repeat("é", MaxExitReasonLength)},
+	})
+	if !strings.Contains(reason, " - ValueError: é") {
+		t.Errorf("expected the reason to end with the last exception, got %s", reason)
+	}
+	if len(reason) > MaxExitReasonLength {
+		t.Errorf("expected the reason to be at most %d bytes, got %d", MaxExitReasonLength, len(reason))
+	}
+	if !utf8.ValidString(reason) {
+		t.Errorf("expected the reason to be cut on a rune boundary, got %q", reason[len(reason)-4:])
+	}
+}
@@ -0,0 +1,96 @@
+package state
+
+import (
+	"regexp"
+	"strings"
+)
+
+// FailureCategory is the typed cause of a failed run.
+type FailureCategory string
+
+const (
+	FailureCategoryUserError        FailureCategory = "user_error"
+	FailureCategoryOOM              FailureCategory = "oom"
+	FailureCategorySpotInterruption FailureCategory = "spot_interruption"
+	FailureCategoryImagePull        FailureCategory = "image_pull"
+	FailureCategoryTimeout          FailureCategory = "timeout"
+	FailureCategoryScheduling       FailureCategory = "scheduling"
+	FailureCategoryInfra            FailureCategory = "infra"
+	FailureCategoryCancelled        FailureCategory = "cancelled"
+)
+
+// FailureCategories lists every failure category.
+var FailureCategories = []FailureCategory{
+	FailureCategoryUserError,
+	FailureCategoryOOM,
+	FailureCategorySpotInterruption,
+	FailureCategoryImagePull,
+	FailureCategoryTimeout,
+	FailureCategoryScheduling,
+	FailureCategoryInfra,
+	FailureCategoryCancelled,
+}
+
+// IsValidFailureCategory checks that the given string is one of the failure categories.
+func IsValidFailureCategory(category string) bool {
+	for _, c := range FailureCategories {
+		if string(c) == category {
+			return true
+		}
+	}
+	return false
+}
+
+// failureRules are evaluated in order against the exit reason of a stopped
+// run, the first match wins. Cancellation and timeouts go first since the
+// pod is killed and may report any reason. Only rules with exceptions set are
+// also matched against the exceptions found in the logs, eg. a TimeoutError
+// raised by user code is not a run timeout.
+var failureRules = []struct {
+	category   FailureCategory
+	pattern    *regexp.Regexp
+	exceptions bool
+}{
+	{FailureCategoryCancelled, regexp.MustCompile(`(?i)terminated by`), false},
+	{FailureCategoryTimeout, regexp.MustCompile(`(?i)(exceeded specified timeout|DeadlineExceeded)`), false},
+	{FailureCategoryOOM, regexp.MustCompile(`(?i)(OOMKilled|OutOfMemory|out of memory|MemoryError)`), true},
+	{FailureCategorySpotInterruption, regexp.MustCompile(`(?i)(\bspot\b|interruption|node (was )?(terminated|shutdown|deleted)|NodeShutdown)`), false},
+	{FailureCategoryImagePull, regexp.MustCompile(`(?i)(ImagePullBackOff|ErrImagePull|InvalidImageName|image pull|pull image)`), false},
+	{FailureCategoryScheduling, regexp.MustCompile(`(?i)(FailedScheduling|Unschedulable|Insufficient (cpu|memory|nvidia))`), false},
+	{FailureCategoryInfra, regexp.MustCompile(`(?i)(not found on the EKS cluster|Invalid cluster name|Error creating k8s|ContainerCannotRun|CreateContainerError|Evicted|NodeLost)`), false},
+}
+
+// ClassifyFailure returns the failure category of a stopped run, nil for
+// runs which aren't stopped or exited successfully.
+func ClassifyFailure(run Run) *FailureCategory {
+	if run.Status != StatusStopped {
+		return nil
+	}
+	if run.ExitCode != nil && *run.ExitCode == 0 {
+		return nil
+	}
+
+	reason := ""
+	if run.ExitReason != nil {
+		reason = *run.ExitReason
+	}
+	exceptions := ""
+	if run.RunExceptions != nil {
+		exceptions = strings.Join(*run.RunExceptions, "\n")
+	}
+
+	for _, rule := range failureRules {
+		if rule.pattern.MatchString(reason) || (rule.exceptions && rule.pattern.MatchString(exceptions)) {
+			category := rule.category
+			return &category
+		}
+	}
+
+	// The container ran and exited non zero, blame the code. Without an
+	// exit code the container never ran.
+	category := FailureCategoryInfra
+	if run.ExitCode != nil {
+		category = FailureCategoryUserError
+	}
+	return &category
+}
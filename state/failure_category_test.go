@@ -0,0 +1,43 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestClassifyFailure(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     string
+		exitCode   *int64
+		exitReason *string
+		exceptions *RunExceptions
+		expected   *FailureCategory
+	}{
+		{"not stopped", StatusRunning, nil, nil, nil, nil},
+		{"succeeded", StatusStopped, aws.Int64(0), aws.String("Pod flotilla-1 Exited Successfully"), nil, nil},
+		{"cancelled", StatusStopped, aws.Int64(1), aws.String("Task terminated by - someone@example.com"), nil, categoryPtr(FailureCategoryCancelled)},
+		{"timeout", StatusStopped, aws.Int64(1), aws.String("JobRun exceeded specified timeout of 60 seconds"), nil, categoryPtr(FailureCategoryTimeout)},
+		{"oom", StatusStopped, aws.Int64(137), aws.String("OOMKilled"), nil, categoryPtr(FailureCategoryOOM)},
+		{"oom from exceptions", StatusStopped, aws.Int64(1), aws.String("Error"), &RunExceptions{"MemoryError: unable to allocate"}, categoryPtr(FailureCategoryOOM)},
+		{"spot", StatusStopped, aws.Int64(143), aws.String("Spot interruption - node was terminated"), nil, categoryPtr(FailureCategorySpotInterruption)},
+		{"image pull", StatusStopped, nil, aws.String("ErrImagePull"), nil, categoryPtr(FailureCategoryImagePull)},
+		{"not found", StatusStopped, nil, aws.String("Job either timed out or not found on the EKS cluster."), nil, categoryPtr(FailureCategoryInfra)},
+		{"user code", StatusStopped, aws.Int64(1), aws.String("Error"), &RunExceptions{"TimeoutError: timed out"}, categoryPtr(FailureCategoryUserError)},
+		{"never ran", StatusStopped, nil, nil, nil, categoryPtr(FailureCategoryInfra)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ClassifyFailure(Run{Status: tt.status, ExitCode: tt.exitCode, ExitReason: tt.exitReason, RunExceptions: tt.exceptions})
+			if (got == nil) != (tt.expected == nil) || (got != nil && *got != *tt.expected) {
+				t.Errorf("ClassifyFailure() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func categoryPtr(c FailureCategory) *FailureCategory {
+	return &c
+}
@@ -0,0 +1,107 @@
+package state
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// AttemptSpotInterrupted is the outcome of attempts stopped because their
+// spot node was reclaimed.
+const AttemptSpotInterrupted = "spot_interrupted"
+
+// InterruptionTaints are the taints put on nodes about to be reclaimed, by
+// the aws node termination handler on spot interruption notices and by
+// Karpenter when it disrupts a node.
+var InterruptionTaints = []string{
+	"aws-node-termination-handler/spot-itn",
+	"karpenter.sh/disrupted",
+	"karpenter.sh/disruption",
+}
+
+// RunAttempt is a past attempt of a run, recorded when the run is
+// resubmitted.
+type RunAttempt struct {
+	Attempt       int64      `json:"attempt"`
+	Outcome       string     `json:"outcome"`
+	Cluster       string     `json:"cluster,omitempty"`
+	PodName       string     `json:"pod_name,omitempty"`
+	Node          string     `json:"node,omitempty"`
+	NodeLifecycle string     `json:"node_lifecycle,omitempty"`
+	Reason        string     `json:"reason,omitempty"`
+	StartedAt     *time.Time `json:"started_at,omitempty"`
+	EndedAt       time.Time  `json:"ended_at"`
+}
+
+// RunAttempts is the attempt history of a run, oldest first.
+type RunAttempts []RunAttempt
+
+// Count returns the number of attempts with the outcome.
+func (as *RunAttempts) Count(outcome string) int {
+	if as == nil {
+		return 0
+	}
+	count := 0
+	for _, a := range *as {
+		if a.Outcome == outcome {
+			count++
+		}
+	}
+	return count
+}
+
+// InterruptionTaint returns the interruption taint of the node, if any, when
+// the node is a spot node. capacityTypeKey is the node label holding the
+// node's lifecycle; nodes tainted by spot interruption notices are spot nodes
+// whatever their labels.
+func InterruptionTaint(node corev1.Node, taints []string, capacityTypeKey string) (string, bool) {
+	spot := strings.Contains(strings.ToLower(node.Labels[capacityTypeKey]), SpotLifecycle)
+	for _, taint := range node.Spec.Taints {
+		for _, key := range taints {
+			if taint.Key != key {
+				continue
+			}
+			if spot || strings.HasSuffix(key, "spot-itn") {
+				return taint.Key, true
+			}
+		}
+	}
+	return "", false
+}
+
+// SpotInterruptionUpdate returns the update recording the interrupted
+// attempt of a running run and sending it back for retry, on an on-demand
+// node when onDemand is set.
+func SpotInterruptionUpdate(run Run, node string, taint string, onDemand bool, now time.Time) Run {
+	var attempts RunAttempts
+	if run.Attempts != nil {
+		attempts = append(attempts, *run.Attempts...)
+	}
+	attempt := RunAttempt{
+		Attempt:   int64(len(attempts) + 1),
+		Outcome:   AttemptSpotInterrupted,
+		Node:      node,
+		Reason:    fmt.Sprintf("node [%s] was tainted with [%s]", node, taint),
+		StartedAt: run.StartedAt,
+		EndedAt:   now,
+	}
+	if run.PodName != nil {
+		attempt.PodName = *run.PodName
+	}
+	if run.NodeLifecycle != nil {
+		attempt.NodeLifecycle = *run.NodeLifecycle
+	}
+	attempts = append(attempts, attempt)
+
+	update := Run{
+		Status:   StatusNeedsRetry,
+		QueuedAt: &now,
+		Attempts: &attempts,
+	}
+	if onDemand {
+		update.NodeLifecycle = &OndemandLifecycle
+	}
+	return update
+}
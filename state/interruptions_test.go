@@ -0,0 +1,69 @@
+package state
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestInterruptionTaint(t *testing.T) {
+	node := func(capacityType string, taint string) corev1.Node {
+		n := corev1.Node{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"karpenter.sh/capacity-type": capacityType}}}
+		if taint != "" {
+			n.Spec.Taints = []corev1.Taint{{Key: taint, Effect: corev1.TaintEffectNoSchedule}}
+		}
+		return n
+	}
+	key := "karpenter.sh/capacity-type"
+
+	if taint, ok := InterruptionTaint(node("spot", "karpenter.sh/disrupted"), InterruptionTaints, key); !ok || taint != "karpenter.sh/disrupted" {
+		t.Errorf("expected a disrupted spot node to be interrupted, got %q %v", taint, ok)
+	}
+	if _, ok := InterruptionTaint(node("on-demand", "karpenter.sh/disrupted"), InterruptionTaints, key); ok {
+		t.Errorf("expected disrupted on-demand nodes to be ignored")
+	}
+	if _, ok := InterruptionTaint(node("", "aws-node-termination-handler/spot-itn"), InterruptionTaints, key); !ok {
+		t.Errorf("expected spot interruption notices to interrupt unlabelled nodes")
+	}
+	if _, ok := InterruptionTaint(node("spot", "dedicated"), InterruptionTaints, key); ok {
+		t.Errorf("expected other taints to be ignored")
+	}
+}
+
+func TestSpotInterruptionUpdate(t *testing.T) {
+	podName := "run-abc"
+	startedAt := time.Now().Add(-time.Hour)
+	run := Run{
+		RunID:         "run",
+		Status:        StatusRunning,
+		PodName:       &podName,
+		NodeLifecycle: &SpotLifecycle,
+		StartedAt:     &startedAt,
+		Attempts:      &RunAttempts{{Attempt: 1, Outcome: AttemptSpotInterrupted}},
+	}
+	now := time.Now()
+
+	update := SpotInterruptionUpdate(run, "ip-10-0-0-1", "karpenter.sh/disrupted", true, now)
+	if update.Status != StatusNeedsRetry || update.QueuedAt == nil || !update.QueuedAt.Equal(now) {
+		t.Errorf("expected the run to be requeued for retry, got %s %v", update.Status, update.QueuedAt)
+	}
+	if update.NodeLifecycle == nil || *update.NodeLifecycle != OndemandLifecycle {
+		t.Errorf("expected the run to be resubmitted on-demand")
+	}
+	if update.Attempts.Count(AttemptSpotInterrupted) != 2 {
+		t.Fatalf("expected the interrupted attempt to be appended, got %+v", update.Attempts)
+	}
+	attempt := (*update.Attempts)[1]
+	if attempt.Attempt != 2 || attempt.PodName != podName || attempt.Node != "ip-10-0-0-1" || attempt.NodeLifecycle != SpotLifecycle {
+		t.Errorf("unexpected attempt %+v", attempt)
+	}
+	if len(*run.Attempts) != 1 {
+		t.Errorf("expected the run's own attempts to be left alone")
+	}
+
+	if update := SpotInterruptionUpdate(run, "ip-10-0-0-1", "karpenter.sh/disrupted", false, now); update.NodeLifecycle != nil {
+		t.Errorf("expected the node lifecycle to be kept")
+	}
+}
@@ -2,6 +2,8 @@ package state
 
 import (
 	"context"
+	"time"
+
 	"github.com/pkg/errors"
 	"github.com/stitchfix/flotilla-os/config"
 	"github.com/stitchfix/flotilla-os/log"
@@ -32,6 +34,7 @@ type Manager interface {
 
 	GetRun(ctx context.Context, runID string) (Run, error)
 	CreateRun(ctx context.Context, r Run) error
+	CreateRuns(ctx context.Context, runs []Run) error
 	UpdateRun(ctx context.Context, runID string, updates Run) (Run, error)
 
 	ListGroups(ctx context.Context, limit int, offset int, name *string) (GroupsList, error)
@@ -41,6 +44,12 @@ type Manager interface {
 	BatchUpdateWorkers(ctx context.Context, updates []Worker) (WorkersList, error)
 	GetWorker(ctx context.Context, workerType string, engine string) (Worker, error)
 	UpdateWorker(ctx context.Context, workerType string, updates Worker) (Worker, error)
+	HeartbeatWorkerInstance(ctx context.Context, instance WorkerInstance) error
+	ListWorkerInstances(ctx context.Context, ttl time.Duration) ([]WorkerInstance, error)
+	DeleteWorkerInstance(ctx context.Context, instanceID string) error
+	AcquireWorkerLease(ctx context.Context, name string, holder string, ttl time.Duration) (WorkerLease, error)
+	GetWorkerLease(ctx context.Context, name string) (WorkerLease, error)
+	ReleaseWorkerLease(ctx context.Context, name string, holder string) error
 
 	GetExecutableByTypeAndID(ctx context.Context, executableType ExecutableType, executableID string) (Executable, error)
 
@@ -50,9 +59,22 @@ type Manager interface {
 	ListTemplates(ctx context.Context, limit int, offset int, sortBy string, order string) (TemplateList, error)
 	ListTemplatesLatestOnly(ctx context.Context, limit int, offset int, sortBy string, order string) (TemplateList, error)
 	CreateTemplate(ctx context.Context, t Template) error
+	UpdateTemplateDeprecation(ctx context.Context, templateID string, deprecation *TemplateDeprecation) (Template, error)
+	ListTemplateChannels(ctx context.Context, templateName string) (TemplateChannelList, error)
+	GetTemplateChannel(ctx context.Context, templateName string, channel string) (bool, TemplateChannel, error)
+	SetTemplateChannel(ctx context.Context, c TemplateChannel) (TemplateChannel, error)
+	DeleteTemplateChannel(ctx context.Context, templateName string, channel string) error
+	GetTemplateUsage(ctx context.Context, templateName string, since time.Time) ([]TemplateVersionUsage, error)
+	ApplyBundle(ctx context.Context, changes BundleChanges) error
+	ListSettings(ctx context.Context) ([]Setting, error)
+	SetSetting(ctx context.Context, s Setting, reason string) (Setting, error)
+	DeleteSetting(ctx context.Context, key string, user string, reason string) error
+	ListSettingChanges(ctx context.Context, key string, limit int, offset int) (SettingChangeList, error)
 
 	ListFailingNodes(ctx context.Context) (NodeList, error)
 	GetPodReAttemptRate(ctx context.Context) (float32, error)
+	CountActiveRuns(ctx context.Context) ([]RunStatusCount, error)
+	GetRunLatencyStats(ctx context.Context, q RunLatencyQuery) ([]RunLatencyStats, error)
 	GetNodeLifecycle(ctx context.Context, executableID string, commandHash string) (string, error)
 	GetTaskHistoricalRuntime(ctx context.Context, executableID string, runId string) (float32, error)
 	CheckIdempotenceKey(ctx context.Context, idempotenceKey string) (string, error)
@@ -64,6 +86,11 @@ type Manager interface {
 	DeleteClusterMetadata(ctx context.Context, clusterID string) error
 	GetClusterByID(ctx context.Context, clusterID string) (ClusterMetadata, error)
 	GetRunStatus(ctx context.Context, runID string) (RunStatus, error)
+
+	CreateDebugSession(ctx context.Context, s DebugSession) error
+	GetDebugSession(ctx context.Context, sessionID string) (DebugSession, error)
+	ListDebugSessions(ctx context.Context, runID string) (DebugSessionList, error)
+	UpdateDebugSession(ctx context.Context, sessionID string, updates DebugSession) (DebugSession, error)
 }
 
 // NewStateManager sets up and configures a new statemanager
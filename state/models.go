@@ -14,11 +14,9 @@ import (
 	"text/template"
 	"time"
 
-	"github.com/Masterminds/sprig"
 	"github.com/aws/aws-sdk-go/aws"
 	uuid "github.com/nu7hatch/gouuid"
 	"github.com/pkg/errors"
-	"github.com/xeipuuv/gojsonschema"
 )
 
 var EKSEngine = "eks"
@@ -75,6 +73,10 @@ var StatusPending = "PENDING"
 // StatusStopped means the run is finished
 var StatusStopped = "STOPPED"
 
+// StatusHeld indicates the run is waiting for its array run's parallelism
+// limit before being queued
+var StatusHeld = "HELD"
+
 var MaxLogLines = int64(256)
 
 var EKSBackoffLimit = int32(0)
@@ -82,9 +84,13 @@ var EKSBackoffLimit = int32(0)
 var GPUNodeTypes = []string{"p3.2xlarge", "p3.8xlarge", "p3.16xlarge", "g5.xlarge", "g5.2xlarge", "g5.4xlarge", "g5.8xlarge", "g5.12xlarge", "g5.16xlarge", "g5.24xlarge", "g5.48xlarge"}
 
 var WorkerTypes = map[string]bool{
-	"retry":  true,
-	"submit": true,
-	"status": true,
+	"retry":        true,
+	"submit":       true,
+	"status":       true,
+	"array":        true,
+	"interruption": true,
+	"metrics":      true,
+	"analytics":    true,
 }
 
 func IsValidWorkerType(workerType string) bool {
@@ -98,7 +104,8 @@ func IsValidStatus(status string) bool {
 		status == StatusQueued ||
 		status == StatusNeedsRetry ||
 		status == StatusPending ||
-		status == StatusStopped
+		status == StatusStopped ||
+		status == StatusHeld
 }
 
 // NewRunID returns a new uuid for a Run
@@ -143,6 +150,14 @@ type EnvVar struct {
 
 type NodeList []string
 
+// RunStatusCount is the number of runs of a cluster and engine in a status
+type RunStatusCount struct {
+	ClusterName string `json:"cluster" db:"cluster_name"`
+	Engine      string `json:"engine" db:"engine"`
+	Status      string `json:"status" db:"status"`
+	Runs        int64  `json:"runs" db:"runs"`
+}
+
 // Tags wraps a list of strings
 //   - abstraction to make it easier to read
 //     and write to db
@@ -151,15 +166,19 @@ type Tags []string
 // ExecutableResources define the resources and flags required to run an
 // executable.
 type ExecutableResources struct {
-	Image                      string     `json:"image"`
-	Memory                     *int64     `json:"memory,omitempty"`
-	Gpu                        *int64     `json:"gpu,omitempty"`
-	Cpu                        *int64     `json:"cpu,omitempty"`
-	EphemeralStorage           *int64     `json:"ephemeral_storage,omitempty" db:"ephemeral_storage"`
-	Env                        *EnvList   `json:"env"`
-	AdaptiveResourceAllocation *bool      `json:"adaptive_resource_allocation,omitempty"`
-	Ports                      *PortsList `json:"ports,omitempty"`
-	Tags                       *Tags      `json:"tags,omitempty"`
+	Image                      string         `json:"image"`
+	Memory                     *int64         `json:"memory,omitempty"`
+	Gpu                        *int64         `json:"gpu,omitempty"`
+	Cpu                        *int64         `json:"cpu,omitempty"`
+	EphemeralStorage           *int64         `json:"ephemeral_storage,omitempty" db:"ephemeral_storage"`
+	Env                        *EnvList       `json:"env"`
+	AdaptiveResourceAllocation *bool          `json:"adaptive_resource_allocation,omitempty"`
+	Ports                      *PortsList     `json:"ports,omitempty"`
+	Tags                       *Tags          `json:"tags,omitempty"`
+	InitContainers             *Containers    `json:"init_containers,omitempty"`
+	Sidecars                   *Containers    `json:"sidecars,omitempty"`
+	SharedVolumes              *SharedVolumes `json:"shared_volumes,omitempty"`
+	Volumes                    *Volumes       `json:"volumes,omitempty"`
 }
 
 type ExecutableType string
@@ -248,6 +267,8 @@ type ExecutionRequestCommon struct {
 	Arch                  *string         `json:"arch,omitempty"`
 	Labels                *Labels         `json:"labels,omitempty"`
 	ServiceAccount        *string         `json:"service_account,omitempty"`
+	Replicas              *int64          `json:"replicas,omitempty"`
+	Volumes               *Volumes        `json:"volumes,omitempty"`
 }
 
 type ExecutionRequestCustom map[string]interface{}
@@ -273,6 +294,7 @@ func (d *DefinitionExecutionRequest) GetExecutionRequestCustom() *ExecutionReque
 type TerminateJob struct {
 	RunID    string
 	UserInfo UserInfo
+	Request  StopRequest
 }
 
 // task definition. It implements the `Executable` interface.
@@ -348,6 +370,16 @@ func (d *Definition) IsValid() (bool, []string) {
 			reasons = append(reasons, cond.reason)
 		}
 	}
+	if containerReasons := d.ValidateContainers(); len(containerReasons) > 0 {
+		valid = false
+		reasons = append(reasons, containerReasons...)
+	}
+	if d.Volumes != nil {
+		if volumeReasons := d.Volumes.Validate(); len(volumeReasons) > 0 {
+			valid = false
+			reasons = append(reasons, volumeReasons...)
+		}
+	}
 	return valid, reasons
 }
 
@@ -395,6 +427,18 @@ func (d *Definition) UpdateWith(other Definition) {
 	if other.Tags != nil {
 		d.Tags = other.Tags
 	}
+	if other.InitContainers != nil {
+		d.InitContainers = other.InitContainers
+	}
+	if other.Sidecars != nil {
+		d.Sidecars = other.Sidecars
+	}
+	if other.SharedVolumes != nil {
+		d.SharedVolumes = other.SharedVolumes
+	}
+	if other.Volumes != nil {
+		d.Volumes = other.Volumes
+	}
 }
 
 func (d Definition) MarshalJSON() ([]byte, error) {
@@ -495,6 +539,26 @@ type Run struct {
 	RequiresDocker          bool                     `json:"requires_docker,omitempty" db:"requires_docker"`
 	ServiceAccount          *string                  `json:"service_account,omitempty" db:"service_account"`
 	Tier                    Tier                     `json:"tier,omitempty"`
+	StructuredExceptions    *StructuredExceptions    `json:"structured_exceptions,omitempty"`
+	FailureCategory         *FailureCategory         `json:"failure_category,omitempty"`
+	ImageDigest             *string                  `json:"image_digest,omitempty"`
+	ArrayParentID           *string                  `json:"array_parent_id,omitempty"`
+	ArrayIndex              *int64                   `json:"array_index,omitempty"`
+	Array                   *ArrayStatus             `json:"array,omitempty"`
+	Replicas                *int64                   `json:"replicas,omitempty"`
+	ReplicaPods             *ReplicaPods             `json:"replica_pods,omitempty"`
+	Volumes                 *Volumes                 `json:"volumes,omitempty"`
+	Artifacts               *ArtifactManifest        `json:"artifacts,omitempty"`
+	Result                  *RunResult               `json:"result,omitempty"`
+	Attempts                *RunAttempts             `json:"attempts,omitempty"`
+	Endpoints               *RunEndpoints            `json:"endpoints,omitempty"`
+	Stop                    *RunStop                 `json:"stop,omitempty"`
+	// Diagnosis explains why a queued or pending run isn't running yet; it's
+	// only returned when getting the run.
+	Diagnosis *RunDiagnosis `json:"diagnosis,omitempty" db:"-"`
+	// Warnings about the run's creation, eg. its template version being
+	// deprecated; they're only returned by the request creating the run.
+	Warnings []string `json:"warnings,omitempty" db:"-"`
 }
 
 // UpdateWith updates this run with information from another
@@ -612,6 +676,50 @@ func (d *Run) UpdateWith(other Run) {
 		d.RunExceptions = other.RunExceptions
 	}
 
+	if other.StructuredExceptions != nil {
+		d.StructuredExceptions = other.StructuredExceptions
+	}
+
+	if other.FailureCategory != nil {
+		d.FailureCategory = other.FailureCategory
+	}
+	if other.ImageDigest != nil {
+		d.ImageDigest = other.ImageDigest
+	}
+	if other.ArrayParentID != nil {
+		d.ArrayParentID = other.ArrayParentID
+	}
+	if other.ArrayIndex != nil {
+		d.ArrayIndex = other.ArrayIndex
+	}
+	if other.Array != nil {
+		d.Array = other.Array
+	}
+	if other.Replicas != nil {
+		d.Replicas = other.Replicas
+	}
+	if other.ReplicaPods != nil {
+		d.ReplicaPods = other.ReplicaPods
+	}
+	if other.Volumes != nil {
+		d.Volumes = other.Volumes
+	}
+	if other.Artifacts != nil {
+		d.Artifacts = other.Artifacts
+	}
+	if other.Result != nil {
+		d.Result = other.Result
+	}
+	if other.Attempts != nil {
+		d.Attempts = other.Attempts
+	}
+	if other.Endpoints != nil {
+		d.Endpoints = other.Endpoints
+	}
+	if other.Stop != nil {
+		d.Stop = other.Stop
+	}
+
 	if other.ExecutableID != nil {
 		d.ExecutableID = other.ExecutableID
 	}
@@ -669,8 +777,10 @@ func (d *Run) UpdateWith(other Run) {
 	// QUEUED --> PENDING --> RUNNING --> STOPPED
 	// QUEUED --> PENDING --> NEEDS_RETRY --> QUEUED ...
 	// QUEUED --> PENDING --> STOPPED ...
+	// HELD --> QUEUED ...
 	//
 	statusPrecedence := map[string]int{
+		StatusHeld:       -1,
 		StatusNeedsRetry: -1,
 		StatusQueued:     0,
 		StatusPending:    1,
@@ -691,6 +801,22 @@ func (d *Run) UpdateWith(other Run) {
 	}
 }
 
+// PinnedImage returns the image of the run pinned to the digest it was
+// resolved to at creation, or the image as is when it wasn't resolved.
+func (d Run) PinnedImage() string {
+	if d.ImageDigest == nil || len(*d.ImageDigest) == 0 {
+		return d.Image
+	}
+	name := d.Image
+	if i := strings.Index(name, "@"); i >= 0 {
+		name = name[:i]
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name = name[:i]
+	}
+	return fmt.Sprintf("%s@%s", name, *d.ImageDigest)
+}
+
 func removeDuplicateStr(strSlice []string) []string {
 	allKeys := make(map[string]bool)
 	var list []string
@@ -833,6 +959,33 @@ type SpawnedRuns []SpawnedRun
 
 type RunExceptions []string
 
+// RunException is a single exception extracted from the logs of a run.
+type RunException struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+	Frame   string `json:"frame,omitempty"`
+	Line    int64  `json:"line"`
+	Parser  string `json:"parser"`
+}
+
+func (e RunException) String() string {
+	if len(e.Message) == 0 {
+		return e.Type
+	}
+	return fmt.Sprintf("%s: %s", e.Type, e.Message)
+}
+
+type StructuredExceptions []RunException
+
+// RunExceptions flattens structured exceptions to their string form.
+func (e StructuredExceptions) RunExceptions() RunExceptions {
+	res := RunExceptions{}
+	for _, ex := range e {
+		res = append(res, ex.String())
+	}
+	return res
+}
+
 func (w *PodEvent) Equal(other PodEvent) bool {
 	return w.Reason == other.Reason &&
 		other.Timestamp != nil &&
@@ -867,6 +1020,7 @@ type Worker struct {
 	WorkerType       string `json:"worker_type"`
 	CountPerInstance int    `json:"count_per_instance"`
 	Engine           string `json:"engine"`
+	Scope            string `json:"scope"`
 }
 
 // UpdateWith updates this definition with information from another
@@ -874,6 +1028,9 @@ func (w *Worker) UpdateWith(other Worker) {
 	if other.CountPerInstance >= 0 {
 		w.CountPerInstance = other.CountPerInstance
 	}
+	if len(other.Scope) > 0 {
+		w.Scope = other.Scope
+	}
 }
 
 // WorkersList wraps a list of Workers
@@ -943,6 +1100,13 @@ type TemplateExecutionRequest struct {
 	DryRun          bool            `json:"dry_run,omitempty"`
 }
 
+// TemplateArrayExecutionRequest is a TemplateExecutionRequest creating an
+// array run of a template, with a child run per parameter set of the array.
+type TemplateArrayExecutionRequest struct {
+	TemplateExecutionRequest
+	Array ArraySpec `json:"array"`
+}
+
 // Returns ExecutionRequestCommon associated with a Template type.
 func (t TemplateExecutionRequest) GetExecutionRequestCommon() *ExecutionRequestCommon {
 	return t.ExecutionRequestCommon
@@ -968,6 +1132,7 @@ type Template struct {
 	Defaults        TemplatePayload    `json:"defaults"`
 	AvatarURI       string             `json:"avatar_uri"`
 	ExecutableResources
+	Deprecation *TemplateDeprecation `json:"deprecation,omitempty"`
 }
 
 type CreateTemplateRequest struct {
@@ -977,11 +1142,16 @@ type CreateTemplateRequest struct {
 	Defaults        TemplatePayload    `json:"defaults"`
 	AvatarURI       string             `json:"avatar_uri"`
 	ExecutableResources
+	// AllowIncompatibleSchema creates the new version even when its schema
+	// rejects payloads the previous version accepted.
+	AllowIncompatibleSchema bool `json:"allow_incompatible_schema,omitempty"`
 }
 
 type CreateTemplateResponse struct {
 	DidCreate bool     `json:"did_create"`
 	Template  Template `json:"template,omitempty"`
+	// Incompatibilities of the new version's schema, allowed by the request.
+	Incompatibilities []string `json:"incompatibilities,omitempty"`
 }
 
 // Returns Template ID
@@ -1002,10 +1172,7 @@ func (t Template) GetExecutableResources() *ExecutableResources {
 
 // Renders the command to be rendered for that Template.
 func (t Template) GetExecutableCommand(req ExecutionRequest) (string, error) {
-	var (
-		err    error
-		result bytes.Buffer
-	)
+	var err error
 
 	// Get the request's custom fields.
 	customFields := *req.GetExecutionRequestCustom()
@@ -1013,38 +1180,13 @@ func (t Template) GetExecutableCommand(req ExecutionRequest) (string, error) {
 	if !ok || executionPayload == nil {
 		return "", err
 	}
-
-	executionPayload, err = t.compositeUserAndDefaults(executionPayload)
-
-	schemaLoader := gojsonschema.NewGoLoader(t.Schema)
-	documentLoader := gojsonschema.NewGoLoader(executionPayload)
-
-	// Perform JSON schema validation to ensure that the request's template
-	// payload conforms to the template's JSON schema.
-	validationResult, err := gojsonschema.Validate(schemaLoader, documentLoader)
-	if err != nil {
-		return "", err
-	}
-	if validationResult != nil && validationResult.Valid() != true {
-		var res []string
-		for _, resultError := range validationResult.Errors() {
-			res = append(res, resultError.String())
-		}
-		return "", errors.New(strings.Join(res, "\n"))
-	}
-
-	// Create a new template string based on the template.Template.
-	textTemplate, err := template.New("command").Funcs(sprig.TxtFuncMap()).Parse(t.CommandTemplate)
-	if err != nil {
-		return "", err
-	}
-
-	// Dump payload into the template string.
-	if err = textTemplate.Execute(&result, executionPayload); err != nil {
-		return "", err
+	payload, ok := executionPayload.(TemplatePayload)
+	if !ok {
+		return "", errors.New("unable to cast request payload to TemplatePayload struct")
 	}
 
-	return result.String(), nil
+	command, _, err := t.RenderCommand(payload)
+	return command, err
 }
 
 // Returns the Template Id.
@@ -1099,6 +1241,16 @@ func (t *Template) IsValid() (bool, []string) {
 			reasons = append(reasons, cond.reason)
 		}
 	}
+	if containerReasons := t.ValidateContainers(); len(containerReasons) > 0 {
+		valid = false
+		reasons = append(reasons, containerReasons...)
+	}
+	if t.Volumes != nil {
+		if volumeReasons := t.Volumes.Validate(); len(volumeReasons) > 0 {
+			valid = false
+			reasons = append(reasons, volumeReasons...)
+		}
+	}
 	return valid, reasons
 }
 
@@ -1239,6 +1391,16 @@ type LaunchRequestV2 struct {
 	Arch                  *string         `json:"arch,omitempty"`
 	Labels                *Labels         `json:"labels,omitempty"`
 	ServiceAccount        *string         `json:"service_account,omitempty"`
+	Replicas              *int64          `json:"replicas,omitempty"`
+	Volumes               *Volumes        `json:"volumes,omitempty"`
+	DryRun                bool            `json:"dry_run,omitempty"`
+}
+
+// ArrayLaunchRequest is a LaunchRequestV2 creating an array run of a
+// definition, with a child run per parameter set of the array.
+type ArrayLaunchRequest struct {
+	LaunchRequestV2
+	Array ArraySpec `json:"array"`
 }
 
 // RunTags represents which user is responsible for a task run
@@ -1273,19 +1435,21 @@ const (
 )
 
 type ClusterMetadata struct {
-	ID                string        `json:"id" db:"id"`
-	Name              string        `json:"name" db:"name"`
-	ClusterVersion    string        `json:"cluster_version" db:"cluster_version"`
-	Status            ClusterStatus `json:"status" db:"status"`
-	StatusReason      string        `json:"status_reason" db:"status_reason"`
-	StatusSince       time.Time     `json:"status_since" db:"status_since"`
-	AllowedTiers      Tiers         `json:"allowed_tiers" db:"allowed_tiers"`
-	Capabilities      Capabilities  `json:"capabilities" db:"capabilities"`
-	UpdatedAt         time.Time     `json:"updated_at" db:"updated_at"`
-	Namespace         string        `json:"namespace" db:"namespace"`
-	Region            string        `json:"region" db:"region"`
-	EMRVirtualCluster string        `json:"emr_virtual_cluster" db:"emr_virtual_cluster"`
-	SparkServerURI    string        `json:"spark_server_uri" db:"spark_server_uri"`
+	ID                string            `json:"id" db:"id"`
+	Name              string            `json:"name" db:"name"`
+	ClusterVersion    string            `json:"cluster_version" db:"cluster_version"`
+	Status            ClusterStatus     `json:"status" db:"status"`
+	StatusReason      string            `json:"status_reason" db:"status_reason"`
+	StatusSince       time.Time         `json:"status_since" db:"status_since"`
+	AllowedTiers      Tiers             `json:"allowed_tiers" db:"allowed_tiers"`
+	Capabilities      Capabilities      `json:"capabilities" db:"capabilities"`
+	UpdatedAt         time.Time         `json:"updated_at" db:"updated_at"`
+	Namespace         string            `json:"namespace" db:"namespace"`
+	Region            string            `json:"region" db:"region"`
+	EMRVirtualCluster string            `json:"emr_virtual_cluster" db:"emr_virtual_cluster"`
+	SparkServerURI    string            `json:"spark_server_uri" db:"spark_server_uri"`
+	SchedulingPolicy  *SchedulingPolicy `json:"scheduling_policy,omitempty" db:"scheduling_policy"`
+	VolumePolicy      *VolumePolicy     `json:"volume_policy,omitempty" db:"volume_policy"`
 }
 
 // MergeMaps takes a pointer to a map (first arg) and map containing default
@@ -17,7 +17,11 @@ select td.definition_id                    as definitionid,
        coalesce(td.requires_docker, false) as requires_docker,
        coalesce(td.target_cluster, '')     as target_cluster,
        array_to_json('{""}'::TEXT[])::TEXT as tags,
-       array_to_json('{}'::INT[])::TEXT    as ports
+       array_to_json('{}'::INT[])::TEXT    as ports,
+       td.init_containers::TEXT            as initcontainers,
+       td.sidecars::TEXT                   as sidecars,
+       td.shared_volumes::TEXT             as sharedvolumes,
+       td.volumes::TEXT                    as volumes
 from (select * from task_def) td
 `
 
@@ -40,7 +44,9 @@ SELECT
 	updated_at,
 	namespace,
 	emr_virtual_cluster,
-	spark_server_uri
+	spark_server_uri,
+	scheduling_policy::TEXT as scheduling_policy,
+	volume_policy::TEXT as volume_policy
 FROM cluster_state
 ORDER BY name ASC`
 )
@@ -170,6 +176,76 @@ FROM (
             node_lifecycle = 'spot') A
 `
 
+// CountActiveRunsSQL counts the runs which aren't finished by cluster,
+// engine and status
+const CountActiveRunsSQL = `
+SELECT coalesce(cluster_name, '') as cluster_name, coalesce(engine, '') as engine, status, count(*) as runs
+FROM task
+WHERE status IN ('QUEUED', 'PENDING', 'RUNNING', 'NEEDS_RETRY', 'HELD')
+GROUP BY 1, 2, 3
+`
+
+// SetRunPendingAtSQL records when the run last became pending
+const SetRunPendingAtSQL = `UPDATE task SET pending_at = now() WHERE run_id = $1`
+
+// SetRunRunningAtSQL records when the run last became running, started_at
+// being set before the pod of EKS runs is running
+const SetRunRunningAtSQL = `UPDATE task SET running_at = now() WHERE run_id = $1`
+
+// runDimensionColumns are the columns of the run latency dimensions, the team
+// being the run label named by the parameter formatted in
+var runDimensionColumns = map[RunDimension]string{
+	RunDimensionCluster:    "coalesce(cluster_name, '')",
+	RunDimensionTier:       "coalesce(tier, '')",
+	RunDimensionTeam:       "coalesce(labels->>$%d, '')",
+	RunDimensionDefinition: "coalesce(executable_id, definition_id, '')",
+	RunDimensionEngine:     "coalesce(engine, '')",
+}
+
+// RunLatencySQL computes the latency percentiles, in seconds, of the runs
+// queued in [$1, $2), formatted with the bucket and dimension expressions.
+// Resubmits queue runs again, the times before queued_at are the ones of
+// their previous attempts and are left out.
+const RunLatencySQL = `
+WITH attempts AS (
+	SELECT
+		*,
+		CASE WHEN pending_at >= queued_at THEN pending_at END AS attempt_pending_at,
+		CASE WHEN running_at >= queued_at THEN running_at END AS attempt_running_at,
+		CASE WHEN started_at >= queued_at THEN started_at END AS attempt_started_at
+	FROM task
+	WHERE queued_at >= $1 AND queued_at < $2
+), runs AS (
+	SELECT
+		%s AS bucket,
+		%s AS value,
+		attempt_started_at AS started_at,
+		finished_at,
+		EXTRACT(epoch FROM coalesce(attempt_pending_at, attempt_running_at, attempt_started_at) - queued_at) AS queue_wait,
+		EXTRACT(epoch FROM attempt_running_at - attempt_pending_at) AS pending,
+		EXTRACT(epoch FROM finished_at - coalesce(attempt_running_at, attempt_started_at)) AS runtime
+	FROM attempts
+)
+SELECT
+	bucket,
+	value,
+	count(*) AS runs,
+	count(started_at) AS started,
+	count(finished_at) FILTER (WHERE started_at IS NOT NULL) AS finished,
+	percentile_cont(0.5) WITHIN GROUP (ORDER BY queue_wait) AS queue_wait_p50,
+	percentile_cont(0.9) WITHIN GROUP (ORDER BY queue_wait) AS queue_wait_p90,
+	percentile_cont(0.99) WITHIN GROUP (ORDER BY queue_wait) AS queue_wait_p99,
+	percentile_cont(0.5) WITHIN GROUP (ORDER BY pending) AS pending_p50,
+	percentile_cont(0.9) WITHIN GROUP (ORDER BY pending) AS pending_p90,
+	percentile_cont(0.99) WITHIN GROUP (ORDER BY pending) AS pending_p99,
+	percentile_cont(0.5) WITHIN GROUP (ORDER BY runtime) AS runtime_p50,
+	percentile_cont(0.9) WITHIN GROUP (ORDER BY runtime) AS runtime_p90,
+	percentile_cont(0.99) WITHIN GROUP (ORDER BY runtime) AS runtime_p99
+FROM runs
+GROUP BY bucket, value
+ORDER BY bucket, value
+`
+
 // RunSelect postgres specific query for runs
 const RunSelect = `
 select t.run_id                          as runid,
@@ -220,7 +296,21 @@ select t.run_id                          as runid,
 	   labels::TEXT                      as labels,
 	   coalesce(requires_docker,false)   as requires_docker,
 	   service_account 				 	 as service_account,
-     coalesce(tier::text, 'Tier4')   as tier
+     coalesce(tier::text, 'Tier4')   as tier,
+       structured_exceptions::TEXT       as structuredexceptions,
+       failure_category                  as failurecategory,
+       t.image_digest                    as imagedigest,
+       array_parent_id                   as arrayparentid,
+       array_index                       as arrayindex,
+       array_status::TEXT                as array,
+       t.replicas                        as replicas,
+       t.replica_pods::TEXT              as replicapods,
+       volumes::TEXT                     as volumes,
+       artifacts::TEXT                   as artifacts,
+       result::TEXT                      as result,
+       attempts::TEXT                    as attempts,
+       endpoints::TEXT                   as endpoints,
+       run_stop::TEXT                    as stop
 from task t
 `
 const GetRunStatusSQL = `
@@ -274,7 +364,8 @@ const WorkerSelect = `
   select
     worker_type        as workertype,
     count_per_instance as countperinstance,
-    engine
+    engine,
+    coalesce(scope, 'instance') as scope
   from worker
 `
 
@@ -291,6 +382,26 @@ const GetWorkerSQL = WorkerSelect + "\nwhere worker_type = $1 and engine = $2"
 // worker type; locks the row.
 const GetWorkerSQLForUpdate = GetWorkerSQL + " for update"
 
+// WorkerInstanceSelect postgres specific query for worker instances
+const WorkerInstanceSelect = `
+SELECT
+	instance_id,
+	hostname,
+	started_at,
+	heartbeat_at,
+	workers::TEXT as workers
+FROM worker_instance`
+
+// ListWorkerInstancesSQL lists the instances which heartbeated within the
+// given number of seconds
+const ListWorkerInstancesSQL = WorkerInstanceSelect + `
+WHERE heartbeat_at >= now() - $1::float8 * interval '1 second'
+ORDER BY started_at, instance_id`
+
+// GetWorkerLeaseSQL postgres specific query for getting a lease
+const GetWorkerLeaseSQL = `
+SELECT name, holder, acquired_at, expires_at FROM worker_lease WHERE name = $1`
+
 // TemplateSelect selects a template
 const TemplateSelect = `
 SELECT
@@ -307,7 +418,12 @@ SELECT
   cpu,
   gpu,
   defaults,
-  coalesce(avatar_uri, '') as avataruri
+  coalesce(avatar_uri, '') as avataruri,
+  init_containers::TEXT as initcontainers,
+  sidecars::TEXT as sidecars,
+  shared_volumes::TEXT as sharedvolumes,
+  volumes::TEXT as volumes,
+  deprecation::TEXT as deprecation
 FROM template
 `
 
@@ -334,7 +450,12 @@ const ListTemplatesLatestOnlySQL = `
     cpu,
     gpu,
     defaults,
-    coalesce(avatar_uri, '') as avataruri
+    coalesce(avatar_uri, '') as avataruri,
+    init_containers::TEXT as initcontainers,
+    sidecars::TEXT as sidecars,
+    shared_volumes::TEXT as sharedvolumes,
+    volumes::TEXT as volumes,
+    deprecation::TEXT as deprecation
   FROM template
   ORDER BY template_name, version DESC, template_id
   LIMIT $1 OFFSET $2
@@ -343,3 +464,94 @@ const ListTemplatesLatestOnlySQL = `
 // GetTemplateLatestOnlySQL get the latest version of a specific template name.
 const GetTemplateLatestOnlySQL = TemplateSelect + "\nWHERE template_name = $1 ORDER BY version DESC LIMIT 1;"
 const GetTemplateByVersionSQL = TemplateSelect + "\nWHERE template_name = $1 AND version = $2 ORDER BY version DESC LIMIT 1;"
+
+// TemplateChannelSelect selects template channels along with the id of the
+// version they target
+const TemplateChannelSelect = `
+SELECT
+	c.template_name,
+	c.channel,
+	c.version,
+	t.template_id,
+	c.updated_by,
+	c.updated_at
+FROM template_channel c
+JOIN template t ON t.template_name = c.template_name AND t.version = c.version
+`
+
+// ListTemplateChannelsSQL lists the channels of a template
+const ListTemplateChannelsSQL = TemplateChannelSelect + "\nWHERE c.template_name = $1 ORDER BY c.channel"
+
+// GetTemplateChannelSQL gets a channel of a template
+const GetTemplateChannelSQL = TemplateChannelSelect + "\nWHERE c.template_name = $1 AND c.channel = $2"
+
+// TemplateUsageSQL counts the runs of each version of a template queued
+// since a point in time
+const TemplateUsageSQL = `
+SELECT
+	t.template_id,
+	t.version,
+	count(r.run_id) as runs,
+	count(r.run_id) FILTER (WHERE r.status IN ('QUEUED', 'PENDING', 'RUNNING', 'NEEDS_RETRY')) as active_runs,
+	max(r.queued_at) as last_run_at,
+	coalesce(json_agg(DISTINCT r."user") FILTER (WHERE coalesce(r."user", '') <> ''), '[]')::TEXT as users,
+	t.deprecation::TEXT as deprecation
+FROM template t
+LEFT JOIN task r ON r.executable_type = 'template' AND r.executable_id = t.template_id AND r.queued_at >= $2
+WHERE t.template_name = $1
+GROUP BY t.template_id, t.version
+ORDER BY t.version DESC
+`
+
+// DebugSessionSelect postgres specific query for debug sessions
+const DebugSessionSelect = `
+SELECT
+	session_id,
+	run_id,
+	mode,
+	user_name,
+	cluster_name,
+	namespace,
+	job_name,
+	pod_name,
+	container,
+	image,
+	created_at,
+	expires_at,
+	terminated_at,
+	terminated_by,
+	execs::TEXT as execs
+FROM debug_session`
+
+// GetDebugSessionSQL postgres specific query for getting a single debug session
+const GetDebugSessionSQL = DebugSessionSelect + "\nWHERE session_id = $1"
+
+// GetDebugSessionSQLForUpdate locks a debug session while it's updated
+const GetDebugSessionSQLForUpdate = GetDebugSessionSQL + " FOR UPDATE"
+
+// ListDebugSessionsSQL postgres specific query for the debug sessions of a run
+const ListDebugSessionsSQL = DebugSessionSelect + "\nWHERE run_id = $1 ORDER BY created_at DESC"
+
+// SettingSelect postgres specific query for setting overrides
+const SettingSelect = `
+SELECT
+	key,
+	value::TEXT as value,
+	updated_by,
+	updated_at
+FROM setting`
+
+// ListSettingsSQL lists the setting overrides
+const ListSettingsSQL = SettingSelect + "\nORDER BY key"
+
+// SettingChangeSelect postgres specific query for the changes of settings
+const SettingChangeSelect = `
+SELECT
+	id,
+	key,
+	value::TEXT as value,
+	previous_value::TEXT as previous_value,
+	reason,
+	updated_by,
+	updated_at
+FROM setting_change`
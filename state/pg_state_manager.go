@@ -55,6 +55,86 @@ func (sm *SQLStateManager) ListFailingNodes(ctx context.Context) (NodeList, erro
 	return nodeList, err
 }
 
+// CountActiveRuns counts the runs which aren't finished by cluster, engine
+// and status
+func (sm *SQLStateManager) CountActiveRuns(ctx context.Context) ([]RunStatusCount, error) {
+	ctx, span := tracing.TraceJob(ctx, "flotilla.state.count_active_runs", "")
+	defer span.Finish()
+
+	var counts []RunStatusCount
+	if err := sm.readonlyDB.SelectContext(ctx, &counts, CountActiveRunsSQL); err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return counts, errors.Wrap(err, "issue counting active runs")
+	}
+	return counts, nil
+}
+
+// runLatencyRow is a row of RunLatencySQL
+type runLatencyRow struct {
+	Bucket       *time.Time `db:"bucket"`
+	Value        string     `db:"value"`
+	Runs         int64      `db:"runs"`
+	Started      int64      `db:"started"`
+	Finished     int64      `db:"finished"`
+	QueueWaitP50 *float64   `db:"queue_wait_p50"`
+	QueueWaitP90 *float64   `db:"queue_wait_p90"`
+	QueueWaitP99 *float64   `db:"queue_wait_p99"`
+	PendingP50   *float64   `db:"pending_p50"`
+	PendingP90   *float64   `db:"pending_p90"`
+	PendingP99   *float64   `db:"pending_p99"`
+	RuntimeP50   *float64   `db:"runtime_p50"`
+	RuntimeP90   *float64   `db:"runtime_p90"`
+	RuntimeP99   *float64   `db:"runtime_p99"`
+}
+
+// GetRunLatencyStats computes the percentiles of the queue wait, pending time
+// and runtime of the runs queued in the window of the query.
+func (sm *SQLStateManager) GetRunLatencyStats(ctx context.Context, q RunLatencyQuery) ([]RunLatencyStats, error) {
+	ctx, span := tracing.TraceJob(ctx, "flotilla.state.get_run_latency_stats", "")
+	defer span.Finish()
+	span.SetTag("group_by", string(q.GroupBy))
+
+	dimension, ok := runDimensionColumns[q.GroupBy]
+	if !ok {
+		return nil, exceptions.MalformedInput{ErrorString: fmt.Sprintf("runs can't be grouped by [%s]", q.GroupBy)}
+	}
+	args := []interface{}{q.Since, q.Until}
+	if q.GroupBy == RunDimensionTeam {
+		args = append(args, q.TeamLabel)
+		dimension = fmt.Sprintf(dimension, len(args))
+	}
+	// Runs are bucketed by the interval, in seconds, the whole window
+	// being a single bucket without interval.
+	bucket := "NULL::timestamptz"
+	if interval := int64(q.Interval.Seconds()); interval > 0 {
+		args = append(args, interval)
+		bucket = fmt.Sprintf("to_timestamp(floor(extract(epoch FROM queued_at) / $%d) * $%d)", len(args), len(args))
+	}
+
+	var rows []runLatencyRow
+	if err := sm.readonlyDB.SelectContext(ctx, &rows, fmt.Sprintf(RunLatencySQL, bucket, dimension), args...); err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return nil, errors.Wrap(err, "issue computing run latencies")
+	}
+
+	stats := make([]RunLatencyStats, len(rows))
+	for i, row := range rows {
+		stats[i] = RunLatencyStats{
+			Bucket:    row.Bucket,
+			Value:     row.Value,
+			Runs:      row.Runs,
+			Started:   row.Started,
+			Finished:  row.Finished,
+			QueueWait: Percentiles{P50: row.QueueWaitP50, P90: row.QueueWaitP90, P99: row.QueueWaitP99},
+			Pending:   Percentiles{P50: row.PendingP50, P90: row.PendingP90, P99: row.PendingP99},
+			Runtime:   Percentiles{P50: row.RuntimeP50, P90: row.RuntimeP90, P99: row.RuntimeP99},
+		}
+	}
+	return stats, nil
+}
+
 func (sm *SQLStateManager) GetPodReAttemptRate(ctx context.Context) (float32, error) {
 	ctx, span := tracing.TraceJob(ctx, "flotilla.state.get_pod_reattempt_rate", "")
 	defer span.Finish()
@@ -303,14 +383,20 @@ func (sm *SQLStateManager) Initialize(conf config.Config) error {
 
 	createSchema := conf.GetBool("create_database_schema")
 	fmt.Printf("create_database_schema: %t\ncreating schema...\n", createSchema)
-	sqltrace.Register("postgres", &pq.Driver{}, sqltrace.WithServiceName("flotilla"))
+	// The queries are only traced by Datadog, other tracing backends see the
+	// spans of the state manager.
+	open := sqlx.Open
+	if tracing.IsDatadog() {
+		sqltrace.Register("postgres", &pq.Driver{}, sqltrace.WithServiceName("flotilla"))
+		open = func(driverName, dataSourceName string) (*sqlx.DB, error) {
+			return sqlxtrace.Open(driverName, dataSourceName)
+		}
+	}
 	var err error
-	if sm.db, err = sqlxtrace.Open("postgres", dburl); err != nil {
+	if sm.db, err = open("postgres", dburl); err != nil {
 		return errors.Wrap(err, "unable to open postgres db")
 	}
-
-	sqltrace.Register("postgres", &pq.Driver{}, sqltrace.WithServiceName("flotilla"))
-	if sm.readonlyDB, err = sqlxtrace.Open("postgres", readonlyDbUrl); err != nil {
+	if sm.readonlyDB, err = open("postgres", readonlyDbUrl); err != nil {
 		return errors.Wrap(err, "unable to open readonly postgres db")
 	}
 
@@ -343,12 +429,28 @@ func (sm *SQLStateManager) Initialize(conf config.Config) error {
 	return nil
 }
 
-func (sm *SQLStateManager) makeWhereClause(filters map[string][]string) []string {
+// makeWhereClause returns the conditions of the filters along with the
+// arguments they bind. Their placeholders follow the limit and offset ($1 and
+// $2) of the list queries.
+func (sm *SQLStateManager) makeWhereClause(filters map[string][]string) ([]string, []interface{}) {
 
 	// These will be joined with "AND"
 	wc := []string{}
+	args := []interface{}{}
 	for k, v := range filters {
-		if len(v) > 1 {
+		if k == "label" {
+			// Label filters are "|" separated key-value pairs, eg. label=team|data
+			for _, kv := range v {
+				if split := strings.SplitN(kv, "|", 2); len(split) == 2 {
+					label, err := json.Marshal(map[string]string{split[0]: split[1]})
+					if err != nil {
+						continue
+					}
+					args = append(args, string(label))
+					wc = append(wc, fmt.Sprintf("labels @> $%d::jsonb", len(args)+2))
+				}
+			}
+		} else if len(v) > 1 {
 			// No like queries for multiple filters with same key
 			quoted := make([]string, len(v))
 			for i, filterVal := range v {
@@ -370,7 +472,7 @@ func (sm *SQLStateManager) makeWhereClause(filters map[string][]string) []string
 			wc = append(wc, fmt.Sprintf(fmtString, fieldName, v[0]))
 		}
 	}
-	return wc
+	return wc, args
 }
 
 func (sm *SQLStateManager) makeEnvWhereClause(filters map[string]string) []string {
@@ -416,7 +518,8 @@ func (sm *SQLStateManager) ListDefinitions(
 	var err error
 	var result DefinitionList
 	var whereClause, orderQuery string
-	where := append(sm.makeWhereClause(filters), sm.makeEnvWhereClause(envFilters)...)
+	where, args := sm.makeWhereClause(filters)
+	where = append(where, sm.makeEnvWhereClause(envFilters)...)
 	if len(where) > 0 {
 		whereClause = fmt.Sprintf("where %s", strings.Join(where, " and "))
 	}
@@ -429,11 +532,11 @@ func (sm *SQLStateManager) ListDefinitions(
 	sql := fmt.Sprintf(ListDefinitionsSQL, whereClause, orderQuery)
 	countSQL := fmt.Sprintf("select COUNT(*) from (%s) as sq", sql)
 
-	err = sm.db.Select(&result.Definitions, sql, limit, offset)
+	err = sm.db.Select(&result.Definitions, sql, append([]interface{}{limit, offset}, args...)...)
 	if err != nil {
 		return result, errors.Wrap(err, "issue running list definitions sql")
 	}
-	err = sm.db.Get(&result.Total, countSQL, nil, 0)
+	err = sm.db.Get(&result.Total, countSQL, append([]interface{}{nil, 0}, args...)...)
 	if err != nil {
 		return result, errors.Wrap(err, "issue running list definitions count sql")
 	}
@@ -497,6 +600,25 @@ func (sm *SQLStateManager) UpdateDefinition(ctx context.Context, definitionID st
 
 	existing.UpdateWith(updates)
 
+	tx, err := sm.db.Begin()
+	if err != nil {
+		return existing, errors.WithStack(err)
+	}
+	if err = sm.updateDefinition(tx, definitionID, existing); err != nil {
+		tx.Rollback()
+		return existing, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return existing, errors.WithStack(err)
+	}
+	return existing, nil
+}
+
+// updateDefinition replaces the definition with existing within the
+// transaction.
+func (sm *SQLStateManager) updateDefinition(tx *sql.Tx, definitionID string, existing Definition) error {
+	var err error
 	selectForUpdate := `SELECT * FROM task_def WHERE definition_id = $1 FOR UPDATE;`
 	deletePorts := `DELETE FROM task_def_ports WHERE task_def_id = $1;`
 	deleteTags := `DELETE FROM task_def_tags WHERE task_def_id = $1`
@@ -517,21 +639,16 @@ func (sm *SQLStateManager) UpdateDefinition(ctx context.Context, definitionID st
 	INSERT INTO tags(text) SELECT $1 WHERE NOT EXISTS (SELECT text from tags where text = $2)
 	`
 
-	tx, err := sm.db.Begin()
-	if err != nil {
-		return existing, errors.WithStack(err)
-	}
-
 	if _, err = tx.Exec(selectForUpdate, definitionID); err != nil {
-		return existing, errors.WithStack(err)
+		return errors.WithStack(err)
 	}
 
 	if _, err = tx.Exec(deletePorts, definitionID); err != nil {
-		return existing, errors.WithStack(err)
+		return errors.WithStack(err)
 	}
 
 	if _, err = tx.Exec(deleteTags, definitionID); err != nil {
-		return existing, errors.WithStack(err)
+		return errors.WithStack(err)
 	}
 
 	update := `
@@ -546,7 +663,12 @@ func (sm *SQLStateManager) UpdateDefinition(ctx context.Context, definitionID st
       adaptive_resource_allocation = $9,
       ephemeral_storage = $10,
 	  requires_docker = $11,
-      target_cluster = $12
+      target_cluster = $12,
+      init_containers = $13,
+      sidecars = $14,
+      shared_volumes = $15,
+      volumes = $16,
+      group_name = $17
     WHERE definition_id = $1;
     `
 	if _, err = tx.Exec(
@@ -562,15 +684,19 @@ func (sm *SQLStateManager) UpdateDefinition(ctx context.Context, definitionID st
 		existing.AdaptiveResourceAllocation,
 		existing.EphemeralStorage,
 		existing.RequiresDocker,
-		existing.TargetCluster); err != nil {
-		return existing, errors.Wrapf(err, "issue updating definition [%s]", definitionID)
+		existing.TargetCluster,
+		existing.InitContainers,
+		existing.Sidecars,
+		existing.SharedVolumes,
+		existing.Volumes,
+		existing.GroupName); err != nil {
+		return errors.Wrapf(err, "issue updating definition [%s]", definitionID)
 	}
 
 	if existing.Ports != nil {
 		for _, p := range *existing.Ports {
 			if _, err = tx.Exec(insertPorts, definitionID, p); err != nil {
-				tx.Rollback()
-				return existing, errors.WithStack(err)
+				return errors.WithStack(err)
 			}
 		}
 	}
@@ -578,20 +704,14 @@ func (sm *SQLStateManager) UpdateDefinition(ctx context.Context, definitionID st
 	if existing.Tags != nil {
 		for _, t := range *existing.Tags {
 			if _, err = tx.Exec(insertTags, t, t); err != nil {
-				tx.Rollback()
-				return existing, errors.WithStack(err)
+				return errors.WithStack(err)
 			}
 			if _, err = tx.Exec(insertDefTags, definitionID, t); err != nil {
-				tx.Rollback()
-				return existing, errors.WithStack(err)
+				return errors.WithStack(err)
 			}
 		}
 	}
-	err = tx.Commit()
-	if err != nil {
-		return existing, errors.WithStack(err)
-	}
-	return existing, nil
+	return nil
 }
 
 // CreateDefinition creates the passed in definition object
@@ -601,6 +721,26 @@ func (sm *SQLStateManager) CreateDefinition(ctx context.Context, d Definition) e
 	defer span.Finish()
 	var err error
 
+	tx, err := sm.db.Begin()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err = sm.createDefinition(tx, d); err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// createDefinition inserts the definition within the transaction.
+func (sm *SQLStateManager) createDefinition(tx *sql.Tx, d Definition) error {
+	var err error
 	insertPorts := `
     INSERT INTO task_def_ports(
       task_def_id, port
@@ -617,11 +757,6 @@ func (sm *SQLStateManager) CreateDefinition(ctx context.Context, d Definition) e
 	INSERT INTO tags(text) SELECT $1 WHERE NOT EXISTS (SELECT text from tags where text = $2)
 	`
 
-	tx, err := sm.db.Begin()
-	if err != nil {
-		return errors.WithStack(err)
-	}
-
 	insert := `
     INSERT INTO task_def(
       definition_id,
@@ -636,9 +771,13 @@ func (sm *SQLStateManager) CreateDefinition(ctx context.Context, d Definition) e
       adaptive_resource_allocation,
       ephemeral_storage,
       requires_docker,
-      target_cluster
+      target_cluster,
+      init_containers,
+      sidecars,
+      shared_volumes,
+      volumes
     )
-    VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13);
+    VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17);
     `
 
 	if _, err = tx.Exec(insert,
@@ -654,8 +793,11 @@ func (sm *SQLStateManager) CreateDefinition(ctx context.Context, d Definition) e
 		d.AdaptiveResourceAllocation,
 		d.EphemeralStorage,
 		d.RequiresDocker,
-		d.TargetCluster); err != nil {
-		tx.Rollback()
+		d.TargetCluster,
+		d.InitContainers,
+		d.Sidecars,
+		d.SharedVolumes,
+		d.Volumes); err != nil {
 		return errors.Wrapf(
 			err, "issue creating new task definition with alias [%s] and id [%s]", d.DefinitionID, d.Alias)
 	}
@@ -663,7 +805,6 @@ func (sm *SQLStateManager) CreateDefinition(ctx context.Context, d Definition) e
 	if d.Ports != nil {
 		for _, p := range *d.Ports {
 			if _, err = tx.Exec(insertPorts, d.DefinitionID, p); err != nil {
-				tx.Rollback()
 				return errors.WithStack(err)
 			}
 		}
@@ -672,21 +813,13 @@ func (sm *SQLStateManager) CreateDefinition(ctx context.Context, d Definition) e
 	if d.Tags != nil {
 		for _, t := range *d.Tags {
 			if _, err = tx.Exec(insertTags, t, t); err != nil {
-				tx.Rollback()
 				return errors.WithStack(err)
 			}
 			if _, err = tx.Exec(insertDefTags, d.DefinitionID, t); err != nil {
-				tx.Rollback()
 				return errors.WithStack(err)
 			}
 		}
 	}
-	err = tx.Commit()
-	if err != nil {
-		span.SetTag("error", true)
-		span.SetTag("error.msg", err.Error())
-		return errors.WithStack(err)
-	}
 	return nil
 }
 
@@ -696,22 +829,13 @@ func (sm *SQLStateManager) DeleteDefinition(ctx context.Context, definitionID st
 	defer span.Finish()
 	var err error
 
-	statements := []string{
-		"DELETE FROM task_def_ports WHERE task_def_id = $1",
-		"DELETE FROM task_def_tags WHERE task_def_id = $1",
-		"DELETE FROM task WHERE definition_id = $1",
-		"DELETE FROM task_def WHERE definition_id = $1",
-	}
 	tx, err := sm.db.Begin()
 	if err != nil {
 		return errors.WithStack(err)
 	}
-
-	for _, stmt := range statements {
-		if _, err = tx.Exec(stmt, definitionID); err != nil {
-			tx.Rollback()
-			return errors.Wrapf(err, "issue deleting definition with id [%s]", definitionID)
-		}
+	if err = sm.deleteDefinition(tx, definitionID); err != nil {
+		tx.Rollback()
+		return err
 	}
 
 	err = tx.Commit()
@@ -721,6 +845,23 @@ func (sm *SQLStateManager) DeleteDefinition(ctx context.Context, definitionID st
 	return nil
 }
 
+// deleteDefinition deletes the definition and its runs within the
+// transaction.
+func (sm *SQLStateManager) deleteDefinition(tx *sql.Tx, definitionID string) error {
+	statements := []string{
+		"DELETE FROM task_def_ports WHERE task_def_id = $1",
+		"DELETE FROM task_def_tags WHERE task_def_id = $1",
+		"DELETE FROM task WHERE definition_id = $1",
+		"DELETE FROM task_def WHERE definition_id = $1",
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt, definitionID); err != nil {
+			return errors.Wrapf(err, "issue deleting definition with id [%s]", definitionID)
+		}
+	}
+	return nil
+}
+
 // ListRuns returns a RunList
 // limit: limit the result to this many runs
 // offset: start the results at this offset
@@ -745,7 +886,8 @@ func (sm *SQLStateManager) ListRuns(ctx context.Context, limit int, offset int,
 		filters["engine"] = []string{DefaultEngine}
 	}
 
-	where := append(sm.makeWhereClause(filters), sm.makeEnvWhereClause(envFilters)...)
+	where, args := sm.makeWhereClause(filters)
+	where = append(where, sm.makeEnvWhereClause(envFilters)...)
 	if len(where) > 0 {
 		whereClause = fmt.Sprintf("where %s", strings.Join(where, " and "))
 	}
@@ -758,11 +900,11 @@ func (sm *SQLStateManager) ListRuns(ctx context.Context, limit int, offset int,
 	sql := fmt.Sprintf(ListRunsSQL, whereClause, orderQuery)
 	countSQL := fmt.Sprintf("select COUNT(*) from (%s) as sq", sql)
 
-	err = sm.db.Select(&result.Runs, sql, limit, offset)
+	err = sm.db.Select(&result.Runs, sql, append([]interface{}{limit, offset}, args...)...)
 	if err != nil {
 		return result, errors.Wrap(err, "issue running list runs sql")
 	}
-	err = sm.db.Get(&result.Total, countSQL, nil, 0)
+	err = sm.db.Get(&result.Total, countSQL, append([]interface{}{nil, 0}, args...)...)
 	if err != nil {
 		return result, errors.Wrap(err, "issue running list runs count sql")
 	}
@@ -933,14 +1075,35 @@ func (sm *SQLStateManager) UpdateRun(ctx context.Context, runID string, updates
 			&existing.RequiresDocker,
 			&existing.ServiceAccount,
 			&existing.Tier,
+			&existing.StructuredExceptions,
+			&existing.FailureCategory,
+			&existing.ImageDigest,
+			&existing.ArrayParentID,
+			&existing.ArrayIndex,
+			&existing.Array,
+			&existing.Replicas,
+			&existing.ReplicaPods,
+			&existing.Volumes,
+			&existing.Artifacts,
+			&existing.Result,
+			&existing.Attempts,
+			&existing.Endpoints,
+			&existing.Stop,
 		)
 	}
 	if err != nil {
 		return existing, errors.WithStack(err)
 	}
 
+	previousStatus := existing.Status
 	existing.UpdateWith(updates)
 
+	// Classify at every terminal transition, and again when a stopped run
+	// gets more details (eg. exceptions extracted from its logs).
+	if existing.Status == StatusStopped && updates.FailureCategory == nil {
+		existing.FailureCategory = ClassifyFailure(existing)
+	}
+
 	update := `
     UPDATE task SET
         definition_id = $2,
@@ -988,7 +1151,21 @@ func (sm *SQLStateManager) UpdateRun(ctx context.Context, runID string, updates
 		labels = $44,
 		requires_docker = $45,
 		service_account = $46,
-        tier = $47
+        tier = $47,
+        structured_exceptions = $48,
+        failure_category = $49,
+        image_digest = $50,
+        array_parent_id = $51,
+        array_index = $52,
+        array_status = $53,
+        replicas = $54,
+        replica_pods = $55,
+        volumes = $56,
+        artifacts = $57,
+        result = $58,
+        attempts = $59,
+        endpoints = $60,
+        run_stop = $61
     WHERE run_id = $1;
     `
 
@@ -1040,16 +1217,47 @@ func (sm *SQLStateManager) UpdateRun(ctx context.Context, runID string, updates
 		existing.Labels,
 		existing.RequiresDocker,
 		existing.ServiceAccount,
-		existing.Tier); err != nil {
+		existing.Tier,
+		existing.StructuredExceptions,
+		existing.FailureCategory,
+		existing.ImageDigest,
+		existing.ArrayParentID,
+		existing.ArrayIndex,
+		existing.Array,
+		existing.Replicas,
+		existing.ReplicaPods,
+		existing.Volumes,
+		existing.Artifacts,
+		existing.Result,
+		existing.Attempts,
+		existing.Endpoints,
+		existing.Stop); err != nil {
 		tx.Rollback()
 		return existing, errors.WithStack(err)
 	}
 
+	// pending_at and running_at only serve the latency analytics
+	if previousStatus != StatusPending && existing.Status == StatusPending {
+		if _, err = tx.Exec(SetRunPendingAtSQL, runID); err != nil {
+			tx.Rollback()
+			return existing, errors.WithStack(err)
+		}
+	}
+	if previousStatus != StatusRunning && existing.Status == StatusRunning {
+		if _, err = tx.Exec(SetRunRunningAtSQL, runID); err != nil {
+			tx.Rollback()
+			return existing, errors.WithStack(err)
+		}
+	}
+
 	if err = tx.Commit(); err != nil {
 		return existing, errors.WithStack(err)
 	}
 
 	_ = metrics.Timing(metrics.EngineUpdateRun, time.Since(start), []string{existing.ClusterName}, 1)
+	if previousStatus != StatusStopped && existing.Status == StatusStopped {
+		sm.emitRunFinished(existing)
+	}
 	go sm.logStatusUpdate(existing)
 	return existing, nil
 }
@@ -1060,7 +1268,43 @@ func (sm *SQLStateManager) CreateRun(ctx context.Context, r Run) error {
 	defer span.Finish()
 	span.SetTag("job.run_id", r.RunID)
 	// Now utils.TraceJob already sets the run_id tag
-	var err error
+	return sm.CreateRuns(ctx, []Run{r})
+}
+
+// CreateRuns creates the runs in a single transaction, either all of them
+// are created or none is.
+func (sm *SQLStateManager) CreateRuns(ctx context.Context, runs []Run) error {
+	ctx, span := tracing.TraceJob(ctx, "flotilla.state.create_runs", "")
+	defer span.Finish()
+	span.SetTag("runs", len(runs))
+
+	tx, err := sm.db.BeginTx(ctx, nil)
+	if err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return errors.WithStack(err)
+	}
+
+	for _, r := range runs {
+		if err = sm.insertRun(ctx, tx, r); err != nil {
+			tx.Rollback()
+			span.SetTag("error", true)
+			span.SetTag("error.msg", err.Error())
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return errors.WithStack(err)
+	}
+	for _, r := range runs {
+		go sm.logStatusUpdate(r)
+	}
+	return nil
+}
+
+// insertRun inserts the run within tx.
+func (sm *SQLStateManager) insertRun(ctx context.Context, tx *sql.Tx, r Run) error {
 	insert := `
 	INSERT INTO task (
       	run_id,
@@ -1110,7 +1354,21 @@ func (sm *SQLStateManager) CreateRun(ctx context.Context, r Run) error {
 	    labels,
 		requires_docker,
 		service_account,
-		tier
+		tier,
+		structured_exceptions,
+		failure_category,
+		image_digest,
+		array_parent_id,
+		array_index,
+		array_status,
+		replicas,
+		replica_pods,
+		volumes,
+		artifacts,
+		result,
+		attempts,
+		endpoints,
+		run_stop
     ) VALUES (
         $1,
 		$2,
@@ -1159,18 +1417,25 @@ func (sm *SQLStateManager) CreateRun(ctx context.Context, r Run) error {
         $45,
     	$46,
     	$47,
-    	$48
+    	$48,
+    	$49,
+    	$50,
+    	$51,
+    	$52,
+    	$53,
+    	$54,
+    	$55,
+    	$56,
+    	$57,
+    	$58,
+    	$59,
+    	$60,
+    	$61,
+    	$62
 	);
     `
 
-	tx, err := sm.db.BeginTx(ctx, nil)
-	if err != nil {
-		span.SetTag("error", true)
-		span.SetTag("error.msg", err.Error())
-		return errors.WithStack(err)
-	}
-
-	if _, err = tx.ExecContext(ctx, insert,
+	if _, err := tx.ExecContext(ctx, insert,
 		r.RunID,
 		r.DefinitionID,
 		r.Alias,
@@ -1218,15 +1483,23 @@ func (sm *SQLStateManager) CreateRun(ctx context.Context, r Run) error {
 		r.Labels,
 		r.RequiresDocker,
 		r.ServiceAccount,
-		r.Tier); err != nil {
-		tx.Rollback()
+		r.Tier,
+		r.StructuredExceptions,
+		r.FailureCategory,
+		r.ImageDigest,
+		r.ArrayParentID,
+		r.ArrayIndex,
+		r.Array,
+		r.Replicas,
+		r.ReplicaPods,
+		r.Volumes,
+		r.Artifacts,
+		r.Result,
+		r.Attempts,
+		r.Endpoints,
+		r.Stop); err != nil {
 		return errors.Wrapf(err, "issue creating new task run with id [%s]", r.RunID)
 	}
-
-	if err = tx.Commit(); err != nil {
-		return errors.WithStack(err)
-	}
-	go sm.logStatusUpdate(r)
 	return nil
 }
 
@@ -1240,8 +1513,8 @@ func (sm *SQLStateManager) ListGroups(ctx context.Context, limit int, offset int
 		whereClause string
 	)
 	if name != nil && len(*name) > 0 {
-		whereClause = fmt.Sprintf("where %s", strings.Join(
-			sm.makeWhereClause(map[string][]string{"group_name": {*name}}), " and "))
+		where, _ := sm.makeWhereClause(map[string][]string{"group_name": {*name}})
+		whereClause = fmt.Sprintf("where %s", strings.Join(where, " and "))
 	}
 
 	sql := fmt.Sprintf(ListGroupsSQL, whereClause)
@@ -1269,8 +1542,8 @@ func (sm *SQLStateManager) ListTags(ctx context.Context, limit int, offset int,
 		whereClause string
 	)
 	if name != nil && len(*name) > 0 {
-		whereClause = fmt.Sprintf("where %s", strings.Join(
-			sm.makeWhereClause(map[string][]string{"text": {*name}}), " and "))
+		where, _ := sm.makeWhereClause(map[string][]string{"text": {*name}})
+		whereClause = fmt.Sprintf("where %s", strings.Join(where, " and "))
 	}
 
 	sql := fmt.Sprintf(ListTagsSQL, whereClause)
@@ -1403,7 +1676,7 @@ func (sm *SQLStateManager) UpdateWorker(ctx context.Context, workerType string,
 	}
 
 	for rows.Next() {
-		err = rows.Scan(&existing.WorkerType, &existing.CountPerInstance, &existing.Engine)
+		err = rows.Scan(&existing.WorkerType, &existing.CountPerInstance, &existing.Engine, &existing.Scope)
 	}
 	if err != nil {
 		return existing, errors.WithStack(err)
@@ -1412,11 +1685,11 @@ func (sm *SQLStateManager) UpdateWorker(ctx context.Context, workerType string,
 	existing.UpdateWith(updates)
 
 	update := `
-		UPDATE worker SET count_per_instance = $2
+		UPDATE worker SET count_per_instance = $2, scope = $3
     WHERE worker_type = $1;
     `
 
-	if _, err = tx.ExecContext(ctx, update, workerType, existing.CountPerInstance); err != nil {
+	if _, err = tx.ExecContext(ctx, update, workerType, existing.CountPerInstance, existing.Scope); err != nil {
 		tx.Rollback()
 		span.SetTag("error", true)
 		span.SetTag("error.msg", err.Error())
@@ -1451,6 +1724,116 @@ func (sm *SQLStateManager) BatchUpdateWorkers(ctx context.Context, updates []Wor
 	return sm.ListWorkers(ctx, DefaultEngine)
 }
 
+// HeartbeatWorkerInstance records that an instance is alive along with the
+// workers it runs, and forgets the instances gone for a day.
+func (sm *SQLStateManager) HeartbeatWorkerInstance(ctx context.Context, instance WorkerInstance) error {
+	ctx, span := tracing.TraceJob(ctx, "flotilla.state.heartbeat_worker_instance", "")
+	defer span.Finish()
+	upsert := `
+	INSERT INTO worker_instance(instance_id, hostname, started_at, heartbeat_at, workers)
+	VALUES ($1, $2, $3, now(), $4)
+	ON CONFLICT (instance_id) DO UPDATE SET
+		heartbeat_at = EXCLUDED.heartbeat_at,
+		workers = EXCLUDED.workers;
+	`
+	if _, err := sm.db.ExecContext(ctx, upsert,
+		instance.InstanceID, instance.Hostname, instance.StartedAt, instance.Workers); err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return errors.Wrapf(err, "issue heartbeating worker instance [%s]", instance.InstanceID)
+	}
+	if _, err := sm.db.ExecContext(ctx,
+		"DELETE FROM worker_instance WHERE heartbeat_at < now() - interval '1 day'"); err != nil {
+		return errors.Wrap(err, "issue deleting stale worker instances")
+	}
+	return nil
+}
+
+// ListWorkerInstances lists the instances which heartbeated within the ttl.
+func (sm *SQLStateManager) ListWorkerInstances(ctx context.Context, ttl time.Duration) ([]WorkerInstance, error) {
+	ctx, span := tracing.TraceJob(ctx, "flotilla.state.list_worker_instances", "")
+	defer span.Finish()
+	var instances []WorkerInstance
+	if err := sm.db.SelectContext(ctx, &instances, ListWorkerInstancesSQL, ttl.Seconds()); err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return instances, errors.Wrap(err, "issue listing worker instances")
+	}
+	return instances, nil
+}
+
+// DeleteWorkerInstance takes an instance out of the topology.
+func (sm *SQLStateManager) DeleteWorkerInstance(ctx context.Context, instanceID string) error {
+	ctx, span := tracing.TraceJob(ctx, "flotilla.state.delete_worker_instance", "")
+	defer span.Finish()
+	if _, err := sm.db.ExecContext(ctx, "DELETE FROM worker_instance WHERE instance_id = $1", instanceID); err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return errors.Wrapf(err, "issue deleting worker instance [%s]", instanceID)
+	}
+	return nil
+}
+
+// AcquireWorkerLease takes the named lease for the holder, or renews it when
+// the holder already has it. Leases held by others are only taken once they
+// expire. The current lease is returned either way.
+func (sm *SQLStateManager) AcquireWorkerLease(ctx context.Context, name string, holder string, ttl time.Duration) (WorkerLease, error) {
+	ctx, span := tracing.TraceJob(ctx, "flotilla.state.acquire_worker_lease", "")
+	defer span.Finish()
+	var lease WorkerLease
+	upsert := `
+	INSERT INTO worker_lease(name, holder, acquired_at, expires_at)
+	VALUES ($1, $2, now(), now() + $3::float8 * interval '1 second')
+	ON CONFLICT (name) DO UPDATE SET
+		holder = EXCLUDED.holder,
+		acquired_at = CASE WHEN worker_lease.holder = EXCLUDED.holder
+			THEN worker_lease.acquired_at ELSE EXCLUDED.acquired_at END,
+		expires_at = EXCLUDED.expires_at
+	WHERE worker_lease.holder = EXCLUDED.holder OR worker_lease.expires_at < now()
+	RETURNING name, holder, acquired_at, expires_at;
+	`
+	err := sm.db.GetContext(ctx, &lease, upsert, name, holder, ttl.Seconds())
+	if err == sql.ErrNoRows {
+		return sm.GetWorkerLease(ctx, name)
+	}
+	if err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return lease, errors.Wrapf(err, "issue acquiring worker lease [%s]", name)
+	}
+	return lease, nil
+}
+
+// GetWorkerLease gets the named lease.
+func (sm *SQLStateManager) GetWorkerLease(ctx context.Context, name string) (WorkerLease, error) {
+	ctx, span := tracing.TraceJob(ctx, "flotilla.state.get_worker_lease", "")
+	defer span.Finish()
+	var lease WorkerLease
+	err := sm.db.GetContext(ctx, &lease, GetWorkerLeaseSQL, name)
+	if err == sql.ErrNoRows {
+		return lease, exceptions.MissingResource{ErrorString: fmt.Sprintf("Worker lease %s not found", name)}
+	}
+	if err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return lease, errors.Wrapf(err, "issue getting worker lease [%s]", name)
+	}
+	return lease, nil
+}
+
+// ReleaseWorkerLease gives up the named lease when the holder has it.
+func (sm *SQLStateManager) ReleaseWorkerLease(ctx context.Context, name string, holder string) error {
+	ctx, span := tracing.TraceJob(ctx, "flotilla.state.release_worker_lease", "")
+	defer span.Finish()
+	if _, err := sm.db.ExecContext(ctx,
+		"DELETE FROM worker_lease WHERE name = $1 AND holder = $2", name, holder); err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return errors.Wrapf(err, "issue releasing worker lease [%s]", name)
+	}
+	return nil
+}
+
 // Cleanup close any open resources
 func (sm *SQLStateManager) Cleanup() error {
 	return multierr.Combine(sm.db.Close(), sm.readonlyDB.Close())
@@ -1489,7 +1872,7 @@ func (r *Run) ValidOrderField(field string) bool {
 }
 
 func (r *Run) ValidOrderFields() []string {
-	return []string{"run_id", "cluster_name", "status", "started_at", "finished_at", "group_name"}
+	return []string{"run_id", "cluster_name", "status", "queued_at", "started_at", "finished_at", "group_name", "array_index"}
 }
 
 func (r *Run) DefaultOrderField() string {
@@ -1580,6 +1963,20 @@ func (e *RunExceptions) Scan(value interface{}) error {
 	return nil
 }
 
+// Value to db
+func (e StructuredExceptions) Value() (driver.Value, error) {
+	res, _ := json.Marshal(e)
+	return res, nil
+}
+
+func (e *StructuredExceptions) Scan(value interface{}) error {
+	if value != nil {
+		s := []byte(value.(string))
+		json.Unmarshal(s, &e)
+	}
+	return nil
+}
+
 // Value to db
 func (e PodEvents) Value() (driver.Value, error) {
 	res, _ := json.Marshal(e)
@@ -1632,7 +2029,7 @@ func (e CloudTrailNotifications) Value() (driver.Value, error) {
 }
 
 // Scan from db
-func (e *ExecutionRequestCustom) Scan(value interface{}) error {
+func (e *ArrayStatus) Scan(value interface{}) error {
 	if value != nil {
 		s := []byte(value.(string))
 		json.Unmarshal(s, &e)
@@ -1641,48 +2038,58 @@ func (e *ExecutionRequestCustom) Scan(value interface{}) error {
 }
 
 // Value to db
-func (e ExecutionRequestCustom) Value() (driver.Value, error) {
+func (e ArrayStatus) Value() (driver.Value, error) {
 	res, _ := json.Marshal(e)
 	return res, nil
 }
 
 // Scan from db
-func (tjs *TemplateJSONSchema) Scan(value interface{}) error {
+func (e *ReplicaPods) Scan(value interface{}) error {
 	if value != nil {
-		s := []byte(value.([]uint8))
-		json.Unmarshal(s, &tjs)
+		s := []byte(value.(string))
+		json.Unmarshal(s, &e)
 	}
 	return nil
 }
 
 // Value to db
-func (tjs TemplateJSONSchema) Value() (driver.Value, error) {
-	res, _ := json.Marshal(tjs)
+func (e ReplicaPods) Value() (driver.Value, error) {
+	res, _ := json.Marshal(e)
 	return res, nil
 }
 
 // Scan from db
-func (tjs *TemplatePayload) Scan(value interface{}) error {
+func (e *Containers) Scan(value interface{}) error {
 	if value != nil {
-		s := []byte(value.([]uint8))
-		json.Unmarshal(s, &tjs)
+		s := []byte(value.(string))
+		json.Unmarshal(s, &e)
 	}
 	return nil
 }
 
 // Value to db
-func (tjs TemplatePayload) Value() (driver.Value, error) {
-	res, _ := json.Marshal(tjs)
+func (e Containers) Value() (driver.Value, error) {
+	res, _ := json.Marshal(e)
 	return res, nil
 }
 
+// Scan from db
+func (e *SharedVolumes) Scan(value interface{}) error {
+	if value != nil {
+		s := []byte(value.(string))
+		json.Unmarshal(s, &e)
+	}
+	return nil
+}
+
 // Value to db
-func (e Labels) Value() (driver.Value, error) {
+func (e SharedVolumes) Value() (driver.Value, error) {
 	res, _ := json.Marshal(e)
 	return res, nil
 }
 
-func (e *Labels) Scan(value interface{}) error {
+// Scan from db
+func (e *Volumes) Scan(value interface{}) error {
 	if value != nil {
 		s := []byte(value.(string))
 		json.Unmarshal(s, &e)
@@ -1690,12 +2097,236 @@ func (e *Labels) Scan(value interface{}) error {
 	return nil
 }
 
-// GetTemplateByID returns a single template by id.
-func (sm *SQLStateManager) GetTemplateByID(ctx context.Context, templateID string) (Template, error) {
-	ctx, span := tracing.TraceJob(ctx, "flotilla.state.get_template_by_id", "")
-	defer span.Finish()
-	var err error
-	var tpl Template
+// Value to db
+func (e Volumes) Value() (driver.Value, error) {
+	res, _ := json.Marshal(e)
+	return res, nil
+}
+
+// Scan from db
+func (e *VolumePolicy) Scan(value interface{}) error {
+	if value != nil {
+		s := []byte(value.(string))
+		json.Unmarshal(s, &e)
+	}
+	return nil
+}
+
+// Value to db
+func (e VolumePolicy) Value() (driver.Value, error) {
+	res, _ := json.Marshal(e)
+	return res, nil
+}
+
+// Scan from db
+func (e *ArtifactManifest) Scan(value interface{}) error {
+	if value != nil {
+		s := []byte(value.(string))
+		json.Unmarshal(s, &e)
+	}
+	return nil
+}
+
+// Value to db
+func (e ArtifactManifest) Value() (driver.Value, error) {
+	res, _ := json.Marshal(e)
+	return res, nil
+}
+
+// Scan from db
+func (e *RunResult) Scan(value interface{}) error {
+	if value != nil {
+		s := []byte(value.(string))
+		json.Unmarshal(s, &e)
+	}
+	return nil
+}
+
+// Value to db
+func (e RunResult) Value() (driver.Value, error) {
+	res, _ := json.Marshal(e)
+	return res, nil
+}
+
+// Scan from db
+func (e *RunAttempts) Scan(value interface{}) error {
+	if value != nil {
+		s := []byte(value.(string))
+		json.Unmarshal(s, &e)
+	}
+	return nil
+}
+
+// Value to db
+func (e RunAttempts) Value() (driver.Value, error) {
+	res, _ := json.Marshal(e)
+	return res, nil
+}
+
+// Scan from db
+func (e *RunEndpoints) Scan(value interface{}) error {
+	if value != nil {
+		s := []byte(value.(string))
+		json.Unmarshal(s, &e)
+	}
+	return nil
+}
+
+// Value to db
+func (e RunEndpoints) Value() (driver.Value, error) {
+	res, _ := json.Marshal(e)
+	return res, nil
+}
+
+// Scan from db
+func (e *RunStop) Scan(value interface{}) error {
+	if value != nil {
+		s := []byte(value.(string))
+		json.Unmarshal(s, &e)
+	}
+	return nil
+}
+
+// Value to db
+func (e RunStop) Value() (driver.Value, error) {
+	res, _ := json.Marshal(e)
+	return res, nil
+}
+
+// Scan from db
+func (e *TemplateDeprecation) Scan(value interface{}) error {
+	if value != nil {
+		s := []byte(value.(string))
+		json.Unmarshal(s, &e)
+	}
+	return nil
+}
+
+// Value to db
+func (e TemplateDeprecation) Value() (driver.Value, error) {
+	res, _ := json.Marshal(e)
+	return res, nil
+}
+
+// Scan from db
+func (e *TemplateUsers) Scan(value interface{}) error {
+	if value != nil {
+		s := []byte(value.(string))
+		json.Unmarshal(s, &e)
+	}
+	return nil
+}
+
+// Scan from db
+func (e *DebugExecs) Scan(value interface{}) error {
+	if value != nil {
+		s := []byte(value.(string))
+		json.Unmarshal(s, &e)
+	}
+	return nil
+}
+
+// Value to db
+func (e DebugExecs) Value() (driver.Value, error) {
+	res, _ := json.Marshal(e)
+	return res, nil
+}
+
+// Scan from db
+func (e *WorkerCounts) Scan(value interface{}) error {
+	if value != nil {
+		s := []byte(value.(string))
+		json.Unmarshal(s, &e)
+	}
+	return nil
+}
+
+// Value to db
+func (e WorkerCounts) Value() (driver.Value, error) {
+	res, _ := json.Marshal(e)
+	return res, nil
+}
+
+// Scan from db
+func (e *SchedulingPolicy) Scan(value interface{}) error {
+	if value != nil {
+		s := []byte(value.(string))
+		json.Unmarshal(s, &e)
+	}
+	return nil
+}
+
+// Value to db
+func (e SchedulingPolicy) Value() (driver.Value, error) {
+	res, _ := json.Marshal(e)
+	return res, nil
+}
+
+// Scan from db
+func (e *ExecutionRequestCustom) Scan(value interface{}) error {
+	if value != nil {
+		s := []byte(value.(string))
+		json.Unmarshal(s, &e)
+	}
+	return nil
+}
+
+// Value to db
+func (e ExecutionRequestCustom) Value() (driver.Value, error) {
+	res, _ := json.Marshal(e)
+	return res, nil
+}
+
+// Scan from db
+func (tjs *TemplateJSONSchema) Scan(value interface{}) error {
+	if value != nil {
+		s := []byte(value.([]uint8))
+		json.Unmarshal(s, &tjs)
+	}
+	return nil
+}
+
+// Value to db
+func (tjs TemplateJSONSchema) Value() (driver.Value, error) {
+	res, _ := json.Marshal(tjs)
+	return res, nil
+}
+
+// Scan from db
+func (tjs *TemplatePayload) Scan(value interface{}) error {
+	if value != nil {
+		s := []byte(value.([]uint8))
+		json.Unmarshal(s, &tjs)
+	}
+	return nil
+}
+
+// Value to db
+func (tjs TemplatePayload) Value() (driver.Value, error) {
+	res, _ := json.Marshal(tjs)
+	return res, nil
+}
+
+// Value to db
+func (e Labels) Value() (driver.Value, error) {
+	res, _ := json.Marshal(e)
+	return res, nil
+}
+
+func (e *Labels) Scan(value interface{}) error {
+	if value != nil {
+		s := []byte(value.(string))
+		json.Unmarshal(s, &e)
+	}
+	return nil
+}
+
+// GetTemplateByID returns a single template by id.
+func (sm *SQLStateManager) GetTemplateByID(ctx context.Context, templateID string) (Template, error) {
+	ctx, span := tracing.TraceJob(ctx, "flotilla.state.get_template_by_id", "")
+	defer span.Finish()
+	var err error
+	var tpl Template
 	err = sm.db.GetContext(ctx, &tpl, GetTemplateByIDSQL, templateID)
 	if err != nil {
 		span.SetTag("error", true)
@@ -1807,41 +2438,342 @@ func (sm *SQLStateManager) CreateTemplate(ctx context.Context, t Template) error
 	ctx, span := tracing.TraceJob(ctx, "flotilla.state.create_template", "")
 	defer span.Finish()
 	var err error
+	tx, err := sm.db.BeginTx(ctx, nil)
+	if err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return errors.WithStack(err)
+	}
+
+	if err = sm.createTemplate(ctx, tx, t); err != nil {
+		tx.Rollback()
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// createTemplate inserts the template within the transaction.
+func (sm *SQLStateManager) createTemplate(ctx context.Context, tx *sql.Tx, t Template) error {
 	insert := `
     INSERT INTO template(
 			template_id, template_name, version, schema, command_template,
-			adaptive_resource_allocation, image, memory, env, cpu, gpu, defaults, avatar_uri
+			adaptive_resource_allocation, image, memory, env, cpu, gpu, defaults, avatar_uri,
+			init_containers, sidecars, shared_volumes, volumes
     )
-    VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15);
+    VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17);
     `
+	if _, err := tx.ExecContext(ctx, insert,
+		t.TemplateID, t.TemplateName, t.Version, t.Schema, t.CommandTemplate,
+		t.AdaptiveResourceAllocation, t.Image, t.Memory, t.Env,
+		t.Cpu, t.Gpu, t.Defaults, t.AvatarURI,
+		t.InitContainers, t.Sidecars, t.SharedVolumes, t.Volumes); err != nil {
+		return errors.Wrapf(
+			err, "issue creating new template with template_name [%s] and version [%d]", t.TemplateName, t.Version)
+	}
+	return nil
+}
+
+// UpdateTemplateDeprecation deprecates a template version, or undeprecates it
+// when deprecation is nil.
+func (sm *SQLStateManager) UpdateTemplateDeprecation(ctx context.Context, templateID string, deprecation *TemplateDeprecation) (Template, error) {
+	ctx, span := tracing.TraceJob(ctx, "flotilla.state.update_template_deprecation", "")
+	defer span.Finish()
+	span.SetTag("template_id", templateID)
+	result, err := sm.db.ExecContext(ctx, "UPDATE template SET deprecation = $2 WHERE template_id = $1", templateID, deprecation)
+	if err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return Template{}, errors.Wrapf(err, "issue updating deprecation of template [%s]", templateID)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return Template{}, exceptions.MissingResource{
+			ErrorString: fmt.Sprintf("Template with ID %s not found", templateID)}
+	}
+	return sm.GetTemplateByID(ctx, templateID)
+}
 
+// ListTemplateChannels lists the channels of a template.
+func (sm *SQLStateManager) ListTemplateChannels(ctx context.Context, templateName string) (TemplateChannelList, error) {
+	ctx, span := tracing.TraceJob(ctx, "flotilla.state.list_template_channels", "")
+	defer span.Finish()
+	var result TemplateChannelList
+	if err := sm.db.SelectContext(ctx, &result.Channels, ListTemplateChannelsSQL, templateName); err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return result, errors.Wrapf(err, "issue listing channels of template [%s]", templateName)
+	}
+	result.Total = len(result.Channels)
+	return result, nil
+}
+
+// GetTemplateChannel gets a channel of a template.
+func (sm *SQLStateManager) GetTemplateChannel(ctx context.Context, templateName string, channel string) (bool, TemplateChannel, error) {
+	ctx, span := tracing.TraceJob(ctx, "flotilla.state.get_template_channel", "")
+	defer span.Finish()
+	var c TemplateChannel
+	err := sm.db.GetContext(ctx, &c, GetTemplateChannelSQL, templateName, channel)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, c, nil
+		}
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return false, c, errors.Wrapf(err, "issue getting channel [%s] of template [%s]", channel, templateName)
+	}
+	return true, c, nil
+}
+
+// SetTemplateChannel points a channel of a template at a version, creating
+// the channel if needed.
+func (sm *SQLStateManager) SetTemplateChannel(ctx context.Context, c TemplateChannel) (TemplateChannel, error) {
+	ctx, span := tracing.TraceJob(ctx, "flotilla.state.set_template_channel", "")
+	defer span.Finish()
+	upsert := `
+	INSERT INTO template_channel(template_name, channel, version, updated_by, updated_at)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (template_name, channel) DO UPDATE SET
+		version = EXCLUDED.version,
+		updated_by = EXCLUDED.updated_by,
+		updated_at = EXCLUDED.updated_at;
+	`
+	if _, err := sm.db.ExecContext(ctx, upsert, c.TemplateName, c.Channel, c.Version, c.UpdatedBy, c.UpdatedAt); err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return c, errors.Wrapf(err, "issue setting channel [%s] of template [%s]", c.Channel, c.TemplateName)
+	}
+	_, c, err := sm.GetTemplateChannel(ctx, c.TemplateName, c.Channel)
+	return c, err
+}
+
+// DeleteTemplateChannel deletes a channel of a template.
+func (sm *SQLStateManager) DeleteTemplateChannel(ctx context.Context, templateName string, channel string) error {
+	ctx, span := tracing.TraceJob(ctx, "flotilla.state.delete_template_channel", "")
+	defer span.Finish()
+	result, err := sm.db.ExecContext(ctx,
+		"DELETE FROM template_channel WHERE template_name = $1 AND channel = $2", templateName, channel)
+	if err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return errors.Wrapf(err, "issue deleting channel [%s] of template [%s]", channel, templateName)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return exceptions.MissingResource{
+			ErrorString: fmt.Sprintf("Channel %s of template %s not found", channel, templateName)}
+	}
+	return nil
+}
+
+// GetTemplateUsage sums up the runs of each version of a template queued
+// since a point in time, most recent version first.
+func (sm *SQLStateManager) GetTemplateUsage(ctx context.Context, templateName string, since time.Time) ([]TemplateVersionUsage, error) {
+	ctx, span := tracing.TraceJob(ctx, "flotilla.state.get_template_usage", "")
+	defer span.Finish()
+	var result []TemplateVersionUsage
+	if err := sm.db.SelectContext(ctx, &result, TemplateUsageSQL, templateName, since); err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return result, errors.Wrapf(err, "issue getting usage of template [%s]", templateName)
+	}
+	return result, nil
+}
+
+// ApplyBundle makes the changes of a bundle in a single transaction.
+func (sm *SQLStateManager) ApplyBundle(ctx context.Context, changes BundleChanges) error {
+	ctx, span := tracing.TraceJob(ctx, "flotilla.state.apply_bundle", "")
+	defer span.Finish()
 	tx, err := sm.db.BeginTx(ctx, nil)
 	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err = sm.applyBundle(ctx, tx, changes); err != nil {
+		tx.Rollback()
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return err
+	}
+	if err = tx.Commit(); err != nil {
 		span.SetTag("error", true)
 		span.SetTag("error.msg", err.Error())
 		return errors.WithStack(err)
 	}
+	return nil
+}
 
-	if _, err = tx.ExecContext(ctx, insert,
-		t.TemplateID, t.TemplateName, t.Version, t.Schema, t.CommandTemplate,
-		t.AdaptiveResourceAllocation, t.Image, t.Memory, t.Env,
-		t.Cpu, t.Gpu, t.Defaults, t.AvatarURI); err != nil {
+func (sm *SQLStateManager) applyBundle(ctx context.Context, tx *sql.Tx, changes BundleChanges) error {
+	for _, d := range changes.CreateDefinitions {
+		if err := sm.createDefinition(tx, d); err != nil {
+			return err
+		}
+	}
+	for _, d := range changes.UpdateDefinitions {
+		if err := sm.updateDefinition(tx, d.DefinitionID, d); err != nil {
+			return err
+		}
+	}
+	for _, definitionID := range changes.DeleteDefinitions {
+		if err := sm.pruneDefinition(ctx, tx, definitionID); err != nil {
+			return err
+		}
+	}
+	for _, t := range changes.CreateTemplates {
+		if err := sm.createTemplate(ctx, tx, t); err != nil {
+			return err
+		}
+	}
+	for templateID, deprecation := range changes.DeprecateTemplates {
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE template SET deprecation = $2 WHERE template_id = $1", templateID, deprecation); err != nil {
+			return errors.Wrapf(err, "issue deprecating template [%s]", templateID)
+		}
+	}
+	return nil
+}
+
+// pruneDefinition deletes a definition pruned from a bundle. Unlike
+// DeleteDefinition it keeps the runs of the definition, and refuses to delete
+// a definition which still has active runs.
+func (sm *SQLStateManager) pruneDefinition(ctx context.Context, tx *sql.Tx, definitionID string) error {
+	var active int
+	if err := tx.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM task WHERE definition_id = $1 AND status = ANY($2)",
+		definitionID, pq.Array(StopStatuses)).Scan(&active); err != nil {
+		return errors.Wrapf(err, "issue counting active runs of definition with id [%s]", definitionID)
+	}
+	if active > 0 {
+		return exceptions.ConflictingResource{
+			ErrorString: fmt.Sprintf("definition with id [%s] has [%d] active runs and can't be pruned", definitionID, active)}
+	}
+	statements := []string{
+		"DELETE FROM task_def_ports WHERE task_def_id = $1",
+		"DELETE FROM task_def_tags WHERE task_def_id = $1",
+		"DELETE FROM task_def WHERE definition_id = $1",
+	}
+	for _, stmt := range statements {
+		if _, err := tx.ExecContext(ctx, stmt, definitionID); err != nil {
+			return errors.Wrapf(err, "issue pruning definition with id [%s]", definitionID)
+		}
+	}
+	return nil
+}
+
+// ListSettings lists the setting overrides.
+func (sm *SQLStateManager) ListSettings(ctx context.Context) ([]Setting, error) {
+	ctx, span := tracing.TraceJob(ctx, "flotilla.state.list_settings", "")
+	defer span.Finish()
+	var settings []Setting
+	if err := sm.db.SelectContext(ctx, &settings, ListSettingsSQL); err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return settings, errors.Wrap(err, "issue listing settings")
+	}
+	return settings, nil
+}
+
+// SetSetting overrides a setting and records the change.
+func (sm *SQLStateManager) SetSetting(ctx context.Context, s Setting, reason string) (Setting, error) {
+	ctx, span := tracing.TraceJob(ctx, "flotilla.state.set_setting", "")
+	defer span.Finish()
+	tx, err := sm.db.BeginTx(ctx, nil)
+	if err != nil {
+		return s, errors.WithStack(err)
+	}
+	var previous sql.NullString
+	err = tx.QueryRowContext(ctx, "SELECT value::TEXT FROM setting WHERE key = $1 FOR UPDATE", s.Key).Scan(&previous)
+	if err != nil && err != sql.ErrNoRows {
+		tx.Rollback()
+		return s, errors.Wrapf(err, "issue getting setting [%s]", s.Key)
+	}
+	upsert := `
+	INSERT INTO setting(key, value, updated_by, updated_at)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (key) DO UPDATE SET
+		value = EXCLUDED.value,
+		updated_by = EXCLUDED.updated_by,
+		updated_at = EXCLUDED.updated_at;
+	`
+	if _, err = tx.ExecContext(ctx, upsert, s.Key, string(s.Value), s.UpdatedBy, s.UpdatedAt); err != nil {
 		tx.Rollback()
 		span.SetTag("error", true)
 		span.SetTag("error.msg", err.Error())
-		return errors.Wrapf(
-			err, "issue creating new template with template_name [%s] and version [%d]", t.TemplateName, t.Version)
+		return s, errors.Wrapf(err, "issue setting [%s]", s.Key)
+	}
+	insertChange := `
+	INSERT INTO setting_change(key, value, previous_value, reason, updated_by, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6);
+	`
+	if _, err = tx.ExecContext(ctx, insertChange, s.Key, string(s.Value), previous, reason, s.UpdatedBy, s.UpdatedAt); err != nil {
+		tx.Rollback()
+		return s, errors.Wrapf(err, "issue recording change of setting [%s]", s.Key)
+	}
+	if err = tx.Commit(); err != nil {
+		return s, errors.WithStack(err)
 	}
+	return s, nil
+}
 
-	err = tx.Commit()
+// DeleteSetting removes the override of a setting and records the change.
+func (sm *SQLStateManager) DeleteSetting(ctx context.Context, key string, user string, reason string) error {
+	ctx, span := tracing.TraceJob(ctx, "flotilla.state.delete_setting", "")
+	defer span.Finish()
+	tx, err := sm.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	var previous string
+	err = tx.QueryRowContext(ctx, "DELETE FROM setting WHERE key = $1 RETURNING value::TEXT", key).Scan(&previous)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return exceptions.MissingResource{ErrorString: fmt.Sprintf("Setting %s is not overridden", key)}
+	}
 	if err != nil {
+		tx.Rollback()
 		span.SetTag("error", true)
 		span.SetTag("error.msg", err.Error())
+		return errors.Wrapf(err, "issue deleting setting [%s]", key)
+	}
+	insertChange := `
+	INSERT INTO setting_change(key, previous_value, reason, updated_by, updated_at)
+	VALUES ($1, $2, $3, $4, $5);
+	`
+	if _, err = tx.ExecContext(ctx, insertChange, key, previous, reason, user, time.Now()); err != nil {
+		tx.Rollback()
+		return errors.Wrapf(err, "issue recording change of setting [%s]", key)
+	}
+	if err = tx.Commit(); err != nil {
 		return errors.WithStack(err)
 	}
 	return nil
 }
 
+// ListSettingChanges lists the changes of a setting, or of all of them when
+// key is empty, most recent first.
+func (sm *SQLStateManager) ListSettingChanges(ctx context.Context, key string, limit int, offset int) (SettingChangeList, error) {
+	ctx, span := tracing.TraceJob(ctx, "flotilla.state.list_setting_changes", "")
+	defer span.Finish()
+	var result SettingChangeList
+	where := "WHERE $1 = '' OR key = $1"
+	listSQL := fmt.Sprintf("%s\n%s ORDER BY id DESC LIMIT $2 OFFSET $3", SettingChangeSelect, where)
+	if err := sm.db.SelectContext(ctx, &result.Changes, listSQL, key, limit, offset); err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return result, errors.Wrap(err, "issue listing setting changes")
+	}
+	countSQL := fmt.Sprintf("SELECT COUNT(*) FROM setting_change %s", where)
+	if err := sm.db.GetContext(ctx, &result.Total, countSQL, key); err != nil {
+		return result, errors.Wrap(err, "issue counting setting changes")
+	}
+	return result, nil
+}
+
 // GetExecutableByExecutableType returns a single executable by id.
 func (sm *SQLStateManager) GetExecutableByTypeAndID(ctx context.Context, t ExecutableType, id string) (Executable, error) {
 	ctx, span := tracing.TraceJob(ctx, "flotilla.state.get_executable_by_type_and_id", "")
@@ -1862,6 +2794,20 @@ func (sm *SQLStateManager) GetExecutableByTypeAndID(ctx context.Context, t Execu
 	}
 }
 
+// emitRunFinished counts finished runs tagged with their failure category.
+func (sm *SQLStateManager) emitRunFinished(run Run) {
+	tags := []string{
+		string(metrics.StatusSuccess),
+		fmt.Sprintf("cluster:%s", run.ClusterName),
+		fmt.Sprintf("tier:%s", run.Tier),
+	}
+	if run.FailureCategory != nil {
+		tags[0] = string(metrics.StatusFailure)
+		tags = append(tags, fmt.Sprintf("failure_category:%s", *run.FailureCategory))
+	}
+	_ = metrics.Increment(metrics.RunFinished, tags, 1)
+}
+
 func (sm *SQLStateManager) logStatusUpdate(update Run) {
 	var err error
 	var startedAt, finishedAt time.Time
@@ -1908,7 +2854,8 @@ func (sm *SQLStateManager) logStatusUpdate(update Run) {
 			"env", env,
 			"executable_id", update.ExecutableID,
 			"executable_type", update.ExecutableType,
-			"Tier", update.Tier)
+			"Tier", update.Tier,
+			"failure_category", update.FailureCategory)
 	} else {
 		err = sm.log.Event("eventClassName", "FlotillaTaskStatus",
 			"run_id", update.RunID,
@@ -1929,7 +2876,8 @@ func (sm *SQLStateManager) logStatusUpdate(update Run) {
 			"env", env,
 			"executable_id", update.ExecutableID,
 			"executable_type", update.ExecutableType,
-			"Tier", update.Tier)
+			"Tier", update.Tier,
+			"failure_category", update.FailureCategory)
 	}
 
 	if err != nil {
@@ -1971,8 +2919,8 @@ func (sm *SQLStateManager) UpdateClusterMetadata(ctx context.Context, cluster Cl
 
 	if cluster.ID == "" {
 		sql := `
-			INSERT INTO cluster_state (name, cluster_version, status, status_reason, allowed_tiers, capabilities, namespace, region, emr_virtual_cluster, spark_server_uri)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			INSERT INTO cluster_state (name, cluster_version, status, status_reason, allowed_tiers, capabilities, namespace, region, emr_virtual_cluster, spark_server_uri, scheduling_policy, volume_policy)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 			RETURNING id;
 		`
 		var id string
@@ -1986,7 +2934,9 @@ func (sm *SQLStateManager) UpdateClusterMetadata(ctx context.Context, cluster Cl
 			cluster.Namespace,
 			cluster.Region,
 			cluster.EMRVirtualCluster,
-			cluster.SparkServerURI).Scan(&id)
+			cluster.SparkServerURI,
+			cluster.SchedulingPolicy,
+			cluster.VolumePolicy).Scan(&id)
 
 		if err != nil {
 			span.SetTag("error", true)
@@ -2008,6 +2958,8 @@ func (sm *SQLStateManager) UpdateClusterMetadata(ctx context.Context, cluster Cl
 				region = $9,
 				emr_virtual_cluster = $10,
 				spark_server_uri = $11,
+				scheduling_policy = $12,
+				volume_policy = $13,
 				updated_at = NOW()
 			WHERE id = $1;
 		`
@@ -2022,7 +2974,9 @@ func (sm *SQLStateManager) UpdateClusterMetadata(ctx context.Context, cluster Cl
 			cluster.Namespace,
 			cluster.Region,
 			cluster.EMRVirtualCluster,
-			cluster.SparkServerURI)
+			cluster.SparkServerURI,
+			cluster.SchedulingPolicy,
+			cluster.VolumePolicy)
 
 		if err != nil {
 			span.SetTag("error", true)
@@ -2085,7 +3039,9 @@ func (sm *SQLStateManager) GetClusterByID(ctx context.Context, clusterID string)
 	query := `
 		SELECT 
 			id, name, status, status_reason, status_since, allowed_tiers,
-			capabilities, region, updated_at, namespace, emr_virtual_cluster, spark_server_uri
+			capabilities, region, updated_at, namespace, emr_virtual_cluster, spark_server_uri,
+			scheduling_policy::TEXT as scheduling_policy,
+			volume_policy::TEXT as volume_policy
 		FROM cluster_state 
 		WHERE id = $1
 	`
@@ -2301,3 +3257,102 @@ func (sm *SQLStateManager) GetRunStatus(ctx context.Context, runID string) (RunS
 
 	return status, nil
 }
+
+// CreateDebugSession records a new debug session
+func (sm *SQLStateManager) CreateDebugSession(ctx context.Context, s DebugSession) error {
+	ctx, span := tracing.TraceJob(ctx, "flotilla.state.create_debug_session", s.RunID)
+	defer span.Finish()
+	insert := `
+	INSERT INTO debug_session(
+		session_id, run_id, mode, user_name, cluster_name, namespace, job_name,
+		pod_name, container, image, created_at, expires_at, execs
+	)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13);
+	`
+	if _, err := sm.db.ExecContext(ctx, insert,
+		s.SessionID, s.RunID, s.Mode, s.User, s.ClusterName, s.Namespace, s.JobName,
+		s.PodName, s.Container, s.Image, s.CreatedAt, s.ExpiresAt, s.Execs); err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return errors.Wrapf(err, "issue creating debug session [%s]", s.SessionID)
+	}
+	return nil
+}
+
+// GetDebugSession gets a debug session by id
+func (sm *SQLStateManager) GetDebugSession(ctx context.Context, sessionID string) (DebugSession, error) {
+	ctx, span := tracing.TraceJob(ctx, "flotilla.state.get_debug_session", "")
+	defer span.Finish()
+	var s DebugSession
+	err := sm.db.GetContext(ctx, &s, GetDebugSessionSQL, sessionID)
+	if err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		if err == sql.ErrNoRows {
+			return s, exceptions.MissingResource{
+				ErrorString: fmt.Sprintf("Debug session with ID %s not found", sessionID)}
+		}
+		return s, errors.Wrapf(err, "issue getting debug session with id [%s]", sessionID)
+	}
+	return s, nil
+}
+
+// ListDebugSessions lists the debug sessions of a run, newest first
+func (sm *SQLStateManager) ListDebugSessions(ctx context.Context, runID string) (DebugSessionList, error) {
+	ctx, span := tracing.TraceJob(ctx, "flotilla.state.list_debug_sessions", runID)
+	defer span.Finish()
+	var result DebugSessionList
+	if err := sm.db.SelectContext(ctx, &result.Sessions, ListDebugSessionsSQL, runID); err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return result, errors.Wrapf(err, "issue listing debug sessions of run [%s]", runID)
+	}
+	result.Total = len(result.Sessions)
+	return result, nil
+}
+
+// UpdateDebugSession updates a debug session, appending to its execs
+func (sm *SQLStateManager) UpdateDebugSession(ctx context.Context, sessionID string, updates DebugSession) (DebugSession, error) {
+	ctx, span := tracing.TraceJob(ctx, "flotilla.state.update_debug_session", "")
+	defer span.Finish()
+	var existing DebugSession
+
+	tx, err := sm.db.BeginTxx(ctx, nil)
+	if err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return existing, errors.WithStack(err)
+	}
+
+	if err = tx.GetContext(ctx, &existing, GetDebugSessionSQLForUpdate, sessionID); err != nil {
+		tx.Rollback()
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		if err == sql.ErrNoRows {
+			return existing, exceptions.MissingResource{
+				ErrorString: fmt.Sprintf("Debug session with ID %s not found", sessionID)}
+		}
+		return existing, errors.WithStack(err)
+	}
+
+	existing.UpdateWith(updates)
+
+	update := `
+	UPDATE debug_session SET pod_name = $2, terminated_at = $3, terminated_by = $4, execs = $5
+	WHERE session_id = $1;
+	`
+	if _, err = tx.ExecContext(ctx, update,
+		sessionID, existing.PodName, existing.TerminatedAt, existing.TerminatedBy, existing.Execs); err != nil {
+		tx.Rollback()
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return existing, errors.WithStack(err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return existing, errors.WithStack(err)
+	}
+	return existing, nil
+}
@@ -410,6 +410,26 @@ func TestSQLStateManager_ListRuns(t *testing.T) {
 			`Expected environment variable filters (E2:V2) to yield
             run run2, but was %s`, rl.Runs[0].RunID)
 	}
+
+	// Test filtering on labels whose value is quoted
+	rl, err = sm.ListRuns(ctx, 10, 0, "started_at", "asc", map[string][]string{"label": {`team|data'); drop table task; --"`}}, nil, nil)
+	if err != nil {
+		t.Error(err.Error())
+	}
+	if rl.Total != 0 {
+		t.Errorf("Expected no runs with the quoted label but was %v", rl.Total)
+	}
+}
+
+func TestSQLStateManager_makeWhereClauseLabels(t *testing.T) {
+	sm := &SQLStateManager{}
+	where, args := sm.makeWhereClause(map[string][]string{"label": {`team|o'brien"}`, "invalid"}})
+	if len(where) != 1 || where[0] != "labels @> $3::jsonb" {
+		t.Fatalf("Expected a single bound label condition but was %v", where)
+	}
+	if len(args) != 1 || args[0] != `{"team":"o'brien\"}"}` {
+		t.Errorf("Expected the label to be bound as json but was %v", args)
+	}
 }
 
 func TestSQLStateManager_ListRuns2(t *testing.T) {
@@ -688,6 +708,42 @@ func TestSQLStateManager_UpdateRun(t *testing.T) {
 	}
 }
 
+func TestSQLStateManager_GetRunLatencyStatsResubmitted(t *testing.T) {
+	defer tearDown()
+	sm := setUp()
+	conf, _ := config.NewConfig(nil)
+	db := getDB(conf)
+
+	// Resubmitted 10 minutes ago, after pending, running and starting earlier.
+	now := time.Now().UTC()
+	db.MustExec(`
+	INSERT INTO task (run_id, definition_id, cluster_name, status, engine, tier, queued_at, pending_at, running_at, started_at)
+	VALUES ('resubmitted', 'A', 'resubmits', $1, 'eks', 4, $2, $3, $4, $4)
+	`, StatusNeedsRetry, now.Add(-10*time.Minute), now.Add(-55*time.Minute), now.Add(-50*time.Minute))
+
+	stats, err := sm.GetRunLatencyStats(ctx, RunLatencyQuery{
+		GroupBy: RunDimensionCluster,
+		Since:   now.Add(-time.Hour),
+		Until:   now.Add(time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range stats {
+		if s.Value != "resubmits" {
+			continue
+		}
+		if s.Runs != 1 || s.Started != 0 {
+			t.Errorf("expected a queued run which didn't start yet, got %+v", s)
+		}
+		if s.QueueWait.P50 != nil || s.Pending.P50 != nil || s.Runtime.P50 != nil {
+			t.Errorf("expected the times of the previous attempt to be left out, got %+v", s)
+		}
+		return
+	}
+	t.Errorf("expected the stats of the resubmitted run, got %+v", stats)
+}
+
 func TestSQLStateManager_UpdateWorker(t *testing.T) {
 	defer tearDown()
 	sm := setUp()
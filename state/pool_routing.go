@@ -8,23 +8,8 @@ type PoolRouting struct {
 	Tolerations       []corev1.Toleration
 }
 
+// SharedPoolRouting routes a pool size to the shared pools of the default
+// scheduling policy.
 func SharedPoolRouting(size string) PoolRouting {
-	pool := "standard"
-	switch size {
-	case "l":
-		pool = "large"
-	case "xl":
-		pool = "xl"
-	}
-
-	return PoolRouting{
-		RequiredAffinity: &corev1.NodeSelectorRequirement{
-			Key:      "flotilla-pool",
-			Operator: corev1.NodeSelectorOpIn,
-			Values:   []string{pool},
-		},
-		Tolerations: []corev1.Toleration{
-			{Key: "flotilla-pool", Operator: "Equal", Value: pool, Effect: "NoSchedule"},
-		},
-	}
+	return DefaultSchedulingPolicy().SharedPoolRouting(size)
 }
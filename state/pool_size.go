@@ -1,14 +1,7 @@
 package state
 
+// PoolSize buckets cpu (millicores) and memory (MiB) in the pool sizes of the
+// default scheduling policy.
 func PoolSize(cpuMillis, memoryMiB int64) string {
-	switch {
-	case cpuMillis >= 30000 || memoryMiB >= 234000:
-		return "xl"
-	case cpuMillis >= 14000 || memoryMiB >= 100000:
-		return "l"
-	case cpuMillis >= 3000 || memoryMiB >= 24000:
-		return "m"
-	default:
-		return "s"
-	}
+	return DefaultSchedulingPolicy().PoolSize(cpuMillis, memoryMiB)
 }
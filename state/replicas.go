@@ -0,0 +1,82 @@
+package state
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Environment variables injected into each pod of a replicated run, following
+// the torch.distributed env:// conventions.
+var (
+	ReplicaRankVar       = "RANK"
+	ReplicaWorldSizeVar  = "WORLD_SIZE"
+	ReplicaMasterAddrVar = "MASTER_ADDR"
+	ReplicaMasterPortVar = "MASTER_PORT"
+)
+
+// ReplicaPod is the status of one pod of a replicated run.
+type ReplicaPod struct {
+	Index           int64   `json:"index"`
+	PodName         string  `json:"pod_name"`
+	Phase           string  `json:"phase"`
+	ExitCode        *int64  `json:"exit_code,omitempty"`
+	ExitReason      *string `json:"exit_reason,omitempty"`
+	InstanceDNSName string  `json:"instance_dns_name,omitempty"`
+}
+
+// ReplicaPods are the pods of a replicated run, one per index.
+type ReplicaPods []ReplicaPod
+
+// ReplicaCount returns the number of pods the run is made of.
+func (d Run) ReplicaCount() int64 {
+	if d.Replicas == nil || *d.Replicas < 1 {
+		return 1
+	}
+	return *d.Replicas
+}
+
+// IsReplicated checks whether the run is a multi-pod run.
+func (d Run) IsReplicated() bool {
+	return d.ReplicaCount() > 1
+}
+
+// ForReplica returns the run as seen from the pod of the given index, for
+// fetching the logs and events of that pod.
+func (d Run) ForReplica(index int64) (Run, error) {
+	if index < 0 || index >= d.ReplicaCount() {
+		return d, fmt.Errorf("run [%s] has no replica [%d]", d.RunID, index)
+	}
+	if d.ReplicaPods != nil {
+		for _, pod := range *d.ReplicaPods {
+			if pod.Index == index {
+				d.PodName = &pod.PodName
+				d.InstanceDNSName = pod.InstanceDNSName
+				return d, nil
+			}
+		}
+	}
+	if index == 0 && !d.IsReplicated() {
+		return d, nil
+	}
+	return d, fmt.Errorf("replica [%d] of run [%s] has no pod yet", index, d.RunID)
+}
+
+// MergeReplicaPods merges newly observed pods into the known ones, keeping
+// the most recent pod of each index, and returns them ordered by index.
+func MergeReplicaPods(known *ReplicaPods, observed ReplicaPods) ReplicaPods {
+	byIndex := map[int64]ReplicaPod{}
+	if known != nil {
+		for _, pod := range *known {
+			byIndex[pod.Index] = pod
+		}
+	}
+	for _, pod := range observed {
+		byIndex[pod.Index] = pod
+	}
+	merged := make(ReplicaPods, 0, len(byIndex))
+	for _, pod := range byIndex {
+		merged = append(merged, pod)
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Index < merged[j].Index })
+	return merged
+}
@@ -0,0 +1,29 @@
+package state
+
+import "testing"
+
+func TestRun_ForReplica(t *testing.T) {
+	replicas := int64(2)
+	pods := MergeReplicaPods(&ReplicaPods{{Index: 1, PodName: "run-1-old"}}, ReplicaPods{
+		{Index: 1, PodName: "run-1-new", InstanceDNSName: "node-b"},
+		{Index: 0, PodName: "run-0"},
+	})
+	if len(pods) != 2 || pods[0].PodName != "run-0" || pods[1].PodName != "run-1-new" {
+		t.Fatalf("unexpected merged pods %+v", pods)
+	}
+	run := Run{RunID: "run", Replicas: &replicas, ReplicaPods: &pods}
+
+	replica, err := run.ForReplica(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *replica.PodName != "run-1-new" || replica.InstanceDNSName != "node-b" {
+		t.Errorf("expected replica 1's pod, got %s on %s", *replica.PodName, replica.InstanceDNSName)
+	}
+	if _, err := run.ForReplica(2); err == nil {
+		t.Errorf("expected an error for a replica out of range")
+	}
+	if _, err := (Run{RunID: "single"}).ForReplica(0); err != nil {
+		t.Errorf("expected replica 0 of a single pod run to be the run itself")
+	}
+}
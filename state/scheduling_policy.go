@@ -0,0 +1,152 @@
+package state
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SchedulingPolicy describes how runs are placed on the nodes of a cluster:
+// the node labels flotilla selects on, how runs are bucketed in pool sizes
+// and any extra affinity terms, tolerations and topology spread the cluster
+// needs. It is stored per cluster alongside the ClusterMetadata, fields left
+// empty fall back to DefaultSchedulingPolicy.
+type SchedulingPolicy struct {
+	// CapacityTypeKey is the node label holding the spot/on-demand lifecycle.
+	CapacityTypeKey string `json:"capacity_type_key,omitempty"`
+	// ArchKey is the node label holding the cpu architecture.
+	ArchKey string `json:"arch_key,omitempty"`
+	// TeamKey is the node label dedicated team nodes are labelled with.
+	TeamKey string `json:"team_key,omitempty"`
+	// PoolKey is the node label (and taint) of sized and shared pools.
+	PoolKey string `json:"pool_key,omitempty"`
+	// PoolSizes are checked in order, a run gets the first size whose cpu or
+	// memory threshold it reaches and the last size otherwise.
+	PoolSizes []PoolSizeThreshold `json:"pool_sizes,omitempty"`
+	// SharedPools maps pool sizes to the shared pool serving them, sizes
+	// missing from the map go to DefaultSharedPool.
+	SharedPools       map[string]string `json:"shared_pools,omitempty"`
+	DefaultSharedPool string            `json:"default_shared_pool,omitempty"`
+
+	RequiredTerms  []corev1.NodeSelectorRequirement `json:"required_terms,omitempty"`
+	PreferredTerms []corev1.PreferredSchedulingTerm `json:"preferred_terms,omitempty"`
+	Tolerations    []corev1.Toleration              `json:"tolerations,omitempty"`
+	// TopologySpread constraints without a label selector spread the pods
+	// of the run they are applied to.
+	TopologySpread []corev1.TopologySpreadConstraint `json:"topology_spread,omitempty"`
+	// GangLabelKey is the label naming the pod group of replicated runs, for
+	// gang schedulers placing all the pods of a run at once.
+	GangLabelKey string `json:"gang_label_key,omitempty"`
+}
+
+// PoolSizeThreshold is the minimum cpu (millicores) or memory (MiB) of a
+// run for it to be placed in the named pool size. A threshold of 0 is unset,
+// a size without any threshold only serves as the last, catch-all, size.
+type PoolSizeThreshold struct {
+	Name      string `json:"name"`
+	MinCPU    int64  `json:"min_cpu"`
+	MinMemory int64  `json:"min_memory"`
+}
+
+// DefaultSchedulingPolicy is the placement used by clusters without a
+// scheduling policy of their own.
+func DefaultSchedulingPolicy() SchedulingPolicy {
+	return SchedulingPolicy{
+		CapacityTypeKey: "karpenter.sh/capacity-type",
+		ArchKey:         "kubernetes.io/arch",
+		TeamKey:         "team",
+		PoolKey:         "flotilla-pool",
+		PoolSizes: []PoolSizeThreshold{
+			{Name: "xl", MinCPU: 30000, MinMemory: 234000},
+			{Name: "l", MinCPU: 14000, MinMemory: 100000},
+			{Name: "m", MinCPU: 3000, MinMemory: 24000},
+			{Name: "s"},
+		},
+		SharedPools:       map[string]string{"l": "large", "xl": "xl"},
+		DefaultSharedPool: "standard",
+	}
+}
+
+// WithDefaults fills the unset fields of the policy from the default policy.
+func (p SchedulingPolicy) WithDefaults() SchedulingPolicy {
+	d := DefaultSchedulingPolicy()
+	if p.CapacityTypeKey == "" {
+		p.CapacityTypeKey = d.CapacityTypeKey
+	}
+	if p.ArchKey == "" {
+		p.ArchKey = d.ArchKey
+	}
+	if p.TeamKey == "" {
+		p.TeamKey = d.TeamKey
+	}
+	if p.PoolKey == "" {
+		p.PoolKey = d.PoolKey
+	}
+	if len(p.PoolSizes) == 0 {
+		p.PoolSizes = d.PoolSizes
+	}
+	if len(p.SharedPools) == 0 {
+		p.SharedPools = d.SharedPools
+	}
+	if p.DefaultSharedPool == "" {
+		p.DefaultSharedPool = d.DefaultSharedPool
+	}
+	return p
+}
+
+// PoolSize buckets a run's cpu (millicores) and memory (MiB) in a pool size.
+func (p SchedulingPolicy) PoolSize(cpuMillis, memoryMiB int64) string {
+	for _, size := range p.PoolSizes {
+		if (size.MinCPU > 0 && cpuMillis >= size.MinCPU) ||
+			(size.MinMemory > 0 && memoryMiB >= size.MinMemory) {
+			return size.Name
+		}
+	}
+	if len(p.PoolSizes) == 0 {
+		return ""
+	}
+	return p.PoolSizes[len(p.PoolSizes)-1].Name
+}
+
+// SharedPoolRouting returns the affinity and tolerations placing runs of the
+// given pool size on the shared pool serving it.
+func (p SchedulingPolicy) SharedPoolRouting(size string) PoolRouting {
+	pool, ok := p.SharedPools[size]
+	if !ok {
+		pool = p.DefaultSharedPool
+	}
+
+	return PoolRouting{
+		RequiredAffinity: &corev1.NodeSelectorRequirement{
+			Key:      p.PoolKey,
+			Operator: corev1.NodeSelectorOpIn,
+			Values:   []string{pool},
+		},
+		Tolerations: []corev1.Toleration{
+			{Key: p.PoolKey, Operator: "Equal", Value: pool, Effect: "NoSchedule"},
+		},
+	}
+}
+
+// TopologySpreadConstraints returns the policy's topology spread constraints
+// for a run, selecting the pods of the run where no selector was given.
+func (p SchedulingPolicy) TopologySpreadConstraints(runID string) []corev1.TopologySpreadConstraint {
+	var constraints []corev1.TopologySpreadConstraint
+	for _, c := range p.TopologySpread {
+		if c.LabelSelector == nil {
+			c.LabelSelector = &metav1.LabelSelector{
+				MatchLabels: map[string]string{"flotilla-run-id": SanitizeLabel(runID)},
+			}
+		}
+		constraints = append(constraints, c)
+	}
+	return constraints
+}
+
+// Scheduling returns the cluster's scheduling policy with unset fields
+// taken from the default policy.
+func (c ClusterMetadata) Scheduling() SchedulingPolicy {
+	if c.SchedulingPolicy == nil {
+		return DefaultSchedulingPolicy()
+	}
+	return c.SchedulingPolicy.WithDefaults()
+}
@@ -0,0 +1,85 @@
+package state
+
+import (
+	"encoding/json"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestSchedulingPolicy_DefaultPoolSize(t *testing.T) {
+	policy := DefaultSchedulingPolicy()
+	cases := []struct {
+		cpu, mem int64
+		expected string
+	}{
+		{1000, 2000, "s"},
+		{3000, 2000, "m"},
+		{1000, 100000, "l"},
+		{30000, 2000, "xl"},
+	}
+	for _, c := range cases {
+		if size := policy.PoolSize(c.cpu, c.mem); size != c.expected {
+			t.Errorf("PoolSize(%d, %d) = %s, want %s", c.cpu, c.mem, size, c.expected)
+		}
+		if size := PoolSize(c.cpu, c.mem); size != c.expected {
+			t.Errorf("state.PoolSize(%d, %d) = %s, want %s", c.cpu, c.mem, size, c.expected)
+		}
+	}
+}
+
+func TestSchedulingPolicy_Overrides(t *testing.T) {
+	var stored SchedulingPolicy
+	err := json.Unmarshal([]byte(`{
+		"pool_key": "node-pool",
+		"pool_sizes": [{"name": "big", "min_cpu": 8000, "min_memory": 64000}, {"name": "mem", "min_memory": 32000}, {"name": "small"}],
+		"shared_pools": {"big": "shared-big"},
+		"tolerations": [{"key": "dedicated", "operator": "Exists", "effect": "NoSchedule"}]
+	}`), &stored)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	cluster := ClusterMetadata{SchedulingPolicy: &stored}
+	policy := cluster.Scheduling()
+
+	if policy.ArchKey != "kubernetes.io/arch" || policy.CapacityTypeKey != "karpenter.sh/capacity-type" {
+		t.Errorf("expected unset label keys to default, got %s and %s", policy.ArchKey, policy.CapacityTypeKey)
+	}
+	if size := policy.PoolSize(8000, 1000); size != "big" {
+		t.Errorf("expected big, got %s", size)
+	}
+	if size := policy.PoolSize(1000, 1000); size != "small" {
+		t.Errorf("expected small, got %s", size)
+	}
+	if size := policy.PoolSize(4000, 32000); size != "mem" {
+		t.Errorf("expected mem, got %s", size)
+	}
+
+	routing := policy.SharedPoolRouting("big")
+	if routing.RequiredAffinity.Key != "node-pool" || routing.RequiredAffinity.Values[0] != "shared-big" {
+		t.Errorf("unexpected routing for big %+v", routing.RequiredAffinity)
+	}
+	routing = policy.SharedPoolRouting("small")
+	if routing.RequiredAffinity.Values[0] != "standard" {
+		t.Errorf("expected unmapped size to go to the default shared pool, got %v", routing.RequiredAffinity.Values)
+	}
+	if len(policy.Tolerations) != 1 || policy.Tolerations[0].Key != "dedicated" {
+		t.Errorf("unexpected tolerations %+v", policy.Tolerations)
+	}
+}
+
+func TestSchedulingPolicy_TopologySpreadConstraints(t *testing.T) {
+	policy := SchedulingPolicy{TopologySpread: []corev1.TopologySpreadConstraint{
+		{MaxSkew: 1, TopologyKey: "topology.kubernetes.io/zone", WhenUnsatisfiable: corev1.ScheduleAnyway},
+	}}
+	constraints := policy.TopologySpreadConstraints("run-1")
+	if len(constraints) != 1 {
+		t.Fatalf("expected 1 constraint, got %d", len(constraints))
+	}
+	if constraints[0].LabelSelector == nil || constraints[0].LabelSelector.MatchLabels["flotilla-run-id"] != "run-1" {
+		t.Errorf("expected constraint to select the pods of the run, got %+v", constraints[0].LabelSelector)
+	}
+	if policy.TopologySpread[0].LabelSelector != nil {
+		t.Errorf("expected the policy itself to be left untouched")
+	}
+}
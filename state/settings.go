@@ -0,0 +1,411 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/stitchfix/flotilla-os/config"
+	"github.com/stitchfix/flotilla-os/log"
+)
+
+// Keys of the settings which can be changed at runtime. They're named after
+// the configuration keys which set their defaults.
+const (
+	SettingSpotReattemptOverride = "eks_spot_reattempt_override"
+	SettingSpotOverride          = "eks_spot_override"
+	SettingSpotThresholdMinutes  = "eks_spot_threshold_minutes"
+	SettingClusterDefault        = "eks_cluster_default"
+	SettingGPUClusterDefault     = "eks_gpu_cluster_default"
+	SettingTierDefault           = "eks_tier_default"
+	SettingJobARAEnabled         = "eks_job_ara_enabled"
+)
+
+// SettingType is the type of the value of a setting.
+type SettingType string
+
+const (
+	SettingTypeBool   SettingType = "bool"
+	SettingTypeInt    SettingType = "int"
+	SettingTypeFloat  SettingType = "float"
+	SettingTypeString SettingType = "string"
+)
+
+// SettingSpec describes a setting which can be changed at runtime.
+type SettingSpec struct {
+	Key         string      `json:"key"`
+	Type        SettingType `json:"type"`
+	Description string      `json:"description"`
+	// Default is the value of the setting when neither the configuration nor
+	// an override sets it.
+	Default  interface{} `json:"-"`
+	validate func(v interface{}) error
+}
+
+var settingSpecs = []SettingSpec{
+	{
+		Key:         SettingSpotReattemptOverride,
+		Type:        SettingTypeFloat,
+		Description: "rate of pod reattempts above which eks runs are moved from spot to on demand nodes",
+		Default:     0.05,
+		validate:    settingRange(0, 1),
+	},
+	{
+		Key:         SettingSpotOverride,
+		Type:        SettingTypeBool,
+		Description: "runs every eks run on on demand nodes",
+		Default:     false,
+	},
+	{
+		Key:         SettingSpotThresholdMinutes,
+		Type:        SettingTypeFloat,
+		Description: "historical runtime, in minutes, above which runs are moved from spot to on demand nodes",
+		Default:     30.0,
+		validate:    settingRange(0, math.MaxFloat64),
+	},
+	{
+		Key:         SettingClusterDefault,
+		Type:        SettingTypeString,
+		Description: "cluster of runs which don't pick one",
+		Default:     "",
+		validate:    settingNotEmpty,
+	},
+	{
+		Key:         SettingGPUClusterDefault,
+		Type:        SettingTypeString,
+		Description: "cluster of gpu runs which don't pick one",
+		Default:     "",
+		validate:    settingNotEmpty,
+	},
+	{
+		Key:         SettingTierDefault,
+		Type:        SettingTypeString,
+		Description: "tier of runs which don't pick one",
+		Default:     "",
+		validate:    settingNotEmpty,
+	},
+	{
+		Key:         SettingJobARAEnabled,
+		Type:        SettingTypeBool,
+		Description: "sizes eks runs with adaptive resource allocation",
+		Default:     true,
+	},
+}
+
+func settingRange(min float64, max float64) func(v interface{}) error {
+	return func(v interface{}) error {
+		if f := v.(float64); f < min || f > max {
+			return fmt.Errorf("must be between %v and %v", min, max)
+		}
+		return nil
+	}
+}
+
+func settingNotEmpty(v interface{}) error {
+	if len(v.(string)) == 0 {
+		return fmt.Errorf("must not be empty")
+	}
+	return nil
+}
+
+// SettingSpecs lists the settings which can be changed at runtime, by key.
+func SettingSpecs() []SettingSpec {
+	specs := append([]SettingSpec{}, settingSpecs...)
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Key < specs[j].Key })
+	return specs
+}
+
+// GetSettingSpec returns the spec of the setting.
+func GetSettingSpec(key string) (SettingSpec, bool) {
+	for _, spec := range settingSpecs {
+		if spec.Key == key {
+			return spec, true
+		}
+	}
+	return SettingSpec{}, false
+}
+
+// Parse converts the value, as decoded from JSON, to the type of the setting
+// and validates it.
+func (s SettingSpec) Parse(v interface{}) (interface{}, error) {
+	var parsed interface{}
+	switch s.Type {
+	case SettingTypeBool:
+		if b, ok := v.(bool); ok {
+			parsed = b
+		}
+	case SettingTypeInt:
+		switch n := v.(type) {
+		case int:
+			parsed = n
+		case int64:
+			parsed = int(n)
+		case float64:
+			if n == math.Trunc(n) {
+				parsed = int(n)
+			}
+		}
+	case SettingTypeFloat:
+		switch n := v.(type) {
+		case int:
+			parsed = float64(n)
+		case int64:
+			parsed = float64(n)
+		case float64:
+			parsed = n
+		}
+	case SettingTypeString:
+		if str, ok := v.(string); ok {
+			parsed = str
+		}
+	}
+	if parsed == nil {
+		return nil, fmt.Errorf("setting [%s] must be of type [%s]", s.Key, s.Type)
+	}
+	if s.validate != nil {
+		if err := s.validate(parsed); err != nil {
+			return nil, fmt.Errorf("setting [%s] %s", s.Key, err)
+		}
+	}
+	return parsed, nil
+}
+
+// ParseJSON decodes and parses the JSON encoded value.
+func (s SettingSpec) ParseJSON(raw json.RawMessage) (interface{}, error) {
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, fmt.Errorf("setting [%s] must be JSON: %s", s.Key, err)
+	}
+	return s.Parse(v)
+}
+
+// Setting overrides the value of a setting at runtime.
+type Setting struct {
+	Key       string          `json:"key" db:"key"`
+	Value     json.RawMessage `json:"value" db:"value"`
+	UpdatedBy string          `json:"updated_by" db:"updated_by"`
+	UpdatedAt time.Time       `json:"updated_at" db:"updated_at"`
+}
+
+// SettingRequest is the body of requests overriding a setting.
+type SettingRequest struct {
+	Value  json.RawMessage `json:"value"`
+	Reason string          `json:"reason"`
+}
+
+// SettingChange is a change of the override of a setting. Value is empty when
+// the override was removed.
+type SettingChange struct {
+	ID            int64           `json:"id" db:"id"`
+	Key           string          `json:"key" db:"key"`
+	Value         json.RawMessage `json:"value,omitempty" db:"value"`
+	PreviousValue json.RawMessage `json:"previous_value,omitempty" db:"previous_value"`
+	Reason        string          `json:"reason,omitempty" db:"reason"`
+	UpdatedBy     string          `json:"updated_by" db:"updated_by"`
+	UpdatedAt     time.Time       `json:"updated_at" db:"updated_at"`
+}
+
+// SettingChangeList wraps a list of setting changes.
+type SettingChangeList struct {
+	Total   int             `json:"total"`
+	Changes []SettingChange `json:"changes"`
+}
+
+// SettingStatus is the current value of a setting.
+type SettingStatus struct {
+	SettingSpec
+	Value interface{} `json:"value"`
+	// Default is the value of the setting without override, from the
+	// configuration or built in.
+	Default    interface{} `json:"default"`
+	Overridden bool        `json:"overridden"`
+	UpdatedBy  string      `json:"updated_by,omitempty"`
+	UpdatedAt  *time.Time  `json:"updated_at,omitempty"`
+}
+
+// SettingStatusList wraps a list of setting statuses.
+type SettingStatusList struct {
+	Total    int             `json:"total"`
+	Settings []SettingStatus `json:"settings"`
+}
+
+// Settings holds the values of the settings which can be changed at runtime:
+// the overrides stored by the state manager over the configuration. Refresh
+// reloads the overrides and notifies the subscribers of the settings whose
+// value changed.
+type Settings struct {
+	sm          Manager
+	logger      log.Logger
+	mu          sync.RWMutex
+	defaults    map[string]interface{}
+	overrides   map[string]Setting
+	values      map[string]interface{}
+	subscribers map[string][]func(v interface{})
+}
+
+// NewSettings initializes the settings with their defaults from the
+// configuration. Overrides are loaded by Refresh.
+func NewSettings(conf config.Config, sm Manager, logger log.Logger) *Settings {
+	s := &Settings{
+		sm:          sm,
+		logger:      logger,
+		defaults:    map[string]interface{}{},
+		overrides:   map[string]Setting{},
+		values:      map[string]interface{}{},
+		subscribers: map[string][]func(v interface{}){},
+	}
+	for _, spec := range settingSpecs {
+		value := spec.Default
+		if conf != nil && conf.IsSet(spec.Key) {
+			switch spec.Type {
+			case SettingTypeBool:
+				value = conf.GetBool(spec.Key)
+			case SettingTypeInt:
+				value = conf.GetInt(spec.Key)
+			case SettingTypeFloat:
+				value = conf.GetFloat64(spec.Key)
+			case SettingTypeString:
+				value = conf.GetString(spec.Key)
+			}
+		}
+		s.defaults[spec.Key] = value
+		s.values[spec.Key] = value
+	}
+	return s
+}
+
+// Get returns the value of the setting.
+func (s *Settings) Get(key string) interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.values[key]
+}
+
+// Bool returns the value of a bool setting.
+func (s *Settings) Bool(key string) bool {
+	v, _ := s.Get(key).(bool)
+	return v
+}
+
+// Int returns the value of an int setting.
+func (s *Settings) Int(key string) int {
+	v, _ := s.Get(key).(int)
+	return v
+}
+
+// Float64 returns the value of a float setting.
+func (s *Settings) Float64(key string) float64 {
+	v, _ := s.Get(key).(float64)
+	return v
+}
+
+// String returns the value of a string setting.
+func (s *Settings) String(key string) string {
+	v, _ := s.Get(key).(string)
+	return v
+}
+
+// Subscribe calls fn with the value of the setting now, and then each time
+// it changes.
+func (s *Settings) Subscribe(key string, fn func(v interface{})) {
+	s.mu.Lock()
+	s.subscribers[key] = append(s.subscribers[key], fn)
+	value := s.values[key]
+	s.mu.Unlock()
+	fn(value)
+}
+
+// Statuses returns the current value of each setting.
+func (s *Settings) Statuses() SettingStatusList {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var list SettingStatusList
+	for _, spec := range SettingSpecs() {
+		status := SettingStatus{SettingSpec: spec, Value: s.values[spec.Key], Default: s.defaults[spec.Key]}
+		if override, ok := s.overrides[spec.Key]; ok {
+			updatedAt := override.UpdatedAt
+			status.Overridden = true
+			status.UpdatedBy = override.UpdatedBy
+			status.UpdatedAt = &updatedAt
+		}
+		list.Settings = append(list.Settings, status)
+	}
+	list.Total = len(list.Settings)
+	return list
+}
+
+// Refresh reloads the overrides and notifies the subscribers of the settings
+// whose value changed. Overrides which are invalid, eg. set before a change
+// of the spec of their setting, are ignored.
+func (s *Settings) Refresh(ctx context.Context) error {
+	stored, err := s.sm.ListSettings(ctx)
+	if err != nil {
+		return err
+	}
+	overrides := map[string]Setting{}
+	values := map[string]interface{}{}
+	for _, setting := range stored {
+		spec, ok := GetSettingSpec(setting.Key)
+		if !ok {
+			continue
+		}
+		value, err := spec.ParseJSON(setting.Value)
+		if err != nil {
+			if s.logger != nil {
+				s.logger.Log("level", "error", "message", "ignoring invalid setting override", "key", setting.Key, "error", err.Error())
+			}
+			continue
+		}
+		overrides[setting.Key] = setting
+		values[setting.Key] = value
+	}
+
+	type notification struct {
+		fns   []func(v interface{})
+		value interface{}
+	}
+	var notifications []notification
+	s.mu.Lock()
+	for _, spec := range settingSpecs {
+		value, ok := values[spec.Key]
+		if !ok {
+			value = s.defaults[spec.Key]
+		}
+		if value != s.values[spec.Key] {
+			if s.logger != nil {
+				s.logger.Log("level", "info", "message", "setting changed", "key", spec.Key, "value", fmt.Sprintf("%v", value))
+			}
+			notifications = append(notifications, notification{fns: s.subscribers[spec.Key], value: value})
+		}
+		s.values[spec.Key] = value
+	}
+	s.overrides = overrides
+	s.mu.Unlock()
+
+	for _, n := range notifications {
+		for _, fn := range n.fns {
+			fn(n.value)
+		}
+	}
+	return nil
+}
+
+// Watch refreshes the settings every interval until the context is done.
+func (s *Settings) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Refresh(ctx); err != nil && s.logger != nil {
+				s.logger.Log("level", "error", "message", "problem refreshing settings", "error", err.Error())
+			}
+		}
+	}
+}
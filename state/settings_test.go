@@ -0,0 +1,69 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+// settingsManager stores setting overrides, the rest of Manager is unused.
+type settingsManager struct {
+	Manager
+	settings []Setting
+}
+
+func (m *settingsManager) ListSettings(ctx context.Context) ([]Setting, error) {
+	return m.settings, nil
+}
+
+func TestSettingSpec_Parse(t *testing.T) {
+	spec, _ := GetSettingSpec(SettingSpotReattemptOverride)
+	if v, err := spec.ParseJSON(json.RawMessage(`1`)); err != nil || v != 1.0 {
+		t.Errorf("expected integers to be accepted as floats, got %v %v", v, err)
+	}
+	for _, raw := range []string{`1.5`, `"0.1"`, `true`, `{`} {
+		if _, err := spec.ParseJSON(json.RawMessage(raw)); err == nil {
+			t.Errorf("expected %s to be refused", raw)
+		}
+	}
+	spec, _ = GetSettingSpec(SettingClusterDefault)
+	if _, err := spec.Parse(""); err == nil {
+		t.Errorf("expected empty clusters to be refused")
+	}
+}
+
+func TestSettings_Refresh(t *testing.T) {
+	sm := &settingsManager{}
+	settings := NewSettings(nil, sm, nil)
+	if !settings.Bool(SettingJobARAEnabled) || settings.Float64(SettingSpotThresholdMinutes) != 30 {
+		t.Errorf("expected the built in defaults, got %+v", settings.Statuses())
+	}
+
+	var notified []interface{}
+	settings.Subscribe(SettingJobARAEnabled, func(v interface{}) { notified = append(notified, v) })
+	sm.settings = []Setting{
+		{Key: SettingJobARAEnabled, Value: json.RawMessage(`false`), UpdatedBy: "somebody"},
+		{Key: SettingSpotThresholdMinutes, Value: json.RawMessage(`-1`)},
+		{Key: "unknown", Value: json.RawMessage(`1`)},
+	}
+	if err := settings.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if settings.Bool(SettingJobARAEnabled) || settings.Float64(SettingSpotThresholdMinutes) != 30 {
+		t.Errorf("expected valid overrides only to apply, got %+v", settings.Statuses())
+	}
+	if len(notified) != 2 || notified[0] != true || notified[1] != false {
+		t.Errorf("expected subscribers to get the value then its change, got %v", notified)
+	}
+
+	if err := settings.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	sm.settings = nil
+	if err := settings.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(notified) != 3 || notified[2] != true {
+		t.Errorf("expected subscribers to be notified of changes only, got %v", notified)
+	}
+}
@@ -0,0 +1,105 @@
+package state
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefaultStopGracePeriodSeconds is the grace period of the pods of runs
+// stopped without one.
+const DefaultStopGracePeriodSeconds = int64(300)
+
+// StopSignals are the signals runs can be stopped with.
+var StopSignals = []string{"SIGTERM", "SIGINT", "SIGHUP", "SIGQUIT", "SIGUSR1", "SIGUSR2"}
+
+// StopStatuses are the statuses of runs which can still be stopped.
+var StopStatuses = []string{StatusHeld, StatusQueued, StatusNeedsRetry, StatusPending, StatusRunning}
+
+// StopRequest is the body of requests stopping runs.
+type StopRequest struct {
+	// Reason is added to the exit reason of the run.
+	Reason string `json:"reason,omitempty"`
+	// GracePeriodSeconds is how long the run has to exit once signalled.
+	GracePeriodSeconds *int64 `json:"grace_period_seconds,omitempty"`
+	// Signal is sent to the run's main process first, instead of the
+	// container's stop signal.
+	Signal string `json:"signal,omitempty"`
+}
+
+// BulkStopRequest is the body of requests stopping all the runs matching a
+// filter.
+type BulkStopRequest struct {
+	StopRequest
+	// DryRun only counts the runs which would be stopped.
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// BulkStopResult lists the runs stopped, or which would be on dry runs.
+type BulkStopResult struct {
+	Total  int      `json:"total"`
+	DryRun bool     `json:"dry_run"`
+	RunIDs []string `json:"run_ids"`
+}
+
+// RunStop records who stopped a run and how.
+type RunStop struct {
+	By                 string    `json:"by,omitempty"`
+	Reason             string    `json:"reason,omitempty"`
+	GracePeriodSeconds *int64    `json:"grace_period_seconds,omitempty"`
+	Signal             string    `json:"signal,omitempty"`
+	RequestedAt        time.Time `json:"requested_at"`
+}
+
+// Validate checks the signal and that the grace period is within max.
+func (r *StopRequest) Validate(maxGracePeriodSeconds int64) error {
+	if len(r.Signal) > 0 {
+		r.Signal = strings.ToUpper(r.Signal)
+		if !strings.HasPrefix(r.Signal, "SIG") {
+			r.Signal = "SIG" + r.Signal
+		}
+		if !slices.Contains(StopSignals, r.Signal) {
+			return fmt.Errorf("invalid signal [%s], must be one of [%s]", r.Signal, strings.Join(StopSignals, ", "))
+		}
+	}
+	if r.GracePeriodSeconds != nil && (*r.GracePeriodSeconds < 0 || *r.GracePeriodSeconds > maxGracePeriodSeconds) {
+		return fmt.Errorf("grace_period_seconds must be between 0 and %d", maxGracePeriodSeconds)
+	}
+	return nil
+}
+
+// NewRunStop records the request of the user to stop a run.
+func NewRunStop(req StopRequest, userInfo UserInfo, now time.Time) RunStop {
+	by := userInfo.Email
+	if len(by) == 0 {
+		by = userInfo.Name
+	}
+	return RunStop{
+		By:                 by,
+		Reason:             req.Reason,
+		GracePeriodSeconds: req.GracePeriodSeconds,
+		Signal:             req.Signal,
+		RequestedAt:        now,
+	}
+}
+
+// ExitReason is the exit reason of runs stopped by the request.
+func (s RunStop) ExitReason() string {
+	exitReason := "Task terminated by user"
+	if len(s.By) > 0 {
+		exitReason = fmt.Sprintf("Task terminated by - %s", s.By)
+	}
+	if len(s.Reason) > 0 {
+		exitReason = fmt.Sprintf("%s: %s", exitReason, s.Reason)
+	}
+	return exitReason
+}
+
+// GracePeriod returns the grace period of the run's pods.
+func (s *RunStop) GracePeriod() int64 {
+	if s == nil || s.GracePeriodSeconds == nil {
+		return DefaultStopGracePeriodSeconds
+	}
+	return *s.GracePeriodSeconds
+}
@@ -0,0 +1,39 @@
+package state
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStopRequest_Validate(t *testing.T) {
+	req := StopRequest{Signal: "usr1"}
+	if err := req.Validate(3600); err != nil || req.Signal != "SIGUSR1" {
+		t.Errorf("expected the signal to be normalized, got %q %v", req.Signal, err)
+	}
+	req = StopRequest{Signal: "SIGSEGV"}
+	if err := req.Validate(3600); err == nil {
+		t.Errorf("expected unsupported signals to be refused")
+	}
+	gracePeriod := int64(7200)
+	req = StopRequest{GracePeriodSeconds: &gracePeriod}
+	if err := req.Validate(3600); err == nil {
+		t.Errorf("expected grace periods past the max to be refused")
+	}
+}
+
+func TestRunStop(t *testing.T) {
+	stop := NewRunStop(StopRequest{Reason: "bad input"}, UserInfo{Name: "Some Body", Email: "somebody@example.com"}, time.Now())
+	if stop.ExitReason() != "Task terminated by - somebody@example.com: bad input" {
+		t.Errorf("unexpected exit reason %q", stop.ExitReason())
+	}
+	if stop.GracePeriod() != DefaultStopGracePeriodSeconds {
+		t.Errorf("expected the default grace period, got %d", stop.GracePeriod())
+	}
+	if reason := NewRunStop(StopRequest{}, UserInfo{}, time.Now()).ExitReason(); reason != "Task terminated by user" {
+		t.Errorf("unexpected exit reason %q", reason)
+	}
+	var unset *RunStop
+	if unset.GracePeriod() != DefaultStopGracePeriodSeconds {
+		t.Errorf("expected runs stopped without a request to get the default grace period")
+	}
+}
@@ -0,0 +1,387 @@
+package state
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/stitchfix/flotilla-os/config"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// AttemptStuck is the outcome of attempts resubmitted because their pod was
+// stuck.
+const AttemptStuck = "stuck"
+
+// StuckAction is what's done with a run stuck for longer than its pattern
+// allows.
+type StuckAction string
+
+const (
+	// StuckActionNone only explains why the run is pending
+	StuckActionNone StuckAction = "none"
+	// StuckActionFail stops the run with the reason it was stuck
+	StuckActionFail StuckAction = "fail"
+	// StuckActionResubmit resubmits the run to another active cluster
+	// allowing its tier
+	StuckActionResubmit StuckAction = "resubmit"
+	// StuckActionOndemand resubmits the run to on-demand nodes
+	StuckActionOndemand StuckAction = "ondemand"
+)
+
+// IsValidStuckAction checks that the given string is one of the stuck actions.
+func IsValidStuckAction(action string) bool {
+	switch StuckAction(action) {
+	case StuckActionNone, StuckActionFail, StuckActionResubmit, StuckActionOndemand:
+		return true
+	}
+	return false
+}
+
+// StuckPattern is a known way for the pod of a run not to start, recognized
+// by the reasons of its events. A pattern no longer applies once an event
+// with one of its ClearedBy reasons follows.
+type StuckPattern struct {
+	Name        string
+	Description string
+	Reasons     []string
+	ClearedBy   []string
+	Category    FailureCategory
+	After       time.Duration
+	Action      StuckAction
+}
+
+// StuckPatterns are the known patterns, with their default thresholds and
+// actions. They're matched in order.
+var StuckPatterns = []StuckPattern{
+	{
+		Name:        "image_pull",
+		Description: "the image of the run can't be pulled",
+		Reasons:     []string{"ErrImagePull", "ImagePullBackOff", "InvalidImageName", "ErrImageNeverPull"},
+		ClearedBy:   []string{"Pulled"},
+		Category:    FailureCategoryImagePull,
+		After:       10 * time.Minute,
+		Action:      StuckActionFail,
+	},
+	{
+		Name:        "container_config",
+		Description: "the container of the run can't be created, eg. a secret or config map it uses is missing",
+		Reasons:     []string{"CreateContainerConfigError", "CreateContainerError"},
+		ClearedBy:   []string{"Created", "Started"},
+		Category:    FailureCategoryUserError,
+		After:       10 * time.Minute,
+		Action:      StuckActionFail,
+	},
+	{
+		Name:        "mount",
+		Description: "a volume of the run can't be mounted",
+		Reasons:     []string{"FailedMount", "FailedAttachVolume"},
+		ClearedBy:   []string{"Pulling", "Pulled", "Started"},
+		Category:    FailureCategoryInfra,
+		After:       15 * time.Minute,
+		Action:      StuckActionFail,
+	},
+	{
+		Name:        "sandbox",
+		Description: "the sandbox of the run's pod can't be created",
+		Reasons:     []string{"FailedCreatePodSandBox"},
+		ClearedBy:   []string{"Pulling", "Pulled", "Started"},
+		Category:    FailureCategoryInfra,
+		After:       15 * time.Minute,
+		Action:      StuckActionNone,
+	},
+	{
+		Name:        "unschedulable",
+		Description: "no node can fit the run",
+		Reasons:     []string{"FailedScheduling", "Unschedulable"},
+		ClearedBy:   []string{"Scheduled", "TriggeredScaleUp"},
+		Category:    FailureCategoryScheduling,
+		After:       30 * time.Minute,
+		Action:      StuckActionNone,
+	},
+}
+
+// StuckRunDetector matches the events of the runs waiting for their pod to
+// start against the stuck patterns.
+type StuckRunDetector struct {
+	Patterns     []StuckPattern
+	MaxResubmits int
+}
+
+// NewStuckRunDetector reads the action and threshold of each pattern from
+// `stuck_run_<pattern>_action` and `stuck_run_<pattern>_after`, and how many
+// times a run can be resubmitted from `stuck_run_max_resubmits` (default 2).
+func NewStuckRunDetector(conf config.Config) (*StuckRunDetector, error) {
+	d := StuckRunDetector{MaxResubmits: 2}
+	for _, p := range StuckPatterns {
+		if conf != nil {
+			if key := fmt.Sprintf("stuck_run_%s_action", p.Name); conf.IsSet(key) {
+				action := strings.TrimSpace(conf.GetString(key))
+				if !IsValidStuckAction(action) {
+					return nil, fmt.Errorf("invalid %s [%s]", key, action)
+				}
+				p.Action = StuckAction(action)
+			}
+			if key := fmt.Sprintf("stuck_run_%s_after", p.Name); conf.IsSet(key) {
+				after, err := time.ParseDuration(conf.GetString(key))
+				if err != nil || after <= 0 {
+					return nil, fmt.Errorf("invalid %s [%s]", key, conf.GetString(key))
+				}
+				p.After = after
+			}
+		}
+		d.Patterns = append(d.Patterns, p)
+	}
+	if conf != nil && conf.IsSet("stuck_run_max_resubmits") {
+		d.MaxResubmits = conf.GetInt("stuck_run_max_resubmits")
+	}
+	return &d, nil
+}
+
+// StuckRun is a run matching a stuck pattern since its first matching event.
+// Event is its latest matching event.
+type StuckRun struct {
+	Pattern StuckPattern
+	Event   PodEvent
+	Since   time.Time
+}
+
+// Stuck tells whether the run has been stuck for longer than its pattern
+// allows.
+func (s StuckRun) Stuck(now time.Time) bool {
+	return now.Sub(s.Since) >= s.Pattern.After
+}
+
+// Reason explains why the run is stuck, eg. for its exit reason.
+func (s StuckRun) Reason(now time.Time) string {
+	return fmt.Sprintf("Run was stuck for %s: %s (%s: %s)",
+		now.Sub(s.Since).Round(time.Minute), s.Pattern.Description, s.Event.Reason, s.Event.Message)
+}
+
+// Match returns the first stuck pattern the run matches, whether or not it
+// has been stuck long enough for the pattern's action. Only the events of
+// the run's latest attempt, since it was queued, are considered.
+func (d *StuckRunDetector) Match(run Run) *StuckRun {
+	if run.PodEvents == nil {
+		return nil
+	}
+	for _, p := range d.Patterns {
+		// Events aren't necessarily in order, find the latest clearing event
+		// first
+		var cleared *time.Time
+		for _, e := range *run.PodEvents {
+			if e.Timestamp != nil && containsString(p.ClearedBy, e.Reason) && (cleared == nil || e.Timestamp.After(*cleared)) {
+				cleared = e.Timestamp
+			}
+		}
+
+		var stuck *StuckRun
+		for _, e := range *run.PodEvents {
+			if e.Timestamp == nil || !containsString(p.Reasons, e.Reason) {
+				continue
+			}
+			if (run.QueuedAt != nil && e.Timestamp.Before(*run.QueuedAt)) || (cleared != nil && !e.Timestamp.After(*cleared)) {
+				continue
+			}
+			if stuck == nil {
+				stuck = &StuckRun{Pattern: p, Event: e, Since: *e.Timestamp}
+				continue
+			}
+			if e.Timestamp.Before(stuck.Since) {
+				stuck.Since = *e.Timestamp
+			}
+			if !e.Timestamp.Before(*stuck.Event.Timestamp) {
+				stuck.Event = e
+			}
+		}
+		if stuck != nil {
+			return stuck
+		}
+	}
+	return nil
+}
+
+// Detect returns the pattern the run has been stuck on for longer than it
+// allows, nil if the run isn't waiting for its pod or isn't stuck.
+func (d *StuckRunDetector) Detect(run Run, now time.Time) *StuckRun {
+	if run.Status != StatusPending && run.Status != StatusQueued {
+		return nil
+	}
+	if stuck := d.Match(run); stuck != nil && stuck.Stuck(now) {
+		return stuck
+	}
+	return nil
+}
+
+// RunDiagnosis explains why a run is still waiting to run.
+type RunDiagnosis struct {
+	Summary  string      `json:"summary"`
+	Since    *time.Time  `json:"since,omitempty"`
+	Pattern  string      `json:"pattern,omitempty"`
+	Reason   string      `json:"reason,omitempty"`
+	Message  string      `json:"message,omitempty"`
+	Action   StuckAction `json:"action,omitempty"`
+	ActionAt *time.Time  `json:"action_at,omitempty"`
+}
+
+// Diagnose explains why a queued or pending run isn't running yet, nil for
+// runs in other statuses.
+func (d *StuckRunDetector) Diagnose(run Run, now time.Time) *RunDiagnosis {
+	switch run.Status {
+	case StatusQueued:
+		return &RunDiagnosis{
+			Summary: fmt.Sprintf("The run is queued for cluster %s and waiting to be submitted.", run.ClusterName),
+			Since:   run.QueuedAt,
+		}
+	case StatusPending:
+	default:
+		return nil
+	}
+
+	if stuck := d.Match(run); stuck != nil {
+		diagnosis := RunDiagnosis{
+			Summary: fmt.Sprintf("The run is pending because %s (%s: %s).", stuck.Pattern.Description, stuck.Event.Reason, stuck.Event.Message),
+			Since:   &stuck.Since,
+			Pattern: stuck.Pattern.Name,
+			Reason:  stuck.Event.Reason,
+			Message: stuck.Event.Message,
+			Action:  stuck.Pattern.Action,
+		}
+		if stuck.Pattern.Action != StuckActionNone {
+			actionAt := stuck.Since.Add(stuck.Pattern.After)
+			diagnosis.ActionAt = &actionAt
+		}
+		return &diagnosis
+	}
+
+	var latest *PodEvent
+	if run.PodEvents != nil {
+		for i, e := range *run.PodEvents {
+			if e.Timestamp == nil || (run.QueuedAt != nil && e.Timestamp.Before(*run.QueuedAt)) {
+				continue
+			}
+			if latest == nil || !e.Timestamp.Before(*latest.Timestamp) {
+				latest = &(*run.PodEvents)[i]
+			}
+		}
+	}
+	if latest == nil {
+		return &RunDiagnosis{
+			Summary: fmt.Sprintf("The run was submitted to cluster %s and its pod is waiting to be scheduled.", run.ClusterName),
+			Since:   run.QueuedAt,
+		}
+	}
+	return &RunDiagnosis{
+		Summary: fmt.Sprintf("The run's pod is starting, its latest event is %s: %s", latest.Reason, latest.Message),
+		Since:   run.QueuedAt,
+		Reason:  latest.Reason,
+		Message: latest.Message,
+	}
+}
+
+// StuckRunUpdate returns the update recording the stuck attempt of a run and
+// sending it back for retry on the cluster, on an on-demand node when
+// onDemand is set.
+func StuckRunUpdate(run Run, stuck StuckRun, cluster ClusterMetadata, onDemand bool, now time.Time) Run {
+	var attempts RunAttempts
+	if run.Attempts != nil {
+		attempts = append(attempts, *run.Attempts...)
+	}
+	attempt := RunAttempt{
+		Attempt:   int64(len(attempts) + 1),
+		Outcome:   AttemptStuck,
+		Cluster:   run.ClusterName,
+		Reason:    stuck.Reason(now),
+		StartedAt: run.QueuedAt,
+		EndedAt:   now,
+	}
+	if run.PodName != nil {
+		attempt.PodName = *run.PodName
+	}
+	if run.NodeLifecycle != nil {
+		attempt.NodeLifecycle = *run.NodeLifecycle
+	}
+	attempts = append(attempts, attempt)
+
+	update := Run{
+		Status:      StatusNeedsRetry,
+		QueuedAt:    &now,
+		Attempts:    &attempts,
+		ClusterName: cluster.Name,
+	}
+	if cluster.Namespace != "" {
+		namespace := cluster.Namespace
+		update.Namespace = &namespace
+	}
+	if onDemand {
+		update.NodeLifecycle = &OndemandLifecycle
+	}
+	return update
+}
+
+// StuckRunCluster returns the first active cluster allowing the run's tier on
+// which the run hasn't been stuck yet.
+func StuckRunCluster(run Run, clusters []ClusterMetadata) (ClusterMetadata, bool) {
+	tried := map[string]bool{run.ClusterName: true}
+	if run.Attempts != nil {
+		for _, a := range *run.Attempts {
+			if a.Outcome == AttemptStuck {
+				tried[a.Cluster] = true
+			}
+		}
+	}
+	for _, c := range clusters {
+		if c.Status != StatusActive || tried[c.Name] {
+			continue
+		}
+		if run.Tier != "" && !containsString(c.AllowedTiers, string(run.Tier)) {
+			continue
+		}
+		return c, true
+	}
+	return ClusterMetadata{}, false
+}
+
+// PodStatusEvents returns the problems reported by the status of a pending
+// pod as events: its scheduling failure and the reasons its containers are
+// waiting for. They're timestamped by the pod's condition or start, so that
+// they're only recorded once.
+func PodStatusEvents(pod corev1.Pod) PodEvents {
+	var events PodEvents
+	if pod.Status.Phase != corev1.PodPending {
+		return events
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodScheduled && condition.Status == corev1.ConditionFalse && len(condition.Reason) > 0 {
+			timestamp := condition.LastTransitionTime.Time
+			events = append(events, PodEvent{
+				Timestamp:    &timestamp,
+				EventType:    corev1.EventTypeWarning,
+				Reason:       condition.Reason,
+				SourceObject: pod.Name,
+				Message:      condition.Message,
+			})
+		}
+	}
+
+	since := pod.CreationTimestamp.Time
+	if pod.Status.StartTime != nil {
+		since = pod.Status.StartTime.Time
+	}
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		waiting := status.State.Waiting
+		if waiting == nil || waiting.Reason == "ContainerCreating" || waiting.Reason == "PodInitializing" {
+			continue
+		}
+		timestamp := since
+		events = append(events, PodEvent{
+			Timestamp:    &timestamp,
+			EventType:    corev1.EventTypeWarning,
+			Reason:       waiting.Reason,
+			SourceObject: pod.Name,
+			Message:      fmt.Sprintf("container %s: %s", status.Name, waiting.Message),
+		})
+	}
+	return events
+}
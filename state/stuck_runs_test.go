@@ -0,0 +1,173 @@
+package state
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stitchfix/flotilla-os/config"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestStuckRunDetector_Detect(t *testing.T) {
+	d, err := NewStuckRunDetector(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	at := func(ago time.Duration) *time.Time {
+		ts := now.Add(-ago)
+		return &ts
+	}
+	queuedAt := at(time.Hour)
+	run := Run{RunID: "run", Status: StatusPending, QueuedAt: queuedAt, PodEvents: &PodEvents{
+		{Timestamp: at(2 * time.Hour), Reason: "FailedMount", Message: "from a previous attempt"},
+		{Timestamp: at(40 * time.Minute), Reason: "Scheduled"},
+		{Timestamp: at(20 * time.Minute), Reason: "ErrImagePull", Message: "not found"},
+		{Timestamp: at(15 * time.Minute), Reason: "ImagePullBackOff", Message: "Back-off pulling image"},
+	}}
+
+	stuck := d.Detect(run, now)
+	if stuck == nil || stuck.Pattern.Name != "image_pull" {
+		t.Fatalf("expected the run to be stuck pulling its image, got %+v", stuck)
+	}
+	if !stuck.Since.Equal(*at(20 * time.Minute)) || stuck.Event.Reason != "ImagePullBackOff" {
+		t.Errorf("expected the stuck run to be since its first event with its latest event, got %+v", stuck)
+	}
+	if reason := stuck.Reason(now); !strings.Contains(reason, "ImagePullBackOff") || ClassifyFailure(Run{Status: StatusStopped, ExitReason: &reason}) == nil {
+		t.Errorf("unexpected reason %s", reason)
+	}
+
+	if d.Detect(run, now.Add(-15*time.Minute)) != nil {
+		t.Errorf("expected runs not to be stuck before the pattern's threshold")
+	}
+	running := run
+	running.Status = StatusRunning
+	if d.Detect(running, now) != nil {
+		t.Errorf("expected running runs not to be stuck")
+	}
+	pulled := run
+	pulled.PodEvents = &PodEvents{(*run.PodEvents)[2], {Timestamp: at(time.Minute), Reason: "Pulled"}}
+	if d.Detect(pulled, now) != nil {
+		t.Errorf("expected pulled images to clear the pattern")
+	}
+}
+
+func TestNewStuckRunDetector(t *testing.T) {
+	t.Setenv("STUCK_RUN_UNSCHEDULABLE_ACTION", "resubmit")
+	t.Setenv("STUCK_RUN_UNSCHEDULABLE_AFTER", "5m")
+	conf, _ := config.NewConfig(nil)
+	d, err := NewStuckRunDetector(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range d.Patterns {
+		if p.Name == "unschedulable" && (p.Action != StuckActionResubmit || p.After != 5*time.Minute) {
+			t.Errorf("expected the pattern to be configured, got %+v", p)
+		}
+	}
+
+	t.Setenv("STUCK_RUN_MOUNT_ACTION", "retry")
+	if _, err = NewStuckRunDetector(conf); err == nil {
+		t.Errorf("expected unknown actions to be refused")
+	}
+}
+
+func TestStuckRunDetector_Diagnose(t *testing.T) {
+	d, _ := NewStuckRunDetector(nil)
+	now := time.Now()
+	queuedAt := now.Add(-10 * time.Minute)
+	eventAt := now.Add(-5 * time.Minute)
+
+	if diagnosis := d.Diagnose(Run{Status: StatusRunning}, now); diagnosis != nil {
+		t.Errorf("expected running runs not to be diagnosed, got %+v", diagnosis)
+	}
+	if diagnosis := d.Diagnose(Run{Status: StatusQueued, ClusterName: "a", QueuedAt: &queuedAt}, now); diagnosis == nil || !strings.Contains(diagnosis.Summary, "queued") {
+		t.Errorf("unexpected diagnosis of a queued run %+v", diagnosis)
+	}
+
+	run := Run{Status: StatusPending, ClusterName: "a", QueuedAt: &queuedAt, PodEvents: &PodEvents{
+		{Timestamp: &eventAt, Reason: "CreateContainerConfigError", Message: `secret "db" not found`},
+	}}
+	diagnosis := d.Diagnose(run, now)
+	if diagnosis == nil || diagnosis.Pattern != "container_config" || diagnosis.Action != StuckActionFail {
+		t.Fatalf("unexpected diagnosis of a stuck run %+v", diagnosis)
+	}
+	if !strings.Contains(diagnosis.Summary, `secret "db" not found`) || diagnosis.ActionAt == nil || !diagnosis.ActionAt.Equal(eventAt.Add(10*time.Minute)) {
+		t.Errorf("expected the summary and when the run will be failed, got %+v", diagnosis)
+	}
+
+	run.PodEvents = &PodEvents{{Timestamp: &eventAt, Reason: "Pulling", Message: "Pulling image"}}
+	if diagnosis = d.Diagnose(run, now); diagnosis.Pattern != "" || diagnosis.Reason != "Pulling" {
+		t.Errorf("expected the latest event of a starting run, got %+v", diagnosis)
+	}
+}
+
+func TestStuckRunUpdate(t *testing.T) {
+	now := time.Now()
+	queuedAt := now.Add(-time.Hour)
+	podName := "run-abc"
+	run := Run{RunID: "run", Status: StatusPending, ClusterName: "a", Tier: "4", QueuedAt: &queuedAt, PodName: &podName}
+	stuck := StuckRun{Pattern: StuckPatterns[4], Event: PodEvent{Reason: "FailedScheduling"}, Since: queuedAt}
+	clusters := []ClusterMetadata{
+		{Name: "a", Status: StatusActive, AllowedTiers: Tiers{"4"}},
+		{Name: "b", Status: StatusMaintenance, AllowedTiers: Tiers{"4"}},
+		{Name: "c", Status: StatusActive, AllowedTiers: Tiers{"1"}},
+		{Name: "d", Status: StatusActive, AllowedTiers: Tiers{"1", "4"}, Namespace: "jobs"},
+	}
+
+	cluster, ok := StuckRunCluster(run, clusters)
+	if !ok || cluster.Name != "d" {
+		t.Fatalf("expected the only other active cluster allowing the run's tier, got %+v", cluster)
+	}
+	update := StuckRunUpdate(run, stuck, cluster, false, now)
+	if update.Status != StatusNeedsRetry || update.ClusterName != "d" || *update.Namespace != "jobs" || update.NodeLifecycle != nil {
+		t.Errorf("unexpected update %+v", update)
+	}
+	if update.Attempts.Count(AttemptStuck) != 1 || (*update.Attempts)[0].Cluster != "a" || (*update.Attempts)[0].PodName != podName {
+		t.Errorf("expected the stuck attempt to be recorded, got %+v", update.Attempts)
+	}
+
+	run.UpdateWith(update)
+	run.ClusterName = "d"
+	if _, ok = StuckRunCluster(run, clusters); ok {
+		t.Errorf("expected the clusters the run was stuck on not to be tried again")
+	}
+}
+
+func TestPodStatusEvents(t *testing.T) {
+	transition := metav1.NewTime(time.Now().Add(-time.Minute))
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "run-abc"},
+		Status: corev1.PodStatus{
+			Phase:     corev1.PodPending,
+			StartTime: &transition,
+			Conditions: []corev1.PodCondition{
+				{Type: corev1.PodScheduled, Status: corev1.ConditionTrue, LastTransitionTime: transition},
+			},
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "main", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff", Message: "Back-off"}}},
+				{Name: "sidecar", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ContainerCreating"}}},
+			},
+		},
+	}
+	events := PodStatusEvents(pod)
+	if len(events) != 1 || events[0].Reason != "ImagePullBackOff" || events[0].SourceObject != "run-abc" {
+		t.Errorf("expected the waiting reason of the main container, got %+v", events)
+	}
+	if again := PodStatusEvents(pod); !events[0].Equal(again[0]) {
+		t.Errorf("expected the same status to give the same events")
+	}
+
+	pod.Status.Conditions[0] = corev1.PodCondition{Type: corev1.PodScheduled, Status: corev1.ConditionFalse, Reason: "Unschedulable", Message: "0/3 nodes are available", LastTransitionTime: transition}
+	pod.Status.ContainerStatuses = nil
+	if events = PodStatusEvents(pod); len(events) != 1 || events[0].Reason != "Unschedulable" {
+		t.Errorf("expected the scheduling failure, got %+v", events)
+	}
+
+	pod.Status.Phase = corev1.PodRunning
+	if events = PodStatusEvents(pod); len(events) != 0 {
+		t.Errorf("expected no events once the pod runs, got %+v", events)
+	}
+}
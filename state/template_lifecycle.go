@@ -0,0 +1,360 @@
+package state
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// TemplateLatestChannel always targets the latest version of a template; it
+// can't be set.
+const TemplateLatestChannel = "latest"
+
+var templateChannelPattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,62}$`)
+
+// TemplateDeprecationLevel is what happens to runs of a deprecated template
+// version.
+type TemplateDeprecationLevel string
+
+const (
+	// TemplateDeprecationWarn lets runs of the version through with a warning.
+	TemplateDeprecationWarn TemplateDeprecationLevel = "warn"
+	// TemplateDeprecationBlock rejects runs of the version.
+	TemplateDeprecationBlock TemplateDeprecationLevel = "block"
+)
+
+// TemplateDeprecation marks a template version as deprecated. It's also the
+// body of requests deprecating a version, By and DeprecatedAt being set by
+// the server.
+type TemplateDeprecation struct {
+	Level        TemplateDeprecationLevel `json:"level"`
+	Message      string                   `json:"message,omitempty"`
+	By           string                   `json:"by,omitempty"`
+	DeprecatedAt time.Time                `json:"deprecated_at"`
+}
+
+// Validate checks the level of the deprecation.
+func (d TemplateDeprecation) Validate() error {
+	if d.Level != TemplateDeprecationWarn && d.Level != TemplateDeprecationBlock {
+		return fmt.Errorf("invalid deprecation level [%s], must be one of [%s, %s]", d.Level, TemplateDeprecationWarn, TemplateDeprecationBlock)
+	}
+	return nil
+}
+
+// Blocks tells whether runs of the version are rejected; it's nil-safe.
+func (d *TemplateDeprecation) Blocks() bool {
+	return d != nil && d.Level == TemplateDeprecationBlock
+}
+
+// Warning describes the deprecation of the template for its users.
+func (d TemplateDeprecation) Warning(t Template) string {
+	warning := fmt.Sprintf("template [%s] version [%d] is deprecated", t.TemplateName, t.Version)
+	if len(d.Message) > 0 {
+		warning = fmt.Sprintf("%s: %s", warning, d.Message)
+	}
+	return warning
+}
+
+// TemplateChannel points a name, eg. stable or canary, at a version of a
+// template. Runs by template name can target channels instead of versions.
+type TemplateChannel struct {
+	TemplateName string    `json:"template_name" db:"template_name"`
+	Channel      string    `json:"channel" db:"channel"`
+	Version      int64     `json:"version" db:"version"`
+	TemplateID   string    `json:"template_id" db:"template_id"`
+	UpdatedBy    string    `json:"updated_by" db:"updated_by"`
+	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// TemplateChannelRequest is the body of requests setting a channel.
+type TemplateChannelRequest struct {
+	Version int64 `json:"version"`
+}
+
+// TemplateChannelList wraps a list of template channels.
+type TemplateChannelList struct {
+	Total    int               `json:"total"`
+	Channels []TemplateChannel `json:"channels"`
+}
+
+// ValidateTemplateChannelName checks that the name can be told apart from
+// versions and isn't reserved.
+func ValidateTemplateChannelName(channel string) error {
+	if channel == TemplateLatestChannel {
+		return fmt.Errorf("channel [%s] is reserved", TemplateLatestChannel)
+	}
+	if !templateChannelPattern.MatchString(channel) {
+		return fmt.Errorf("invalid channel [%s], must match %s", channel, templateChannelPattern.String())
+	}
+	return nil
+}
+
+// TemplateVersionUsage sums up the runs of a template version.
+type TemplateVersionUsage struct {
+	TemplateID  string               `json:"template_id" db:"template_id"`
+	Version     int64                `json:"version" db:"version"`
+	Runs        int64                `json:"runs" db:"runs"`
+	ActiveRuns  int64                `json:"active_runs" db:"active_runs"`
+	LastRunAt   *time.Time           `json:"last_run_at,omitempty" db:"last_run_at"`
+	Users       TemplateUsers        `json:"users" db:"users"`
+	Deprecation *TemplateDeprecation `json:"deprecation,omitempty" db:"deprecation"`
+	Channels    []string             `json:"channels,omitempty" db:"-"`
+}
+
+// TemplateUsers are the distinct users of a template version.
+type TemplateUsers []string
+
+// TemplateUsageReport is the usage of each version of a template since a
+// point in time, most recent version first.
+type TemplateUsageReport struct {
+	TemplateName string                 `json:"template_name"`
+	Since        time.Time              `json:"since"`
+	Versions     []TemplateVersionUsage `json:"versions"`
+}
+
+// Schema keywords which can't be compared but only told changed.
+var opaqueSchemaKeywords = []string{
+	"pattern", "format", "multipleOf", "patternProperties", "dependencies",
+	"allOf", "anyOf", "oneOf", "not", "if", "then", "else",
+	"$ref", "definitions", "$defs",
+}
+
+// SchemaIncompatibilities lists the changes from prev to curr which make curr
+// reject payloads prev accepted. Payloads are validated with the template's
+// defaults merged in, so newly required fields which have defaults are
+// compatible.
+func SchemaIncompatibilities(prev TemplateJSONSchema, curr TemplateJSONSchema, defaults TemplatePayload) []string {
+	var reasons []string
+	compareSchemas("(root)", prev, curr, defaults, &reasons)
+	return reasons
+}
+
+func compareSchemas(path string, prev map[string]interface{}, curr map[string]interface{}, defaults map[string]interface{}, reasons *[]string) {
+	report := func(format string, args ...interface{}) {
+		*reasons = append(*reasons, fmt.Sprintf("%s: %s", path, fmt.Sprintf(format, args...)))
+	}
+
+	if currTypes, ok := schemaTypes(curr); ok {
+		prevTypes, ok := schemaTypes(prev)
+		if !ok {
+			report("type is now restricted to %v", currTypes)
+		}
+		for _, t := range prevTypes {
+			if !schemaTypeAccepted(t, currTypes) {
+				report("type %s is no longer accepted", t)
+			}
+		}
+	}
+
+	if currValues, ok := schemaValues(curr); ok {
+		prevValues, ok := schemaValues(prev)
+		if !ok {
+			report("values are now restricted to %v", currValues)
+		}
+		for _, v := range prevValues {
+			if !containsValue(currValues, v) {
+				report("value %v is no longer accepted", v)
+			}
+		}
+	}
+
+	for _, keyword := range []string{"minimum", "exclusiveMinimum", "minLength", "minItems", "minProperties"} {
+		compareBound(keyword, prev, curr, func(p, c float64) bool { return c > p }, report)
+	}
+	for _, keyword := range []string{"maximum", "exclusiveMaximum", "maxLength", "maxItems", "maxProperties"} {
+		compareBound(keyword, prev, curr, func(p, c float64) bool { return c < p }, report)
+	}
+	for _, keyword := range opaqueSchemaKeywords {
+		if c, ok := curr[keyword]; ok && !reflect.DeepEqual(prev[keyword], c) {
+			report("%s changed", keyword)
+		}
+	}
+	if curr["uniqueItems"] == true && prev["uniqueItems"] != true {
+		report("items must now be unique")
+	}
+
+	prevRequired := map[string]bool{}
+	for _, name := range schemaStrings(prev["required"]) {
+		prevRequired[name] = true
+	}
+	for _, name := range schemaStrings(curr["required"]) {
+		if _, ok := defaults[name]; ok || prevRequired[name] {
+			continue
+		}
+		report("property %s is now required", name)
+	}
+
+	currAdditional, currHasAdditional := curr["additionalProperties"]
+	if currHasAdditional && currAdditional == false && prev["additionalProperties"] != false {
+		report("additional properties are no longer allowed")
+	}
+	if currAdditionalSchema := schemaMap(currAdditional); currAdditionalSchema != nil {
+		if prevAdditionalSchema := schemaMap(prev["additionalProperties"]); prevAdditionalSchema != nil {
+			compareSchemas(path+".*", prevAdditionalSchema, currAdditionalSchema, nil, reasons)
+		} else if prev["additionalProperties"] != false {
+			report("additional properties are now restricted")
+		}
+	}
+
+	prevProperties := schemaMap(prev["properties"])
+	currProperties := schemaMap(curr["properties"])
+	names := make([]string, 0, len(prevProperties))
+	for name := range prevProperties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		c, ok := currProperties[name]
+		if !ok {
+			if currHasAdditional && currAdditional == false {
+				report("property %s was removed and additional properties are not allowed", name)
+			}
+			continue
+		}
+		prevProperty, currProperty := schemaMap(prevProperties[name]), schemaMap(c)
+		if prevProperty != nil && currProperty != nil {
+			compareSchemas(path+"."+name, prevProperty, currProperty, schemaMap(defaults[name]), reasons)
+		}
+	}
+
+	// New properties were accepted by prev through its additional properties,
+	// unless it didn't allow any.
+	names = names[:0]
+	for name := range currProperties {
+		if _, ok := prevProperties[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	prevAdditional := prev["additionalProperties"]
+	for _, name := range names {
+		currProperty := schemaMap(currProperties[name])
+		if currProperty == nil || prevAdditional == false {
+			continue
+		}
+		if prevAdditionalSchema := schemaMap(prevAdditional); prevAdditionalSchema != nil {
+			compareSchemas(path+"."+name, prevAdditionalSchema, currProperty, schemaMap(defaults[name]), reasons)
+			continue
+		}
+		var restrictions []string
+		compareSchemas(path+"."+name, map[string]interface{}{}, currProperty, schemaMap(defaults[name]), &restrictions)
+		if len(restrictions) > 0 {
+			report("property %s is now restricted", name)
+		}
+	}
+
+	if currItems := schemaMap(curr["items"]); currItems != nil {
+		if prevItems := schemaMap(prev["items"]); prevItems != nil {
+			compareSchemas(path+"[]", prevItems, currItems, nil, reasons)
+		} else {
+			report("items are now restricted")
+		}
+	} else if c, ok := curr["items"]; ok && !reflect.DeepEqual(prev["items"], c) {
+		report("items changed")
+	}
+}
+
+// compareBound reports the keyword of curr when it's new or tightens the
+// one of prev.
+func compareBound(keyword string, prev map[string]interface{}, curr map[string]interface{}, tighter func(p, c float64) bool, report func(string, ...interface{})) {
+	c, ok := curr[keyword]
+	if !ok {
+		return
+	}
+	p, ok := prev[keyword]
+	if !ok {
+		report("%s %v was added", keyword, c)
+		return
+	}
+	pf, pok := schemaNumber(p)
+	cf, cok := schemaNumber(c)
+	if !pok || !cok {
+		// Boolean exclusive bounds of draft 4.
+		if !reflect.DeepEqual(p, c) {
+			report("%s changed", keyword)
+		}
+		return
+	}
+	if tighter(pf, cf) {
+		report("%s changed from %v to %v", keyword, p, c)
+	}
+}
+
+func schemaTypes(schema map[string]interface{}) ([]string, bool) {
+	switch t := schema["type"].(type) {
+	case string:
+		return []string{t}, true
+	case []interface{}:
+		return schemaStrings(t), true
+	}
+	return nil, false
+}
+
+func schemaTypeAccepted(t string, types []string) bool {
+	for _, accepted := range types {
+		if accepted == t || (t == "integer" && accepted == "number") {
+			return true
+		}
+	}
+	return false
+}
+
+func schemaValues(schema map[string]interface{}) ([]interface{}, bool) {
+	if values, ok := schema["enum"].([]interface{}); ok {
+		return values, true
+	}
+	if value, ok := schema["const"]; ok {
+		return []interface{}{value}, true
+	}
+	return nil, false
+}
+
+func containsValue(values []interface{}, value interface{}) bool {
+	for _, v := range values {
+		if reflect.DeepEqual(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func schemaStrings(value interface{}) []string {
+	var result []string
+	switch v := value.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		for _, s := range v {
+			if str, ok := s.(string); ok {
+				result = append(result, str)
+			}
+		}
+	}
+	return result
+}
+
+func schemaMap(value interface{}) map[string]interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v
+	case TemplateJSONSchema:
+		return v
+	case TemplatePayload:
+		return v
+	}
+	return nil
+}
+
+func schemaNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
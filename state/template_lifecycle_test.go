@@ -0,0 +1,167 @@
+package state
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func schema(t *testing.T, s string) TemplateJSONSchema {
+	var result TemplateJSONSchema
+	if err := json.Unmarshal([]byte(s), &result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestSchemaIncompatibilities(t *testing.T) {
+	prev := `{
+		"type": "object",
+		"required": ["name"],
+		"properties": {
+			"name": {"type": "string", "maxLength": 10},
+			"size": {"type": "integer", "minimum": 1, "maximum": 10},
+			"mode": {"type": "string", "enum": ["fast", "slow"]},
+			"tags": {"type": "array", "items": {"type": "string"}}
+		}
+	}`
+	tests := []struct {
+		name     string
+		curr     string
+		defaults TemplatePayload
+		expected []string
+	}{
+		{"unchanged", prev, nil, nil},
+		{
+			"widened",
+			`{
+				"type": "object",
+				"required": [],
+				"properties": {
+					"name": {"type": ["string", "null"]},
+					"size": {"type": "number", "minimum": 0},
+					"mode": {"type": "string", "enum": ["fast", "slow", "medium"]},
+					"tags": {"type": "array"},
+					"extra": {"description": "anything goes"}
+				}
+			}`,
+			nil,
+			nil,
+		},
+		{
+			"narrowed",
+			`{
+				"type": "object",
+				"required": ["name", "mode"],
+				"additionalProperties": false,
+				"properties": {
+					"name": {"type": "string", "maxLength": 5, "pattern": "^[a-z]+$"},
+					"size": {"type": "string"},
+					"mode": {"type": "string", "enum": ["fast"]}
+				}
+			}`,
+			nil,
+			[]string{
+				"(root): property mode is now required",
+				"(root): additional properties are no longer allowed",
+				"(root).mode: value slow is no longer accepted",
+				"(root).name: maxLength changed from 10 to 5",
+				"(root).name: pattern changed",
+				"(root).size: type integer is no longer accepted",
+				"(root): property tags was removed and additional properties are not allowed",
+			},
+		},
+		{
+			"required with a default",
+			`{
+				"type": "object",
+				"required": ["name", "mode"],
+				"properties": {
+					"name": {"type": "string", "maxLength": 10},
+					"size": {"type": "integer", "minimum": 1, "maximum": 10},
+					"mode": {"type": "string", "enum": ["fast", "slow"]},
+					"tags": {"type": "array", "items": {"type": "string", "minLength": 1}}
+				}
+			}`,
+			TemplatePayload{"mode": "fast"},
+			[]string{"(root).tags[]: minLength 1 was added"},
+		},
+		{
+			"new property",
+			`{
+				"type": "object",
+				"required": ["name"],
+				"properties": {
+					"name": {"type": "string", "maxLength": 10},
+					"size": {"type": "integer", "minimum": 1, "maximum": 10},
+					"mode": {"type": "string", "enum": ["fast", "slow"]},
+					"tags": {"type": "array", "items": {"type": "string"}},
+					"extra": {"type": "integer"}
+				}
+			}`,
+			nil,
+			[]string{"(root): property extra is now restricted"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := SchemaIncompatibilities(schema(t, prev), schema(t, test.curr), test.defaults)
+			if strings.Join(got, "\n") != strings.Join(test.expected, "\n") {
+				t.Errorf("expected incompatibilities\n%s\ngot\n%s", strings.Join(test.expected, "\n"), strings.Join(got, "\n"))
+			}
+		})
+	}
+}
+
+func TestSchemaIncompatibilitiesAdditionalProperties(t *testing.T) {
+	curr := `{"type": "object", "properties": {"extra": {"type": "integer", "minimum": 1}}}`
+	tests := []struct {
+		name     string
+		prev     string
+		expected []string
+	}{
+		{"not allowed", `{"type": "object", "additionalProperties": false}`, nil},
+		{"allowed", `{"type": "object", "additionalProperties": true}`, []string{"(root): property extra is now restricted"}},
+		{"same schema", `{"type": "object", "additionalProperties": {"type": "integer", "minimum": 1}}`, nil},
+		{"wider schema", `{"type": "object", "additionalProperties": {"type": "integer"}}`, []string{"(root).extra: minimum 1 was added"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := SchemaIncompatibilities(schema(t, test.prev), schema(t, curr), nil)
+			if strings.Join(got, "\n") != strings.Join(test.expected, "\n") {
+				t.Errorf("expected incompatibilities\n%s\ngot\n%s", strings.Join(test.expected, "\n"), strings.Join(got, "\n"))
+			}
+		})
+	}
+}
+
+func TestValidateTemplateChannelName(t *testing.T) {
+	for _, channel := range []string{"stable", "canary", "team_a-prod"} {
+		if err := ValidateTemplateChannelName(channel); err != nil {
+			t.Errorf("expected channel %s to be valid, got %v", channel, err)
+		}
+	}
+	for _, channel := range []string{"latest", "3", "Stable", "", "has space"} {
+		if err := ValidateTemplateChannelName(channel); err == nil {
+			t.Errorf("expected channel %q to be refused", channel)
+		}
+	}
+}
+
+func TestTemplateDeprecation(t *testing.T) {
+	if err := (TemplateDeprecation{Level: "fail"}).Validate(); err == nil {
+		t.Errorf("expected unknown levels to be refused")
+	}
+	var unset *TemplateDeprecation
+	if unset.Blocks() {
+		t.Errorf("expected templates without deprecation not to block runs")
+	}
+	d := &TemplateDeprecation{Level: TemplateDeprecationBlock, Message: "use version 3"}
+	if !d.Blocks() {
+		t.Errorf("expected block deprecations to block runs")
+	}
+	warning := d.Warning(Template{TemplateName: "tpl", Version: 2})
+	if warning != "template [tpl] version [2] is deprecated: use version 3" {
+		t.Errorf("unexpected warning %q", warning)
+	}
+}
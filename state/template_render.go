@@ -0,0 +1,304 @@
+package state
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/Masterminds/sprig"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// TemplateFieldError is a field of a template payload rejected by the
+// template's schema.
+type TemplateFieldError struct {
+	// Field is the path of the field, eg. opts.level, or (root).
+	Field string `json:"field"`
+	// Type is the schema rule the field broke, eg. required or enum.
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// TemplatePayloadErrors are the fields of a payload rejected by a template's
+// schema.
+type TemplatePayloadErrors []TemplateFieldError
+
+func (e TemplatePayloadErrors) Error() string {
+	res := make([]string, len(e))
+	for i, fieldError := range e {
+		res[i] = fmt.Sprintf("%s: %s", fieldError.Field, fieldError.Message)
+	}
+	return strings.Join(res, "\n")
+}
+
+// TemplateRenderRequest is the body of requests previewing the command of a
+// template.
+type TemplateRenderRequest struct {
+	TemplatePayload TemplatePayload `json:"template_payload"`
+}
+
+// TemplateRender is the preview of the command of a template for a payload.
+type TemplateRender struct {
+	// Payload is the request's payload with the template's defaults merged in.
+	Payload TemplatePayload `json:"payload"`
+	Valid   bool            `json:"valid"`
+	Command string          `json:"command,omitempty"`
+	// Errors are the fields of the payload rejected by the schema.
+	Errors TemplatePayloadErrors `json:"errors,omitempty"`
+	// RenderError is why the command template failed to render the payload.
+	RenderError string `json:"render_error,omitempty"`
+}
+
+// TemplateLintSeverity tells whether a lint issue breaks the template's runs.
+type TemplateLintSeverity string
+
+const (
+	// TemplateLintError issues break the runs of the template.
+	TemplateLintError TemplateLintSeverity = "error"
+	// TemplateLintWarning issues may break some of the runs of the template.
+	TemplateLintWarning TemplateLintSeverity = "warning"
+)
+
+// TemplateLintIssue is a problem of the command template of a template.
+type TemplateLintIssue struct {
+	Severity TemplateLintSeverity `json:"severity"`
+	// Field is the payload key the command template refers to, if any.
+	Field string `json:"field,omitempty"`
+	// Location is where the issue is in the command template, eg. command:1:7.
+	Location string `json:"location,omitempty"`
+	Message  string `json:"message"`
+}
+
+// TemplateLint lists the issues of a command template.
+type TemplateLint struct {
+	Valid  bool                `json:"valid"`
+	Issues []TemplateLintIssue `json:"issues"`
+}
+
+// RenderCommand merges the template's defaults into the payload, validates it
+// against the template's schema and renders the command template with it.
+// Payloads rejected by the schema fail with TemplatePayloadErrors.
+func (t Template) RenderCommand(payload TemplatePayload) (string, TemplatePayload, error) {
+	if payload == nil {
+		payload = TemplatePayload{}
+	}
+	payload, err := t.compositeUserAndDefaults(payload)
+	if err != nil {
+		return "", payload, err
+	}
+	if err = t.ValidatePayload(payload); err != nil {
+		return "", payload, err
+	}
+
+	// Create a new template string based on the template.Template.
+	textTemplate, err := t.parseCommandTemplate()
+	if err != nil {
+		return "", payload, err
+	}
+
+	// Dump payload into the template string.
+	var result bytes.Buffer
+	if err = textTemplate.Execute(&result, payload); err != nil {
+		return "", payload, err
+	}
+	return result.String(), payload, nil
+}
+
+// ValidatePayload checks the payload against the template's schema, failing
+// with TemplatePayloadErrors when it's rejected.
+func (t Template) ValidatePayload(payload TemplatePayload) error {
+	schemaLoader := gojsonschema.NewGoLoader(t.Schema)
+	documentLoader := gojsonschema.NewGoLoader(payload)
+
+	validationResult, err := gojsonschema.Validate(schemaLoader, documentLoader)
+	if err != nil {
+		return err
+	}
+	if validationResult == nil || validationResult.Valid() {
+		return nil
+	}
+	var errs TemplatePayloadErrors
+	for _, resultError := range validationResult.Errors() {
+		errs = append(errs, TemplateFieldError{
+			Field:   resultError.Field(),
+			Type:    resultError.Type(),
+			Message: resultError.Description(),
+		})
+	}
+	return errs
+}
+
+func (t Template) parseCommandTemplate() (*template.Template, error) {
+	return template.New("command").Funcs(sprig.TxtFuncMap()).Parse(t.CommandTemplate)
+}
+
+// LintCommandTemplate checks the payload keys the command template refers to
+// against the template's schema and defaults. Keys the schema doesn't define
+// are errors when it doesn't allow additional properties, warnings otherwise;
+// optional keys without defaults are warnings unless guarded, as they render
+// as <no value> when missing. Keys are only followed where dot is the payload,
+// or through $.
+func (t Template) LintCommandTemplate() TemplateLint {
+	lint := TemplateLint{Valid: true, Issues: []TemplateLintIssue{}}
+	textTemplate, err := t.parseCommandTemplate()
+	if err != nil {
+		lint.Valid = false
+		lint.Issues = append(lint.Issues, TemplateLintIssue{Severity: TemplateLintError, Message: err.Error()})
+		return lint
+	}
+
+	collector := &templateRefCollector{
+		tree:    textTemplate.Tree,
+		refs:    map[string]templateRef{},
+		guarded: map[string]bool{},
+	}
+	collector.collect(textTemplate.Tree.Root, true, false)
+	paths := make([]string, 0, len(collector.refs))
+	for path := range collector.refs {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		ref := collector.refs[path]
+		if issue, ok := t.lintTemplateRef(ref, collector.guarded); ok {
+			issue.Field = path
+			issue.Location = ref.location
+			if issue.Severity == TemplateLintError {
+				lint.Valid = false
+			}
+			lint.Issues = append(lint.Issues, issue)
+		}
+	}
+	return lint
+}
+
+// templateRef is a payload key the command template refers to, along with
+// where it first does.
+type templateRef struct {
+	keys     []string
+	location string
+}
+
+func (t Template) lintTemplateRef(ref templateRef, guarded map[string]bool) (TemplateLintIssue, bool) {
+	schema := map[string]interface{}(t.Schema)
+	defaults := map[string]interface{}(t.Defaults)
+	for i, key := range ref.keys {
+		path := strings.Join(ref.keys[:i+1], ".")
+		properties := schemaMap(schema["properties"])
+		property, defined := properties[key]
+		_, defaulted := defaults[key]
+		if !defined {
+			if defaulted {
+				return TemplateLintIssue{}, false
+			}
+			if schema["additionalProperties"] == false {
+				return TemplateLintIssue{
+					Severity: TemplateLintError,
+					Message:  fmt.Sprintf("key %s isn't defined by the schema, which doesn't allow additional properties", path),
+				}, true
+			}
+			if properties == nil && schemaMap(schema["additionalProperties"]) == nil {
+				// A free form object, anything goes.
+				return TemplateLintIssue{}, false
+			}
+			return TemplateLintIssue{
+				Severity: TemplateLintWarning,
+				Message:  fmt.Sprintf("key %s isn't defined by the schema", path),
+			}, true
+		}
+		if !defaulted && !guarded[path] && !containsString(schemaStrings(schema["required"]), key) {
+			return TemplateLintIssue{
+				Severity: TemplateLintWarning,
+				Message:  fmt.Sprintf("key %s is neither required nor defaulted, it renders as <no value> when missing", path),
+			}, true
+		}
+		schema = schemaMap(property)
+		defaults = schemaMap(defaults[key])
+	}
+	return TemplateLintIssue{}, false
+}
+
+// templateRefCollector collects the payload keys referred to by a command
+// template. Dot is the payload until a range or a with changes it. Keys
+// tested by an if or a with, ranged over, or piped or given to default, are
+// guarded: they may be missing.
+type templateRefCollector struct {
+	tree    *parse.Tree
+	refs    map[string]templateRef
+	guarded map[string]bool
+}
+
+func (c *templateRefCollector) collect(node parse.Node, dotIsPayload bool, guard bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			c.collect(child, dotIsPayload, false)
+		}
+	case *parse.ActionNode:
+		c.collect(n.Pipe, dotIsPayload, false)
+	case *parse.IfNode:
+		c.collect(n.Pipe, dotIsPayload, true)
+		c.collect(n.List, dotIsPayload, false)
+		c.collect(n.ElseList, dotIsPayload, false)
+	case *parse.RangeNode:
+		c.collect(n.Pipe, dotIsPayload, true)
+		c.collect(n.List, false, false)
+		c.collect(n.ElseList, dotIsPayload, false)
+	case *parse.WithNode:
+		c.collect(n.Pipe, dotIsPayload, true)
+		c.collect(n.List, false, false)
+		c.collect(n.ElseList, dotIsPayload, false)
+	case *parse.TemplateNode:
+		c.collect(n.Pipe, dotIsPayload, false)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			guard = guard || isDefaultCommand(cmd)
+		}
+		for _, cmd := range n.Cmds {
+			c.collect(cmd, dotIsPayload, guard)
+		}
+	case *parse.CommandNode:
+		guard = guard || isDefaultCommand(n)
+		for _, arg := range n.Args {
+			c.collect(arg, dotIsPayload, guard)
+		}
+	case *parse.ChainNode:
+		c.collect(n.Node, dotIsPayload, guard)
+	case *parse.FieldNode:
+		if dotIsPayload {
+			c.add(n, n.Ident, guard)
+		}
+	case *parse.VariableNode:
+		if len(n.Ident) > 1 && n.Ident[0] == "$" {
+			c.add(n, n.Ident[1:], guard)
+		}
+	}
+}
+
+func (c *templateRefCollector) add(node parse.Node, keys []string, guard bool) {
+	path := strings.Join(keys, ".")
+	if guard {
+		c.guarded[path] = true
+	}
+	if _, ok := c.refs[path]; !ok {
+		location, _ := c.tree.ErrorContext(node)
+		c.refs[path] = templateRef{keys: keys, location: location}
+	}
+}
+
+func isDefaultCommand(cmd *parse.CommandNode) bool {
+	if len(cmd.Args) == 0 {
+		return false
+	}
+	ident, ok := cmd.Args[0].(*parse.IdentifierNode)
+	return ok && ident.Ident == "default"
+}
@@ -0,0 +1,91 @@
+package state
+
+import (
+	"testing"
+)
+
+func TestTemplate_RenderCommand(t *testing.T) {
+	tpl := Template{
+		Schema: schema(t, `{
+			"type": "object",
+			"required": ["name", "count"],
+			"properties": {
+				"name": {"type": "string"},
+				"count": {"type": "integer", "maximum": 3},
+				"greeting": {"type": "string"}
+			}
+		}`),
+		CommandTemplate: `echo {{.greeting}} {{.name}} {{.count}}`,
+		Defaults:        TemplatePayload{"greeting": "hello"},
+	}
+
+	command, payload, err := tpl.RenderCommand(TemplatePayload{"name": "world", "count": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if command != "echo hello world 2" || payload["greeting"] != "hello" {
+		t.Errorf("expected the defaults to be merged in, got %q %v", command, payload)
+	}
+
+	_, _, err = tpl.RenderCommand(TemplatePayload{"count": 5})
+	errs, ok := err.(TemplatePayloadErrors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("expected an error per rejected field, got %#v", err)
+	}
+	fields := map[string]string{}
+	for _, e := range errs {
+		fields[e.Field] = e.Type
+	}
+	if fields["name"] != "required" || fields["count"] != "number_lte" {
+		t.Errorf("unexpected field errors %+v", errs)
+	}
+}
+
+func TestTemplate_LintCommandTemplate(t *testing.T) {
+	tpl := Template{
+		Schema: schema(t, `{
+			"type": "object",
+			"required": ["name", "opts"],
+			"properties": {
+				"name": {"type": "string"},
+				"verbose": {"type": "boolean"},
+				"suffix": {"type": "string"},
+				"opts": {
+					"type": "object",
+					"additionalProperties": false,
+					"properties": {"level": {"type": "integer"}}
+				},
+				"files": {"type": "array", "items": {"type": "string"}}
+			}
+		}`),
+		CommandTemplate: `run {{.name}}{{.suffix}} {{if .verbose}}-v{{end}} --level {{.opts.level | default 1}} --mode {{.opts.mode}} {{.extra}}` +
+			` {{range .files}}{{.}} {{$.name}}{{end}} {{.greeting}}`,
+		Defaults: TemplatePayload{"greeting": "hi"},
+	}
+
+	lint := tpl.LintCommandTemplate()
+	if lint.Valid {
+		t.Errorf("expected keys the schema can't hold to make the template invalid")
+	}
+	expected := map[string]TemplateLintSeverity{
+		"extra":     TemplateLintWarning,
+		"opts.mode": TemplateLintError,
+		"suffix":    TemplateLintWarning,
+	}
+	if len(lint.Issues) != len(expected) {
+		t.Errorf("expected %d issues, got %+v", len(expected), lint.Issues)
+	}
+	for _, issue := range lint.Issues {
+		if expected[issue.Field] != issue.Severity {
+			t.Errorf("unexpected issue %+v", issue)
+		}
+		if len(issue.Location) == 0 {
+			t.Errorf("expected issue %+v to be located", issue)
+		}
+	}
+
+	tpl.CommandTemplate = "echo {{.name"
+	if lint = tpl.LintCommandTemplate(); lint.Valid || len(lint.Issues) != 1 {
+		t.Errorf("expected command templates which don't parse to be invalid, got %+v", lint)
+	}
+}
@@ -0,0 +1,159 @@
+package state
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stitchfix/flotilla-os/config"
+)
+
+// Worker scopes: instance workers run on every Flotilla instance, leader
+// workers only on the instance holding the leader lease.
+const (
+	WorkerScopeInstance = "instance"
+	WorkerScopeLeader   = "leader"
+)
+
+// WorkerLeaderLease is the name of the lease held by the leader instance.
+const WorkerLeaderLease = "worker_leader"
+
+// HashRingReplicas is the number of points each instance has on the hash ring
+// the runs are sharded with.
+const HashRingReplicas = 64
+
+// WorkerTopologyTTL is how long instances and the leader lease live without
+// a heartbeat: `worker_topology_ttl`, by default 3 times the worker manager's
+// poll interval and at least 30s.
+func WorkerTopologyTTL(conf config.Config) (time.Duration, error) {
+	if conf == nil {
+		return 30 * time.Second, nil
+	}
+	if conf.IsSet("worker_topology_ttl") {
+		ttl, err := time.ParseDuration(conf.GetString("worker_topology_ttl"))
+		if err != nil {
+			return ttl, errors.Wrap(err, "problem parsing worker_topology_ttl")
+		}
+		if ttl <= 0 {
+			return ttl, errors.Errorf("worker_topology_ttl must be positive, got %s", ttl)
+		}
+		return ttl, nil
+	}
+	ttl := 30 * time.Second
+	if interval, err := time.ParseDuration(conf.GetString("worker_worker_manager_interval")); err == nil && 3*interval > ttl {
+		ttl = 3 * interval
+	}
+	return ttl, nil
+}
+
+// IsValidWorkerScope checks that the given scope is one of the worker scopes.
+func IsValidWorkerScope(scope string) bool {
+	return scope == WorkerScopeInstance || scope == WorkerScopeLeader
+}
+
+// WorkerCounts is the number of workers of each type running on an instance.
+type WorkerCounts map[string]int
+
+// WorkerInstance is a Flotilla instance running workers. Instances heartbeat
+// while they run and are dropped from the topology once their heartbeat is
+// older than the topology's ttl.
+type WorkerInstance struct {
+	InstanceID  string       `json:"instance_id" db:"instance_id"`
+	Hostname    string       `json:"hostname" db:"hostname"`
+	StartedAt   time.Time    `json:"started_at" db:"started_at"`
+	HeartbeatAt time.Time    `json:"heartbeat_at" db:"heartbeat_at"`
+	Workers     WorkerCounts `json:"workers" db:"workers"`
+	Leader      bool         `json:"leader" db:"-"`
+	// Share of the runs swept by the instance's status workers.
+	ShardShare float64 `json:"shard_share" db:"-"`
+}
+
+// WorkerLease is a named lease held by one instance until it expires.
+type WorkerLease struct {
+	Name       string    `json:"name" db:"name"`
+	Holder     string    `json:"holder" db:"holder"`
+	AcquiredAt time.Time `json:"acquired_at" db:"acquired_at"`
+	ExpiresAt  time.Time `json:"expires_at" db:"expires_at"`
+}
+
+// WorkerTopology is which instance runs which workers: the live instances,
+// their share of the runs and the leader running the leader workers.
+type WorkerTopology struct {
+	Leader    *WorkerLease     `json:"leader"`
+	Instances []WorkerInstance `json:"instances"`
+	Workers   []Worker         `json:"workers"`
+}
+
+// HashRing places instances on a consistent hash ring, each run belonging to
+// the first instance after it on the ring. Adding or removing an instance
+// only moves the runs of its neighbours.
+type HashRing struct {
+	points  []uint32
+	owners  map[uint32]string
+	members []string
+}
+
+// NewHashRing places the members on a ring with the given number of points
+// per member.
+func NewHashRing(members []string, replicas int) *HashRing {
+	r := &HashRing{owners: map[uint32]string{}}
+	r.members = append(r.members, members...)
+	sort.Strings(r.members)
+	for _, m := range r.members {
+		for i := 0; i < replicas; i++ {
+			p := hashKey(m + "#" + strconv.Itoa(i))
+			if _, taken := r.owners[p]; taken {
+				continue
+			}
+			r.owners[p] = m
+			r.points = append(r.points, p)
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+	return r
+}
+
+// Members are the members of the ring, sorted.
+func (r *HashRing) Members() []string {
+	return r.members
+}
+
+// Owner is the member owning the key, empty when the ring has no members.
+func (r *HashRing) Owner(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	h := hashKey(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
+
+// Shares is the share of the hash space owned by each member.
+func (r *HashRing) Shares() map[string]float64 {
+	shares := map[string]float64{}
+	if len(r.points) == 0 {
+		return shares
+	}
+	const space = float64(1 << 32)
+	for i, p := range r.points {
+		var arc float64
+		if i == 0 {
+			arc = float64(p) + space - float64(r.points[len(r.points)-1])
+		} else {
+			arc = float64(p) - float64(r.points[i-1])
+		}
+		shares[r.owners[p]] += arc / space
+	}
+	return shares
+}
+
+func hashKey(key string) uint32 {
+	sum := md5.Sum([]byte(key))
+	return binary.BigEndian.Uint32(sum[:4])
+}
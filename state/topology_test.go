@@ -0,0 +1,62 @@
+package state
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stitchfix/flotilla-os/config"
+)
+
+func TestHashRing(t *testing.T) {
+	ring := NewHashRing([]string{"c", "a", "b"}, HashRingReplicas)
+	owned := map[string]int{}
+	before := map[string]string{}
+	for i := 0; i < 3000; i++ {
+		key := fmt.Sprintf("run-%d", i)
+		before[key] = ring.Owner(key)
+		owned[before[key]]++
+	}
+	for _, m := range []string{"a", "b", "c"} {
+		if owned[m] < 500 {
+			t.Errorf("expected the runs to be spread across the members, got %v", owned)
+		}
+	}
+	total := 0.0
+	for _, share := range ring.Shares() {
+		total += share
+	}
+	if math.Abs(total-1) > 1e-9 {
+		t.Errorf("expected the shares to cover the ring, got %v", ring.Shares())
+	}
+
+	// Removing a member only moves its own runs
+	ring = NewHashRing([]string{"a", "b"}, HashRingReplicas)
+	for key, owner := range before {
+		if owner != "c" && ring.Owner(key) != owner {
+			t.Fatalf("expected run %s to stay on %s, moved to %s", key, owner, ring.Owner(key))
+		}
+	}
+
+	if owner := NewHashRing(nil, HashRingReplicas).Owner("run"); owner != "" {
+		t.Errorf("expected no owner on an empty ring, got %s", owner)
+	}
+	if shares := NewHashRing([]string{"a"}, HashRingReplicas).Shares(); shares["a"] != 1 {
+		t.Errorf("expected a single member to own the whole ring, got %v", shares)
+	}
+}
+
+func TestWorkerTopologyTTL(t *testing.T) {
+	t.Setenv("WORKER_TOPOLOGY_TTL", "45s")
+	conf, _ := config.NewConfig(nil)
+	if ttl, err := WorkerTopologyTTL(conf); err != nil || ttl != 45*time.Second {
+		t.Errorf("expected the configured ttl, got %s, %v", ttl, err)
+	}
+	for _, ttl := range []string{"0s", "-1m"} {
+		t.Setenv("WORKER_TOPOLOGY_TTL", ttl)
+		if _, err := WorkerTopologyTTL(conf); err == nil {
+			t.Errorf("expected ttl [%s] to be refused", ttl)
+		}
+	}
+}
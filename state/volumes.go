@@ -0,0 +1,237 @@
+package state
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// VolumeType is the kind of storage backing a volume.
+type VolumeType string
+
+const (
+	// VolumeTypePVC mounts an existing persistent volume claim.
+	VolumeTypePVC VolumeType = "pvc"
+	// VolumeTypeEphemeral mounts a claim created for the pod and deleted
+	// with it.
+	VolumeTypeEphemeral VolumeType = "ephemeral"
+	// VolumeTypeConfigMap mounts a config map, always read-only.
+	VolumeTypeConfigMap VolumeType = "config_map"
+	// VolumeTypeS3 mounts an S3 bucket through the claim of its
+	// mountpoint-s3 CSI volume.
+	VolumeTypeS3 VolumeType = "s3"
+)
+
+// Volume is a volume mounted into the main container of a run (the driver
+// and executors of Spark runs).
+type Volume struct {
+	Name      string     `json:"name"`
+	Type      VolumeType `json:"type"`
+	MountPath string     `json:"mount_path"`
+	// SubPath mounts a directory of the volume, the key prefix of S3 volumes.
+	SubPath  string `json:"sub_path,omitempty"`
+	ReadOnly bool   `json:"read_only,omitempty"`
+	// ClaimName is the claim of pvc volumes, and of s3 volumes once resolved
+	// against the cluster's volume policy.
+	ClaimName string `json:"claim_name,omitempty"`
+	// StorageClass and Size (GiB) of ephemeral volumes.
+	StorageClass string `json:"storage_class,omitempty"`
+	Size         *int64 `json:"size,omitempty"`
+	ConfigMap    string `json:"config_map,omitempty"`
+	Bucket       string `json:"bucket,omitempty"`
+}
+
+// Volumes is a list of volumes.
+type Volumes []Volume
+
+// VolumePolicy is the allow-list of the volumes runs may mount on a cluster.
+// It is stored per cluster alongside the ClusterMetadata; clusters without
+// one don't allow any volume.
+type VolumePolicy struct {
+	Claims         []string `json:"claims,omitempty"`
+	StorageClasses []string `json:"storage_classes,omitempty"`
+	// MaxEphemeralSize caps the size of ephemeral volumes, in GiB, 0 leaves
+	// them uncapped.
+	MaxEphemeralSize int64    `json:"max_ephemeral_size,omitempty"`
+	ConfigMaps       []string `json:"config_maps,omitempty"`
+	// Buckets maps the S3 buckets runs may mount to the claims bound to
+	// their mountpoint-s3 CSI volumes.
+	Buckets map[string]string `json:"buckets,omitempty"`
+}
+
+// reservedRunVolumeNames are the names of volumes flotilla adds to the pods
+// of runs itself.
+var reservedRunVolumeNames = append([]string{"shared-lib-volume"}, ReservedVolumeNames...)
+
+// Validate returns the reasons the volumes are malformed, if any.
+func (vs Volumes) Validate() []string {
+	var reasons []string
+	names := map[string]bool{}
+	paths := map[string]bool{}
+	for _, v := range vs {
+		switch {
+		case !containerNamePattern.MatchString(v.Name) || len(v.Name) > 63:
+			reasons = append(reasons, fmt.Sprintf("volume name [%s] must be a lowercase DNS label", v.Name))
+		case names[v.Name]:
+			reasons = append(reasons, fmt.Sprintf("volume [%s] is declared more than once", v.Name))
+		}
+		names[v.Name] = true
+		for _, reserved := range reservedRunVolumeNames {
+			if v.Name == reserved {
+				reasons = append(reasons, fmt.Sprintf("volume name [%s] is reserved", v.Name))
+			}
+		}
+		if !strings.HasPrefix(v.MountPath, "/") {
+			reasons = append(reasons, fmt.Sprintf("volume [%s] must be mounted at an absolute path", v.Name))
+		} else if paths[v.MountPath] {
+			reasons = append(reasons, fmt.Sprintf("more than one volume is mounted at [%s]", v.MountPath))
+		}
+		paths[v.MountPath] = true
+		if strings.HasPrefix(v.SubPath, "/") || strings.Contains(v.SubPath, "..") {
+			reasons = append(reasons, fmt.Sprintf("sub path of volume [%s] must be relative", v.Name))
+		}
+
+		switch v.Type {
+		case VolumeTypePVC:
+			if len(v.ClaimName) == 0 {
+				reasons = append(reasons, fmt.Sprintf("pvc volume [%s] must specify a [claim_name]", v.Name))
+			}
+		case VolumeTypeEphemeral:
+			if len(v.StorageClass) == 0 || v.Size == nil || *v.Size < 1 {
+				reasons = append(reasons, fmt.Sprintf("ephemeral volume [%s] must specify a [storage_class] and a positive [size]", v.Name))
+			}
+		case VolumeTypeConfigMap:
+			if len(v.ConfigMap) == 0 {
+				reasons = append(reasons, fmt.Sprintf("config_map volume [%s] must specify a [config_map]", v.Name))
+			}
+		case VolumeTypeS3:
+			if len(v.Bucket) == 0 {
+				reasons = append(reasons, fmt.Sprintf("s3 volume [%s] must specify a [bucket]", v.Name))
+			}
+		default:
+			reasons = append(reasons, fmt.Sprintf("volume [%s] has unknown type [%s]", v.Name, v.Type))
+		}
+	}
+	return reasons
+}
+
+// Resolve checks the volumes against the allow-list and returns them with
+// the claims of S3 buckets filled in, along with the reasons any volume
+// isn't allowed.
+func (p *VolumePolicy) Resolve(vs Volumes) (Volumes, []string) {
+	if p == nil {
+		p = &VolumePolicy{}
+	}
+	var reasons []string
+	resolved := make(Volumes, len(vs))
+	for i, v := range vs {
+		switch v.Type {
+		case VolumeTypePVC:
+			if !containsString(p.Claims, v.ClaimName) {
+				reasons = append(reasons, fmt.Sprintf("claim [%s] is not allowed on this cluster", v.ClaimName))
+			}
+		case VolumeTypeEphemeral:
+			if !containsString(p.StorageClasses, v.StorageClass) {
+				reasons = append(reasons, fmt.Sprintf("storage class [%s] is not allowed on this cluster", v.StorageClass))
+			}
+			if p.MaxEphemeralSize > 0 && v.Size != nil && *v.Size > p.MaxEphemeralSize {
+				reasons = append(reasons, fmt.Sprintf("ephemeral volume [%s] exceeds the maximum size of %dGi", v.Name, p.MaxEphemeralSize))
+			}
+		case VolumeTypeConfigMap:
+			if !containsString(p.ConfigMaps, v.ConfigMap) {
+				reasons = append(reasons, fmt.Sprintf("config map [%s] is not allowed on this cluster", v.ConfigMap))
+			}
+		case VolumeTypeS3:
+			claim, ok := p.Buckets[v.Bucket]
+			if !ok {
+				reasons = append(reasons, fmt.Sprintf("bucket [%s] is not allowed on this cluster", v.Bucket))
+			}
+			v.ClaimName = claim
+		}
+		resolved[i] = v
+	}
+	return resolved, reasons
+}
+
+// MergeVolumes returns the volumes of an executable with those of a request
+// on top, a request's volume replacing the executable's volume of the same
+// name.
+func MergeVolumes(base *Volumes, overrides *Volumes) Volumes {
+	var merged Volumes
+	replaced := map[string]bool{}
+	if overrides != nil {
+		for _, v := range *overrides {
+			replaced[v.Name] = true
+		}
+	}
+	if base != nil {
+		for _, v := range *base {
+			if !replaced[v.Name] {
+				merged = append(merged, v)
+			}
+		}
+	}
+	if overrides != nil {
+		merged = append(merged, *overrides...)
+	}
+	return merged
+}
+
+// KubernetesVolumes returns the pod volumes and the container mounts of the
+// volumes, the same for EKS jobs and Spark driver and executor pods.
+func (vs Volumes) KubernetesVolumes() ([]corev1.Volume, []corev1.VolumeMount) {
+	var volumes []corev1.Volume
+	var mounts []corev1.VolumeMount
+	for _, v := range vs {
+		source := corev1.VolumeSource{}
+		readOnly := v.ReadOnly
+		switch v.Type {
+		case VolumeTypePVC, VolumeTypeS3:
+			source.PersistentVolumeClaim = &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: v.ClaimName,
+				ReadOnly:  readOnly,
+			}
+		case VolumeTypeEphemeral:
+			storageClass := v.StorageClass
+			source.Ephemeral = &corev1.EphemeralVolumeSource{
+				VolumeClaimTemplate: &corev1.PersistentVolumeClaimTemplate{
+					Spec: corev1.PersistentVolumeClaimSpec{
+						AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+						StorageClassName: &storageClass,
+						Resources: corev1.VolumeResourceRequirements{
+							Requests: corev1.ResourceList{
+								corev1.ResourceStorage: resource.MustParse(fmt.Sprintf("%dGi", *v.Size)),
+							},
+						},
+					},
+				},
+			}
+		case VolumeTypeConfigMap:
+			readOnly = true
+			source.ConfigMap = &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: v.ConfigMap},
+			}
+		default:
+			continue
+		}
+		volumes = append(volumes, corev1.Volume{Name: v.Name, VolumeSource: source})
+		mounts = append(mounts, corev1.VolumeMount{
+			Name:      v.Name,
+			MountPath: v.MountPath,
+			SubPath:   v.SubPath,
+			ReadOnly:  readOnly,
+		})
+	}
+	return volumes, mounts
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package state
+
+import "testing"
+
+func TestVolumes_ValidateAndResolve(t *testing.T) {
+	size := int64(50)
+	volumes := MergeVolumes(
+		&Volumes{
+			{Name: "scratch", Type: VolumeTypeEphemeral, StorageClass: "gp3", Size: &size, MountPath: "/scratch"},
+			{Name: "data", Type: VolumeTypePVC, ClaimName: "old-claim", MountPath: "/data"},
+		},
+		&Volumes{
+			{Name: "data", Type: VolumeTypeS3, Bucket: "bucket", SubPath: "inputs", MountPath: "/data", ReadOnly: true},
+			{Name: "config", Type: VolumeTypeConfigMap, ConfigMap: "app", MountPath: "/etc/app"},
+		})
+	if len(volumes) != 3 || volumes[1].Type != VolumeTypeS3 {
+		t.Fatalf("expected the request's volume to replace the definition's, got %+v", volumes)
+	}
+	if reasons := volumes.Validate(); len(reasons) != 0 {
+		t.Fatalf("expected valid volumes, got %v", reasons)
+	}
+
+	policy := &VolumePolicy{
+		StorageClasses:   []string{"gp3"},
+		MaxEphemeralSize: 100,
+		ConfigMaps:       []string{"app"},
+		Buckets:          map[string]string{"bucket": "s3-bucket"},
+	}
+	resolved, reasons := policy.Resolve(volumes)
+	if len(reasons) != 0 {
+		t.Fatalf("expected the volumes to be allowed, got %v", reasons)
+	}
+	if resolved[1].ClaimName != "s3-bucket" {
+		t.Errorf("expected the bucket's claim, got %q", resolved[1].ClaimName)
+	}
+	if _, reasons := (*VolumePolicy)(nil).Resolve(volumes); len(reasons) != 3 {
+		t.Errorf("expected no volume allowed without a policy, got %v", reasons)
+	}
+
+	podVolumes, mounts := resolved.KubernetesVolumes()
+	if len(podVolumes) != 3 || len(mounts) != 3 {
+		t.Fatalf("expected 3 volumes and mounts, got %d and %d", len(podVolumes), len(mounts))
+	}
+	if podVolumes[0].Ephemeral == nil || *podVolumes[0].Ephemeral.VolumeClaimTemplate.Spec.StorageClassName != "gp3" {
+		t.Errorf("expected an ephemeral claim, got %+v", podVolumes[0])
+	}
+	if podVolumes[1].PersistentVolumeClaim == nil || podVolumes[1].PersistentVolumeClaim.ClaimName != "s3-bucket" ||
+		!mounts[1].ReadOnly || mounts[1].SubPath != "inputs" {
+		t.Errorf("expected a read-only mount of the bucket's claim, got %+v %+v", podVolumes[1], mounts[1])
+	}
+	if podVolumes[2].ConfigMap == nil || !mounts[2].ReadOnly {
+		t.Errorf("expected a read-only config map, got %+v %+v", podVolumes[2], mounts[2])
+	}
+
+	invalid := Volumes{
+		{Name: "dockersock", Type: VolumeTypePVC, MountPath: "relative"},
+		{Name: "big", Type: VolumeTypeEphemeral, MountPath: "/big"},
+		{Name: "nfs", Type: "nfs", MountPath: "/big"},
+	}
+	// Reserved name, relative path, missing claim, missing ephemeral size,
+	// repeated mount path and unknown type.
+	if reasons := invalid.Validate(); len(reasons) != 6 {
+		t.Errorf("expected 6 reasons, got %v", reasons)
+	}
+}
@@ -5,14 +5,21 @@ import (
 	"fmt"
 	"math"
 	"net/http"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 
+	"github.com/stitchfix/flotilla-os/clients/logs"
+	"github.com/stitchfix/flotilla-os/clients/registry"
 	"github.com/stitchfix/flotilla-os/config"
+	"github.com/stitchfix/flotilla-os/exceptions"
 	"github.com/stitchfix/flotilla-os/execution/engine"
 	"github.com/stitchfix/flotilla-os/queue"
 	"github.com/stitchfix/flotilla-os/state"
+	"github.com/stitchfix/flotilla-os/tracing"
 )
 
 // ImplementsAllTheThings defines a struct which implements many of the interfaces
@@ -30,11 +37,20 @@ type ImplementsAllTheThings struct {
 	StatusUpdatesAsRuns     []state.Run                 // List of queued status updates (Execution Engine)
 	ExecuteError            error                       // Execution Engine - error to return
 	ExecuteErrorIsRetryable bool                        // Execution Engine - is the run retryable?
+	TerminateError          error                       // Execution Engine - error to return when terminating
 	Groups                  []string
 	Tags                    []string
 	Templates               map[string]state.Template
 	ClusterStates           []state.ClusterMetadata
+	DebugSessions           map[string]state.DebugSession
+	TemplateChannels        map[string]state.TemplateChannel
+	Settings                map[string]state.Setting
+	SettingChanges          []state.SettingChange
+	LatencyStats            []state.RunLatencyStats
+	WorkerInstances         map[string]state.WorkerInstance
+	WorkerLeases            map[string]state.WorkerLease
 	GetRandomClusterName    func(clusters []string) string
+	LogLines                []logs.LogLine // Lines returned by log searches
 }
 
 func (iatt *ImplementsAllTheThings) GetResources(ctx context.Context, runID string) (state.Run, error) {
@@ -77,6 +93,19 @@ func (iatt *ImplementsAllTheThings) LogsText(executable state.Executable, run st
 	return nil
 }
 
+// SearchLogs - Logs Client
+func (iatt *ImplementsAllTheThings) SearchLogs(executable state.Executable, run state.Run, query logs.LogQuery) (logs.LogSearchResult, error) {
+	iatt.Calls = append(iatt.Calls, "SearchLogs")
+	lines := append([]logs.LogLine{}, iatt.LogLines...)
+	return logs.LogSearchResult{Lines: lines, Total: len(lines)}, nil
+}
+
+// DownloadLogs - Logs Client
+func (iatt *ImplementsAllTheThings) DownloadLogs(executable state.Executable, run state.Run, query logs.LogQuery, w http.ResponseWriter) error {
+	iatt.Calls = append(iatt.Calls, "DownloadLogs")
+	return nil
+}
+
 func (iatt *ImplementsAllTheThings) Log(keyvals ...interface{}) error {
 	iatt.Calls = append(iatt.Calls, "Name")
 	return nil
@@ -116,6 +145,32 @@ func (iatt *ImplementsAllTheThings) GetPodReAttemptRate(ctx context.Context) (fl
 	return 1.0, nil
 }
 
+func (iatt *ImplementsAllTheThings) CountActiveRuns(ctx context.Context) ([]state.RunStatusCount, error) {
+	iatt.Calls = append(iatt.Calls, "CountActiveRuns")
+	counts := map[state.RunStatusCount]int64{}
+	for _, run := range iatt.Runs {
+		if run.Status == state.StatusStopped {
+			continue
+		}
+		count := state.RunStatusCount{ClusterName: run.ClusterName, Status: run.Status}
+		if run.Engine != nil {
+			count.Engine = *run.Engine
+		}
+		counts[count]++
+	}
+	var res []state.RunStatusCount
+	for count, runs := range counts {
+		count.Runs = runs
+		res = append(res, count)
+	}
+	return res, nil
+}
+
+func (iatt *ImplementsAllTheThings) GetRunLatencyStats(ctx context.Context, q state.RunLatencyQuery) ([]state.RunLatencyStats, error) {
+	iatt.Calls = append(iatt.Calls, "GetRunLatencyStats")
+	return iatt.LatencyStats, nil
+}
+
 func (iatt *ImplementsAllTheThings) GetNodeLifecycle(ctx context.Context, executableID string, commandHash string) (string, error) {
 	iatt.Calls = append(iatt.Calls, "GetNodeLifecycle")
 	return "spot", nil
@@ -223,6 +278,15 @@ func (iatt *ImplementsAllTheThings) CreateRun(ctx context.Context, r state.Run)
 	return nil
 }
 
+// CreateRuns - StateManager
+func (iatt *ImplementsAllTheThings) CreateRuns(ctx context.Context, runs []state.Run) error {
+	iatt.Calls = append(iatt.Calls, "CreateRuns")
+	for _, r := range runs {
+		iatt.Runs[r.RunID] = r
+	}
+	return nil
+}
+
 func (iatt *ImplementsAllTheThings) EstimateRunResources(ctx context.Context, executableID string, command string) (state.TaskResources, error) {
 	iatt.Calls = append(iatt.Calls, "EstimateRunResources")
 	return state.TaskResources{}, nil
@@ -298,6 +362,75 @@ func (iatt *ImplementsAllTheThings) BatchUpdateWorkers(ctx context.Context, upda
 	return state.WorkersList{Total: len(iatt.Workers), Workers: iatt.Workers}, nil
 }
 
+// HeartbeatWorkerInstance - StateManager
+func (iatt *ImplementsAllTheThings) HeartbeatWorkerInstance(ctx context.Context, instance state.WorkerInstance) error {
+	iatt.Calls = append(iatt.Calls, "HeartbeatWorkerInstance")
+	if iatt.WorkerInstances == nil {
+		iatt.WorkerInstances = map[string]state.WorkerInstance{}
+	}
+	instance.HeartbeatAt = time.Now()
+	iatt.WorkerInstances[instance.InstanceID] = instance
+	return nil
+}
+
+// ListWorkerInstances - StateManager
+func (iatt *ImplementsAllTheThings) ListWorkerInstances(ctx context.Context, ttl time.Duration) ([]state.WorkerInstance, error) {
+	iatt.Calls = append(iatt.Calls, "ListWorkerInstances")
+	var instances []state.WorkerInstance
+	for _, instance := range iatt.WorkerInstances {
+		if time.Since(instance.HeartbeatAt) <= ttl {
+			instances = append(instances, instance)
+		}
+	}
+	sort.Slice(instances, func(i, j int) bool { return instances[i].InstanceID < instances[j].InstanceID })
+	return instances, nil
+}
+
+// DeleteWorkerInstance - StateManager
+func (iatt *ImplementsAllTheThings) DeleteWorkerInstance(ctx context.Context, instanceID string) error {
+	iatt.Calls = append(iatt.Calls, "DeleteWorkerInstance")
+	delete(iatt.WorkerInstances, instanceID)
+	return nil
+}
+
+// AcquireWorkerLease - StateManager
+func (iatt *ImplementsAllTheThings) AcquireWorkerLease(ctx context.Context, name string, holder string, ttl time.Duration) (state.WorkerLease, error) {
+	iatt.Calls = append(iatt.Calls, "AcquireWorkerLease")
+	if iatt.WorkerLeases == nil {
+		iatt.WorkerLeases = map[string]state.WorkerLease{}
+	}
+	now := time.Now()
+	lease, ok := iatt.WorkerLeases[name]
+	if ok && lease.Holder != holder && lease.ExpiresAt.After(now) {
+		return lease, nil
+	}
+	if !ok || lease.Holder != holder {
+		lease = state.WorkerLease{Name: name, Holder: holder, AcquiredAt: now}
+	}
+	lease.ExpiresAt = now.Add(ttl)
+	iatt.WorkerLeases[name] = lease
+	return lease, nil
+}
+
+// GetWorkerLease - StateManager
+func (iatt *ImplementsAllTheThings) GetWorkerLease(ctx context.Context, name string) (state.WorkerLease, error) {
+	iatt.Calls = append(iatt.Calls, "GetWorkerLease")
+	lease, ok := iatt.WorkerLeases[name]
+	if !ok {
+		return lease, exceptions.MissingResource{ErrorString: fmt.Sprintf("Worker lease %s not found", name)}
+	}
+	return lease, nil
+}
+
+// ReleaseWorkerLease - StateManager
+func (iatt *ImplementsAllTheThings) ReleaseWorkerLease(ctx context.Context, name string, holder string) error {
+	iatt.Calls = append(iatt.Calls, "ReleaseWorkerLease")
+	if lease, ok := iatt.WorkerLeases[name]; ok && lease.Holder == holder {
+		delete(iatt.WorkerLeases, name)
+	}
+	return nil
+}
+
 // QurlFor - QueueManager
 func (iatt *ImplementsAllTheThings) QurlFor(name string, prefixed bool) (string, error) {
 	iatt.Calls = append(iatt.Calls, "QurlFor")
@@ -322,6 +455,11 @@ func (iatt *ImplementsAllTheThings) ReceiveRun(qURL string) (queue.RunReceipt, e
 	iatt.Queued = iatt.Queued[1:]
 	receipt := queue.RunReceipt{
 		Run: &state.Run{RunID: popped},
+		TraceContext: tracing.TextMapCarrier{
+			"x-datadog-trace-id":          "1111",
+			"x-datadog-parent-id":         "1111111",
+			"x-datadog-sampling-priority": "1",
+		},
 	}
 	receipt.Done = func() error {
 		iatt.Calls = append(iatt.Calls, "RunReceipt.Done")
@@ -401,6 +539,18 @@ func (iatt *ImplementsAllTheThings) IsImageValid(imageRef string) (bool, error)
 	return true, nil
 }
 
+// ResolveImage - Registry Client
+func (iatt *ImplementsAllTheThings) ResolveImage(imageRef string) (registry.Image, error) {
+	iatt.Calls = append(iatt.Calls, "ResolveImage")
+	if imageRef == "invalidimage" {
+		return registry.Image{}, exceptions.MissingResource{ErrorString: fmt.Sprintf("image [%s] was not found", imageRef)}
+	}
+	return registry.Image{
+		Reference: registry.Reference{Registry: "docker.io", Repository: imageRef, Tag: "latest"},
+		Digest:    fmt.Sprintf("sha256:%x", imageRef),
+	}, nil
+}
+
 func (iatt *ImplementsAllTheThings) PollRunStatus(ctx context.Context) (state.Run, error) {
 	iatt.Calls = append(iatt.Calls, "PollRunStatus")
 	return state.Run{}, nil
@@ -419,12 +569,17 @@ func (iatt *ImplementsAllTheThings) PollRuns(ctx context.Context) ([]engine.RunR
 	iatt.Queued = iatt.Queued[1:]
 	receipt := queue.RunReceipt{
 		Run: &state.Run{RunID: popped},
+		TraceContext: tracing.TextMapCarrier{
+			"x-datadog-trace-id":          "1111",
+			"x-datadog-parent-id":         "1111111",
+			"x-datadog-sampling-priority": "1",
+		},
 	}
 	receipt.Done = func() error {
 		iatt.Calls = append(iatt.Calls, "RunReceipt.Done")
 		return nil
 	}
-	r = append(r, engine.RunReceipt{receipt, 1111, 1111111, 1})
+	r = append(r, engine.RunReceipt{RunReceipt: receipt})
 	return r, nil
 }
 
@@ -446,7 +601,7 @@ func (iatt *ImplementsAllTheThings) PollStatus(ctx context.Context) (engine.RunR
 		iatt.Calls = append(iatt.Calls, "StatusReceipt.Done")
 		return nil
 	}
-	return engine.RunReceipt{receipt, 1111, 1111111, 1}, nil
+	return engine.RunReceipt{RunReceipt: receipt}, nil
 }
 
 // Execute - Execution Engine
@@ -455,10 +610,52 @@ func (iatt *ImplementsAllTheThings) Execute(ctx context.Context, executable stat
 	return state.Run{}, iatt.ExecuteErrorIsRetryable, iatt.ExecuteError
 }
 
+// Render - Execution Engine
+func (iatt *ImplementsAllTheThings) Render(ctx context.Context, executable state.Executable, run state.Run, manager state.Manager) (engine.RenderedRun, error) {
+	iatt.Calls = append(iatt.Calls, "Render")
+	return engine.RenderedRun{Run: run}, nil
+}
+
+// StartDebugSession - Execution Engine
+func (iatt *ImplementsAllTheThings) StartDebugSession(ctx context.Context, executable state.Executable, run state.Run, session state.DebugSession, manager state.Manager) (state.DebugSession, error) {
+	iatt.Calls = append(iatt.Calls, "StartDebugSession")
+	session.Namespace = "flotilla"
+	session.Container = run.RunID
+	if session.Mode == state.DebugModeTwin {
+		session.JobName = session.SessionID
+	} else if run.PodName != nil {
+		session.PodName = *run.PodName
+	}
+	return session, nil
+}
+
+// StopDebugSession - Execution Engine
+func (iatt *ImplementsAllTheThings) StopDebugSession(ctx context.Context, session state.DebugSession) error {
+	iatt.Calls = append(iatt.Calls, "StopDebugSession")
+	return nil
+}
+
+// ExecDebugSession - Execution Engine
+func (iatt *ImplementsAllTheThings) ExecDebugSession(ctx context.Context, session state.DebugSession, command []string, streams engine.DebugStreams) (state.DebugSession, error) {
+	iatt.Calls = append(iatt.Calls, "ExecDebugSession")
+	if session.PodName == "" {
+		session.PodName = session.JobName + "-pod"
+	}
+	return session, nil
+}
+
+// ProxyPort - Execution Engine
+func (iatt *ImplementsAllTheThings) ProxyPort(run state.Run, port int, prefix string) (http.Handler, error) {
+	iatt.Calls = append(iatt.Calls, "ProxyPort")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "%s:%d%s", run.RunID, port, strings.TrimPrefix(r.URL.Path, prefix))
+	}), nil
+}
+
 // Terminate - Execution Engine
 func (iatt *ImplementsAllTheThings) Terminate(ctx context.Context, run state.Run) error {
 	iatt.Calls = append(iatt.Calls, "Terminate")
-	return nil
+	return iatt.TerminateError
 }
 
 // Define - Execution Engine
@@ -505,11 +702,15 @@ func (iatt *ImplementsAllTheThings) ListTemplates(ctx context.Context, limit int
 
 // ListTemplatesLatestOnly - StateManager
 func (iatt *ImplementsAllTheThings) ListTemplatesLatestOnly(ctx context.Context, limit int, offset int, sortBy string, order string) (state.TemplateList, error) {
-	// TODO: this is not actually implemented correctly - but also we're never
-	// using it.
 	iatt.Calls = append(iatt.Calls, "ListTemplatesLatestOnly")
-	tl := state.TemplateList{Total: len(iatt.Templates)}
+	latest := map[string]state.Template{}
 	for _, t := range iatt.Templates {
+		if prev, ok := latest[t.TemplateName]; !ok || t.Version > prev.Version {
+			latest[t.TemplateName] = t
+		}
+	}
+	tl := state.TemplateList{Total: len(latest)}
+	for _, t := range latest {
 		tl.Templates = append(tl.Templates, t)
 	}
 	return tl, nil
@@ -528,7 +729,7 @@ func (iatt *ImplementsAllTheThings) GetTemplateByVersion(ctx context.Context, te
 	}
 
 	if tpl == nil {
-		return false, *tpl, fmt.Errorf("No template with name: %s", templateName)
+		return false, state.Template{}, nil
 	}
 
 	return true, *tpl, err
@@ -561,7 +762,7 @@ func (iatt *ImplementsAllTheThings) GetLatestTemplateByTemplateName(ctx context.
 	}
 
 	if tpl == nil {
-		return false, *tpl, fmt.Errorf("No template with name: %s", templateName)
+		return false, state.Template{}, nil
 	}
 
 	return true, *tpl, err
@@ -574,6 +775,168 @@ func (iatt *ImplementsAllTheThings) CreateTemplate(ctx context.Context, t state.
 	return nil
 }
 
+// UpdateTemplateDeprecation - StateManager
+func (iatt *ImplementsAllTheThings) UpdateTemplateDeprecation(ctx context.Context, templateID string, deprecation *state.TemplateDeprecation) (state.Template, error) {
+	iatt.Calls = append(iatt.Calls, "UpdateTemplateDeprecation")
+	t, ok := iatt.Templates[templateID]
+	if !ok {
+		return t, exceptions.MissingResource{ErrorString: fmt.Sprintf("No template %s", templateID)}
+	}
+	t.Deprecation = deprecation
+	iatt.Templates[templateID] = t
+	return t, nil
+}
+
+// ListTemplateChannels - StateManager
+func (iatt *ImplementsAllTheThings) ListTemplateChannels(ctx context.Context, templateName string) (state.TemplateChannelList, error) {
+	iatt.Calls = append(iatt.Calls, "ListTemplateChannels")
+	var result state.TemplateChannelList
+	for _, c := range iatt.TemplateChannels {
+		if c.TemplateName == templateName {
+			result.Channels = append(result.Channels, c)
+		}
+	}
+	result.Total = len(result.Channels)
+	return result, nil
+}
+
+// GetTemplateChannel - StateManager
+func (iatt *ImplementsAllTheThings) GetTemplateChannel(ctx context.Context, templateName string, channel string) (bool, state.TemplateChannel, error) {
+	iatt.Calls = append(iatt.Calls, "GetTemplateChannel")
+	c, ok := iatt.TemplateChannels[templateName+"/"+channel]
+	return ok, c, nil
+}
+
+// SetTemplateChannel - StateManager
+func (iatt *ImplementsAllTheThings) SetTemplateChannel(ctx context.Context, c state.TemplateChannel) (state.TemplateChannel, error) {
+	iatt.Calls = append(iatt.Calls, "SetTemplateChannel")
+	if iatt.TemplateChannels == nil {
+		iatt.TemplateChannels = map[string]state.TemplateChannel{}
+	}
+	for _, t := range iatt.Templates {
+		if t.TemplateName == c.TemplateName && t.Version == c.Version {
+			c.TemplateID = t.TemplateID
+		}
+	}
+	iatt.TemplateChannels[c.TemplateName+"/"+c.Channel] = c
+	return c, nil
+}
+
+// DeleteTemplateChannel - StateManager
+func (iatt *ImplementsAllTheThings) DeleteTemplateChannel(ctx context.Context, templateName string, channel string) error {
+	iatt.Calls = append(iatt.Calls, "DeleteTemplateChannel")
+	if _, ok := iatt.TemplateChannels[templateName+"/"+channel]; !ok {
+		return exceptions.MissingResource{ErrorString: fmt.Sprintf("No channel %s of template %s", channel, templateName)}
+	}
+	delete(iatt.TemplateChannels, templateName+"/"+channel)
+	return nil
+}
+
+// GetTemplateUsage - StateManager
+func (iatt *ImplementsAllTheThings) GetTemplateUsage(ctx context.Context, templateName string, since time.Time) ([]state.TemplateVersionUsage, error) {
+	iatt.Calls = append(iatt.Calls, "GetTemplateUsage")
+	var result []state.TemplateVersionUsage
+	for _, t := range iatt.Templates {
+		if t.TemplateName != templateName {
+			continue
+		}
+		usage := state.TemplateVersionUsage{TemplateID: t.TemplateID, Version: t.Version, Deprecation: t.Deprecation}
+		for _, r := range iatt.Runs {
+			if r.ExecutableID != nil && *r.ExecutableID == t.TemplateID {
+				usage.Runs++
+			}
+		}
+		result = append(result, usage)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Version > result[j].Version })
+	return result, nil
+}
+
+// ListSettings - StateManager
+func (iatt *ImplementsAllTheThings) ListSettings(ctx context.Context) ([]state.Setting, error) {
+	iatt.Calls = append(iatt.Calls, "ListSettings")
+	var settings []state.Setting
+	for _, s := range iatt.Settings {
+		settings = append(settings, s)
+	}
+	return settings, nil
+}
+
+// SetSetting - StateManager
+func (iatt *ImplementsAllTheThings) SetSetting(ctx context.Context, s state.Setting, reason string) (state.Setting, error) {
+	iatt.Calls = append(iatt.Calls, "SetSetting")
+	if iatt.Settings == nil {
+		iatt.Settings = map[string]state.Setting{}
+	}
+	iatt.SettingChanges = append([]state.SettingChange{{
+		ID:            int64(len(iatt.SettingChanges) + 1),
+		Key:           s.Key,
+		Value:         s.Value,
+		PreviousValue: iatt.Settings[s.Key].Value,
+		Reason:        reason,
+		UpdatedBy:     s.UpdatedBy,
+		UpdatedAt:     s.UpdatedAt,
+	}}, iatt.SettingChanges...)
+	iatt.Settings[s.Key] = s
+	return s, nil
+}
+
+// DeleteSetting - StateManager
+func (iatt *ImplementsAllTheThings) DeleteSetting(ctx context.Context, key string, user string, reason string) error {
+	iatt.Calls = append(iatt.Calls, "DeleteSetting")
+	previous, ok := iatt.Settings[key]
+	if !ok {
+		return exceptions.MissingResource{ErrorString: fmt.Sprintf("Setting %s is not overridden", key)}
+	}
+	delete(iatt.Settings, key)
+	iatt.SettingChanges = append([]state.SettingChange{{
+		ID:            int64(len(iatt.SettingChanges) + 1),
+		Key:           key,
+		PreviousValue: previous.Value,
+		Reason:        reason,
+		UpdatedBy:     user,
+		UpdatedAt:     time.Now(),
+	}}, iatt.SettingChanges...)
+	return nil
+}
+
+// ListSettingChanges - StateManager
+func (iatt *ImplementsAllTheThings) ListSettingChanges(ctx context.Context, key string, limit int, offset int) (state.SettingChangeList, error) {
+	iatt.Calls = append(iatt.Calls, "ListSettingChanges")
+	var result state.SettingChangeList
+	for _, c := range iatt.SettingChanges {
+		if key == "" || c.Key == key {
+			result.Changes = append(result.Changes, c)
+		}
+	}
+	result.Total = len(result.Changes)
+	return result, nil
+}
+
+// ApplyBundle - StateManager
+func (iatt *ImplementsAllTheThings) ApplyBundle(ctx context.Context, changes state.BundleChanges) error {
+	iatt.Calls = append(iatt.Calls, "ApplyBundle")
+	for _, d := range changes.CreateDefinitions {
+		iatt.Definitions[d.DefinitionID] = d
+	}
+	for _, d := range changes.UpdateDefinitions {
+		iatt.Definitions[d.DefinitionID] = d
+	}
+	for _, definitionID := range changes.DeleteDefinitions {
+		delete(iatt.Definitions, definitionID)
+	}
+	for _, t := range changes.CreateTemplates {
+		iatt.Templates[t.TemplateID] = t
+	}
+	for templateID, deprecation := range changes.DeprecateTemplates {
+		t := iatt.Templates[templateID]
+		deprecation := deprecation
+		t.Deprecation = &deprecation
+		iatt.Templates[templateID] = t
+	}
+	return nil
+}
+
 func (iatt *ImplementsAllTheThings) GetRunStatus(ctx context.Context, runID string) (state.RunStatus, error) {
 	iatt.Calls = append(iatt.Calls, "GetRunStatus")
 	var err error
@@ -600,3 +963,48 @@ func (iatt *ImplementsAllTheThings) GetRunStatus(ctx context.Context, runID stri
 
 	return status, err
 }
+
+// CreateDebugSession - StateManager
+func (iatt *ImplementsAllTheThings) CreateDebugSession(ctx context.Context, s state.DebugSession) error {
+	iatt.Calls = append(iatt.Calls, "CreateDebugSession")
+	if iatt.DebugSessions == nil {
+		iatt.DebugSessions = map[string]state.DebugSession{}
+	}
+	iatt.DebugSessions[s.SessionID] = s
+	return nil
+}
+
+// GetDebugSession - StateManager
+func (iatt *ImplementsAllTheThings) GetDebugSession(ctx context.Context, sessionID string) (state.DebugSession, error) {
+	iatt.Calls = append(iatt.Calls, "GetDebugSession")
+	s, ok := iatt.DebugSessions[sessionID]
+	if !ok {
+		return s, exceptions.MissingResource{ErrorString: fmt.Sprintf("Debug session with ID %s not found", sessionID)}
+	}
+	return s, nil
+}
+
+// ListDebugSessions - StateManager
+func (iatt *ImplementsAllTheThings) ListDebugSessions(ctx context.Context, runID string) (state.DebugSessionList, error) {
+	iatt.Calls = append(iatt.Calls, "ListDebugSessions")
+	var list state.DebugSessionList
+	for _, s := range iatt.DebugSessions {
+		if s.RunID == runID {
+			list.Sessions = append(list.Sessions, s)
+		}
+	}
+	list.Total = len(list.Sessions)
+	return list, nil
+}
+
+// UpdateDebugSession - StateManager
+func (iatt *ImplementsAllTheThings) UpdateDebugSession(ctx context.Context, sessionID string, updates state.DebugSession) (state.DebugSession, error) {
+	iatt.Calls = append(iatt.Calls, "UpdateDebugSession")
+	s, ok := iatt.DebugSessions[sessionID]
+	if !ok {
+		return s, exceptions.MissingResource{ErrorString: fmt.Sprintf("Debug session with ID %s not found", sessionID)}
+	}
+	s.UpdateWith(updates)
+	iatt.DebugSessions[sessionID] = s
+	return s, nil
+}
@@ -0,0 +1,88 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"os"
+
+	"github.com/gorilla/mux"
+	httptrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/net/http"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// datadogTracer sends the spans to the Datadog agent. The database and AWS
+// clients are traced by their dd-trace-go integrations.
+type datadogTracer struct {
+	started bool
+}
+
+func newDatadogTracer() *datadogTracer {
+	tracer.Start()
+	return &datadogTracer{started: true}
+}
+
+type datadogSpan struct {
+	span ddtrace.Span
+}
+
+func (s datadogSpan) SetTag(key string, value interface{}) {
+	s.span.SetTag(key, value)
+}
+
+func (s datadogSpan) Finish() {
+	s.span.Finish()
+}
+
+func (t *datadogTracer) StartSpan(ctx context.Context, operationName string, resourceName string) (context.Context, Span) {
+	span, ctx := tracer.StartSpanFromContext(ctx, operationName, tracer.ResourceName(resourceName))
+	return ctx, datadogSpan{span: span}
+}
+
+func (t *datadogTracer) StartRemoteSpan(ctx context.Context, operationName string, carrier TextMapCarrier) (context.Context, Span) {
+	spanCtx, err := tracer.Extract(carrier)
+	if err != nil {
+		return t.StartSpan(ctx, operationName, "")
+	}
+	span := tracer.StartSpan(operationName, tracer.ChildOf(spanCtx))
+	return tracer.ContextWithSpan(ctx, span), datadogSpan{span: span}
+}
+
+func (t *datadogTracer) Inject(ctx context.Context, carrier TextMapCarrier) {
+	if span, ok := tracer.SpanFromContext(ctx); ok {
+		_ = tracer.Inject(span.Context(), carrier)
+	}
+}
+
+// Middleware traces the requests with the route they matched as resource,
+// when it's used by the router.
+func (t *datadogTracer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resource := r.Method + " unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				resource = r.Method + " " + template
+			}
+		}
+		httptrace.TraceAndServe(next, w, r, &httptrace.ServeConfig{
+			Service:     routerServiceName(),
+			Resource:    resource,
+			RouteParams: mux.Vars(r),
+		})
+	})
+}
+
+// routerServiceName is the service of the requests' spans, DD_SERVICE or the
+// one of the dd-trace-go gorilla/mux integration.
+func routerServiceName() string {
+	if service := os.Getenv("DD_SERVICE"); len(service) > 0 {
+		return service
+	}
+	return "mux.router"
+}
+
+func (t *datadogTracer) Stop() {
+	if t.started {
+		tracer.Stop()
+	}
+}
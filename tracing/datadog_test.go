@@ -0,0 +1,44 @@
+package tracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+)
+
+func TestDatadogTracer_Middleware(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	r := mux.NewRouter()
+	r.Use(Middleware)
+	r.HandleFunc("/api/v6/history/{run_id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/v6/history/run-1", nil))
+
+	spans := mt.FinishedSpans()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	if resource := spans[0].Tag("resource.name"); resource != "GET /api/v6/history/{run_id}" {
+		t.Errorf("expected the route as resource, got %v", resource)
+	}
+	if status := spans[0].Tag("http.status_code"); status != "503" {
+		t.Errorf("expected the status to be tagged, got %v", status)
+	}
+}
+
+func TestIsDatadog(t *testing.T) {
+	if !IsDatadog() {
+		t.Errorf("expected datadog to be the default backend")
+	}
+	t.Cleanup(func() { backend = &datadogTracer{} })
+	backend = &noopTracer{}
+	if IsDatadog() {
+		t.Errorf("expected the datadog integrations to be left out of other backends")
+	}
+}
@@ -0,0 +1,189 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stitchfix/flotilla-os/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// otelTracer exports the spans to an OpenTelemetry collector with OTLP over
+// http, and propagates traces with W3C traceparent headers.
+type otelTracer struct {
+	provider   *sdktrace.TracerProvider
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// newOtelTracer reads the following keys:
+// *tracing_service_name* -- service name of the spans, default `flotilla`
+// *tracing_otlp_endpoint* -- host:port of the collector, defaults to the OTEL_EXPORTER_OTLP_* variables
+// *tracing_otlp_insecure* -- send the spans over plain http
+// *tracing_sample_rate* -- ratio of the new traces sampled, default 1
+func newOtelTracer(conf config.Config) (*otelTracer, error) {
+	ctx := context.Background()
+
+	var opts []otlptracehttp.Option
+	if conf.IsSet("tracing_otlp_endpoint") {
+		opts = append(opts, otlptracehttp.WithEndpoint(conf.GetString("tracing_otlp_endpoint")))
+	}
+	if conf.GetBool("tracing_otlp_insecure") {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the otlp exporter: %w", err)
+	}
+
+	serviceName := "flotilla"
+	if conf.IsSet("tracing_service_name") {
+		serviceName = conf.GetString("tracing_service_name")
+	}
+	res, err := resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(attribute.String("service.name", serviceName)))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the otel resource: %w", err)
+	}
+
+	sampleRate := 1.0
+	if conf.IsSet("tracing_sample_rate") {
+		sampleRate = conf.GetFloat64("tracing_sample_rate")
+	}
+
+	return newOtelTracerWithProvider(sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRate))),
+	)), nil
+}
+
+func newOtelTracerWithProvider(provider *sdktrace.TracerProvider) *otelTracer {
+	propagator := propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagator)
+	return &otelTracer{
+		provider:   provider,
+		tracer:     provider.Tracer("github.com/stitchfix/flotilla-os"),
+		propagator: propagator,
+	}
+}
+
+type otelSpan struct {
+	span trace.Span
+}
+
+// SetTag sets an attribute of the span. The `error` and `error.msg` tags
+// also set the status of the span.
+func (s otelSpan) SetTag(key string, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		s.span.SetAttributes(attribute.String(key, v))
+	case bool:
+		s.span.SetAttributes(attribute.Bool(key, v))
+	case int:
+		s.span.SetAttributes(attribute.Int(key, v))
+	case int64:
+		s.span.SetAttributes(attribute.Int64(key, v))
+	case float64:
+		s.span.SetAttributes(attribute.Float64(key, v))
+	default:
+		s.span.SetAttributes(attribute.String(key, fmt.Sprintf("%v", v)))
+	}
+
+	switch key {
+	case "error":
+		if failed, ok := value.(bool); !ok || failed {
+			s.span.SetStatus(codes.Error, fmt.Sprintf("%v", value))
+		}
+	case "error.msg":
+		s.span.SetStatus(codes.Error, fmt.Sprintf("%v", value))
+	}
+}
+
+func (s otelSpan) Finish() {
+	s.span.End()
+}
+
+func (t *otelTracer) StartSpan(ctx context.Context, operationName string, resourceName string) (context.Context, Span) {
+	var opts []trace.SpanStartOption
+	if len(resourceName) > 0 {
+		opts = append(opts, trace.WithAttributes(attribute.String("resource.name", resourceName)))
+	}
+	ctx, span := t.tracer.Start(ctx, operationName, opts...)
+	return ctx, otelSpan{span: span}
+}
+
+func (t *otelTracer) StartRemoteSpan(ctx context.Context, operationName string, carrier TextMapCarrier) (context.Context, Span) {
+	ctx = t.propagator.Extract(ctx, carrier)
+	ctx, span := t.tracer.Start(ctx, operationName, trace.WithSpanKind(trace.SpanKindConsumer))
+	return ctx, otelSpan{span: span}
+}
+
+func (t *otelTracer) Inject(ctx context.Context, carrier TextMapCarrier) {
+	t.propagator.Inject(ctx, carrier)
+}
+
+// Middleware continues the traces of the requests' traceparent headers, with
+// a span named after the route.
+func (t *otelTracer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		ctx := t.propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := t.tracer.Start(ctx, fmt.Sprintf("%s %s", r.Method, route),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("http.route", route),
+				attribute.String("url.path", r.URL.Path)))
+		defer span.End()
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+		span.SetAttributes(attribute.Int("http.response.status_code", recorder.status))
+		if recorder.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(recorder.status))
+		}
+	})
+}
+
+func (t *otelTracer) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = t.provider.Shutdown(ctx)
+}
+
+// statusRecorder keeps the status code of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush lets streamed responses, like logs, through the recorder
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,77 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func setUpOtel(t *testing.T) (*otelTracer, *tracetest.SpanRecorder) {
+	recorder := tracetest.NewSpanRecorder()
+	t.Cleanup(func() { backend = &datadogTracer{} })
+	backend = newOtelTracerWithProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	return backend.(*otelTracer), recorder
+}
+
+func TestOtelTracer_Propagation(t *testing.T) {
+	_, recorder := setUpOtel(t)
+
+	ctx, enqueue := TraceJob(context.Background(), "flotilla.queue.sqs_enqueue", "run-1")
+	carrier := TextMapCarrier{}
+	Inject(ctx, carrier)
+	enqueue.Finish()
+	if len(carrier["traceparent"]) == 0 {
+		t.Fatalf("expected a traceparent to be injected, got %v", carrier)
+	}
+
+	_, receive := StartRemoteSpan(context.Background(), "flotilla.queue.sqs_receive", carrier)
+	receive.SetTag("error", true)
+	receive.SetTag("error.msg", "no cluster")
+	receive.Finish()
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	if spans[1].SpanContext().TraceID() != spans[0].SpanContext().TraceID() ||
+		spans[1].Parent().SpanID() != spans[0].SpanContext().SpanID() {
+		t.Errorf("expected the received span to continue the trace of the enqueued one")
+	}
+	if spans[1].Status().Code != codes.Error || spans[1].Status().Description != "no cluster" {
+		t.Errorf("expected the error tags to set the status, got %+v", spans[1].Status())
+	}
+}
+
+func TestOtelTracer_Middleware(t *testing.T) {
+	_, recorder := setUpOtel(t)
+
+	r := mux.NewRouter()
+	r.Use(Middleware)
+	r.HandleFunc("/api/v6/history/{run_id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	req := httptest.NewRequest("GET", "/api/v6/history/run-1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	if spans[0].Name() != "GET /api/v6/history/{run_id}" {
+		t.Errorf("expected the span to be named after the route, got %s", spans[0].Name())
+	}
+	if spans[0].SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("expected the request's trace to be continued, got %s", spans[0].SpanContext().TraceID())
+	}
+	if spans[0].Status().Code != codes.Error {
+		t.Errorf("expected server errors to set the status, got %+v", spans[0].Status())
+	}
+}
@@ -2,25 +2,97 @@ package tracing
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"strings"
 	"time"
 
-	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"github.com/stitchfix/flotilla-os/config"
 )
 
-// TraceJob starts or continues a trace for a job operation
-func TraceJob(ctx context.Context, operationName string, runID string) (context.Context, tracer.Span) {
-	span, ctx := tracer.StartSpanFromContext(
-		ctx,
-		operationName,
-		tracer.ResourceName(runID),
-		tracer.Tag("job.run_id", runID),
-	)
+// Span is an operation of a trace
+type Span interface {
+	SetTag(key string, value interface{})
+	Finish()
+}
+
+// Tracer is a tracing backend
+type Tracer interface {
+	// StartSpan starts a span, child of the span of the context if any
+	StartSpan(ctx context.Context, operationName string, resourceName string) (context.Context, Span)
+	// StartRemoteSpan starts a span continuing the trace propagated in the
+	// carrier, e.g. by another process through a queue
+	StartRemoteSpan(ctx context.Context, operationName string, carrier TextMapCarrier) (context.Context, Span)
+	// Inject writes the trace of the context to the carrier
+	Inject(ctx context.Context, carrier TextMapCarrier)
+	// Middleware traces the http requests
+	Middleware(next http.Handler) http.Handler
+	Stop()
+}
+
+var backend Tracer = &datadogTracer{}
+
+// Init starts the tracing backend set by `tracing_backend`: `datadog` (the
+// default), `otel` or `none`.
+func Init(conf config.Config) error {
+	name := "datadog"
+	if conf.IsSet("tracing_backend") {
+		name = strings.TrimSpace(conf.GetString("tracing_backend"))
+	}
+
+	switch name {
+	case "datadog":
+		backend = newDatadogTracer()
+	case "otel", "opentelemetry":
+		t, err := newOtelTracer(conf)
+		if err != nil {
+			return err
+		}
+		backend = t
+	case "none":
+		backend = &noopTracer{}
+	default:
+		return fmt.Errorf("no tracing backend named [%s] was found", name)
+	}
+	return nil
+}
+
+// IsDatadog is whether the spans go to Datadog, the dd-trace-go integrations
+// being only worth wiring then.
+func IsDatadog() bool {
+	_, ok := backend.(*datadogTracer)
+	return ok
+}
+
+// Stop flushes the spans and stops the tracing backend
+func Stop() {
+	backend.Stop()
+}
+
+// Inject writes the trace of the context to the carrier
+func Inject(ctx context.Context, carrier TextMapCarrier) {
+	backend.Inject(ctx, carrier)
+}
+
+// StartRemoteSpan starts a span continuing the trace propagated in the carrier
+func StartRemoteSpan(ctx context.Context, operationName string, carrier TextMapCarrier) (context.Context, Span) {
+	return backend.StartRemoteSpan(ctx, operationName, carrier)
+}
 
+// Middleware traces the http requests with the tracing backend
+func Middleware(next http.Handler) http.Handler {
+	return backend.Middleware(next)
+}
+
+// TraceJob starts or continues a trace for a job operation
+func TraceJob(ctx context.Context, operationName string, runID string) (context.Context, Span) {
+	ctx, span := backend.StartSpan(ctx, operationName, runID)
+	span.SetTag("job.run_id", runID)
 	return ctx, span
 }
 
 // TagRunInfo adds standardized job metadata to a span
-func TagRunInfo(span tracer.Span,
+func TagRunInfo(span Span,
 	runID, definitionID, alias, status, clusterName string,
 	queuedAt, startedAt, finishedAt *time.Time,
 	podName, namespace, exitReason *string,
@@ -37,6 +109,8 @@ func TagRunInfo(span tracer.Span,
 	}
 }
 
+// TextMapCarrier carries the propagated trace, e.g. as http headers or queue
+// message attributes
 type TextMapCarrier map[string]string
 
 // ForeachKey implements the TextMapReader interface for Extract
@@ -53,3 +127,42 @@ func (c TextMapCarrier) ForeachKey(handler func(key, val string) error) error {
 func (c TextMapCarrier) Set(key, val string) {
 	c[key] = val
 }
+
+// Get returns the value of the key
+func (c TextMapCarrier) Get(key string) string {
+	return c[key]
+}
+
+// Keys lists the keys of the carrier
+func (c TextMapCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+type noopSpan struct{}
+
+func (s noopSpan) SetTag(key string, value interface{}) {}
+
+func (s noopSpan) Finish() {}
+
+// noopTracer disables tracing
+type noopTracer struct{}
+
+func (t *noopTracer) StartSpan(ctx context.Context, operationName string, resourceName string) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+func (t *noopTracer) StartRemoteSpan(ctx context.Context, operationName string, carrier TextMapCarrier) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+func (t *noopTracer) Inject(ctx context.Context, carrier TextMapCarrier) {}
+
+func (t *noopTracer) Middleware(next http.Handler) http.Handler {
+	return next
+}
+
+func (t *noopTracer) Stop() {}
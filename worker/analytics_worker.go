@@ -0,0 +1,180 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/stitchfix/flotilla-os/clients/metrics"
+	"github.com/stitchfix/flotilla-os/config"
+	"github.com/stitchfix/flotilla-os/execution/engine"
+	flotillaLog "github.com/stitchfix/flotilla-os/log"
+	"github.com/stitchfix/flotilla-os/queue"
+	"github.com/stitchfix/flotilla-os/state"
+	"github.com/stitchfix/flotilla-os/utils"
+	"gopkg.in/tomb.v2"
+)
+
+// analyticsDimensions are the dimensions the latencies are reported by. Runs
+// aren't reported per definition, there are too many of them.
+var analyticsDimensions = []state.RunDimension{
+	state.RunDimensionCluster,
+	state.RunDimensionTier,
+	state.RunDimensionTeam,
+	state.RunDimensionEngine,
+}
+
+// analyticsWorker periodically reports the latency percentiles of the recent
+// runs as gauges, and flags the runs running for longer than usual.
+type analyticsWorker struct {
+	leaderWorker
+	sm           state.Manager
+	conf         state.AnalyticsConfig
+	log          flotillaLog.Logger
+	pollInterval time.Duration
+	t            tomb.Tomb
+	// runs flagged as slow by the last poll, so that they're only counted once
+	flagged map[string]bool
+	// clusters with slow runs at the last poll, reset to zero once they have
+	// none anymore
+	slowClusters map[string]bool
+	// latency gauges reported by the last poll of each dimension, reset to
+	// zero once their value has no runs anymore
+	latencyGauges map[state.RunDimension]map[latencyGauge]bool
+}
+
+// latencyGauge is a latency gauge reported for a dimension value.
+type latencyGauge struct {
+	name     metrics.Metric
+	tag      string
+	quantile string
+}
+
+func (aw *analyticsWorker) Initialize(conf config.Config, sm state.Manager, eksEngine engine.Engine, emrEngine engine.Engine, log flotillaLog.Logger, pollInterval time.Duration, qm queue.Manager, clusterManager *engine.DynamicClusterManager) error {
+	aw.pollInterval = pollInterval
+	if aw.pollInterval == 0 {
+		aw.pollInterval = 5 * time.Minute
+	}
+	aw.conf = state.NewAnalyticsConfig(conf)
+	aw.sm = sm
+	aw.log = log
+	aw.flagged = map[string]bool{}
+	aw.slowClusters = map[string]bool{}
+	aw.latencyGauges = map[state.RunDimension]map[latencyGauge]bool{}
+	_ = aw.log.Log("level", "info", "message", "initialized an analytics worker")
+	return nil
+}
+
+func (aw *analyticsWorker) GetTomb() *tomb.Tomb {
+	return &aw.t
+}
+
+// Run reports the analytics every poll interval
+func (aw *analyticsWorker) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-aw.t.Dying():
+			_ = aw.log.Log("level", "info", "message", "An analytics worker was terminated")
+			return nil
+		default:
+			if aw.leads() {
+				aw.runOnce(ctx)
+			}
+			sleepUnlessDying(&aw.t, aw.pollInterval)
+		}
+	}
+}
+
+func (aw *analyticsWorker) runOnce(ctx context.Context) {
+	ctx, span := utils.TraceJob(ctx, "flotilla.analytics_worker.poll", "analytics_worker")
+	defer span.Finish()
+
+	now := time.Now().UTC()
+	for _, dimension := range analyticsDimensions {
+		if err := aw.reportLatency(ctx, dimension, now); err != nil {
+			span.SetTag("error", true)
+			span.SetTag("error.msg", err.Error())
+			_ = aw.log.Log("level", "error", "message", "unable to report run latencies", "group_by", string(dimension), "error", fmt.Sprintf("%+v", err))
+		}
+	}
+	if err := aw.reportSlowRuns(ctx, now); err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		_ = aw.log.Log("level", "error", "message", "unable to report slow runs", "error", fmt.Sprintf("%+v", err))
+	}
+}
+
+func (aw *analyticsWorker) reportLatency(ctx context.Context, dimension state.RunDimension, now time.Time) error {
+	stats, err := aw.sm.GetRunLatencyStats(ctx, state.RunLatencyQuery{
+		GroupBy:   dimension,
+		Since:     now.Add(-aw.conf.Window),
+		Until:     now,
+		TeamLabel: aw.conf.TeamLabel,
+	})
+	if err != nil {
+		return err
+	}
+	gauges := map[latencyGauge]bool{}
+	for _, s := range stats {
+		tag := fmt.Sprintf("%s:%s", dimension, s.Value)
+		reportPercentiles(metrics.RunQueueWait, s.QueueWait, tag, gauges)
+		reportPercentiles(metrics.RunPending, s.Pending, tag, gauges)
+		reportPercentiles(metrics.RunRuntime, s.Runtime, tag, gauges)
+	}
+	for g := range aw.latencyGauges[dimension] {
+		if !gauges[g] {
+			_ = metrics.Gauge(g.name, 0, []string{g.tag, fmt.Sprintf("quantile:%s", g.quantile)}, 1)
+		}
+	}
+	aw.latencyGauges[dimension] = gauges
+	return nil
+}
+
+func reportPercentiles(name metrics.Metric, p state.Percentiles, tag string, gauges map[latencyGauge]bool) {
+	for quantile, value := range map[string]*float64{"p50": p.P50, "p90": p.P90, "p99": p.P99} {
+		if value != nil {
+			_ = metrics.Gauge(name, *value, []string{tag, fmt.Sprintf("quantile:%s", quantile)}, 1)
+			gauges[latencyGauge{name: name, tag: tag, quantile: quantile}] = true
+		}
+	}
+}
+
+func (aw *analyticsWorker) reportSlowRuns(ctx context.Context, now time.Time) error {
+	slow, err := state.ListSlowRuns(ctx, aw.sm, aw.conf.SlowRunFactor, now)
+	if err != nil {
+		return err
+	}
+
+	flagged := make(map[string]bool, len(slow.Runs))
+	perCluster := map[string]int{}
+	for _, run := range slow.Runs {
+		flagged[run.RunID] = true
+		perCluster[run.ClusterName]++
+		if aw.flagged[run.RunID] {
+			continue
+		}
+		_ = metrics.Increment(metrics.RunSlow, []string{fmt.Sprintf("cluster:%s", run.ClusterName)}, 1)
+		_ = aw.log.Log(
+			"level", "warn",
+			"message", "run is running for longer than usual",
+			"run_id", run.RunID,
+			"executable_id", run.ExecutableID,
+			"cluster", run.ClusterName,
+			"runtime_minutes", fmt.Sprintf("%.1f", run.RuntimeMinutes),
+			"historical_minutes", fmt.Sprintf("%.1f", run.HistoricalMinutes))
+	}
+
+	slowClusters := make(map[string]bool, len(perCluster))
+	for cluster, count := range perCluster {
+		slowClusters[cluster] = true
+		_ = metrics.Gauge(metrics.RunsSlow, float64(count), []string{fmt.Sprintf("cluster:%s", cluster)}, 1)
+	}
+	for cluster := range aw.slowClusters {
+		if !slowClusters[cluster] {
+			_ = metrics.Gauge(metrics.RunsSlow, 0, []string{fmt.Sprintf("cluster:%s", cluster)}, 1)
+		}
+	}
+	aw.flagged = flagged
+	aw.slowClusters = slowClusters
+	return nil
+}
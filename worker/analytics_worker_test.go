@@ -0,0 +1,78 @@
+package worker
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	gklog "github.com/go-kit/kit/log"
+	"github.com/stitchfix/flotilla-os/clients/metrics"
+	flotillaLog "github.com/stitchfix/flotilla-os/log"
+	"github.com/stitchfix/flotilla-os/state"
+	"github.com/stitchfix/flotilla-os/testutils"
+)
+
+func TestAnalyticsWorker_ReportSlowRuns(t *testing.T) {
+	l := gklog.NewLogfmtLogger(gklog.NewSyncWriter(os.Stderr))
+	executableID := "definition-a"
+	longAgo := time.Now().Add(-time.Hour)
+	// The historical runtime of the mock is 1 minute
+	imp := testutils.ImplementsAllTheThings{
+		T: t,
+		Runs: map[string]state.Run{
+			"runA": {RunID: "runA", ClusterName: "A", ExecutableID: &executableID, Status: state.StatusRunning, StartedAt: &longAgo},
+		},
+	}
+	aw := &analyticsWorker{}
+	if err := aw.Initialize(nil, &imp, nil, nil, flotillaLog.NewLogger(l, nil), 0, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := aw.reportSlowRuns(context.Background(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if !aw.flagged["runA"] || !aw.slowClusters["A"] {
+		t.Errorf("expected runA to be flagged, got %v", aw.flagged)
+	}
+
+	imp.Runs = map[string]state.Run{}
+	if err := aw.reportSlowRuns(context.Background(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if len(aw.flagged) != 0 || len(aw.slowClusters) != 0 {
+		t.Errorf("expected the slow runs to be forgotten once they're done, got %v", aw.flagged)
+	}
+}
+
+func TestAnalyticsWorker_ReportLatency(t *testing.T) {
+	l := gklog.NewLogfmtLogger(gklog.NewSyncWriter(os.Stderr))
+	p50 := 10.0
+	imp := testutils.ImplementsAllTheThings{
+		T: t,
+		LatencyStats: []state.RunLatencyStats{
+			{Value: "A", QueueWait: state.Percentiles{P50: &p50}},
+			{Value: "B", Pending: state.Percentiles{P50: &p50}},
+		},
+	}
+	aw := &analyticsWorker{}
+	if err := aw.Initialize(nil, &imp, nil, nil, flotillaLog.NewLogger(l, nil), 0, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := aw.reportLatency(context.Background(), state.RunDimensionCluster, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if len(aw.latencyGauges[state.RunDimensionCluster]) != 2 {
+		t.Errorf("expected the gauges of both clusters to be reported, got %v", aw.latencyGauges)
+	}
+
+	imp.LatencyStats = imp.LatencyStats[:1]
+	if err := aw.reportLatency(context.Background(), state.RunDimensionCluster, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	gauges := aw.latencyGauges[state.RunDimensionCluster]
+	if len(gauges) != 1 || !gauges[latencyGauge{name: metrics.RunQueueWait, tag: "cluster:A", quantile: "p50"}] {
+		t.Errorf("expected the gauges of cluster B to be forgotten once it has no runs, got %v", gauges)
+	}
+}
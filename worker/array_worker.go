@@ -0,0 +1,177 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/stitchfix/flotilla-os/config"
+	"github.com/stitchfix/flotilla-os/execution/engine"
+	flotillaLog "github.com/stitchfix/flotilla-os/log"
+	"github.com/stitchfix/flotilla-os/queue"
+	"github.com/stitchfix/flotilla-os/state"
+	"github.com/stitchfix/flotilla-os/utils"
+	"gopkg.in/tomb.v2"
+)
+
+// arrayPageSize is the number of array runs reconciled per page.
+const arrayPageSize = 100
+
+// arrayWorker queues the held children of array runs as the parallelism of
+// the array allows and keeps the array runs' status in line with their
+// children.
+type arrayWorker struct {
+	sm           state.Manager
+	ee           engine.Engine
+	emrEngine    engine.Engine
+	conf         config.Config
+	log          flotillaLog.Logger
+	pollInterval time.Duration
+	t            tomb.Tomb
+	redisClient  *redis.Client
+	locks        *redisLocks
+	workerId     string
+}
+
+func (aw *arrayWorker) Initialize(conf config.Config, sm state.Manager, eksEngine engine.Engine, emrEngine engine.Engine, log flotillaLog.Logger, pollInterval time.Duration, qm queue.Manager, clusterManager *engine.DynamicClusterManager) error {
+	aw.pollInterval = pollInterval
+	if aw.pollInterval == 0 {
+		aw.pollInterval = 10 * time.Second
+	}
+	aw.conf = conf
+	aw.sm = sm
+	aw.ee = eksEngine
+	aw.emrEngine = emrEngine
+	aw.log = log
+	aw.workerId = fmt.Sprintf("workerid:%d", rand.Int())
+	aw.redisClient, _ = utils.SetupRedisClient(conf)
+	aw.locks = newRedisLocks(aw.redisClient, aw.workerId)
+	_ = aw.log.Log("level", "info", "message", "initialized an array worker")
+	return nil
+}
+
+func (aw *arrayWorker) GetTomb() *tomb.Tomb {
+	return &aw.t
+}
+
+// Run reconciles active array runs with their children
+func (aw *arrayWorker) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-aw.t.Dying():
+			releaseLocks(aw.locks, aw.log)
+			_ = aw.log.Log("level", "info", "message", "An array worker was terminated")
+			return nil
+		default:
+			aw.runOnce(ctx)
+			sleepUnlessDying(&aw.t, aw.pollInterval)
+		}
+	}
+}
+
+func (aw *arrayWorker) runOnce(ctx context.Context) {
+	ctx, span := utils.TraceJob(ctx, "flotilla.array_worker.poll", aw.workerId)
+	defer span.Finish()
+	// Oldest arrays first, paging through all of them so none are starved.
+	for offset := 0; ; offset += arrayPageSize {
+		parents, err := aw.sm.ListRuns(ctx, arrayPageSize, offset, "queued_at", "asc", map[string][]string{
+			"task_type": {state.ArrayTaskType},
+			"status":    {state.StatusQueued, state.StatusRunning},
+		}, nil, state.Engines)
+		if err != nil {
+			span.SetTag("error", true)
+			span.SetTag("error.msg", err.Error())
+			_ = aw.log.Log("level", "error", "message", "unable to list array runs", "error", fmt.Sprintf("%+v", err))
+			return
+		}
+
+		for _, parent := range parents.Runs {
+			if !aw.acquireLock(parent) {
+				continue
+			}
+			children, err := aw.sm.ListRuns(ctx, int(aw.arraySize(parent)), 0, "array_index", "asc", map[string][]string{
+				"array_parent_id": {parent.RunID},
+			}, nil, state.Engines)
+			if err != nil {
+				_ = aw.log.Log("level", "error", "message", "unable to list array children", "run_id", parent.RunID, "error", fmt.Sprintf("%+v", err))
+				continue
+			}
+			aw.reconcile(ctx, parent, children.Runs)
+		}
+		if len(parents.Runs) < arrayPageSize {
+			return
+		}
+	}
+}
+
+// reconcile queues held children while the array has room for them, then
+// updates the array run's progress and status.
+func (aw *arrayWorker) reconcile(ctx context.Context, parent state.Run, children []state.Run) {
+	ctx, span := utils.TraceJob(ctx, "flotilla.job.array_reconcile", parent.RunID)
+	defer span.Finish()
+	utils.TagJobRun(span, parent)
+
+	parallelism := aw.arraySize(parent)
+	if parent.Array != nil && parent.Array.Parallelism > 0 {
+		parallelism = parent.Array.Parallelism
+	}
+	summary := state.SummarizeArray(children, parallelism)
+	for i, child := range children {
+		if summary.Active() >= parallelism {
+			break
+		}
+		if child.Status != state.StatusHeld {
+			continue
+		}
+		queuedAt := time.Now()
+		updated, err := aw.sm.UpdateRun(ctx, child.RunID, state.Run{Status: state.StatusQueued, QueuedAt: &queuedAt})
+		if err != nil {
+			_ = aw.log.Log("level", "error", "message", "Error updating run status to StatusQueued", "run_id", child.RunID, "error", fmt.Sprintf("%+v", err))
+			continue
+		}
+		if updated.Engine != nil && *updated.Engine == state.EKSSparkEngine {
+			err = aw.emrEngine.Enqueue(ctx, updated)
+		} else {
+			err = aw.ee.Enqueue(ctx, updated)
+		}
+		if err != nil {
+			_ = aw.log.Log("level", "error", "message", "Error enqueuing run", "run_id", child.RunID, "error", fmt.Sprintf("%+v", err))
+		}
+		children[i] = updated
+		summary.Held--
+		summary.Queued++
+	}
+
+	if _, err := aw.sm.UpdateRun(ctx, parent.RunID, state.ArrayRunUpdate(parent, children, summary)); err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		_ = aw.log.Log("level", "error", "message", "unable to update array run", "run_id", parent.RunID, "error", fmt.Sprintf("%+v", err))
+	}
+}
+
+// arraySize returns the number of children of the array run.
+func (aw *arrayWorker) arraySize(parent state.Run) int64 {
+	if parent.Array != nil {
+		return parent.Array.Size
+	}
+	if parent.SpawnedRuns != nil {
+		return int64(len(*parent.SpawnedRuns))
+	}
+	return 0
+}
+
+// acquireLock keeps concurrent array workers from releasing the same held
+// children twice; without redis every worker processes every array run.
+func (aw *arrayWorker) acquireLock(parent state.Run) bool {
+	if aw.redisClient == nil {
+		return true
+	}
+	set, err := aw.locks.acquire(fmt.Sprintf("%s-array", parent.RunID), aw.pollInterval)
+	if err != nil {
+		_ = aw.log.Log("level", "error", "message", "unable to set lock", "error", fmt.Sprintf("%+v", err))
+		return true
+	}
+	return set
+}
@@ -0,0 +1,45 @@
+package worker
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	gklog "github.com/go-kit/kit/log"
+	flotillaLog "github.com/stitchfix/flotilla-os/log"
+	"github.com/stitchfix/flotilla-os/state"
+	"github.com/stitchfix/flotilla-os/testutils"
+)
+
+func TestArrayWorker_Reconcile(t *testing.T) {
+	l := gklog.NewLogfmtLogger(gklog.NewSyncWriter(os.Stderr))
+	parentID := "array"
+	zero := int64(0)
+	imp := testutils.ImplementsAllTheThings{
+		T: t,
+		Runs: map[string]state.Run{
+			"array":  {RunID: "array", Status: state.StatusQueued, TaskType: state.ArrayTaskType, Array: &state.ArrayStatus{Size: 3, Parallelism: 1}},
+			"child0": {RunID: "child0", ArrayParentID: &parentID, Status: state.StatusStopped, ExitCode: &zero, Engine: &state.EKSEngine},
+			"child1": {RunID: "child1", ArrayParentID: &parentID, Status: state.StatusHeld, Engine: &state.EKSEngine},
+			"child2": {RunID: "child2", ArrayParentID: &parentID, Status: state.StatusHeld, Engine: &state.EKSEngine},
+		},
+	}
+	worker := &arrayWorker{sm: &imp, ee: &imp, emrEngine: &imp, log: flotillaLog.NewLogger(l, nil)}
+
+	children := []state.Run{imp.Runs["child0"], imp.Runs["child1"], imp.Runs["child2"]}
+	worker.reconcile(context.Background(), imp.Runs["array"], children)
+
+	if len(imp.Queued) != 1 || imp.Queued[0] != "child1" {
+		t.Errorf("Expected only child1 to be queued but was %v", imp.Queued)
+	}
+	if imp.Runs["child2"].Status != state.StatusHeld {
+		t.Errorf("Expected child2 to stay held")
+	}
+	parent := imp.Runs["array"]
+	if parent.Status != state.StatusRunning {
+		t.Errorf("Expected array run to be running but was %s", parent.Status)
+	}
+	if parent.Array == nil || parent.Array.Queued != 1 || parent.Array.Succeeded != 1 || parent.Array.Held != 1 {
+		t.Errorf("Unexpected array status %+v", parent.Array)
+	}
+}
@@ -0,0 +1,42 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/stitchfix/flotilla-os/clients/artifacts"
+	flotillaLog "github.com/stitchfix/flotilla-os/log"
+	"github.com/stitchfix/flotilla-os/state"
+	"github.com/stitchfix/flotilla-os/utils"
+)
+
+// recordArtifacts saves the manifest of the artifacts of a stopped run and
+// its result document, if it output one.
+func recordArtifacts(ctx context.Context, sm state.Manager, ac artifacts.Client, log flotillaLog.Logger, runID string) {
+	ctx, span := utils.TraceJob(ctx, "flotilla.job.record_artifacts", runID)
+	defer span.Finish()
+
+	manifest, err := ac.Manifest(ctx, runID)
+	if err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		_ = log.Log("level", "error", "message", "unable to list run artifacts", "run_id", runID, "error", fmt.Sprintf("%+v", err))
+		return
+	}
+	span.SetTag("artifacts.count", len(manifest.Artifacts))
+	update := state.Run{Artifacts: &manifest}
+	for _, artifact := range manifest.Artifacts {
+		if artifact.Path != state.ResultFileName {
+			continue
+		}
+		// A malformed result doesn't keep the manifest from being recorded.
+		if update.Result, err = ac.Result(ctx, runID); err != nil {
+			_ = log.Log("level", "error", "message", "unable to read run result", "run_id", runID, "error", fmt.Sprintf("%+v", err))
+		}
+	}
+	if _, err = sm.UpdateRun(ctx, runID, update); err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		_ = log.Log("level", "error", "message", "unable to save run artifacts", "run_id", runID, "error", fmt.Sprintf("%+v", err))
+	}
+}
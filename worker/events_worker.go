@@ -10,6 +10,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/pkg/errors"
+	"github.com/stitchfix/flotilla-os/clients/artifacts"
 	"github.com/stitchfix/flotilla-os/config"
 	"github.com/stitchfix/flotilla-os/execution/engine"
 	flotillaLog "github.com/stitchfix/flotilla-os/log"
@@ -39,6 +40,7 @@ type eventsWorker struct {
 	eksEngine         engine.Engine
 	emrEngine         engine.Engine
 	clusterManager    *engine.DynamicClusterManager
+	artifactsClient   artifacts.Client
 }
 
 func (ew *eventsWorker) Initialize(conf config.Config, sm state.Manager, eksEngine engine.Engine, emrEngine engine.Engine, log flotillaLog.Logger, pollInterval time.Duration, qm queue.Manager, clusterManager *engine.DynamicClusterManager) error {
@@ -56,6 +58,11 @@ func (ew *eventsWorker) Initialize(conf config.Config, sm state.Manager, eksEngi
 	ew.emrMetricsServer = conf.GetString("emr_metrics_server_uri")
 	ew.eksMetricsServer = conf.GetString("eks_metrics_server_uri")
 	ew.clusterManager = clusterManager
+	if artifactsClient, acErr := artifacts.NewArtifactsClient(conf, log); acErr == nil {
+		ew.artifactsClient = artifactsClient
+	} else {
+		_ = ew.log.Log("level", "error", "message", "Error initializing artifacts client", "error", fmt.Sprintf("%+v", acErr))
+	}
 	if conf.IsSet("emr_max_pod_events") {
 		ew.emrMaxPodEvents = conf.GetInt("emr_max_pod_events")
 	} else {
@@ -94,7 +101,7 @@ func (ew *eventsWorker) Run(ctx context.Context) error {
 			ew.runOnce(loopCtx)
 			ew.runOnceEMR(loopCtx)
 			span.Finish()
-			time.Sleep(ew.pollInterval)
+			sleepUnlessDying(&ew.t, ew.pollInterval)
 		}
 	}
 }
@@ -178,6 +185,9 @@ func (ew *eventsWorker) processEventEMR(ctx context.Context, emrEvent state.EmrE
 		_, err = ew.sm.UpdateRun(ctx, run.RunID, run)
 		if err == nil {
 			_ = emrEvent.Done()
+			if run.Status == state.StatusStopped && ew.artifactsClient != nil {
+				go recordArtifacts(ctx, ew.sm, ew.artifactsClient, ew.log, run.RunID)
+			}
 		}
 	}
 }
@@ -0,0 +1,261 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/stitchfix/flotilla-os/clients/metrics"
+	"github.com/stitchfix/flotilla-os/config"
+	"github.com/stitchfix/flotilla-os/execution/engine"
+	flotillaLog "github.com/stitchfix/flotilla-os/log"
+	"github.com/stitchfix/flotilla-os/queue"
+	"github.com/stitchfix/flotilla-os/state"
+	"github.com/stitchfix/flotilla-os/utils"
+	"gopkg.in/tomb.v2"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// interruptionPageSize is the number of running runs listed at once.
+const interruptionPageSize = 1000
+
+// interruptionWorker watches the nodes hosting running runs for spot
+// interruption notices and Karpenter disruptions. The runs of an interrupted
+// node are stopped with their grace period to checkpoint and sent back to the
+// retry worker, their interrupted attempt recorded.
+type interruptionWorker struct {
+	leaderWorker
+	sm             state.Manager
+	conf           config.Config
+	log            flotillaLog.Logger
+	pollInterval   time.Duration
+	t              tomb.Tomb
+	clusterManager *engine.DynamicClusterManager
+	redisClient    *redis.Client
+	locks          *redisLocks
+	workerId       string
+	jobNamespace   string
+	taints         []string
+	gracePeriod    int64
+	onDemand       bool
+	maxResubmits   int
+}
+
+func (iw *interruptionWorker) Initialize(conf config.Config, sm state.Manager, eksEngine engine.Engine, emrEngine engine.Engine, log flotillaLog.Logger, pollInterval time.Duration, qm queue.Manager, clusterManager *engine.DynamicClusterManager) error {
+	iw.pollInterval = pollInterval
+	if iw.pollInterval == 0 {
+		iw.pollInterval = 10 * time.Second
+	}
+	iw.conf = conf
+	iw.sm = sm
+	iw.log = log
+	iw.clusterManager = clusterManager
+	iw.workerId = fmt.Sprintf("workerid:%d", rand.Int())
+	iw.redisClient, _ = utils.SetupRedisClient(conf)
+	iw.locks = newRedisLocks(iw.redisClient, iw.workerId)
+	iw.jobNamespace = conf.GetString("eks_job_namespace")
+
+	iw.taints = state.InterruptionTaints
+	if conf.IsSet("eks_interruption_taints") {
+		iw.taints = nil
+		for _, taint := range strings.Split(conf.GetString("eks_interruption_taints"), ",") {
+			iw.taints = append(iw.taints, strings.TrimSpace(taint))
+		}
+	}
+	if conf.IsSet("eks_interruption_grace_period_seconds") {
+		iw.gracePeriod = int64(conf.GetInt("eks_interruption_grace_period_seconds"))
+	} else {
+		iw.gracePeriod = 120
+	}
+	if conf.IsSet("eks_interruption_max_resubmits") {
+		iw.maxResubmits = conf.GetInt("eks_interruption_max_resubmits")
+	} else {
+		iw.maxResubmits = 3
+	}
+	iw.onDemand = conf.GetBool("eks_interruption_resubmit_ondemand")
+	_ = iw.log.Log("level", "info", "message", "initialized an interruption worker")
+	return nil
+}
+
+func (iw *interruptionWorker) GetTomb() *tomb.Tomb {
+	return &iw.t
+}
+
+// Run resubmits the runs of interrupted nodes
+func (iw *interruptionWorker) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-iw.t.Dying():
+			releaseLocks(iw.locks, iw.log)
+			_ = iw.log.Log("level", "info", "message", "An interruption worker was terminated")
+			return nil
+		default:
+			if iw.leads() {
+				iw.runOnce(ctx)
+			}
+			sleepUnlessDying(&iw.t, iw.pollInterval)
+		}
+	}
+}
+
+func (iw *interruptionWorker) runOnce(ctx context.Context) {
+	ctx, span := utils.TraceJob(ctx, "flotilla.interruption_worker.poll", iw.workerId)
+	defer span.Finish()
+	clusters := map[string]map[string]state.Run{}
+	for offset := 0; ; offset += interruptionPageSize {
+		rl, err := iw.sm.ListRuns(ctx, interruptionPageSize, offset, "started_at", "asc", map[string][]string{
+			"task_type": {state.DefaultTaskType},
+			"status":    {state.StatusRunning},
+		}, nil, []string{state.EKSEngine})
+		if err != nil {
+			span.SetTag("error", true)
+			span.SetTag("error.msg", err.Error())
+			_ = iw.log.Log("level", "error", "message", "unable to list running runs", "error", fmt.Sprintf("%+v", err))
+			return
+		}
+		for _, run := range rl.Runs {
+			if clusters[run.ClusterName] == nil {
+				clusters[run.ClusterName] = map[string]state.Run{}
+			}
+			clusters[run.ClusterName][run.RunID] = run
+		}
+		if len(rl.Runs) < interruptionPageSize {
+			break
+		}
+	}
+	if len(clusters) == 0 {
+		return
+	}
+
+	capacityTypeKeys := map[string]string{}
+	if clusterStates, err := iw.sm.ListClusterStates(ctx); err == nil {
+		for _, c := range clusterStates {
+			capacityTypeKeys[c.Name] = c.Scheduling().CapacityTypeKey
+		}
+	}
+
+	for clusterName, runs := range clusters {
+		capacityTypeKey, ok := capacityTypeKeys[clusterName]
+		if !ok {
+			capacityTypeKey = state.DefaultSchedulingPolicy().CapacityTypeKey
+		}
+		iw.processCluster(ctx, clusterName, capacityTypeKey, runs)
+	}
+}
+
+// processCluster interrupts the runs with a pod on an interrupted node of the
+// cluster. A replicated run is interrupted as a whole when any of its pods
+// is.
+func (iw *interruptionWorker) processCluster(ctx context.Context, clusterName string, capacityTypeKey string, runs map[string]state.Run) {
+	kClient, err := iw.clusterManager.GetKubernetesClient(clusterName)
+	if err != nil {
+		_ = iw.log.Log("level", "error", "message", "unable to get kubernetes client", "cluster", clusterName, "error", err.Error())
+		return
+	}
+	nodes, err := kClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		_ = iw.log.Log("level", "error", "message", "unable to list nodes", "cluster", clusterName, "error", err.Error())
+		return
+	}
+
+	for _, node := range nodes.Items {
+		taint, interrupted := state.InterruptionTaint(node, iw.taints, capacityTypeKey)
+		if !interrupted {
+			continue
+		}
+		pods, err := kClient.CoreV1().Pods(iw.jobNamespace).List(ctx, metav1.ListOptions{
+			FieldSelector: fmt.Sprintf("spec.nodeName=%s", node.Name),
+		})
+		if err != nil {
+			_ = iw.log.Log("level", "error", "message", "unable to list pods of node", "node", node.Name, "error", err.Error())
+			continue
+		}
+		for _, pod := range pods.Items {
+			run, ok := runs[pod.Labels["job-name"]]
+			if !ok {
+				continue
+			}
+			delete(runs, run.RunID)
+			iw.interrupt(ctx, &kClient, run, node.Name, taint)
+		}
+	}
+}
+
+// interrupt deletes the job of the run, then records the interrupted attempt
+// and hands the run to the retry worker. The run's pods get the grace period
+// to checkpoint once they receive their stop signal. A run whose job couldn't
+// be deleted is left running and tried again on the next poll, so it is never
+// resubmitted while its job is still there. Runs which were resubmitted too
+// many times are left to fail with their node.
+func (iw *interruptionWorker) interrupt(ctx context.Context, kClient kubernetes.Interface, run state.Run, node string, taint string) {
+	ctx, span := utils.TraceJob(ctx, "flotilla.job.spot_interruption", run.RunID)
+	defer span.Finish()
+	utils.TagJobRun(span, run)
+
+	if run.Attempts.Count(state.AttemptSpotInterrupted) >= iw.maxResubmits {
+		span.SetTag("job.resubmitted", false)
+		_ = iw.log.Log("level", "info", "message", "run was interrupted too many times to be resubmitted", "run_id", run.RunID, "node", node)
+		return
+	}
+	if !iw.acquireLock(run) {
+		return
+	}
+
+	if err := iw.deleteJob(ctx, kClient, run); err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		_ = iw.log.Log("level", "error", "message", "unable to delete job of interrupted run", "run_id", run.RunID, "error", err.Error())
+		return
+	}
+
+	update := state.SpotInterruptionUpdate(run, node, taint, iw.onDemand, time.Now())
+	if _, err := iw.sm.UpdateRun(ctx, run.RunID, update); err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		_ = iw.log.Log("level", "error", "message", "unable to record spot interruption", "run_id", run.RunID, "error", fmt.Sprintf("%+v", err))
+		return
+	}
+
+	_ = metrics.Increment(metrics.EngineEKSRunSpotInterrupted, []string{fmt.Sprintf("tier:%s", run.Tier)}, 1)
+	_ = iw.log.Log("level", "info", "message", "resubmitting interrupted run", "run_id", run.RunID, "node", node, "taint", taint)
+}
+
+// deleteJob deletes the pods and the job of the run with the grace period, a
+// job which is already gone counts as deleted.
+func (iw *interruptionWorker) deleteJob(ctx context.Context, kClient kubernetes.Interface, run state.Run) error {
+	deletionPropagation := metav1.DeletePropagationBackground
+	deleteOptions := metav1.DeleteOptions{
+		GracePeriodSeconds: &iw.gracePeriod,
+		PropagationPolicy:  &deletionPropagation,
+	}
+	err := kClient.CoreV1().Pods(iw.jobNamespace).DeleteCollection(ctx, deleteOptions, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("job-name=%s", run.RunID),
+	})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return err
+	}
+	err = kClient.BatchV1().Jobs(iw.jobNamespace).Delete(ctx, run.RunID, deleteOptions)
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// acquireLock keeps concurrent interruption workers from interrupting the
+// same run twice; without redis every worker processes every run.
+func (iw *interruptionWorker) acquireLock(run state.Run) bool {
+	if iw.redisClient == nil {
+		return true
+	}
+	set, err := iw.locks.acquire(fmt.Sprintf("%s-interruption", run.RunID), iw.pollInterval)
+	if err != nil {
+		_ = iw.log.Log("level", "error", "message", "unable to set lock", "error", fmt.Sprintf("%+v", err))
+		return true
+	}
+	return set
+}
@@ -0,0 +1,77 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	gklog "github.com/go-kit/kit/log"
+	flotillaLog "github.com/stitchfix/flotilla-os/log"
+	"github.com/stitchfix/flotilla-os/state"
+	"github.com/stitchfix/flotilla-os/testutils"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func setUpInterruptionWorkerTest(t *testing.T) (*interruptionWorker, *testutils.ImplementsAllTheThings) {
+	l := gklog.NewLogfmtLogger(gklog.NewSyncWriter(os.Stderr))
+	imp := testutils.ImplementsAllTheThings{
+		T: t,
+		Runs: map[string]state.Run{
+			"runA": {RunID: "runA", ClusterName: "A", Status: state.StatusRunning},
+		},
+	}
+	return &interruptionWorker{
+		sm:           &imp,
+		log:          flotillaLog.NewLogger(l, nil),
+		jobNamespace: "flotilla",
+		gracePeriod:  120,
+		maxResubmits: 3,
+	}, &imp
+}
+
+func TestInterruptionWorker_interrupt(t *testing.T) {
+	ctx := context.Background()
+	iw, imp := setUpInterruptionWorkerTest(t)
+	kClient := fake.NewSimpleClientset(&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "runA", Namespace: "flotilla"}})
+
+	iw.interrupt(ctx, kClient, imp.Runs["runA"], "node-a", "karpenter.sh/disrupted")
+
+	if _, err := kClient.BatchV1().Jobs("flotilla").Get(ctx, "runA", metav1.GetOptions{}); err == nil {
+		t.Errorf("Expected the job of the interrupted run to be deleted")
+	}
+	run := imp.Runs["runA"]
+	if run.Status != state.StatusNeedsRetry {
+		t.Errorf("Expected interrupted run to need a retry but was [%s]", run.Status)
+	}
+	if run.Attempts.Count(state.AttemptSpotInterrupted) != 1 {
+		t.Errorf("Expected the interrupted attempt to be recorded")
+	}
+
+	// A job which is already gone counts as deleted.
+	imp.Runs["runB"] = state.Run{RunID: "runB", ClusterName: "A", Status: state.StatusRunning}
+	iw.interrupt(ctx, kClient, imp.Runs["runB"], "node-a", "karpenter.sh/disrupted")
+	if imp.Runs["runB"].Status != state.StatusNeedsRetry {
+		t.Errorf("Expected run without a job to need a retry but was [%s]", imp.Runs["runB"].Status)
+	}
+}
+
+func TestInterruptionWorker_interruptDeleteFailure(t *testing.T) {
+	ctx := context.Background()
+	iw, imp := setUpInterruptionWorkerTest(t)
+	kClient := fake.NewSimpleClientset(&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "runA", Namespace: "flotilla"}})
+	kClient.PrependReactor("delete", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("api unavailable")
+	})
+
+	iw.interrupt(ctx, kClient, imp.Runs["runA"], "node-a", "karpenter.sh/disrupted")
+
+	run := imp.Runs["runA"]
+	if run.Status != state.StatusRunning || run.Attempts != nil {
+		t.Errorf("Expected run to be left running until its job is deleted, was [%s] with attempts %v", run.Status, run.Attempts)
+	}
+}
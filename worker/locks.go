@@ -0,0 +1,89 @@
+package worker
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	flotillaLog "github.com/stitchfix/flotilla-os/log"
+)
+
+// releaseLockScript deletes a lock only when it's still held by the holder,
+// so a lock which expired and was taken by another worker is left alone.
+var releaseLockScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0
+`)
+
+// redisLocks are the redis locks taken by a worker. They're released when the
+// worker drains so other instances don't wait for them to expire.
+type redisLocks struct {
+	client    *redis.Client
+	holder    string
+	mu        sync.Mutex
+	held      map[string]time.Time
+	lastPrune time.Time
+}
+
+func newRedisLocks(client *redis.Client, holder string) *redisLocks {
+	return &redisLocks{client: client, holder: holder, held: map[string]time.Time{}}
+}
+
+// acquire takes the lock for the expiration unless it's already held.
+func (l *redisLocks) acquire(key string, expiration time.Duration) (bool, error) {
+	set, err := l.client.SetNX(key, l.holder, expiration).Result()
+	if err != nil || !set {
+		return set, err
+	}
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.held[key] = now.Add(expiration)
+	if now.Sub(l.lastPrune) > time.Minute {
+		for k, expiresAt := range l.held {
+			if expiresAt.Before(now) {
+				delete(l.held, k)
+			}
+		}
+		l.lastPrune = now
+	}
+	return true, nil
+}
+
+// releaseAll releases the unexpired locks taken by the worker, returning how
+// many were released.
+func (l *redisLocks) releaseAll() (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	released := 0
+	now := time.Now()
+	for key, expiresAt := range l.held {
+		delete(l.held, key)
+		if expiresAt.Before(now) {
+			continue
+		}
+		n, err := releaseLockScript.Run(l.client, []string{key}, l.holder).Int()
+		if err != nil {
+			return released, err
+		}
+		released += n
+	}
+	return released, nil
+}
+
+// releaseLocks releases the locks of a draining worker, without redis there
+// are none.
+func releaseLocks(locks *redisLocks, log flotillaLog.Logger) {
+	if locks == nil || locks.client == nil {
+		return
+	}
+	released, err := locks.releaseAll()
+	if err != nil {
+		_ = log.Log("level", "error", "message", "unable to release locks", "error", fmt.Sprintf("%+v", err))
+		return
+	}
+	_ = log.Log("level", "info", "message", "released locks", "holder", locks.holder, "count", released)
+}
@@ -0,0 +1,155 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/stitchfix/flotilla-os/clients/metrics"
+	"github.com/stitchfix/flotilla-os/config"
+	"github.com/stitchfix/flotilla-os/execution/engine"
+	flotillaLog "github.com/stitchfix/flotilla-os/log"
+	"github.com/stitchfix/flotilla-os/queue"
+	"github.com/stitchfix/flotilla-os/state"
+	"github.com/stitchfix/flotilla-os/utils"
+	"gopkg.in/tomb.v2"
+)
+
+// metricsWorker periodically reports gauges of the state of flotilla: the
+// active runs per cluster and status, and the depth of each queue.
+type metricsWorker struct {
+	leaderWorker
+	sm           state.Manager
+	qm           queue.Manager
+	conf         config.Config
+	log          flotillaLog.Logger
+	pollInterval time.Duration
+	t            tomb.Tomb
+	// tags of the run counts last reported, reset to zero once they have no
+	// active runs anymore
+	reported map[string][]string
+	// tags of the queue depths last reported
+	reportedQueues [][]string
+}
+
+func (mw *metricsWorker) Initialize(conf config.Config, sm state.Manager, eksEngine engine.Engine, emrEngine engine.Engine, log flotillaLog.Logger, pollInterval time.Duration, qm queue.Manager, clusterManager *engine.DynamicClusterManager) error {
+	mw.pollInterval = pollInterval
+	if mw.pollInterval == 0 {
+		mw.pollInterval = 30 * time.Second
+	}
+	mw.conf = conf
+	mw.sm = sm
+	mw.qm = qm
+	mw.log = log
+	mw.reported = map[string][]string{}
+	_ = mw.log.Log("level", "info", "message", "initialized a metrics worker")
+	return nil
+}
+
+func (mw *metricsWorker) GetTomb() *tomb.Tomb {
+	return &mw.t
+}
+
+// Run reports the gauges every poll interval
+func (mw *metricsWorker) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-mw.t.Dying():
+			mw.resetGauges()
+			_ = mw.log.Log("level", "info", "message", "A metrics worker was terminated")
+			return nil
+		default:
+			mw.poll(ctx)
+			sleepUnlessDying(&mw.t, mw.pollInterval)
+		}
+	}
+}
+
+// poll reports the gauges while this instance leads. Once it doesn't, the
+// leader reports them and the ones of this instance go back to zero, so that
+// they aren't left at their last value.
+func (mw *metricsWorker) poll(ctx context.Context) {
+	if mw.leads() {
+		mw.runOnce(ctx)
+		return
+	}
+	mw.resetGauges()
+}
+
+// resetGauges zeroes the gauges last reported by this instance.
+func (mw *metricsWorker) resetGauges() {
+	for _, tags := range mw.reported {
+		_ = metrics.Gauge(metrics.RunsActive, 0, tags, 1)
+	}
+	for _, tags := range mw.reportedQueues {
+		_ = metrics.Gauge(metrics.QueueDepth, 0, tags, 1)
+	}
+	mw.reported = map[string][]string{}
+	mw.reportedQueues = nil
+}
+
+func (mw *metricsWorker) runOnce(ctx context.Context) {
+	ctx, span := utils.TraceJob(ctx, "flotilla.metrics_worker.poll", "metrics_worker")
+	defer span.Finish()
+
+	if err := mw.reportRuns(ctx); err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		_ = mw.log.Log("level", "error", "message", "unable to report active runs", "error", fmt.Sprintf("%+v", err))
+	}
+	if mw.qm != nil {
+		if err := mw.reportQueues(); err != nil {
+			span.SetTag("error", true)
+			span.SetTag("error.msg", err.Error())
+			_ = mw.log.Log("level", "error", "message", "unable to report queue depths", "error", fmt.Sprintf("%+v", err))
+		}
+	}
+}
+
+func (mw *metricsWorker) reportRuns(ctx context.Context) error {
+	counts, err := mw.sm.CountActiveRuns(ctx)
+	if err != nil {
+		return err
+	}
+
+	reported := make(map[string][]string, len(counts))
+	for _, count := range counts {
+		tags := []string{
+			fmt.Sprintf("cluster:%s", count.ClusterName),
+			fmt.Sprintf("engine:%s", count.Engine),
+			fmt.Sprintf("status:%s", count.Status),
+		}
+		key := strings.Join(tags, ",")
+		reported[key] = tags
+		_ = metrics.Gauge(metrics.RunsActive, float64(count.Runs), tags, 1)
+	}
+	for key, tags := range mw.reported {
+		if _, ok := reported[key]; !ok {
+			_ = metrics.Gauge(metrics.RunsActive, 0, tags, 1)
+		}
+	}
+	mw.reported = reported
+	return nil
+}
+
+func (mw *metricsWorker) reportQueues() error {
+	qURLs, err := mw.qm.List()
+	if err != nil {
+		return err
+	}
+	reported := make([][]string, 0, len(qURLs))
+	for _, qURL := range qURLs {
+		depth, err := mw.qm.Depth(qURL)
+		if err != nil {
+			_ = mw.log.Log("level", "error", "message", "unable to get queue depth", "queue", qURL, "error", err.Error())
+			continue
+		}
+		tags := []string{fmt.Sprintf("queue:%s", path.Base(qURL))}
+		reported = append(reported, tags)
+		_ = metrics.Gauge(metrics.QueueDepth, float64(depth), tags, 1)
+	}
+	mw.reportedQueues = reported
+	return nil
+}
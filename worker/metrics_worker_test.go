@@ -0,0 +1,83 @@
+package worker
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	gklog "github.com/go-kit/kit/log"
+	flotillaLog "github.com/stitchfix/flotilla-os/log"
+	"github.com/stitchfix/flotilla-os/state"
+	"github.com/stitchfix/flotilla-os/testutils"
+)
+
+func TestMetricsWorker_ReportRuns(t *testing.T) {
+	l := gklog.NewLogfmtLogger(gklog.NewSyncWriter(os.Stderr))
+	eks := state.EKSEngine
+	imp := testutils.ImplementsAllTheThings{
+		T: t,
+		Runs: map[string]state.Run{
+			"runA": {RunID: "runA", ClusterName: "A", Engine: &eks, Status: state.StatusRunning},
+			"runB": {RunID: "runB", ClusterName: "A", Engine: &eks, Status: state.StatusRunning},
+			"runC": {RunID: "runC", ClusterName: "B", Engine: &eks, Status: state.StatusQueued},
+			"runD": {RunID: "runD", ClusterName: "B", Engine: &eks, Status: state.StatusStopped},
+		},
+	}
+	mw := &metricsWorker{}
+	if err := mw.Initialize(nil, &imp, nil, nil, flotillaLog.NewLogger(l, nil), 0, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mw.reportRuns(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(mw.reported) != 2 {
+		t.Errorf("expected the runs of 2 clusters and statuses to be reported, got %v", mw.reported)
+	}
+
+	imp.Runs = map[string]state.Run{}
+	if err := mw.reportRuns(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(mw.reported) != 0 {
+		t.Errorf("expected the run counts to be reset once there are no active runs, got %v", mw.reported)
+	}
+}
+
+func TestMetricsWorker_ResetGauges(t *testing.T) {
+	ctx := context.Background()
+	l := gklog.NewLogfmtLogger(gklog.NewSyncWriter(os.Stderr))
+	eks := state.EKSEngine
+	imp := testutils.ImplementsAllTheThings{
+		T: t,
+		Runs: map[string]state.Run{
+			"runA": {RunID: "runA", ClusterName: "A", Engine: &eks, Status: state.StatusRunning},
+		},
+	}
+	mw := &metricsWorker{}
+	if err := mw.Initialize(nil, &imp, nil, nil, flotillaLog.NewLogger(l, nil), 0, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	mw.setTopology(&topology{leaderUntil: time.Now().Add(time.Minute)})
+
+	mw.poll(ctx)
+	if len(mw.reported) != 1 {
+		t.Fatalf("expected the leader to report the active runs, got %v", mw.reported)
+	}
+	mw.topology.leaderUntil = time.Now().Add(-time.Second)
+	mw.poll(ctx)
+	if len(mw.reported) != 0 {
+		t.Errorf("expected the gauges to be reset once the lease is lost, got %v", mw.reported)
+	}
+
+	mw.topology.leaderUntil = time.Now().Add(time.Minute)
+	mw.poll(ctx)
+	mw.t.Kill(nil)
+	if err := mw.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(mw.reported) != 0 {
+		t.Errorf("expected the gauges to be reset once the worker stops, got %v", mw.reported)
+	}
+}
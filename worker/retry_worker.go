@@ -15,6 +15,7 @@ import (
 )
 
 type retryWorker struct {
+	leaderWorker
 	sm             state.Manager
 	ee             engine.Engine
 	conf           config.Config
@@ -47,8 +48,10 @@ func (rw *retryWorker) Run(ctx context.Context) error {
 			rw.log.Log("level", "info", "message", "A retry worker was terminated")
 			return nil
 		default:
-			rw.runOnce(ctx)
-			time.Sleep(rw.pollInterval)
+			if rw.leads() {
+				rw.runOnce(ctx)
+			}
+			sleepUnlessDying(&rw.t, rw.pollInterval)
 		}
 	}
 }
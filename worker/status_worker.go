@@ -7,6 +7,8 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/go-redis/redis"
 	"github.com/pkg/errors"
+	"github.com/stitchfix/flotilla-os/clients/artifacts"
+	"github.com/stitchfix/flotilla-os/clients/logs"
 	"github.com/stitchfix/flotilla-os/clients/metrics"
 	"github.com/stitchfix/flotilla-os/config"
 	"github.com/stitchfix/flotilla-os/execution/engine"
@@ -14,12 +16,12 @@ import (
 	"github.com/stitchfix/flotilla-os/queue"
 	"github.com/stitchfix/flotilla-os/state"
 	"github.com/stitchfix/flotilla-os/utils"
-	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 	"gopkg.in/tomb.v2"
 	"io/ioutil"
 	"math/rand"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -35,8 +37,14 @@ type statusWorker struct {
 	workerId                 string
 	exceptionExtractorClient *http.Client
 	exceptionExtractorUrl    string
+	exceptionExtractor       *logs.ExceptionExtractor
 	emrEngine                engine.Engine
 	clusterManager           *engine.DynamicClusterManager
+	artifactsClient          artifacts.Client
+	stuckRunDetector         *state.StuckRunDetector
+	topology                 *topology
+	locks                    *redisLocks
+	inflight                 sync.WaitGroup
 }
 
 func (sw *statusWorker) Initialize(conf config.Config, sm state.Manager, eksEngine engine.Engine, emrEngine engine.Engine, log flotillaLog.Logger, pollInterval time.Duration, qm queue.Manager, clusterManager *engine.DynamicClusterManager) error {
@@ -54,8 +62,28 @@ func (sw *statusWorker) Initialize(conf config.Config, sm state.Manager, eksEngi
 			Timeout: time.Second * 5,
 		}
 		sw.exceptionExtractorUrl = sw.conf.GetString("eks_exception_extractor_url")
+	} else if sw.conf.GetBool("eks_exception_extractor_enabled") {
+		lc, err := logs.NewLogsClient(conf, log, "eks")
+		if err != nil {
+			return errors.Wrap(err, "problem initializing exception extractor logs client")
+		}
+		tailLines := 2000
+		if sw.conf.IsSet("eks_exception_extractor_tail_lines") {
+			tailLines = sw.conf.GetInt("eks_exception_extractor_tail_lines")
+		}
+		sw.exceptionExtractor = logs.NewExceptionExtractor(lc, tailLines)
+	}
+	artifactsClient, err := artifacts.NewArtifactsClient(conf, log)
+	if err != nil {
+		return errors.Wrap(err, "problem initializing artifacts client")
+	}
+	sw.artifactsClient = artifactsClient
+	sw.stuckRunDetector, err = state.NewStuckRunDetector(conf)
+	if err != nil {
+		return errors.Wrap(err, "problem initializing stuck run detector")
 	}
 	sw.redisClient, _ = utils.SetupRedisClient(conf)
+	sw.locks = newRedisLocks(sw.redisClient, sw.workerId)
 	_ = sw.log.Log("level", "info", "message", "initialized a status worker")
 	return nil
 }
@@ -64,11 +92,31 @@ func (sw *statusWorker) GetTomb() *tomb.Tomb {
 	return &sw.t
 }
 
+func (sw *statusWorker) setTopology(t *topology) {
+	sw.topology = t
+}
+
+// ownedRuns are the runs in this instance's shard, all of them without a
+// topology.
+func (sw *statusWorker) ownedRuns(runs []state.Run) []state.Run {
+	if sw.topology == nil {
+		return runs
+	}
+	var owned []state.Run
+	for _, run := range runs {
+		if sw.topology.Owns(run.RunID) {
+			owned = append(owned, run)
+		}
+	}
+	return owned
+}
+
 // Run updates status of tasks
 func (sw *statusWorker) Run(ctx context.Context) error {
 	for {
 		select {
 		case <-sw.t.Dying():
+			sw.drain()
 			sw.log.Log("level", "info", "message", "A status worker was terminated")
 			return nil
 		default:
@@ -76,7 +124,7 @@ func (sw *statusWorker) Run(ctx context.Context) error {
 				sw.runOnceEKS(ctx)
 				sw.runTimeouts(ctx)
 			}
-			time.Sleep(sw.pollInterval)
+			sleepUnlessDying(&sw.t, sw.pollInterval)
 		}
 	}
 }
@@ -96,13 +144,13 @@ func (sw *statusWorker) runTimeouts(ctx context.Context) {
 		_ = sw.log.Log("level", "error", "message", "unable to receive runs", "error", fmt.Sprintf("%+v", err))
 		return
 	}
-	runs := rl.Runs
+	runs := sw.ownedRuns(rl.Runs)
 	sw.processTimeouts(runs)
 }
 
 func (sw *statusWorker) processTimeouts(runs []state.Run) {
 	ctx := context.Background()
-	span, ctx := tracer.StartSpanFromContext(ctx, "flotilla.job.timeout_check")
+	ctx, span := utils.TraceJob(ctx, "flotilla.job.timeout_check", "")
 	defer span.Finish()
 	timeoutCount := 0
 	for _, run := range runs {
@@ -147,7 +195,7 @@ func (sw *statusWorker) runOnceEKS(ctx context.Context) {
 		_ = sw.log.Log("level", "error", "message", "unable to receive runs", "error", fmt.Sprintf("%+v", err))
 		return
 	}
-	runs := rl.Runs
+	runs := sw.ownedRuns(rl.Runs)
 	sw.processEKSRuns(ctx, runs)
 }
 
@@ -174,7 +222,9 @@ func (sw *statusWorker) processEKSRuns(ctx context.Context, runs []state.Run) {
 
 	for _, run := range lockedRuns {
 		runCopy := run
+		sw.inflight.Add(1)
 		go func() {
+			defer sw.inflight.Done()
 			runCtx, runSpan := utils.TraceJob(ctx, "flotilla.job.status_check", runCopy.RunID)
 			defer runSpan.Finish()
 
@@ -187,6 +237,9 @@ func (sw *statusWorker) processEKSRuns(ctx context.Context, runs []state.Run) {
 	}
 }
 
+// acquireLock keeps the status workers of this instance from processing a run
+// at once. Runs are sharded across instances, so failing open on Redis errors
+// only risks a run being processed twice by this instance.
 func (sw *statusWorker) acquireLock(run state.Run, purpose string, expiration time.Duration) bool {
 	start := time.Now()
 	key := fmt.Sprintf("%s-%s", run.RunID, purpose)
@@ -194,7 +247,7 @@ func (sw *statusWorker) acquireLock(run state.Run, purpose string, expiration ti
 	if err == nil && ttl.Nanoseconds() < 0 {
 		_, err = sw.redisClient.Del(key).Result()
 	}
-	set, err := sw.redisClient.SetNX(key, sw.workerId, expiration).Result()
+	set, err := sw.locks.acquire(key, expiration)
 	if err != nil {
 		_ = sw.log.Log("level", "error", "message", "unable to set lock", "error", fmt.Sprintf("%+v", err))
 		return true
@@ -203,6 +256,13 @@ func (sw *statusWorker) acquireLock(run state.Run, purpose string, expiration ti
 	return set
 }
 
+// drain waits for the in-flight status updates, then releases the locks of
+// their runs so the workers taking over don't wait for them to expire.
+func (sw *statusWorker) drain() {
+	sw.inflight.Wait()
+	releaseLocks(sw.locks, sw.log)
+}
+
 func (sw *statusWorker) processEKSRun(ctx context.Context, run state.Run) {
 	ctx, span := utils.TraceJob(ctx, "flotilla.job.status_check", run.RunID)
 	defer span.Finish()
@@ -262,6 +322,12 @@ func (sw *statusWorker) processEKSRun(ctx context.Context, run state.Run) {
 		}
 
 	} else {
+		if sw.stuckRunDetector != nil {
+			if stuck := sw.stuckRunDetector.Detect(updatedRun, time.Now()); stuck != nil && sw.remediateStuckRun(ctx, updatedRun, *stuck) {
+				return
+			}
+		}
+
 		fullUpdate := false
 
 		if run.PodName != nil {
@@ -275,8 +341,7 @@ func (sw *statusWorker) processEKSRun(ctx context.Context, run state.Run) {
 			if updatedRun.ExitCode != nil {
 				go sw.cleanupRun(ctx, run.RunID)
 			}
-			_, err = sw.sm.UpdateRun(ctx, updatedRun.RunID, updatedRun)
-			if err != nil {
+			if err = sw.saveStatusChange(ctx, updatedRun); err != nil {
 				_ = sw.log.Log("level", "error", "message", "unable to save eks runs", "error", fmt.Sprintf("%+v", err))
 			}
 
@@ -304,6 +369,25 @@ func (sw *statusWorker) processEKSRun(ctx context.Context, run state.Run) {
 	}
 }
 
+// saveStatusChange saves the run whose status changed, then starts the work
+// which reads its final state back: only once it's persisted, so that they
+// don't race it.
+func (sw *statusWorker) saveStatusChange(ctx context.Context, updatedRun state.Run) error {
+	if _, err := sw.sm.UpdateRun(ctx, updatedRun.RunID, updatedRun); err != nil {
+		return err
+	}
+	// The job of a stopped run is done, its output uploader has synced the
+	// run's output.
+	if updatedRun.Status == state.StatusStopped && sw.artifactsClient != nil {
+		go recordArtifacts(ctx, sw.sm, sw.artifactsClient, sw.log, updatedRun.RunID)
+	}
+	if updatedRun.ExitCode != nil && *updatedRun.ExitCode != 0 &&
+		(sw.exceptionExtractorClient != nil || sw.exceptionExtractor != nil) {
+		go sw.extractExceptions(ctx, updatedRun.RunID)
+	}
+	return nil
+}
+
 func (sw *statusWorker) cleanupRun(ctx context.Context, runID string) {
 	ctx, span := utils.TraceJob(ctx, "flotilla.job.cleanup", runID)
 	defer span.Finish()
@@ -329,6 +413,12 @@ func (sw *statusWorker) extractExceptions(ctx context.Context, runID string) {
 		span.SetTag("error.msg", err.Error())
 		return
 	}
+
+	if sw.exceptionExtractor != nil {
+		sw.extractExceptionsFromLogs(ctx, run)
+		return
+	}
+
 	jobUrl := fmt.Sprintf("%s/extract/%s", sw.exceptionExtractorUrl, run.RunID)
 	res, err := sw.exceptionExtractorClient.Get(jobUrl)
 	if err != nil {
@@ -350,6 +440,67 @@ func (sw *statusWorker) extractExceptions(ctx context.Context, runID string) {
 	}
 }
 
+// extractExceptionsFromLogs runs the built-in exception extractor over the
+// logs of the run and replaces generic exit reasons with the root exception.
+func (sw *statusWorker) extractExceptionsFromLogs(ctx context.Context, run state.Run) {
+	ctx, span := utils.TraceJob(ctx, "flotilla.job.extract_exceptions_from_logs", run.RunID)
+	defer span.Finish()
+
+	if run.ExecutableType == nil {
+		defaultExecutableType := state.ExecutableTypeDefinition
+		run.ExecutableType = &defaultExecutableType
+	}
+	if run.ExecutableID == nil {
+		run.ExecutableID = &run.DefinitionID
+	}
+	executable, err := sw.sm.GetExecutableByTypeAndID(ctx, *run.ExecutableType, *run.ExecutableID)
+	if err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		return
+	}
+
+	structured, err := sw.exceptionExtractor.Extract(executable, run)
+	if err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		_ = sw.log.Log("level", "error", "message", "unable to extract exceptions", "run_id", run.RunID, "error", err.Error())
+		return
+	}
+	span.SetTag("job.exceptions", len(structured))
+	if len(structured) == 0 {
+		return
+	}
+
+	runExceptions := structured.RunExceptions()
+	update := state.Run{
+		RunExceptions:        &runExceptions,
+		StructuredExceptions: &structured,
+	}
+	// Extraction reads the whole log, look at the exit reason as it is now.
+	if current, err := sw.sm.GetRun(ctx, run.RunID); err == nil {
+		run.ExitReason = current.ExitReason
+	}
+	if sw.isGenericExitReason(run.ExitReason) {
+		exitReason := state.ExitReasonFromStructuredExceptions(structured)
+		update.ExitReason = &exitReason
+	}
+	if _, err = sw.sm.UpdateRun(ctx, run.RunID, update); err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+	}
+}
+
+// isGenericExitReason reports whether the exit reason carries no more
+// information than the pod failing, eg. "Error" or "Pod Exited".
+func (sw *statusWorker) isGenericExitReason(exitReason *string) bool {
+	if exitReason == nil {
+		return true
+	}
+	reason := strings.TrimSpace(*exitReason)
+	return len(reason) == 0 || reason == "Error" || strings.HasPrefix(reason, "Pod ")
+}
+
 func (sw *statusWorker) processEKSRunMetrics(ctx context.Context, run state.Run) {
 	ctx, span := utils.TraceJob(ctx, "flotilla.job.metrics_check", run.RunID)
 	defer span.Finish()
@@ -1,13 +1,18 @@
 package worker
 
 import (
+	"context"
+	"errors"
 	gklog "github.com/go-kit/kit/log"
+	"github.com/stitchfix/flotilla-os/clients/artifacts"
+	"github.com/stitchfix/flotilla-os/clients/logs"
 	"github.com/stitchfix/flotilla-os/config"
 	flotillaLog "github.com/stitchfix/flotilla-os/log"
 	"github.com/stitchfix/flotilla-os/state"
 	"github.com/stitchfix/flotilla-os/testutils"
 	"os"
 	"testing"
+	"time"
 )
 
 func setUpStatusWorkerTest(t *testing.T) (*statusWorker, *testutils.ImplementsAllTheThings) {
@@ -121,3 +126,90 @@ func setUpStatusWorkerTest2(t *testing.T) (*statusWorker, *testutils.ImplementsA
 		conf: c,
 	}, &imp
 }
+
+func TestStatusWorker_extractExceptionsFromLogs(t *testing.T) {
+	sw, imp := setUpStatusWorkerTest(t)
+	oomKilled := "OOMKilled"
+	imp.Definitions = map[string]state.Definition{"somedef": {DefinitionID: "somedef"}}
+	imp.LogLines = []logs.LogLine{
+		{Line: 0, Stream: "stderr", Log: "Traceback (most recent call last):\n"},
+		{Line: 1, Stream: "stderr", Log: "  File \"/app/job.py\", line 42, in run\n"},
+		{Line: 2, Stream: "stderr", Log: "ValueError: bad input\n"},
+	}
+	sw.exceptionExtractor = logs.NewExceptionExtractor(imp, 100)
+
+	// The stored run already has a specific exit reason, the passed one is stale.
+	imp.Runs["somerun"] = state.Run{RunID: "somerun", DefinitionID: "somedef", ExitReason: &oomKilled}
+	sw.extractExceptionsFromLogs(context.Background(), state.Run{RunID: "somerun", DefinitionID: "somedef"})
+
+	run := imp.Runs["somerun"]
+	if run.StructuredExceptions == nil || len(*run.StructuredExceptions) != 1 {
+		t.Fatalf("Expected 1 structured exception but was %v", run.StructuredExceptions)
+	}
+	if run.ExitReason == nil || *run.ExitReason != oomKilled {
+		t.Errorf("Expected exit reason [%s] to be kept but was %v", oomKilled, run.ExitReason)
+	}
+
+	// A generic exit reason is replaced by the root exception.
+	generic := "Error"
+	imp.Runs["somerun"] = state.Run{RunID: "somerun", DefinitionID: "somedef", ExitReason: &generic}
+	sw.extractExceptionsFromLogs(context.Background(), imp.Runs["somerun"])
+	run = imp.Runs["somerun"]
+	if run.ExitReason == nil || *run.ExitReason == generic {
+		t.Errorf("Expected generic exit reason to be replaced but was %v", run.ExitReason)
+	}
+}
+
+// manifestRecorder is an artifacts client recording the status the run had
+// in state when its artifacts were listed.
+type manifestRecorder struct {
+	artifacts.Client
+	sm     state.Manager
+	listed chan string
+}
+
+func (mr *manifestRecorder) Manifest(ctx context.Context, runID string) (state.ArtifactManifest, error) {
+	run, _ := mr.sm.GetRun(ctx, runID)
+	mr.listed <- run.Status
+	return state.ArtifactManifest{}, nil
+}
+
+// failingUpdates is a state manager unable to update runs.
+type failingUpdates struct {
+	*testutils.ImplementsAllTheThings
+}
+
+func (fu failingUpdates) UpdateRun(ctx context.Context, runID string, updates state.Run) (state.Run, error) {
+	return state.Run{}, errors.New("database unavailable")
+}
+
+func TestStatusWorker_saveStatusChangeRecordsArtifacts(t *testing.T) {
+	sw, imp := setUpStatusWorkerTest(t)
+	recorder := &manifestRecorder{sm: imp, listed: make(chan string, 1)}
+	sw.artifactsClient = recorder
+	exitCode := int64(0)
+	stopped := state.Run{RunID: "somerun", Status: state.StatusStopped, ExitCode: &exitCode}
+
+	sw.sm = failingUpdates{imp}
+	if err := sw.saveStatusChange(context.Background(), stopped); err == nil {
+		t.Fatal("expected the update to fail")
+	}
+	select {
+	case status := <-recorder.listed:
+		t.Fatalf("expected no artifacts to be recorded when the run isn't saved, listed with status %s", status)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	sw.sm = imp
+	if err := sw.saveStatusChange(context.Background(), stopped); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case status := <-recorder.listed:
+		if status != state.StatusStopped {
+			t.Errorf("expected the artifacts to be recorded once the run is saved as stopped, was %s", status)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the artifacts of the stopped run to be recorded")
+	}
+}
@@ -0,0 +1,97 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/stitchfix/flotilla-os/clients/metrics"
+	"github.com/stitchfix/flotilla-os/state"
+	"github.com/stitchfix/flotilla-os/utils"
+)
+
+// remediateStuckRun applies the action of the pattern the run is stuck on:
+// the run is stopped with the reason it was stuck, or its attempt is recorded
+// and it's sent back to the retry worker for another cluster or on-demand
+// nodes. Runs resubmitted too many times are stopped. The run is only updated
+// once its job is deleted. It returns whether the run was updated.
+func (sw *statusWorker) remediateStuckRun(ctx context.Context, run state.Run, stuck state.StuckRun) bool {
+	ctx, span := utils.TraceJob(ctx, "flotilla.job.stuck", run.RunID)
+	defer span.Finish()
+	utils.TagJobRun(span, run)
+	span.SetTag("job.stuck_pattern", stuck.Pattern.Name)
+
+	now := time.Now()
+	action := stuck.Pattern.Action
+	var update state.Run
+	switch action {
+	case state.StuckActionResubmit, state.StuckActionOndemand:
+		if run.Attempts.Count(state.AttemptStuck) >= sw.stuckRunDetector.MaxResubmits {
+			action = state.StuckActionFail
+			break
+		}
+		cluster := state.ClusterMetadata{Name: run.ClusterName}
+		if action == state.StuckActionResubmit {
+			clusters, err := sw.sm.ListClusterStates(ctx)
+			if err != nil {
+				_ = sw.log.Log("level", "error", "message", "unable to list clusters for stuck run", "run_id", run.RunID, "error", fmt.Sprintf("%+v", err))
+				return false
+			}
+			var ok bool
+			if cluster, ok = state.StuckRunCluster(run, clusters); !ok {
+				// Nowhere else to go, the run keeps waiting
+				span.SetTag("job.stuck_remediated", false)
+				return false
+			}
+		} else if run.NodeLifecycle != nil && *run.NodeLifecycle == state.OndemandLifecycle {
+			span.SetTag("job.stuck_remediated", false)
+			return false
+		}
+		update = state.StuckRunUpdate(run, stuck, cluster, action == state.StuckActionOndemand, now)
+	case state.StuckActionFail:
+		// Stopped below
+	default:
+		return false
+	}
+	if action == state.StuckActionFail {
+		reason := stuck.Reason(now)
+		category := stuck.Pattern.Category
+		update = state.Run{
+			Status:          state.StatusStopped,
+			FinishedAt:      &now,
+			ExitReason:      &reason,
+			FailureCategory: &category,
+		}
+	}
+
+	// The job goes first, so that a run is never resubmitted, or stopped,
+	// while its job could still start. It's tried again on the next poll.
+	if err := sw.ee.Terminate(ctx, run); err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		_ = sw.log.Log("level", "error", "message", "unable to terminate stuck run", "run_id", run.RunID, "error", fmt.Sprintf("%+v", err))
+		return false
+	}
+	if _, err := sw.sm.UpdateRun(ctx, run.RunID, update); err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.msg", err.Error())
+		_ = sw.log.Log("level", "error", "message", "unable to remediate stuck run", "run_id", run.RunID, "error", fmt.Sprintf("%+v", err))
+		return false
+	}
+
+	span.SetTag("job.stuck_action", string(action))
+	_ = metrics.Increment(metrics.RunStuck, []string{
+		fmt.Sprintf("pattern:%s", stuck.Pattern.Name),
+		fmt.Sprintf("action:%s", action),
+		fmt.Sprintf("cluster:%s", run.ClusterName),
+	}, 1)
+	_ = sw.log.Log(
+		"level", "info",
+		"message", "remediated stuck run",
+		"run_id", run.RunID,
+		"pattern", stuck.Pattern.Name,
+		"action", string(action),
+		"cluster", update.ClusterName,
+		"reason", stuck.Reason(now))
+	return true
+}
@@ -0,0 +1,87 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stitchfix/flotilla-os/state"
+)
+
+func TestStatusWorker_RemediateStuckRun(t *testing.T) {
+	sw, imp := setUpStatusWorkerTest(t)
+	sw.stuckRunDetector, _ = state.NewStuckRunDetector(nil)
+	imp.ClusterStates = []state.ClusterMetadata{
+		{Name: "a", Status: state.StatusActive},
+		{Name: "b", Status: state.StatusActive},
+	}
+	queuedAt := time.Now().Add(-time.Hour)
+	eventAt := time.Now().Add(-45 * time.Minute)
+	run := state.Run{RunID: "somerun", Status: state.StatusPending, ClusterName: "a", QueuedAt: &queuedAt, PodEvents: &state.PodEvents{
+		{Timestamp: &eventAt, Reason: "FailedScheduling", Message: "0/3 nodes are available"},
+	}}
+	imp.Runs["somerun"] = run
+
+	stuck := sw.stuckRunDetector.Detect(run, time.Now())
+	if stuck == nil || stuck.Pattern.Name != "unschedulable" {
+		t.Fatalf("expected the run to be unschedulable, got %+v", stuck)
+	}
+	if sw.remediateStuckRun(context.Background(), run, *stuck) {
+		t.Errorf("expected runs stuck on patterns without action to be left alone")
+	}
+
+	stuck.Pattern.Action = state.StuckActionResubmit
+	imp.TerminateError = errors.New("unable to delete job")
+	if sw.remediateStuckRun(context.Background(), run, *stuck) {
+		t.Errorf("expected the run to be left alone while its job can't be deleted")
+	}
+	if imp.Runs["somerun"].Status != state.StatusPending {
+		t.Errorf("expected the run to stay pending, got %+v", imp.Runs["somerun"])
+	}
+
+	imp.TerminateError = nil
+	if !sw.remediateStuckRun(context.Background(), run, *stuck) {
+		t.Fatalf("expected the run to be resubmitted")
+	}
+	updated := imp.Runs["somerun"]
+	if updated.Status != state.StatusNeedsRetry || updated.ClusterName != "b" || updated.Attempts.Count(state.AttemptStuck) != 1 {
+		t.Errorf("expected the run to be resubmitted to the other cluster, got %+v", updated)
+	}
+
+	stuck.Pattern.Action = state.StuckActionOndemand
+	sw.stuckRunDetector.MaxResubmits = 1
+	if !sw.remediateStuckRun(context.Background(), updated, *stuck) {
+		t.Fatalf("expected the run to be stopped")
+	}
+	updated = imp.Runs["somerun"]
+	if updated.Status != state.StatusStopped || *updated.FailureCategory != state.FailureCategoryScheduling || updated.ExitReason == nil {
+		t.Errorf("expected runs resubmitted too many times to be stopped, got %+v", updated)
+	}
+}
+
+func TestStatusWorker_RemediateStuckRunFail(t *testing.T) {
+	sw, imp := setUpStatusWorkerTest(t)
+	sw.stuckRunDetector, _ = state.NewStuckRunDetector(nil)
+	queuedAt := time.Now().Add(-time.Hour)
+	eventAt := time.Now().Add(-20 * time.Minute)
+	run := state.Run{RunID: "somerun", Status: state.StatusPending, ClusterName: "a", QueuedAt: &queuedAt, PodEvents: &state.PodEvents{
+		{Timestamp: &eventAt, Reason: "ImagePullBackOff", Message: "Back-off pulling image \"nope:1\""},
+	}}
+	imp.Runs["somerun"] = run
+
+	stuck := sw.stuckRunDetector.Detect(run, time.Now())
+	if stuck == nil || stuck.Pattern.Name != "image_pull" {
+		t.Fatalf("expected the run to be stuck pulling its image, got %+v", stuck)
+	}
+	if !sw.remediateStuckRun(context.Background(), run, *stuck) {
+		t.Fatalf("expected the run to be stopped")
+	}
+	updated := imp.Runs["somerun"]
+	if updated.Status != state.StatusStopped || *updated.FailureCategory != state.FailureCategoryImagePull || updated.ExitReason == nil {
+		t.Errorf("expected the run to be stopped with the reason it was stuck, got %+v", updated)
+	}
+	if updated.Attempts.Count(state.AttemptStuck) != 0 {
+		t.Errorf("expected no resubmitted attempt to be recorded, got %+v", updated.Attempts)
+	}
+}
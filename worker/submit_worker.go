@@ -6,7 +6,6 @@ import (
 	"github.com/stitchfix/flotilla-os/tracing"
 
 	"github.com/stitchfix/flotilla-os/utils"
-	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 	"time"
 
 	"github.com/go-redis/redis"
@@ -56,7 +55,7 @@ func (sw *submitWorker) Run(ctx context.Context) error {
 			return nil
 		default:
 			sw.runOnce(ctx)
-			time.Sleep(sw.pollInterval)
+			sleepUnlessDying(&sw.t, sw.pollInterval)
 		}
 	}
 }
@@ -77,34 +76,24 @@ func (sw *submitWorker) runOnce(ctx context.Context) {
 		sw.log.Log("level", "error", "message", "Error receiving runs", "error", fmt.Sprintf("%+v", err))
 	}
 	for _, runReceipt := range receipts {
+		// Once draining, the runs left are neither submitted nor acked, they
+		// become visible on the queue again for the other instances.
+		if !sw.t.Alive() {
+			break
+		}
 		if runReceipt.Run == nil {
 			continue
 		}
 		sw.log.Log("level", "info", "message", "Processing run receipt",
 			"run_id", runReceipt.Run.RunID,
-			"has_trace_context", runReceipt.TraceID != 0 && runReceipt.ParentID != 0,
-			"trace_id", runReceipt.TraceID,
-			"parent_id", runReceipt.ParentID)
-
-		var runCtx context.Context
-		if runReceipt.RunReceipt.TraceID != 0 && runReceipt.RunReceipt.ParentID != 0 {
-			carrier := tracing.TextMapCarrier{
-				"x-datadog-trace-id":          fmt.Sprintf("%d", runReceipt.TraceID),
-				"x-datadog-parent-id":         fmt.Sprintf("%d", runReceipt.ParentID),
-				"x-datadog-sampling-priority": fmt.Sprintf("%d", runReceipt.SamplingPriority),
-			}
-			spanCtx, err := tracer.Extract(carrier)
-			if err != nil {
-				sw.log.Log("level", "error", "message", "Error extracting span context", "error", err.Error())
-				runCtx = ctx
-			} else {
-				bridgeSpan := tracer.StartSpan("flotilla.queue.sqs_receive", tracer.ChildOf(spanCtx))
-				bridgeSpan.SetTag("run_id", runReceipt.Run.RunID)
-				runCtx = tracer.ContextWithSpan(ctx, bridgeSpan)
-				defer bridgeSpan.Finish()
-			}
-		} else {
-			runCtx = ctx
+			"has_trace_context", len(runReceipt.TraceContext) > 0)
+
+		runCtx := ctx
+		if len(runReceipt.TraceContext) > 0 {
+			var bridgeSpan tracing.Span
+			runCtx, bridgeSpan = tracing.StartRemoteSpan(ctx, "flotilla.queue.sqs_receive", runReceipt.TraceContext)
+			bridgeSpan.SetTag("run_id", runReceipt.Run.RunID)
+			defer bridgeSpan.Finish()
 		}
 		runCtx, childSpan := utils.TraceJob(runCtx, "flotilla.job.submit_worker.process", "")
 		childSpan.SetTag("job.run_id", runReceipt.Run.RunID)
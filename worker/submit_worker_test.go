@@ -213,3 +213,19 @@ func TestSubmitWorker_Run5(t *testing.T) {
 		}
 	}
 }
+
+func TestSubmitWorker_Draining(t *testing.T) {
+	// Test that a draining worker neither submits nor acks the runs it received
+	worker, imp := setUpSubmitWorkerTest1(t)
+	worker.t.Kill(nil)
+	worker.runOnce(context.Background())
+
+	expected := []string{"PollRuns", "PollRuns"}
+	if len(imp.Calls) != len(expected) {
+		t.Errorf("Unexpected number of run calls, expected %v but was %v", expected, imp.Calls)
+	}
+	run, _ := imp.GetRun(context.Background(), "run:cupcake")
+	if run.Status != state.StatusQueued {
+		t.Errorf("Expected the run to stay queued for another instance")
+	}
+}
@@ -0,0 +1,145 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/stitchfix/flotilla-os/config"
+	"github.com/stitchfix/flotilla-os/state"
+)
+
+// topology is this instance's view of the worker topology. Each refresh
+// heartbeats the instance, takes or renews the leader lease and places the
+// live instances on the hash ring the status sweeps are sharded with.
+type topology struct {
+	sm         state.Manager
+	instanceID string
+	hostname   string
+	startedAt  time.Time
+	ttl        time.Duration
+
+	mu          sync.RWMutex
+	ring        *state.HashRing
+	leaderUntil time.Time
+}
+
+// topologyAware workers are given the instance's topology by the worker
+// manager before they start.
+type topologyAware interface {
+	setTopology(t *topology)
+}
+
+// leaderWorker is embedded by the workers which only run on the leader. They
+// check that this instance still leads before each poll: the worker manager
+// only stops them on its next poll, possibly after another instance took
+// over the lease.
+type leaderWorker struct {
+	topology *topology
+}
+
+func (lw *leaderWorker) setTopology(t *topology) {
+	lw.topology = t
+}
+
+// leads is whether the worker may poll, always when it runs outside of the
+// worker manager.
+func (lw *leaderWorker) leads() bool {
+	return lw.topology == nil || lw.topology.IsLeader()
+}
+
+// newTopology sets up the topology of this instance, alone on its ring until
+// it's refreshed.
+func newTopology(conf config.Config, sm state.Manager) (*topology, error) {
+	ttl, err := state.WorkerTopologyTTL(conf)
+	if err != nil {
+		return nil, err
+	}
+	hostname, _ := os.Hostname()
+	t := &topology{
+		sm:         sm,
+		hostname:   hostname,
+		instanceID: fmt.Sprintf("%s-%d", hostname, rand.Int63()),
+		startedAt:  time.Now(),
+		ttl:        ttl,
+	}
+	t.ring = state.NewHashRing([]string{t.instanceID}, state.HashRingReplicas)
+	return t, nil
+}
+
+// refresh heartbeats the instance with the workers it runs, then takes or
+// renews the leader lease and rebuilds the ring from the live instances.
+// This instance is always on its ring, so an instance unable to list the
+// others keeps sweeping its runs rather than leaving them unswept.
+func (t *topology) refresh(ctx context.Context, workers state.WorkerCounts) error {
+	start := time.Now()
+	if err := t.sm.HeartbeatWorkerInstance(ctx, state.WorkerInstance{
+		InstanceID: t.instanceID,
+		Hostname:   t.hostname,
+		StartedAt:  t.startedAt,
+		Workers:    workers,
+	}); err != nil {
+		return err
+	}
+
+	lease, err := t.sm.AcquireWorkerLease(ctx, state.WorkerLeaderLease, t.instanceID, t.ttl)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	if lease.Holder == t.instanceID {
+		// Measured from before the lease was renewed, the leader steps down
+		// before any other instance can take the lease
+		t.leaderUntil = start.Add(t.ttl)
+	} else {
+		t.leaderUntil = time.Time{}
+	}
+	t.mu.Unlock()
+
+	instances, err := t.sm.ListWorkerInstances(ctx, t.ttl)
+	if err != nil {
+		return err
+	}
+	members := []string{t.instanceID}
+	for _, i := range instances {
+		if i.InstanceID != t.instanceID {
+			members = append(members, i.InstanceID)
+		}
+	}
+	ring := state.NewHashRing(members, state.HashRingReplicas)
+	t.mu.Lock()
+	t.ring = ring
+	t.mu.Unlock()
+	return nil
+}
+
+// IsLeader is whether this instance holds an unexpired leader lease. It
+// fails closed: a leader unable to renew its lease steps down once it
+// expires.
+func (t *topology) IsLeader() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return time.Now().Before(t.leaderUntil)
+}
+
+// Owns is whether the run is in this instance's shard.
+func (t *topology) Owns(runID string) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.ring.Owner(runID) == t.instanceID
+}
+
+// leave takes this instance out of the topology and gives up its leader
+// lease.
+func (t *topology) leave(ctx context.Context) error {
+	t.mu.Lock()
+	t.leaderUntil = time.Time{}
+	t.mu.Unlock()
+	if err := t.sm.ReleaseWorkerLease(ctx, state.WorkerLeaderLease, t.instanceID); err != nil {
+		return err
+	}
+	return t.sm.DeleteWorkerInstance(ctx, t.instanceID)
+}
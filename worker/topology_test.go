@@ -0,0 +1,158 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	gklog "github.com/go-kit/kit/log"
+	"github.com/stitchfix/flotilla-os/config"
+	"github.com/stitchfix/flotilla-os/execution/engine"
+	flotillaLog "github.com/stitchfix/flotilla-os/log"
+	"github.com/stitchfix/flotilla-os/queue"
+	"github.com/stitchfix/flotilla-os/state"
+	"github.com/stitchfix/flotilla-os/testutils"
+	"gopkg.in/tomb.v2"
+)
+
+func TestTopology(t *testing.T) {
+	imp := testutils.ImplementsAllTheThings{T: t}
+	a, _ := newTopology(nil, &imp)
+	b, _ := newTopology(nil, &imp)
+	if !a.Owns("run") {
+		t.Errorf("expected an instance alone on its ring to own every run")
+	}
+
+	ctx := context.Background()
+	for _, topology := range []*topology{a, b, a} {
+		if err := topology.refresh(ctx, state.WorkerCounts{"status": 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !a.IsLeader() || b.IsLeader() {
+		t.Errorf("expected the first instance to be the only leader")
+	}
+	for i := 0; i < 100; i++ {
+		runID := fmt.Sprintf("run-%d", i)
+		if a.Owns(runID) == b.Owns(runID) {
+			t.Fatalf("expected run %s to be owned by exactly one instance", runID)
+		}
+	}
+
+	// The leader stops renewing its lease, another instance takes over
+	lease := imp.WorkerLeases[state.WorkerLeaderLease]
+	lease.ExpiresAt = time.Now().Add(-time.Second)
+	imp.WorkerLeases[state.WorkerLeaderLease] = lease
+	a.leaderUntil = lease.ExpiresAt
+	if err := b.refresh(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	if a.IsLeader() || !b.IsLeader() {
+		t.Errorf("expected the leader to fail over")
+	}
+}
+
+func TestWorkerManager_DesiredWorkerCount(t *testing.T) {
+	imp := testutils.ImplementsAllTheThings{T: t}
+	wm := &workerManager{}
+	wm.topology, _ = newTopology(nil, &imp)
+	status := state.Worker{WorkerType: "status", CountPerInstance: 2, Scope: state.WorkerScopeInstance}
+	retry := state.Worker{WorkerType: "retry", CountPerInstance: 1, Scope: state.WorkerScopeLeader}
+
+	if wm.desiredWorkerCount(status) != 2 || wm.desiredWorkerCount(retry) != 0 {
+		t.Errorf("expected only instance workers to run before the instance leads")
+	}
+	if err := wm.topology.refresh(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if wm.desiredWorkerCount(retry) != 1 {
+		t.Errorf("expected the leader workers to run on the leader")
+	}
+}
+
+// pollingWorker polls every hour until it's killed.
+type pollingWorker struct {
+	t tomb.Tomb
+}
+
+func (pw *pollingWorker) Initialize(conf config.Config, sm state.Manager, eksEngine engine.Engine, emrEngine engine.Engine, log flotillaLog.Logger, pollInterval time.Duration, qm queue.Manager, clusterManager *engine.DynamicClusterManager) error {
+	return nil
+}
+
+func (pw *pollingWorker) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-pw.t.Dying():
+			return nil
+		default:
+			sleepUnlessDying(&pw.t, time.Hour)
+		}
+	}
+}
+
+func (pw *pollingWorker) GetTomb() *tomb.Tomb {
+	return &pw.t
+}
+
+func TestWorkerManager_Drain(t *testing.T) {
+	imp := testutils.ImplementsAllTheThings{T: t}
+	wm := &workerManager{log: flotillaLog.NewLogger(gklog.NewNopLogger(), nil)}
+	wm.topology, _ = newTopology(nil, &imp)
+	if err := wm.topology.refresh(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	wk := &pollingWorker{}
+	wk.t.Go(func() error { return wk.Run(context.Background()) })
+	wm.workers = map[string][]Worker{"retry": {wk}}
+
+	done := make(chan struct{})
+	go func() {
+		wm.drain()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the workers to stop without waiting out their poll interval")
+	}
+	if wk.t.Alive() {
+		t.Errorf("expected the workers to be stopped")
+	}
+	if len(imp.WorkerLeases) != 0 || len(imp.WorkerInstances) != 0 || wm.topology.IsLeader() {
+		t.Errorf("expected the instance to leave the topology, got %v %v", imp.WorkerLeases, imp.WorkerInstances)
+	}
+}
+
+func TestLeaderWorker_Leads(t *testing.T) {
+	imp := testutils.ImplementsAllTheThings{T: t}
+	a, _ := newTopology(nil, &imp)
+	if err := a.refresh(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, wk := range []Worker{&retryWorker{}, &interruptionWorker{}, &metricsWorker{}, &analyticsWorker{}} {
+		lw, ok := wk.(interface {
+			topologyAware
+			leads() bool
+		})
+		if !ok {
+			t.Fatalf("expected %T to be a leader worker", wk)
+		}
+		if !lw.leads() {
+			t.Errorf("expected %T to poll outside of a worker manager", wk)
+		}
+		lw.setTopology(a)
+		if !lw.leads() {
+			t.Errorf("expected %T to poll on the leader", wk)
+		}
+	}
+
+	// The lease expires before the worker manager stops the leader workers
+	wk := &retryWorker{}
+	wk.setTopology(a)
+	a.leaderUntil = time.Now().Add(-time.Second)
+	if wk.leads() {
+		t.Errorf("expected leader workers to stop polling once the lease expires")
+	}
+}
@@ -36,6 +36,14 @@ func NewWorker(workerType string, log flotillaLog.Logger, conf config.Config, ek
 		worker = &workerManager{}
 	case "events":
 		worker = &eventsWorker{}
+	case "array":
+		worker = &arrayWorker{}
+	case "interruption":
+		worker = &interruptionWorker{}
+	case "metrics":
+		worker = &metricsWorker{}
+	case "analytics":
+		worker = &analyticsWorker{}
 	default:
 		return nil, errors.Errorf("no workerType [%s] exists", workerType)
 	}
@@ -56,3 +64,12 @@ func GetPollInterval(workerType string, conf config.Config) (time.Duration, erro
 	}
 	return time.ParseDuration(pollIntervalString)
 }
+
+// sleepUnlessDying waits for the poll interval, returning early once the
+// worker's tomb is dying so draining workers don't wait out their interval.
+func sleepUnlessDying(t *tomb.Tomb, interval time.Duration) {
+	select {
+	case <-t.Dying():
+	case <-time.After(interval):
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/pkg/errors"
+	"github.com/stitchfix/flotilla-os/clients/metrics"
 	"github.com/stitchfix/flotilla-os/queue"
 	"github.com/stitchfix/flotilla-os/utils"
 	"gopkg.in/tomb.v2"
@@ -27,6 +28,7 @@ type workerManager struct {
 	engine         *string
 	qm             queue.Manager
 	clusterManager *engine.DynamicClusterManager
+	topology       *topology
 }
 
 func (wm *workerManager) Initialize(
@@ -51,6 +53,14 @@ func (wm *workerManager) Initialize(
 	ctx, span := utils.TraceJob(context.Background(), "worker_manager.initialize_workers", "worker_manager")
 	defer span.Finish()
 
+	var err error
+	if wm.topology, err = newTopology(conf, sm); err != nil {
+		return err
+	}
+	if err = wm.topology.refresh(ctx, state.WorkerCounts{}); err != nil {
+		wm.log.Log("level", "error", "message", "problem refreshing worker topology", "error", err.Error())
+	}
+
 	if err := wm.InitializeWorkers(ctx); err != nil {
 		span.SetTag("error", err.Error())
 		return errors.Errorf("WorkerManager unable to initialize workers: %s", err.Error())
@@ -64,7 +74,8 @@ func (wm *workerManager) GetTomb() *tomb.Tomb {
 
 // InitializeWorkers will first check the DB for the total count per instance
 // of each worker type (retry, submit, or status), start each worker's  `Run`
-// goroutine via tomb, then append the worker to the appropriate slice.
+// goroutine via tomb, then append the worker to the appropriate slice. Leader
+// workers are only started on the leader.
 func (wm *workerManager) InitializeWorkers(ctx context.Context) error {
 	workerList, err := wm.sm.ListWorkers(ctx, state.EKSEngine)
 
@@ -76,10 +87,11 @@ func (wm *workerManager) InitializeWorkers(ctx context.Context) error {
 
 	// Iterate through list of workers.
 	for _, w := range workerList.Workers {
-		wm.workers[w.WorkerType] = make([]Worker, w.CountPerInstance)
-		for i := 0; i < w.CountPerInstance; i++ {
+		count := wm.desiredWorkerCount(w)
+		wm.workers[w.WorkerType] = make([]Worker, count)
+		for i := 0; i < count; i++ {
 			// Instantiate a new worker.
-			wk, err := NewWorker(w.WorkerType, wm.log, wm.conf, wm.eksEngine, wm.emrEngine, wm.sm, wm.qm, wm.clusterManager)
+			wk, err := wm.newWorker(w.WorkerType)
 
 			if err != nil {
 				return err
@@ -100,18 +112,30 @@ func (wm *workerManager) Run(ctx context.Context) error {
 	for {
 		select {
 		case <-wm.t.Dying():
+			wm.drain()
 			wm.log.Log("level", "info", "message", "Worker manager was terminated")
 			return nil
 		default:
 			ctx, span := utils.TraceJob(context.Background(), "worker_manager.run_once", "worker_manager")
 			wm.runOnce(ctx)
 			span.Finish()
-			time.Sleep(wm.pollInterval)
+			sleepUnlessDying(&wm.t, wm.pollInterval)
 		}
 	}
 }
 
 func (wm *workerManager) runOnce(ctx context.Context) error {
+	running := state.WorkerCounts{}
+	for workerType, workers := range wm.workers {
+		running[workerType] = len(workers)
+	}
+	if err := wm.topology.refresh(ctx, running); err != nil {
+		wm.log.Log(
+			"level", "error",
+			"message", "problem refreshing worker topology",
+			"error", err.Error())
+	}
+
 	// Check worker count via state manager.
 	workerList, err := wm.sm.ListWorkers(ctx, state.EKSEngine)
 
@@ -121,10 +145,11 @@ func (wm *workerManager) runOnce(ctx context.Context) error {
 
 	for _, w := range workerList.Workers {
 		currentWorkerCount := len(wm.workers[w.WorkerType])
+		desiredWorkerCount := wm.desiredWorkerCount(w)
 		// Is our current number of workers not the desired number of workers?
-		if currentWorkerCount != w.CountPerInstance {
+		if currentWorkerCount != desiredWorkerCount {
 
-			if err := wm.updateWorkerCount(ctx, w.WorkerType, currentWorkerCount, w.CountPerInstance); err != nil {
+			if err := wm.updateWorkerCount(ctx, w.WorkerType, currentWorkerCount, desiredWorkerCount); err != nil {
 				wm.log.Log(
 					"level", "error",
 					"message", "problem updating worker count",
@@ -133,9 +158,62 @@ func (wm *workerManager) runOnce(ctx context.Context) error {
 		}
 	}
 
+	for workerType, workers := range wm.workers {
+		_ = metrics.Gauge(metrics.WorkerCount, float64(len(workers)), []string{fmt.Sprintf("worker_type:%s", workerType)}, 1)
+	}
+	leader := 0.0
+	if wm.topology.IsLeader() {
+		leader = 1
+	}
+	_ = metrics.Gauge(metrics.WorkerLeader, leader, nil, 1)
+
 	return nil
 }
 
+// drain stops the workers and waits for them to finish their work, then
+// takes this instance out of the topology so the others take over its shard
+// and, when it led, the leader workers right away.
+func (wm *workerManager) drain() {
+	for _, workers := range wm.workers {
+		for _, wk := range workers {
+			wk.GetTomb().Kill(nil)
+		}
+	}
+	for workerType, workers := range wm.workers {
+		for _, wk := range workers {
+			if err := wk.GetTomb().Wait(); err != nil {
+				wm.log.Log("level", "error", "message", "worker stopped with an error", "type", workerType, "error", err.Error())
+			}
+		}
+	}
+	if err := wm.topology.leave(context.Background()); err != nil {
+		wm.log.Log("level", "error", "message", "problem leaving worker topology", "error", err.Error())
+	}
+}
+
+// desiredWorkerCount is the number of workers of the type this instance
+// should run: their count per instance, none of the leader workers unless
+// this instance is the leader.
+func (wm *workerManager) desiredWorkerCount(w state.Worker) int {
+	if w.Scope == state.WorkerScopeLeader && !wm.topology.IsLeader() {
+		return 0
+	}
+	return w.CountPerInstance
+}
+
+// newWorker instantiates a worker, giving it the topology when it shards its
+// work across instances.
+func (wm *workerManager) newWorker(workerType string) (Worker, error) {
+	wk, err := NewWorker(workerType, wm.log, wm.conf, wm.eksEngine, wm.emrEngine, wm.sm, wm.qm, wm.clusterManager)
+	if err != nil {
+		return nil, err
+	}
+	if ta, ok := wk.(topologyAware); ok {
+		ta.setTopology(wm.topology)
+	}
+	return wk, nil
+}
+
 func (wm *workerManager) updateWorkerCount(
 	ctx context.Context,
 	workerType string,
@@ -186,7 +264,7 @@ func (wm *workerManager) addWorker(ctx context.Context, workerType string) error
 	ctx, span := utils.TraceJob(ctx, "worker_manager.add_worker", workerType)
 	defer span.Finish()
 
-	wk, err := NewWorker(workerType, wm.log, wm.conf, wm.eksEngine, wm.emrEngine, wm.sm, wm.qm, wm.clusterManager)
+	wk, err := wm.newWorker(workerType)
 	if err != nil {
 		return err
 	}